@@ -3,6 +3,7 @@ package consumer
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 
 	amf_context "github.com/free5gc/amf/context"
@@ -13,27 +14,56 @@ import (
 	"github.com/free5gc/openapi/models"
 )
 
-func BuildUeContextCreateData(ue *amf_context.AmfUe, targetRanId models.NgRanTargetId,
-	sourceToTargetData models.N2InfoContent, pduSessionList []models.N2SmInformation,
-	n2NotifyUri string, ngapCause *models.NgApCause) models.UeContextCreateData {
+// BuildCreateUeContextRequest builds the request sent to the target AMF in the N2 handover preparation,
+// the N2 SM information of the PDU sessions to hand over are carried in the binary parts
+func BuildCreateUeContextRequest(ue *amf_context.AmfUe, targetRanId models.NgRanTargetId,
+	sourceToTargetData []byte, pduSessionList []models.N2SmInformation, n2SmInfos [][]byte,
+	n2NotifyUri string, ngapCause *models.NgApCause) (models.CreateUeContextRequest, error) {
 	var ueContextCreateData models.UeContextCreateData
+	req := models.CreateUeContextRequest{
+		JsonData: &ueContextCreateData,
+	}
 
 	ueContext := BuildUeContextModel(ue)
+	ueContext.SeafData = ue.SeafDataModel()
+	// only the 3GPP access is relocated by the N2 handover
+	ueContext.MmContextList = []models.MmContext{ue.MmContextModel(models.AccessType__3_GPP_ACCESS)}
+	ueContext.SessionContextList = ue.SessionContextListModel()
 	ueContextCreateData.UeContext = &ueContext
 	ueContextCreateData.TargetId = &targetRanId
-	ueContextCreateData.SourceToTargetData = &sourceToTargetData
+	ueContextCreateData.SourceToTargetData = &models.N2InfoContent{
+		NgapIeType: models.NgapIeType_SRC_TO_TAR_CONTAINER,
+		NgapData: &models.RefToBinaryData{
+			ContentId: "N2SourceToTarget",
+		},
+	}
+	req.BinaryDataN2Information = sourceToTargetData
+
+	binaries := amf_context.PduSessionListBinaries(&req)
+	if len(pduSessionList) > len(binaries) {
+		return req, fmt.Errorf("too many PDU sessions to hand over: %d", len(pduSessionList))
+	}
+	for i := range pduSessionList {
+		*binaries[i] = n2SmInfos[i]
+	}
 	ueContextCreateData.PduSessionList = pduSessionList
 	ueContextCreateData.N2NotifyUri = n2NotifyUri
 
 	if ue.UeRadioCapability != "" {
+		ueRadioCapability, err := hex.DecodeString(ue.UeRadioCapability)
+		if err != nil {
+			return req, err
+		}
 		ueContextCreateData.UeRadioCapability = &models.N2InfoContent{
+			NgapIeType: models.NgapIeType_UE_RADIO_CAPABILITY,
 			NgapData: &models.RefToBinaryData{
-				ContentId: ue.UeRadioCapability,
+				ContentId: "N2UeRadioCapability",
 			},
 		}
+		req.BinaryDataN2InformationExt1 = ueRadioCapability
 	}
 	ueContextCreateData.NgapCause = ngapCause
-	return ueContextCreateData
+	return req, nil
 }
 
 func BuildUeContextModel(ue *amf_context.AmfUe) (ueContext models.UeContext) {
@@ -86,11 +116,13 @@ func BuildUeContextModel(ue *amf_context.AmfUe) (ueContext models.UeContext) {
 		}
 	}
 
+	ue.EventSubscriptionsInfoLock.RLock()
 	for _, eventSub := range ue.EventSubscriptionsInfo {
 		if eventSub.EventSubscription != nil {
 			ueContext.EventSubscriptionList = append(ueContext.EventSubscriptionList, *eventSub.EventSubscription)
 		}
 	}
+	ue.EventSubscriptionsInfoLock.RUnlock()
 
 	if ue.TraceData != nil {
 		ueContext.TraceData = ue.TraceData
@@ -114,28 +146,36 @@ func buildAmPolicyReqTriggers(triggers []models.RequestTrigger) (amPolicyReqTrig
 	return
 }
 
-func CreateUEContextRequest(ue *amf_context.AmfUe, ueContextCreateData models.UeContextCreateData) (
-	ueContextCreatedData *models.UeContextCreatedData, problemDetails *models.ProblemDetails, err error) {
+// CreateUEContextRequest relocates the UE context of supi to the target AMF, it takes the target AMF URI and the
+// SUPI rather than the UE context since it waits for the target AMF outside the NGAP goroutine
+func CreateUEContextRequest(targetAmfUri, supi string, req models.CreateUeContextRequest) (
+	createUeContextResponse *models.CreateUeContextResponse, ueContextCreateError *models.UeContextCreateError,
+	err error) {
 	configuration := Namf_Communication.NewConfiguration()
-	configuration.SetBasePath(ue.TargetAmfUri)
+	configuration.SetBasePath(targetAmfUri)
 	client := Namf_Communication.NewAPIClient(configuration)
 
-	req := models.CreateUeContextRequest{
-		JsonData: &ueContextCreateData,
-	}
-	res, httpResp, localErr := client.IndividualUeContextDocumentApi.CreateUEContext(context.TODO(), ue.Guti, req)
+	res, httpResp, localErr := client.IndividualUeContextDocumentApi.CreateUEContext(context.TODO(), supi, req)
 	if localErr == nil {
-		ueContextCreatedData = res.JsonData
-		logger.ConsumerLog.Debugf("UeContextCreatedData: %+v", *ueContextCreatedData)
+		createUeContextResponse = &res
+		logger.ConsumerLog.Debugf("UeContextCreatedData: %+v", *res.JsonData)
 	} else if httpResp != nil {
 		if httpResp.Status != localErr.Error() {
 			err = localErr
 			return
 		}
-		problem := localErr.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
-		problemDetails = &problem
+		switch model := localErr.(openapi.GenericOpenAPIError).Model().(type) {
+		case models.UeContextCreateError:
+			ueContextCreateError = &model
+		case models.ProblemDetails:
+			ueContextCreateError = &models.UeContextCreateError{
+				Error: &model,
+			}
+		default:
+			err = localErr
+		}
 	} else {
-		err = openapi.ReportError("%s: server no response", ue.TargetAmfUri)
+		err = openapi.ReportError("%s: server no response", targetAmfUri)
 	}
 	return
 }
@@ -180,7 +220,7 @@ func ReleaseUEContextRequest(ue *amf_context.AmfUe, ngapCause models.NgApCause)
 
 func UEContextTransferRequest(
 	ue *amf_context.AmfUe, accessType models.AccessType, transferReason models.TransferReason) (
-	ueContextTransferRspData *models.UeContextTransferRspData, problemDetails *models.ProblemDetails, err error) {
+	ueContextTransferRsp *models.UeContextTransferResponse, problemDetails *models.ProblemDetails, err error) {
 	configuration := Namf_Communication.NewConfiguration()
 	configuration.SetBasePath(ue.TargetAmfUri)
 	client := Namf_Communication.NewAPIClient(configuration)
@@ -194,15 +234,20 @@ func UEContextTransferRequest(
 		JsonData: &ueContextTransferReqData,
 	}
 	if transferReason == models.TransferReason_INIT_REG || transferReason == models.TransferReason_MOBI_REG {
-		var buf bytes.Buffer
-		ue.RegistrationRequest.EncodeRegistrationRequest(&buf)
+		// the registration request as received lets the old AMF check its integrity
+		if ue.RegistrationRequestNasPdu != nil {
+			req.BinaryDataN1Message = ue.RegistrationRequestNasPdu
+		} else {
+			var buf bytes.Buffer
+			ue.RegistrationRequest.EncodeRegistrationRequest(&buf)
+			req.BinaryDataN1Message = buf.Bytes()
+		}
 		ueContextTransferReqData.RegRequest = &models.N1MessageContainer{
 			N1MessageClass: models.N1MessageClass__5_GMM,
 			N1MessageContent: &models.RefToBinaryData{
 				ContentId: "n1Msg",
 			},
 		}
-		req.BinaryDataN1Message = buf.Bytes()
 	}
 
 	// guti format is defined at TS 29.518 Table 6.1.3.2.2-1 5g-guti-[0-9]{5,6}[0-9a-fA-F]{14}
@@ -210,8 +255,8 @@ func UEContextTransferRequest(
 
 	res, httpResp, localErr := client.IndividualUeContextDocumentApi.UEContextTransfer(context.TODO(), ueContextId, req)
 	if localErr == nil {
-		ueContextTransferRspData = res.JsonData
-		logger.ConsumerLog.Debugf("UeContextTransferRspData: %+v", *ueContextTransferRspData)
+		ueContextTransferRsp = &res
+		logger.ConsumerLog.Debugf("UeContextTransferRspData: %+v", res.JsonData)
 	} else if httpResp != nil {
 		if httpResp.Status != localErr.Error() {
 			err = localErr
@@ -222,7 +267,7 @@ func UEContextTransferRequest(
 	} else {
 		err = openapi.ReportError("%s: server no response", ue.TargetAmfUri)
 	}
-	return ueContextTransferRspData, problemDetails, err
+	return ueContextTransferRsp, problemDetails, err
 }
 
 // This operation is called "RegistrationCompleteNotify" at TS 23.502
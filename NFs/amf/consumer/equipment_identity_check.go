@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	amf_context "github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+// EquipmentStatus of TS 29.511 6.1.6.3.3
+type EquipmentStatus string
+
+const (
+	EquipmentStatusWhitelisted EquipmentStatus = "WHITELISTED"
+	EquipmentStatusBlacklisted EquipmentStatus = "BLACKLISTED"
+	EquipmentStatusGreylisted  EquipmentStatus = "GREYLISTED"
+)
+
+// EirResponseData of TS 29.511 6.1.6.2.2
+type EirResponseData struct {
+	Status EquipmentStatus `json:"status"`
+}
+
+// EquipmentIdentityCheck invokes N5g-eir_EquipmentIdentityCheck_Get to get the status of the PEI of the UE
+// (TS 29.511 5.2.2.2), openapi has no client of the 5G-EIR
+func EquipmentIdentityCheck(ue *amf_context.AmfUe) (EquipmentStatus, *models.ProblemDetails, error) {
+	query := url.Values{}
+	query.Set("pei", ue.Pei)
+	if ue.Supi != "" {
+		query.Set("supi", ue.Supi)
+	}
+	if ue.Gpsi != "" {
+		query.Set("gpsi", ue.Gpsi)
+	}
+	reqUri := fmt.Sprintf("%s/n5g-eir-eic/v1/equipment-status?%s", ue.EirUri, query.Encode())
+
+	client := http.Client{Timeout: 5 * time.Second}
+	httpResp, err := client.Get(reqUri)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			logger.ConsumerLog.Errorf("EquipmentIdentityCheck response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+
+	if httpResp.StatusCode != http.StatusOK {
+		var problem models.ProblemDetails
+		if err := json.NewDecoder(httpResp.Body).Decode(&problem); err != nil {
+			return "", nil, fmt.Errorf("5G-EIR returned status %d", httpResp.StatusCode)
+		}
+		return "", &problem, nil
+	}
+
+	var eirResponseData EirResponseData
+	if err := json.NewDecoder(httpResp.Body).Decode(&eirResponseData); err != nil {
+		return "", nil, err
+	}
+	return eirResponseData.Status, nil, nil
+}
@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	amf_context "github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+// LmfInputData of TS 29.572 6.1.6.2.2
+type LmfInputData struct {
+	ExternalClientType models.ExternalClientType   `json:"externalClientType"`
+	CorrelationID      string                      `json:"correlationID"`
+	AmfID              string                      `json:"amfId"`
+	LocationQoS        *models.LocationQoS         `json:"locationQoS,omitempty"`
+	SupportedGADShapes []models.SupportedGadShapes `json:"supportedGADShapes,omitempty"`
+	Supi               string                      `json:"supi,omitempty"`
+	Pei                string                      `json:"pei,omitempty"`
+	Gpsi               string                      `json:"gpsi,omitempty"`
+	Ecgi               *models.Ecgi                `json:"ecgi,omitempty"`
+	Ncgi               *models.Ncgi                `json:"ncgi,omitempty"`
+	Priority           models.LcsPriority          `json:"priority,omitempty"`
+	VelocityRequested  models.VelocityRequested    `json:"velocityRequested,omitempty"`
+	SupportedFeatures  string                      `json:"supportedFeatures,omitempty"`
+}
+
+// LmfLocationData of TS 29.572 6.1.6.2.3
+type LmfLocationData struct {
+	LocationEstimate            models.GeographicArea                  `json:"locationEstimate"`
+	AccuracyFulfilmentIndicator models.AccuracyFulfilmentIndicator     `json:"accuracyFulfilmentIndicator,omitempty"`
+	AgeOfLocationEstimate       int32                                  `json:"ageOfLocationEstimate,omitempty"`
+	VelocityEstimate            *models.VelocityEstimate               `json:"velocityEstimate,omitempty"`
+	CivicAddress                *models.CivicAddress                   `json:"civicAddress,omitempty"`
+	PositioningDataList         []models.PositioningMethodAndUsage     `json:"positioningDataList,omitempty"`
+	GnssPositioningDataList     []models.GnssPositioningMethodAndUsage `json:"gnssPositioningDataList,omitempty"`
+	Ecgi                        *models.Ecgi                           `json:"ecgi,omitempty"`
+	Ncgi                        *models.Ncgi                           `json:"ncgi,omitempty"`
+	Altitude                    float32                                `json:"altitude,omitempty"`
+	BarometricPressure          int32                                  `json:"barometricPressure,omitempty"`
+	SupportedFeatures           string                                 `json:"supportedFeatures,omitempty"`
+}
+
+// DetermineLocation invokes Nlmf_Location_DetermineLocation to get the position of the UE
+// (TS 29.572 5.2.2.2), openapi has no client of the LMF
+func DetermineLocation(ue *amf_context.AmfUe, requestPosInfo models.RequestPosInfo) (
+	*LmfLocationData, *models.ProblemDetails, error) {
+	inputData := LmfInputData{
+		ExternalClientType: requestPosInfo.LcsClientType,
+		CorrelationID:      uuid.New().String(),
+		AmfID:              amf_context.AMF_Self().NfId,
+		LocationQoS:        requestPosInfo.LcsQoS,
+		Supi:               ue.Supi,
+		Pei:                ue.Pei,
+		Gpsi:               ue.Gpsi,
+		Priority:           requestPosInfo.Priority,
+		VelocityRequested:  requestPosInfo.VelocityRequested,
+		SupportedFeatures:  requestPosInfo.SupportedFeatures,
+	}
+	if requestPosInfo.LcsSupportedGADShapes != "" {
+		inputData.SupportedGADShapes = []models.SupportedGadShapes{requestPosInfo.LcsSupportedGADShapes}
+	}
+	if ue.Location.EutraLocation != nil {
+		inputData.Ecgi = ue.Location.EutraLocation.Ecgi
+	}
+	if ue.Location.NrLocation != nil {
+		inputData.Ncgi = ue.Location.NrLocation.Ncgi
+	}
+
+	body, err := json.Marshal(inputData)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqUri := fmt.Sprintf("%s/nlmf-loc/v1/determine-location", ue.LmfUri)
+
+	// positioning may take several NRPPa and LPP round trips
+	client := http.Client{Timeout: 30 * time.Second}
+	httpResp, err := client.Post(reqUri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			logger.ConsumerLog.Errorf("DetermineLocation response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+
+	if httpResp.StatusCode != http.StatusOK {
+		var problem models.ProblemDetails
+		if err := json.NewDecoder(httpResp.Body).Decode(&problem); err != nil {
+			return nil, nil, fmt.Errorf("LMF returned status %d", httpResp.StatusCode)
+		}
+		return nil, &problem, nil
+	}
+
+	var locationData LmfLocationData
+	if err := json.NewDecoder(httpResp.Body).Decode(&locationData); err != nil {
+		return nil, nil, err
+	}
+	return &locationData, nil, nil
+}
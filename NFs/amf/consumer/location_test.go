@@ -0,0 +1,105 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/free5gc/amf/consumer"
+	amf_context "github.com/free5gc/amf/context"
+	"github.com/free5gc/openapi/models"
+)
+
+// newMockLmf returns an LMF which serves Nlmf_Location_DetermineLocation with the given status and body
+func newMockLmf(t *testing.T, status int, body interface{}, inputData *consumer.LmfInputData) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/nlmf-loc/v1/determine-location" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(inputData); err != nil {
+			t.Errorf("decode InputData: %+v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Errorf("encode response: %+v", err)
+		}
+	}))
+}
+
+func TestDetermineLocation(t *testing.T) {
+	locationData := consumer.LmfLocationData{
+		LocationEstimate: models.GeographicArea{
+			Shape: models.SupportedGadShapes_POINT,
+			Point: &models.GeographicalCoordinates{Lon: 121.5, Lat: 25.0},
+		},
+		AccuracyFulfilmentIndicator: models.AccuracyFulfilmentIndicator_FULFILLED,
+		AgeOfLocationEstimate:       1,
+		Altitude:                    100,
+	}
+	var inputData consumer.LmfInputData
+	lmf := newMockLmf(t, http.StatusOK, locationData, &inputData)
+	defer lmf.Close()
+
+	ue := &amf_context.AmfUe{
+		Supi:   "imsi-208930000000003",
+		LmfUri: lmf.URL,
+		Location: models.UserLocation{
+			NrLocation: &models.NrLocation{
+				Ncgi: &models.Ncgi{
+					PlmnId:   &models.PlmnId{Mcc: "208", Mnc: "93"},
+					NrCellId: "000000010",
+				},
+			},
+		},
+	}
+	requestPosInfo := models.RequestPosInfo{
+		LcsClientType:         models.ExternalClientType_LAWFUL_INTERCEPT_SERVICES,
+		LcsLocation:           models.LocationType_CURRENT_LOCATION,
+		LcsSupportedGADShapes: models.SupportedGadShapes_POINT,
+	}
+
+	result, problemDetails, err := consumer.DetermineLocation(ue, requestPosInfo)
+	if err != nil || problemDetails != nil {
+		t.Fatalf("DetermineLocation failed: %+v %+v", err, problemDetails)
+	}
+	if result.LocationEstimate.Point == nil || result.LocationEstimate.Point.Lat != 25.0 ||
+		result.AccuracyFulfilmentIndicator != models.AccuracyFulfilmentIndicator_FULFILLED || result.Altitude != 100 {
+		t.Errorf("unexpected LocationData: %+v", result)
+	}
+
+	if inputData.Supi != ue.Supi || inputData.CorrelationID == "" ||
+		inputData.ExternalClientType != models.ExternalClientType_LAWFUL_INTERCEPT_SERVICES {
+		t.Errorf("unexpected InputData: %+v", inputData)
+	}
+	if inputData.Ncgi == nil || inputData.Ncgi.NrCellId != "000000010" {
+		t.Errorf("serving cell is not provided to the LMF: %+v", inputData.Ncgi)
+	}
+	if len(inputData.SupportedGADShapes) != 1 || inputData.SupportedGADShapes[0] != models.SupportedGadShapes_POINT {
+		t.Errorf("unexpected supported GAD shapes: %+v", inputData.SupportedGADShapes)
+	}
+}
+
+func TestDetermineLocationFailure(t *testing.T) {
+	problem := models.ProblemDetails{
+		Status: http.StatusInternalServerError,
+		Cause:  "POSITIONING_FAILED",
+	}
+	var inputData consumer.LmfInputData
+	lmf := newMockLmf(t, http.StatusInternalServerError, problem, &inputData)
+	defer lmf.Close()
+
+	ue := &amf_context.AmfUe{
+		Supi:   "imsi-208930000000003",
+		LmfUri: lmf.URL,
+	}
+
+	result, problemDetails, err := consumer.DetermineLocation(ue, models.RequestPosInfo{})
+	if err != nil {
+		t.Fatalf("DetermineLocation failed: %+v", err)
+	}
+	if result != nil || problemDetails == nil || problemDetails.Cause != "POSITIONING_FAILED" {
+		t.Errorf("unexpected result %+v, problem %+v", result, problemDetails)
+	}
+}
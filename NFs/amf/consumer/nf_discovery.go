@@ -56,6 +56,51 @@ func SearchUdmSdmInstance(ue *amf_context.AmfUe, nrfUri string, targetNfType, re
 	return nil
 }
 
+func SearchEirInstance(ue *amf_context.AmfUe, nrfUri string, targetNfType, requestNfType models.NfType,
+	param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) error {
+	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
+	if localErr != nil {
+		return localErr
+	}
+
+	// select the first 5G-EIR, TODO: select base on other info
+	var eirUri string
+	for _, nfProfile := range resp.NfInstances {
+		eirUri = util.SearchNFServiceUri(nfProfile, models.ServiceName_N5G_EIR_EIC, models.NfServiceStatus_REGISTERED)
+		if eirUri != "" {
+			break
+		}
+	}
+	ue.EirUri = eirUri
+	if ue.EirUri == "" {
+		return fmt.Errorf("AMF can not select a 5G-EIR by NRF")
+	}
+	return nil
+}
+
+func SearchLmfInstance(ue *amf_context.AmfUe, nrfUri string, targetNfType, requestNfType models.NfType,
+	param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) error {
+	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
+	if localErr != nil {
+		return localErr
+	}
+
+	// select the first LMF, TODO: select base on other info
+	var lmfUri string
+	for _, nfProfile := range resp.NfInstances {
+		ue.LmfId = nfProfile.NfInstanceId
+		lmfUri = util.SearchNFServiceUri(nfProfile, models.ServiceName_NLMF_LOC, models.NfServiceStatus_REGISTERED)
+		if lmfUri != "" {
+			break
+		}
+	}
+	ue.LmfUri = lmfUri
+	if ue.LmfUri == "" {
+		return fmt.Errorf("AMF can not select an LMF by NRF")
+	}
+	return nil
+}
+
 func SearchNssfNSSelectionInstance(ue *amf_context.AmfUe, nrfUri string, targetNfType, requestNfType models.NfType,
 	param *Nnrf_NFDiscovery.SearchNFInstancesParamOpts) error {
 	resp, localErr := SendSearchNFInstances(nrfUri, targetNfType, requestNfType, param)
@@ -87,11 +132,15 @@ func SearchAmfCommunicationInstance(ue *amf_context.AmfUe, nrfUri string, target
 		return
 	}
 
-	// select the first AMF, TODO: select base on other info
+	// select the first AMF other than this one, TODO: select base on other info
 	var amfUri string
-	for _, nfProfile := range resp.NfInstances {
-		ue.TargetAmfProfile = &nfProfile
-		amfUri = util.SearchNFServiceUri(nfProfile, models.ServiceName_NAMF_COMM, models.NfServiceStatus_REGISTERED)
+	for i := range resp.NfInstances {
+		nfProfile := &resp.NfInstances[i]
+		if nfProfile.NfInstanceId == amf_context.AMF_Self().NfId {
+			continue
+		}
+		ue.TargetAmfProfile = nfProfile
+		amfUri = util.SearchNFServiceUri(*nfProfile, models.ServiceName_NAMF_COMM, models.NfServiceStatus_REGISTERED)
 		if amfUri != "" {
 			break
 		}
@@ -166,6 +166,7 @@ func buildCreateSmContextRequest(ue *amf_context.AmfUe, smContext *amf_context.S
 	if requestType != nil {
 		smContextCreateData.RequestType = *requestType
 	}
+	smContextCreateData.OldPduSessionId = smContext.OldPduSessionID()
 	smContextCreateData.N1SmMsg = new(models.RefToBinaryData)
 	smContextCreateData.N1SmMsg.ContentId = "n1SmMsg"
 	smContextCreateData.AnType = smContext.AccessType()
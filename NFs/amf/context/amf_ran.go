@@ -3,6 +3,7 @@ package context
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -31,6 +32,9 @@ type AmfRan struct {
 	/* RAN UE List */
 	RanUeList []*RanUe // RanUeNgapId as key
 
+	/* Time To Wait of the AMF Configuration Update, received in AMF Configuration Update Failure */
+	ConfigurationUpdateWaitUntil time.Time
+
 	/* logger */
 	Log *logrus.Entry
 }
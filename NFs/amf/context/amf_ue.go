@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"reflect"
 	"regexp"
 	"sync"
@@ -60,6 +61,7 @@ type AmfUe struct {
 	RegistrationType5GS                uint8
 	IdentityTypeUsedForRegistration    uint8
 	RegistrationRequest                *nasMessage.RegistrationRequest
+	RegistrationRequestNasPdu          []byte // the registration request as received, possibly integrity protected
 	ServingAmfChanged                  bool
 	DeregistrationTargetAccessType     uint8 // only used when deregistration procedure is initialized by the network
 	RegistrationAcceptForNon3GPPAccess []byte
@@ -79,7 +81,8 @@ type AmfUe struct {
 	GroupID             string
 	EBI                 int32
 	/* Ue Identity*/
-	EventSubscriptionsInfo map[string]*AmfUeEventSubscription
+	EventSubscriptionsInfo     map[string]*AmfUeEventSubscription
+	EventSubscriptionsInfoLock sync.RWMutex
 	/* User Location*/
 	RatType                  models.RatType
 	Location                 models.UserLocation
@@ -120,6 +123,11 @@ type AmfUe struct {
 	ConfigurationUpdateMessage   []byte
 	/* UeContextForHandover*/
 	HandoverNotifyUri string
+	// result of the inter-AMF handover preparation awaited by the CreateUEContext producer
+	HandoverResult chan *HandoverResult
+	// serializes the handover state between the NGAP goroutine and the result of the CreateUEContext
+	// request, which the source AMF awaits outside of it
+	HandoverLock sync.Mutex
 	/* N1N2Message */
 	N1N2MessageIDGenerator          *idgenerator.IDGenerator
 	N1N2Message                     *N1N2Message
@@ -138,7 +146,9 @@ type AmfUe struct {
 	/* context related to Paging */
 	UeRadioCapabilityForPaging                 *UERadioCapabilityForPaging
 	InfoOnRecommendedCellsAndRanNodesForPaging *InfoOnRecommendedCellsAndRanNodesForPaging
-	UESpecificDRX                              uint8
+	UESpecificDRX                              uint8                  // negotiated DRX value (TS 24.501 9.11.3.2A)
+	RequestedExtendedDRX                       *ExtendedDRXParameters // requested in the last Registration Request
+	NegotiatedExtendedDRX                      *ExtendedDRXParameters // nil if eDRX is not used
 	/* Security Context */
 	SecurityContextAvailable bool
 	UESecurityCapability     nasType.UESecurityCapability // for security command
@@ -157,6 +167,13 @@ type AmfUe struct {
 	/* Registration Area */
 	RegistrationArea map[models.AccessType][]models.Tai
 	LadnInfo         []LADN
+	/* context about 5G-EIR */
+	EirUri string
+	/* LMF */
+	LmfId  string
+	LmfUri string
+	/* Location Reporting */
+	LocationReporting *LocationReporting
 	/* Network Slicing related context and Nssf */
 	NssfId                            string
 	NssfUri                           string
@@ -282,6 +299,18 @@ func (ue *AmfUe) Remove() {
 	}
 }
 
+func (ue *AmfUe) AddEventSubscriptionInfo(subscriptionID string, ueEventSubscription AmfUeEventSubscription) {
+	ue.EventSubscriptionsInfoLock.Lock()
+	defer ue.EventSubscriptionsInfoLock.Unlock()
+	ue.EventSubscriptionsInfo[subscriptionID] = &ueEventSubscription
+}
+
+func (ue *AmfUe) DeleteEventSubscriptionInfo(subscriptionID string) {
+	ue.EventSubscriptionsInfoLock.Lock()
+	defer ue.EventSubscriptionsInfoLock.Unlock()
+	delete(ue.EventSubscriptionsInfo, subscriptionID)
+}
+
 func (ue *AmfUe) DetachRanUe(anType models.AccessType) {
 	delete(ue.RanUe, anType)
 }
@@ -524,6 +553,7 @@ func (ue *AmfUe) SelectSecurityAlg(intOrder, encOrder []uint8) {
 
 func (ue *AmfUe) ClearRegistrationRequestData(accessType models.AccessType) {
 	ue.RegistrationRequest = nil
+	ue.RegistrationRequestNasPdu = nil
 	ue.RegistrationType5GS = 0
 	ue.IdentityTypeUsedForRegistration = 0
 	ue.AuthFailureCauseSynchFailureTimes = 0
@@ -658,6 +688,11 @@ func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 				vSmfID:       pduSessionContext.VsmfId,
 				nsInstance:   pduSessionContext.NsInstance,
 			}
+			// the SmContextRef is the URI of the SM context when the UE context is relocated
+			if smfUri, ref, err := ParseSmContextUri(pduSessionContext.SmContextRef); err == nil {
+				smContext.smfUri = smfUri
+				smContext.smContextRef = ref
+			}
 			ue.StoreSmContext(pduSessionContext.PduSessionId, &smContext)
 		}
 	}
@@ -715,9 +750,9 @@ func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 			}
 
 			if mmContext.AllowedNssai != nil {
-				for _, snssai := range mmContext.AllowedNssai {
+				for i := range mmContext.AllowedNssai {
 					allowedSnssai := models.AllowedSnssai{
-						AllowedSnssai: &snssai,
+						AllowedSnssai: &mmContext.AllowedNssai[i],
 					}
 					ue.AllowedNssai[mmContext.AccessType] = append(ue.AllowedNssai[mmContext.AccessType], allowedSnssai)
 				}
@@ -729,6 +764,68 @@ func (ue *AmfUe) CopyDataFromUeContextModel(ueContext models.UeContext) {
 	}
 }
 
+// SeafDataModel returns the security data relocated with the UE context (TS 29.518 6.1.6.2.19)
+func (ue *AmfUe) SeafDataModel() *models.SeafData {
+	if ue.Kamf == "" {
+		return nil
+	}
+	ngKsi := ue.NgKsi
+	return &models.SeafData{
+		NgKsi: &ngKsi,
+		KeyAmf: &models.KeyAmf{
+			KeyType: models.KeyAmfType_KAMF,
+			KeyVal:  ue.Kamf,
+		},
+		Nh:  hex.EncodeToString(ue.NH),
+		Ncc: int32(ue.NCC),
+	}
+}
+
+// MmContextModel returns the MM context of the access type relocated with the UE context (TS 29.518 6.1.6.2.20)
+func (ue *AmfUe) MmContextModel(anType models.AccessType) models.MmContext {
+	mmContext := models.MmContext{
+		AccessType: anType,
+	}
+	if ue.SecurityContextAvailable {
+		mmContext.NasSecurityMode = &models.NasSecurityMode{
+			IntegrityAlgorithm: models.IntegrityAlgorithm(fmt.Sprintf("NIA%d", ue.IntegrityAlg)),
+			CipheringAlgorithm: models.CipheringAlgorithm(fmt.Sprintf("NEA%d", ue.CipheringAlg)),
+		}
+		mmContext.NasDownlinkCount = int32(ue.DLCount.Get())
+		mmContext.NasUplinkCount = int32(ue.ULCount.Get())
+	}
+	if ue.UESecurityCapability.Buffer != nil {
+		mmContext.UeSecurityCapability = base64.StdEncoding.EncodeToString(ue.UESecurityCapability.Buffer)
+	}
+	for _, allowedSnssai := range ue.AllowedNssai[anType] {
+		if allowedSnssai.AllowedSnssai != nil {
+			mmContext.AllowedNssai = append(mmContext.AllowedNssai, *allowedSnssai.AllowedSnssai)
+		}
+	}
+	return mmContext
+}
+
+// SessionContextListModel returns the PDU session contexts relocated with the UE context,
+// the SmContextRef of each one is the URI of the SM context
+func (ue *AmfUe) SessionContextListModel() (sessionContextList []models.PduSessionContext) {
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*SmContext)
+		snssai := smContext.Snssai()
+		sessionContextList = append(sessionContextList, models.PduSessionContext{
+			PduSessionId: smContext.PduSessionID(),
+			SmContextRef: smContext.SmContextUri(),
+			SNssai:       &snssai,
+			Dnn:          smContext.Dnn(),
+			AccessType:   smContext.AccessType(),
+			HsmfId:       smContext.HSmfID(),
+			VsmfId:       smContext.VSmfID(),
+			NsInstance:   smContext.NsInstance(),
+		})
+		return true
+	})
+	return sessionContextList
+}
+
 // SM Context realted function
 
 func (ue *AmfUe) StoreSmContext(pduSessionID int32, smContext *SmContext) {
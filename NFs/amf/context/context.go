@@ -26,6 +26,7 @@ var (
 func init() {
 	AMF_Self().LadnPool = make(map[string]*LADN)
 	AMF_Self().EventSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
+	AMF_Self().NonUeN2InfoSubscriptionIDGenerator = idgenerator.NewGenerator(1, math.MaxInt32)
 	AMF_Self().Name = "amf"
 	AMF_Self().UriScheme = models.UriScheme_HTTPS
 	AMF_Self().RelativeCapacity = 0xff
@@ -73,6 +74,19 @@ type AMFContext struct {
 	T3550Cfg factory.TimerValue
 	T3560Cfg factory.TimerValue
 	T3565Cfg factory.TimerValue
+	// overload control of NG-RAN signalling
+	OverloadControl OverloadControl
+	// equipment identity check with the 5G-EIR
+	EquipmentIdentityCheck factory.EquipmentIdentityCheck
+	// network policy of the UE specific DRX and eDRX
+	Drx factory.Drx
+	// paging escalation from the recommended NG-RAN nodes to the registration area
+	Paging factory.Paging
+	// subscriptions of the non UE N2 information, e.g. NRPPa of the LMF
+	NonUeN2InfoSubscriptionIDGenerator *idgenerator.IDGenerator
+	NonUeN2InfoSubscriptions           sync.Map // map[subscriptionID]models.NonUeN2InfoSubscriptionCreateData
+	// trace records of the trace sessions activated by OAM (TS 32.422)
+	TraceStore TraceStore
 }
 
 type AMFContextEventSubscription struct {
@@ -395,6 +409,7 @@ func (context *AMFContext) Reset() {
 		context.DeleteEventSubscription(key.(string))
 		return true
 	})
+	context.TraceStore.Reset()
 	for key := range context.NfService {
 		delete(context.NfService, key)
 	}
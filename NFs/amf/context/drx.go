@@ -0,0 +1,146 @@
+package context
+
+import (
+	"time"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/ngap/ngapType"
+)
+
+// eDRX cycle lengths indexed by the eDRX value (TS 24.008 10.5.5.32, WB-S1 mode and NR)
+var edrxCycles = [16]time.Duration{
+	5120 * time.Millisecond,
+	10240 * time.Millisecond,
+	20480 * time.Millisecond,
+	40960 * time.Millisecond,
+	61440 * time.Millisecond,
+	81920 * time.Millisecond,
+	102400 * time.Millisecond,
+	122880 * time.Millisecond,
+	143360 * time.Millisecond,
+	163840 * time.Millisecond,
+	327680 * time.Millisecond,
+	655360 * time.Millisecond,
+	1310720 * time.Millisecond,
+	2621440 * time.Millisecond,
+	5242880 * time.Millisecond,
+	10485760 * time.Millisecond,
+}
+
+// PagingTimeWindowUnit is the length of a paging time window step (TS 24.008 10.5.5.32, WB-S1 mode and NR)
+const PagingTimeWindowUnit = 1280 * time.Millisecond
+
+// ExtendedDRXParameters is the value part of the extended DRX parameters IE (TS 24.008 10.5.5.32)
+type ExtendedDRXParameters struct {
+	PagingTimeWindow uint8 // 4 bits, the window is (value + 1) * 1.28s
+	EDRXValue        uint8 // 4 bits
+}
+
+func (e *ExtendedDRXParameters) Cycle() time.Duration {
+	return edrxCycles[e.EDRXValue&0x0f]
+}
+
+func (e *ExtendedDRXParameters) PagingTimeWindowLength() time.Duration {
+	return time.Duration(e.PagingTimeWindow&0x0f+1) * PagingTimeWindowUnit
+}
+
+// DRXCycleToNas converts a DRX cycle in radio frames to the DRX value of the DRX parameter IE
+// (TS 24.501 9.11.3.2A), a cycle which is not 32, 64, 128 or 256 is "not specified"
+func DRXCycleToNas(cycle int) uint8 {
+	switch cycle {
+	case 32:
+		return nasMessage.DRXcycleParameterT32
+	case 64:
+		return nasMessage.DRXcycleParameterT64
+	case 128:
+		return nasMessage.DRXcycleParameterT128
+	case 256:
+		return nasMessage.DRXcycleParameterT256
+	default:
+		return nasMessage.DRXValueNotSpecified
+	}
+}
+
+// DRXNasToCycle converts the DRX value of the DRX parameter IE to a DRX cycle in radio frames,
+// 0 is returned for "not specified"
+func DRXNasToCycle(drxValue uint8) int {
+	switch drxValue {
+	case nasMessage.DRXcycleParameterT32:
+		return 32
+	case nasMessage.DRXcycleParameterT64:
+		return 64
+	case nasMessage.DRXcycleParameterT128:
+		return 128
+	case nasMessage.DRXcycleParameterT256:
+		return 256
+	default:
+		return 0
+	}
+}
+
+// DRXNasToNgap converts the DRX value of the DRX parameter IE to NGAP Paging DRX (TS 38.413 9.3.1.90),
+// nil is returned for "not specified"
+func DRXNasToNgap(drxValue uint8) *ngapType.PagingDRX {
+	pagingDRX := new(ngapType.PagingDRX)
+	switch drxValue {
+	case nasMessage.DRXcycleParameterT32:
+		pagingDRX.Value = ngapType.PagingDRXPresentV32
+	case nasMessage.DRXcycleParameterT64:
+		pagingDRX.Value = ngapType.PagingDRXPresentV64
+	case nasMessage.DRXcycleParameterT128:
+		pagingDRX.Value = ngapType.PagingDRXPresentV128
+	case nasMessage.DRXcycleParameterT256:
+		pagingDRX.Value = ngapType.PagingDRXPresentV256
+	default:
+		return nil
+	}
+	return pagingDRX
+}
+
+// NegotiateDRX returns the UE specific DRX value granted to the requested one (TS 23.501 5.4.5),
+// the requested cycle is kept within the configured bounds and the default cycle is used if none is requested
+func (context *AMFContext) NegotiateDRX(requested uint8) uint8 {
+	cfg := context.Drx
+	cycle := DRXNasToCycle(requested)
+	if cycle == 0 {
+		cycle = cfg.DefaultCycle
+		if cycle == 0 {
+			return nasMessage.DRXValueNotSpecified
+		}
+	}
+	if cfg.MinCycle > 0 && cycle < cfg.MinCycle {
+		cycle = cfg.MinCycle
+	}
+	if cfg.MaxCycle > 0 && cycle > cfg.MaxCycle {
+		cycle = cfg.MaxCycle
+	}
+	return DRXCycleToNas(cycle)
+}
+
+// NegotiateExtendedDRX returns the eDRX parameters granted to the requested ones (TS 23.501 5.31.7.2),
+// nil means eDRX is not used by the UE
+func (context *AMFContext) NegotiateExtendedDRX(requested *ExtendedDRXParameters) *ExtendedDRXParameters {
+	cfg := context.Drx.Edrx
+	if requested == nil || cfg == nil || !cfg.Enable {
+		return nil
+	}
+
+	negotiated := &ExtendedDRXParameters{
+		PagingTimeWindow: requested.PagingTimeWindow & 0x0f,
+		EDRXValue:        requested.EDRXValue & 0x0f,
+	}
+	if cfg.MaxCycle > 0 {
+		if cfg.MaxCycle < edrxCycles[0] {
+			return nil
+		}
+		for negotiated.Cycle() > cfg.MaxCycle {
+			negotiated.EDRXValue--
+		}
+	}
+	if cfg.MaxPagingTimeWindow > 0 {
+		for negotiated.PagingTimeWindow > 0 && negotiated.PagingTimeWindowLength() > cfg.MaxPagingTimeWindow {
+			negotiated.PagingTimeWindow--
+		}
+	}
+	return negotiated
+}
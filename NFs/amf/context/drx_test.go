@@ -0,0 +1,85 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+func TestNegotiateDRX(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       factory.Drx
+		requested uint8
+		expected  uint8
+	}{
+		{"no policy", factory.Drx{}, nasMessage.DRXcycleParameterT64, nasMessage.DRXcycleParameterT64},
+		{"not requested without default", factory.Drx{}, nasMessage.DRXValueNotSpecified,
+			nasMessage.DRXValueNotSpecified},
+		{"not requested with default", factory.Drx{DefaultCycle: 128}, nasMessage.DRXValueNotSpecified,
+			nasMessage.DRXcycleParameterT128},
+		{"within the bounds", factory.Drx{MinCycle: 32, MaxCycle: 256}, nasMessage.DRXcycleParameterT128,
+			nasMessage.DRXcycleParameterT128},
+		{"raised to the minimum", factory.Drx{MinCycle: 64, MaxCycle: 256}, nasMessage.DRXcycleParameterT32,
+			nasMessage.DRXcycleParameterT64},
+		{"lowered to the maximum", factory.Drx{MinCycle: 32, MaxCycle: 128}, nasMessage.DRXcycleParameterT256,
+			nasMessage.DRXcycleParameterT128},
+		{"default lowered to the maximum", factory.Drx{DefaultCycle: 256, MaxCycle: 64},
+			nasMessage.DRXValueNotSpecified, nasMessage.DRXcycleParameterT64},
+	}
+	for _, tc := range testCases {
+		context := &AMFContext{Drx: tc.cfg}
+		if negotiated := context.NegotiateDRX(tc.requested); negotiated != tc.expected {
+			t.Errorf("%s: negotiated DRX %d, expected %d", tc.name, negotiated, tc.expected)
+		}
+	}
+}
+
+func TestNegotiateExtendedDRX(t *testing.T) {
+	requested := &ExtendedDRXParameters{PagingTimeWindow: 7, EDRXValue: 9} // 10.24s, 163.84s
+	testCases := []struct {
+		name      string
+		cfg       *factory.Edrx
+		requested *ExtendedDRXParameters
+		expected  *ExtendedDRXParameters
+	}{
+		{"no policy", nil, requested, nil},
+		{"disabled", &factory.Edrx{Enable: false}, requested, nil},
+		{"not requested", &factory.Edrx{Enable: true}, nil, nil},
+		{"no maximum", &factory.Edrx{Enable: true}, requested, requested},
+		{"within the maximums", &factory.Edrx{
+			Enable:              true,
+			MaxCycle:            200 * time.Second,
+			MaxPagingTimeWindow: 20 * time.Second,
+		}, requested, requested},
+		{"cycle lowered to the maximum", &factory.Edrx{
+			Enable:   true,
+			MaxCycle: 100 * time.Second,
+		}, requested, &ExtendedDRXParameters{PagingTimeWindow: 7, EDRXValue: 5}},
+		{"paging time window lowered to the maximum", &factory.Edrx{
+			Enable:              true,
+			MaxPagingTimeWindow: 5 * time.Second,
+		}, requested, &ExtendedDRXParameters{PagingTimeWindow: 2, EDRXValue: 9}},
+		{"shortest paging time window", &factory.Edrx{
+			Enable:              true,
+			MaxPagingTimeWindow: time.Second,
+		}, requested, &ExtendedDRXParameters{PagingTimeWindow: 0, EDRXValue: 9}},
+		{"maximum under the shortest cycle", &factory.Edrx{
+			Enable:   true,
+			MaxCycle: 5 * time.Second,
+		}, requested, nil},
+		{"spare bits ignored", &factory.Edrx{Enable: true},
+			&ExtendedDRXParameters{PagingTimeWindow: 0x13, EDRXValue: 0x24},
+			&ExtendedDRXParameters{PagingTimeWindow: 3, EDRXValue: 4}},
+	}
+	for _, tc := range testCases {
+		context := &AMFContext{Drx: factory.Drx{Edrx: tc.cfg}}
+		negotiated := context.NegotiateExtendedDRX(tc.requested)
+		if !reflect.DeepEqual(negotiated, tc.expected) {
+			t.Errorf("%s: negotiated eDRX %+v, expected %+v", tc.name, negotiated, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/free5gc/aper"
+	"github.com/free5gc/ngap/ngapType"
+	"github.com/free5gc/openapi/models"
+)
+
+const smContextsPath = "/nsmf-pdusession/v1/sm-contexts/"
+
+// HandoverResult is the outcome of the handover resource allocation in the target AMF,
+// used to answer the CreateUEContext request of the source AMF (TS 23.502 4.9.1.3.2 step 12)
+type HandoverResult struct {
+	Response *models.CreateUeContextResponse
+	Error    *models.UeContextCreateError
+}
+
+// SmContextUri returns the URI of the individual SM context resource, which is what the
+// SmContextRef of a PduSessionContext refers to when the UE context is relocated
+func (c *SmContext) SmContextUri() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.smfUri + smContextsPath + c.smContextRef
+}
+
+// ParseSmContextUri splits the URI of an individual SM context resource into the SMF
+// API root and the SM context reference
+func ParseSmContextUri(uri string) (smfUri string, smContextRef string, err error) {
+	idx := strings.LastIndex(uri, smContextsPath)
+	if idx <= 0 || idx+len(smContextsPath) == len(uri) {
+		return "", "", fmt.Errorf("invalid SM context URI: %s", uri)
+	}
+	return uri[:idx], uri[idx+len(smContextsPath):], nil
+}
+
+// NgapCauseToCause converts the NGAP cause of a SBI message, whose group is the
+// present value of ngapType.Cause, back to an NGAP cause
+func NgapCauseToCause(ngapCause *models.NgApCause) ngapType.Cause {
+	cause := ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: ngapType.CauseRadioNetworkPresentUnspecified,
+		},
+	}
+	if ngapCause == nil {
+		return cause
+	}
+	value := aper.Enumerated(ngapCause.Value)
+	switch int(ngapCause.Group) {
+	case ngapType.CausePresentRadioNetwork:
+		cause.RadioNetwork.Value = value
+	case ngapType.CausePresentTransport:
+		cause = ngapType.Cause{Present: ngapType.CausePresentTransport, Transport: &ngapType.CauseTransport{Value: value}}
+	case ngapType.CausePresentNas:
+		cause = ngapType.Cause{Present: ngapType.CausePresentNas, Nas: &ngapType.CauseNas{Value: value}}
+	case ngapType.CausePresentProtocol:
+		cause = ngapType.Cause{Present: ngapType.CausePresentProtocol, Protocol: &ngapType.CauseProtocol{Value: value}}
+	case ngapType.CausePresentMisc:
+		cause = ngapType.Cause{Present: ngapType.CausePresentMisc, Misc: &ngapType.CauseMisc{Value: value}}
+	}
+	return cause
+}
+
+// PduSessionListBinaries returns the binary parts carrying the N2 SM information of the
+// PduSessionList of a CreateUeContextRequest, in list order
+func PduSessionListBinaries(request *models.CreateUeContextRequest) []*[]byte {
+	return []*[]byte{
+		&request.BinaryDataN2InformationExt2, &request.BinaryDataN2InformationExt3,
+		&request.BinaryDataN2InformationExt4, &request.BinaryDataN2InformationExt5,
+		&request.BinaryDataN2InformationExt6, &request.BinaryDataN2InformationExt7,
+		&request.BinaryDataN2InformationExt8, &request.BinaryDataN2InformationExt9,
+		&request.BinaryDataN2InformationExt10, &request.BinaryDataN2InformationExt11,
+		&request.BinaryDataN2InformationExt12, &request.BinaryDataN2InformationExt13,
+		&request.BinaryDataN2InformationExt14, &request.BinaryDataN2InformationExt15,
+		&request.BinaryDataN2InformationExt16,
+	}
+}
+
+// CreatedPduSessionListBinaries returns the binary parts carrying the N2 SM information
+// of the PduSessionList of a CreateUeContextResponse, in list order
+func CreatedPduSessionListBinaries(response *models.CreateUeContextResponse) []*[]byte {
+	return []*[]byte{
+		&response.BinaryDataN2InformationExt1, &response.BinaryDataN2InformationExt2,
+		&response.BinaryDataN2InformationExt3, &response.BinaryDataN2InformationExt4,
+		&response.BinaryDataN2InformationExt5, &response.BinaryDataN2InformationExt6,
+		&response.BinaryDataN2InformationExt7, &response.BinaryDataN2InformationExt8,
+	}
+}
+
+// FailedSessionListBinaries returns the binary parts carrying the N2 SM information of
+// the FailedSessionList of a CreateUeContextResponse, in list order
+func FailedSessionListBinaries(response *models.CreateUeContextResponse) []*[]byte {
+	return []*[]byte{
+		&response.BinaryDataN2InformationExt9, &response.BinaryDataN2InformationExt10,
+		&response.BinaryDataN2InformationExt11, &response.BinaryDataN2InformationExt12,
+		&response.BinaryDataN2InformationExt13, &response.BinaryDataN2InformationExt14,
+		&response.BinaryDataN2InformationExt15,
+	}
+}
@@ -0,0 +1,20 @@
+package context
+
+import (
+	"encoding/hex"
+)
+
+// LmfIdToRoutingID returns the Routing ID (hex) which identifies the LMF towards the NG-RAN (TS 38.413 9.3.3.13),
+// the NF instance ID of the LMF is carried so the NRPPa PDUs are routed back without a mapping table
+func LmfIdToRoutingID(lmfID string) string {
+	return hex.EncodeToString([]byte(lmfID))
+}
+
+// RoutingIDToLmfId returns the NF instance ID of the LMF identified by the Routing ID (hex)
+func RoutingIDToLmfId(routingID string) (string, error) {
+	lmfID, err := hex.DecodeString(routingID)
+	if err != nil {
+		return "", err
+	}
+	return string(lmfID), nil
+}
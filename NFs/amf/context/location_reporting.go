@@ -0,0 +1,91 @@
+package context
+
+import (
+	"github.com/free5gc/aper"
+	"github.com/free5gc/ngap/ngapType"
+	"github.com/free5gc/openapi/models"
+)
+
+// LocationReporting is the location reporting requested to the NG-RAN for the UE (TS 23.502 4.10),
+// it is cleared when the NG-RAN is asked to stop the reporting or the UE enters CM-IDLE
+type LocationReporting struct {
+	EventType          aper.Enumerated // ngapType.EventTypePresentChangeOfServeCell or UePresenceInAreaOfInterest
+	AreaOfInterestList []ngapType.AreaOfInterestItem
+}
+
+// UpdateLocationReporting records the location reporting of the Location Reporting Control sent to the NG-RAN
+// (TS 38.413 8.12.1), direct reporting is a single report and is not recorded
+func (ue *AmfUe) UpdateLocationReporting(eventType aper.Enumerated, aoiList *ngapType.AreaOfInterestList,
+	referenceIDToBeCancelled int64) {
+	switch eventType {
+	case ngapType.EventTypePresentChangeOfServeCell:
+		ue.LocationReporting = &LocationReporting{EventType: eventType}
+	case ngapType.EventTypePresentUePresenceInAreaOfInterest:
+		if ue.LocationReporting == nil || ue.LocationReporting.EventType != eventType {
+			ue.LocationReporting = &LocationReporting{EventType: eventType}
+		}
+		if aoiList != nil {
+			ue.LocationReporting.AreaOfInterestList = append(ue.LocationReporting.AreaOfInterestList, aoiList.List...)
+		}
+	case ngapType.EventTypePresentStopChangeOfServeCell:
+		if ue.LocationReporting != nil && ue.LocationReporting.EventType == ngapType.EventTypePresentChangeOfServeCell {
+			ue.ClearLocationReporting()
+		}
+	case ngapType.EventTypePresentStopUePresenceInAreaOfInterest:
+		ue.removeLocationReportingAreaOfInterest(referenceIDToBeCancelled)
+	case ngapType.EventTypePresentCancelLocationReportingForTheUe:
+		ue.ClearLocationReporting()
+	}
+}
+
+func (ue *AmfUe) removeLocationReportingAreaOfInterest(referenceID int64) {
+	reporting := ue.LocationReporting
+	if reporting == nil || reporting.EventType != ngapType.EventTypePresentUePresenceInAreaOfInterest {
+		return
+	}
+	for i, item := range reporting.AreaOfInterestList {
+		if item.LocationReportingReferenceID.Value == referenceID {
+			reporting.AreaOfInterestList = append(reporting.AreaOfInterestList[:i],
+				reporting.AreaOfInterestList[i+1:]...)
+			break
+		}
+	}
+	if len(reporting.AreaOfInterestList) == 0 {
+		ue.ClearLocationReporting()
+	}
+}
+
+func (ue *AmfUe) ClearLocationReporting() {
+	ue.LocationReporting = nil
+}
+
+// IsReportingLocationAtChangeOfServeCell returns true if the NG-RAN reports the location of the UE
+// whenever the serving cell changes
+func (ue *AmfUe) IsReportingLocationAtChangeOfServeCell() bool {
+	return ue.LocationReporting != nil && ue.LocationReporting.EventType == ngapType.EventTypePresentChangeOfServeCell
+}
+
+// HasContinuousLocationReportSubscription returns true if any NF subscribes to the continuous LOCATION_REPORT
+// event of the UE (TS 23.502 4.15.4.2), the location is then reported by the NG-RAN at change of serving cell
+func (ue *AmfUe) HasContinuousLocationReportSubscription() bool {
+	ue.EventSubscriptionsInfoLock.RLock()
+	defer ue.EventSubscriptionsInfoLock.RUnlock()
+	for _, ueSubscription := range ue.EventSubscriptionsInfo {
+		subscription := ueSubscription.EventSubscription
+		if subscription == nil || subscription.EventList == nil {
+			continue
+		}
+		if subscription.Options == nil || subscription.Options.Trigger != models.AmfEventTrigger_CONTINUOUS {
+			continue
+		}
+		if ueSubscription.RemainReports != nil && *ueSubscription.RemainReports <= 0 {
+			continue
+		}
+		for _, event := range *subscription.EventList {
+			if event.Type == models.AmfEventType_LOCATION_REPORT {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/ngap/ngapType"
+)
+
+const (
+	OverloadActionRejectNonEmergencyMoDt      = "rejectNonEmergencyMoDt"
+	OverloadActionRejectRrcCrSignalling       = "rejectRrcCrSignalling"
+	OverloadActionPermitEmergencyAndMtOnly    = "permitEmergencySessionsAndMobileTerminatedServicesOnly"
+	OverloadActionPermitHighPriorityAndMtOnly = "permitHighPrioritySessionsAndMobileTerminatedServicesOnly"
+)
+
+// RRC establishment causes (TS 38.413 9.3.1.111) admitted under overload
+const (
+	rrcEstablishmentCauseEmergency          = "0"
+	rrcEstablishmentCauseHighPriorityAccess = "1"
+	rrcEstablishmentCauseMtAccess           = "2"
+	rrcEstablishmentCauseMpsPriorityAccess  = "8"
+	rrcEstablishmentCauseMcsPriorityAccess  = "9"
+)
+
+const (
+	overloadStateNormal int32 = iota
+	overloadStateOverloaded
+)
+
+// Load is the load of the AMF measured in a check interval
+type Load struct {
+	UeNum      int
+	NasRate    int
+	QueueDepth int
+}
+
+// OverloadControl tracks the load of the AMF against the configured thresholds,
+// the NG-RANs are asked to reduce the signalling with NGAP Overload Start while it is overloaded
+type OverloadControl struct {
+	Cfg factory.OverloadControl
+
+	nasCount   int64 // uplink NAS messages since the last check
+	queueDepth int64 // NGAP messages being handled
+	state      int32
+
+	mu        sync.Mutex
+	lastCheck time.Time
+}
+
+func (oc *OverloadControl) Enabled() bool {
+	return oc.Cfg.Enable
+}
+
+func (oc *OverloadControl) IsOverloaded() bool {
+	return atomic.LoadInt32(&oc.state) == overloadStateOverloaded
+}
+
+func (oc *OverloadControl) CountNasMessage() {
+	atomic.AddInt64(&oc.nasCount, 1)
+}
+
+func (oc *OverloadControl) EnterNgapMessage() {
+	atomic.AddInt64(&oc.queueDepth, 1)
+}
+
+func (oc *OverloadControl) LeaveNgapMessage() {
+	atomic.AddInt64(&oc.queueDepth, -1)
+}
+
+// Check measures the load and updates the overload state, changed is true if the AMF
+// enters or leaves the overload
+func (oc *OverloadControl) Check(ueNum int) (load Load, changed bool) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	now := time.Now()
+	nasCount := atomic.SwapInt64(&oc.nasCount, 0)
+	if elapsed := now.Sub(oc.lastCheck); !oc.lastCheck.IsZero() && elapsed > 0 {
+		load.NasRate = int(float64(nasCount) / elapsed.Seconds())
+	}
+	oc.lastCheck = now
+	load.UeNum = ueNum
+	load.QueueDepth = int(atomic.LoadInt64(&oc.queueDepth))
+
+	if oc.IsOverloaded() {
+		// hysteresis: all the loads have to fall under the stop ratio of their thresholds
+		if !oc.exceed(load, oc.Cfg.StopRatio) {
+			atomic.StoreInt32(&oc.state, overloadStateNormal)
+			changed = true
+		}
+	} else if oc.exceed(load, 100) {
+		atomic.StoreInt32(&oc.state, overloadStateOverloaded)
+		changed = true
+	}
+	return load, changed
+}
+
+func (oc *OverloadControl) exceed(load Load, ratio int) bool {
+	exceed := func(value, threshold int) bool {
+		return threshold > 0 && value*100 >= threshold*ratio
+	}
+	return exceed(load.UeNum, oc.Cfg.MaxUeNum) || exceed(load.NasRate, oc.Cfg.MaxNasRate) ||
+		exceed(load.QueueDepth, oc.Cfg.MaxQueueDepth)
+}
+
+// OverloadResponse returns the overload action requested to the NG-RAN in NGAP Overload Start
+func (oc *OverloadControl) OverloadResponse() *ngapType.OverloadResponse {
+	action := new(ngapType.OverloadAction)
+	switch oc.Cfg.OverloadAction {
+	case OverloadActionRejectNonEmergencyMoDt:
+		action.Value = ngapType.OverloadActionPresentRejectNonEmergencyMoDt
+	case OverloadActionPermitEmergencyAndMtOnly:
+		action.Value = ngapType.OverloadActionPresentPermitEmergencySessionsAndMobileTerminatedServicesOnly
+	case OverloadActionPermitHighPriorityAndMtOnly:
+		action.Value = ngapType.OverloadActionPresentPermitHighPrioritySessionsAndMobileTerminatedServicesOnly
+	default:
+		action.Value = ngapType.OverloadActionPresentRejectRrcCrSignalling
+	}
+	return &ngapType.OverloadResponse{
+		Present:        ngapType.OverloadResponsePresentOverloadAction,
+		OverloadAction: action,
+	}
+}
+
+// TimeToWait returns the configured time to wait rounded up to a value of the NGAP Time To Wait IE
+func (oc *OverloadControl) TimeToWait() *ngapType.TimeToWait {
+	return DurationToTimeToWait(oc.Cfg.TimeToWait)
+}
+
+// Admit reports whether a UE with the RRC establishment cause may start a procedure,
+// only emergency, high priority and mobile terminated accesses are admitted under overload
+func (oc *OverloadControl) Admit(rrcEstablishmentCause string) bool {
+	if !oc.IsOverloaded() {
+		return true
+	}
+	switch rrcEstablishmentCause {
+	case rrcEstablishmentCauseEmergency, rrcEstablishmentCauseHighPriorityAccess, rrcEstablishmentCauseMtAccess,
+		rrcEstablishmentCauseMpsPriorityAccess, rrcEstablishmentCauseMcsPriorityAccess:
+		return true
+	}
+	return false
+}
+
+// DurationToTimeToWait rounds the duration up to a value of the NGAP Time To Wait IE
+func DurationToTimeToWait(d time.Duration) *ngapType.TimeToWait {
+	timeToWait := new(ngapType.TimeToWait)
+	switch {
+	case d <= time.Second:
+		timeToWait.Value = ngapType.TimeToWaitPresentV1s
+	case d <= 2*time.Second:
+		timeToWait.Value = ngapType.TimeToWaitPresentV2s
+	case d <= 5*time.Second:
+		timeToWait.Value = ngapType.TimeToWaitPresentV5s
+	case d <= 10*time.Second:
+		timeToWait.Value = ngapType.TimeToWaitPresentV10s
+	case d <= 20*time.Second:
+		timeToWait.Value = ngapType.TimeToWaitPresentV20s
+	default:
+		timeToWait.Value = ngapType.TimeToWaitPresentV60s
+	}
+	return timeToWait
+}
+
+// TimeToWaitToDuration converts the NGAP Time To Wait IE to a duration
+func TimeToWaitToDuration(timeToWait ngapType.TimeToWait) time.Duration {
+	switch timeToWait.Value {
+	case ngapType.TimeToWaitPresentV1s:
+		return time.Second
+	case ngapType.TimeToWaitPresentV2s:
+		return 2 * time.Second
+	case ngapType.TimeToWaitPresentV5s:
+		return 5 * time.Second
+	case ngapType.TimeToWaitPresentV10s:
+		return 10 * time.Second
+	case ngapType.TimeToWaitPresentV20s:
+		return 20 * time.Second
+	default:
+		return 60 * time.Second
+	}
+}
+
+// RanUeNum returns the number of UE-associated NG connections
+func (context *AMFContext) RanUeNum() (num int) {
+	context.RanUePool.Range(func(key, value interface{}) bool {
+		num++
+		return true
+	})
+	return num
+}
@@ -0,0 +1,150 @@
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/aper"
+	"github.com/free5gc/ngap/ngapType"
+)
+
+func TestOverloadControlCheck(t *testing.T) {
+	oc := &OverloadControl{Cfg: factory.OverloadControl{
+		Enable:        true,
+		MaxUeNum:      10,
+		MaxQueueDepth: 5,
+		StopRatio:     80,
+	}}
+
+	steps := []struct {
+		name       string
+		ueNum      int
+		queueDepth int
+		overloaded bool
+		changed    bool
+	}{
+		{name: "under the thresholds", ueNum: 9, overloaded: false, changed: false},
+		{name: "UE number reaches the threshold", ueNum: 10, overloaded: true, changed: true},
+		{name: "still overloaded above the stop ratio", ueNum: 8, overloaded: true, changed: false},
+		{name: "UE number falls under the stop ratio", ueNum: 7, overloaded: false, changed: true},
+		{name: "queue depth reaches the threshold", ueNum: 1, queueDepth: 5, overloaded: true, changed: true},
+		{name: "queue depth falls under the stop ratio", ueNum: 1, queueDepth: 3, overloaded: false, changed: true},
+	}
+	for _, step := range steps {
+		for oc.queueDepth < int64(step.queueDepth) {
+			oc.EnterNgapMessage()
+		}
+		for oc.queueDepth > int64(step.queueDepth) {
+			oc.LeaveNgapMessage()
+		}
+		load, changed := oc.Check(step.ueNum)
+		if load.UeNum != step.ueNum || load.QueueDepth != step.queueDepth {
+			t.Errorf("%s: load %+v", step.name, load)
+		}
+		if changed != step.changed || oc.IsOverloaded() != step.overloaded {
+			t.Errorf("%s: changed %v overloaded %v, want changed %v overloaded %v",
+				step.name, changed, oc.IsOverloaded(), step.changed, step.overloaded)
+		}
+	}
+}
+
+func TestOverloadControlNasRate(t *testing.T) {
+	oc := &OverloadControl{Cfg: factory.OverloadControl{Enable: true, MaxNasRate: 5, StopRatio: 80}}
+
+	// the first check has no interval to measure the rate
+	for i := 0; i < 10; i++ {
+		oc.CountNasMessage()
+	}
+	if load, changed := oc.Check(0); load.NasRate != 0 || changed {
+		t.Fatalf("first check: load %+v changed %v", load, changed)
+	}
+
+	oc.lastCheck = time.Now().Add(-time.Second)
+	for i := 0; i < 10; i++ {
+		oc.CountNasMessage()
+	}
+	load, changed := oc.Check(0)
+	if load.NasRate < 5 || !changed || !oc.IsOverloaded() {
+		t.Fatalf("load %+v changed %v overloaded %v", load, changed, oc.IsOverloaded())
+	}
+
+	// the NAS messages are counted from the last check
+	oc.lastCheck = time.Now().Add(-time.Second)
+	load, changed = oc.Check(0)
+	if load.NasRate != 0 || !changed || oc.IsOverloaded() {
+		t.Fatalf("load %+v changed %v overloaded %v", load, changed, oc.IsOverloaded())
+	}
+}
+
+func TestOverloadControlAdmit(t *testing.T) {
+	oc := &OverloadControl{Cfg: factory.OverloadControl{Enable: true, MaxUeNum: 1}}
+	if !oc.Admit("3") {
+		t.Error("mo-Signalling is rejected without overload")
+	}
+
+	oc.Check(1)
+	for cause, admitted := range map[string]bool{
+		rrcEstablishmentCauseEmergency:          true,
+		rrcEstablishmentCauseHighPriorityAccess: true,
+		rrcEstablishmentCauseMtAccess:           true,
+		"3":                                     false, // mo-Signalling
+		"4":                                     false, // mo-Data
+		rrcEstablishmentCauseMpsPriorityAccess:  true,
+		rrcEstablishmentCauseMcsPriorityAccess:  true,
+	} {
+		if oc.Admit(cause) != admitted {
+			t.Errorf("RRC establishment cause %s: admitted %v, want %v", cause, !admitted, admitted)
+		}
+	}
+}
+
+func TestOverloadResponse(t *testing.T) {
+	testCases := []struct {
+		action string
+		value  aper.Enumerated
+	}{
+		{OverloadActionRejectNonEmergencyMoDt, ngapType.OverloadActionPresentRejectNonEmergencyMoDt},
+		{OverloadActionRejectRrcCrSignalling, ngapType.OverloadActionPresentRejectRrcCrSignalling},
+		{OverloadActionPermitEmergencyAndMtOnly,
+			ngapType.OverloadActionPresentPermitEmergencySessionsAndMobileTerminatedServicesOnly},
+		{OverloadActionPermitHighPriorityAndMtOnly,
+			ngapType.OverloadActionPresentPermitHighPrioritySessionsAndMobileTerminatedServicesOnly},
+		{"", ngapType.OverloadActionPresentRejectRrcCrSignalling},
+	}
+	for _, tc := range testCases {
+		oc := &OverloadControl{Cfg: factory.OverloadControl{OverloadAction: tc.action}}
+		response := oc.OverloadResponse()
+		if response.Present != ngapType.OverloadResponsePresentOverloadAction || response.OverloadAction == nil {
+			t.Fatalf("overload action %q: response %+v", tc.action, response)
+		}
+		if response.OverloadAction.Value != tc.value {
+			t.Errorf("overload action %q: value %d, want %d", tc.action, response.OverloadAction.Value, tc.value)
+		}
+	}
+}
+
+func TestTimeToWait(t *testing.T) {
+	testCases := []struct {
+		duration time.Duration
+		value    aper.Enumerated
+		rounded  time.Duration
+	}{
+		{0, ngapType.TimeToWaitPresentV1s, time.Second},
+		{time.Second, ngapType.TimeToWaitPresentV1s, time.Second},
+		{1500 * time.Millisecond, ngapType.TimeToWaitPresentV2s, 2 * time.Second},
+		{3 * time.Second, ngapType.TimeToWaitPresentV5s, 5 * time.Second},
+		{10 * time.Second, ngapType.TimeToWaitPresentV10s, 10 * time.Second},
+		{15 * time.Second, ngapType.TimeToWaitPresentV20s, 20 * time.Second},
+		{2 * time.Minute, ngapType.TimeToWaitPresentV60s, 60 * time.Second},
+	}
+	for _, tc := range testCases {
+		timeToWait := DurationToTimeToWait(tc.duration)
+		if timeToWait.Value != tc.value {
+			t.Errorf("%v: time to wait %d, want %d", tc.duration, timeToWait.Value, tc.value)
+		}
+		if d := TimeToWaitToDuration(*timeToWait); d != tc.rounded {
+			t.Errorf("%v: rounded to %v, want %v", tc.duration, d, tc.rounded)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package context
+
+import (
+	"reflect"
+
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+// PagingScope returns the paging area of the paging attempt (starting from 0) in the paging escalation,
+// the last paging area is used by the paging attempts after the escalation
+func (context *AMFContext) PagingScope(attempt int) string {
+	escalation := context.Paging.Escalation
+	if len(escalation) == 0 {
+		return factory.PagingScopeRegistrationArea
+	}
+	for _, step := range escalation {
+		if attempt < step.Attempts {
+			return step.Scope
+		}
+		attempt -= step.Attempts
+	}
+	return escalation[len(escalation)-1].Scope
+}
+
+// PagingRanList returns the NG-RANs the UE is paged by in the paging area (TS 23.502 4.2.3.3 step 4b),
+// the NG-RANs in the registration area are returned if no recommended NG-RAN can be used
+func (ue *AmfUe) PagingRanList(scope string) (ranList []*AmfRan, usedScope string) {
+	if scope == factory.PagingScopeRecommendedRanNodes {
+		if ranList = ue.recommendedPagingRanList(); len(ranList) > 0 {
+			return ranList, factory.PagingScopeRecommendedRanNodes
+		}
+	}
+	return ue.registrationAreaRanList(), factory.PagingScopeRegistrationArea
+}
+
+func (ue *AmfUe) registrationAreaRanList() (ranList []*AmfRan) {
+	taiList := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
+	AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*AmfRan)
+		for _, item := range ran.SupportedTAList {
+			if InTaiList(item.Tai, taiList) {
+				ranList = append(ranList, ran)
+				break
+			}
+		}
+		return true
+	})
+	return
+}
+
+// recommendedPagingRanList returns the NG-RANs in the registration area which are recommended
+// for paging in the last UE Context Release Complete (TS 38.413 9.3.1.100)
+func (ue *AmfUe) recommendedPagingRanList() (ranList []*AmfRan) {
+	info := ue.InfoOnRecommendedCellsAndRanNodesForPaging
+	if info == nil || len(info.RecommendedRanNodes) == 0 {
+		return nil
+	}
+	for _, ran := range ue.registrationAreaRanList() {
+		for _, ranNode := range info.RecommendedRanNodes {
+			if isRecommendedRan(ran, ranNode) {
+				ranList = append(ranList, ran)
+				break
+			}
+		}
+	}
+	return
+}
+
+func isRecommendedRan(ran *AmfRan, ranNode RecommendRanNode) bool {
+	switch ranNode.Present {
+	case RecommendRanNodePresentRanNode:
+		return ranNode.GlobalRanNodeId != nil && ran.RanId != nil &&
+			reflect.DeepEqual(*ranNode.GlobalRanNodeId, *ran.RanId)
+	case RecommendRanNodePresentTAI:
+		if ranNode.Tai == nil {
+			return false
+		}
+		for _, item := range ran.SupportedTAList {
+			if reflect.DeepEqual(item.Tai, *ranNode.Tai) {
+				return true
+			}
+		}
+	}
+	return false
+}
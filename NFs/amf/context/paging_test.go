@@ -0,0 +1,114 @@
+package context
+
+import (
+	"testing"
+
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestPagingScope(t *testing.T) {
+	amfSelf := AMF_Self()
+	paging := amfSelf.Paging
+	defer func() { amfSelf.Paging = paging }()
+
+	amfSelf.Paging = factory.Paging{}
+	for attempt := 0; attempt < 3; attempt++ {
+		if scope := amfSelf.PagingScope(attempt); scope != factory.PagingScopeRegistrationArea {
+			t.Errorf("no escalation, attempt %d: scope %s", attempt, scope)
+		}
+	}
+
+	amfSelf.Paging = factory.Paging{Escalation: []factory.PagingStep{
+		{Scope: factory.PagingScopeRecommendedRanNodes, Attempts: 2},
+		{Scope: factory.PagingScopeRegistrationArea, Attempts: 1},
+		{Scope: factory.PagingScopeRecommendedRanNodes, Attempts: 1},
+	}}
+	expectedScopes := []string{
+		factory.PagingScopeRecommendedRanNodes,
+		factory.PagingScopeRecommendedRanNodes,
+		factory.PagingScopeRegistrationArea,
+		factory.PagingScopeRecommendedRanNodes,
+		// the last paging area is used after the escalation
+		factory.PagingScopeRecommendedRanNodes,
+		factory.PagingScopeRecommendedRanNodes,
+	}
+	for attempt, expected := range expectedScopes {
+		if scope := amfSelf.PagingScope(attempt); scope != expected {
+			t.Errorf("attempt %d: scope %s, want %s", attempt, scope, expected)
+		}
+	}
+}
+
+func TestPagingRanList(t *testing.T) {
+	plmnID := &models.PlmnId{Mcc: "208", Mnc: "93"}
+	tai1 := models.Tai{PlmnId: plmnID, Tac: "000001"}
+	tai2 := models.Tai{PlmnId: plmnID, Tac: "000002"}
+	tai3 := models.Tai{PlmnId: plmnID, Tac: "000003"}
+	newRan := func(gnbID string, tai models.Tai) *AmfRan {
+		return &AmfRan{
+			RanPresent: RanPresentGNbId,
+			RanId: &models.GlobalRanNodeId{
+				PlmnId: plmnID,
+				GNbId:  &models.GNbId{BitLength: 24, GNBValue: gnbID},
+			},
+			SupportedTAList: []SupportedTAI{{Tai: tai}},
+		}
+	}
+	ran1 := newRan("000001", tai1)
+	ran2 := newRan("000002", tai2)
+	ran3 := newRan("000003", tai3) // out of the registration area
+
+	amfSelf := AMF_Self()
+	for key, ran := range map[string]*AmfRan{"ran1": ran1, "ran2": ran2, "ran3": ran3} {
+		amfSelf.AmfRanPool.Store(key, ran)
+		defer amfSelf.AmfRanPool.Delete(key)
+	}
+
+	ue := &AmfUe{
+		RegistrationArea: map[models.AccessType][]models.Tai{
+			models.AccessType__3_GPP_ACCESS: {tai1, tai2},
+		},
+	}
+	contains := func(ranList []*AmfRan, ran *AmfRan) bool {
+		for _, item := range ranList {
+			if item == ran {
+				return true
+			}
+		}
+		return false
+	}
+
+	// no recommended NG-RAN, the UE is paged in the registration area
+	ranList, scope := ue.PagingRanList(factory.PagingScopeRecommendedRanNodes)
+	if scope != factory.PagingScopeRegistrationArea || len(ranList) != 2 ||
+		!contains(ranList, ran1) || !contains(ranList, ran2) {
+		t.Fatalf("no recommended NG-RAN: scope %s, %d NG-RANs", scope, len(ranList))
+	}
+
+	ue.InfoOnRecommendedCellsAndRanNodesForPaging = &InfoOnRecommendedCellsAndRanNodesForPaging{
+		RecommendedRanNodes: []RecommendRanNode{
+			{Present: RecommendRanNodePresentRanNode, GlobalRanNodeId: ran2.RanId},
+			// recommended NG-RAN out of the registration area is not paged
+			{Present: RecommendRanNodePresentTAI, Tai: &tai3},
+		},
+	}
+	ranList, scope = ue.PagingRanList(factory.PagingScopeRecommendedRanNodes)
+	if scope != factory.PagingScopeRecommendedRanNodes || len(ranList) != 1 || ranList[0] != ran2 {
+		t.Fatalf("recommended NG-RAN: scope %s, %d NG-RANs", scope, len(ranList))
+	}
+
+	// escalated to the registration area
+	ranList, scope = ue.PagingRanList(factory.PagingScopeRegistrationArea)
+	if scope != factory.PagingScopeRegistrationArea || len(ranList) != 2 {
+		t.Fatalf("registration area: scope %s, %d NG-RANs", scope, len(ranList))
+	}
+
+	ue.InfoOnRecommendedCellsAndRanNodesForPaging.RecommendedRanNodes = []RecommendRanNode{
+		{Present: RecommendRanNodePresentTAI, Tai: &tai1},
+	}
+	ranList, scope = ue.PagingRanList(factory.PagingScopeRecommendedRanNodes)
+	if scope != factory.PagingScopeRecommendedRanNodes || len(ranList) != 1 || ranList[0] != ran1 {
+		t.Fatalf("recommended TAI: scope %s, %d NG-RANs", scope, len(ranList))
+	}
+}
@@ -61,6 +61,7 @@ type RanUe struct {
 	InitialUEMessage      []byte
 	RRCEstablishmentCause string // Received from initial ue message; pattern: ^[0-9a-fA-F]+$
 	UeContextRequest      bool
+	AllowedNssai          []models.AllowedSnssai // provided by the initial AMF in the rerouted message
 
 	/* send initial context setup request or not*/
 	SentInitialContextSetupRequest bool
@@ -26,6 +26,9 @@ type SmContext struct {
 	hSmfID string
 	vSmfID string
 
+	// PDU session of SSC mode 3 released after this PDU session is established
+	oldPduSessionID int32
+
 	// for duplicate pdu session id handling
 	ulNASTransport *nasMessage.ULNASTransport
 	duplicated     bool
@@ -180,6 +183,18 @@ func (c *SmContext) SetVSmfID(vsmfID string) {
 	c.vSmfID = vsmfID
 }
 
+func (c *SmContext) OldPduSessionID() int32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.oldPduSessionID
+}
+
+func (c *SmContext) SetOldPduSessionID(id int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.oldPduSessionID = id
+}
+
 func (c *SmContext) PduSessionIDDuplicated() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,100 @@
+package context
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// MaxNumOfTraceRecords is the number of the trace records kept in the trace store, the oldest record is
+// dropped when the store is full
+const MaxNumOfTraceRecords = 1024
+
+type TraceEvent string
+
+const (
+	TraceEventTraceStart       TraceEvent = "TRACE_START"
+	TraceEventDeactivateTrace  TraceEvent = "DEACTIVATE_TRACE"
+	TraceEventTraceFailure     TraceEvent = "TRACE_FAILURE"
+	TraceEventCellTrafficTrace TraceEvent = "CELL_TRAFFIC_TRACE"
+)
+
+// TraceRecord is a record of a trace session of a UE, the SUPI and IMEI(SV) of the UE are recorded together with
+// the Trace Reference and Trace Recording Session Reference for the Trace Collection Entity (TS 32.422 4.2.2.10)
+type TraceRecord struct {
+	Time                   time.Time  `json:"time"`
+	Event                  TraceEvent `json:"event"`
+	Supi                   string     `json:"supi,omitempty"`
+	Pei                    string     `json:"pei,omitempty"`
+	TraceRef               string     `json:"traceRef,omitempty"`
+	Trsr                   string     `json:"trsr,omitempty"`
+	CollectionEntityIpAddr string     `json:"collectionEntityIpAddr,omitempty"`
+	Cell                   string     `json:"cell,omitempty"`
+	Cause                  string     `json:"cause,omitempty"`
+}
+
+// TraceStore is the local collection of the trace records
+type TraceStore struct {
+	mu      sync.RWMutex
+	records []TraceRecord
+}
+
+func (s *TraceStore) Add(record TraceRecord) {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.records) >= MaxNumOfTraceRecords {
+		s.records = s.records[1:]
+	}
+	s.records = append(s.records, record)
+}
+
+// Records returns the trace records of the UE, all the records are returned if supi is empty
+func (s *TraceStore) Records(supi string) []TraceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]TraceRecord, 0, len(s.records))
+	for _, record := range s.records {
+		if supi == "" || record.Supi == supi {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (s *TraceStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = nil
+}
+
+// trace reference is MCC+MNC followed by a 3 octet trace ID (TS 29.571 5.6.2.2)
+var traceRefPattern = regexp.MustCompile(`^[0-9]{3}[0-9]{2,3}-[A-Fa-f0-9]{6}$`)
+
+func ValidateTraceData(traceData *models.TraceData) error {
+	if traceData == nil {
+		return fmt.Errorf("trace data is nil")
+	}
+	if !traceRefPattern.MatchString(traceData.TraceRef) {
+		return fmt.Errorf("invalid trace reference[%s]", traceData.TraceRef)
+	}
+	if traceData.CollectionEntityIpv4Addr == "" && traceData.CollectionEntityIpv6Addr == "" {
+		return fmt.Errorf("trace collection entity address is missing")
+	}
+	return nil
+}
+
+var trsrCounter uint32
+
+// AllocateTrsr allocates the 2 octet Trace Recording Session Reference of a new trace session of the UE
+// (TS 32.422 5.5)
+func (ue *RanUe) AllocateTrsr() string {
+	ue.Trsr = fmt.Sprintf("%04x", uint16(atomic.AddUint32(&trsrCounter, 1)))
+	return ue.Trsr
+}
@@ -0,0 +1,96 @@
+package context
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestTraceStore(t *testing.T) {
+	var store TraceStore
+	store.Add(TraceRecord{Event: TraceEventTraceStart, Supi: "imsi-208930000000001", TraceRef: "20893-000001"})
+	store.Add(TraceRecord{Event: TraceEventTraceStart, Supi: "imsi-208930000000002", TraceRef: "20893-000002"})
+	store.Add(TraceRecord{
+		Event:    TraceEventTraceFailure,
+		Supi:     "imsi-208930000000001",
+		TraceRef: "20893-000001",
+		Cause:    "0:20",
+	})
+
+	if records := store.Records(""); len(records) != 3 {
+		t.Fatalf("%d records, want 3", len(records))
+	}
+	records := store.Records("imsi-208930000000001")
+	if len(records) != 2 {
+		t.Fatalf("%d records of the UE, want 2", len(records))
+	}
+	if records[0].Event != TraceEventTraceStart || records[1].Event != TraceEventTraceFailure {
+		t.Errorf("events %s, %s", records[0].Event, records[1].Event)
+	}
+	if records[1].Time.IsZero() {
+		t.Error("time of the record is not set")
+	}
+	if records := store.Records("imsi-208930000000003"); len(records) != 0 {
+		t.Errorf("%d records of an unknown UE", len(records))
+	}
+
+	// the returned records are a copy of the store
+	records[0].Supi = ""
+	if store.Records("imsi-208930000000001")[0].Supi == "" {
+		t.Error("record in the store is modified")
+	}
+
+	store.Reset()
+	if records := store.Records(""); len(records) != 0 {
+		t.Errorf("%d records after reset", len(records))
+	}
+}
+
+func TestTraceStoreFull(t *testing.T) {
+	var store TraceStore
+	for i := 0; i < MaxNumOfTraceRecords+2; i++ {
+		store.Add(TraceRecord{Event: TraceEventCellTrafficTrace, TraceRef: fmt.Sprintf("20893-%06x", i)})
+	}
+	records := store.Records("")
+	if len(records) != MaxNumOfTraceRecords {
+		t.Fatalf("%d records, want %d", len(records), MaxNumOfTraceRecords)
+	}
+	// the oldest records are dropped
+	if records[0].TraceRef != "20893-000002" ||
+		records[len(records)-1].TraceRef != fmt.Sprintf("20893-%06x", MaxNumOfTraceRecords+1) {
+		t.Errorf("first record %s, last record %s", records[0].TraceRef, records[len(records)-1].TraceRef)
+	}
+}
+
+func TestValidateTraceData(t *testing.T) {
+	testCases := []struct {
+		name      string
+		traceData *models.TraceData
+		valid     bool
+	}{
+		{"nil", nil, false},
+		{"IPv4 collection entity", &models.TraceData{TraceRef: "20893-00a1b2", CollectionEntityIpv4Addr: "10.0.0.1"}, true},
+		{"IPv6 collection entity", &models.TraceData{TraceRef: "208930-00A1B2", CollectionEntityIpv6Addr: "fd00::1"}, true},
+		{"short trace ID", &models.TraceData{TraceRef: "20893-00a1", CollectionEntityIpv4Addr: "10.0.0.1"}, false},
+		{"no PLMN", &models.TraceData{TraceRef: "00a1b2", CollectionEntityIpv4Addr: "10.0.0.1"}, false},
+		{"no collection entity", &models.TraceData{TraceRef: "20893-00a1b2"}, false},
+	}
+	for _, tc := range testCases {
+		if err := ValidateTraceData(tc.traceData); (err == nil) != tc.valid {
+			t.Errorf("%s: error %v", tc.name, err)
+		}
+	}
+}
+
+func TestAllocateTrsr(t *testing.T) {
+	ue := new(RanUe)
+	trsr1 := ue.AllocateTrsr()
+	trsr2 := ue.AllocateTrsr()
+	if len(trsr1) != 4 || len(trsr2) != 4 || trsr1 == trsr2 {
+		t.Errorf("trace recording session references %s, %s", trsr1, trsr2)
+	}
+	if ue.Trsr != trsr2 {
+		t.Errorf("trace recording session reference of the UE %s, want %s", ue.Trsr, trsr2)
+	}
+}
@@ -33,26 +33,42 @@ const (
 	AMF_DEFAULT_NRFURI   = "https://127.0.0.10:8000"
 )
 
+const (
+	AMF_DEFAULT_OVERLOAD_STOP_RATIO     = 80
+	AMF_DEFAULT_OVERLOAD_CHECK_INTERVAL = time.Second
+	AMF_DEFAULT_OVERLOAD_TIME_TO_WAIT   = 10 * time.Second
+	AMF_DEFAULT_OVERLOAD_T3346_VALUE    = 60 // unit is second
+)
+
+const (
+	AMF_DEFAULT_DRX_MIN_CYCLE = 32  // unit is radio frame
+	AMF_DEFAULT_DRX_MAX_CYCLE = 256 // unit is radio frame
+)
+
 type Configuration struct {
-	AmfName                         string            `yaml:"amfName,omitempty"`
-	NgapIpList                      []string          `yaml:"ngapIpList,omitempty"`
-	Sbi                             *Sbi              `yaml:"sbi,omitempty"`
-	ServiceNameList                 []string          `yaml:"serviceNameList,omitempty"`
-	ServedGumaiList                 []models.Guami    `yaml:"servedGuamiList,omitempty"`
-	SupportTAIList                  []models.Tai      `yaml:"supportTaiList,omitempty"`
-	PlmnSupportList                 []PlmnSupportItem `yaml:"plmnSupportList,omitempty"`
-	SupportDnnList                  []string          `yaml:"supportDnnList,omitempty"`
-	NrfUri                          string            `yaml:"nrfUri,omitempty"`
-	Security                        *Security         `yaml:"security,omitempty"`
-	NetworkName                     NetworkName       `yaml:"networkName,omitempty"`
-	T3502Value                      int               `yaml:"t3502Value,omitempty"`
-	T3512Value                      int               `yaml:"t3512Value,omitempty"`
-	Non3gppDeregistrationTimerValue int               `yaml:"non3gppDeregistrationTimerValue,omitempty"`
-	T3513                           TimerValue        `yaml:"t3513"`
-	T3522                           TimerValue        `yaml:"t3522"`
-	T3550                           TimerValue        `yaml:"t3550"`
-	T3560                           TimerValue        `yaml:"t3560"`
-	T3565                           TimerValue        `yaml:"t3565"`
+	AmfName                         string                  `yaml:"amfName,omitempty"`
+	NgapIpList                      []string                `yaml:"ngapIpList,omitempty"`
+	Sbi                             *Sbi                    `yaml:"sbi,omitempty"`
+	ServiceNameList                 []string                `yaml:"serviceNameList,omitempty"`
+	ServedGumaiList                 []models.Guami          `yaml:"servedGuamiList,omitempty"`
+	SupportTAIList                  []models.Tai            `yaml:"supportTaiList,omitempty"`
+	PlmnSupportList                 []PlmnSupportItem       `yaml:"plmnSupportList,omitempty"`
+	SupportDnnList                  []string                `yaml:"supportDnnList,omitempty"`
+	NrfUri                          string                  `yaml:"nrfUri,omitempty"`
+	Security                        *Security               `yaml:"security,omitempty"`
+	NetworkName                     NetworkName             `yaml:"networkName,omitempty"`
+	T3502Value                      int                     `yaml:"t3502Value,omitempty"`
+	T3512Value                      int                     `yaml:"t3512Value,omitempty"`
+	Non3gppDeregistrationTimerValue int                     `yaml:"non3gppDeregistrationTimerValue,omitempty"`
+	T3513                           TimerValue              `yaml:"t3513"`
+	T3522                           TimerValue              `yaml:"t3522"`
+	T3550                           TimerValue              `yaml:"t3550"`
+	T3560                           TimerValue              `yaml:"t3560"`
+	T3565                           TimerValue              `yaml:"t3565"`
+	OverloadControl                 *OverloadControl        `yaml:"overloadControl,omitempty"`
+	EquipmentIdentityCheck          *EquipmentIdentityCheck `yaml:"equipmentIdentityCheck,omitempty"`
+	Drx                             *Drx                    `yaml:"drx,omitempty"`
+	Paging                          *Paging                 `yaml:"paging,omitempty"`
 }
 
 type Sbi struct {
@@ -77,6 +93,64 @@ type NetworkName struct {
 	Short string `yaml:"short,omitempty"`
 }
 
+// OverloadControl thresholds, a threshold set to 0 is not checked (TS 23.501 5.19.5.2)
+type OverloadControl struct {
+	Enable         bool          `yaml:"enable"`
+	MaxUeNum       int           `yaml:"maxUeNum,omitempty"`       // UE-associated NG connections
+	MaxNasRate     int           `yaml:"maxNasRate,omitempty"`     // uplink NAS messages per second
+	MaxQueueDepth  int           `yaml:"maxQueueDepth,omitempty"`  // NGAP messages being handled
+	StopRatio      int           `yaml:"stopRatio,omitempty"`      // percentage of the thresholds to stop the overload
+	CheckInterval  time.Duration `yaml:"checkInterval,omitempty"`  // interval of the load check
+	OverloadAction string        `yaml:"overloadAction,omitempty"` // overload action requested to the NG-RAN
+	// percentage of the signalling traffic to be rejected by the NG-RAN (1~99), 0 means not indicated
+	TrafficLoadReduction int64         `yaml:"trafficLoadReduction,omitempty"`
+	TimeToWait           time.Duration `yaml:"timeToWait,omitempty"` // rounded up to 1s, 2s, 5s, 10s, 20s or 60s
+	T3346Value           int           `yaml:"t3346Value,omitempty"` // back-off timer (seconds) of rejected UEs
+}
+
+// EquipmentIdentityCheck with the 5G-EIR during the registration (TS 23.502 4.2.2.2.2 step 12)
+type EquipmentIdentityCheck struct {
+	Enable bool `yaml:"enable"`
+	// reject the UE if the 5G-EIR can not be reached or does not know the PEI, otherwise the UE is accepted
+	RejectOnFailure bool `yaml:"rejectOnFailure,omitempty"`
+}
+
+// Drx is the network policy the UE requested DRX and eDRX parameters are negotiated against (TS 23.501 5.4.5)
+type Drx struct {
+	// UE specific DRX cycle (32, 64, 128 or 256 radio frames) used when the UE does not request one,
+	// 0 means the UE uses the default paging DRX broadcast by the NG-RAN
+	DefaultCycle int   `yaml:"defaultCycle,omitempty"`
+	MinCycle     int   `yaml:"minCycle,omitempty"` // the UE requested DRX cycle is raised to it
+	MaxCycle     int   `yaml:"maxCycle,omitempty"` // the UE requested DRX cycle is lowered to it
+	Edrx         *Edrx `yaml:"edrx,omitempty"`
+}
+
+// Edrx policy, the UE requested eDRX parameters are lowered to the configured maximums (TS 24.008 10.5.5.32)
+type Edrx struct {
+	Enable bool `yaml:"enable"`
+	// longest eDRX cycle granted, rounded down to one of the 16 cycles from 5.12s to 10485.76s
+	MaxCycle time.Duration `yaml:"maxCycle,omitempty"`
+	// longest paging time window granted, rounded down to a multiple of 1.28s (1.28s ~ 20.48s)
+	MaxPagingTimeWindow time.Duration `yaml:"maxPagingTimeWindow,omitempty"`
+}
+
+// Paging areas of the paging escalation
+const (
+	PagingScopeRecommendedRanNodes = "recommendedRanNodes" // NG-RAN nodes recommended by the last serving NG-RAN
+	PagingScopeRegistrationArea    = "registrationArea"
+)
+
+// Paging policy of the UE in CM-IDLE state (TS 23.502 4.2.3.3 step 4b)
+type Paging struct {
+	// paging areas in the order they are used, the last paging area is used by the remaining paging attempts
+	Escalation []PagingStep `yaml:"escalation,omitempty"`
+}
+
+type PagingStep struct {
+	Scope    string `yaml:"scope"`    // recommendedRanNodes or registrationArea
+	Attempts int    `yaml:"attempts"` // paging attempts in the paging area
+}
+
 type TimerValue struct {
 	Enable        bool          `yaml:"enable"`
 	ExpireTime    time.Duration `yaml:"expireTime"`
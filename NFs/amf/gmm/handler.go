@@ -18,6 +18,7 @@ import (
 	"github.com/free5gc/amf/consumer"
 	"github.com/free5gc/amf/context"
 	gmm_message "github.com/free5gc/amf/gmm/message"
+	"github.com/free5gc/amf/nas/nas_security"
 	ngap_message "github.com/free5gc/amf/ngap/message"
 	"github.com/free5gc/amf/producer/callback"
 	"github.com/free5gc/amf/util"
@@ -209,26 +210,7 @@ func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 					gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
 						smMessage, pduSessionID, cause, nil, 0)
 				} else {
-					_, smContextRef, errResponse, problemDetail, err :=
-						consumer.SendCreateSmContextRequest(ue, newSmContext, nil, smMessage)
-					if err != nil {
-						ue.GmmLog.Errorf("CreateSmContextRequest Error: %+v", err)
-						return nil
-					} else if problemDetail != nil {
-						// TODO: error handling
-						return fmt.Errorf("Failed to Create smContext[pduSessionID: %d], Error[%v]", pduSessionID, problemDetail)
-					} else if errResponse != nil {
-						ue.GmmLog.Warnf("PDU Session Establishment Request is rejected by SMF[pduSessionId:%d]",
-							pduSessionID)
-						gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
-							errResponse.BinaryDataN1SmMessage, pduSessionID, 0, nil, 0)
-					} else {
-						newSmContext.SetSmContextRef(smContextRef)
-						newSmContext.SetUserLocation(deepcopy.Copy(ue.Location).(models.UserLocation))
-						ue.StoreSmContext(pduSessionID, newSmContext)
-						ue.GmmLog.Infof("create smContext[pduSessionID: %d] Success", pduSessionID)
-						// TODO: handle response(response N2SmInfo to RAN if exists)
-					}
+					return createSmContext(ue, anType, pduSessionID, newSmContext, smMessage)
 				}
 			case nasMessage.ULNASTransportRequestTypeModificationRequest:
 				fallthrough
@@ -257,8 +239,53 @@ func transport5GSMMessage(ue *context.AmfUe, anType models.AccessType,
 			}
 		}
 	} else {
-		// TODO: implement SSC mode3 Op
-		return fmt.Errorf("SSC mode3 operation has not been implemented yet")
+		// case 2): the UE establishes a new PDU session to the same DN before releasing the old PDU session of SSC
+		// mode 3, the SMF serving the old PDU session is selected (TS 23.502 4.3.5.2)
+		oldPduSessionID := int32(ulNasTransport.OldPDUSessionID.GetOldPDUSessionID())
+		oldSmContext, ok := ue.SmContextFindByPDUSessionID(oldPduSessionID)
+		if !ok {
+			ue.GmmLog.Warnf("Old PDU Session ID[%d] is not found", oldPduSessionID)
+			gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+				smMessage, pduSessionID, nasMessage.Cause5GMMPayloadWasNotForwarded, nil, 0)
+			return nil
+		}
+
+		newSmContext := context.NewSmContext(pduSessionID)
+		newSmContext.SetSnssai(oldSmContext.Snssai())
+		newSmContext.SetDnn(oldSmContext.Dnn())
+		newSmContext.SetAccessType(anType)
+		newSmContext.SetNsInstance(oldSmContext.NsInstance())
+		newSmContext.SetSmfID(oldSmContext.SmfID())
+		newSmContext.SetSmfUri(oldSmContext.SmfUri())
+		newSmContext.SetOldPduSessionID(oldPduSessionID)
+		return createSmContext(ue, anType, pduSessionID, newSmContext, smMessage)
+	}
+	return nil
+}
+
+func createSmContext(
+	ue *context.AmfUe,
+	anType models.AccessType,
+	pduSessionID int32,
+	smContext *context.SmContext,
+	smMessage []byte) error {
+	_, smContextRef, errResponse, problemDetail, err := consumer.SendCreateSmContextRequest(ue, smContext, nil, smMessage)
+	if err != nil {
+		ue.GmmLog.Errorf("CreateSmContextRequest Error: %+v", err)
+		return nil
+	} else if problemDetail != nil {
+		// TODO: error handling
+		return fmt.Errorf("Failed to Create smContext[pduSessionID: %d], Error[%v]", pduSessionID, problemDetail)
+	} else if errResponse != nil {
+		ue.GmmLog.Warnf("PDU Session Establishment Request is rejected by SMF[pduSessionId:%d]", pduSessionID)
+		gmm_message.SendDLNASTransport(ue.RanUe[anType], nasMessage.PayloadContainerTypeN1SMInfo,
+			errResponse.BinaryDataN1SmMessage, pduSessionID, 0, nil, 0)
+	} else {
+		smContext.SetSmContextRef(smContextRef)
+		smContext.SetUserLocation(deepcopy.Copy(ue.Location).(models.UserLocation))
+		ue.StoreSmContext(pduSessionID, smContext)
+		ue.GmmLog.Infof("create smContext[pduSessionID: %d] Success", pduSessionID)
+		// TODO: handle response(response N2SmInfo to RAN if exists)
 	}
 	return nil
 }
@@ -370,6 +397,14 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		ue.T3565 = nil // clear the timer
 	}
 
+	// TS 24.501 5.3.9: under general NAS level mobility management congestion control, the AMF rejects
+	// the registration with 5GMM cause #22 and T3346, except for the emergency and high priority accesses
+	if !amfSelf.OverloadControl.Admit(ue.RanUe[anType].RRCEstablishmentCause) {
+		ue.GmmLog.Warn("AMF overloaded, reject Registration Request")
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMCongestion, "")
+		return fmt.Errorf("Registration Request rejected: AMF overloaded")
+	}
+
 	// TS 24.501 8.2.6.21: if the UE is sending a REGISTRATION REQUEST message as an initial NAS message,
 	// the UE has a valid 5G NAS security context and the UE needs to send non-cleartext IEs
 	// TS 24.501 4.4.6: When the UE sends a REGISTRATION REQUEST or SERVICE REQUEST message that includes a NAS message
@@ -397,6 +432,7 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 			// TS 24.501 4.4.6: The AMF shall consider the NAS message that is obtained from the NAS message container
 			// IE as the initial NAS message that triggered the procedure
 			registrationRequest = m.RegistrationRequest
+			ue.RequestedExtendedDRX = nas_security.DecodeRequestedExtendedDRX(registrationRequest, contents)
 		}
 		// TS 33.501 6.4.6 step 3: if the initial NAS message was protected but did not pass the integrity check
 		ue.RetransmissionOfInitialNASMsg = ue.MacFailed
@@ -485,42 +521,158 @@ func HandleRegistrationRequest(ue *context.AmfUe, anType models.AccessType, proc
 		return fmt.Errorf("UESecurityCapability is nil")
 	}
 
-	// TODO (TS 23.502 4.2.2.2 step 4): if UE's 5g-GUTI is included & serving AMF has changed
-	// since last registration procedure, new AMF may invoke Namf_Communication_UEContextTransfer
+	// TS 23.502 4.2.2.2.2 step 4: if UE's 5g-GUTI is included & serving AMF has changed
+	// since last registration procedure, new AMF invokes Namf_Communication_UEContextTransfer
 	// to old AMF, including the complete registration request nas msg, to request UE's SUPI & UE Context
 	if ue.ServingAmfChanged {
-		var transferReason models.TransferReason
-		switch ue.RegistrationType5GS {
-		case nasMessage.RegistrationType5GSInitialRegistration:
-			transferReason = models.TransferReason_INIT_REG
-		case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
-			fallthrough
-		case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
-			transferReason = models.TransferReason_MOBI_REG
+		transferUeContextFromOldAmf(ue, anType, guamiFromUeGuti)
+	}
+	return nil
+}
+
+// transferUeContextFromOldAmf retrieves the UE context from the old AMF, selected by the GUAMI of the
+// 5G-GUTI. The registration continues with a fresh UE context if the transfer fails
+func transferUeContextFromOldAmf(ue *context.AmfUe, anType models.AccessType, guami models.Guami) {
+	amfSelf := context.AMF_Self()
+
+	var transferReason models.TransferReason
+	switch ue.RegistrationType5GS {
+	case nasMessage.RegistrationType5GSInitialRegistration:
+		transferReason = models.TransferReason_INIT_REG
+	case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
+		fallthrough
+	case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
+		transferReason = models.TransferReason_MOBI_REG
+	}
+
+	searchOpt := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		Guami: optional.NewInterface(util.MarshToJsonString(guami)),
+	}
+	err := consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri, models.NfType_AMF, models.NfType_AMF, &searchOpt)
+	if err != nil {
+		ue.GmmLog.Warnf("Can not find the old AMF[GUAMI: %+v]: %+v", guami, err)
+		ue.SecurityContextAvailable = false
+		return
+	}
+
+	ueContextTransferRsp, problemDetails, err := consumer.UEContextTransferRequest(ue, anType, transferReason)
+	if problemDetails != nil {
+		if problemDetails.Cause == "INTEGRITY_CHECK_FAIL" || problemDetails.Cause == "CONTEXT_NOT_FOUND" {
+			ue.GmmLog.Warnf("Can not retrieve UE Context from old AMF[Cause: %s]", problemDetails.Cause)
+		} else {
+			ue.GmmLog.Warnf("UE Context Transfer Request Failed Problem[%+v]", problemDetails)
 		}
+		ue.SecurityContextAvailable = false // need to start authentication procedure later
+		ue.TargetAmfUri = ""
+		return
+	} else if err != nil {
+		ue.GmmLog.Errorf("UE Context Transfer Request Error[%+v]", err)
+		ue.SecurityContextAvailable = false
+		ue.TargetAmfUri = ""
+		return
+	}
+
+	ueContextTransferRspData := ueContextTransferRsp.JsonData
+	if ueContextTransferRspData == nil || ueContextTransferRspData.UeContext == nil {
+		ue.GmmLog.Warn("UE Context Transfer Response without UE Context")
+		ue.SecurityContextAvailable = false
+		ue.TargetAmfUri = ""
+		return
+	}
+	ueContext := ueContextTransferRspData.UeContext
+	ue.CopyDataFromUeContextModel(*ueContext)
+	ue.GmmLog.Infof("Retrieve UE Context[SUPI: %s] from old AMF", ue.Supi)
+	amfSelf.AddAmfUeToUePool(ue, ue.Supi)
+
+	if ueContextTransferRspData.UeRadioCapability != nil && len(ueContextTransferRsp.BinaryDataN2Information) > 0 {
+		ue.UeRadioCapability = hex.EncodeToString(ueContextTransferRsp.BinaryDataN2Information)
+	}
 
-		searchOpt := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
-			Guami: optional.NewInterface(util.MarshToJsonString(guamiFromUeGuti)),
+	// the old AMF has checked the integrity of the registration request with this NAS security context,
+	// so it can be used without a new authentication (TS 23.502 4.2.2.2.2 step 9)
+	ue.SecurityContextAvailable = false
+	if ue.Kamf != "" {
+		for _, mmContext := range ueContext.MmContextList {
+			if mmContext.AccessType == anType && mmContext.NasSecurityMode != nil {
+				ue.DerivateAlgKey()
+				ue.SecurityContextAvailable = true
+				ue.MacFailed = false
+				break
+			}
 		}
-		err := consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri, models.NfType_AMF, models.NfType_AMF, &searchOpt)
-		if err != nil {
-			ue.GmmLog.Errorf("[GMM] %+v", err)
-			return err
+	}
+}
+
+// TS 23.502 4.2.2.2.2 step 10: the new AMF notifies the old AMF that the registration of the UE is completed
+// and then the UE context in the old AMF is removed
+func registrationCompleteNotify(ue *context.AmfUe) {
+	if ue.TargetAmfUri == "" {
+		return
+	}
+	req := models.UeRegStatusUpdateReqData{
+		TransferStatus: models.UeContextTransferStatus_TRANSFERRED,
+	}
+	// TODO: based on locol policy, decide if need to change serving PCF for UE
+	regStatusTransferComplete, problemDetails, err := consumer.RegistrationStatusUpdate(ue, req)
+	if problemDetails != nil {
+		ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
+	} else if err != nil {
+		ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
+	} else {
+		if regStatusTransferComplete {
+			ue.GmmLog.Infof("Registration Status Transfer complete")
+		}
+	}
+}
+
+// checkEquipmentIdentity rejects the registration if the PEI of the UE is blacklisted by the 5G-EIR
+func checkEquipmentIdentity(ue *context.AmfUe, anType models.AccessType) error {
+	amfSelf := context.AMF_Self()
+	equipmentIdentityCheck := amfSelf.EquipmentIdentityCheck
+	if !equipmentIdentityCheck.Enable {
+		return nil
+	}
+	// the PEI is requested with the Identity Request before the check, the UE which did not provide it
+	// can not be checked by the 5G-EIR
+	if ue.Pei == "" {
+		if !equipmentIdentityCheck.RejectOnFailure {
+			ue.GmmLog.Warnf("UE has no PEI, skip the equipment identity check")
+			return nil
 		}
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMIllegalME, "")
+		return fmt.Errorf("Equipment identity check failed: UE has no PEI")
+	}
 
-		ueContextTransferRspData, problemDetails, err := consumer.UEContextTransferRequest(ue, anType, transferReason)
+	var status consumer.EquipmentStatus
+	var err error
+	if ue.EirUri == "" {
+		err = consumer.SearchEirInstance(ue, amfSelf.NrfUri, models.NfType__5_G_EIR, models.NfType_AMF, nil)
+	}
+	if err == nil {
+		var problemDetails *models.ProblemDetails
+		status, problemDetails, err = consumer.EquipmentIdentityCheck(ue)
 		if problemDetails != nil {
-			if problemDetails.Cause == "INTEGRITY_CHECK_FAIL" || problemDetails.Cause == "CONTEXT_NOT_FOUND" {
-				ue.GmmLog.Warnf("Can not retrieve UE Context from old AMF[Cause: %s]", problemDetails.Cause)
-			} else {
-				ue.GmmLog.Warnf("UE Context Transfer Request Failed Problem[%+v]", problemDetails)
-			}
-			ue.SecurityContextAvailable = false // need to start authentication procedure later
-		} else if err != nil {
-			ue.GmmLog.Errorf("UE Context Transfer Request Error[%+v]", err)
-		} else {
-			ue.CopyDataFromUeContextModel(*ueContextTransferRspData.UeContext)
+			err = fmt.Errorf("Equipment Identity Check Failed Problem[%+v]", problemDetails)
+		}
+	}
+	if err != nil {
+		if !equipmentIdentityCheck.RejectOnFailure {
+			ue.GmmLog.Warnf("Equipment identity check of PEI[%s] failed, accept the UE: %+v", ue.Pei, err)
+			return nil
 		}
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMIllegalME, "")
+		return fmt.Errorf("Equipment identity check of PEI[%s] failed: %+v", ue.Pei, err)
+	}
+
+	switch status {
+	case consumer.EquipmentStatusBlacklisted:
+		// TS 24.501 5.5.1.2.5: 5GMM cause #6 "Illegal ME"
+		gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMIllegalME, "")
+		return fmt.Errorf("PEI[%s] is blacklisted", ue.Pei)
+	case consumer.EquipmentStatusGreylisted:
+		ue.GmmLog.Warnf("PEI[%s] is greylisted", ue.Pei)
+	default:
+		ue.GmmLog.Debugf("PEI[%s] is %s", ue.Pei, status)
 	}
 	return nil
 }
@@ -542,8 +694,10 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 		getSubscribedNssai(ue)
 	}
 
-	if err := handleRequestedNssai(ue, anType); err != nil {
+	if rerouted, err := handleRequestedNssai(ue, anType); err != nil {
 		return err
+	} else if rerouted {
+		return nil
 	}
 
 	if ue.RegistrationRequest.Capability5GMM != nil {
@@ -560,26 +714,12 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 			ue.RegistrationRequest.MICOIndication.GetRAAI())
 	}
 
-	// TODO: Negotiate DRX value if need (TS 23.501 5.4.5)
+	// TS 23.501 5.4.5, 5.31.7.2: negotiate the DRX and eDRX parameters with the UE
 	negotiateDRXParameters(ue, ue.RegistrationRequest.RequestedDRXParameters)
 
-	// TODO (step 10 optional): send Namf_Communication_RegistrationCompleteNotify to old AMF if need
+	// TS 23.502 4.2.2.2.2 step 10 (optional): send Namf_Communication_RegistrationCompleteNotify to old AMF
 	if ue.ServingAmfChanged {
-		// If the AMF has changed the new AMF notifies the old AMF that the registration of the UE in the new AMF is completed
-		req := models.UeRegStatusUpdateReqData{
-			TransferStatus: models.UeContextTransferStatus_TRANSFERRED,
-		}
-		// TODO: based on locol policy, decide if need to change serving PCF for UE
-		regStatusTransferComplete, problemDetails, err := consumer.RegistrationStatusUpdate(ue, req)
-		if problemDetails != nil {
-			ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
-		} else if err != nil {
-			ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
-		} else {
-			if regStatusTransferComplete {
-				ue.GmmLog.Infof("Registration Status Transfer complete")
-			}
-		}
+		registrationCompleteNotify(ue)
 	}
 
 	if len(ue.Pei) == 0 {
@@ -587,8 +727,11 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 		return nil
 	}
 
-	// TODO (step 12 optional): the new AMF initiates ME identity check by invoking the
+	// TS 23.502 4.2.2.2.2 step 12 (optional): the new AMF initiates ME identity check by invoking the
 	// N5g-eir_EquipmentIdentityCheck_Get service operation
+	if err := checkEquipmentIdentity(ue, anType); err != nil {
+		return err
+	}
 
 	if ue.ServingAmfChanged || ue.State[models.AccessType_NON_3_GPP_ACCESS].Is(context.Registered) ||
 		!ue.ContextValid {
@@ -656,7 +799,13 @@ func HandleInitialRegistration(ue *context.AmfUe, anType models.AccessType) erro
 	// }
 
 	amfSelf.AllocateRegistrationArea(ue, anType)
-	ue.GmmLog.Debugf("Use original GUTI[%s]", ue.Guti)
+	if ue.ServingAmfChanged {
+		// the 5G-GUTI was allocated by the old AMF
+		amfSelf.AllocateGutiToUe(ue)
+		ue.GmmLog.Debugf("Allocate new GUTI[%s]", ue.Guti)
+	} else {
+		ue.GmmLog.Debugf("Use original GUTI[%s]", ue.Guti)
+	}
 
 	assignLadnInfo(ue, anType)
 
@@ -702,8 +851,10 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 		getSubscribedNssai(ue)
 	}
 
-	if err := handleRequestedNssai(ue, anType); err != nil {
+	if rerouted, err := handleRequestedNssai(ue, anType); err != nil {
 		return err
+	} else if rerouted {
+		return nil
 	}
 
 	if ue.RegistrationRequest.Capability5GMM != nil {
@@ -722,21 +873,42 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 			ue.RegistrationRequest.MICOIndication.GetRAAI())
 	}
 
-	// TODO: Negotiate DRX value if need (TS 23.501 5.4.5)
+	// TS 23.501 5.4.5, 5.31.7.2: negotiate the DRX and eDRX parameters with the UE
 	negotiateDRXParameters(ue, ue.RegistrationRequest.RequestedDRXParameters)
 
-	// TODO (step 10 optional): send Namf_Communication_RegistrationCompleteNotify to old AMF if need
-	// if ue.ServingAmfChanged {
-	// 	If the AMF has changed the new AMF notifies the old AMF that the registration of the UE in the new AMF is completed
-	// }
+	// TS 23.502 4.2.2.2.2 step 10 (optional): send Namf_Communication_RegistrationCompleteNotify to old AMF
+	if ue.ServingAmfChanged {
+		registrationCompleteNotify(ue)
+		// the PDU sessions transferred from the old AMF are now served by this AMF (TS 23.502 4.2.2.2.2 step 17)
+		if len(amfSelf.ServedGuamiList) == 0 {
+			ue.GmmLog.Errorln("No served GUAMI, the SMF of the transferred PDU sessions is not updated")
+		} else {
+			guami := &amfSelf.ServedGuamiList[0]
+			ue.SmContextList.Range(func(key, value interface{}) bool {
+				smContext := value.(*context.SmContext)
+				_, _, problemDetail, err := consumer.SendUpdateSmContextHandoverBetweenAMF(ue, smContext,
+					amfSelf.NfId, guami, false)
+				if problemDetail != nil {
+					ue.GmmLog.Errorf("Update SmContext[pduSessionId: %d] Failed Problem[%+v]",
+						smContext.PduSessionID(), problemDetail)
+				} else if err != nil {
+					ue.GmmLog.Errorf("Update SmContext[pduSessionId: %d] Error[%v]", smContext.PduSessionID(), err)
+				}
+				return true
+			})
+		}
+	}
 
 	if len(ue.Pei) == 0 {
 		gmm_message.SendIdentityRequest(ue.RanUe[anType], nasMessage.MobileIdentity5GSTypeImei)
 		return nil
 	}
 
-	// TODO (step 12 optional): the new AMF initiates ME identity check by invoking the
+	// TS 23.502 4.2.2.2.2 step 12 (optional): the new AMF initiates ME identity check by invoking the
 	// N5g-eir_EquipmentIdentityCheck_Get service operation
+	if err := checkEquipmentIdentity(ue, anType); err != nil {
+		return err
+	}
 
 	if ue.ServingAmfChanged || ue.State[models.AccessType_NON_3_GPP_ACCESS].Is(context.Registered) ||
 		!ue.ContextValid {
@@ -965,6 +1137,11 @@ func HandleMobilityAndPeriodicRegistrationUpdating(ue *context.AmfUe, anType mod
 	amfSelf.AllocateRegistrationArea(ue, anType)
 	assignLadnInfo(ue, anType)
 
+	if ue.ServingAmfChanged {
+		// the 5G-GUTI was allocated by the old AMF
+		amfSelf.AllocateGutiToUe(ue)
+		ue.GmmLog.Debugf("Allocate new GUTI[%s]", ue.Guti)
+	}
 	// TODO: GUTI reassignment if need (based on operator poilcy)
 	// TODO: T3512/Non3GPP de-registration timer reassignment if need (based on operator policy)
 
@@ -1022,25 +1199,26 @@ func storeLastVisitedRegisteredTAI(ue *context.AmfUe, lastVisitedRegisteredTAI *
 }
 
 func negotiateDRXParameters(ue *context.AmfUe, requestedDRXParameters *nasType.RequestedDRXParameters) {
+	amfSelf := context.AMF_Self()
 	if requestedDRXParameters != nil {
-		switch requestedDRXParameters.GetDRXValue() {
-		case nasMessage.DRXcycleParameterT32:
-			ue.GmmLog.Tracef("Requested DRX: T = 32")
-			ue.UESpecificDRX = nasMessage.DRXcycleParameterT32
-		case nasMessage.DRXcycleParameterT64:
-			ue.GmmLog.Tracef("Requested DRX: T = 64")
-			ue.UESpecificDRX = nasMessage.DRXcycleParameterT64
-		case nasMessage.DRXcycleParameterT128:
-			ue.GmmLog.Tracef("Requested DRX: T = 128")
-			ue.UESpecificDRX = nasMessage.DRXcycleParameterT128
-		case nasMessage.DRXcycleParameterT256:
-			ue.GmmLog.Tracef("Requested DRX: T = 256")
-			ue.UESpecificDRX = nasMessage.DRXcycleParameterT256
-		case nasMessage.DRXValueNotSpecified:
-			fallthrough
-		default:
-			ue.UESpecificDRX = nasMessage.DRXValueNotSpecified
-			ue.GmmLog.Tracef("Requested DRX: Value not specified")
+		requested := requestedDRXParameters.GetDRXValue()
+		ue.UESpecificDRX = amfSelf.NegotiateDRX(requested)
+		ue.GmmLog.Debugf("Requested DRX cycle: %d, negotiated DRX cycle: %d",
+			context.DRXNasToCycle(requested), context.DRXNasToCycle(ue.UESpecificDRX))
+	} else if ue.RegistrationType5GS == nasMessage.RegistrationType5GSInitialRegistration {
+		// the negotiated DRX is kept in the mobility and periodic registration update
+		ue.UESpecificDRX = amfSelf.NegotiateDRX(nasMessage.DRXValueNotSpecified)
+	}
+
+	// TS 24.501 5.5.1.3.4: eDRX is not used if the UE does not request it in the registration
+	ue.NegotiatedExtendedDRX = amfSelf.NegotiateExtendedDRX(ue.RequestedExtendedDRX)
+	if requested := ue.RequestedExtendedDRX; requested != nil {
+		if negotiated := ue.NegotiatedExtendedDRX; negotiated != nil {
+			ue.GmmLog.Debugf("Requested eDRX cycle: %s (PTW: %s), negotiated eDRX cycle: %s (PTW: %s)",
+				requested.Cycle(), requested.PagingTimeWindowLength(),
+				negotiated.Cycle(), negotiated.PagingTimeWindowLength())
+		} else {
+			ue.GmmLog.Debugf("Requested eDRX cycle: %s is not accepted", requested.Cycle())
 		}
 	}
 }
@@ -1138,20 +1316,30 @@ func getSubscribedNssai(ue *context.AmfUe) {
 }
 
 // TS 23.502 4.2.2.2.3 Registration with AMF Re-allocation
-func handleRequestedNssai(ue *context.AmfUe, anType models.AccessType) error {
+// rerouted is true if the registration is rerouted to another AMF, and the UE context has been removed
+func handleRequestedNssai(ue *context.AmfUe, anType models.AccessType) (rerouted bool, err error) {
 	amfSelf := context.AMF_Self()
 
+	// TS 23.502 4.2.2.2.3 step 7: the allowed NSSAI is provided by the initial AMF in the rerouted message
+	if allowedNssai := ue.RanUe[anType].AllowedNssai; len(allowedNssai) > 0 {
+		ue.GmmLog.Infof("Use Allowed NSSAI provided by the initial AMF: %+v", allowedNssai)
+		ue.AllowedNssai[anType] = allowedNssai
+		return false, nil
+	}
+
 	if ue.RegistrationRequest.RequestedNSSAI != nil {
 		requestedNssai, err := nasConvert.RequestedNssaiToModels(ue.RegistrationRequest.RequestedNSSAI)
 		if err != nil {
-			return fmt.Errorf("Decode failed at RequestedNSSAI[%s]", err)
+			return false, fmt.Errorf("Decode failed at RequestedNSSAI[%s]", err)
 		}
 
 		ue.GmmLog.Errorf("RequestedNssai: %+v", requestedNssai)
 
 		needSliceSelection := false
 		for _, requestedSnssai := range requestedNssai {
-			if ue.InSubscribedNssai(*requestedSnssai.ServingSnssai) {
+			// the S-NSSAIs not supported by this AMF (e.g. served by a slice-dedicated AMF) need the slice selection
+			if ue.InSubscribedNssai(*requestedSnssai.ServingSnssai) &&
+				amfSelf.InPlmnSupportList(*requestedSnssai.ServingSnssai) {
 				allowedSnssai := models.AllowedSnssai{
 					AllowedSnssai: &models.Snssai{
 						Sst: requestedSnssai.ServingSnssai.Sst,
@@ -1184,91 +1372,21 @@ func handleRequestedNssai(ue *context.AmfUe, anType models.AccessType) error {
 			if problemDetails != nil {
 				ue.GmmLog.Errorf("NSSelection Get Failed Problem[%+v]", problemDetails)
 				gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
-				return fmt.Errorf("Handle Requested Nssai of UE failed")
+				return false, fmt.Errorf("Handle Requested Nssai of UE failed")
 			} else if err != nil {
 				ue.GmmLog.Errorf("NSSelection Get Error[%+v]", err)
 				gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
-				return fmt.Errorf("Handle Requested Nssai of UE failed")
-			}
-
-			// Step 5: Initial AMF send Namf_Communication_RegistrationCompleteNotify to old AMF
-			req := models.UeRegStatusUpdateReqData{
-				TransferStatus: models.UeContextTransferStatus_NOT_TRANSFERRED,
-			}
-			_, problemDetails, err = consumer.RegistrationStatusUpdate(ue, req)
-			if problemDetails != nil {
-				ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
-			} else if err != nil {
-				ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
-			}
-
-			// Step 6
-			searchTargetAmfQueryParam := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{}
-			if ue.NetworkSliceInfo != nil {
-				netwotkSliceInfo := ue.NetworkSliceInfo
-				if netwotkSliceInfo.TargetAmfSet != "" {
-					// TS 29.531
-					// TargetAmfSet format: ^[0-9]{3}-[0-9]{2-3}-[A-Fa-f0-9]{2}-[0-3][A-Fa-f0-9]{2}$
-					// mcc-mnc-amfRegionId(8 bit)-AmfSetId(10 bit)
-					targetAmfSetToken := strings.Split(netwotkSliceInfo.TargetAmfSet, "-")
-					guami := amfSelf.ServedGuamiList[0]
-					targetAmfPlmnId := models.PlmnId{
-						Mcc: targetAmfSetToken[0],
-						Mnc: targetAmfSetToken[1],
-					}
-
-					if !reflect.DeepEqual(guami.PlmnId, targetAmfPlmnId) {
-						searchTargetAmfQueryParam.TargetPlmnList =
-							optional.NewInterface(util.MarshToJsonString([]models.PlmnId{targetAmfPlmnId}))
-						searchTargetAmfQueryParam.RequesterPlmnList =
-							optional.NewInterface(util.MarshToJsonString([]models.PlmnId{*guami.PlmnId}))
-					}
-
-					searchTargetAmfQueryParam.AmfRegionId = optional.NewString(targetAmfSetToken[2])
-					searchTargetAmfQueryParam.AmfSetId = optional.NewString(targetAmfSetToken[3])
-				} else if len(netwotkSliceInfo.CandidateAmfList) > 0 {
-					// TODO: select candidate Amf based on local poilcy
-					searchTargetAmfQueryParam.TargetNfInstanceId = optional.NewInterface(netwotkSliceInfo.CandidateAmfList[0])
-				}
+				return false, fmt.Errorf("Handle Requested Nssai of UE failed")
 			}
 
-			err = consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri,
-				models.NfType_AMF, models.NfType_AMF, &searchTargetAmfQueryParam)
-			if err == nil {
-				// Condition (A) Step 7: initial AMF find Target AMF via NRF ->
-				// Send Namf_Communication_N1MessageNotify to Target AMF
-				ueContext := consumer.BuildUeContextModel(ue)
-				registerContext := models.RegistrationContextContainer{
-					UeContext:        &ueContext,
-					AnType:           anType,
-					AnN2ApId:         int32(ue.RanUe[anType].RanUeNgapId),
-					RanNodeId:        ue.RanUe[anType].Ran.RanId,
-					InitialAmfName:   amfSelf.Name,
-					UserLocation:     &ue.Location,
-					RrcEstCause:      ue.RanUe[anType].RRCEstablishmentCause,
-					UeContextRequest: ue.RanUe[anType].UeContextRequest,
-					AnN2IPv4Addr:     ue.RanUe[anType].Ran.Conn.RemoteAddr().String(),
-					AllowedNssai: &models.AllowedNssai{
-						AllowedSnssaiList: ue.AllowedNssai[anType],
-						AccessType:        anType,
-					},
-				}
-				if len(ue.NetworkSliceInfo.RejectedNssaiInPlmn) > 0 {
-					registerContext.RejectedNssaiInPlmn = ue.NetworkSliceInfo.RejectedNssaiInPlmn
-				}
-				if len(ue.NetworkSliceInfo.RejectedNssaiInTa) > 0 {
-					registerContext.RejectedNssaiInTa = ue.NetworkSliceInfo.RejectedNssaiInTa
-				}
-
-				var n1Message bytes.Buffer
-				ue.RegistrationRequest.EncodeRegistrationRequest(&n1Message)
-				callback.SendN1MessageNotifyAtAMFReAllocation(ue, n1Message.Bytes(), &registerContext)
+			if isServedByThisAmf(ue) {
+				ue.GmmLog.Debugf("Allowed NSSAI is served by this AMF")
 			} else {
-				// Condition (B) Step 7: initial AMF can not find Target AMF via NRF -> Send Reroute NAS Request to RAN
-				allowedNssaiNgap := ngapConvert.AllowedNssaiToNgap(ue.AllowedNssai[anType])
-				ngap_message.SendRerouteNasRequest(ue, anType, nil, ue.RanUe[anType].InitialUEMessage, &allowedNssaiNgap)
+				if err := rerouteNasMessage(ue, anType); err != nil {
+					return false, err
+				}
+				return true, nil
 			}
-			return nil
 		}
 	}
 
@@ -1286,6 +1404,181 @@ func handleRequestedNssai(ue *context.AmfUe, anType models.AccessType) error {
 			}
 		}
 	}
+	return false, nil
+}
+
+// isServedByThisAmf reports whether the slices authorized by the NSSF for the UE can be served by this AMF,
+// i.e. the target AMF set is the AMF set of this AMF or this AMF is one of the candidate AMFs
+func isServedByThisAmf(ue *context.AmfUe) bool {
+	amfSelf := context.AMF_Self()
+	networkSliceInfo := ue.NetworkSliceInfo
+
+	if networkSliceInfo == nil {
+		return true
+	}
+	if networkSliceInfo.TargetAmfSet != "" {
+		plmnId, amfRegionId, amfSetId, err := parseTargetAmfSet(networkSliceInfo.TargetAmfSet)
+		if err != nil {
+			ue.GmmLog.Warnf("Invalid TargetAmfSet[%s]: %+v", networkSliceInfo.TargetAmfSet, err)
+			return true
+		}
+		for _, guami := range amfSelf.ServedGuamiList {
+			if !reflect.DeepEqual(*guami.PlmnId, plmnId) || len(guami.AmfId) != 6 {
+				continue
+			}
+			// AMF ID := <AMF Region ID (8 bits)><AMF Set ID (10 bits)><AMF Pointer (6 bits)>
+			servedRegionId, errRegion := strconv.ParseUint(guami.AmfId[:2], 16, 8)
+			servedSetAndPointer, errSet := strconv.ParseUint(guami.AmfId[2:], 16, 16)
+			if errRegion == nil && errSet == nil &&
+				servedRegionId == amfRegionId && servedSetAndPointer>>6 == amfSetId {
+				return true
+			}
+		}
+		return false
+	}
+	if len(networkSliceInfo.CandidateAmfList) > 0 {
+		for _, candidateAmf := range networkSliceInfo.CandidateAmfList {
+			if candidateAmf == amfSelf.NfId {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// TS 29.531 TargetAmfSet format: ^[0-9]{3}-[0-9]{2-3}-[A-Fa-f0-9]{2}-[0-3][A-Fa-f0-9]{2}$
+// mcc-mnc-amfRegionId(8 bit)-AmfSetId(10 bit)
+func parseTargetAmfSet(targetAmfSet string) (plmnId models.PlmnId, amfRegionId, amfSetId uint64, err error) {
+	targetAmfSetToken := strings.Split(targetAmfSet, "-")
+	if len(targetAmfSetToken) != 4 {
+		err = fmt.Errorf("TargetAmfSet should be mcc-mnc-amfRegionId-amfSetId")
+		return
+	}
+	plmnId = models.PlmnId{
+		Mcc: targetAmfSetToken[0],
+		Mnc: targetAmfSetToken[1],
+	}
+	if amfRegionId, err = strconv.ParseUint(targetAmfSetToken[2], 16, 8); err != nil {
+		return
+	}
+	amfSetId, err = strconv.ParseUint(targetAmfSetToken[3], 16, 10)
+	return
+}
+
+// TS 23.502 4.2.2.2.3 Registration with AMF re-allocation: the initial AMF forwards the Registration Request
+// to the target AMF directly (Condition A), or via the NG-RAN with Reroute NAS Request (Condition B),
+// then removes the UE context locally
+func rerouteNasMessage(ue *context.AmfUe, anType models.AccessType) error {
+	amfSelf := context.AMF_Self()
+	networkSliceInfo := ue.NetworkSliceInfo
+
+	// Step 5: Initial AMF send Namf_Communication_RegistrationStatusUpdate to old AMF
+	if ue.ServingAmfChanged && ue.TargetAmfUri != "" {
+		req := models.UeRegStatusUpdateReqData{
+			TransferStatus: models.UeContextTransferStatus_NOT_TRANSFERRED,
+		}
+		_, problemDetails, err := consumer.RegistrationStatusUpdate(ue, req)
+		if problemDetails != nil {
+			ue.GmmLog.Errorf("Registration Status Update Failed Problem[%+v]", problemDetails)
+		} else if err != nil {
+			ue.GmmLog.Errorf("Registration Status Update Error[%+v]", err)
+		}
+		ue.TargetAmfUri = ""
+	}
+
+	// Step 6: search the target AMF
+	var targetAmfSetId string
+	err := fmt.Errorf("No target AMF set or candidate AMF provided by NSSF")
+	if networkSliceInfo.TargetAmfSet != "" {
+		searchTargetAmfQueryParam := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{}
+		targetAmfSetToken := strings.Split(networkSliceInfo.TargetAmfSet, "-")
+		targetAmfSetId = targetAmfSetToken[3]
+		guami := amfSelf.ServedGuamiList[0]
+		targetAmfPlmnId := models.PlmnId{
+			Mcc: targetAmfSetToken[0],
+			Mnc: targetAmfSetToken[1],
+		}
+
+		if !reflect.DeepEqual(*guami.PlmnId, targetAmfPlmnId) {
+			searchTargetAmfQueryParam.TargetPlmnList =
+				optional.NewInterface(util.MarshToJsonString([]models.PlmnId{targetAmfPlmnId}))
+			searchTargetAmfQueryParam.RequesterPlmnList =
+				optional.NewInterface(util.MarshToJsonString([]models.PlmnId{*guami.PlmnId}))
+		}
+
+		searchTargetAmfQueryParam.AmfRegionId = optional.NewString(targetAmfSetToken[2])
+		searchTargetAmfQueryParam.AmfSetId = optional.NewString(targetAmfSetToken[3])
+		err = consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri,
+			models.NfType_AMF, models.NfType_AMF, &searchTargetAmfQueryParam)
+	} else {
+		// local policy: the first candidate AMF which can be discovered by NRF
+		for _, candidateAmf := range networkSliceInfo.CandidateAmfList {
+			searchTargetAmfQueryParam := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+				TargetNfInstanceId: optional.NewInterface(candidateAmf),
+			}
+			err = consumer.SearchAmfCommunicationInstance(ue, amfSelf.NrfUri,
+				models.NfType_AMF, models.NfType_AMF, &searchTargetAmfQueryParam)
+			if err == nil {
+				break
+			}
+			ue.GmmLog.Warnf("Candidate AMF[%s] not available: %+v", candidateAmf, err)
+		}
+	}
+
+	rerouted := false
+	if err == nil {
+		// Condition (A) Step 7: initial AMF find Target AMF via NRF ->
+		// Send Namf_Communication_N1MessageNotify to Target AMF
+		ueContext := consumer.BuildUeContextModel(ue)
+		registerContext := models.RegistrationContextContainer{
+			UeContext:        &ueContext,
+			AnType:           anType,
+			AnN2ApId:         int32(ue.RanUe[anType].RanUeNgapId),
+			RanNodeId:        ue.RanUe[anType].Ran.RanId,
+			InitialAmfName:   amfSelf.Name,
+			UserLocation:     &ue.Location,
+			RrcEstCause:      ue.RanUe[anType].RRCEstablishmentCause,
+			UeContextRequest: ue.RanUe[anType].UeContextRequest,
+			AnN2IPv4Addr:     ue.RanUe[anType].Ran.Conn.RemoteAddr().String(),
+			AllowedNssai: &models.AllowedNssai{
+				AllowedSnssaiList: ue.AllowedNssai[anType],
+				AccessType:        anType,
+			},
+		}
+		if len(networkSliceInfo.RejectedNssaiInPlmn) > 0 {
+			registerContext.RejectedNssaiInPlmn = networkSliceInfo.RejectedNssaiInPlmn
+		}
+		if len(networkSliceInfo.RejectedNssaiInTa) > 0 {
+			registerContext.RejectedNssaiInTa = networkSliceInfo.RejectedNssaiInTa
+		}
+		if len(ue.ConfiguredNssai) > 0 {
+			registerContext.ConfiguredNssai = ue.ConfiguredNssai
+		}
+
+		var n1Message bytes.Buffer
+		ue.RegistrationRequest.EncodeRegistrationRequest(&n1Message)
+		if err = callback.SendN1MessageNotifyAtAMFReAllocation(ue, n1Message.Bytes(), &registerContext); err != nil {
+			ue.GmmLog.Warnf("Reroute to target AMF[%s] failed: %+v", ue.TargetAmfUri, err)
+		} else {
+			ue.GmmLog.Infof("Registration Request rerouted to target AMF[%s]", ue.TargetAmfUri)
+			rerouted = true
+		}
+	}
+
+	if !rerouted {
+		// Condition (B) Step 7: initial AMF can not find Target AMF via NRF -> Send Reroute NAS Request to RAN
+		if targetAmfSetId == "" {
+			gmm_message.SendRegistrationReject(ue.RanUe[anType], nasMessage.Cause5GMMProtocolErrorUnspecified, "")
+			return fmt.Errorf("Reroute NAS message failed: %+v", err)
+		}
+		allowedNssaiNgap := ngapConvert.AllowedNssaiToNgap(ue.AllowedNssai[anType])
+		ngap_message.SendRerouteNasRequest(ue, anType, nil, ue.RanUe[anType].InitialUEMessage,
+			targetAmfSetId, &allowedNssaiNgap)
+	}
+
+	// the UE is served by the target AMF from now on
+	ue.Remove()
 	return nil
 }
 
@@ -0,0 +1,83 @@
+package gmm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/free5gc/amf/consumer"
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/factory"
+	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestCheckEquipmentIdentity(t *testing.T) {
+	var checkedPeis []string
+	eir := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pei := r.URL.Query().Get("pei")
+		checkedPeis = append(checkedPeis, pei)
+		status := consumer.EquipmentStatusWhitelisted
+		if pei == "imei-356938035643809" {
+			status = consumer.EquipmentStatusBlacklisted
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(consumer.EirResponseData{Status: status}); err != nil {
+			t.Errorf("Encode EIR response error: %+v", err)
+		}
+	}))
+	defer eir.Close()
+
+	amfSelf := context.AMF_Self()
+	if len(amfSelf.ServedGuamiList) == 0 {
+		amfSelf.ServedGuamiList = []models.Guami{{
+			PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"},
+			AmfId:  "cafe00",
+		}}
+	}
+	equipmentIdentityCheck := amfSelf.EquipmentIdentityCheck
+	amfSelf.EquipmentIdentityCheck = factory.EquipmentIdentityCheck{Enable: true, RejectOnFailure: true}
+	defer func() {
+		amfSelf.EquipmentIdentityCheck = equipmentIdentityCheck
+	}()
+
+	testCases := []struct {
+		name            string
+		pei             string
+		rejectOnFailure bool
+		reject          bool
+		checked         bool
+	}{
+		{"allowed", "imei-490154203237518", true, false, true},
+		{"blacklisted", "imei-356938035643809", true, true, true},
+		{"empty PEI", "", true, true, false},
+		{"empty PEI accepted on failure", "", false, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkedPeis = nil
+			amfSelf.EquipmentIdentityCheck.RejectOnFailure = tc.rejectOnFailure
+			ue := amfSelf.NewAmfUe("imsi-208930000000003")
+			defer ue.Remove()
+			ue.GmmLog = logger.GmmLog
+			ue.EirUri = eir.URL
+			ue.Pei = tc.pei
+			ran := &context.AmfRan{AnType: models.AccessType__3_GPP_ACCESS, Log: logger.NgapLog}
+			ranUe, err := ran.NewRanUe(1)
+			if err != nil {
+				t.Fatalf("NewRanUe error: %+v", err)
+			}
+			ue.AttachRanUe(ranUe)
+
+			err = checkEquipmentIdentity(ue, models.AccessType__3_GPP_ACCESS)
+			if reject := err != nil; reject != tc.reject {
+				t.Errorf("checkEquipmentIdentity(%q) = %v, expected reject %t", tc.pei, err, tc.reject)
+			}
+			if checked := len(checkedPeis) != 0; checked != tc.checked {
+				t.Errorf("checkEquipmentIdentity(%q) checked %q, expected checked %t", tc.pei, checkedPeis, tc.checked)
+			}
+		})
+	}
+}
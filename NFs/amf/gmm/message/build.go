@@ -276,7 +276,6 @@ func BuildServiceReject(pDUSessionStatus *[16]bool, cause uint8) ([]byte, error)
 	return m.PlainNasEncode()
 }
 
-// T3346 timer are not supported
 func BuildRegistrationReject(ue *context.AmfUe, cause5GMM uint8, eapMessage string) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
@@ -296,6 +295,14 @@ func BuildRegistrationReject(ue *context.AmfUe, cause5GMM uint8, eapMessage stri
 		registrationReject.T3502Value.SetGPRSTimer2Value(t3502)
 	}
 
+	// TS 24.501 5.5.1.2.5: T3346 is included when the registration is rejected due to congestion
+	if t3346Value := context.AMF_Self().OverloadControl.Cfg.T3346Value; cause5GMM == nasMessage.Cause5GMMCongestion &&
+		t3346Value > 0 {
+		registrationReject.T3346Value = nasType.NewT3346Value(nasMessage.RegistrationRejectT3346ValueType)
+		registrationReject.T3346Value.SetLen(1)
+		registrationReject.T3346Value.SetGPRSTimer2Value(nasConvert.GPRSTimer2ToNas(t3346Value))
+	}
+
 	if eapMessage != "" {
 		registrationReject.EAPMessage = nasType.NewEAPMessage(nasMessage.RegistrationRejectEAPMessageType)
 		rawEapMsg, err := base64.StdEncoding.DecodeString(eapMessage)
@@ -612,7 +619,14 @@ func BuildRegistrationAccept(
 
 	m.GmmMessage.RegistrationAccept = registrationAccept
 
-	return nas_security.Encode(ue, m)
+	// Negotiated extended DRX parameters is not supported by the nas library, it follows the Negotiated DRX
+	// parameters which is the last IE of the Registration Accept encoded by the nas library (TS 24.501 8.2.7.1)
+	var ies []byte
+	if ue.NegotiatedExtendedDRX != nil {
+		ies = nas_security.EncodeExtendedDRXParameters(ue.NegotiatedExtendedDRX)
+	}
+
+	return nas_security.EncodeWithIEs(ue, m, ies)
 }
 
 func includeConfiguredNssaiCheck(ue *context.AmfUe) bool {
@@ -99,4 +99,11 @@ var routes = Routes{
 		"/n1-message-notify",
 		HTTPN1MessageNotify,
 	},
+
+	{
+		"N2InfoNotify",
+		strings.ToUpper("Post"),
+		"/n2-info-notify",
+		HTTPN2InfoNotify,
+	},
 }
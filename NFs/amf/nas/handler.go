@@ -21,6 +21,8 @@ func HandleNAS(ue *context.RanUe, procedureCode int64, nasPdu []byte) {
 		return
 	}
 
+	amfSelf.OverloadControl.CountNasMessage()
+
 	if ue.AmfUe == nil {
 		ue.AmfUe = amfSelf.NewAmfUe("")
 		ue.AmfUe.AttachRanUe(ue)
@@ -35,6 +37,10 @@ func HandleNAS(ue *context.RanUe, procedureCode int64, nasPdu []byte) {
 		ue.AmfUe.NASLog.Errorln(err)
 		return
 	}
+	// the old AMF checks the integrity of the registration request when the UE context is transferred
+	if msg.GmmMessage != nil && msg.GmmMessage.RegistrationRequest != nil {
+		ue.AmfUe.RegistrationRequestNasPdu = nasPdu
+	}
 
 	if err := Dispatch(ue.AmfUe, ue.Ran.AnType, procedureCode, msg); err != nil {
 		ue.AmfUe.NASLog.Errorf("Handle NAS Error: %v", err)
@@ -0,0 +1,64 @@
+package nas_security
+
+import (
+	"encoding/binary"
+
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+// Extended DRX parameters IEI in Registration Request and Registration Accept (TS 24.501 8.2.6.1, 8.2.7.1),
+// the IE is not supported by the nas library
+const ExtendedDRXParametersType uint8 = 0x6E
+
+// DecodeRequestedExtendedDRX returns the requested extended DRX parameters IE of the Registration Request decoded
+// by the nas library from the plain payload, nil is returned if the IE is absent or the message is malformed
+func DecodeRequestedExtendedDRX(registrationRequest *nasMessage.RegistrationRequest,
+	payload []byte) *context.ExtendedDRXParameters {
+	if registrationRequest == nil || registrationRequest.MobileIdentity5GS.GetLen() == 0 {
+		return nil
+	}
+	// the optional IEs follow the mandatory IEs decoded by the nas library: extended protocol discriminator,
+	// security header type, message type, ngKSI with 5GS registration type and 5GS mobile identity (LV-E)
+	offset := 6 + int(registrationRequest.MobileIdentity5GS.GetLen())
+
+	for offset < len(payload) {
+		iei := payload[offset]
+		switch {
+		case iei >= 0x80:
+			// type 1 IEs are one octet long (TS 24.007 11.2.1.1)
+			offset++
+		case iei&0xf0 == 0x70:
+			// the 0x7X IEIs are TLV-E (TS 24.007 11.2.4), e.g. the NAS message container
+			if offset+3 > len(payload) {
+				return nil
+			}
+			offset += 3 + int(binary.BigEndian.Uint16(payload[offset+1:]))
+		default:
+			// TLV, e.g. the requested DRX parameters
+			if offset+2 > len(payload) {
+				return nil
+			}
+			length := int(payload[offset+1])
+			if offset+2+length > len(payload) {
+				return nil
+			}
+			if iei == ExtendedDRXParametersType {
+				if length < 1 {
+					return nil
+				}
+				return &context.ExtendedDRXParameters{
+					PagingTimeWindow: payload[offset+2] >> 4,
+					EDRXValue:        payload[offset+2] & 0x0f,
+				}
+			}
+			offset += 2 + length
+		}
+	}
+	return nil
+}
+
+// EncodeExtendedDRXParameters encodes the extended DRX parameters IE (TS 24.008 10.5.5.32)
+func EncodeExtendedDRXParameters(edrx *context.ExtendedDRXParameters) []byte {
+	return []byte{ExtendedDRXParametersType, 1, edrx.PagingTimeWindow<<4 | edrx.EDRXValue&0x0f}
+}
@@ -0,0 +1,129 @@
+package nas_security
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+)
+
+// plain Registration Request for initial registration with a SUCI
+var registrationRequestHeader = []byte{
+	0x7e, 0x00, 0x41, 0x71,
+	0x00, 0x0d, 0x01, 0x02, 0xf8, 0x39, 0xf0, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+}
+
+func TestDecodeRequestedExtendedDRX(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ies      []byte
+		expected *context.ExtendedDRXParameters
+	}{
+		{
+			name:     "no optional IE",
+			expected: nil,
+		},
+		{
+			name: "no extended DRX parameters",
+			ies: []byte{
+				0x2e, 0x02, 0x80, 0x20, // UE security capability
+				0x51, 0x01, 0x02, // requested DRX parameters
+			},
+			expected: nil,
+		},
+		{
+			name:     "extended DRX parameters only",
+			ies:      []byte{0x6e, 0x01, 0x35},
+			expected: &context.ExtendedDRXParameters{PagingTimeWindow: 3, EDRXValue: 5},
+		},
+		{
+			name: "extended DRX parameters after TLV, TLV-E and type 1 IEs",
+			ies: []byte{
+				0x2e, 0x02, 0x80, 0x20, // UE security capability
+				0x51, 0x01, 0x02, // requested DRX parameters
+				0x71, 0x00, 0x02, 0x7e, 0x00, // NAS message container
+				0x90,             // network slicing indication
+				0x6e, 0x01, 0xf9, // requested extended DRX parameters
+			},
+			expected: &context.ExtendedDRXParameters{PagingTimeWindow: 15, EDRXValue: 9},
+		},
+		{
+			name:     "empty extended DRX parameters",
+			ies:      []byte{0x6e, 0x00},
+			expected: nil,
+		},
+		{
+			name:     "truncated extended DRX parameters",
+			ies:      []byte{0x6e, 0x01},
+			expected: nil,
+		},
+		{
+			name:     "truncated TLV-E IE",
+			ies:      []byte{0x71, 0x00, 0x08, 0x7e, 0x00, 0x6e, 0x01, 0x35},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := append(append([]byte{}, registrationRequestHeader...), tc.ies...)
+			msg := nas.NewMessage()
+			if err := msg.PlainNasDecode(&payload); err != nil {
+				t.Fatalf("PlainNasDecode error: %+v", err)
+			}
+			edrx := DecodeRequestedExtendedDRX(msg.RegistrationRequest, payload)
+			if !reflect.DeepEqual(edrx, tc.expected) {
+				t.Errorf("extended DRX parameters %+v, expected %+v", edrx, tc.expected)
+			}
+		})
+	}
+
+	if edrx := DecodeRequestedExtendedDRX(nil, registrationRequestHeader); edrx != nil {
+		t.Errorf("extended DRX parameters %+v of no Registration Request", edrx)
+	}
+	if edrx := DecodeRequestedExtendedDRX(nasMessage.NewRegistrationRequest(0), []byte{0x6e, 0x01, 0x35}); edrx != nil {
+		t.Errorf("extended DRX parameters %+v of no 5GS mobile identity", edrx)
+	}
+}
+
+func TestEncodeExtendedDRXParameters(t *testing.T) {
+	ie := EncodeExtendedDRXParameters(&context.ExtendedDRXParameters{PagingTimeWindow: 3, EDRXValue: 5})
+	if !reflect.DeepEqual(ie, []byte{ExtendedDRXParametersType, 0x01, 0x35}) {
+		t.Errorf("extended DRX parameters IE %x", ie)
+	}
+}
+
+func TestEncodeWithIEsOrder(t *testing.T) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationAccept)
+	registrationAccept := nasMessage.NewRegistrationAccept(0)
+	registrationAccept.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationAccept.RegistrationAcceptMessageIdentity.SetMessageType(nas.MsgTypeRegistrationAccept)
+	registrationAccept.RegistrationResult5GS.SetLen(1)
+	registrationAccept.RegistrationResult5GS.SetRegistrationResultValue5GS(nasMessage.AccessType3GPP)
+	registrationAccept.NegotiatedDRXParameters =
+		nasType.NewNegotiatedDRXParameters(nasMessage.RegistrationAcceptNegotiatedDRXParametersType)
+	registrationAccept.NegotiatedDRXParameters.SetLen(1)
+	registrationAccept.NegotiatedDRXParameters.SetDRXValue(nasMessage.DRXcycleParameterT64)
+	m.GmmMessage.RegistrationAccept = registrationAccept
+
+	ue := new(context.AmfUe)
+	edrx := EncodeExtendedDRXParameters(&context.ExtendedDRXParameters{PagingTimeWindow: 3, EDRXValue: 5})
+	payload, err := EncodeWithIEs(ue, m, edrx)
+	if err != nil {
+		t.Fatalf("EncodeWithIEs error: %+v", err)
+	}
+	// TS 24.501 8.2.7.1: the negotiated extended DRX parameters follows the negotiated DRX parameters
+	expected := []byte{
+		nasMessage.RegistrationAcceptNegotiatedDRXParametersType, 0x01, nasMessage.DRXcycleParameterT64,
+		ExtendedDRXParametersType, 0x01, 0x35,
+	}
+	if len(payload) < len(expected) || !reflect.DeepEqual(payload[len(payload)-len(expected):], expected) {
+		t.Errorf("Registration Accept %x does not end with %x", payload, expected)
+	}
+}
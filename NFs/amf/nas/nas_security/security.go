@@ -12,6 +12,14 @@ import (
 )
 
 func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
+	return EncodeWithIEs(ue, msg, nil)
+}
+
+// EncodeWithIEs encodes the NAS message with the encoded optional IEs appended to the plain message,
+// which is used for the IEs not supported by the nas library yet. The optional IEs have to be in the order
+// of the message definition (e.g. TS 24.501 8.2.7 for the Registration Accept) and follow all the IEs
+// encoded by the nas library
+func EncodeWithIEs(ue *context.AmfUe, msg *nas.Message, ies []byte) ([]byte, error) {
 	if ue == nil {
 		return nil, fmt.Errorf("amfUe is nil")
 	}
@@ -21,7 +29,11 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 
 	// Plain NAS message
 	if !ue.SecurityContextAvailable {
-		return msg.PlainNasEncode()
+		payload, err := msg.PlainNasEncode()
+		if err != nil {
+			return nil, err
+		}
+		return append(payload, ies...), nil
 	} else {
 		// Security protected NAS Message
 		// a security protected NAS message must be integrity protected, and ciphering is optional
@@ -45,6 +57,7 @@ func Encode(ue *context.AmfUe, msg *nas.Message) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Plain NAS encode error: %+v", err)
 		}
+		payload = append(payload, ies...)
 
 		ue.NASLog.Tracef("plain payload:\n%+v", hex.Dump(payload))
 
@@ -101,7 +114,7 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 		if ue.SecurityContextAvailable && ue.RanUe[accessType].RRCEstablishmentCause != "0" {
 			ue.NASLog.Warnln("Received Plain NAS message")
 			ue.MacFailed = false
-			if err := msg.PlainNasDecode(&payload); err != nil {
+			if err := plainNasDecode(ue, msg, payload); err != nil {
 				return nil, err
 			}
 
@@ -133,7 +146,7 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 			}
 		} else {
 			ue.MacFailed = false
-			err := msg.PlainNasDecode(&payload)
+			err := plainNasDecode(ue, msg, payload)
 			return msg, err
 		}
 	} else { // Security protected NAS message
@@ -196,7 +209,19 @@ func Decode(ue *context.AmfUe, accessType models.AccessType, payload []byte) (*n
 
 		// remove sequece Number
 		payload = payload[1:]
-		err = msg.PlainNasDecode(&payload)
+		err = plainNasDecode(ue, msg, payload)
 		return msg, err
 	}
 }
+
+// plainNasDecode decodes the plain NAS message, the IEs not supported by the nas library yet
+// are decoded into the UE context
+func plainNasDecode(ue *context.AmfUe, msg *nas.Message, payload []byte) error {
+	if err := msg.PlainNasDecode(&payload); err != nil {
+		return err
+	}
+	if msg.GmmMessage != nil && msg.GmmHeader.GetMessageType() == nas.MsgTypeRegistrationRequest {
+		ue.RequestedExtendedDRX = DecodeRequestedExtendedDRX(msg.RegistrationRequest, payload)
+	}
+	return nil
+}
@@ -21,6 +21,9 @@ func Dispatch(conn net.Conn, msg []byte) {
 		ran = amfSelf.NewAmfRan(conn)
 	}
 
+	amfSelf.OverloadControl.EnterNgapMessage()
+	defer amfSelf.OverloadControl.LeaveNgapMessage()
+
 	if len(msg) == 0 {
 		ran.Log.Infof("RAN close the connection.")
 		ran.Remove()
@@ -83,6 +86,8 @@ func Dispatch(conn net.Conn, msg []byte) {
 			HandlePDUSessionResourceModifyIndication(ran, pdu)
 		case ngapType.ProcedureCodeCellTrafficTrace:
 			HandleCellTrafficTrace(ran, pdu)
+		case ngapType.ProcedureCodeTraceFailureIndication:
+			HandleTraceFailureIndication(ran, pdu)
 		case ngapType.ProcedureCodeUplinkRANStatusTransfer:
 			HandleUplinkRanStatusTransfer(ran, pdu)
 		case ngapType.ProcedureCodeUplinkNonUEAssociatedNRPPaTransport:
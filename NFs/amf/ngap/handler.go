@@ -2,7 +2,12 @@ package ngap
 
 import (
 	"encoding/hex"
+	"fmt"
+	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/antihax/optional"
 
 	"github.com/free5gc/amf/consumer"
 	"github.com/free5gc/amf/context"
@@ -10,11 +15,14 @@ import (
 	"github.com/free5gc/amf/logger"
 	"github.com/free5gc/amf/nas"
 	ngap_message "github.com/free5gc/amf/ngap/message"
+	"github.com/free5gc/amf/producer/callback"
+	"github.com/free5gc/amf/util"
 	"github.com/free5gc/aper"
 	"github.com/free5gc/nas/nasMessage"
 	libngap "github.com/free5gc/ngap"
 	"github.com/free5gc/ngap/ngapConvert"
 	"github.com/free5gc/ngap/ngapType"
+	"github.com/free5gc/openapi/Nnrf_NFDiscovery"
 	"github.com/free5gc/openapi/models"
 )
 
@@ -139,10 +147,21 @@ func HandleNGSetupRequest(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		}
 	}
 
+	var timeToWait *ngapType.TimeToWait
+	if cause.Present == ngapType.CausePresentNothing && context.AMF_Self().OverloadControl.IsOverloaded() {
+		// TS 38.413 8.7.1.4: the NG-RAN shall wait at least for the Time To Wait before reinitiating the NG Setup
+		ran.Log.Warn("NG-Setup failure: AMF overloaded")
+		cause.Present = ngapType.CausePresentMisc
+		cause.Misc = &ngapType.CauseMisc{
+			Value: ngapType.CauseMiscPresentControlProcessingOverload,
+		}
+		timeToWait = context.AMF_Self().OverloadControl.TimeToWait()
+	}
+
 	if cause.Present == ngapType.CausePresentNothing {
 		ngap_message.SendNGSetupResponse(ran)
 	} else {
-		ngap_message.SendNGSetupFailure(ran, cause)
+		ngap_message.SendNGSetupFailure(ran, cause, timeToWait)
 	}
 }
 
@@ -433,9 +452,6 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		case ngapType.ProtocolIEIDInfoOnRecommendedCellsAndRANNodesForPaging:
 			infoOnRecommendedCellsAndRANNodesForPaging = ie.Value.InfoOnRecommendedCellsAndRANNodesForPaging
 			ran.Log.Trace("Decode IE InfoOnRecommendedCellsAndRANNodesForPaging")
-			if infoOnRecommendedCellsAndRANNodesForPaging != nil {
-				ran.Log.Warn("IE infoOnRecommendedCellsAndRANNodesForPaging is not support")
-			}
 		case ngapType.ProtocolIEIDPDUSessionResourceListCxtRelCpl:
 			pDUSessionResourceList = ie.Value.PDUSessionResourceListCxtRelCpl
 			ran.Log.Trace("Decode IE PDUSessionResourceList")
@@ -474,7 +490,13 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		}
 		return
 	}
-	// TODO: AMF shall, if supported, store it and may use it for subsequent paging
+	// the location reporting requested to the NG-RAN ends with the release of the UE context (TS 38.413 8.12.1.2)
+	if ran.AnType == models.AccessType__3_GPP_ACCESS {
+		amfUe.ClearLocationReporting()
+	}
+	// TS 23.502 4.2.6 step 5: AMF stores it and uses it for subsequent paging, the information of
+	// the previous release is outdated
+	amfUe.InfoOnRecommendedCellsAndRanNodesForPaging = nil
 	if infoOnRecommendedCellsAndRANNodesForPaging != nil {
 		amfUe.InfoOnRecommendedCellsAndRanNodesForPaging = new(context.InfoOnRecommendedCellsAndRanNodesForPaging)
 
@@ -514,8 +536,8 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 			switch item.AMFPagingTarget.Present {
 			case ngapType.AMFPagingTargetPresentGlobalRANNodeID:
 				recommendedRanNode.Present = context.RecommendRanNodePresentRanNode
-				recommendedRanNode.GlobalRanNodeId = new(models.GlobalRanNodeId)
-				// TODO: recommendedRanNode.GlobalRanNodeId = ngapConvert.RanIdToModels(item.AMFPagingTarget.GlobalRANNodeID)
+				globalRanNodeId := ngapConvert.RanIdToModels(*item.AMFPagingTarget.GlobalRANNodeID)
+				recommendedRanNode.GlobalRanNodeId = &globalRanNodeId
 			case ngapType.AMFPagingTargetPresentTAI:
 				recommendedRanNode.Present = context.RecommendRanNodePresentTAI
 				tai := ngapConvert.TaiToModels(*item.AMFPagingTarget.TAI)
@@ -530,7 +552,8 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 	if tmp, exist := amfUe.ReleaseCause[ran.AnType]; exist {
 		cause = *tmp
 	}
-	if amfUe.State[ran.AnType].Is(context.Registered) {
+	// the user plane of the PDU sessions has been handed over to the target NG-RAN
+	if amfUe.State[ran.AnType].Is(context.Registered) && ranUe.ReleaseAction != context.UeContextReleaseHandover {
 		ranUe.Log.Info("Rel Ue Context in GMM-Registered")
 		if pDUSessionResourceList != nil {
 			for _, pduSessionReourceItem := range pDUSessionResourceList.List {
@@ -568,16 +591,35 @@ func HandleUEContextReleaseComplete(ran *context.AmfRan, message *ngapType.NGAPP
 		amfUe.Remove()
 	case context.UeContextReleaseHandover:
 		ran.Log.Infof("Release UE[%s] Context : Release for Handover", amfUe.Supi)
-		// TODO: it's a workaround, need to fix it.
-		targetRanUe := context.AMF_Self().RanUeFindByAmfUeNgapID(ranUe.TargetUe.AmfUeNgapId)
+		switch {
+		case ranUe.TargetUe != nil:
+			// TODO: it's a workaround, need to fix it.
+			targetRanUe := context.AMF_Self().RanUeFindByAmfUeNgapID(ranUe.TargetUe.AmfUeNgapId)
 
-		context.DetachSourceUeTargetUe(ranUe)
-		err := ranUe.Remove()
-		if err != nil {
-			ran.Log.Errorln(err.Error())
+			context.DetachSourceUeTargetUe(ranUe)
+			err := ranUe.Remove()
+			if err != nil {
+				ran.Log.Errorln(err.Error())
+			}
+			amfUe.AttachRanUe(targetRanUe)
+			// Todo: remove indirect tunnel
+		case ranUe.SourceUe != nil:
+			// handover failed or cancelled in the target NG-RAN, the UE stays on the source NG-RAN
+			context.DetachSourceUeTargetUe(ranUe)
+			ranUe.DetachAmfUe()
+			err := ranUe.Remove()
+			if err != nil {
+				ran.Log.Errorln(err.Error())
+			}
+		default:
+			// handover between different AMF, the UE context has been relocated to the T-AMF,
+			// or the handover has failed in this T-AMF
+			err := ranUe.Remove()
+			if err != nil {
+				ran.Log.Errorln(err.Error())
+			}
+			amfUe.Remove()
 		}
-		amfUe.AttachRanUe(targetRanUe)
-		// Todo: remove indirect tunnel
 	default:
 		ran.Log.Errorf("Invalid Release Action[%d]", ranUe.ReleaseAction)
 	}
@@ -830,9 +872,9 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	var userLocationInformation *ngapType.UserLocationInformation
 	var rRCEstablishmentCause *ngapType.RRCEstablishmentCause
 	var fiveGSTMSI *ngapType.FiveGSTMSI
-	// var aMFSetID *ngapType.AMFSetID
+	var aMFSetID *ngapType.AMFSetID
 	var uEContextRequest *ngapType.UEContextRequest
-	// var allowedNSSAI *ngapType.AllowedNSSAI
+	var allowedNSSAI *ngapType.AllowedNSSAI
 
 	var iesCriticalityDiagnostics ngapType.CriticalityDiagnosticsIEList
 
@@ -890,13 +932,13 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 			fiveGSTMSI = ie.Value.FiveGSTMSI
 			ran.Log.Trace("Decode IE 5G-S-TMSI")
 		case ngapType.ProtocolIEIDAMFSetID: // optional, ignore
-			// aMFSetID = ie.Value.AMFSetID
+			aMFSetID = ie.Value.AMFSetID
 			ran.Log.Trace("Decode IE AmfSetID")
 		case ngapType.ProtocolIEIDUEContextRequest: // optional, ignore
 			uEContextRequest = ie.Value.UEContextRequest
 			ran.Log.Trace("Decode IE UEContextRequest")
 		case ngapType.ProtocolIEIDAllowedNSSAI: // optional, reject
-			// allowedNSSAI = ie.Value.AllowedNSSAI
+			allowedNSSAI = ie.Value.AllowedNSSAI
 			ran.Log.Trace("Decode IE Allowed NSSAI")
 		}
 	}
@@ -943,8 +985,8 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 			guti := servedGuami.PlmnId.Mcc + servedGuami.PlmnId.Mnc + amfID + tmsi
 
-			// TODO: invoke Namf_Communication_UEContextTransfer if serving AMF has changed since
-			// last Registration Request procedure
+			// if the serving AMF has changed since last Registration Request procedure, the UE context is
+			// retrieved with Namf_Communication_UEContextTransfer when the Registration Request is handled
 			// Described in TS 23.502 4.2.2.2.2 step 4 (without UDSF deployment)
 
 			if amfUe, ok := amfSelf.AmfUeFindByGuti(guti); !ok {
@@ -983,17 +1025,17 @@ func HandleInitialUEMessage(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		ranUe.UeContextRequest = false
 	}
 
-	// TS 23.502 4.2.2.2.3 step 6a Nnrf_NFDiscovery_Request (NF type, AMF Set)
-	// if aMFSetID != nil {
-	// TODO: This is a rerouted message
-	// TS 38.413: AMF shall, if supported, use the IE as described in TS 23.502
-	// }
+	// TS 23.502 4.2.2.2.3 step 7(B): this is a message rerouted by the NG-RAN to the AMF set selected by NSSF
+	if aMFSetID != nil && len(aMFSetID.Value.Bytes) == 2 {
+		amfSetId := uint16(aMFSetID.Value.Bytes[0])<<2 | uint16(aMFSetID.Value.Bytes[1])>>6
+		ranUe.Log.Infof("Rerouted Initial UE Message [AmfSetID: %03x]", amfSetId)
+	}
 
 	// ng-ran propagate allowedNssai in the rerouted initial ue message (TS 38.413 8.6.5)
-	// TS 23.502 4.2.2.2.3 step 4a Nnssf_NSSelection_Get
-	// if allowedNSSAI != nil {
-	// TODO: AMF should use it as defined in TS 23.502
-	// }
+	// the allowed NSSAI has been selected by the initial AMF, so Nnssf_NSSelection_Get is skipped
+	if allowedNSSAI != nil {
+		ranUe.AllowedNssai = ngapConvert.AllowedNssaiToModels(*allowedNSSAI)
+	}
 
 	pdu, err := libngap.Encoder(*message)
 	if err != nil {
@@ -1723,6 +1765,9 @@ func HandleInitialContextSetupResponse(ran *context.AmfRan, message *ngapType.NG
 
 	if ranUe.Ran.AnType == models.AccessType_NON_3_GPP_ACCESS {
 		ngap_message.SendDownlinkNasTransport(ranUe, amfUe.RegistrationAcceptForNon3GPPAccess, nil)
+	} else {
+		// the location reporting of the subscriptions is restarted when the UE enters CM-CONNECTED
+		ngap_message.SendLocationReportingControlForSubscriptions(amfUe)
 	}
 
 	if criticalityDiagnostics != nil {
@@ -2287,11 +2332,43 @@ func HandleHandoverNotify(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	}
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: Send to S-AMF
-		// Desciibed in (23.502 4.9.1.3.3) [conditional] 6a.Namf_Communication_N2InfoNotify.
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
+		// handover between different AMF, described in (23.502 4.9.1.3.3) step 2-6
+		amfSelf := context.AMF_Self()
+		var guami *models.Guami
+		if len(amfSelf.ServedGuamiList) > 0 {
+			guami = &amfSelf.ServedGuamiList[0]
+		}
+		successPduSessionId := make(map[int32]bool)
+		for _, pduSessionid := range targetUe.SuccessPduSessionId {
+			smContext, ok := amfUe.SmContextFindByPDUSessionID(pduSessionid)
+			if !ok {
+				targetUe.Log.Errorf("SmContext[PDU Session ID:%d] not found", pduSessionid)
+				continue
+			}
+			successPduSessionId[pduSessionid] = true
+			_, _, _, err := consumer.SendUpdateSmContextN2HandoverComplete(amfUe, smContext, amfSelf.NfId, guami)
+			if err != nil {
+				ran.Log.Errorf("Send UpdateSmContextN2HandoverComplete Error[%s]", err.Error())
+			}
+		}
+		// the PDU sessions not handed over are released by the S-AMF
+		var releaseList []int32
+		amfUe.SmContextList.Range(func(key, value interface{}) bool {
+			if pduSessionID := key.(int32); !successPduSessionId[pduSessionID] {
+				releaseList = append(releaseList, pduSessionID)
+				amfUe.SmContextList.Delete(pduSessionID)
+			}
+			return true
+		})
+		amfUe.AttachRanUe(targetUe)
+		amfUe.OnGoing[ran.AnType].Procedure = context.OnGoingProcedureNothing
+		amfUe.HandoverResult = nil
+
+		if err := callback.SendN2InfoNotifyN2Handover(amfUe, releaseList); err != nil {
+			targetUe.Log.Errorf("Send N2InfoNotify to S-AMF error: %+v", err)
+		}
+		ran.Log.Info("Handle Handover notification finished")
 	} else {
-		ran.Log.Info("Handle Handover notification Finshed ")
 		for _, pduSessionid := range targetUe.SuccessPduSessionId {
 			smContext, ok := amfUe.SmContextFindByPDUSessionID(pduSessionid)
 			if !ok {
@@ -2306,6 +2383,7 @@ func HandleHandoverNotify(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 		ngap_message.SendUEContextReleaseCommand(sourceUe, context.UeContextReleaseHandover, ngapType.CausePresentNas,
 			ngapType.CauseNasPresentNormalRelease)
+		ran.Log.Info("Handle Handover notification finished")
 	}
 
 	// TODO: The UE initiates Mobility Registration Update procedure as described in clause 4.2.2.2.2.
@@ -2651,8 +2729,14 @@ func HandleHandoverRequestAcknowledge(ran *context.AmfRan, message *ngapType.NGA
 
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: Send Namf_Communication_CreateUEContext Response to S-AMF
-		ran.Log.Error("handover between different Ue has not been implement yet")
+		// handover between different AMF, answer the Namf_Communication_CreateUEContext of the S-AMF
+		// described in (23.502 4.9.1.3.2) step 12
+		if amfUe.HandoverResult == nil {
+			targetUe.Log.Error("No CreateUEContext request is waiting for the handover resources")
+			return
+		}
+		deliverHandoverResult(targetUe, buildHandoverResult(targetUe, pduSessionResourceHandoverList,
+			pduSessionResourceToReleaseList, targetToSourceTransparentContainer))
 	} else {
 		ran.Log.Tracef("Source: RanUeNgapID[%d] AmfUeNgapID[%d]", sourceUe.RanUeNgapId, sourceUe.AmfUeNgapId)
 		ran.Log.Tracef("Target: RanUeNgapID[%d] AmfUeNgapID[%d]", targetUe.RanUeNgapId, targetUe.AmfUeNgapId)
@@ -2672,6 +2756,85 @@ func HandleHandoverRequestAcknowledge(ran *context.AmfRan, message *ngapType.NGA
 	}
 }
 
+// buildHandoverResult builds the Namf_Communication_CreateUEContext response of the T-AMF,
+// the N2 SM information of the PDU sessions are carried in the binary parts
+func buildHandoverResult(targetUe *context.RanUe, handoverList ngapType.PDUSessionResourceHandoverList,
+	toReleaseList ngapType.PDUSessionResourceToReleaseListHOCmd,
+	targetToSourceTransparentContainer *ngapType.TargetToSourceTransparentContainer) *context.HandoverResult {
+	if len(handoverList.List) == 0 || targetToSourceTransparentContainer == nil {
+		targetUe.Log.Info("Handle Handover Preparation Failure [HoFailure In Target5GC NgranNode Or TargetSystem]")
+		return &context.HandoverResult{
+			Error: &models.UeContextCreateError{
+				Error: &models.ProblemDetails{
+					Status: http.StatusForbidden,
+					Cause:  "HANDOVER_FAILURE",
+				},
+				NgapCause: &models.NgApCause{
+					Group: int32(ngapType.CausePresentRadioNetwork),
+					Value: int32(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem),
+				},
+			},
+		}
+	}
+
+	response := &models.CreateUeContextResponse{
+		JsonData: &models.UeContextCreatedData{
+			UeContext: &models.UeContext{
+				Supi: targetUe.AmfUe.Supi,
+			},
+			TargetToSourceData: &models.N2InfoContent{
+				NgapIeType: models.NgapIeType_TAR_TO_SRC_CONTAINER,
+				NgapData: &models.RefToBinaryData{
+					ContentId: "N2TargetToSource",
+				},
+			},
+		},
+		BinaryDataN2Information: targetToSourceTransparentContainer.Value,
+	}
+	binaries := context.CreatedPduSessionListBinaries(response)
+	for i, item := range handoverList.List {
+		if i >= len(binaries) {
+			targetUe.Log.Warnf("PDU Session ID[%d] exceeds the PDU sessions of CreateUEContext", item.PDUSessionID.Value)
+			break
+		}
+		response.JsonData.PduSessionList = append(response.JsonData.PduSessionList, models.N2SmInformation{
+			PduSessionId: int32(item.PDUSessionID.Value),
+			N2InfoContent: &models.N2InfoContent{
+				NgapIeType: models.NgapIeType_HANDOVER_CMD,
+				NgapData: &models.RefToBinaryData{
+					ContentId: fmt.Sprintf("N2SmInfo%d", item.PDUSessionID.Value),
+				},
+			},
+		})
+		*binaries[i] = item.HandoverCommandTransfer
+	}
+	binaries = context.FailedSessionListBinaries(response)
+	for i, item := range toReleaseList.List {
+		if i >= len(binaries) {
+			break
+		}
+		response.JsonData.FailedSessionList = append(response.JsonData.FailedSessionList, models.N2SmInformation{
+			PduSessionId: int32(item.PDUSessionID.Value),
+			N2InfoContent: &models.N2InfoContent{
+				NgapIeType: models.NgapIeType_HANDOVER_PREP_FAIL,
+				NgapData: &models.RefToBinaryData{
+					ContentId: fmt.Sprintf("N2SmInfoFail%d", item.PDUSessionID.Value),
+				},
+			},
+		})
+		*binaries[i] = item.HandoverPreparationUnsuccessfulTransfer
+	}
+	return &context.HandoverResult{Response: response}
+}
+
+func deliverHandoverResult(targetUe *context.RanUe, result *context.HandoverResult) {
+	select {
+	case targetUe.AmfUe.HandoverResult <- result:
+	default:
+		targetUe.Log.Warn("CreateUEContext result has already been delivered")
+	}
+}
+
 func HandleHandoverFailure(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	var aMFUENGAPID *ngapType.AMFUENGAPID
 	var cause *ngapType.Cause
@@ -2737,30 +2900,42 @@ func HandleHandoverFailure(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		return
 	}
 
+	ngapCause := &models.NgApCause{
+		Group: int32(causePresent),
+		Value: int32(causeValue),
+	}
+	amfUe := targetUe.AmfUe
+	if amfUe != nil {
+		amfUe.SmContextList.Range(func(key, value interface{}) bool {
+			pduSessionID := key.(int32)
+			smContext := value.(*context.SmContext)
+			causeAll := context.CauseAll{
+				NgapCause: ngapCause,
+			}
+			_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(amfUe, smContext, causeAll)
+			if err != nil {
+				ran.Log.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", pduSessionID)
+			}
+			return true
+		})
+	}
+
 	sourceUe := targetUe.SourceUe
 	if sourceUe == nil {
-		// TODO: handle N2 Handover between AMF
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
-	} else {
-		amfUe := targetUe.AmfUe
-		if amfUe != nil {
-			amfUe.SmContextList.Range(func(key, value interface{}) bool {
-				pduSessionID := key.(int32)
-				smContext := value.(*context.SmContext)
-				causeAll := context.CauseAll{
-					NgapCause: &models.NgApCause{
-						Group: int32(causePresent),
-						Value: int32(causeValue),
+		// handover between different AMF, answer the Namf_Communication_CreateUEContext of the S-AMF
+		if amfUe != nil && amfUe.HandoverResult != nil {
+			deliverHandoverResult(targetUe, &context.HandoverResult{
+				Error: &models.UeContextCreateError{
+					Error: &models.ProblemDetails{
+						Status: http.StatusForbidden,
+						Cause:  "HANDOVER_FAILURE",
 					},
-				}
-				_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(amfUe, smContext, causeAll)
-				if err != nil {
-					ran.Log.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", pduSessionID)
-				}
-				return true
+					NgapCause: ngapCause,
+				},
 			})
 		}
-		ngap_message.SendHandoverPreparationFailure(sourceUe, *cause, criticalityDiagnostics)
+	} else {
+		ngap_message.SendHandoverPreparationFailure(sourceUe, context.NgapCauseToCause(ngapCause), criticalityDiagnostics)
 	}
 
 	ngap_message.SendUEContextReleaseCommand(targetUe, context.UeContextReleaseHandover, causePresent, causeValue)
@@ -2894,6 +3069,8 @@ func HandleHandoverRequired(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		ran.Log.Errorf("targetID type[%d] is not supported", targetID.Present)
 		return
 	}
+	amfUe.HandoverLock.Lock()
+	defer amfUe.HandoverLock.Unlock()
 	amfUe.OnGoing[sourceUe.Ran.AnType].Procedure = context.OnGoingProcedureN2Handover
 	if !amfUe.SecurityContextIsValid() {
 		sourceUe.Log.Info("Handle Handover Preparation Failure [Authentication Failure]")
@@ -2911,11 +3088,15 @@ func HandleHandoverRequired(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	targetRan, ok := aMFSelf.AmfRanFindByRanID(targetRanNodeId)
 	if !ok {
 		// handover between different AMF
-		sourceUe.Log.Warnf("Handover required : cannot find target Ran Node Id[%+v] in this AMF", targetRanNodeId)
-		sourceUe.Log.Error("Handover between different AMF has not been implemented yet")
-		return
-		// TODO: Send to T-AMF
-		// Described in (23.502 4.9.1.3.2) step 3.Namf_Communication_CreateUEContext Request
+		sourceUe.Log.Infof("Handover required : cannot find target Ran Node Id[%+v] in this AMF", targetRanNodeId)
+		sourceUe.HandOverType.Value = handoverType.Value
+		tai := ngapConvert.TaiToModels(targetID.TargetRANNodeID.SelectedTAI)
+		targetId := models.NgRanTargetId{
+			RanNodeId: &targetRanNodeId,
+			Tai:       &tai,
+		}
+		handleInterAmfHandoverRequired(sourceUe, targetId, cause, pDUSessionResourceListHORqd,
+			sourceToTargetTransparentContainer)
 	} else {
 		// Handover in same AMF
 		sourceUe.HandOverType.Value = handoverType.Value
@@ -2960,6 +3141,157 @@ func HandleHandoverRequired(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	}
 }
 
+// Described in (23.502 4.9.1.3.2) step 2-3 and 12-13, the S-AMF selects the T-AMF serving the target TAI
+// and relocates the UE context with Namf_Communication_CreateUEContext
+func handleInterAmfHandoverRequired(sourceUe *context.RanUe, targetId models.NgRanTargetId, cause *ngapType.Cause,
+	pDUSessionResourceListHORqd *ngapType.PDUSessionResourceListHORqd,
+	sourceToTargetTransparentContainer *ngapType.SourceToTargetTransparentContainer) {
+	amfSelf := context.AMF_Self()
+	amfUe := sourceUe.AmfUe
+	preparationFailure := ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem,
+		},
+	}
+
+	param := Nnrf_NFDiscovery.SearchNFInstancesParamOpts{
+		Tai: optional.NewInterface(util.MarshToJsonString(*targetId.Tai)),
+	}
+	if err := consumer.SearchAmfCommunicationInstance(amfUe, amfSelf.NrfUri, models.NfType_AMF,
+		models.NfType_AMF, &param); err != nil {
+		sourceUe.Log.Errorf("Select target AMF for TAI[%+v] error: %+v", *targetId.Tai, err)
+		preparationFailure.RadioNetwork.Value = ngapType.CauseRadioNetworkPresentUnknownTargetID
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+	sourceUe.Log.Infof("Send Create UE Context to target AMF[%s]", amfUe.TargetAmfUri)
+
+	var pduSessionList []models.N2SmInformation
+	var n2SmInfos [][]byte
+	for _, item := range pDUSessionResourceListHORqd.List {
+		pduSessionId := int32(item.PDUSessionID.Value)
+		smContext, exist := amfUe.SmContextFindByPDUSessionID(pduSessionId)
+		if !exist {
+			sourceUe.Log.Warnf("SmContext[PDU Session ID:%d] not found", pduSessionId)
+			continue
+		}
+		snssai := smContext.Snssai()
+		pduSessionList = append(pduSessionList, models.N2SmInformation{
+			PduSessionId: pduSessionId,
+			N2InfoContent: &models.N2InfoContent{
+				NgapIeType: models.NgapIeType_HANDOVER_REQUIRED,
+				NgapData: &models.RefToBinaryData{
+					ContentId: fmt.Sprintf("N2SmInfo%d", pduSessionId),
+				},
+			},
+			SNssai: &snssai,
+		})
+		n2SmInfos = append(n2SmInfos, item.HandoverRequiredTransfer)
+	}
+	if len(pduSessionList) == 0 {
+		sourceUe.Log.Info("Handle Handover Preparation Failure [HoFailure In Target5GC NgranNode Or TargetSystem]")
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+
+	// Update NH
+	amfUe.UpdateNH()
+	var ngapCause *models.NgApCause
+	if cause != nil {
+		causePresent, causeValue := printAndGetCause(sourceUe.Ran, cause)
+		ngapCause = &models.NgApCause{
+			Group: int32(causePresent),
+			Value: int32(causeValue),
+		}
+	}
+	n2NotifyUri := amfSelf.GetIPv4Uri() + "/namf-callback/v1/n2-info-notify"
+	req, err := consumer.BuildCreateUeContextRequest(amfUe, targetId, sourceToTargetTransparentContainer.Value,
+		pduSessionList, n2SmInfos, n2NotifyUri, ngapCause)
+	if err != nil {
+		sourceUe.Log.Errorf("Build CreateUEContext request error: %+v", err)
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+
+	// the T-AMF answers CreateUEContext only after the target RAN acknowledges the handover request, which may
+	// arrive on this NGAP association, so only the request waits outside the NGAP goroutine
+	targetAmfUri, supi := amfUe.TargetAmfUri, amfUe.Supi
+	go func() {
+		response, ueContextCreateError, err := consumer.CreateUEContextRequest(targetAmfUri, supi, req)
+		handleCreateUeContextResult(sourceUe, amfUe, response, ueContextCreateError, err)
+	}()
+}
+
+// handleCreateUeContextResult answers the Handover Required of sourceUe with the result of the CreateUEContext
+// request, the result is dropped when the handover is cancelled or the UE context released meanwhile
+func handleCreateUeContextResult(sourceUe *context.RanUe, amfUe *context.AmfUe,
+	response *models.CreateUeContextResponse, ueContextCreateError *models.UeContextCreateError, err error) {
+	amfUe.HandoverLock.Lock()
+	defer amfUe.HandoverLock.Unlock()
+	if sourceUe.AmfUe != amfUe || sourceUe.Ran == nil ||
+		amfUe.OnGoing[sourceUe.Ran.AnType].Procedure != context.OnGoingProcedureN2Handover {
+		sourceUe.Log.Warn("Handover preparation is no longer ongoing, drop the CreateUEContext result")
+		return
+	}
+	preparationFailure := ngapType.Cause{
+		Present: ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{
+			Value: ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem,
+		},
+	}
+	if err != nil {
+		sourceUe.Log.Errorf("CreateUEContext error: %+v", err)
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+	if ueContextCreateError != nil {
+		if ueContextCreateError.Error != nil {
+			sourceUe.Log.Warnf("CreateUEContext failed[status: %d, cause: %s]",
+				ueContextCreateError.Error.Status, ueContextCreateError.Error.Cause)
+		}
+		if ueContextCreateError.NgapCause != nil {
+			preparationFailure = context.NgapCauseToCause(ueContextCreateError.NgapCause)
+		}
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+
+	createdData := response.JsonData
+	var pduSessionResourceHandoverList ngapType.PDUSessionResourceHandoverList
+	var pduSessionResourceToReleaseList ngapType.PDUSessionResourceToReleaseListHOCmd
+	binaries := context.CreatedPduSessionListBinaries(response)
+	for i, smInfo := range createdData.PduSessionList {
+		if i >= len(binaries) {
+			break
+		}
+		handoverItem := ngapType.PDUSessionResourceHandoverItem{}
+		handoverItem.PDUSessionID.Value = int64(smInfo.PduSessionId)
+		handoverItem.HandoverCommandTransfer = *binaries[i]
+		pduSessionResourceHandoverList.List = append(pduSessionResourceHandoverList.List, handoverItem)
+	}
+	binaries = context.FailedSessionListBinaries(response)
+	for i, smInfo := range createdData.FailedSessionList {
+		if i >= len(binaries) {
+			break
+		}
+		releaseItem := ngapType.PDUSessionResourceToReleaseItemHOCmd{}
+		releaseItem.PDUSessionID.Value = int64(smInfo.PduSessionId)
+		releaseItem.HandoverPreparationUnsuccessfulTransfer = *binaries[i]
+		pduSessionResourceToReleaseList.List = append(pduSessionResourceToReleaseList.List, releaseItem)
+	}
+	if len(pduSessionResourceHandoverList.List) == 0 {
+		sourceUe.Log.Info("Handle Handover Preparation Failure [HoFailure In Target5GC NgranNode Or TargetSystem]")
+		ngap_message.SendHandoverPreparationFailure(sourceUe, preparationFailure, nil)
+		return
+	}
+	targetToSourceTransparentContainer := ngapType.TargetToSourceTransparentContainer{
+		Value: response.BinaryDataN2Information,
+	}
+	ngap_message.SendHandoverCommand(sourceUe, pduSessionResourceHandoverList, pduSessionResourceToReleaseList,
+		targetToSourceTransparentContainer, nil)
+}
+
 func HandleHandoverCancel(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	var aMFUENGAPID *ngapType.AMFUENGAPID
 	var rANUENGAPID *ngapType.RANUENGAPID
@@ -3037,33 +3369,53 @@ func HandleHandoverCancel(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		causePresent, causeValue = printAndGetCause(ran, cause)
 	}
 	targetUe := sourceUe.TargetUe
+	amfUe := sourceUe.AmfUe
+	if amfUe != nil {
+		amfUe.HandoverLock.Lock()
+		defer amfUe.HandoverLock.Unlock()
+	}
+	if targetUe == nil && (amfUe == nil || amfUe.TargetAmfUri == "") {
+		ran.Log.Error("No handover in progress for this UE")
+		return
+	}
+	ngapCause := models.NgApCause{
+		Group: int32(causePresent),
+		Value: int32(causeValue),
+	}
 	if targetUe == nil {
 		// Described in (23.502 4.11.1.2.3) step 2
-		// Todo : send to T-AMF invoke Namf_UeContextReleaseRequest(targetUe)
-		ran.Log.Error("N2 Handover between AMF has not been implemented yet")
+		ran.Log.Infof("Send Release UE Context to target AMF[%s]", amfUe.TargetAmfUri)
+		problemDetails, err := consumer.ReleaseUEContextRequest(amfUe, ngapCause)
+		if problemDetails != nil {
+			ran.Log.Warnf("Release UE Context in target AMF failed: %+v", problemDetails)
+		} else if err != nil {
+			ran.Log.Errorf("Release UE Context in target AMF error: %+v", err)
+		}
 	} else {
 		ran.Log.Tracef("Target : RAN_UE_NGAP_ID[%d] AMF_UE_NGAP_ID[%d]", targetUe.RanUeNgapId, targetUe.AmfUeNgapId)
-		amfUe := sourceUe.AmfUe
-		if amfUe != nil {
-			amfUe.SmContextList.Range(func(key, value interface{}) bool {
-				pduSessionID := key.(int32)
-				smContext := value.(*context.SmContext)
-				causeAll := context.CauseAll{
-					NgapCause: &models.NgApCause{
-						Group: int32(causePresent),
-						Value: int32(causeValue),
-					},
-				}
-				_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(amfUe, smContext, causeAll)
-				if err != nil {
-					sourceUe.Log.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", pduSessionID)
-				}
-				return true
-			})
-		}
+	}
+	if amfUe != nil {
+		amfUe.SmContextList.Range(func(key, value interface{}) bool {
+			pduSessionID := key.(int32)
+			smContext := value.(*context.SmContext)
+			causeAll := context.CauseAll{
+				NgapCause: &ngapCause,
+			}
+			_, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(amfUe, smContext, causeAll)
+			if err != nil {
+				sourceUe.Log.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]", pduSessionID)
+			}
+			return true
+		})
+	}
+	if targetUe != nil {
 		ngap_message.SendUEContextReleaseCommand(targetUe, context.UeContextReleaseHandover, causePresent, causeValue)
-		ngap_message.SendHandoverCancelAcknowledge(sourceUe, nil)
 	}
+	if amfUe != nil {
+		// a CreateUEContext result still awaited from the target AMF is dropped
+		amfUe.OnGoing[ran.AnType].Procedure = context.OnGoingProcedureNothing
+	}
+	ngap_message.SendHandoverCancelAcknowledge(sourceUe, nil)
 }
 
 func HandleUplinkRanStatusTransfer(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -3438,7 +3790,20 @@ func HandleUplinkUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapTy
 
 	ranUe.RoutingID = hex.EncodeToString(routingID.Value)
 
-	// TODO: Forward NRPPaPDU to LMF
+	amfUe := ranUe.AmfUe
+	if amfUe == nil {
+		ranUe.Log.Error("AmfUe is nil")
+		return
+	}
+
+	// TS 23.502 4.13.5.5 step 4: forward the NRPPa PDU to the LMF identified by the Routing ID
+	lmfID, err := context.RoutingIDToLmfId(ranUe.RoutingID)
+	if err != nil {
+		ranUe.Log.Errorf("Invalid Routing ID: %+v", err)
+		return
+	}
+	ranUe.Log.Debugf("Forward NRPPa PDU to LMF[%s]", lmfID)
+	callback.SendN2InfoNotify(amfUe, models.N2InformationClass_NRP_PA, lmfID, nil, nRPPaPDU.Value)
 }
 
 func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -3483,14 +3848,19 @@ func HandleUplinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, message *nga
 		ran.Log.Error("RoutingID is nil")
 		return
 	}
-	// Forward routingID to LMF
-	// Described in (23.502 4.13.5.6)
-
 	if nRPPaPDU == nil {
 		ran.Log.Error("NRPPaPDU is nil")
 		return
 	}
-	// TODO: Forward NRPPaPDU to LMF
+
+	// TS 23.502 4.13.5.6 step 4: forward the NRPPa PDU to the LMF identified by the Routing ID
+	lmfID, err := context.RoutingIDToLmfId(hex.EncodeToString(routingID.Value))
+	if err != nil {
+		ran.Log.Errorf("Invalid Routing ID: %+v", err)
+		return
+	}
+	ran.Log.Debugf("Forward NRPPa PDU to LMF[%s]", lmfID)
+	callback.SendNonUeN2InfoNotify(ran, models.N2InformationClass_NRP_PA, lmfID, nRPPaPDU.Value)
 }
 
 func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
@@ -3563,17 +3933,33 @@ func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 	ranUe.UpdateLocation(userLocationInformation)
 
+	if locationReportingRequestType == nil {
+		ranUe.Log.Error("LocationReportingRequestType is nil")
+		return
+	}
 	ranUe.Log.Tracef("Report Area[%d]", locationReportingRequestType.ReportArea.Value)
 
+	amfUe := ranUe.AmfUe
 	switch locationReportingRequestType.EventType.Value {
 	case ngapType.EventTypePresentDirect:
 		ranUe.Log.Trace("To report directly")
+		if amfUe != nil {
+			callback.SendAmfLocationReportNotify(amfUe)
+		}
 
 	case ngapType.EventTypePresentChangeOfServeCell:
 		ranUe.Log.Trace("To report upon change of serving cell")
+		if amfUe != nil {
+			callback.SendAmfLocationReportNotify(amfUe)
+			// stop the reporting if the reports of all the subscriptions are used up
+			ngap_message.SendLocationReportingControlForSubscriptions(amfUe)
+		}
 
 	case ngapType.EventTypePresentUePresenceInAreaOfInterest:
 		ranUe.Log.Trace("To report UE presence in the area of interest")
+		if uEPresenceInAreaOfInterestList == nil {
+			break
+		}
 		for _, uEPresenceInAreaOfInterestItem := range uEPresenceInAreaOfInterestList.List {
 			uEPresence := uEPresenceInAreaOfInterestItem.UEPresence.Value
 			referenceID := uEPresenceInAreaOfInterestItem.LocationReportingReferenceID.Value
@@ -3588,17 +3974,25 @@ func HandleLocationReport(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	case ngapType.EventTypePresentStopChangeOfServeCell:
 		ranUe.Log.Trace("To stop reporting at change of serving cell")
 		ngap_message.SendLocationReportingControl(ranUe, nil, 0, locationReportingRequestType.EventType)
-		// TODO: Clear location report
 
 	case ngapType.EventTypePresentStopUePresenceInAreaOfInterest:
 		ranUe.Log.Trace("To stop reporting UE presence in the area of interest")
-		ranUe.Log.Tracef("ReferenceID To Be Cancelled[%d]",
-			locationReportingRequestType.LocationReportingReferenceIDToBeCancelled.Value)
-		// TODO: Clear location report
+		referenceIDToBeCancelled := locationReportingRequestType.LocationReportingReferenceIDToBeCancelled
+		if referenceIDToBeCancelled == nil {
+			ranUe.Log.Error("LocationReportingReferenceIDToBeCancelled is nil")
+			break
+		}
+		ranUe.Log.Tracef("ReferenceID To Be Cancelled[%d]", referenceIDToBeCancelled.Value)
+		if amfUe != nil {
+			amfUe.UpdateLocationReporting(locationReportingRequestType.EventType.Value, nil,
+				referenceIDToBeCancelled.Value)
+		}
 
 	case ngapType.EventTypePresentCancelLocationReportingForTheUe:
 		ranUe.Log.Trace("To cancel location reporting for the UE")
-		// TODO: Clear location report
+		if amfUe != nil {
+			amfUe.ClearLocationReporting()
+		}
 	}
 }
 
@@ -3697,6 +4091,7 @@ func HandleUERadioCapabilityInfoIndication(ran *context.AmfRan, message *ngapTyp
 
 func HandleAMFconfigurationUpdateFailure(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 	var cause *ngapType.Cause
+	var timeToWait *ngapType.TimeToWait
 	var criticalityDiagnostics *ngapType.CriticalityDiagnostics
 	if ran == nil {
 		logger.NgapLog.Error("ran is nil")
@@ -3729,13 +4124,26 @@ func HandleAMFconfigurationUpdateFailure(ran *context.AmfRan, message *ngapType.
 				ran.Log.Error("Cause is nil")
 				return
 			}
+		case ngapType.ProtocolIEIDTimeToWait:
+			timeToWait = ie.Value.TimeToWait
+			ran.Log.Trace("Decode IE TimeToWait")
 		case ngapType.ProtocolIEIDCriticalityDiagnostics:
 			criticalityDiagnostics = ie.Value.CriticalityDiagnostics
 			ran.Log.Trace("Decode IE CriticalityDiagnostics")
 		}
 	}
 
-	//	TODO: Time To Wait
+	if cause != nil {
+		printAndGetCause(ran, cause)
+	}
+
+	// TS 38.413 8.7.3.3: the AMF shall wait at least for the indicated time before reinitiating
+	// the AMF Configuration Update towards the same NG-RAN node
+	if timeToWait != nil {
+		wait := context.TimeToWaitToDuration(*timeToWait)
+		ran.Log.Infof("Time To Wait[%v] before next AMF Configuration Update", wait)
+		ran.ConfigurationUpdateWaitUntil = time.Now().Add(wait)
+	}
 
 	if criticalityDiagnostics != nil {
 		printCriticalityDiagnostics(ran, criticalityDiagnostics)
@@ -3956,15 +4364,18 @@ func HandleCellTrafficTrace(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 
 	ranUe.Log.Tracef("TRSR[%s]", ranUe.Trsr)
 
+	var cell string
 	switch nGRANCGI.Present {
 	case ngapType.NGRANCGIPresentNRCGI:
 		plmnID := ngapConvert.PlmnIdToModels(nGRANCGI.NRCGI.PLMNIdentity)
 		cellID := ngapConvert.BitStringToHex(&nGRANCGI.NRCGI.NRCellIdentity.Value)
 		ranUe.Log.Debugf("NRCGI[plmn: %s, cellID: %s]", plmnID, cellID)
+		cell = fmt.Sprintf("%s%s-%s", plmnID.Mcc, plmnID.Mnc, cellID)
 	case ngapType.NGRANCGIPresentEUTRACGI:
 		plmnID := ngapConvert.PlmnIdToModels(nGRANCGI.EUTRACGI.PLMNIdentity)
 		cellID := ngapConvert.BitStringToHex(&nGRANCGI.EUTRACGI.EUTRACellIdentity.Value)
 		ranUe.Log.Debugf("EUTRACGI[plmn: %s, cellID: %s]", plmnID, cellID)
+		cell = fmt.Sprintf("%s%s-%s", plmnID.Mcc, plmnID.Mnc, cellID)
 	}
 
 	tceIpv4, tceIpv6 := ngapConvert.IPAddressToString(*traceCollectionEntityIPAddress)
@@ -3975,11 +4386,115 @@ func HandleCellTrafficTrace(ran *context.AmfRan, message *ngapType.NGAPPDU) {
 		ranUe.Log.Debugf("TCE IP Address[v6: %s]", tceIpv6)
 	}
 
-	// TODO: TS 32.422 4.2.2.10
+	// TS 32.422 4.2.2.10
 	// When AMF receives this new NG signalling message containing the Trace Recording Session Reference (TRSR)
 	// and Trace Reference (TR), the AMF shall look up the SUPI/IMEI(SV) of the given call from its database and
 	// shall send the SUPI/IMEI(SV) numbers together with the Trace Recording Session Reference and Trace Reference
-	// to the Trace Collection Entity.
+	// to the Trace Collection Entity. The records are collected in the local trace store.
+	traceRecord := context.TraceRecord{
+		Event:                  context.TraceEventCellTrafficTrace,
+		TraceRef:               ngranTraceIDToTraceRef(nGRANTraceID.Value),
+		Trsr:                   ranUe.Trsr,
+		CollectionEntityIpAddr: tceIpv4 + tceIpv6,
+		Cell:                   cell,
+	}
+	if amfUe := ranUe.AmfUe; amfUe != nil {
+		traceRecord.Supi = amfUe.Supi
+		traceRecord.Pei = amfUe.Pei
+	}
+	context.AMF_Self().TraceStore.Add(traceRecord)
+}
+
+func HandleTraceFailureIndication(ran *context.AmfRan, message *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var nGRANTraceID *ngapType.NGRANTraceID
+	var cause *ngapType.Cause
+
+	if ran == nil {
+		logger.NgapLog.Error("ran is nil")
+		return
+	}
+	if message == nil {
+		ran.Log.Error("NGAP Message is nil")
+		return
+	}
+	initiatingMessage := message.InitiatingMessage
+	if initiatingMessage == nil {
+		ran.Log.Error("InitiatingMessage is nil")
+		return
+	}
+	traceFailureIndication := initiatingMessage.Value.TraceFailureIndication
+	if traceFailureIndication == nil {
+		ran.Log.Error("TraceFailureIndication is nil")
+		return
+	}
+
+	ran.Log.Info("Handle Trace Failure Indication")
+
+	for _, ie := range traceFailureIndication.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID: // reject
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+			ran.Log.Trace("Decode IE AmfUeNgapID")
+			if aMFUENGAPID == nil {
+				ran.Log.Error("AmfUeNgapID is nil")
+				return
+			}
+		case ngapType.ProtocolIEIDRANUENGAPID: // reject
+			rANUENGAPID = ie.Value.RANUENGAPID
+			ran.Log.Trace("Decode IE RanUeNgapID")
+			if rANUENGAPID == nil {
+				ran.Log.Error("RanUeNgapID is nil")
+				return
+			}
+		case ngapType.ProtocolIEIDNGRANTraceID: // ignore
+			nGRANTraceID = ie.Value.NGRANTraceID
+			ran.Log.Trace("Decode IE NGRANTraceID")
+		case ngapType.ProtocolIEIDCause: // ignore
+			cause = ie.Value.Cause
+			ran.Log.Trace("Decode IE Cause")
+		}
+	}
+	if aMFUENGAPID == nil {
+		ran.Log.Error("AmfUeNgapID is nil")
+		return
+	}
+
+	ranUe := context.AMF_Self().RanUeFindByAmfUeNgapID(aMFUENGAPID.Value)
+	if ranUe == nil {
+		ran.Log.Errorf("No UE Context[AmfUeNgapID: %d]", aMFUENGAPID.Value)
+		return
+	}
+
+	// TS 38.413 8.12.3: the NG-RAN is not able to start the trace session, e.g. due to the handover
+	traceRecord := context.TraceRecord{
+		Event: context.TraceEventTraceFailure,
+		Trsr:  ranUe.Trsr,
+	}
+	if nGRANTraceID != nil {
+		traceRecord.TraceRef = ngranTraceIDToTraceRef(nGRANTraceID.Value)
+		ranUe.Log.Warnf("Trace[%s] failed", hex.EncodeToString(nGRANTraceID.Value))
+	}
+	if cause != nil {
+		causePresent, causeValue := printAndGetCause(ran, cause)
+		traceRecord.Cause = fmt.Sprintf("%d:%d", causePresent, causeValue)
+	}
+	if amfUe := ranUe.AmfUe; amfUe != nil {
+		traceRecord.Supi = amfUe.Supi
+		traceRecord.Pei = amfUe.Pei
+	}
+	context.AMF_Self().TraceStore.Add(traceRecord)
+}
+
+// ngranTraceIDToTraceRef returns the Trace Reference (MCC+MNC-Trace ID) of the left most 6 octets of
+// the NG-RAN Trace ID, the last 2 octets are the Trace Recording Session Reference (TS 38.413 9.3.1.14)
+func ngranTraceIDToTraceRef(nGRANTraceID aper.OctetString) string {
+	if len(nGRANTraceID) < 6 {
+		return ""
+	}
+	plmnID := ngapConvert.PlmnIdToModels(ngapType.PLMNIdentity{Value: nGRANTraceID[:3]})
+	return fmt.Sprintf("%s%s-%s", plmnID.Mcc, plmnID.Mnc, hex.EncodeToString(nGRANTraceID[3:6]))
 }
 
 func printAndGetCause(ran *context.AmfRan, cause *ngapType.Cause) (present int, value aper.Enumerated) {
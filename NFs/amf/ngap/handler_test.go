@@ -0,0 +1,93 @@
+package ngap
+
+import (
+	"testing"
+
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/ngap/ngapType"
+)
+
+func buildTraceFailureIndication(amfUeNgapID, ranUeNgapID int64, nGRANTraceID []byte,
+	cause *ngapType.Cause) *ngapType.NGAPPDU {
+	pdu := &ngapType.NGAPPDU{
+		Present:           ngapType.NGAPPDUPresentInitiatingMessage,
+		InitiatingMessage: new(ngapType.InitiatingMessage),
+	}
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeTraceFailureIndication
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentTraceFailureIndication
+	initiatingMessage.Value.TraceFailureIndication = new(ngapType.TraceFailureIndication)
+	ieList := &initiatingMessage.Value.TraceFailureIndication.ProtocolIEs
+
+	ie := ngapType.TraceFailureIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Value.Present = ngapType.TraceFailureIndicationIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: amfUeNgapID}
+	ieList.List = append(ieList.List, ie)
+
+	ie = ngapType.TraceFailureIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Value.Present = ngapType.TraceFailureIndicationIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: ranUeNgapID}
+	ieList.List = append(ieList.List, ie)
+
+	ie = ngapType.TraceFailureIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNGRANTraceID
+	ie.Value.Present = ngapType.TraceFailureIndicationIEsPresentNGRANTraceID
+	ie.Value.NGRANTraceID = &ngapType.NGRANTraceID{Value: nGRANTraceID}
+	ieList.List = append(ieList.List, ie)
+
+	ie = ngapType.TraceFailureIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Value.Present = ngapType.TraceFailureIndicationIEsPresentCause
+	ie.Value.Cause = cause
+	ieList.List = append(ieList.List, ie)
+	return pdu
+}
+
+func TestHandleTraceFailureIndication(t *testing.T) {
+	amfSelf := context.AMF_Self()
+	amfSelf.TraceStore.Reset()
+	defer amfSelf.TraceStore.Reset()
+
+	ran := &context.AmfRan{Log: logger.NgapLog}
+	ranUe := &context.RanUe{
+		RanUeNgapId: 1,
+		AmfUeNgapId: 100,
+		Ran:         ran,
+		Trsr:        "0001",
+		AmfUe:       &context.AmfUe{Supi: "imsi-208930000000003", Pei: "imeisv-4370816125816151"},
+		Log:         logger.NgapLog,
+	}
+	amfSelf.RanUePool.Store(ranUe.AmfUeNgapId, ranUe)
+	defer amfSelf.RanUePool.Delete(ranUe.AmfUeNgapId)
+
+	// MCC 208 MNC 93, trace ID 00a1b2, trace recording session reference 0001
+	nGRANTraceID := []byte{0x02, 0xf8, 0x39, 0x00, 0xa1, 0xb2, 0x00, 0x01}
+	cause := &ngapType.Cause{
+		Present:      ngapType.CausePresentRadioNetwork,
+		RadioNetwork: &ngapType.CauseRadioNetwork{Value: ngapType.CauseRadioNetworkPresentInteractionWithOtherProcedure},
+	}
+	HandleTraceFailureIndication(ran, buildTraceFailureIndication(ranUe.AmfUeNgapId, ranUe.RanUeNgapId,
+		nGRANTraceID, cause))
+
+	records := amfSelf.TraceStore.Records("imsi-208930000000003")
+	if len(records) != 1 {
+		t.Fatalf("%d trace records, want 1", len(records))
+	}
+	record := records[0]
+	if record.Event != context.TraceEventTraceFailure || record.TraceRef != "20893-00a1b2" ||
+		record.Trsr != "0001" || record.Pei != "imeisv-4370816125816151" {
+		t.Errorf("trace record %+v", record)
+	}
+	if record.Cause != "1:25" {
+		t.Errorf("cause %s, want 1:25", record.Cause)
+	}
+
+	// the trace failure of an unknown UE is not recorded
+	HandleTraceFailureIndication(ran, buildTraceFailureIndication(101, 2, nGRANTraceID, cause))
+	if records := amfSelf.TraceStore.Records(""); len(records) != 1 {
+		t.Errorf("%d trace records, want 1", len(records))
+	}
+}
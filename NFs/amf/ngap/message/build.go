@@ -3,6 +3,7 @@ package message
 import (
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/free5gc/amf/context"
@@ -159,7 +160,8 @@ func BuildNGSetupResponse() ([]byte, error) {
 	return ngap.Encoder(pdu)
 }
 
-func BuildNGSetupFailure(cause ngapType.Cause) ([]byte, error) {
+// timeToWait: optional, set to nil if the NG-RAN may retry the NG Setup at once
+func BuildNGSetupFailure(cause ngapType.Cause, timeToWait *ngapType.TimeToWait) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 	pdu.Present = ngapType.NGAPPDUPresentUnsuccessfulOutcome
 	pdu.UnsuccessfulOutcome = new(ngapType.UnsuccessfulOutcome)
@@ -182,6 +184,17 @@ func BuildNGSetupFailure(cause ngapType.Cause) ([]byte, error) {
 
 	nGSetupFailureIEs.List = append(nGSetupFailureIEs.List, ie)
 
+	// Time To Wait (optional)
+	if timeToWait != nil {
+		ie = ngapType.NGSetupFailureIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDTimeToWait
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.NGSetupFailureIEsPresentTimeToWait
+		ie.Value.TimeToWait = timeToWait
+
+		nGSetupFailureIEs.List = append(nGSetupFailureIEs.List, ie)
+	}
+
 	return ngap.Encoder(pdu)
 }
 
@@ -1084,9 +1097,8 @@ func BuildInitialContextSetupRequest(
 		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
 		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentTraceActivation
 		ie.Value.TraceActivation = new(ngapType.TraceActivation)
-		// TS 32.422 4.2.2.9
-		// TODO: AMF allocate Trace Recording Session Reference
-		traceActivation := ngapConvert.TraceDataToNgap(*amfUe.TraceData, ranUe.Trsr)
+		// TS 32.422 4.2.2.9: AMF allocates the Trace Recording Session Reference
+		traceActivation := ngapConvert.TraceDataToNgap(*amfUe.TraceData, ranUe.AllocateTrsr())
 		ie.Value.TraceActivation = &traceActivation
 		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
 	}
@@ -2088,10 +2100,9 @@ func BuildDownlinkRanStatusTransfer(ue *context.RanUe,
 // is associated with non-3GPP access, the AMF sends a Paging message with associated access "non-3GPP" to
 // NG-RAN node(s) via 3GPP access.
 // more paging policy with 3gpp/non-3gpp access is described in TS 23.501 5.6.8
-func BuildPaging(
-	ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool) ([]byte, error) {
-	// TODO: Paging DRX (optional)
-
+// pagingAttemptInformation: provided by AMF (TS 23.502 4.2.3.3, TS 38.300 9.2.5)
+func BuildPaging(ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool,
+	pagingAttemptInformation *ngapType.PagingAttemptInformation) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
 	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
@@ -2138,7 +2149,15 @@ func BuildPaging(
 
 	pagingIEs.List = append(pagingIEs.List, ie)
 
-	// Paging DRX (optional)
+	// Paging DRX (optional): the UE specific DRX negotiated in the registration
+	if pagingDRX := context.DRXNasToNgap(ue.UESpecificDRX); pagingDRX != nil {
+		ie = ngapType.PagingIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDPagingDRX
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.PagingIEsPresentPagingDRX
+		ie.Value.PagingDRX = pagingDRX
+		pagingIEs.List = append(pagingIEs.List, ie)
+	}
 
 	// TAI List for Paging
 	ie = ngapType.PagingIEs{}
@@ -2204,7 +2223,11 @@ func BuildPaging(
 	}
 
 	// Assistance Data for Paing (optional)
+	var recommendedCells []context.RecommendedCell
 	if ue.InfoOnRecommendedCellsAndRanNodesForPaging != nil {
+		recommendedCells = ue.InfoOnRecommendedCellsAndRanNodesForPaging.RecommendedCells
+	}
+	if len(recommendedCells) > 0 || pagingAttemptInformation != nil {
 		ie = ngapType.PagingIEs{}
 		ie.Id.Value = ngapType.ProtocolIEIDAssistanceDataForPaging
 		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
@@ -2212,36 +2235,39 @@ func BuildPaging(
 		ie.Value.AssistanceDataForPaging = new(ngapType.AssistanceDataForPaging)
 
 		assistanceDataForPaging := ie.Value.AssistanceDataForPaging
-		assistanceDataForPaging.AssistanceDataForRecommendedCells =
-			new(ngapType.AssistanceDataForRecommendedCells)
-		recommendedCellList := &assistanceDataForPaging.
-			AssistanceDataForRecommendedCells.RecommendedCellsForPaging.RecommendedCellList
-
-		for _, recommendedCell := range ue.InfoOnRecommendedCellsAndRanNodesForPaging.RecommendedCells {
-			recommendedCellItem := ngapType.RecommendedCellItem{}
-			switch recommendedCell.NgRanCGI.Present {
-			case context.NgRanCgiPresentNRCGI:
-				recommendedCellItem.NGRANCGI.Present = ngapType.NGRANCGIPresentNRCGI
-				recommendedCellItem.NGRANCGI.NRCGI = new(ngapType.NRCGI)
-				nrCGI := recommendedCellItem.NGRANCGI.NRCGI
-				nrCGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*recommendedCell.NgRanCGI.NRCGI.PlmnId)
-				nrCGI.NRCellIdentity.Value = ngapConvert.HexToBitString(recommendedCell.NgRanCGI.NRCGI.NrCellId, 36)
-			case context.NgRanCgiPresentEUTRACGI:
-				recommendedCellItem.NGRANCGI.Present = ngapType.NGRANCGIPresentEUTRACGI
-				recommendedCellItem.NGRANCGI.EUTRACGI = new(ngapType.EUTRACGI)
-				eutraCGI := recommendedCellItem.NGRANCGI.EUTRACGI
-				eutraCGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*recommendedCell.NgRanCGI.EUTRACGI.PlmnId)
-				eutraCGI.EUTRACellIdentity.Value =
-					ngapConvert.HexToBitString(recommendedCell.NgRanCGI.EUTRACGI.EutraCellId, 28)
-			}
-
-			if recommendedCell.TimeStayedInCell != nil {
-				recommendedCellItem.TimeStayedInCell = recommendedCell.TimeStayedInCell
+		if len(recommendedCells) > 0 {
+			assistanceDataForPaging.AssistanceDataForRecommendedCells =
+				new(ngapType.AssistanceDataForRecommendedCells)
+			recommendedCellList := &assistanceDataForPaging.
+				AssistanceDataForRecommendedCells.RecommendedCellsForPaging.RecommendedCellList
+
+			for _, recommendedCell := range recommendedCells {
+				recommendedCellItem := ngapType.RecommendedCellItem{}
+				switch recommendedCell.NgRanCGI.Present {
+				case context.NgRanCgiPresentNRCGI:
+					recommendedCellItem.NGRANCGI.Present = ngapType.NGRANCGIPresentNRCGI
+					recommendedCellItem.NGRANCGI.NRCGI = new(ngapType.NRCGI)
+					nrCGI := recommendedCellItem.NGRANCGI.NRCGI
+					nrCGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*recommendedCell.NgRanCGI.NRCGI.PlmnId)
+					nrCGI.NRCellIdentity.Value = ngapConvert.HexToBitString(recommendedCell.NgRanCGI.NRCGI.NrCellId, 36)
+				case context.NgRanCgiPresentEUTRACGI:
+					recommendedCellItem.NGRANCGI.Present = ngapType.NGRANCGIPresentEUTRACGI
+					recommendedCellItem.NGRANCGI.EUTRACGI = new(ngapType.EUTRACGI)
+					eutraCGI := recommendedCellItem.NGRANCGI.EUTRACGI
+					eutraCGI.PLMNIdentity = ngapConvert.PlmnIdToNgap(*recommendedCell.NgRanCGI.EUTRACGI.PlmnId)
+					eutraCGI.EUTRACellIdentity.Value =
+						ngapConvert.HexToBitString(recommendedCell.NgRanCGI.EUTRACGI.EutraCellId, 28)
+				}
+
+				if recommendedCell.TimeStayedInCell != nil {
+					recommendedCellItem.TimeStayedInCell = recommendedCell.TimeStayedInCell
+				}
+				recommendedCellList.List = append(recommendedCellList.List, recommendedCellItem)
 			}
-			recommendedCellList.List = append(recommendedCellList.List, recommendedCellItem)
 		}
 
-		// TODO: Paging Attempt Information (optional): provided by AMF (TS 23.502 4.2.3.3, TS 38.300 9.2.5)
+		// Paging Attempt Information (optional): provided by AMF (TS 23.502 4.2.3.3, TS 38.300 9.2.5)
+		assistanceDataForPaging.PagingAttemptInformation = pagingAttemptInformation
 		pagingIEs.List = append(pagingIEs.List, ie)
 	}
 
@@ -2263,9 +2289,10 @@ func BuildPaging(
 // anType: indicate amfUe send this msg for which accessType
 // amfUeNgapID: initial AMF get it from target AMF
 // ngapMessage: initial UE Message to reroute
+// amfSetID: AMF Set ID (hex) of the target AMF set, and AMF get it from NSSF (4.2.2.2.3 step 4b)
 // allowedNSSAI: provided by AMF, and AMF get it from NSSF (4.2.2.2.3 step 4b)
 func BuildRerouteNasRequest(ue *context.AmfUe, anType models.AccessType, amfUeNgapID *int64,
-	ngapMessage []byte, allowedNSSAI *ngapType.AllowedNSSAI) ([]byte, error) {
+	ngapMessage []byte, amfSetID string, allowedNSSAI *ngapType.AllowedNSSAI) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
 
 	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
@@ -2324,19 +2351,16 @@ func BuildRerouteNasRequest(ue *context.AmfUe, anType models.AccessType, amfUeNg
 	ie.Criticality.Value = ngapType.CriticalityPresentReject
 	ie.Value.Present = ngapType.RerouteNASRequestIEsPresentAMFSetID
 
-	// <MCC><MNC><AMF Region ID><AMF Set ID><AMF Pointer><5G-TMSI>
-	// <MCC><MNC> is 3 bytes, <AMF Region ID><AMF Set ID><AMF Pointer> is 3 bytes
-	// 1 byte is 2 characters
-	var amfID string
-	if len(ue.Guti) == 19 { // MNC is 2 char
-		amfID = ue.Guti[5:11]
-	} else {
-		amfID = ue.Guti[6:12]
+	// AMF Set ID is 10 bits
+	setID, err := strconv.ParseUint(amfSetID, 16, 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AMF Set ID[%s]: %+v", amfSetID, err)
 	}
-	_, amfSetID, _ := ngapConvert.AmfIdToNgap(amfID)
-
 	ie.Value.AMFSetID = new(ngapType.AMFSetID)
-	ie.Value.AMFSetID.Value = amfSetID
+	ie.Value.AMFSetID.Value = aper.BitString{
+		Bytes:     []byte{byte(setID >> 2), byte(setID << 6)},
+		BitLength: 10,
+	}
 
 	rerouteNasRequestIEs.List = append(rerouteNasRequestIEs.List, ie)
 
@@ -2586,7 +2610,7 @@ func BuildDownlinkRanConfigurationTransfer(
 }
 
 func BuildDownlinkNonUEAssociatedNRPPATransport(
-	ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
+	routingIDHex string, nRPPaPDU ngapType.NRPPaPDU) ([]byte, error) {
 	// NRPPa PDU is by pass
 	// NRPPa PDU is from LMF define in 4.13.5.6
 
@@ -2606,7 +2630,6 @@ func BuildDownlinkNonUEAssociatedNRPPATransport(
 	downlinkNonUEAssociatedNRPPaTransportIEs := &downlinkNonUEAssociatedNRPPaTransport.ProtocolIEs
 
 	// Routing ID
-	// Routing id in the ran context
 	ie := ngapType.DownlinkNonUEAssociatedNRPPaTransportIEs{}
 	ie.Id.Value = ngapType.ProtocolIEIDRoutingID
 	ie.Criticality.Value = ngapType.CriticalityPresentReject
@@ -2615,9 +2638,9 @@ func BuildDownlinkNonUEAssociatedNRPPATransport(
 
 	var err error
 	routingID := ie.Value.RoutingID
-	routingID.Value, err = hex.DecodeString(ue.RoutingID)
+	routingID.Value, err = hex.DecodeString(routingIDHex)
 	if err != nil {
-		logger.NgapLog.Errorf("[Build Error] DecodeString ue.RoutingID error: %+v", err)
+		logger.NgapLog.Errorf("[Build Error] DecodeString routingID error: %+v", err)
 	}
 
 	downlinkNonUEAssociatedNRPPaTransportIEs.List = append(downlinkNonUEAssociatedNRPPaTransportIEs.List, ie)
@@ -2635,8 +2658,66 @@ func BuildDownlinkNonUEAssociatedNRPPATransport(
 	return ngap.Encoder(pdu)
 }
 
-func BuildTraceStart() ([]byte, error) {
+// TS 32.422 4.2.2.9: the Trace Recording Session Reference is allocated by the AMF for each trace session
+func BuildTraceStart(amfUe *context.AmfUe, anType models.AccessType) ([]byte, error) {
 	var pdu ngapType.NGAPPDU
+
+	ranUe, ok := amfUe.RanUe[anType]
+	if !ok {
+		return nil, fmt.Errorf("ranUe for %s is nil", anType)
+	}
+	if amfUe.TraceData == nil {
+		return nil, fmt.Errorf("TraceData is nil")
+	}
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeTraceStart
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentTraceStart
+	initiatingMessage.Value.TraceStart = new(ngapType.TraceStart)
+
+	traceStart := initiatingMessage.Value.TraceStart
+	traceStartIEs := &traceStart.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.TraceStartIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ranUe.AmfUeNgapId
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.TraceStartIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ranUe.RanUeNgapId
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
+	// Trace Activation
+	ie = ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTraceActivation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.TraceStartIEsPresentTraceActivation
+
+	traceActivation := ngapConvert.TraceDataToNgap(*amfUe.TraceData, ranUe.AllocateTrsr())
+	ie.Value.TraceActivation = &traceActivation
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
 	return ngap.Encoder(pdu)
 }
 
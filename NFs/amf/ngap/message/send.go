@@ -1,6 +1,9 @@
 package message
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/free5gc/amf/context"
 	"github.com/free5gc/amf/logger"
 	"github.com/free5gc/amf/producer/callback"
@@ -86,7 +89,8 @@ func SendNGSetupResponse(ran *context.AmfRan) {
 	SendToRan(ran, pkt)
 }
 
-func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause) {
+// timeToWait: the NG-RAN shall wait at least this time before reinitiating the NG Setup, set to nil if not needed
+func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause, timeToWait *ngapType.TimeToWait) {
 	ran.Log.Info("Send NG-Setup failure")
 
 	if cause.Present == ngapType.CausePresentNothing {
@@ -94,7 +98,7 @@ func SendNGSetupFailure(ran *context.AmfRan, cause ngapType.Cause) {
 		return
 	}
 
-	pkt, err := BuildNGSetupFailure(cause)
+	pkt, err := BuildNGSetupFailure(cause, timeToWait)
 	if err != nil {
 		ran.Log.Errorf("Build NGSetupFailure failed : %s", err.Error())
 		return
@@ -504,6 +508,36 @@ func SendHandoverRequest(sourceUe *context.RanUe, targetRan *context.AmfRan, cau
 	SendToRanUe(targetUe, pkt)
 }
 
+// SendInterAmfHandoverRequest sends the Handover Request of an N2 handover with AMF change,
+// the target UE is created by the target AMF and has no source UE (TS 23.502 4.9.1.3.2 step 9)
+func SendInterAmfHandoverRequest(targetUe *context.RanUe, cause ngapType.Cause,
+	pduSessionResourceSetupListHOReq ngapType.PDUSessionResourceSetupListHOReq,
+	sourceToTargetTransparentContainer ngapType.SourceToTargetTransparentContainer, nsci bool) error {
+	if targetUe == nil {
+		return fmt.Errorf("targetUe is nil")
+	}
+
+	targetUe.Log.Info("Send Handover Request")
+
+	if len(pduSessionResourceSetupListHOReq.List) > context.MaxNumOfPDUSessions {
+		return fmt.Errorf("Pdu List out of range")
+	}
+
+	if len(sourceToTargetTransparentContainer.Value) == 0 {
+		return fmt.Errorf("Source To Target TransparentContainer is nil")
+	}
+
+	targetUe.Log.Tracef("Target : AMF_UE_NGAP_ID[%d], RAN_UE_NGAP_ID[Unknown]", targetUe.AmfUeNgapId)
+
+	pkt, err := BuildHandoverRequest(targetUe, cause, pduSessionResourceSetupListHOReq,
+		sourceToTargetTransparentContainer, nsci)
+	if err != nil {
+		return fmt.Errorf("Build HandoverRequest failed : %s", err.Error())
+	}
+	SendToRanUe(targetUe, pkt)
+	return nil
+}
+
 // pduSessionResourceSwitchedList: provided by AMF, and the transfer data is from SMF
 // pduSessionResourceReleasedList: provided by AMF, and the transfer data is from SMF
 // newSecurityContextIndicator: if AMF has activated a new 5G NAS security context, set it to true,
@@ -604,49 +638,50 @@ func SendDownlinkRanStatusTransfer(ue *context.RanUe, container ngapType.RANStat
 // is associated with non-3GPP access, the AMF sends a Paging message with associated access "non-3GPP" to
 // NG-RAN node(s) via 3GPP access.
 // more paging policy with 3gpp/non-3gpp access is described in TS 23.501 5.6.8
-func SendPaging(ue *context.AmfUe, ngapBuf []byte) {
-	// var pagingPriority *ngapType.PagingPriority
+func SendPaging(ue *context.AmfUe, pagingPriority *ngapType.PagingPriority, pagingOriginNon3GPP bool) {
 	if ue == nil {
 		logger.NgapLog.Error("AmfUe is nil")
 		return
 	}
 
-	// if ppi != nil {
-	// pagingPriority = new(ngapType.PagingPriority)
-	// pagingPriority.Value = aper.Enumerated(*ppi)
-	// }
-	// pkt, err := BuildPaging(ue, pagingPriority, pagingOriginNon3GPP)
-	// if err != nil {
-	// 	ngaplog.Errorf("Build Paging failed : %s", err.Error())
-	// }
-	taiList := ue.RegistrationArea[models.AccessType__3_GPP_ACCESS]
-	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-		ran := value.(*context.AmfRan)
-		for _, item := range ran.SupportedTAList {
-			if context.InTaiList(item.Tai, taiList) {
-				ue.GmmLog.Infof("Send Paging to TAI(%+v, Tac:%+v)",
-					item.Tai.PlmnId, item.Tai.Tac)
-				SendToRan(ran, ngapBuf)
-				break
-			}
+	amfSelf := context.AMF_Self()
+	// the UE is paged in the paging areas of the paging escalation, one paging attempt per T3513 expiry
+	intendedAttempts := 1
+	if amfSelf.T3513Cfg.Enable {
+		intendedAttempts += amfSelf.T3513Cfg.MaxRetryTimes
+	}
+	sendPagingAttempt := func(attempt int) error {
+		ranList, scope := ue.PagingRanList(amfSelf.PagingScope(attempt))
+		pagingAttemptInformation := buildPagingAttemptInformation(ue, attempt, intendedAttempts, scope)
+		ngapBuf, err := BuildPaging(ue, pagingPriority, pagingOriginNon3GPP, pagingAttemptInformation)
+		if err != nil {
+			return err
+		}
+		ue.GmmLog.Infof("Send Paging to %d NG-RAN(s) in %s (attempt: %d)", len(ranList), scope, attempt+1)
+		for _, ran := range ranList {
+			SendToRan(ran, ngapBuf)
 		}
-		return true
-	})
+		return nil
+	}
 
-	if context.AMF_Self().T3513Cfg.Enable {
-		cfg := context.AMF_Self().T3513Cfg
-		ue.T3513 = context.NewTimer(cfg.ExpireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
+	if err := sendPagingAttempt(0); err != nil {
+		ue.GmmLog.Errorf("Build Paging failed: %s", err.Error())
+		return
+	}
+
+	if amfSelf.T3513Cfg.Enable {
+		cfg := amfSelf.T3513Cfg
+		// TS 23.501 5.31.7.2: a UE using eDRX is only reachable in its paging time window,
+		// so the paging is retransmitted once per eDRX cycle
+		expireTime := cfg.ExpireTime
+		if edrx := ue.NegotiatedExtendedDRX; edrx != nil && edrx.Cycle() > expireTime {
+			expireTime = edrx.Cycle()
+		}
+		ue.T3513 = context.NewTimer(expireTime, cfg.MaxRetryTimes, func(expireTimes int32) {
 			ue.GmmLog.Warnf("T3513 expires, retransmit Paging (retry: %d)", expireTimes)
-			context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
-				ran := value.(*context.AmfRan)
-				for _, item := range ran.SupportedTAList {
-					if context.InTaiList(item.Tai, taiList) {
-						SendToRan(ran, ngapBuf)
-						break
-					}
-				}
-				return true
-			})
+			if err := sendPagingAttempt(int(expireTimes)); err != nil {
+				ue.GmmLog.Errorf("Build Paging failed: %s", err.Error())
+			}
 		}, func() {
 			ue.GmmLog.Warnf("T3513 expires %d times, abort paging procedure", cfg.MaxRetryTimes)
 			ue.T3513 = nil // clear the timer
@@ -657,13 +692,41 @@ func SendPaging(ue *context.AmfUe, ngapBuf []byte) {
 	}
 }
 
+// buildPagingAttemptInformation indicates the paging attempt to the NG-RAN (TS 38.413 9.3.1.72),
+// the next paging area scope is changed if the next paging attempt is sent in another paging area
+func buildPagingAttemptInformation(ue *context.AmfUe, attempt, intendedAttempts int,
+	scope string) *ngapType.PagingAttemptInformation {
+	const maxPagingAttempts = 16
+	if attempt >= maxPagingAttempts {
+		return nil
+	}
+	if intendedAttempts > maxPagingAttempts {
+		intendedAttempts = maxPagingAttempts
+	}
+
+	pagingAttemptInformation := new(ngapType.PagingAttemptInformation)
+	pagingAttemptInformation.PagingAttemptCount.Value = int64(attempt + 1)
+	pagingAttemptInformation.IntendedNumberOfPagingAttempts.Value = int64(intendedAttempts)
+	if attempt+1 < intendedAttempts {
+		_, nextScope := ue.PagingRanList(context.AMF_Self().PagingScope(attempt + 1))
+		pagingAttemptInformation.NextPagingAreaScope = new(ngapType.NextPagingAreaScope)
+		if nextScope == scope {
+			pagingAttemptInformation.NextPagingAreaScope.Value = ngapType.NextPagingAreaScopePresentSame
+		} else {
+			pagingAttemptInformation.NextPagingAreaScope.Value = ngapType.NextPagingAreaScopePresentChanged
+		}
+	}
+	return pagingAttemptInformation
+}
+
 // TS 23.502 4.2.2.2.3
 // anType: indicate amfUe send this msg for which accessType
 // amfUeNgapID: initial AMF get it from target AMF
 // ngapMessage: initial UE Message to reroute
+// amfSetID: AMF Set ID (hex) of the target AMF set, and AMF get it from NSSF (4.2.2.2.3 step 4b)
 // allowedNSSAI: provided by AMF, and AMF get it from NSSF (4.2.2.2.3 step 4b)
 func SendRerouteNasRequest(ue *context.AmfUe, anType models.AccessType, amfUeNgapID *int64, ngapMessage []byte,
-	allowedNSSAI *ngapType.AllowedNSSAI) {
+	amfSetID string, allowedNSSAI *ngapType.AllowedNSSAI) {
 	if ue == nil {
 		logger.NgapLog.Error("AmfUe is nil")
 		return
@@ -676,7 +739,7 @@ func SendRerouteNasRequest(ue *context.AmfUe, anType models.AccessType, amfUeNga
 		return
 	}
 
-	pkt, err := BuildRerouteNasRequest(ue, anType, amfUeNgapID, ngapMessage, allowedNSSAI)
+	pkt, err := BuildRerouteNasRequest(ue, anType, amfUeNgapID, ngapMessage, amfSetID, allowedNSSAI)
 	if err != nil {
 		ue.RanUe[anType].Log.Errorf("Build RerouteNasRequest failed : %s", err.Error())
 		return
@@ -820,25 +883,48 @@ func SendDownlinkRanConfigurationTransfer(ran *context.AmfRan, transfer *ngapTyp
 
 // NRPPa PDU is by pass
 // NRPPa PDU is from LMF define in 4.13.5.6
-func SendDownlinkNonUEAssociatedNRPPATransport(ue *context.RanUe, nRPPaPDU ngapType.NRPPaPDU) {
-	if ue == nil {
-		logger.NgapLog.Error("RanUe is nil")
+// routingID: identity of the LMF (hex) which the NG-RAN answers to
+func SendDownlinkNonUEAssociatedNRPPATransport(ran *context.AmfRan, routingID string, nRPPaPDU ngapType.NRPPaPDU) {
+	if ran == nil {
+		logger.NgapLog.Error("Ran is nil")
 		return
 	}
 
-	ue.Log.Info("Send Downlink Non UE Associated NRPPA Transport")
+	ran.Log.Info("Send Downlink Non UE Associated NRPPA Transport")
 
 	if len(nRPPaPDU.Value) == 0 {
-		ue.Log.Error("length of NRPPA-PDU is 0")
+		ran.Log.Error("length of NRPPA-PDU is 0")
 		return
 	}
 
-	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(ue, nRPPaPDU)
+	pkt, err := BuildDownlinkNonUEAssociatedNRPPATransport(routingID, nRPPaPDU)
 	if err != nil {
-		ue.Log.Errorf("Build DownlinkNonUEAssociatedNRPPATransport failed : %s", err.Error())
+		ran.Log.Errorf("Build DownlinkNonUEAssociatedNRPPATransport failed : %s", err.Error())
 		return
 	}
-	SendToRanUe(ue, pkt)
+	SendToRan(ran, pkt)
+}
+
+func SendTraceStart(amfUe *context.AmfUe, anType models.AccessType) {
+	if amfUe == nil {
+		logger.NgapLog.Error("AmfUe is nil")
+		return
+	}
+
+	ranUe := amfUe.RanUe[anType]
+	if ranUe == nil {
+		logger.NgapLog.Error("RanUe is nil")
+		return
+	}
+
+	ranUe.Log.Info("Send Trace Start")
+
+	pkt, err := BuildTraceStart(amfUe, anType)
+	if err != nil {
+		ranUe.Log.Errorf("Build TraceStart failed : %s", err.Error())
+		return
+	}
+	SendToRanUe(ranUe, pkt)
 }
 
 func SendDeactivateTrace(amfUe *context.AmfUe, anType models.AccessType) {
@@ -903,6 +989,34 @@ func SendLocationReportingControl(
 		return
 	}
 	SendToRanUe(ue, pkt)
+
+	if ue.AmfUe != nil {
+		ue.AmfUe.UpdateLocationReporting(eventType.Value, AOIList, LocationReportingReferenceIDToBeCancelled)
+	}
+}
+
+// SendLocationReportingControlForSubscriptions requests the NG-RAN to report the location of the UE at change
+// of serving cell if any NF subscribes to the continuous LOCATION_REPORT event of the UE (TS 23.502 4.15.4.2),
+// and stops the reporting when no NF subscribes to it anymore
+func SendLocationReportingControlForSubscriptions(amfUe *context.AmfUe) {
+	if amfUe == nil {
+		logger.NgapLog.Error("AmfUe is nil")
+		return
+	}
+	ranUe := amfUe.RanUe[models.AccessType__3_GPP_ACCESS]
+	if ranUe == nil {
+		return
+	}
+
+	subscribed := amfUe.HasContinuousLocationReportSubscription()
+	reporting := amfUe.IsReportingLocationAtChangeOfServeCell()
+	if subscribed && !reporting {
+		eventType := ngapType.EventType{Value: ngapType.EventTypePresentChangeOfServeCell}
+		SendLocationReportingControl(ranUe, nil, 0, eventType)
+	} else if !subscribed && reporting {
+		eventType := ngapType.EventType{Value: ngapType.EventTypePresentStopChangeOfServeCell}
+		SendLocationReportingControl(ranUe, nil, 0, eventType)
+	}
 }
 
 func SendUETNLABindingReleaseRequest(ue *context.RanUe) {
@@ -931,6 +1045,12 @@ func SendAMFConfigurationUpdate(ran *context.AmfRan, usage ngapType.TNLAssociati
 
 	ran.Log.Info("Send AMF Configuration Update")
 
+	// TS 38.413 8.7.3.3: Time To Wait received in the AMF Configuration Update Failure
+	if wait := time.Until(ran.ConfigurationUpdateWaitUntil); wait > 0 {
+		ran.Log.Warnf("AMF Configuration Update is not allowed in %v", wait)
+		return
+	}
+
 	pkt, err := BuildAMFConfigurationUpdate(usage, weightfactor)
 	if err != nil {
 		ran.Log.Errorf("Build AMFConfigurationUpdate failed : %s", err.Error())
@@ -0,0 +1,56 @@
+package ngap
+
+import (
+	"time"
+
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	ngap_message "github.com/free5gc/amf/ngap/message"
+)
+
+// StartOverloadControl checks the load of the AMF periodically and sends
+// NGAP Overload Start/Stop to all the NG-RANs when the AMF enters/leaves the overload (TS 23.501 5.19.5.2)
+func StartOverloadControl() {
+	amfSelf := context.AMF_Self()
+	oc := &amfSelf.OverloadControl
+	if !oc.Enabled() {
+		return
+	}
+
+	logger.NgapLog.Infof("Overload control enabled: MaxUeNum[%d] MaxNasRate[%d] MaxQueueDepth[%d]",
+		oc.Cfg.MaxUeNum, oc.Cfg.MaxNasRate, oc.Cfg.MaxQueueDepth)
+
+	go func() {
+		ticker := time.NewTicker(oc.Cfg.CheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			load, changed := oc.Check(amfSelf.RanUeNum())
+			if !changed {
+				continue
+			}
+
+			overloaded := oc.IsOverloaded()
+			if overloaded {
+				logger.NgapLog.Warnf("AMF overloaded: UeNum[%d] NasRate[%d/s] QueueDepth[%d]",
+					load.UeNum, load.NasRate, load.QueueDepth)
+			} else {
+				logger.NgapLog.Infof("AMF overload ceased: UeNum[%d] NasRate[%d/s] QueueDepth[%d]",
+					load.UeNum, load.NasRate, load.QueueDepth)
+			}
+
+			amfSelf.AmfRanPool.Range(func(key, value interface{}) bool {
+				ran := value.(*context.AmfRan)
+				// only the NG-RANs which have completed the NG Setup
+				if ran.RanId == nil {
+					return true
+				}
+				if overloaded {
+					ngap_message.SendOverloadStart(ran, oc.OverloadResponse(), oc.Cfg.TrafficLoadReduction, nil)
+				} else {
+					ngap_message.SendOverloadStop(ran)
+				}
+				return true
+			})
+		}
+	}()
+}
@@ -49,6 +49,10 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case "GET":
 			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
+		case "DELETE":
+			group.DELETE(route.Pattern, route.HandlerFunc)
 		}
 	}
 	return group
@@ -80,4 +84,25 @@ var routes = Routes{
 		"/registered-ue-context/:supi",
 		HTTPRegisteredUEContext,
 	},
+
+	{
+		"Activate Trace",
+		"POST",
+		"/trace/:supi",
+		HTTPActivateTrace,
+	},
+
+	{
+		"Deactivate Trace",
+		"DELETE",
+		"/trace/:supi",
+		HTTPDeactivateTrace,
+	},
+
+	{
+		"Trace Records",
+		"GET",
+		"/trace-records",
+		HTTPTraceRecords,
+	},
 }
@@ -221,12 +221,7 @@ func AmPolicyControlUpdateNotifyUpdateProcedure(polAssoID string,
 				ue.ConfigurationUpdateMessage = message
 				ue.OnGoing[models.AccessType__3_GPP_ACCESS].Procedure = context.OnGoingProcedurePaging
 
-				pkg, err := ngap_message.BuildPaging(ue, nil, false)
-				if err != nil {
-					logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-					return
-				}
-				ngap_message.SendPaging(ue, pkg)
+				ngap_message.SendPaging(ue, nil, false)
 			}
 		}()
 	}
@@ -276,6 +271,74 @@ func AmPolicyControlUpdateNotifyTerminateProcedure(polAssoID string,
 	return nil
 }
 
+// TS 23.502 4.9.1.3.3 step 6a, the T-AMF notifies the S-AMF of the N2 handover completion
+func HandleN2InfoNotify(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infoln("[AMF] Handle N2 Info Notify")
+
+	n2InformationNotification := request.Body.(models.N2InformationNotification)
+
+	problemDetails := N2InfoNotifyProcedure(n2InformationNotification)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func N2InfoNotifyProcedure(n2InformationNotification models.N2InformationNotification) *models.ProblemDetails {
+	logger.ProducerLog.Debugf("n2InformationNotification: %+v", n2InformationNotification)
+
+	if n2InformationNotification.NotifyReason != models.N2InfoNotifyReason_HANDOVER_COMPLETED {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: fmt.Sprintf("Unsupported notify reason[%s]", n2InformationNotification.NotifyReason),
+		}
+		return problemDetails
+	}
+
+	// the subscription ID of the handover notification is the SUPI of the UE
+	ue, ok := context.AMF_Self().AmfUeFindBySupi(n2InformationNotification.N2NotifySubscriptionId)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	for _, pduSessionID := range n2InformationNotification.ToReleaseSessionList {
+		smContext, exist := ue.SmContextFindByPDUSessionID(pduSessionID)
+		if !exist {
+			ue.ProducerLog.Warnf("SmContext[PDU Session ID:%d] not found", pduSessionID)
+			continue
+		}
+		cause := context.CauseAll{
+			NgapCause: &models.NgApCause{
+				Group: int32(ngapType.CausePresentRadioNetwork),
+				Value: int32(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem),
+			},
+		}
+		problem, err := consumer.SendReleaseSmContextRequest(ue, smContext, &cause, "", nil)
+		if problem != nil {
+			ue.ProducerLog.Errorf("Release SmContext[pduSessionId: %d] Failed Problem[%+v]", pduSessionID, problem)
+		} else if err != nil {
+			ue.ProducerLog.Errorf("Release SmContext[pduSessionId: %d] Error[%v]", pduSessionID, err.Error())
+		}
+	}
+
+	// TS 23.502 4.9.1.3.3 step 7, release the UE context in the source NG-RAN
+	ranUe, ok := ue.RanUe[models.AccessType__3_GPP_ACCESS]
+	if !ok {
+		ue.ProducerLog.Warn("Source RanUe not found, remove the UE context")
+		ue.Remove()
+		return nil
+	}
+	ngap_message.SendUEContextReleaseCommand(ranUe, context.UeContextReleaseHandover,
+		ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
+	return nil
+}
+
 // TS 23.502 4.2.2.2.3 Registration with AMF re-allocation
 func HandleN1MessageNotify(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.ProducerLog.Infoln("[AMF] Handle N1 Message Notify")
@@ -325,16 +388,27 @@ func N1MessageNotifyProcedure(n1MessageNotify models.N1MessageNotify) *models.Pr
 		}
 		amfUe.CopyDataFromUeContextModel(*ueContext)
 
+		// the UE-associated NG connection is set up by this AMF towards the NG-RAN of the initial AMF
 		ranUe := ran.RanUeFindByRanUeNgapID(int64(registrationCtxtContainer.AnN2ApId))
+		if ranUe == nil {
+			var err error
+			if ranUe, err = ran.NewRanUe(int64(registrationCtxtContainer.AnN2ApId)); err != nil {
+				logger.ProducerLog.Errorf("NewRanUe Error: %+v", err)
+				amfUe.Remove()
+				return
+			}
+		}
 
-		ranUe.Location = *registrationCtxtContainer.UserLocation
-		amfUe.Location = *registrationCtxtContainer.UserLocation
+		if registrationCtxtContainer.UserLocation != nil {
+			ranUe.Location = *registrationCtxtContainer.UserLocation
+			amfUe.Location = *registrationCtxtContainer.UserLocation
+		}
 		ranUe.UeContextRequest = registrationCtxtContainer.UeContextRequest
+		ranUe.RRCEstablishmentCause = registrationCtxtContainer.RrcEstCause
 		ranUe.OldAmfName = registrationCtxtContainer.InitialAmfName
 
 		if registrationCtxtContainer.AllowedNssai != nil {
-			allowedNssai := registrationCtxtContainer.AllowedNssai
-			amfUe.AllowedNssai[allowedNssai.AccessType] = allowedNssai.AllowedSnssaiList
+			ranUe.AllowedNssai = registrationCtxtContainer.AllowedNssai.AllowedSnssaiList
 		}
 
 		if len(registrationCtxtContainer.ConfiguredNssai) > 0 {
@@ -343,6 +417,10 @@ func N1MessageNotifyProcedure(n1MessageNotify models.N1MessageNotify) *models.Pr
 
 		amfUe.AttachRanUe(ranUe)
 
+		// set log information
+		amfUe.NASLog = logger.NasLog.WithField(logger.FieldAmfUeNgapID, fmt.Sprintf("AMF_UE_NGAP_ID:%d", ranUe.AmfUeNgapId))
+		amfUe.GmmLog = logger.GmmLog.WithField(logger.FieldAmfUeNgapID, fmt.Sprintf("AMF_UE_NGAP_ID:%d", ranUe.AmfUeNgapId))
+
 		nas.HandleNAS(ranUe, ngapType.ProcedureCodeInitialUEMessage, n1MessageNotify.BinaryDataN1Message)
 	}()
 	return nil
@@ -0,0 +1,131 @@
+package callback
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	amf_context "github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+// SendAmfLocationReportNotify notifies the NFs subscribing to the LOCATION_REPORT event of the UE
+// of the current location of the UE (TS 29.518 5.3.2.4), the subscriptions of which the reports are used up
+// are removed. The notifications are sent in the background, openapi has no client of Namf_EventExposure_Notify
+func SendAmfLocationReportNotify(ue *amf_context.AmfUe) {
+	var expiredSubscriptionIDs []string
+	ue.EventSubscriptionsInfoLock.Lock()
+	for subscriptionID, ueSubscription := range ue.EventSubscriptionsInfo {
+		subscription := ueSubscription.EventSubscription
+		if subscription == nil || subscription.EventList == nil || !subscribesEvent(subscription,
+			models.AmfEventType_LOCATION_REPORT) {
+			continue
+		}
+		if ueSubscription.RemainReports != nil {
+			if *ueSubscription.RemainReports <= 0 {
+				continue
+			}
+			*ueSubscription.RemainReports--
+		}
+
+		now := time.Now().UTC()
+		location := ue.Location
+		report := models.AmfEventReport{
+			Type:      models.AmfEventType_LOCATION_REPORT,
+			State:     newAmfEventState(ueSubscription),
+			TimeStamp: &now,
+			AnyUe:     ueSubscription.AnyUe,
+			Supi:      ue.Supi,
+			Location:  &location,
+		}
+		amfEventNotification := models.AmfEventNotification{
+			NotifyCorrelationId: subscription.NotifyCorrelationId,
+			ReportList:          []models.AmfEventReport{report},
+		}
+		go sendAmfEventNotify(subscription.EventNotifyUri, amfEventNotification)
+
+		if !report.State.Active {
+			delete(ue.EventSubscriptionsInfo, subscriptionID)
+			expiredSubscriptionIDs = append(expiredSubscriptionIDs, subscriptionID)
+		}
+	}
+	ue.EventSubscriptionsInfoLock.Unlock()
+
+	for _, subscriptionID := range expiredSubscriptionIDs {
+		removeEventSubscription(subscriptionID)
+	}
+}
+
+// removeEventSubscription removes the expired subscription from the AMF and from all the UEs it applies to
+func removeEventSubscription(subscriptionID string) {
+	amfSelf := amf_context.AMF_Self()
+	subscription, ok := amfSelf.FindEventSubscription(subscriptionID)
+	if !ok {
+		return
+	}
+	for _, supi := range subscription.UeSupiList {
+		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
+			ue.DeleteEventSubscriptionInfo(subscriptionID)
+		}
+	}
+	amfSelf.DeleteEventSubscription(subscriptionID)
+}
+
+func subscribesEvent(subscription *models.AmfEventSubscription, eventType models.AmfEventType) bool {
+	for _, event := range *subscription.EventList {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func newAmfEventState(ueSubscription *amf_context.AmfUeEventSubscription) *models.AmfEventState {
+	state := &models.AmfEventState{Active: true}
+	mode := ueSubscription.EventSubscription.Options
+	if mode == nil {
+		return state
+	}
+	if mode.Trigger == models.AmfEventTrigger_ONE_TIME {
+		state.Active = false
+		return state
+	}
+	if mode.Expiry != nil {
+		if time.Now().After(*mode.Expiry) {
+			state.Active = false
+			return state
+		}
+		state.RemainDuration = int32(time.Until(*mode.Expiry).Seconds())
+	}
+	if ueSubscription.RemainReports != nil {
+		state.RemainReports = *ueSubscription.RemainReports
+		state.Active = state.RemainReports > 0
+	}
+	return state
+}
+
+func sendAmfEventNotify(uri string, amfEventNotification models.AmfEventNotification) {
+	body, err := json.Marshal(amfEventNotification)
+	if err != nil {
+		HttpLog.Errorf("Marshal AmfEventNotification error: %+v", err)
+		return
+	}
+
+	logger.ProducerLog.Infof("[AMF] Send AMF Event Notify to %s", uri)
+	client := http.Client{Timeout: 5 * time.Second}
+	httpResp, err := client.Post(uri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		HttpLog.Errorln(err.Error())
+		return
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			HttpLog.Errorf("AmfEventNotify response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+	if httpResp.StatusCode != http.StatusNoContent {
+		HttpLog.Warnf("AMF Event Notify to %s returned status %d", uri, httpResp.StatusCode)
+	}
+}
@@ -2,6 +2,8 @@ package callback
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"strconv"
 
 	"github.com/sirupsen/logrus"
@@ -86,7 +88,7 @@ func SendN1MessageNotify(ue *amf_context.AmfUe, n1class models.N1MessageClass, n
 
 // TS 29.518 5.2.2.3.5.2
 func SendN1MessageNotifyAtAMFReAllocation(
-	ue *amf_context.AmfUe, n1Msg []byte, registerContext *models.RegistrationContextContainer) {
+	ue *amf_context.AmfUe, n1Msg []byte, registerContext *models.RegistrationContextContainer) error {
 	configuration := Namf_Communication.NewConfiguration()
 	client := Namf_Communication.NewAPIClient(configuration)
 
@@ -103,6 +105,10 @@ func SendN1MessageNotifyAtAMFReAllocation(
 		BinaryDataN1Message: n1Msg,
 	}
 
+	if ue.TargetAmfProfile == nil {
+		return fmt.Errorf("no target AMF profile")
+	}
+
 	var callbackUri string
 	for _, subscription := range ue.TargetAmfProfile.DefaultNotificationSubscriptions {
 		if subscription.NotificationType == models.NotificationType_N1_MESSAGES &&
@@ -112,6 +118,10 @@ func SendN1MessageNotifyAtAMFReAllocation(
 		}
 	}
 
+	if callbackUri == "" {
+		return fmt.Errorf("no N1 message notification callback of target AMF")
+	}
+
 	httpResp, err := client.N1MessageNotifyCallbackDocumentApiServiceCallbackDocumentApi.
 		N1MessageNotify(context.Background(), callbackUri, n1MessageNotify)
 	if err != nil {
@@ -120,14 +130,21 @@ func SendN1MessageNotifyAtAMFReAllocation(
 		} else if err.Error() != httpResp.Status {
 			HttpLog.Errorln(err.Error())
 		}
+		return err
 	}
+	return nil
 }
 
-func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass, n1Msg, n2Msg []byte) {
+// SendN2InfoNotify notifies the N2 information to the subscribed NFs, nfID is the NF the N2 information is
+// destined to (e.g. the LMF identified by the Routing ID of NRPPa) and empty for any subscribed NF
+func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass, nfID string, n1Msg, n2Msg []byte) {
 	ue.N1N2MessageSubscription.Range(func(key, value interface{}) bool {
 		subscriptionID := key.(int64)
 		subscription := value.(models.UeN1N2InfoSubscriptionCreateData)
 
+		if nfID != "" && subscription.NfId != "" && subscription.NfId != nfID {
+			return true
+		}
 		if subscription.N2NotifyCallbackUri != "" && subscription.N2InformationClass == n2class {
 			configuration := Namf_Communication.NewConfiguration()
 			client := Namf_Communication.NewAPIClient(configuration)
@@ -156,6 +173,7 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 				}
 			case models.N2InformationClass_NRP_PA:
 				n2InformationNotify.JsonData.N2InfoContainer.NrppaInfo = &models.NrppaInformation{
+					NfId: nfID,
 					NrppaPdu: &models.N2InfoContent{
 						NgapData: &models.RefToBinaryData{
 							ContentId: "n2Info",
@@ -193,3 +211,90 @@ func SendN2InfoNotify(ue *amf_context.AmfUe, n2class models.N2InformationClass,
 		return true
 	})
 }
+
+// SendNonUeN2InfoNotify notifies the non UE N2 information received from the NG-RAN to the subscribed NFs
+// (TS 29.518 5.2.2.4.4), nfID is the NF the N2 information is destined to and empty for any subscribed NF
+func SendNonUeN2InfoNotify(ran *amf_context.AmfRan, n2class models.N2InformationClass, nfID string, n2Msg []byte) {
+	amf_context.AMF_Self().NonUeN2InfoSubscriptions.Range(func(key, value interface{}) bool {
+		subscriptionID := key.(int64)
+		subscription := value.(models.NonUeN2InfoSubscriptionCreateData)
+
+		if subscription.N2InformationClass != n2class || subscription.N2NotifyCallbackUri == "" {
+			return true
+		}
+		if nfID != "" && subscription.NfId != "" && subscription.NfId != nfID {
+			return true
+		}
+		if !nonUeN2InfoSubscribedRan(subscription, ran) {
+			return true
+		}
+
+		n2InformationNotify := models.N2InfoNotifyRequest{
+			JsonData: &models.N2InformationNotification{
+				N2NotifySubscriptionId: strconv.Itoa(int(subscriptionID)),
+				N2InfoContainer: &models.N2InfoContainer{
+					N2InformationClass: n2class,
+				},
+			},
+			BinaryDataN2Information: n2Msg,
+		}
+		n2InfoContent := &models.N2InfoContent{
+			NgapData: &models.RefToBinaryData{
+				ContentId: "n2Info",
+			},
+		}
+		switch n2class {
+		case models.N2InformationClass_NRP_PA:
+			n2InformationNotify.JsonData.N2InfoContainer.NrppaInfo = &models.NrppaInformation{
+				NfId:     nfID,
+				NrppaPdu: n2InfoContent,
+			}
+		case models.N2InformationClass_PWS, models.N2InformationClass_PWS_BCAL, models.N2InformationClass_PWS_RF:
+			n2InformationNotify.JsonData.N2InfoContainer.PwsInfo = &models.PwsInformation{
+				PwsContainer: n2InfoContent,
+			}
+		}
+
+		configuration := Namf_Communication.NewConfiguration()
+		client := Namf_Communication.NewAPIClient(configuration)
+		httpResponse, err := client.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+			N2InfoNotify(context.Background(), subscription.N2NotifyCallbackUri, n2InformationNotify)
+		if err != nil {
+			if httpResponse == nil {
+				HttpLog.Errorln(err.Error())
+			} else if err.Error() != httpResponse.Status {
+				HttpLog.Errorln(err.Error())
+			}
+		}
+		return true
+	})
+}
+
+// nonUeN2InfoSubscribedRan reports whether the N2 information of the NG-RAN is subscribed,
+// absent global RAN node list and access type list mean any NG-RAN
+func nonUeN2InfoSubscribedRan(subscription models.NonUeN2InfoSubscriptionCreateData, ran *amf_context.AmfRan) bool {
+	if len(subscription.AnTypeList) > 0 {
+		subscribed := false
+		for _, anType := range subscription.AnTypeList {
+			if anType == ran.AnType {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			return false
+		}
+	}
+	if subscription.GlobalRanNodeList != nil && len(*subscription.GlobalRanNodeList) > 0 {
+		if ran.RanId == nil {
+			return false
+		}
+		for _, ranNodeID := range *subscription.GlobalRanNodeList {
+			if reflect.DeepEqual(ranNodeID, *ran.RanId) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 
 	amf_context "github.com/free5gc/amf/context"
+	"github.com/free5gc/openapi"
 	"github.com/free5gc/openapi/Namf_Communication"
 	"github.com/free5gc/openapi/models"
 )
 
+// SendN2InfoNotifyN2Handover notifies the S-AMF of the handover completion (TS 23.502 4.9.1.3.3 step 6a)
 func SendN2InfoNotifyN2Handover(ue *amf_context.AmfUe, releaseList []int32) error {
 	if ue.HandoverNotifyUri == "" {
 		return fmt.Errorf("N2 Info Notify N2Handover failed(uri dose not exist)")
@@ -22,17 +24,18 @@ func SendN2InfoNotifyN2Handover(ue *amf_context.AmfUe, releaseList []int32) erro
 		NotifyReason:           models.N2InfoNotifyReason_HANDOVER_COMPLETED,
 	}
 
-	_, httpResponse, err := client.N2MessageNotifyCallbackDocumentApiServiceCallbackDocumentApi.
-		N2InfoNotify(context.Background(), ue.HandoverNotifyUri, n2InformationNotification)
+	httpResponse, err := client.N2InfoNotifyCallbackDocumentApiServiceCallbackDocumentApi.
+		N2InfoNotify(context.Background(), ue.HandoverNotifyUri, models.N2InfoNotifyRequest{
+			JsonData: &n2InformationNotification,
+		})
 
 	if err == nil {
-		// TODO: handle Msg
-	} else {
-		if httpResponse == nil {
-			HttpLog.Errorln(err.Error())
-		} else if err.Error() != httpResponse.Status {
-			HttpLog.Errorln(err.Error())
-		}
+		return nil
 	}
-	return nil
+	if httpResponse == nil {
+		return openapi.ReportError("%s: server no response", ue.HandoverNotifyUri)
+	} else if err.Error() != httpResponse.Status {
+		return err
+	}
+	return fmt.Errorf("N2 Info Notify N2Handover failed: %s", httpResponse.Status)
 }
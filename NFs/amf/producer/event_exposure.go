@@ -7,6 +7,7 @@ import (
 
 	"github.com/free5gc/amf/context"
 	"github.com/free5gc/amf/logger"
+	ngap_message "github.com/free5gc/amf/ngap/message"
 	"github.com/free5gc/http_wrapper"
 	"github.com/free5gc/openapi/models"
 )
@@ -72,8 +73,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 		ueEventSubscription.AnyUe = true
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
 			ue := value.(*context.AmfUe)
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
+			ue.AddEventSubscriptionInfo(newSubscriptionID, ueEventSubscription)
 			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
 			return true
 		})
@@ -83,8 +83,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 		amfSelf.UePool.Range(func(key, value interface{}) bool {
 			ue := value.(*context.AmfUe)
 			if ue.GroupID == subscription.GroupId {
-				ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-				*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
+				ue.AddEventSubscriptionInfo(newSubscriptionID, ueEventSubscription)
 				contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
 			}
 			return true
@@ -97,8 +96,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 			}
 			return nil, problemDetails
 		} else {
-			ue.EventSubscriptionsInfo[newSubscriptionID] = new(context.AmfUeEventSubscription)
-			*ue.EventSubscriptionsInfo[newSubscriptionID] = ueEventSubscription
+			ue.AddEventSubscriptionInfo(newSubscriptionID, ueEventSubscription)
 			contextEventSubscription.UeSupiList = append(contextEventSubscription.UeSupiList, ue.Supi)
 		}
 	}
@@ -131,7 +129,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 			}
 			// delete subscription
 			if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
-				delete(ue.EventSubscriptionsInfo, newSubscriptionID)
+				ue.DeleteEventSubscriptionInfo(newSubscriptionID)
 			}
 			return true
 		})
@@ -152,7 +150,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 				}
 				// delete subscription
 				if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
-					delete(ue.EventSubscriptionsInfo, newSubscriptionID)
+					ue.DeleteEventSubscriptionInfo(newSubscriptionID)
 				}
 			}
 			return true
@@ -172,7 +170,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 		}
 		// delete subscription
 		if reportlistLen := len(reportlist); reportlistLen > 0 && (!reportlist[reportlistLen-1].State.Active) {
-			delete(ue.EventSubscriptionsInfo, newSubscriptionID)
+			ue.DeleteEventSubscriptionInfo(newSubscriptionID)
 		}
 	}
 	if len(reportlist) > 0 {
@@ -182,6 +180,7 @@ func CreateAMFEventSubscriptionProcedure(createEventSubscription models.AmfCreat
 			amfSelf.DeleteEventSubscription(newSubscriptionID)
 		}
 	}
+	updateLocationReporting(contextEventSubscription.UeSupiList)
 
 	return createdEventSubscription, nil
 }
@@ -213,10 +212,11 @@ func DeleteAMFEventSubscriptionProcedure(subscriptionID string) *models.ProblemD
 
 	for _, supi := range subscription.UeSupiList {
 		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
-			delete(ue.EventSubscriptionsInfo, subscriptionID)
+			ue.DeleteEventSubscriptionInfo(subscriptionID)
 		}
 	}
 	amfSelf.DeleteEventSubscription(subscriptionID)
+	updateLocationReporting(subscription.UeSupiList)
 	return nil
 }
 
@@ -294,6 +294,7 @@ func ModifyAMFEventSubscriptionProcedure(
 			event := *modifySubscriptionRequest.SubscriptionItemInner.Value
 			*subscription.EventList = append(lists, event)
 		}
+		updateLocationReporting(contextSubscription.UeSupiList)
 	}
 
 	updatedEventSubscription := &models.AmfUpdatedEventSubscription{
@@ -302,7 +303,20 @@ func ModifyAMFEventSubscriptionProcedure(
 	return updatedEventSubscription, nil
 }
 
+// updateLocationReporting starts or stops the location reporting of the NG-RAN for the UEs
+// according to their continuous LOCATION_REPORT event subscriptions
+func updateLocationReporting(supiList []string) {
+	amfSelf := context.AMF_Self()
+	for _, supi := range supiList {
+		if ue, ok := amfSelf.AmfUeFindBySupi(supi); ok {
+			ngap_message.SendLocationReportingControlForSubscriptions(ue)
+		}
+	}
+}
+
 func subReports(ue *context.AmfUe, subscriptionId string) {
+	ue.EventSubscriptionsInfoLock.Lock()
+	defer ue.EventSubscriptionsInfoLock.Unlock()
 	remainReport := ue.EventSubscriptionsInfo[subscriptionId].RemainReports
 	if remainReport == nil {
 		return
@@ -313,6 +327,8 @@ func subReports(ue *context.AmfUe, subscriptionId string) {
 // DO NOT handle AmfEventType_PRESENCE_IN_AOI_REPORT and AmfEventType_UES_IN_AREA_REPORT(about area)
 func NewAmfEventReport(ue *context.AmfUe, Type models.AmfEventType, subscriptionId string) (
 	report models.AmfEventReport, ok bool) {
+	ue.EventSubscriptionsInfoLock.RLock()
+	defer ue.EventSubscriptionsInfoLock.RUnlock()
 	ueSubscription, ok := ue.EventSubscriptionsInfo[subscriptionId]
 	if !ok {
 		return report, ok
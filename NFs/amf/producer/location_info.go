@@ -3,6 +3,7 @@ package producer
 import (
 	"net/http"
 
+	"github.com/free5gc/amf/consumer"
 	"github.com/free5gc/amf/context"
 	"github.com/free5gc/amf/logger"
 	"github.com/free5gc/http_wrapper"
@@ -66,3 +67,85 @@ func ProvideLocationInfoProcedure(requestLocInfo models.RequestLocInfo, ueContex
 	}
 	return provideLocInfo, nil
 }
+
+func HandleProvidePositioningInfoRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Info("Handle Provide Positioning Info Request")
+
+	requestPosInfo := request.Body.(models.RequestPosInfo)
+	ueContextID := request.Params["ueContextId"]
+
+	providePosInfo, problemDetails := ProvidePositioningInfoProcedure(requestPosInfo, ueContextID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusOK, nil, providePosInfo)
+	}
+}
+
+// TS 23.273 6.2 step 6, 7: the AMF selects an LMF and invokes Nlmf_Location_DetermineLocation,
+// the NRPPa and LPP messages of the positioning are relayed by Namf_Communication
+func ProvidePositioningInfoProcedure(requestPosInfo models.RequestPosInfo, ueContextID string) (
+	*models.ProvidePosInfo, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return nil, problemDetails
+	}
+
+	if !ue.CmConnect(models.AccessType__3_GPP_ACCESS) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusGatewayTimeout,
+			Cause:  "UE_NOT_REACHABLE",
+		}
+		return nil, problemDetails
+	}
+
+	if ue.LmfUri == "" {
+		err := consumer.SearchLmfInstance(ue, amfSelf.NrfUri, models.NfType_LMF, models.NfType_AMF, nil)
+		if err != nil {
+			logger.ProducerLog.Errorf("LMF selection failed: %+v", err)
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusInternalServerError,
+				Cause:  "POSITIONING_FAILED",
+				Detail: err.Error(),
+			}
+			return nil, problemDetails
+		}
+	}
+
+	locationData, problemDetails, err := consumer.DetermineLocation(ue, requestPosInfo)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	if err != nil {
+		logger.ProducerLog.Errorf("Determine Location Error: %+v", err)
+		problemDetails = &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "POSITIONING_FAILED",
+			Detail: err.Error(),
+		}
+		return nil, problemDetails
+	}
+
+	providePosInfo := &models.ProvidePosInfo{
+		LocationEstimate:            &locationData.LocationEstimate,
+		AccuracyFulfilmentIndicator: locationData.AccuracyFulfilmentIndicator,
+		AgeOfLocationEstimate:       locationData.AgeOfLocationEstimate,
+		VelocityEstimate:            locationData.VelocityEstimate,
+		PositioningDataList:         locationData.PositioningDataList,
+		GnssPositioningDataList:     locationData.GnssPositioningDataList,
+		Ecgi:                        locationData.Ecgi,
+		Ncgi:                        locationData.Ncgi,
+		TargetServingNode:           amfSelf.NfId,
+		CivicAddress:                locationData.CivicAddress,
+		BarometricPressure:          locationData.BarometricPressure,
+		Altitude:                    locationData.Altitude,
+		SupportedFeatures:           locationData.SupportedFeatures,
+	}
+	return providePosInfo, nil
+}
@@ -125,6 +125,10 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 					anType = smContext.AccessType()
 				}
 			}
+		case models.N2InformationClass_NRP_PA:
+			n1n2MessageTransferRspData, problemDetails, transferErr = transferNrppaToRan(ue, requestData, n1MsgType,
+				n1Msg, n2Info)
+			return n1n2MessageTransferRspData, "", problemDetails, transferErr
 		default:
 			ue.ProducerLog.Warnf("N2 Information type [%s] is not supported", requestData.N2InfoContainer.N2InformationClass)
 			problemDetails = &models.ProblemDetails{
@@ -299,12 +303,7 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				pagingPriority = new(ngapType.PagingPriority)
 				pagingPriority.Value = aper.Enumerated(onGoing.Ppi)
 			}
-			pkg, err := ngap_message.BuildPaging(ue, pagingPriority, false)
-			if err != nil {
-				logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-				return n1n2MessageTransferRspData, locationHeader, problemDetails, transferErr
-			}
-			ngap_message.SendPaging(ue, pkg)
+			ngap_message.SendPaging(ue, pagingPriority, false)
 		}
 		// TODO: WAITING_FOR_ASYNCHRONOUS_TRANSFER
 		return n1n2MessageTransferRspData, locationHeader, nil, nil
@@ -349,16 +348,62 @@ func N1N2MessageTransferProcedure(ueContextID string, reqUri string,
 				pagingPriority = new(ngapType.PagingPriority)
 				pagingPriority.Value = aper.Enumerated(onGoing.Ppi)
 			}
-			pkg, err := ngap_message.BuildPaging(ue, pagingPriority, true)
-			if err != nil {
-				logger.NgapLog.Errorf("Build Paging failed : %s", err.Error())
-			}
-			ngap_message.SendPaging(ue, pkg)
+			ngap_message.SendPaging(ue, pagingPriority, true)
 			return n1n2MessageTransferRspData, locationHeader, nil, nil
 		}
 	}
 }
 
+// TS 23.502 4.13.5.5 step 2, 3: the LMF transfers the NRPPa PDU to the serving NG-RAN of the UE,
+// the Routing ID identifies the LMF to the NG-RAN for the uplink NRPPa PDU
+func transferNrppaToRan(ue *context.AmfUe, requestData *models.N1N2MessageTransferReqData, n1MsgType uint8,
+	n1Msg, n2Info []byte) (*models.N1N2MessageTransferRspData, *models.ProblemDetails,
+	*models.N1N2MessageTransferError) {
+	nrppaInfo := requestData.N2InfoContainer.NrppaInfo
+	if nrppaInfo == nil || nrppaInfo.NfId == "" || n2Info == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, problemDetails, nil
+	}
+
+	anType := models.AccessType__3_GPP_ACCESS
+	if !ue.CmConnect(anType) {
+		transferErr := new(models.N1N2MessageTransferError)
+		transferErr.Error = &models.ProblemDetails{
+			Status: http.StatusConflict,
+			Cause:  "UE_IN_CM_IDLE_STATE",
+		}
+		return nil, nil, transferErr
+	}
+	ranUe := ue.RanUe[anType]
+
+	if n1Msg != nil {
+		nasPdu, err := gmm_message.BuildDLNASTransport(ue, n1MsgType, n1Msg, 0, nil, nil, 0)
+		if err != nil {
+			ue.ProducerLog.Errorf("Build DL NAS Transport error: %+v", err)
+			problemDetails := &models.ProblemDetails{
+				Title:  "System failure",
+				Status: http.StatusInternalServerError,
+				Detail: err.Error(),
+				Cause:  "SYSTEM_FAILURE",
+			}
+			return nil, problemDetails, nil
+		}
+		ngap_message.SendDownlinkNasTransport(ranUe, nasPdu, nil)
+	}
+
+	ue.ProducerLog.Debugf("Forward NRPPa PDU from LMF[%s] to NG-RAN", nrppaInfo.NfId)
+	ue.LmfId = nrppaInfo.NfId
+	ranUe.RoutingID = context.LmfIdToRoutingID(nrppaInfo.NfId)
+	ngap_message.SendDownlinkUEAssociatedNRPPaTransport(ranUe, ngapType.NRPPaPDU{Value: n2Info})
+
+	n1n2MessageTransferRspData := new(models.N1N2MessageTransferRspData)
+	n1n2MessageTransferRspData.Cause = models.N1N2MessageTransferCause_N1_N2_TRANSFER_INITIATED
+	return n1n2MessageTransferRspData, nil, nil
+}
+
 func HandleN1N2MessageTransferStatusRequest(request *http_wrapper.Request) *http_wrapper.Response {
 	logger.CommLog.Info("Handle N1N2Message Transfer Status Request")
 
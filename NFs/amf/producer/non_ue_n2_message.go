@@ -0,0 +1,190 @@
+package producer
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/free5gc/amf/context"
+	"github.com/free5gc/amf/logger"
+	ngap_message "github.com/free5gc/amf/ngap/message"
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/ngap/ngapType"
+	"github.com/free5gc/openapi/models"
+)
+
+// TS 29.518 5.2.2.4.1
+func HandleNonUeN2MessageTransferRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Message Transfer Request")
+
+	nonUeN2MessageTransferRequest := request.Body.(models.NonUeN2MessageTransferRequest)
+
+	n2InformationTransferRspData, problemDetails := NonUeN2MessageTransferProcedure(nonUeN2MessageTransferRequest)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusOK, nil, n2InformationTransferRspData)
+	}
+}
+
+// TS 23.502 4.13.5.6 step 1, 2: the LMF transfers the NRPPa PDU to the NG-RANs, the NG-RANs are selected
+// by the global RAN node list or the TAI list, and all the NG-RANs of 3GPP access are selected if both are absent
+func NonUeN2MessageTransferProcedure(nonUeN2MessageTransferRequest models.NonUeN2MessageTransferRequest) (
+	*models.N2InformationTransferRspData, *models.ProblemDetails) {
+	requestData := nonUeN2MessageTransferRequest.JsonData
+	n2Info := nonUeN2MessageTransferRequest.BinaryDataN2Information
+	if requestData == nil || requestData.N2Information == nil || n2Info == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, problemDetails
+	}
+
+	if requestData.N2Information.N2InformationClass != models.N2InformationClass_NRP_PA {
+		logger.CommLog.Warnf("N2 Information type [%s] is not supported", requestData.N2Information.N2InformationClass)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotImplemented,
+			Cause:  "NOT_IMPLEMENTED",
+		}
+		return nil, problemDetails
+	}
+	nrppaInfo := requestData.N2Information.NrppaInfo
+	if nrppaInfo == nil || nrppaInfo.NfId == "" {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, problemDetails
+	}
+
+	var ranList []*context.AmfRan
+	context.AMF_Self().AmfRanPool.Range(func(key, value interface{}) bool {
+		ran := value.(*context.AmfRan)
+		if ran.AnType == models.AccessType__3_GPP_ACCESS && isNonUeN2MessageTargetRan(requestData, ran) {
+			ranList = append(ranList, ran)
+		}
+		return true
+	})
+	if len(ranList) == 0 {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+			Detail: "No NG-RAN matches the target of the N2 information",
+		}
+		return nil, problemDetails
+	}
+
+	routingID := context.LmfIdToRoutingID(nrppaInfo.NfId)
+	for _, ran := range ranList {
+		ngap_message.SendDownlinkNonUEAssociatedNRPPATransport(ran, routingID, ngapType.NRPPaPDU{Value: n2Info})
+	}
+
+	n2InformationTransferRspData := &models.N2InformationTransferRspData{
+		Result: models.N2InformationTransferResult_N2_INFO_TRANSFER_INITIATED,
+	}
+	return n2InformationTransferRspData, nil
+}
+
+func isNonUeN2MessageTargetRan(requestData *models.N2InformationTransferReqData, ran *context.AmfRan) bool {
+	hasTarget := false
+	if requestData.GlobalRanNodeList != nil && len(*requestData.GlobalRanNodeList) > 0 {
+		hasTarget = true
+		for _, ranNodeID := range *requestData.GlobalRanNodeList {
+			if ran.RanId != nil && reflect.DeepEqual(ranNodeID, *ran.RanId) {
+				return true
+			}
+		}
+	}
+	if requestData.TaiList != nil && len(*requestData.TaiList) > 0 {
+		hasTarget = true
+		for _, item := range ran.SupportedTAList {
+			if context.InTaiList(item.Tai, *requestData.TaiList) {
+				return true
+			}
+		}
+	}
+	return !hasTarget
+}
+
+// TS 29.518 5.2.2.4.2
+func HandleNonUeN2InfoSubscribeRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Info Subscribe Request")
+
+	nonUeN2InfoSubscriptionCreateData := request.Body.(models.NonUeN2InfoSubscriptionCreateData)
+
+	nonUeN2InfoSubscriptionCreatedData, problemDetails := NonUeN2InfoSubscribeProcedure(
+		nonUeN2InfoSubscriptionCreateData)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusCreated, nil, nonUeN2InfoSubscriptionCreatedData)
+	}
+}
+
+func NonUeN2InfoSubscribeProcedure(nonUeN2InfoSubscriptionCreateData models.NonUeN2InfoSubscriptionCreateData) (
+	*models.NonUeN2InfoSubscriptionCreatedData, *models.ProblemDetails) {
+	amfSelf := context.AMF_Self()
+
+	if nonUeN2InfoSubscriptionCreateData.N2NotifyCallbackUri == "" {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_MISSING",
+		}
+		return nil, problemDetails
+	}
+
+	newSubscriptionID, err := amfSelf.NonUeN2InfoSubscriptionIDGenerator.Allocate()
+	if err != nil {
+		logger.CommLog.Errorf("Create subscriptionID Error: %+v", err)
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+		}
+		return nil, problemDetails
+	}
+	amfSelf.NonUeN2InfoSubscriptions.Store(newSubscriptionID, nonUeN2InfoSubscriptionCreateData)
+
+	nonUeN2InfoSubscriptionCreatedData := &models.NonUeN2InfoSubscriptionCreatedData{
+		N2NotifySubscriptionId: strconv.Itoa(int(newSubscriptionID)),
+	}
+	return nonUeN2InfoSubscriptionCreatedData, nil
+}
+
+// TS 29.518 5.2.2.4.3
+func HandleNonUeN2InfoUnSubscribeRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.CommLog.Info("Handle Non UE N2 Info UnSubscribe Request")
+
+	subscriptionID := request.Params["n2NotifySubscriptionId"]
+
+	problemDetails := NonUeN2InfoUnSubscribeProcedure(subscriptionID)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func NonUeN2InfoUnSubscribeProcedure(subscriptionIDString string) *models.ProblemDetails {
+	amfSelf := context.AMF_Self()
+
+	subscriptionID, err := strconv.ParseInt(subscriptionIDString, 10, 64)
+	if err != nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+		return problemDetails
+	}
+	if _, ok := amfSelf.NonUeN2InfoSubscriptions.Load(subscriptionID); !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "SUBSCRIPTION_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	amfSelf.NonUeN2InfoSubscriptions.Delete(subscriptionID)
+	amfSelf.NonUeN2InfoSubscriptionIDGenerator.FreeID(subscriptionID)
+	return nil
+}
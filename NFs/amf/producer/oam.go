@@ -6,6 +6,7 @@ import (
 
 	"github.com/free5gc/amf/context"
 	"github.com/free5gc/amf/logger"
+	ngap_message "github.com/free5gc/amf/ngap/message"
 	"github.com/free5gc/http_wrapper"
 	"github.com/free5gc/openapi/models"
 )
@@ -121,3 +122,103 @@ func buildUEContext(ue *context.AmfUe, accessType models.AccessType) *UEContext
 	}
 	return nil
 }
+
+func HandleOAMActivateTrace(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infof("[OAM] Handle Activate Trace")
+
+	supi := request.Params["supi"]
+	traceData := request.Body.(models.TraceData)
+
+	problemDetails := OAMActivateTraceProcedure(supi, traceData)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+// TS 32.422 4.2.2.9: the trace session is activated in the NG-RAN by Trace Start if the UE is in CM-CONNECTED,
+// otherwise by the Trace Activation IE of the next Initial Context Setup Request
+func OAMActivateTraceProcedure(supi string, traceData models.TraceData) *models.ProblemDetails {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindBySupi(supi)
+	if !ok {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+	if err := context.ValidateTraceData(&traceData); err != nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "INVALID_MSG_FORMAT",
+			Detail: err.Error(),
+		}
+		return problemDetails
+	}
+
+	ue.TraceData = &traceData
+	traceRecord := context.TraceRecord{
+		Event:                  context.TraceEventTraceStart,
+		Supi:                   ue.Supi,
+		Pei:                    ue.Pei,
+		TraceRef:               traceData.TraceRef,
+		CollectionEntityIpAddr: traceData.CollectionEntityIpv4Addr + traceData.CollectionEntityIpv6Addr,
+	}
+	if ue.CmConnect(models.AccessType__3_GPP_ACCESS) {
+		ngap_message.SendTraceStart(ue, models.AccessType__3_GPP_ACCESS)
+		traceRecord.Trsr = ue.RanUe[models.AccessType__3_GPP_ACCESS].Trsr
+	}
+	amfSelf.TraceStore.Add(traceRecord)
+	return nil
+}
+
+func HandleOAMDeactivateTrace(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infof("[OAM] Handle Deactivate Trace")
+
+	supi := request.Params["supi"]
+
+	problemDetails := OAMDeactivateTraceProcedure(supi)
+	if problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	} else {
+		return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+}
+
+func OAMDeactivateTraceProcedure(supi string) *models.ProblemDetails {
+	amfSelf := context.AMF_Self()
+
+	ue, ok := amfSelf.AmfUeFindBySupi(supi)
+	if !ok || ue.TraceData == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return problemDetails
+	}
+
+	traceRecord := context.TraceRecord{
+		Event:    context.TraceEventDeactivateTrace,
+		Supi:     ue.Supi,
+		Pei:      ue.Pei,
+		TraceRef: ue.TraceData.TraceRef,
+	}
+	if ue.CmConnect(models.AccessType__3_GPP_ACCESS) {
+		traceRecord.Trsr = ue.RanUe[models.AccessType__3_GPP_ACCESS].Trsr
+		ngap_message.SendDeactivateTrace(ue, models.AccessType__3_GPP_ACCESS)
+	}
+	ue.TraceData = nil
+	amfSelf.TraceStore.Add(traceRecord)
+	return nil
+}
+
+func HandleOAMTraceRecords(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.ProducerLog.Infof("[OAM] Handle Trace Records")
+
+	supi := request.Query.Get("supi")
+
+	return http_wrapper.NewResponse(http.StatusOK, nil, context.AMF_Self().TraceStore.Records(supi))
+}
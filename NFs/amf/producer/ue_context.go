@@ -1,13 +1,20 @@
 package producer
 
 import (
+	"encoding/hex"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/free5gc/amf/consumer"
 	"github.com/free5gc/amf/context"
 	"github.com/free5gc/amf/logger"
+	"github.com/free5gc/amf/nas/nas_security"
+	ngap_message "github.com/free5gc/amf/ngap/message"
+	"github.com/free5gc/aper"
 	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/ngap/ngapType"
 	"github.com/free5gc/openapi/models"
 )
 
@@ -26,102 +33,162 @@ func HandleCreateUEContextRequest(request *http_wrapper.Request) *http_wrapper.R
 	}
 }
 
+// time the target AMF waits for the target NG-RAN to allocate the handover resources
+const handoverResourceAllocationTimeout = 5 * time.Second
+
+// handoverFailure builds the CreateUEContext error with the radio network cause sent back to the source NG-RAN
+func handoverFailure(radioNetworkCause aper.Enumerated) *models.UeContextCreateError {
+	return &models.UeContextCreateError{
+		Error: &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "HANDOVER_FAILURE",
+		},
+		NgapCause: &models.NgApCause{
+			Group: int32(ngapType.CausePresentRadioNetwork),
+			Value: int32(radioNetworkCause),
+		},
+	}
+}
+
+// TS 23.502 4.9.1.3.2 step 4-12, the target AMF prepares the handover resources in the SMF and the target NG-RAN
+// and answers once the target NG-RAN acknowledged or refused the Handover Request
 func CreateUEContextProcedure(ueContextID string, createUeContextRequest models.CreateUeContextRequest) (
 	*models.CreateUeContextResponse, *models.UeContextCreateError) {
 	amfSelf := context.AMF_Self()
 	ueContextCreateData := createUeContextRequest.JsonData
 
 	if ueContextCreateData.UeContext == nil || ueContextCreateData.TargetId == nil ||
+		ueContextCreateData.TargetId.RanNodeId == nil || ueContextCreateData.TargetId.Tai == nil ||
 		ueContextCreateData.PduSessionList == nil || ueContextCreateData.SourceToTargetData == nil ||
 		ueContextCreateData.N2NotifyUri == "" {
-		ueContextCreateError := &models.UeContextCreateError{
-			Error: &models.ProblemDetails{
-				Status: http.StatusForbidden,
-				Cause:  "HANDOVER_FAILURE",
-			},
-		}
-		return nil, ueContextCreateError
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
+	if len(createUeContextRequest.BinaryDataN2Information) == 0 {
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
+
+	targetRan, ok := amfSelf.AmfRanFindByRanID(*ueContextCreateData.TargetId.RanNodeId)
+	if !ok {
+		logger.CommLog.Warnf("Create UE Context: target RAN[%+v] is not served by this AMF",
+			*ueContextCreateData.TargetId.RanNodeId)
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentUnknownTargetID)
+	}
+
+	supi := ueContextCreateData.UeContext.Supi
+	if supi == "" {
+		supi = ueContextID
+	}
+	if staleUe, ok := amfSelf.AmfUeFindBySupi(supi); ok {
+		logger.CommLog.Warnf("Create UE Context: remove stale UE context[%s]", supi)
+		staleUe.Remove()
 	}
+
 	// create the UE context in target amf
-	ue := amfSelf.NewAmfUe(ueContextID)
-	// amfSelf.AmfRanSetByRanId(*ueContextCreateData.TargetId.RanNodeId)
-	// ue.N1N2Message[ueContextId] = &context.N1N2Message{}
-	// ue.N1N2Message[ueContextId].Request.JsonData = &models.N1N2MessageTransferReqData{
-	// 	N2InfoContainer: &models.N2InfoContainer{
-	// 		SmInfo: &models.N2SmInformation{
-	// 			N2InfoContent: ueContextCreateData.SourceToTargetData,
-	// 		},
-	// 	},
-	// }
+	ue := amfSelf.NewAmfUe(supi)
+	ue.CopyDataFromUeContextModel(*ueContextCreateData.UeContext)
+	if ue.AccessAndMobilitySubscriptionData == nil ||
+		ue.AccessAndMobilitySubscriptionData.SubscribedUeAmbr == nil {
+		logger.CommLog.Error("Create UE Context: subscribed UE-AMBR is missing")
+		ue.Remove()
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
 	ue.HandoverNotifyUri = ueContextCreateData.N2NotifyUri
+	ue.Tai = *ueContextCreateData.TargetId.Tai
+	if len(ueContextCreateData.UeContext.RestrictedRatList) > 0 {
+		ue.RatType = ueContextCreateData.UeContext.RestrictedRatList[0]
+	}
+	if ueContextCreateData.UeRadioCapability != nil {
+		ue.UeRadioCapability = hex.EncodeToString(createUeContextRequest.BinaryDataN2InformationExt1)
+	}
+	if ue.Kamf != "" {
+		ue.DerivateAlgKey()
+		ue.SecurityContextAvailable = true
+	}
+	anType := targetRan.AnType
+	ue.State[anType].Set(context.Registered)
+	ue.OnGoing[anType].Procedure = context.OnGoingProcedureN2Handover
+
+	var pduSessionReqList ngapType.PDUSessionResourceSetupListHOReq
+	binaries := context.PduSessionListBinaries(&createUeContextRequest)
+	for i, smInfo := range ueContextCreateData.PduSessionList {
+		if i >= len(binaries) {
+			break
+		}
+		smContext, exist := ue.SmContextFindByPDUSessionID(smInfo.PduSessionId)
+		if !exist {
+			logger.CommLog.Warnf("Create UE Context: no SM context for PDU Session ID[%d]", smInfo.PduSessionId)
+			continue
+		}
+		response, _, _, err := consumer.SendUpdateSmContextN2HandoverPreparing(ue, smContext,
+			models.N2SmInfoType_HANDOVER_REQUIRED, *binaries[i], amfSelf.NfId, ueContextCreateData.TargetId)
+		if err != nil {
+			logger.CommLog.Errorf("consumer.SendUpdateSmContextN2HandoverPreparing Error: %+v", err)
+		}
+		if response == nil || response.BinaryDataN2SmInformation == nil {
+			logger.CommLog.Errorf("SendUpdateSmContextN2HandoverPreparing Error for PduSessionId[%d]", smInfo.PduSessionId)
+			continue
+		}
+		ngap_message.AppendPDUSessionResourceSetupListHOReq(&pduSessionReqList, smInfo.PduSessionId,
+			smContext.Snssai(), response.BinaryDataN2SmInformation)
+	}
+	if len(pduSessionReqList.List) == 0 {
+		ue.Remove()
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
 
-	amfSelf.AmfRanFindByRanID(*ueContextCreateData.TargetId.RanNodeId)
-	supportedTAI := context.NewSupportedTAI()
-	supportedTAI.Tai.Tac = ueContextCreateData.TargetId.Tai.Tac
-	supportedTAI.Tai.PlmnId = ueContextCreateData.TargetId.Tai.PlmnId
-	// ue.N1N2MessageSubscribeInfo[ueContextID] = &models.UeN1N2InfoSubscriptionCreateData{
-	// 	N2NotifyCallbackUri: ueContextCreateData.N2NotifyUri,
-	// }
-	ue.UnauthenticatedSupi = ueContextCreateData.UeContext.SupiUnauthInd
-	// should be smInfo list
-
-	//for _, smInfo := range ueContextCreateData.PduSessionList {
-	//if smInfo.N2InfoContent.NgapIeType == "NgapIeType_HANDOVER_REQUIRED" {
-	// ue.N1N2Message[amfSelf.Uri].Request.JsonData.N2InfoContainer.SmInfo = &smInfo
-	//}
-	//}
-
-	ue.RoutingIndicator = ueContextCreateData.UeContext.RoutingIndicator
-
-	// optional
-	ue.UdmGroupId = ueContextCreateData.UeContext.UdmGroupId
-	ue.AusfGroupId = ueContextCreateData.UeContext.AusfGroupId
-	// ueContextCreateData.UeContext.HpcfId
-	ue.RatType = ueContextCreateData.UeContext.RestrictedRatList[0] // minItem = -1
-	// ueContextCreateData.UeContext.ForbiddenAreaList
-	// ueContextCreateData.UeContext.ServiceAreaRestriction
-	// ueContextCreateData.UeContext.RestrictedCoreNwTypeList
-
-	// it's not in 5.2.2.1.1 step 2a, so don't support
-	// ue.Gpsi = ueContextCreateData.UeContext.GpsiList
-	// ue.Pei = ueContextCreateData.UeContext.Pei
-	// ueContextCreateData.UeContext.GroupList
-	// ueContextCreateData.UeContext.DrxParameter
-	// ueContextCreateData.UeContext.SubRfsp
-	// ueContextCreateData.UeContext.UsedRfsp
-	// ue.UEAMBR = ueContextCreateData.UeContext.SubUeAmbr
-	// ueContextCreateData.UeContext.SmsSupport
-	// ueContextCreateData.UeContext.SmsfId
-	// ueContextCreateData.UeContext.SeafData
-	// ueContextCreateData.UeContext.Var5gMmCapability
-	// ueContextCreateData.UeContext.PcfId
-	// ueContextCreateData.UeContext.PcfAmPolicyUri
-	// ueContextCreateData.UeContext.AmPolicyReqTriggerList
-	// ueContextCreateData.UeContext.EventSubscriptionList
-	// ueContextCreateData.UeContext.MmContextList
-	// ue.CurPduSession.PduSessionId = ueContextCreateData.UeContext.SessionContextList.
-	// ue.TraceData = ueContextCreateData.UeContext.TraceData
-	createUeContextResponse := new(models.CreateUeContextResponse)
-	createUeContextResponse.JsonData = &models.UeContextCreatedData{
-		UeContext: &models.UeContext{
-			Supi: ueContextCreateData.UeContext.Supi,
-		},
+	targetUe, err := targetRan.NewRanUe(context.RanUeNgapIdUnspecified)
+	if err != nil {
+		logger.CommLog.Errorf("Create target UE error: %+v", err)
+		cancelHandoverSmContexts(ue, ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		ue.Remove()
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
 	}
+	targetUe.HandOverType.Value = ngapType.HandoverTypePresentIntra5gs
+	ue.AttachRanUe(targetUe)
 
-	// response.JsonData.TargetToSourceData =
-	// ue.N1N2Message[ueContextId].Request.JsonData.N2InfoContainer.SmInfo.N2InfoContent
-	createUeContextResponse.JsonData.PduSessionList = ueContextCreateData.PduSessionList
-	createUeContextResponse.JsonData.PcfReselectedInd = false
-	// TODO: When  Target AMF selects a nw PCF for AM policy, set the flag to true.
+	ue.HandoverResult = make(chan *context.HandoverResult, 1)
+	sourceToTargetTransparentContainer := ngapType.SourceToTargetTransparentContainer{
+		Value: createUeContextRequest.BinaryDataN2Information,
+	}
+	if err := ngap_message.SendInterAmfHandoverRequest(targetUe, context.NgapCauseToCause(ueContextCreateData.NgapCause),
+		pduSessionReqList, sourceToTargetTransparentContainer, false); err != nil {
+		targetUe.Log.Error(err)
+		cancelHandoverSmContexts(ue, ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+		ue.Remove()
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentHoFailureInTarget5GCNgranNodeOrTargetSystem)
+	}
 
-	//response.UeContext = ueContextCreateData.UeContext
-	//response.TargetToSourceData = ue.N1N2Message[amfSelf.Uri].Request.JsonData.N2InfoContainer.SmInfo.N2InfoContent
-	//response.PduSessionList = ueContextCreateData.PduSessionList
-	//response.PcfReselectedInd = false // TODO:When  Target AMF selects a nw PCF for AM policy, set the flag to true.
-	//
+	select {
+	case result := <-ue.HandoverResult:
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		result.Response.JsonData.PcfReselectedInd = false
+		// TODO: When  Target AMF selects a nw PCF for AM policy, set the flag to true.
+		return result.Response, nil
+	case <-time.After(handoverResourceAllocationTimeout):
+		targetUe.Log.Warn("Handover Request timeout")
+		cancelHandoverSmContexts(ue, ngapType.CauseRadioNetworkPresentTngrelocprepExpiry)
+		ue.Remove()
+		return nil, handoverFailure(ngapType.CauseRadioNetworkPresentTngrelocprepExpiry)
+	}
+}
 
-	// return http_wrapper.NewResponse(http.StatusCreated, nil, createUeContextResponse)
-	return createUeContextResponse, nil
+func cancelHandoverSmContexts(ue *context.AmfUe, radioNetworkCause aper.Enumerated) {
+	causeAll := context.CauseAll{
+		NgapCause: &models.NgApCause{
+			Group: int32(ngapType.CausePresentRadioNetwork),
+			Value: int32(radioNetworkCause),
+		},
+	}
+	ue.SmContextList.Range(func(key, value interface{}) bool {
+		smContext := value.(*context.SmContext)
+		if _, _, _, err := consumer.SendUpdateSmContextN2HandoverCanceled(ue, smContext, causeAll); err != nil {
+			logger.CommLog.Errorf("Send UpdateSmContextN2HandoverCanceled Error for PduSessionId[%d]",
+				smContext.PduSessionID())
+		}
+		return true
+	})
 }
 
 // TS 29.518 5.2.2.2.4
@@ -163,7 +230,14 @@ func ReleaseUEContextProcedure(ueContextID string, ueContextRelease models.UeCon
 	logger.CommLog.Debugf("Release UE Context NGAP cause: %+v", ueContextRelease.NgapCause)
 
 	if ue, ok := amfSelf.AmfUeFindByUeContextID(ueContextID); ok {
-		ue.Remove()
+		// handover cancelled by the source AMF, release the resources in the target NG-RAN
+		if ranUe, exist := ue.RanUe[models.AccessType__3_GPP_ACCESS]; exist &&
+			ue.OnGoing[models.AccessType__3_GPP_ACCESS].Procedure == context.OnGoingProcedureN2Handover {
+			ngap_message.SendUEContextReleaseCommand(ranUe, context.UeContextReleaseHandover,
+				ngapType.CausePresentRadioNetwork, ngapType.CauseRadioNetworkPresentHandoverCancelled)
+		} else {
+			ue.Remove()
+		}
 	} else {
 		problemDetails := &models.ProblemDetails{
 			Status: http.StatusNotFound,
@@ -221,8 +295,9 @@ func UEContextTransferProcedure(ueContextID string, ueContextTransferRequest mod
 		return nil, problemDetails
 	}
 
-	var ueContextTransferResponse *models.UeContextTransferResponse
-	ueContextTransferResponse.JsonData = new(models.UeContextTransferRspData)
+	ueContextTransferResponse := &models.UeContextTransferResponse{
+		JsonData: new(models.UeContextTransferRspData),
+	}
 	ueContextTransferRspData := ueContextTransferResponse.JsonData
 
 	//if ue.GetAnType() != UeContextTransferReqData.AccessType {
@@ -235,70 +310,47 @@ func UEContextTransferProcedure(ueContextID string, ueContextTransferRequest mod
 
 	switch UeContextTransferReqData.Reason {
 	case models.TransferReason_INIT_REG:
-		// TODO: check integrity of the registration request included in ueContextTransferRequest
 		// TODO: handle condition of TS 29.518 5.2.2.2.1.1 step 2a case b
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
+		if !checkRegistrationRequestIntegrity(ue, UeContextTransferReqData.AccessType,
+			ueContextTransferRequest.BinaryDataN1Message) {
+			ue.ProducerLog.Warn("Integrity check of the registration request failed")
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "INTEGRITY_CHECK_FAIL",
+			}
+			return nil, problemDetails
+		}
+		ueContextTransferRspData.UeContext = buildUEContextModel(ue, UeContextTransferReqData.AccessType)
 	case models.TransferReason_MOBI_REG:
-		// TODO: check integrity of the registration request included in ueContextTransferRequest
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
-
-		sessionContextList := &ueContextTransferRspData.UeContext.SessionContextList
-		ue.SmContextList.Range(func(key, value interface{}) bool {
-			smContext := value.(*context.SmContext)
-			snssai := smContext.Snssai()
-			pduSessionContext := models.PduSessionContext{
-				PduSessionId: smContext.PduSessionID(),
-				SmContextRef: smContext.SmContextRef(),
-				SNssai:       &snssai,
-				Dnn:          smContext.Dnn(),
-				AccessType:   smContext.AccessType(),
-				HsmfId:       smContext.HSmfID(),
-				VsmfId:       smContext.VSmfID(),
-				NsInstance:   smContext.NsInstance(),
+		if !checkRegistrationRequestIntegrity(ue, UeContextTransferReqData.AccessType,
+			ueContextTransferRequest.BinaryDataN1Message) {
+			ue.ProducerLog.Warn("Integrity check of the registration request failed")
+			problemDetails := &models.ProblemDetails{
+				Status: http.StatusForbidden,
+				Cause:  "INTEGRITY_CHECK_FAIL",
 			}
-			*sessionContextList = append(*sessionContextList, pduSessionContext)
-			return true
-		})
-
-		ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
-			NgapMessageType: 0,
-			NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
-			NgapData: &models.RefToBinaryData{
-				ContentId: "n2Info",
-			},
+			return nil, problemDetails
 		}
-		b := []byte(ue.UeRadioCapability)
-		copy(ueContextTransferResponse.BinaryDataN2Information, b)
+		fallthrough
 	case models.TransferReason_MOBI_REG_UE_VALIDATED:
-		ueContextTransferRspData.UeContext = buildUEContextModel(ue)
-
-		sessionContextList := &ueContextTransferRspData.UeContext.SessionContextList
-		ue.SmContextList.Range(func(key, value interface{}) bool {
-			smContext := value.(*context.SmContext)
-			snssai := smContext.Snssai()
-			pduSessionContext := models.PduSessionContext{
-				PduSessionId: smContext.PduSessionID(),
-				SmContextRef: smContext.SmContextRef(),
-				SNssai:       &snssai,
-				Dnn:          smContext.Dnn(),
-				AccessType:   smContext.AccessType(),
-				HsmfId:       smContext.HSmfID(),
-				VsmfId:       smContext.VSmfID(),
-				NsInstance:   smContext.NsInstance(),
+		ueContextTransferRspData.UeContext = buildUEContextModel(ue, UeContextTransferReqData.AccessType)
+		ueContextTransferRspData.UeContext.SessionContextList = ue.SessionContextListModel()
+
+		if ue.UeRadioCapability != "" {
+			ueRadioCapability, err := hex.DecodeString(ue.UeRadioCapability)
+			if err != nil {
+				ue.ProducerLog.Errorf("Decode UE Radio Capability error: %+v", err)
+			} else {
+				ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
+					NgapMessageType: 0,
+					NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
+					NgapData: &models.RefToBinaryData{
+						ContentId: "n2Info",
+					},
+				}
+				ueContextTransferResponse.BinaryDataN2Information = ueRadioCapability
 			}
-			*sessionContextList = append(*sessionContextList, pduSessionContext)
-			return true
-		})
-
-		ueContextTransferRspData.UeRadioCapability = &models.N2InfoContent{
-			NgapMessageType: 0,
-			NgapIeType:      models.NgapIeType_UE_RADIO_CAPABILITY,
-			NgapData: &models.RefToBinaryData{
-				ContentId: "n2Info",
-			},
 		}
-		b := []byte(ue.UeRadioCapability)
-		copy(ueContextTransferResponse.BinaryDataN2Information, b)
 	default:
 		logger.ProducerLog.Warnf("Invalid Transfer Reason: %+v", UeContextTransferReqData.Reason)
 		problemDetails := &models.ProblemDetails{
@@ -315,10 +367,33 @@ func UEContextTransferProcedure(ueContextID string, ueContextTransferRequest mod
 	return ueContextTransferResponse, nil
 }
 
-func buildUEContextModel(ue *context.AmfUe) *models.UeContext {
+// TS 29.518 5.2.2.2.1.1 step 2a: the old AMF checks the integrity of the registration request
+// with the NAS security context of the UE before the UE context is transferred
+func checkRegistrationRequestIntegrity(ue *context.AmfUe, anType models.AccessType, nasPdu []byte) bool {
+	if !ue.SecurityContextAvailable || len(nasPdu) < 7 {
+		return false
+	}
+	if nas.GetSecurityHeaderType(nasPdu)&0x0f == nas.SecurityHeaderTypePlainNas {
+		return false
+	}
+	msg, err := nas_security.Decode(ue, anType, nasPdu)
+	if err != nil {
+		ue.ProducerLog.Warnf("Decode registration request error: %+v", err)
+		return false
+	}
+	if msg.GmmMessage == nil || msg.GmmMessage.RegistrationRequest == nil {
+		ue.ProducerLog.Warn("The N1 message is not a registration request")
+		return false
+	}
+	return !ue.MacFailed
+}
+
+func buildUEContextModel(ue *context.AmfUe, anType models.AccessType) *models.UeContext {
 	ueContext := new(models.UeContext)
 	ueContext.Supi = ue.Supi
 	ueContext.SupiUnauthInd = ue.UnauthenticatedSupi
+	ueContext.SeafData = ue.SeafDataModel()
+	ueContext.MmContextList = []models.MmContext{ue.MmContextModel(anType)}
 
 	if ue.Gpsi != "" {
 		ueContext.GpsiList = append(ueContext.GpsiList, ue.Gpsi)
@@ -366,11 +441,13 @@ func buildUEContextModel(ue *context.AmfUe) *models.UeContext {
 		}
 	}
 
+	ue.EventSubscriptionsInfoLock.RLock()
 	for _, eventSub := range ue.EventSubscriptionsInfo {
 		if eventSub.EventSubscription != nil {
 			ueContext.EventSubscriptionList = append(ueContext.EventSubscriptionList, *eventSub.EventSubscription)
 		}
 	}
+	ue.EventSubscriptionsInfoLock.RUnlock()
 
 	if ue.TraceData != nil {
 		ueContext.TraceData = ue.TraceData
@@ -484,6 +561,7 @@ func RegistrationStatusUpdateProcedure(ueContextID string, ueRegStatusUpdateReqD
 			smContext, ok := ue.SmContextFindByPDUSessionID(pduSessionId)
 			if !ok {
 				ue.ProducerLog.Errorf("SmContext[PDU Session ID:%d] not found", pduSessionId)
+				continue
 			}
 			problem, err := consumer.SendReleaseSmContextRequest(ue, smContext, causeAll, "", nil)
 			if problem != nil {
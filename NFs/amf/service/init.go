@@ -271,6 +271,7 @@ func (amf *AMF) Start() {
 		HandleNotification: ngap.HandleSCTPNotification,
 	}
 	ngap_service.Run(self.NgapIpList, 38412, ngapHandler)
+	ngap.StartOverloadControl()
 
 	// Register to NRF
 	var profile models.NfProfile
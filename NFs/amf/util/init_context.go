@@ -81,6 +81,58 @@ func InitAmfContext(context *context.AMFContext) {
 	context.T3550Cfg = configuration.T3550
 	context.T3560Cfg = configuration.T3560
 	context.T3565Cfg = configuration.T3565
+	if overloadControl := configuration.OverloadControl; overloadControl != nil {
+		context.OverloadControl.Cfg = *overloadControl
+		cfg := &context.OverloadControl.Cfg
+		if cfg.StopRatio <= 0 || cfg.StopRatio > 100 {
+			cfg.StopRatio = factory.AMF_DEFAULT_OVERLOAD_STOP_RATIO
+		}
+		if cfg.CheckInterval <= 0 {
+			cfg.CheckInterval = factory.AMF_DEFAULT_OVERLOAD_CHECK_INTERVAL
+		}
+		if cfg.TimeToWait <= 0 {
+			cfg.TimeToWait = factory.AMF_DEFAULT_OVERLOAD_TIME_TO_WAIT
+		}
+		if cfg.T3346Value <= 0 {
+			cfg.T3346Value = factory.AMF_DEFAULT_OVERLOAD_T3346_VALUE
+		}
+		if cfg.TrafficLoadReduction < 0 || cfg.TrafficLoadReduction > 99 {
+			logger.UtilLog.Warnf("Traffic load reduction %d%% out of range (1~99), not indicated",
+				cfg.TrafficLoadReduction)
+			cfg.TrafficLoadReduction = 0
+		}
+	}
+	if equipmentIdentityCheck := configuration.EquipmentIdentityCheck; equipmentIdentityCheck != nil {
+		context.EquipmentIdentityCheck = *equipmentIdentityCheck
+	}
+	if drx := configuration.Drx; drx != nil {
+		context.Drx = *drx
+	}
+	drxCfg := &context.Drx
+	if drxCfg.DefaultCycle != 0 && !isValidDrxCycle(drxCfg.DefaultCycle) {
+		logger.UtilLog.Warnf("Invalid default DRX cycle %d, use the default paging DRX of the NG-RAN", drxCfg.DefaultCycle)
+		drxCfg.DefaultCycle = 0
+	}
+	if !isValidDrxCycle(drxCfg.MinCycle) {
+		drxCfg.MinCycle = factory.AMF_DEFAULT_DRX_MIN_CYCLE
+	}
+	if !isValidDrxCycle(drxCfg.MaxCycle) || drxCfg.MaxCycle < drxCfg.MinCycle {
+		drxCfg.MaxCycle = factory.AMF_DEFAULT_DRX_MAX_CYCLE
+	}
+	if paging := configuration.Paging; paging != nil {
+		for _, step := range paging.Escalation {
+			switch step.Scope {
+			case factory.PagingScopeRecommendedRanNodes, factory.PagingScopeRegistrationArea:
+			default:
+				logger.UtilLog.Warnf("Unsupported paging scope %q is ignored", step.Scope)
+				continue
+			}
+			if step.Attempts <= 0 {
+				step.Attempts = 1
+			}
+			context.Paging.Escalation = append(context.Paging.Escalation, step)
+		}
+	}
 }
 
 func getIntAlgOrder(integrityOrder []string) (intOrder []uint8) {
@@ -118,3 +170,13 @@ func getEncAlgOrder(cipheringOrder []string) (encOrder []uint8) {
 	}
 	return
 }
+
+// isValidDrxCycle reports whether the cycle (in radio frames) can be a UE specific DRX (TS 38.304 7.1)
+func isValidDrxCycle(cycle int) bool {
+	switch cycle {
+	case 32, 64, 128, 256:
+		return true
+	default:
+		return false
+	}
+}
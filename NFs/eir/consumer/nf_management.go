@@ -0,0 +1,122 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	eir_context "github.com/free5gc/eir/context"
+	"github.com/free5gc/eir/factory"
+	"github.com/free5gc/eir/logger"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/Nnrf_NFManagement"
+	"github.com/free5gc/openapi/models"
+)
+
+func BuildNFInstance(context *eir_context.EIRContext) models.NfProfile {
+	var profile models.NfProfile
+	config := factory.EirConfig
+	profile.NfInstanceId = context.NfId
+	profile.NfType = models.NfType__5_G_EIR
+	profile.NfStatus = models.NfStatus_REGISTERED
+	profile.Ipv4Addresses = []string{context.RegisterIPv4}
+	version := config.Info.Version
+	tmpVersion := strings.Split(version, ".")
+	versionUri := "v" + tmpVersion[0]
+	apiPrefix := fmt.Sprintf("%s://%s:%d", context.UriScheme, context.RegisterIPv4, context.SBIPort)
+	services := []models.NfService{
+		{
+			ServiceInstanceId: "equipmentidentitycheck",
+			ServiceName:       models.ServiceName_N5G_EIR_EIC,
+			Versions: &[]models.NfServiceVersion{
+				{
+					ApiFullVersion:  version,
+					ApiVersionInUri: versionUri,
+				},
+			},
+			Scheme:          context.UriScheme,
+			NfServiceStatus: models.NfServiceStatus_REGISTERED,
+			ApiPrefix:       apiPrefix,
+			IpEndPoints: &[]models.IpEndPoint{
+				{
+					Ipv4Address: context.RegisterIPv4,
+					Transport:   models.TransportProtocol_TCP,
+					Port:        int32(context.SBIPort),
+				},
+			},
+		},
+	}
+	profile.NfServices = &services
+	return profile
+}
+
+func SendRegisterNFInstance(nrfUri, nfInstanceId string, profile models.NfProfile) (string, string, error) {
+	// Set client and set url
+	configuration := Nnrf_NFManagement.NewConfiguration()
+	configuration.SetBasePath(nrfUri)
+	client := Nnrf_NFManagement.NewAPIClient(configuration)
+	var resouceNrfUri string
+	var retrieveNfInstanceId string
+
+	for {
+		_, res, err := client.NFInstanceIDDocumentApi.RegisterNFInstance(context.TODO(), nfInstanceId, profile)
+		if err != nil || res == nil {
+			logger.ConsumerLog.Errorf("EIR register to NRF Error[%v]", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		defer func() {
+			if rspCloseErr := res.Body.Close(); rspCloseErr != nil {
+				logger.ConsumerLog.Errorf("RegisterNFInstance response body cannot close: %+v", rspCloseErr)
+			}
+		}()
+
+		status := res.StatusCode
+		if status == http.StatusOK {
+			// NFUpdate
+			return resouceNrfUri, retrieveNfInstanceId, err
+		} else if status == http.StatusCreated {
+			// NFRegister
+			resourceUri := res.Header.Get("Location")
+			resouceNrfUri = resourceUri[:strings.Index(resourceUri, "/nnrf-nfm/")]
+			retrieveNfInstanceId = resourceUri[strings.LastIndex(resourceUri, "/")+1:]
+			return resouceNrfUri, retrieveNfInstanceId, err
+		} else {
+			logger.ConsumerLog.Errorf("NRF return wrong status code %d", status)
+		}
+	}
+}
+
+func SendDeregisterNFInstance() (problemDetails *models.ProblemDetails, err error) {
+	logger.ConsumerLog.Infof("Send Deregister NFInstance")
+
+	eirSelf := eir_context.EIR_Self()
+	// Set client and set url
+	configuration := Nnrf_NFManagement.NewConfiguration()
+	configuration.SetBasePath(eirSelf.NrfUri)
+	client := Nnrf_NFManagement.NewAPIClient(configuration)
+
+	var res *http.Response
+
+	res, err = client.NFInstanceIDDocumentApi.DeregisterNFInstance(context.Background(), eirSelf.NfId)
+	if err == nil {
+		return
+	} else if res != nil {
+		defer func() {
+			if rspCloseErr := res.Body.Close(); rspCloseErr != nil {
+				logger.ConsumerLog.Errorf("DeregisterNFInstance response body cannot close: %+v", rspCloseErr)
+			}
+		}()
+
+		if res.Status != err.Error() {
+			return
+		}
+		problem := err.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		problemDetails = &problem
+	} else {
+		err = openapi.ReportError("server no response")
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package context
+
+import (
+	"fmt"
+
+	"github.com/free5gc/openapi/models"
+)
+
+var eirContext = EIRContext{}
+
+type EIRServiceType int
+
+const (
+	N5G_EIR_EIC EIRServiceType = iota
+)
+
+// EquipmentStatus of TS 29.511 6.1.6.3.3
+type EquipmentStatus string
+
+const (
+	EquipmentStatus_WHITELISTED EquipmentStatus = "WHITELISTED"
+	EquipmentStatus_BLACKLISTED EquipmentStatus = "BLACKLISTED"
+	EquipmentStatus_GREYLISTED  EquipmentStatus = "GREYLISTED"
+)
+
+func init() {
+	EIR_Self().Name = "eir"
+}
+
+type EIRContext struct {
+	Name         string
+	UriScheme    models.UriScheme
+	BindingIPv4  string
+	SBIPort      int
+	RegisterIPv4 string // IP register to NRF
+	NfId         string
+	NrfUri       string
+	// status of the equipments not provisioned, empty if they are unknown
+	DefaultStatus EquipmentStatus
+}
+
+func (context *EIRContext) GetIPv4Uri() string {
+	return fmt.Sprintf("%s://%s:%d", context.UriScheme, context.RegisterIPv4, context.SBIPort)
+}
+
+func (context *EIRContext) GetIPv4GroupUri(eirServiceType EIRServiceType) string {
+	var serviceUri string
+
+	switch eirServiceType {
+	case N5G_EIR_EIC:
+		serviceUri = "/n5g-eir-eic/v1"
+	default:
+		serviceUri = ""
+	}
+
+	return fmt.Sprintf("%s://%s:%d%s", context.UriScheme, context.RegisterIPv4, context.SBIPort, serviceUri)
+}
+
+// Create new EIR context
+func EIR_Self() *EIRContext {
+	return &eirContext
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/free5gc/eir/logger"
+	eir_service "github.com/free5gc/eir/service"
+	"github.com/free5gc/version"
+)
+
+var EIR = &eir_service.EIR{}
+
+var appLog *logrus.Entry
+
+func init() {
+	appLog = logger.AppLog
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "eir"
+	appLog.Infoln(app.Name)
+	appLog.Infoln("EIR version: ", version.GetVersion())
+	app.Usage = "-free5gccfg common configuration file -eircfg eir configuration file"
+	app.Action = action
+	app.Flags = EIR.GetCliCmd()
+	if err := app.Run(os.Args); err != nil {
+		appLog.Errorf("EIR Run error: %v", err)
+	}
+}
+
+func action(c *cli.Context) error {
+	if err := EIR.Initialize(c); err != nil {
+		logger.CfgLog.Errorf("%+v", err)
+		return fmt.Errorf("Failed to initialize !!")
+	}
+
+	EIR.Start()
+
+	return nil
+}
@@ -0,0 +1,41 @@
+/*
+ * N5g-eir_EquipmentIdentityCheck
+ *
+ * 5G-EIR Equipment Identity Check Service (TS 29.511)
+ *
+ * API version: 1.0.0
+ */
+
+package equipmentidentitycheck
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/eir/logger"
+	"github.com/free5gc/eir/producer"
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+)
+
+// HTTPGetEquipmentStatus - retrieves the status of the UE
+func HTTPGetEquipmentStatus(c *gin.Context) {
+	req := http_wrapper.NewRequest(c.Request, nil)
+
+	rsp := producer.HandleGetEquipmentStatus(req)
+
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.EicLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
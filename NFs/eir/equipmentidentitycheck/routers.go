@@ -0,0 +1,73 @@
+/*
+ * N5g-eir_EquipmentIdentityCheck
+ *
+ * 5G-EIR Equipment Identity Check Service (TS 29.511)
+ *
+ * API version: 1.0.0
+ */
+
+package equipmentidentitycheck
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/eir/logger"
+	"github.com/free5gc/logger_util"
+)
+
+// Route is the information for every URI.
+type Route struct {
+	// Name is the name of this Route.
+	Name string
+	// Method is the string for the HTTP method. ex) GET, POST etc..
+	Method string
+	// Pattern is the pattern of the URI.
+	Pattern string
+	// HandlerFunc is the handler function of this route.
+	HandlerFunc gin.HandlerFunc
+}
+
+// Routes is the list of the generated Route.
+type Routes []Route
+
+// NewRouter returns a new router.
+func NewRouter() *gin.Engine {
+	router := logger_util.NewGinWithLogrus(logger.GinLog)
+	AddService(router)
+	return router
+}
+
+func AddService(engine *gin.Engine) *gin.RouterGroup {
+	group := engine.Group("/n5g-eir-eic/v1")
+
+	for _, route := range routes {
+		switch route.Method {
+		case "GET":
+			group.GET(route.Pattern, route.HandlerFunc)
+		}
+	}
+	return group
+}
+
+// Index is the index handler.
+func Index(c *gin.Context) {
+	c.String(http.StatusOK, "Hello World!")
+}
+
+var routes = Routes{
+	{
+		"Index",
+		"GET",
+		"/",
+		Index,
+	},
+
+	{
+		"GetEquipmentStatus",
+		"GET",
+		"/equipment-status",
+		HTTPGetEquipmentStatus,
+	},
+}
@@ -0,0 +1,72 @@
+/*
+ * EIR Configuration Factory
+ */
+
+package factory
+
+import (
+	"github.com/free5gc/logger_util"
+)
+
+const (
+	EIR_EXPECTED_CONFIG_VERSION = "1.0.0"
+)
+
+type Config struct {
+	Info          *Info          `yaml:"info"`
+	Configuration *Configuration `yaml:"configuration"`
+	Logger        *Logger        `yaml:"logger"`
+}
+
+// Logger adds the EIR to the log settings of logger_util, which has no entry for it
+type Logger struct {
+	logger_util.Logger `yaml:",inline"`
+	EIR                *logger_util.LogSetting `yaml:"EIR"`
+}
+
+type Info struct {
+	Version     string `yaml:"version,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+const (
+	EIR_DEFAULT_IPV4     = "127.0.0.20"
+	EIR_DEFAULT_PORT     = "8000"
+	EIR_DEFAULT_PORT_INT = 8000
+)
+
+type Configuration struct {
+	Sbi     *Sbi     `yaml:"sbi"`
+	Mongodb *Mongodb `yaml:"mongodb"`
+	NrfUri  string   `yaml:"nrfUri"`
+	// status of the equipments which are not provisioned in MongoDB: WHITELISTED, BLACKLISTED or GREYLISTED,
+	// the equipments are unknown to the EIR if it is not set
+	DefaultStatus string `yaml:"defaultStatus,omitempty"`
+}
+
+type Sbi struct {
+	Scheme       string `yaml:"scheme"`
+	RegisterIPv4 string `yaml:"registerIPv4,omitempty"` // IP that is registered at NRF.
+	// IPv6Addr string `yaml:"ipv6Addr,omitempty"`
+	BindingIPv4 string `yaml:"bindingIPv4,omitempty"` // IP used to run the server in the node.
+	Port        int    `yaml:"port"`
+	Tls         *Tls   `yaml:"tls,omitempty"`
+}
+
+type Tls struct {
+	Log string `yaml:"log"`
+	Pem string `yaml:"pem"`
+	Key string `yaml:"key"`
+}
+
+type Mongodb struct {
+	Name string `yaml:"name"`
+	Url  string `yaml:"url"`
+}
+
+func (c *Config) GetVersion() string {
+	if c.Info != nil && c.Info.Version != "" {
+		return c.Info.Version
+	}
+	return ""
+}
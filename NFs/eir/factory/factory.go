@@ -0,0 +1,44 @@
+/*
+ * EIR Configuration Factory
+ */
+
+package factory
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/free5gc/eir/logger"
+)
+
+var EirConfig Config
+
+// TODO: Support configuration update from REST api
+func InitConfigFactory(f string) error {
+	if content, err := ioutil.ReadFile(f); err != nil {
+		return err
+	} else {
+		EirConfig = Config{}
+
+		if yamlErr := yaml.Unmarshal(content, &EirConfig); yamlErr != nil {
+			return yamlErr
+		}
+	}
+
+	return nil
+}
+
+func CheckConfigVersion() error {
+	currentVersion := EirConfig.GetVersion()
+
+	if currentVersion != EIR_EXPECTED_CONFIG_VERSION {
+		return fmt.Errorf("config version is [%s], but expected is [%s].",
+			currentVersion, EIR_EXPECTED_CONFIG_VERSION)
+	}
+
+	logger.CfgLog.Infof("config version [%s]", currentVersion)
+
+	return nil
+}
@@ -0,0 +1,21 @@
+module github.com/free5gc/eir
+
+go 1.14
+
+require (
+	github.com/antonfisher/nested-logrus-formatter v1.3.0
+	github.com/free5gc/MongoDBLibrary v1.0.0
+	github.com/free5gc/http2_util v1.0.0
+	github.com/free5gc/http_wrapper v1.0.0
+	github.com/free5gc/logger_conf v1.0.0
+	github.com/free5gc/logger_util v1.0.0
+	github.com/free5gc/openapi v1.0.0
+	github.com/free5gc/path_util v1.0.0
+	github.com/free5gc/version v1.0.0
+	github.com/gin-gonic/gin v1.6.3
+	github.com/google/uuid v1.1.2
+	github.com/sirupsen/logrus v1.7.0
+	github.com/urfave/cli v1.22.5
+	go.mongodb.org/mongo-driver v1.4.4
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,100 @@
+package producer
+
+import (
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/free5gc/MongoDBLibrary"
+	eir_context "github.com/free5gc/eir/context"
+	"github.com/free5gc/eir/logger"
+	"github.com/free5gc/eir/util"
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+)
+
+// equipment status documents: {"pei": "imei-...", "status": ...} for an equipment,
+// or {"tac": "<8 digits>", "status": ...} for all the equipments of a terminal model
+const equipmentStatusCollName = "eirData.equipmentStatus"
+
+// EirResponseData of TS 29.511 6.1.6.2.2
+type EirResponseData struct {
+	Status eir_context.EquipmentStatus `json:"status"`
+}
+
+func HandleGetEquipmentStatus(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.EicLog.Infof("Handle GetEquipmentStatus")
+
+	pei := request.Query.Get("pei")
+	supi := request.Query.Get("supi")
+	gpsi := request.Query.Get("gpsi")
+
+	response, problemDetails := GetEquipmentStatusProcedure(pei, supi, gpsi)
+	if problemDetails == nil {
+		return http_wrapper.NewResponse(http.StatusOK, nil, response)
+	} else {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+}
+
+// GetEquipmentStatusProcedure looks up the status of the equipment by its PEI first,
+// then by the TAC of its terminal model, and falls back to the default status
+func GetEquipmentStatusProcedure(pei, supi, gpsi string) (*EirResponseData, *models.ProblemDetails) {
+	if pei == "" {
+		return nil, util.ProblemDetailsMandatoryIeMissing("pei is missing")
+	}
+
+	status := lookupEquipmentStatus(bson.M{"pei": pei})
+	if status == "" {
+		if tac := PeiToTac(pei); tac != "" {
+			status = lookupEquipmentStatus(bson.M{"tac": tac})
+		}
+	}
+	if status == "" {
+		status = eir_context.EIR_Self().DefaultStatus
+	}
+	if status == "" {
+		logger.EicLog.Infof("PEI[%s] SUPI[%s] GPSI[%s] unknown", pei, supi, gpsi)
+		return nil, util.ProblemDetailsEquipmentUnknown(pei)
+	}
+
+	logger.EicLog.Infof("PEI[%s] SUPI[%s] GPSI[%s] is %s", pei, supi, gpsi, status)
+	return &EirResponseData{Status: status}, nil
+}
+
+func lookupEquipmentStatus(filter bson.M) eir_context.EquipmentStatus {
+	equipmentStatus := MongoDBLibrary.RestfulAPIGetOne(equipmentStatusCollName, filter)
+	if equipmentStatus == nil {
+		return ""
+	}
+	status, ok := equipmentStatus["status"].(string)
+	if !ok {
+		logger.EicLog.Warnf("Equipment status of %v is not a string", filter)
+		return ""
+	}
+	return eir_context.EquipmentStatus(status)
+}
+
+// PeiToTac returns the Type Allocation Code (the first 8 digits of the IMEI or IMEISV, TS 23.003 6.2)
+// which identifies the terminal model, or "" if the PEI is not an IMEI or IMEISV
+func PeiToTac(pei string) string {
+	var digits string
+	switch {
+	case strings.HasPrefix(pei, "imei-"):
+		digits = strings.TrimPrefix(pei, "imei-")
+	case strings.HasPrefix(pei, "imeisv-"):
+		digits = strings.TrimPrefix(pei, "imeisv-")
+	default:
+		return ""
+	}
+	if len(digits) < 8 {
+		return ""
+	}
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return ""
+		}
+	}
+	return digits[:8]
+}
@@ -0,0 +1,27 @@
+package producer_test
+
+import (
+	"testing"
+
+	"github.com/free5gc/eir/producer"
+)
+
+func TestPeiToTac(t *testing.T) {
+	testCases := []struct {
+		pei string
+		tac string
+	}{
+		{"imei-356938035643809", "35693803"},
+		{"imeisv-4370816125816151", "43708161"},
+		{"mac-00-00-5E-00-53-00", ""},
+		{"imei-3569380", ""},
+		{"imei-35693803564380a", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		if tac := producer.PeiToTac(tc.pei); tac != tc.tac {
+			t.Errorf("PeiToTac(%q) = %q, expected %q", tc.pei, tac, tc.tac)
+		}
+	}
+}
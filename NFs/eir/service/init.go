@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/free5gc/MongoDBLibrary"
+	mongoDBLibLogger "github.com/free5gc/MongoDBLibrary/logger"
+	"github.com/free5gc/eir/consumer"
+	eir_context "github.com/free5gc/eir/context"
+	"github.com/free5gc/eir/equipmentidentitycheck"
+	"github.com/free5gc/eir/factory"
+	"github.com/free5gc/eir/logger"
+	"github.com/free5gc/eir/util"
+	"github.com/free5gc/http2_util"
+	"github.com/free5gc/logger_util"
+	openApiLogger "github.com/free5gc/openapi/logger"
+	"github.com/free5gc/path_util"
+	pathUtilLogger "github.com/free5gc/path_util/logger"
+)
+
+type EIR struct{}
+
+type (
+	// Config information.
+	Config struct {
+		eircfg string
+	}
+)
+
+var config Config
+
+var eirCLi = []cli.Flag{
+	cli.StringFlag{
+		Name:  "free5gccfg",
+		Usage: "common config file",
+	},
+	cli.StringFlag{
+		Name:  "eircfg",
+		Usage: "config file",
+	},
+}
+
+var initLog *logrus.Entry
+
+func init() {
+	initLog = logger.InitLog
+}
+
+func (*EIR) GetCliCmd() (flags []cli.Flag) {
+	return eirCLi
+}
+
+func (eir *EIR) Initialize(c *cli.Context) error {
+	config = Config{
+		eircfg: c.String("eircfg"),
+	}
+
+	if config.eircfg != "" {
+		if err := factory.InitConfigFactory(config.eircfg); err != nil {
+			return err
+		}
+	} else {
+		DefaultEirConfigPath := path_util.Free5gcPath("free5gc/config/eircfg.yaml")
+		if err := factory.InitConfigFactory(DefaultEirConfigPath); err != nil {
+			return err
+		}
+	}
+
+	eir.setLogLevel()
+
+	if err := factory.CheckConfigVersion(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (eir *EIR) setLogLevel() {
+	if factory.EirConfig.Logger == nil {
+		initLog.Warnln("EIR config without log level setting!!!")
+		return
+	}
+
+	if factory.EirConfig.Logger.EIR != nil {
+		if factory.EirConfig.Logger.EIR.DebugLevel != "" {
+			if level, err := logrus.ParseLevel(factory.EirConfig.Logger.EIR.DebugLevel); err != nil {
+				initLog.Warnf("EIR Log level [%s] is invalid, set to [info] level",
+					factory.EirConfig.Logger.EIR.DebugLevel)
+				logger.SetLogLevel(logrus.InfoLevel)
+			} else {
+				initLog.Infof("EIR Log level is set to [%s] level", level)
+				logger.SetLogLevel(level)
+			}
+		} else {
+			initLog.Infoln("EIR Log level not set. Default set to [info] level")
+			logger.SetLogLevel(logrus.InfoLevel)
+		}
+		logger.SetReportCaller(factory.EirConfig.Logger.EIR.ReportCaller)
+	}
+
+	if factory.EirConfig.Logger.PathUtil != nil {
+		if factory.EirConfig.Logger.PathUtil.DebugLevel != "" {
+			if level, err := logrus.ParseLevel(factory.EirConfig.Logger.PathUtil.DebugLevel); err != nil {
+				pathUtilLogger.PathLog.Warnf("PathUtil Log level [%s] is invalid, set to [info] level",
+					factory.EirConfig.Logger.PathUtil.DebugLevel)
+				pathUtilLogger.SetLogLevel(logrus.InfoLevel)
+			} else {
+				pathUtilLogger.SetLogLevel(level)
+			}
+		} else {
+			pathUtilLogger.PathLog.Warnln("PathUtil Log level not set. Default set to [info] level")
+			pathUtilLogger.SetLogLevel(logrus.InfoLevel)
+		}
+		pathUtilLogger.SetReportCaller(factory.EirConfig.Logger.PathUtil.ReportCaller)
+	}
+
+	if factory.EirConfig.Logger.OpenApi != nil {
+		if factory.EirConfig.Logger.OpenApi.DebugLevel != "" {
+			if level, err := logrus.ParseLevel(factory.EirConfig.Logger.OpenApi.DebugLevel); err != nil {
+				openApiLogger.OpenApiLog.Warnf("OpenAPI Log level [%s] is invalid, set to [info] level",
+					factory.EirConfig.Logger.OpenApi.DebugLevel)
+				openApiLogger.SetLogLevel(logrus.InfoLevel)
+			} else {
+				openApiLogger.SetLogLevel(level)
+			}
+		} else {
+			openApiLogger.OpenApiLog.Warnln("OpenAPI Log level not set. Default set to [info] level")
+			openApiLogger.SetLogLevel(logrus.InfoLevel)
+		}
+		openApiLogger.SetReportCaller(factory.EirConfig.Logger.OpenApi.ReportCaller)
+	}
+
+	if factory.EirConfig.Logger.MongoDBLibrary != nil {
+		if factory.EirConfig.Logger.MongoDBLibrary.DebugLevel != "" {
+			if level, err := logrus.ParseLevel(factory.EirConfig.Logger.MongoDBLibrary.DebugLevel); err != nil {
+				mongoDBLibLogger.MongoDBLog.Warnf("MongoDBLibrary Log level [%s] is invalid, set to [info] level",
+					factory.EirConfig.Logger.MongoDBLibrary.DebugLevel)
+				mongoDBLibLogger.SetLogLevel(logrus.InfoLevel)
+			} else {
+				mongoDBLibLogger.SetLogLevel(level)
+			}
+		} else {
+			mongoDBLibLogger.MongoDBLog.Warnln("MongoDBLibrary Log level not set. Default set to [info] level")
+			mongoDBLibLogger.SetLogLevel(logrus.InfoLevel)
+		}
+		mongoDBLibLogger.SetReportCaller(factory.EirConfig.Logger.MongoDBLibrary.ReportCaller)
+	}
+}
+
+func (eir *EIR) FilterCli(c *cli.Context) (args []string) {
+	for _, flag := range eir.GetCliCmd() {
+		name := flag.GetName()
+		value := fmt.Sprint(c.Generic(name))
+		if value == "" {
+			continue
+		}
+
+		args = append(args, "--"+name, value)
+	}
+	return args
+}
+
+func (eir *EIR) Start() {
+	// get config file info
+	config := factory.EirConfig
+	mongodb := config.Configuration.Mongodb
+
+	initLog.Infof("EIR Config Info: Version[%s] Description[%s]", config.Info.Version, config.Info.Description)
+
+	// Connect to MongoDB
+	MongoDBLibrary.SetMongoDB(mongodb.Name, mongodb.Url)
+
+	initLog.Infoln("Server started")
+
+	router := logger_util.NewGinWithLogrus(logger.GinLog)
+
+	equipmentidentitycheck.AddService(router)
+
+	eirLogPath := util.EirLogPath
+	eirPemPath := util.EirPemPath
+	eirKeyPath := util.EirKeyPath
+
+	self := eir_context.EIR_Self()
+	util.InitEirContext(self)
+
+	addr := fmt.Sprintf("%s:%d", self.BindingIPv4, self.SBIPort)
+	profile := consumer.BuildNFInstance(self)
+	var newNrfUri string
+	var err error
+	newNrfUri, self.NfId, err = consumer.SendRegisterNFInstance(self.NrfUri, profile.NfInstanceId, profile)
+	if err == nil {
+		self.NrfUri = newNrfUri
+	} else {
+		initLog.Errorf("Send Register NFInstance Error[%s]", err.Error())
+	}
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalChannel
+		eir.Terminate()
+		os.Exit(0)
+	}()
+
+	server, err := http2_util.NewServer(addr, eirLogPath, router)
+	if server == nil {
+		initLog.Errorf("Initialize HTTP server failed: %+v", err)
+		return
+	}
+
+	if err != nil {
+		initLog.Warnf("Initialize HTTP server: %+v", err)
+	}
+
+	serverScheme := factory.EirConfig.Configuration.Sbi.Scheme
+	if serverScheme == "http" {
+		err = server.ListenAndServe()
+	} else if serverScheme == "https" {
+		err = server.ListenAndServeTLS(eirPemPath, eirKeyPath)
+	}
+
+	if err != nil {
+		initLog.Fatalf("HTTP server setup failed: %+v", err)
+	}
+}
+
+func (eir *EIR) Exec(c *cli.Context) error {
+	// EIR.Initialize(cfgPath, c)
+
+	initLog.Traceln("args:", c.String("eircfg"))
+	args := eir.FilterCli(c)
+	initLog.Traceln("filter: ", args)
+	command := exec.Command("./eir", args...)
+
+	if err := eir.Initialize(c); err != nil {
+		return err
+	}
+
+	var stdout io.ReadCloser
+	if readCloser, err := command.StdoutPipe(); err != nil {
+		initLog.Fatalln(err)
+	} else {
+		stdout = readCloser
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+	go func() {
+		in := bufio.NewScanner(stdout)
+		for in.Scan() {
+			fmt.Println(in.Text())
+		}
+		wg.Done()
+	}()
+
+	var stderr io.ReadCloser
+	if readCloser, err := command.StderrPipe(); err != nil {
+		initLog.Fatalln(err)
+	} else {
+		stderr = readCloser
+	}
+	go func() {
+		in := bufio.NewScanner(stderr)
+		for in.Scan() {
+			fmt.Println(in.Text())
+		}
+		wg.Done()
+	}()
+
+	var err error
+	go func() {
+		if errormessage := command.Start(); err != nil {
+			fmt.Println("command.Start Fails!")
+			err = errormessage
+		}
+		wg.Done()
+	}()
+
+	wg.Wait()
+	return err
+}
+
+func (eir *EIR) Terminate() {
+	logger.InitLog.Infof("Terminating EIR...")
+	// deregister with NRF
+	problemDetails, err := consumer.SendDeregisterNFInstance()
+	if problemDetails != nil {
+		logger.InitLog.Errorf("Deregister NF instance Failed Problem[%+v]", problemDetails)
+	} else if err != nil {
+		logger.InitLog.Errorf("Deregister NF instance Error[%+v]", err)
+	} else {
+		logger.InitLog.Infof("Deregister from NRF successfully")
+	}
+	logger.InitLog.Infof("EIR terminated")
+}
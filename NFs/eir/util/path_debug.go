@@ -0,0 +1,14 @@
+//+build debug
+
+package util
+
+import (
+	"github.com/free5gc/path_util"
+)
+
+var (
+	EirLogPath           = path_util.Free5gcPath("free5gc/eirsslkey.log")
+	EirPemPath           = path_util.Free5gcPath("free5gc/support/TLS/_debug.pem")
+	EirKeyPath           = path_util.Free5gcPath("free5gc/support/TLS/_debug.key")
+	DefaultEirConfigPath = path_util.Free5gcPath("free5gc/config/eircfg.yaml")
+)
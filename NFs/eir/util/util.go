@@ -0,0 +1,25 @@
+package util
+
+import (
+	"net/http"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func ProblemDetailsMandatoryIeMissing(detail string) *models.ProblemDetails {
+	return &models.ProblemDetails{
+		Title:  "Mandatory IE missing",
+		Status: http.StatusBadRequest,
+		Detail: detail,
+		Cause:  "MANDATORY_IE_MISSING",
+	}
+}
+
+func ProblemDetailsEquipmentUnknown(detail string) *models.ProblemDetails {
+	return &models.ProblemDetails{
+		Title:  "Equipment unknown",
+		Status: http.StatusNotFound,
+		Detail: detail,
+		Cause:  "ERROR_EQUIPMENT_UNKNOWN",
+	}
+}
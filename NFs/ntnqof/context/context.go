@@ -3,6 +3,7 @@ package context
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/google/uuid"
 
@@ -29,6 +30,10 @@ type NTNContext struct {
 	Slice       []*factory.Slice
 	Classifiers *factory.Classifiers
 	SliceAware  bool
+	// control planes acknowledged by the admission control, keyed by RAN-CN
+	ControlPlanes sync.Map
+	// usage reported per satellite slice, keyed by slice ID
+	SliceUsage sync.Map
 
 	URIScheme    models.UriScheme
 	BindingIPv4  string
@@ -67,6 +72,14 @@ func InitQofContext(config *factory.Config) {
 	ntnContext.QoS = configuration.QoS
 	ntnContext.Classifiers = configuration.Classifiers
 	ntnContext.SliceAware = configuration.SliceAware
+	ntnContext.ControlPlanes.Range(func(key, value interface{}) bool {
+		ntnContext.ControlPlanes.Delete(key)
+		return true
+	})
+	ntnContext.SliceUsage.Range(func(key, value interface{}) bool {
+		ntnContext.SliceUsage.Delete(key)
+		return true
+	})
 
 	sbi := configuration.Sbi
 	if sbi == nil {
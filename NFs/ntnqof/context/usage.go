@@ -0,0 +1,54 @@
+package context
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/shynuu/ntn-qof/factory"
+)
+
+// SliceUsage is the usage of a satellite slice, with its forward and return capacity for audit
+type SliceUsage struct {
+	SliceID        uint8  `json:"slice_id"`
+	Forward        int    `json:"forward"`
+	Return         int    `json:"return"`
+	UplinkVolume   uint64 `json:"uplink_volume"`
+	DownlinkVolume uint64 `json:"downlink_volume"`
+	TotalVolume    uint64 `json:"total_volume"`
+	Duration       uint64 `json:"duration"`
+	Reports        uint64 `json:"reports"`
+}
+
+type sliceUsage struct {
+	mu    sync.Mutex
+	usage SliceUsage
+}
+
+// AddSliceUsage accounts a usage report to the satellite slice
+func (c *NTNContext) AddSliceUsage(slice *factory.Slice, uplink, downlink, total uint64, duration uint32) {
+	value, _ := c.SliceUsage.LoadOrStore(slice.SliceID, &sliceUsage{
+		usage: SliceUsage{SliceID: slice.SliceID, Forward: slice.Forward, Return: slice.Return},
+	})
+	s := value.(*sliceUsage)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.UplinkVolume += uplink
+	s.usage.DownlinkVolume += downlink
+	s.usage.TotalVolume += total
+	s.usage.Duration += uint64(duration)
+	s.usage.Reports++
+}
+
+// GetSliceUsages returns the usage accumulated per satellite slice
+func (c *NTNContext) GetSliceUsages() []SliceUsage {
+	usages := make([]SliceUsage, 0)
+	c.SliceUsage.Range(func(key, value interface{}) bool {
+		s := value.(*sliceUsage)
+		s.mu.Lock()
+		usages = append(usages, s.usage)
+		s.mu.Unlock()
+		return true
+	})
+	sort.Slice(usages, func(i, j int) bool { return usages[i].SliceID < usages[j].SliceID })
+	return usages
+}
@@ -24,8 +24,11 @@ require (
 	github.com/google/uuid v1.1.2
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
 	github.com/pkg/errors v0.9.1
+	github.com/shynuu/qof v1.0.0
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.6.1
 	github.com/urfave/cli v1.22.4
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+replace github.com/shynuu/qof => ../qof
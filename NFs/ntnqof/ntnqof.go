@@ -9,6 +9,7 @@ import (
 
 	"github.com/free5gc/version"
 	"github.com/shynuu/ntn-qof/logger"
+	"github.com/shynuu/ntn-qof/plan"
 	"github.com/shynuu/ntn-qof/service"
 )
 
@@ -28,6 +29,19 @@ func main() {
 	app.Usage = "-ntncfg ntn configuration file"
 	app.Action = action
 	app.Flags = NTN.GetCliCmd()
+	app.Commands = []cli.Command{
+		{
+			Name:  "plan",
+			Usage: "replay a session trace offline and report the satellite slices dimensioning",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "ntncfg", Usage: "ntn config file"},
+				cli.StringFlag{Name: "qofcfg", Usage: "qof config file, S-NSSAI and 5QI translation"},
+				cli.StringFlag{Name: "trace", Usage: "session trace (csv: " + plan.TraceHeader + ")"},
+				cli.BoolFlag{Name: "json", Usage: "json report"},
+			},
+			Action: planAction,
+		},
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		appLog.Errorf("NTN Run error: %v", err)
@@ -44,3 +58,12 @@ func action(c *cli.Context) error {
 
 	return nil
 }
+
+func planAction(c *cli.Context) error {
+	for _, flag := range []string{"ntncfg", "qofcfg", "trace"} {
+		if c.String(flag) == "" {
+			return fmt.Errorf("plan requires -%s", flag)
+		}
+	}
+	return plan.Run(c.String("ntncfg"), c.String("qofcfg"), c.String("trace"), c.Bool("json"), os.Stdout)
+}
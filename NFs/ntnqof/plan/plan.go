@@ -0,0 +1,283 @@
+package plan
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/shynuu/ntn-qof/context"
+	"github.com/shynuu/ntn-qof/factory"
+	"github.com/shynuu/ntn-qof/producer"
+	qofcontext "github.com/shynuu/qof/context"
+	qoffactory "github.com/shynuu/qof/factory"
+	qofproducer "github.com/shynuu/qof/producer"
+)
+
+// SliceReport is the outcome of the trace on a satellite slice
+type SliceReport struct {
+	SliceID uint8 `json:"id"`
+	// admission control throughput of the forward (CN) and return (RAN) links
+	Forward  int `json:"forward"`
+	Return   int `json:"return"`
+	Admitted int `json:"admitted"`
+	// time weighted mean and peak of the admitted GBR over the link throughput, a peak above 1
+	// means the classifier shapes more GBR than the link carries
+	ForwardUtilization float64 `json:"forward_utilization"`
+	ForwardPeak        float64 `json:"forward_peak"`
+	ReturnUtilization  float64 `json:"return_utilization"`
+	ReturnPeak         float64 `json:"return_peak"`
+	// admitted sessions per satellite DSCP
+	DSCP map[uint8]int `json:"dscp"`
+
+	load     [2]float64
+	integral [2]float64
+	last     float64
+}
+
+// Report is the outcome of the trace on the satellite backhaul
+type Report struct {
+	Sessions int `json:"sessions"`
+	Admitted int `json:"admitted"`
+	// sessions refused by the NTN QOF admission
+	Blocked int `json:"blocked"`
+	// sessions whose S-NSSAI has no QOF translation
+	Rejected            int            `json:"rejected"`
+	BlockingProbability float64        `json:"blocking_probability"`
+	Duration            float64        `json:"duration"`
+	Slices              []*SliceReport `json:"slices"`
+}
+
+const (
+	forward = iota
+	back
+)
+
+type departure struct {
+	time    float64
+	slice   *SliceReport
+	session *Session
+}
+
+type departures []*departure
+
+func (d departures) Len() int            { return len(d) }
+func (d departures) Less(i, j int) bool  { return d[i].time < d[j].time }
+func (d departures) Swap(i, j int)       { d[i], d[j] = d[j], d[i] }
+func (d *departures) Push(x interface{}) { *d = append(*d, x.(*departure)) }
+func (d *departures) Pop() interface{} {
+	old := *d
+	n := len(old)
+	x := old[n-1]
+	*d = old[:n-1]
+	return x
+}
+
+// advance accumulates the load of the slice up to t
+func (s *SliceReport) advance(t float64) {
+	for link := range s.load {
+		s.integral[link] += s.load[link] * (t - s.last)
+	}
+	s.last = t
+}
+
+func (s *SliceReport) throughput(link int) float64 {
+	if link == forward {
+		return float64(s.Forward)
+	}
+	return float64(s.Return)
+}
+
+// admit adds the GBR of session to the load of the slice, the forward link carries the downlink
+// and the return link the uplink
+func (s *SliceReport) admit(session *Session) {
+	s.load[forward] += session.GbrDl
+	s.load[back] += session.GbrUl
+}
+
+func (s *SliceReport) release(session *Session) {
+	s.load[forward] -= session.GbrDl
+	s.load[back] -= session.GbrUl
+}
+
+// translate returns the 5G session the QOF creates on the NTN QOF for session
+func translate(session *Session) (*producer.MobileSession, error) {
+	_, _, sliceID, err := qofproducer.TranslateSnssai(&models.Snssai{Sst: session.Snssai.Sst, Sd: session.Snssai.Sd})
+	if err != nil {
+		return nil, fmt.Errorf("S-NSSAI %s: %+v", session.Snssai, err)
+	}
+	return &producer.MobileSession{
+		SliceID:    sliceID,
+		SliceMatch: &producer.SliceMatch{},
+		QosMatch:   &producer.QosMatch{DSCP: uint8(qofproducer.Translate5QI(session.Var5QI))},
+	}, nil
+}
+
+// Simulate replays the sessions through the translation of the QOF context and the admission of the
+// NTN QOF context. The GBR of the admitted sessions is accounted against the admission control
+// throughput of their slice.
+func Simulate(sessions []*Session) *Report {
+	admCN, admRAN := producer.BuildADM()
+	slices := make(map[uint8]*SliceReport)
+	report := &Report{Slices: make([]*SliceReport, 0, len(admCN.Controls))}
+	for k, control := range admCN.Controls {
+		slice := &SliceReport{
+			SliceID: control.SliceID,
+			Forward: control.Throughput,
+			Return:  admRAN.Controls[k].Throughput,
+			DSCP:    make(map[uint8]int),
+		}
+		slices[slice.SliceID] = slice
+		report.Slices = append(report.Slices, slice)
+	}
+
+	sorted := make([]*Session, len(sessions))
+	copy(sorted, sessions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Arrival < sorted[j].Arrival })
+
+	start := 0.0
+	if len(sorted) > 0 {
+		start = sorted[0].Arrival
+	}
+	for _, slice := range slices {
+		slice.last = start
+	}
+	end := start
+
+	active := &departures{}
+	release := func(until float64) {
+		for active.Len() > 0 && (*active)[0].time <= until {
+			d := heap.Pop(active).(*departure)
+			d.slice.advance(d.time)
+			d.slice.release(d.session)
+		}
+	}
+
+	for _, session := range sorted {
+		release(session.Arrival)
+		report.Sessions++
+
+		mobileSession, err := translate(session)
+		if err != nil {
+			report.Rejected++
+			continue
+		}
+		ntnSlice, dscp, err := producer.AdmitSession(mobileSession)
+		if err != nil {
+			report.Blocked++
+			continue
+		}
+		slice := slices[ntnSlice.SliceID]
+		slice.advance(session.Arrival)
+		slice.admit(session)
+		slice.Admitted++
+		report.Admitted++
+		slice.DSCP[dscp]++
+		slice.ForwardPeak = maxFloat(slice.ForwardPeak, ratio(slice.load[forward], slice.throughput(forward)))
+		slice.ReturnPeak = maxFloat(slice.ReturnPeak, ratio(slice.load[back], slice.throughput(back)))
+
+		leave := session.Arrival + session.Duration
+		end = maxFloat(end, leave)
+		heap.Push(active, &departure{time: leave, slice: slice, session: session})
+	}
+	release(end)
+
+	report.Duration = end - start
+	report.BlockingProbability = ratio(float64(report.Blocked), float64(report.Sessions))
+	for _, slice := range report.Slices {
+		slice.advance(end)
+		slice.ForwardUtilization = ratio(slice.integral[forward], report.Duration*slice.throughput(forward))
+		slice.ReturnUtilization = ratio(slice.integral[back], report.Duration*slice.throughput(back))
+	}
+	return report
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Print writes the report as a table
+func (r *Report) Print(out io.Writer) error {
+	fmt.Fprintf(out, "sessions: %d admitted: %d blocked: %d rejected: %d blocking probability: %.2f%% duration: %.1fs\n\n",
+		r.Sessions, r.Admitted, r.Blocked, r.Rejected, 100*r.BlockingProbability, r.Duration)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLICE\tFORWARD\tRETURN\tADMITTED\tFWD UTIL\tFWD PEAK\tRET UTIL\tRET PEAK\tDSCP MIX")
+	for _, s := range r.Slices {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.2f%%\t%.2f%%\t%.2f%%\t%.2f%%\t%s\n",
+			s.SliceID, s.Forward, s.Return, s.Admitted, 100*s.ForwardUtilization, 100*s.ForwardPeak,
+			100*s.ReturnUtilization, 100*s.ReturnPeak, dscpMix(s.DSCP, s.Admitted))
+	}
+	return w.Flush()
+}
+
+func dscpMix(dscp map[uint8]int, admitted int) string {
+	keys := make([]int, 0, len(dscp))
+	for k := range dscp {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	mix := make([]string, 0, len(keys))
+	for _, k := range keys {
+		mix = append(mix, fmt.Sprintf("0x%02x:%.0f%%", k, 100*ratio(float64(dscp[uint8(k)]), float64(admitted))))
+	}
+	if len(mix) == 0 {
+		return "-"
+	}
+	return strings.Join(mix, " ")
+}
+
+// Run loads the NTN QOF and QOF configurations, replays the trace and writes the report to out
+func Run(ntncfg, qofcfg, trace string, asJSON bool, out io.Writer) error {
+	if err := factory.InitConfigFactory(ntncfg); err != nil {
+		return err
+	}
+	if err := factory.CheckConfigVersion(); err != nil {
+		return err
+	}
+	context.InitQofContext(&factory.QofConfig)
+
+	if err := qoffactory.InitConfigFactory(qofcfg); err != nil {
+		return fmt.Errorf("QOF config %s: %+v", qofcfg, err)
+	}
+	if err := qoffactory.CheckConfigVersion(); err != nil {
+		return err
+	}
+	if qoffactory.QofConfig.Configuration == nil {
+		return fmt.Errorf("QOF config %s needs \"configuration\" value", qofcfg)
+	}
+	qofcontext.InitQofContext(&qoffactory.QofConfig)
+
+	file, err := os.Open(trace)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	sessions, err := ReadTrace(file)
+	if err != nil {
+		return fmt.Errorf("trace %s: %+v", trace, err)
+	}
+
+	report := Simulate(sessions)
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.Print(out)
+}
@@ -0,0 +1,113 @@
+package plan_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/shynuu/ntn-qof/context"
+	"github.com/shynuu/ntn-qof/factory"
+	"github.com/shynuu/ntn-qof/plan"
+	qofcontext "github.com/shynuu/qof/context"
+	qoffactory "github.com/shynuu/qof/factory"
+)
+
+func initContext() {
+	context.InitQofContext(&factory.Config{
+		Info: &factory.Info{Version: "1.0.0"},
+		Configuration: &factory.Configuration{
+			QoS: map[uint8]uint8{0x12: 0x0a, 0x11: 0x2e},
+			Slice: []*factory.Slice{
+				{SliceID: 1, ClassifierRANEndpoint: "10.0.1.1", ClassifierCNEndpoint: "10.0.2.1", Forward: 20, Return: 10},
+				{SliceID: 2, ClassifierRANEndpoint: "10.0.1.2", ClassifierCNEndpoint: "10.0.2.2", Forward: 40, Return: 20},
+			},
+			Classifiers: &factory.Classifiers{},
+		},
+	})
+}
+
+func initQofContext() {
+	qofcontext.InitQofContext(&qoffactory.Config{
+		Info: &qoffactory.Info{Version: qoffactory.QOF_EXPECTED_CONFIG_VERSION},
+		Configuration: &qoffactory.Configuration{
+			Sbi: &qoffactory.Sbi{Scheme: "http", RegisterIPv4: "127.0.0.1", BindingIPv4: "127.0.0.1", Port: 8090},
+			QoS: map[int32]uint16{9: 0x12, 3: 0x11},
+			Slice: []*qoffactory.Slice{
+				{SNssai: &models.Snssai{Sst: 1, Sd: "010203"}, ID: "1"},
+				{SNssai: &models.Snssai{Sst: 1, Sd: "112233"}, ID: "2"},
+				{SNssai: &models.Snssai{Sst: 2, Sd: "000001"}, ID: "9"},
+			},
+		},
+	})
+}
+
+func TestReadTrace(t *testing.T) {
+	sessions, err := plan.ReadTrace(strings.NewReader(`# comment
+arrival,duration,sst,sd,5qi,gbr_ul,gbr_dl
+0,10,1,010203,9,0,0
+1.5, 20, 1, 112233, 3, 5, 10
+`))
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, &plan.Session{Arrival: 1.5, Duration: 20, Snssai: plan.Snssai{Sst: 1, Sd: "112233"},
+		Var5QI: 3, GbrUl: 5, GbrDl: 10}, sessions[1])
+	require.False(t, sessions[0].IsGBR())
+
+	_, err = plan.ReadTrace(strings.NewReader("arrival,duration,sst,sd,qci,gbr_ul,gbr_dl\n"))
+	require.Error(t, err)
+	_, err = plan.ReadTrace(strings.NewReader("arrival,duration,sst,sd,5qi,gbr_ul,gbr_dl\n0,-1,1,010203,9,0,0\n"))
+	require.Error(t, err)
+}
+
+func TestSimulate(t *testing.T) {
+	initContext()
+	initQofContext()
+
+	sessions := []*plan.Session{
+		// slice 1 return link of 10 is overbooked by the GBR sessions between 4 s and 12 s
+		{Arrival: 0, Duration: 10, Snssai: plan.Snssai{Sst: 1, Sd: "010203"}, Var5QI: 3, GbrUl: 5, GbrDl: 5},
+		{Arrival: 2, Duration: 10, Snssai: plan.Snssai{Sst: 1, Sd: "010203"}, Var5QI: 3, GbrUl: 5, GbrDl: 5},
+		{Arrival: 4, Duration: 10, Snssai: plan.Snssai{Sst: 1, Sd: "010203"}, Var5QI: 3, GbrUl: 5, GbrDl: 5},
+		{Arrival: 5, Duration: 5, Snssai: plan.Snssai{Sst: 1, Sd: "010203"}, Var5QI: 9},
+		// the first session has left
+		{Arrival: 10, Duration: 10, Snssai: plan.Snssai{Sst: 1, Sd: "010203"}, Var5QI: 3, GbrUl: 5, GbrDl: 5},
+		{Arrival: 0, Duration: 20, Snssai: plan.Snssai{Sst: 1, Sd: "112233"}, Var5QI: 9, GbrDl: 20},
+		// no QOF translation, and a slice ID the NTN QOF refuses
+		{Arrival: 1, Duration: 1, Snssai: plan.Snssai{Sst: 3, Sd: "000001"}, Var5QI: 9},
+		{Arrival: 1, Duration: 1, Snssai: plan.Snssai{Sst: 2, Sd: "000001"}, Var5QI: 9},
+	}
+
+	report := plan.Simulate(sessions)
+	require.Equal(t, 8, report.Sessions)
+	require.Equal(t, 6, report.Admitted)
+	require.Equal(t, 1, report.Blocked)
+	require.Equal(t, 1, report.Rejected)
+	require.Equal(t, 20.0, report.Duration)
+	require.InDelta(t, 1.0/8, report.BlockingProbability, 1e-9)
+
+	require.Len(t, report.Slices, 2)
+	slice1 := report.Slices[0]
+	require.Equal(t, uint8(1), slice1.SliceID)
+	require.Equal(t, 5, slice1.Admitted)
+	require.Equal(t, 1.5, slice1.ReturnPeak)
+	require.Equal(t, 0.75, slice1.ForwardPeak)
+	// 5, 10, 15, 15, 10 and 5 over [0,2), [2,4), [4,10), [10,12), [12,14) and [14,20) on a return link of 10
+	require.InDelta(t, (5*2+10*2+15*6+15*2+10*2+5*6)/(10*20.0), slice1.ReturnUtilization, 1e-9)
+	require.Equal(t, map[uint8]int{0x2e: 4, 0x0a: 1}, slice1.DSCP)
+
+	slice2 := report.Slices[1]
+	require.Equal(t, 1, slice2.Admitted)
+	require.InDelta(t, 0.5, slice2.ForwardUtilization, 1e-9)
+	require.Equal(t, map[uint8]int{0x0a: 1}, slice2.DSCP)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Print(&out))
+	require.Contains(t, out.String(), "blocking probability: 12.50%")
+	require.Contains(t, out.String(), "0x0a:20% 0x2e:80%")
+	_, err := json.Marshal(report)
+	require.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+package plan
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TraceHeader is the header of a session trace, one PDU session per line.
+// arrival and duration are in seconds, gbr_ul and gbr_dl are in the unit of the
+// slice forward and return throughput, 0 for a non GBR session.
+const TraceHeader = "arrival,duration,sst,sd,5qi,gbr_ul,gbr_dl"
+
+var traceHeader = strings.Split(TraceHeader, ",")
+
+// Snssai identifies the 5G slice of a session
+type Snssai struct {
+	Sst int32  `yaml:"sst"`
+	Sd  string `yaml:"sd"`
+}
+
+func (s Snssai) String() string {
+	return fmt.Sprintf("%d-%s", s.Sst, s.Sd)
+}
+
+// Session is a PDU session of the trace
+type Session struct {
+	Arrival  float64
+	Duration float64
+	Snssai   Snssai
+	Var5QI   int32
+	GbrUl    float64
+	GbrDl    float64
+}
+
+// IsGBR returns true when the session requests a guaranteed bit rate
+func (s *Session) IsGBR() bool {
+	return s.GbrUl > 0 || s.GbrDl > 0
+}
+
+// ReadTrace reads a CSV session trace, lines starting with # are ignored
+func ReadTrace(r io.Reader) ([]*Session, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = len(traceHeader)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("trace header: %+v", err)
+	}
+	for i, field := range traceHeader {
+		if strings.ToLower(header[i]) != field {
+			return nil, fmt.Errorf("trace header column %d is %s, expected %s", i+1, header[i], field)
+		}
+	}
+
+	sessions := make([]*Session, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		session, err := parseSession(record)
+		if err != nil {
+			return nil, fmt.Errorf("trace line %d: %+v", line, err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func parseSession(record []string) (*Session, error) {
+	var (
+		session Session
+		err     error
+	)
+	if session.Arrival, err = strconv.ParseFloat(record[0], 64); err != nil || session.Arrival < 0 {
+		return nil, fmt.Errorf("invalid arrival %s", record[0])
+	}
+	if session.Duration, err = strconv.ParseFloat(record[1], 64); err != nil || session.Duration < 0 {
+		return nil, fmt.Errorf("invalid duration %s", record[1])
+	}
+	sst, err := strconv.ParseInt(record[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sst %s", record[2])
+	}
+	session.Snssai = Snssai{Sst: int32(sst), Sd: record[3]}
+	var5qi, err := strconv.ParseInt(record[4], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 5qi %s", record[4])
+	}
+	session.Var5QI = int32(var5qi)
+	if session.GbrUl, err = strconv.ParseFloat(record[5], 64); err != nil || session.GbrUl < 0 {
+		return nil, fmt.Errorf("invalid gbr_ul %s", record[5])
+	}
+	if session.GbrDl, err = strconv.ParseFloat(record[6], 64); err != nil || session.GbrDl < 0 {
+		return nil, fmt.Errorf("invalid gbr_dl %s", record[6])
+	}
+	return &session, nil
+}
@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shynuu/ntn-qof/context"
@@ -71,6 +73,23 @@ type ADM struct {
 	Aware    bool         `json:"slice_aware" yaml:"slice_aware" bson:"slice_aware"`
 }
 
+// Status is the NTN QOF status polled by the QOF to detect restarts
+type Status struct {
+	NfInstanceID  string                  `json:"nf_instance_id"`
+	ControlPlanes []*factory.ControlPlane `json:"control_planes"`
+}
+
+// UsageReport is the usage of a satellite slice reported by the QOF
+type UsageReport struct {
+	SliceID        string    `json:"id" yaml:"id" bson:"id"`
+	StartTime      time.Time `json:"start_time" yaml:"start_time" bson:"start_time"`
+	EndTime        time.Time `json:"end_time" yaml:"end_time" bson:"end_time"`
+	UplinkVolume   uint64    `json:"uplink_volume" yaml:"uplink_volume" bson:"uplink_volume"`
+	DownlinkVolume uint64    `json:"downlink_volume" yaml:"downlink_volume" bson:"downlink_volume"`
+	TotalVolume    uint64    `json:"total_volume" yaml:"total_volume" bson:"total_volume"`
+	Duration       uint32    `json:"duration" yaml:"duration" bson:"duration"`
+}
+
 // TranslateQoS translates the 5G DSCP to Satellite DSCP
 func TranslateQoS(qosMatch *QosMatch) uint8 {
 	return context.NTN_Self().QoS[qosMatch.DSCP]
@@ -86,6 +105,50 @@ func MapSlice(sliceID uint8) *factory.Slice {
 	return nil
 }
 
+// AdmitSession returns the satellite slice and the satellite DSCP of a 5G session, the session is refused
+// when its slice ID is not a satellite slice
+func AdmitSession(mobileSession *MobileSession) (*factory.Slice, uint8, error) {
+	sliceID, err := strconv.ParseUint(mobileSession.SliceID, 10, 8)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid slice ID %s", mobileSession.SliceID)
+	}
+	sliceSatellite := MapSlice(uint8(sliceID))
+	if sliceSatellite == nil {
+		return nil, 0, fmt.Errorf("unknown slice ID %d", sliceID)
+	}
+	return sliceSatellite, TranslateQoS(mobileSession.QosMatch), nil
+}
+
+// BuildADM returns the admission control of the CN classifier, shaping the forward link,
+// and of the RAN classifier, shaping the return link
+func BuildADM() (admCN *ADM, admRAN *ADM) {
+	admRAN = &ADM{
+		Controls: make([]ADMControl, len(context.NTN_Self().Slice)),
+		Aware:    context.NTN_Self().SliceAware,
+	}
+	admCN = &ADM{
+		Controls: make([]ADMControl, len(context.NTN_Self().Slice)),
+		Aware:    context.NTN_Self().SliceAware,
+	}
+
+	for k, sl := range context.NTN_Self().Slice {
+
+		admCN.Controls[k] = ADMControl{
+			SliceID:    sl.SliceID,
+			Throughput: sl.Forward,
+			Endpoint:   sl.ClassifierCNEndpoint,
+		}
+
+		admRAN.Controls[k] = ADMControl{
+			SliceID:    sl.SliceID,
+			Throughput: sl.Return,
+			Endpoint:   sl.ClassifierRANEndpoint,
+		}
+
+	}
+	return admCN, admRAN
+}
+
 // GetEgressInterface returns the classifier egress interface corresponding to a slice ID
 func GetEgressInterface(classifier *factory.Classifier, ipV4 string) (string, error) {
 	var iop string = ""
@@ -128,7 +191,7 @@ func GetIngressInterface(classifier *factory.Classifier, ipV4 string) (string, e
 	return "", err
 }
 
-func AdmissionControl(classifier *factory.Classifier, adm ADM, wg *sync.WaitGroup) error {
+func AdmissionControl(classifier *factory.Classifier, adm ADM) error {
 
 	var uri string = fmt.Sprintf("http://%s:%d/control-plane/adm", classifier.RegisterIPv4, classifier.Port)
 	client := http.Client{}
@@ -153,9 +216,12 @@ func AdmissionControl(classifier *factory.Classifier, adm ADM, wg *sync.WaitGrou
 		logger.PduSessLog.Errorln("Impossible to read the body")
 		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		logger.PduSessLog.Errorf("Admission Control refused by classifier %s", classifier.RegisterIPv4)
+		return fmt.Errorf("classifier %s returned status %d", classifier.RegisterIPv4, resp.StatusCode)
+	}
 	logger.PduSessLog.Infof("Admission Control OK for classifier %s", classifier.RegisterIPv4)
 
-	wg.Done()
 	return nil
 }
 
@@ -167,8 +233,7 @@ func Pipe(classifier *factory.Classifier,
 	ipv4 string,
 	endpoint string,
 	ingress string,
-	isRan bool,
-	wg *sync.WaitGroup) error {
+	isRan bool) error {
 
 	var uri string = fmt.Sprintf("http://%s:%d/data-plane/pdu", classifier.RegisterIPv4, classifier.Port)
 	client := http.Client{}
@@ -204,9 +269,12 @@ func Pipe(classifier *factory.Classifier,
 		logger.PduSessLog.Errorln("Impossible to read the body")
 		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		logger.PduSessLog.Errorf("Classifier %s refused the rule: %s", classifier.RegisterIPv4, string(body))
+		return fmt.Errorf("classifier %s returned status %d", classifier.RegisterIPv4, resp.StatusCode)
+	}
 	logger.PduSessLog.Infoln(string(body))
 
-	wg.Done()
 	return nil
 }
 
@@ -267,48 +335,77 @@ func HandleAdmissionControl(c *gin.Context) {
 
 	logger.PduSessLog.Infoln("Handling Admission Control")
 
-	var admRAN *ADM = &ADM{
-		Controls: make([]ADMControl, len(context.NTN_Self().Slice)),
-		Aware:    context.NTN_Self().SliceAware,
-	}
-	var admCN *ADM = &ADM{
-		Controls: make([]ADMControl, len(context.NTN_Self().Slice)),
-		Aware:    context.NTN_Self().SliceAware,
+	if controlPlane.RAN == "" || controlPlane.CN == "" {
+		c.JSON(500, gin.H{
+			"message": "Missing control plane endpoints",
+		})
+		return
 	}
 
-	for k, sl := range context.NTN_Self().Slice {
-
-		admCN.Controls[k] = ADMControl{
-			SliceID:    sl.SliceID,
-			Throughput: sl.Forward,
-			Endpoint:   sl.ClassifierCNEndpoint,
-		}
-
-		admRAN.Controls[k] = ADMControl{
-			SliceID:    sl.SliceID,
-			Throughput: sl.Return,
-			Endpoint:   sl.ClassifierRANEndpoint,
-		}
-
+	if MapSlice(controlPlane.SliceID) == nil {
+		c.JSON(500, gin.H{
+			"message": fmt.Sprintf("Unknown slice ID %d", controlPlane.SliceID),
+		})
+		return
 	}
 
+	admCN, admRAN := BuildADM()
+
 	classifierCN := context.NTN_Self().Classifiers.CN
 	classifierRAN := context.NTN_Self().Classifiers.RAN
 
 	var wg sync.WaitGroup
+	errs := make([]error, 2)
 
 	wg.Add(2)
-	go AdmissionControl(classifierCN, *admCN, &wg)
-	go AdmissionControl(classifierRAN, *admRAN, &wg)
+	go func() {
+		defer wg.Done()
+		errs[0] = AdmissionControl(classifierCN, *admCN)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = AdmissionControl(classifierRAN, *admRAN)
+	}()
 
 	wg.Wait()
 
+	for _, err := range errs {
+		if err != nil {
+			c.JSON(500, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	context.NTN_Self().ControlPlanes.Store(controlPlane.RAN+"-"+controlPlane.CN, &controlPlane)
+
 	c.JSON(200, gin.H{
 		"message": "success",
 	})
 
 }
 
+// HandleStatus returns the NTN QOF instance ID and the provisioned control planes,
+// the QOF provisions the control planes again when the instance ID changes
+func HandleStatus(c *gin.Context) {
+
+	status := Status{
+		NfInstanceID:  context.NTN_Self().NfInstanceID,
+		ControlPlanes: []*factory.ControlPlane{},
+	}
+	context.NTN_Self().ControlPlanes.Range(func(key, value interface{}) bool {
+		status.ControlPlanes = append(status.ControlPlanes, value.(*factory.ControlPlane))
+		return true
+	})
+	sort.Slice(status.ControlPlanes, func(i, j int) bool {
+		a, b := status.ControlPlanes[i], status.ControlPlanes[j]
+		return a.RAN+"-"+a.CN < b.RAN+"-"+b.CN
+	})
+
+	c.JSON(200, status)
+}
+
 // HandleSessionCreateQof handles the PDU Session creation on the satellite side
 func HandleSessionCreateQof(c *gin.Context) {
 
@@ -324,18 +421,28 @@ func HandleSessionCreateQof(c *gin.Context) {
 		return
 	}
 
+	if mobileSession.QosMatch == nil || mobileSession.SliceMatch == nil {
+		logger.PduSessLog.Errorln("Missing QoS or slice match in session")
+		c.JSON(500, gin.H{
+			"message": "Missing qos_match or slice_match",
+		})
+		return
+	}
+
 	logger.PduSessLog.Infof("New 5G session created for slice %s", mobileSession.SliceID)
 
-	// Translate the 5G DSCP to Satellite DSCP
+	// Get the satellite slice and translate the 5G DSCP to Satellite DSCP
+	sliceSatellite, dscpSatellite, err := AdmitSession(&mobileSession)
+	if err != nil {
+		logger.PduSessLog.Errorln(err)
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
 	dscp5G := mobileSession.QosMatch.DSCP
-	dscpSatellite := TranslateQoS(mobileSession.QosMatch)
 	logger.PduSessLog.Infof("Slice ID: %s, DSCP 5G: %d, DSCP SAT: %d", mobileSession.SliceID, dscp5G, dscpSatellite)
 	logger.PduSessLog.Infof("RAN EP: %s, CN EP: %s", mobileSession.RAN, mobileSession.UPF)
-
-	u64, _ := strconv.ParseUint(mobileSession.SliceID, 10, 64)
-
-	// Get the ST endpoint and the GW endpoint
-	sliceSatellite := MapSlice(uint8(u64))
 	// logger.PduSessLog.Infof("Getting ST endpoint %s and GW endpoint %s for Slice ID %d", sliceSatellite.StEndpoint, sliceSatellite.GwEndpoint, sliceSatellite.SliceId)
 	// logger.PduSessLog.Infof("5G RAN endpoint %s and 5G CN endpoint %s for Slice ID %d", mobileSession.RAN, mobileSession.UPF, uint8(u64))
 
@@ -356,19 +463,78 @@ func HandleSessionCreateQof(c *gin.Context) {
 	// logger.PduSessLog.Infof("Got IP of UE %s", mobileSession.IPv4)
 
 	var wg sync.WaitGroup
+	errs := make([]error, 2)
 	wg.Add(2)
 
 	// Programm the forward link
-	go Pipe(classifierCN, mobileSession.SliceMatch.DTEID, dscp5G, dscpSatellite, sliceSatellite.SliceID, mobileSession.UPF, sliceSatellite.ClassifierCNEndpoint, classifierCNIngress, false, &wg)
+	go func() {
+		defer wg.Done()
+		errs[0] = Pipe(classifierCN, mobileSession.SliceMatch.DTEID, dscp5G, dscpSatellite, sliceSatellite.SliceID, mobileSession.UPF, sliceSatellite.ClassifierCNEndpoint, classifierCNIngress, false)
+	}()
 	// go IPipe(classifierRAN, dscp5G, dscpSatellite, classifierRANEgress, mobileSession.RAN, sliceSatellite.SliceID, mobileSession.UPF, mobileSession.IPv4, true, &wg)
 
 	// Programm the return link
-	go Pipe(classifierRAN, mobileSession.SliceMatch.UTEID, dscp5G, dscpSatellite, sliceSatellite.SliceID, mobileSession.UPF, sliceSatellite.ClassifierRANEndpoint, classifierRANIngress, true, &wg)
+	go func() {
+		defer wg.Done()
+		errs[1] = Pipe(classifierRAN, mobileSession.SliceMatch.UTEID, dscp5G, dscpSatellite, sliceSatellite.SliceID, mobileSession.UPF, sliceSatellite.ClassifierRANEndpoint, classifierRANIngress, true)
+	}()
 	// go IPipe(classifierCN, dscp5G, dscpSatellite, classifierCNEgress, mobileSession.UPF, sliceSatellite.SliceID, mobileSession.RAN, mobileSession.IPv4, false, &wg)
 
 	wg.Wait()
 
+	for _, err := range errs {
+		if err != nil {
+			c.JSON(500, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
 	c.JSON(200, gin.H{
 		"message": "success",
 	})
 }
+
+// HandleUsageReport accounts the usage reported by the QOF to the satellite slice
+func HandleUsageReport(c *gin.Context) {
+
+	var usageReport UsageReport
+
+	if err := c.BindJSON(&usageReport); err != nil {
+		logger.PduSessLog.Errorln(err)
+		c.JSON(500, gin.H{
+			"message": "Error retrieving parameters",
+		})
+		return
+	}
+
+	logger.PduSessLog.Infoln("Handling Usage Report")
+
+	sliceID, err := strconv.ParseUint(usageReport.SliceID, 10, 8)
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": fmt.Sprintf("Invalid slice ID %s", usageReport.SliceID),
+		})
+		return
+	}
+	slice := MapSlice(uint8(sliceID))
+	if slice == nil {
+		c.JSON(500, gin.H{
+			"message": fmt.Sprintf("Unknown slice ID %d", sliceID),
+		})
+		return
+	}
+
+	context.NTN_Self().AddSliceUsage(slice, usageReport.UplinkVolume, usageReport.DownlinkVolume,
+		usageReport.TotalVolume, usageReport.Duration)
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+// HandleGetUsage returns the usage accumulated per satellite slice
+func HandleGetUsage(c *gin.Context) {
+	c.JSON(200, context.NTN_Self().GetSliceUsages())
+}
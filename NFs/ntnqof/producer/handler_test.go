@@ -0,0 +1,431 @@
+package producer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/shynuu/ntn-qof/context"
+	"github.com/shynuu/ntn-qof/factory"
+	"github.com/shynuu/ntn-qof/producer"
+)
+
+// fakeClassifier stands in for a satellite classifier and records every rule it receives
+type fakeClassifier struct {
+	server *httptest.Server
+	status int
+
+	mu   sync.Mutex
+	pdus []producer.PDU
+	adms []producer.ADM
+}
+
+func newFakeClassifier(t *testing.T, status int) *fakeClassifier {
+	f := &fakeClassifier{status: status}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data-plane/pdu", func(w http.ResponseWriter, r *http.Request) {
+		var pdu producer.PDU
+		if err := json.NewDecoder(r.Body).Decode(&pdu); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.pdus = append(f.pdus, pdu)
+		f.mu.Unlock()
+		w.WriteHeader(f.status)
+	})
+	mux.HandleFunc("/control-plane/adm", func(w http.ResponseWriter, r *http.Request) {
+		var adm producer.ADM
+		if err := json.NewDecoder(r.Body).Decode(&adm); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.adms = append(f.adms, adm)
+		f.mu.Unlock()
+		w.WriteHeader(f.status)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeClassifier) classifier(t *testing.T, ingress ...string) *factory.Classifier {
+	host, port, err := net.SplitHostPort(f.server.Listener.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &factory.Classifier{
+		RegisterIPv4: host,
+		Port:         p,
+		Ingress:      ingress,
+	}
+}
+
+func (f *fakeClassifier) receivedPDUs() []producer.PDU {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]producer.PDU(nil), f.pdus...)
+}
+
+func (f *fakeClassifier) receivedADMs() []producer.ADM {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]producer.ADM(nil), f.adms...)
+}
+
+// setupNTN loads an NTNQOF context whose classifiers are the given stand-ins
+func setupNTN(t *testing.T, ran, cn *fakeClassifier) {
+	context.InitQofContext(&factory.Config{
+		Info: &factory.Info{Version: factory.QOF_EXPECTED_CONFIG_VERSION},
+		Configuration: &factory.Configuration{
+			NtnName: "NTNQOF",
+			Sbi: &factory.Sbi{
+				Scheme:       "http",
+				RegisterIPv4: "127.0.0.1",
+				BindingIPv4:  "127.0.0.1",
+				Port:         9090,
+			},
+			QoS: map[uint8]uint8{
+				0x12: 0x0a,
+				0x11: 0x2e,
+			},
+			SliceAware: true,
+			Slice: []*factory.Slice{
+				{SliceID: 0, ClassifierRANEndpoint: "172.16.60.2", ClassifierCNEndpoint: "172.16.70.2", Forward: 20, Return: 10},
+				{SliceID: 1, ClassifierRANEndpoint: "172.16.80.2", ClassifierCNEndpoint: "172.16.90.2", Forward: 40, Return: 20},
+			},
+			Classifiers: &factory.Classifiers{
+				RAN: ran.classifier(t, "10.0.10.3"),
+				CN:  cn.classifier(t, "10.0.5.3"),
+			},
+		},
+	})
+}
+
+func newRouter() *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	return httptest.NewServer(producer.NewRouter())
+}
+
+// client does not use http.DefaultClient, whose transport is switched to HTTP/2 by the openapi clients
+var client = &http.Client{}
+
+func post(t *testing.T, uri string, body string) (int, string) {
+	resp, err := client.Post(uri, "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, buf.String()
+}
+
+func TestTranslateQoS(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+
+	testCases := []struct {
+		name   string
+		dscp5G uint8
+		expect uint8
+	}{
+		{"mapped best effort", 0x12, 0x0a},
+		{"mapped signalling", 0x11, 0x2e},
+		{"unmapped", 0x01, 0x00},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, producer.TranslateQoS(&producer.QosMatch{DSCP: tc.dscp5G}))
+		})
+	}
+}
+
+func TestMapSlice(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+
+	require.Equal(t, "172.16.90.2", producer.MapSlice(1).ClassifierCNEndpoint)
+	require.Equal(t, "172.16.60.2", producer.MapSlice(0).ClassifierRANEndpoint)
+	require.Nil(t, producer.MapSlice(7))
+}
+
+func TestHandleSessionCreateQof(t *testing.T) {
+	testCases := []struct {
+		name             string
+		classifierStatus int
+		body             string
+		expectStatus     int
+		expectPDUs       int
+	}{
+		{
+			name:             "session on slice 1",
+			classifierStatus: http.StatusOK,
+			body: `{"id":"1","ran":"10.0.10.1","upf":"10.0.5.1",
+				"slice_match":{"uteid":10,"dteid":20},"qos_match":{"dscp":18},"ipv4":"60.60.0.1"}`,
+			expectStatus: http.StatusOK,
+			expectPDUs:   1,
+		},
+		{
+			name:             "unknown slice",
+			classifierStatus: http.StatusOK,
+			body: `{"id":"9","ran":"10.0.10.1","upf":"10.0.5.1",
+				"slice_match":{"uteid":10,"dteid":20},"qos_match":{"dscp":18}}`,
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:             "non numeric slice",
+			classifierStatus: http.StatusOK,
+			body: `{"id":"slice","ran":"10.0.10.1","upf":"10.0.5.1",
+				"slice_match":{"uteid":10,"dteid":20},"qos_match":{"dscp":18}}`,
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:             "missing qos match",
+			classifierStatus: http.StatusOK,
+			body:             `{"id":"1","ran":"10.0.10.1","upf":"10.0.5.1","slice_match":{"uteid":10,"dteid":20}}`,
+			expectStatus:     http.StatusInternalServerError,
+		},
+		{
+			name:             "malformed body",
+			classifierStatus: http.StatusOK,
+			body:             `{"id":1`,
+			expectStatus:     http.StatusBadRequest,
+		},
+		{
+			name:             "classifier rejects rule",
+			classifierStatus: http.StatusInternalServerError,
+			body: `{"id":"1","ran":"10.0.10.1","upf":"10.0.5.1",
+				"slice_match":{"uteid":10,"dteid":20},"qos_match":{"dscp":18}}`,
+			expectStatus: http.StatusInternalServerError,
+			expectPDUs:   1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ran := newFakeClassifier(t, tc.classifierStatus)
+			cn := newFakeClassifier(t, tc.classifierStatus)
+			setupNTN(t, ran, cn)
+			router := newRouter()
+			defer router.Close()
+
+			status, _ := post(t, router.URL+"/ntn-session/new-session", tc.body)
+			require.Equal(t, tc.expectStatus, status)
+			require.Len(t, ran.receivedPDUs(), tc.expectPDUs)
+			require.Len(t, cn.receivedPDUs(), tc.expectPDUs)
+		})
+	}
+}
+
+func TestHandleSessionCreateQofRules(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+	router := newRouter()
+	defer router.Close()
+
+	status, _ := post(t, router.URL+"/ntn-session/new-session",
+		`{"id":"1","ran":"10.0.10.1","upf":"10.0.5.1","slice_match":{"uteid":10,"dteid":20},"qos_match":{"dscp":18}}`)
+	require.Equal(t, http.StatusOK, status)
+
+	// Forward link is programmed on the CN classifier with the downlink TEID
+	require.Equal(t, []producer.PDU{{
+		TEID:     20,
+		DSCP5:    0x12,
+		DSCPS:    0x0a,
+		SliceID:  1,
+		IPv4:     "10.0.5.1",
+		IsRAN:    false,
+		Endpoint: "172.16.90.2",
+		Ingress:  "10.0.5.3",
+	}}, cn.receivedPDUs())
+
+	// Return link is programmed on the RAN classifier with the uplink TEID
+	require.Equal(t, []producer.PDU{{
+		TEID:     10,
+		DSCP5:    0x12,
+		DSCPS:    0x0a,
+		SliceID:  1,
+		IPv4:     "10.0.5.1",
+		IsRAN:    true,
+		Endpoint: "172.16.80.2",
+		Ingress:  "10.0.10.3",
+	}}, ran.receivedPDUs())
+}
+
+func TestHandleAdmissionControl(t *testing.T) {
+	testCases := []struct {
+		name             string
+		classifierStatus int
+		body             string
+		expectStatus     int
+		expectADMs       int
+	}{
+		{"admission accepted", http.StatusOK, `{"ran":"10.0.10.1","cn":"10.0.5.1","id":0}`, http.StatusOK, 1},
+		{"classifier refuses", http.StatusServiceUnavailable, `{"ran":"10.0.10.1","cn":"10.0.5.1","id":0}`,
+			http.StatusInternalServerError, 1},
+		{"malformed body", http.StatusOK, `{"ran":`, http.StatusBadRequest, 0},
+		{"unknown slice", http.StatusOK, `{"ran":"10.0.10.1","cn":"10.0.5.1","id":7}`, http.StatusInternalServerError, 0},
+		{"missing amf", http.StatusOK, `{"ran":"10.0.10.1","id":0}`, http.StatusInternalServerError, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ran := newFakeClassifier(t, tc.classifierStatus)
+			cn := newFakeClassifier(t, tc.classifierStatus)
+			setupNTN(t, ran, cn)
+			router := newRouter()
+			defer router.Close()
+
+			status, _ := post(t, router.URL+"/ntn-session/admission-control", tc.body)
+			require.Equal(t, tc.expectStatus, status)
+			require.Len(t, ran.receivedADMs(), tc.expectADMs)
+			require.Len(t, cn.receivedADMs(), tc.expectADMs)
+		})
+	}
+}
+
+func TestHandleAdmissionControlThroughput(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+	router := newRouter()
+	defer router.Close()
+
+	status, _ := post(t, router.URL+"/ntn-session/admission-control", `{"ran":"10.0.10.1","cn":"10.0.5.1","id":0}`)
+	require.Equal(t, http.StatusOK, status)
+
+	// The CN classifier shapes the forward link, the RAN classifier the return link
+	require.Equal(t, []producer.ADM{{
+		Aware: true,
+		Controls: []producer.ADMControl{
+			{SliceID: 0, Throughput: 20, Endpoint: "172.16.70.2"},
+			{SliceID: 1, Throughput: 40, Endpoint: "172.16.90.2"},
+		},
+	}}, cn.receivedADMs())
+	require.Equal(t, []producer.ADM{{
+		Aware: true,
+		Controls: []producer.ADMControl{
+			{SliceID: 0, Throughput: 10, Endpoint: "172.16.60.2"},
+			{SliceID: 1, Throughput: 20, Endpoint: "172.16.80.2"},
+		},
+	}}, ran.receivedADMs())
+}
+
+func TestHandleStatus(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+	router := newRouter()
+	defer router.Close()
+
+	for _, body := range []string{
+		`{"ran":"10.0.11.1","cn":"10.0.6.1","id":1}`,
+		`{"ran":"10.0.10.1","cn":"10.0.5.1","id":0}`,
+		`{"ran":"10.0.10.1","cn":"10.0.5.1","id":0}`,
+	} {
+		status, _ := post(t, router.URL+"/ntn-session/admission-control", body)
+		require.Equal(t, http.StatusOK, status)
+	}
+
+	resp, err := client.Get(router.URL + "/ntn-session/status")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var status producer.Status
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.Equal(t, context.NTN_Self().NfInstanceID, status.NfInstanceID)
+	require.Equal(t, []*factory.ControlPlane{
+		{RAN: "10.0.10.1", CN: "10.0.5.1", SliceID: 0},
+		{RAN: "10.0.11.1", CN: "10.0.6.1", SliceID: 1},
+	}, status.ControlPlanes)
+}
+
+func TestHandleUsageReport(t *testing.T) {
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+	router := newRouter()
+	defer router.Close()
+
+	testCases := []struct {
+		name         string
+		body         string
+		expectStatus int
+	}{
+		{"slice 1", `{"id":"1","uplink_volume":100,"downlink_volume":400,"total_volume":500,"duration":60}`, http.StatusOK},
+		{"slice 1 again", `{"id":"1","uplink_volume":10,"downlink_volume":40,"total_volume":50,"duration":6}`, http.StatusOK},
+		{"slice 0", `{"id":"0","uplink_volume":1,"downlink_volume":2,"total_volume":3,"duration":1}`, http.StatusOK},
+		{"unknown slice", `{"id":"9","total_volume":3}`, http.StatusInternalServerError},
+		{"invalid slice", `{"id":"slice","total_volume":3}`, http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		status, _ := post(t, router.URL+"/ntn-session/usage-report", tc.body)
+		require.Equal(t, tc.expectStatus, status, tc.name)
+	}
+
+	resp, err := client.Get(router.URL + "/ntn-session/usage")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var usages []context.SliceUsage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&usages))
+	require.Equal(t, []context.SliceUsage{
+		{SliceID: 0, Forward: 20, Return: 10, UplinkVolume: 1, DownlinkVolume: 2, TotalVolume: 3, Duration: 1, Reports: 1},
+		{SliceID: 1, Forward: 40, Return: 20, UplinkVolume: 110, DownlinkVolume: 440, TotalVolume: 550, Duration: 66,
+			Reports: 2},
+	}, usages)
+}
+
+func TestConcurrentSessionCreate(t *testing.T) {
+	const sessions = 32
+
+	ran, cn := newFakeClassifier(t, http.StatusOK), newFakeClassifier(t, http.StatusOK)
+	setupNTN(t, ran, cn)
+	router := newRouter()
+	defer router.Close()
+
+	var wg sync.WaitGroup
+	statuses := make([]int, sessions)
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"id":"%d","ran":"10.0.10.1","upf":"10.0.5.1",`+
+				`"slice_match":{"uteid":%d,"dteid":%d},"qos_match":{"dscp":17}}`, i%2, 1000+i, 2000+i)
+			resp, err := client.Post(router.URL+"/ntn-session/new-session", "application/json",
+				bytes.NewBufferString(body))
+			if err != nil {
+				return
+			}
+			statuses[i] = resp.StatusCode
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		require.Equal(t, http.StatusOK, status, "session %d", i)
+	}
+
+	upTEIDs := make(map[uint32]bool)
+	for _, pdu := range ran.receivedPDUs() {
+		require.Equal(t, uint8(0x2e), pdu.DSCPS)
+		upTEIDs[pdu.TEID] = true
+	}
+	downTEIDs := make(map[uint32]bool)
+	for _, pdu := range cn.receivedPDUs() {
+		downTEIDs[pdu.TEID] = true
+	}
+	require.Len(t, upTEIDs, sessions)
+	require.Len(t, downTEIDs, sessions)
+}
@@ -70,4 +70,22 @@ var routes = Routes{
 		"/admission-control",
 		HandleAdmissionControl,
 	},
+	{
+		"Status",
+		"GET",
+		"/status",
+		HandleStatus,
+	},
+	{
+		"UsageReport",
+		"POST",
+		"/usage-report",
+		HandleUsageReport,
+	},
+	{
+		"Usage",
+		"GET",
+		"/usage",
+		HandleGetUsage,
+	},
 }
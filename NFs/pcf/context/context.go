@@ -51,6 +51,8 @@ type PCFContext struct {
 	AppSessionPool sync.Map
 	// AMF Status Change Subscription related
 	AMFStatusSubsData sync.Map // map[string]AMFStatusSubscriptionData; subscriptionID as key
+	// NTN profiles of satellite backhauls
+	NtnProfiles sync.Map // map[string]*factory.NtnProfile; profile name as key
 
 	// lock
 	DefaultUdrURILock sync.RWMutex
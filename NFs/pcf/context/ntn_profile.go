@@ -0,0 +1,111 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pcf/factory"
+)
+
+// ValidateNtnProfile checks that a profile can be bound to sessions
+func ValidateNtnProfile(profile *factory.NtnProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("NTN profile name is empty")
+	}
+	if profile.SNssai == nil && len(profile.GnbIds) == 0 {
+		return fmt.Errorf("NTN profile[%s] needs a sNssai or gnbIds", profile.Name)
+	}
+	if profile.Delay < 0 {
+		return fmt.Errorf("NTN profile[%s] has a negative delay", profile.Name)
+	}
+	for _, capacity := range []string{profile.CapacityUl, profile.CapacityDl} {
+		if capacity == "" {
+			continue
+		}
+		if _, err := ConvertBitRateToKbps(capacity); err != nil {
+			return fmt.Errorf("NTN profile[%s] capacity[%s]: %s", profile.Name, capacity, err)
+		}
+	}
+	return nil
+}
+
+// SetNtnProfile adds or replaces the NTN profile with the same name
+func (c *PCFContext) SetNtnProfile(profile *factory.NtnProfile) error {
+	if err := ValidateNtnProfile(profile); err != nil {
+		return err
+	}
+	c.NtnProfiles.Store(profile.Name, profile)
+	return nil
+}
+
+// DeleteNtnProfile removes a NTN profile, it returns false if the profile does not exist
+func (c *PCFContext) DeleteNtnProfile(name string) bool {
+	if _, exist := c.NtnProfiles.Load(name); !exist {
+		return false
+	}
+	c.NtnProfiles.Delete(name)
+	return true
+}
+
+// GetNtnProfiles returns all the NTN profiles known by the PCF
+func (c *PCFContext) GetNtnProfiles() []*factory.NtnProfile {
+	profiles := []*factory.NtnProfile{}
+	c.NtnProfiles.Range(func(key, value interface{}) bool {
+		profiles = append(profiles, value.(*factory.NtnProfile))
+		return true
+	})
+	return profiles
+}
+
+// FindNtnProfile returns the NTN profile applying to a session on the given slice and location.
+// A profile bound to the serving gNB wins over a slice-wide profile, nil means terrestrial backhaul.
+func (c *PCFContext) FindNtnProfile(snssai *models.Snssai, location *models.UserLocation) *factory.NtnProfile {
+	gnbId := servingGnbId(location)
+
+	var selected *factory.NtnProfile
+	bestScore := 0
+	c.NtnProfiles.Range(func(key, value interface{}) bool {
+		profile := value.(*factory.NtnProfile)
+		score := 0
+		if profile.SNssai != nil {
+			if snssai == nil || profile.SNssai.Sst != snssai.Sst ||
+				!strings.EqualFold(profile.SNssai.Sd, snssai.Sd) {
+				return true
+			}
+			score++
+		}
+		if len(profile.GnbIds) != 0 {
+			if !containsGnbId(profile.GnbIds, gnbId) {
+				return true
+			}
+			score += 2
+		}
+		if score > bestScore || (score == bestScore && selected != nil && profile.Name < selected.Name) {
+			selected = profile
+			bestScore = score
+		}
+		return true
+	})
+	return selected
+}
+
+func servingGnbId(location *models.UserLocation) string {
+	if location == nil || location.NrLocation == nil || location.NrLocation.GlobalGnbId == nil ||
+		location.NrLocation.GlobalGnbId.GNbId == nil {
+		return ""
+	}
+	return location.NrLocation.GlobalGnbId.GNbId.GNBValue
+}
+
+func containsGnbId(gnbIds []string, gnbId string) bool {
+	if gnbId == "" {
+		return false
+	}
+	for _, id := range gnbIds {
+		if strings.EqualFold(id, gnbId) {
+			return true
+		}
+	}
+	return false
+}
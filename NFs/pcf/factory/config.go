@@ -6,6 +6,7 @@ package factory
 
 import (
 	"github.com/free5gc/logger_util"
+	"github.com/free5gc/openapi/models"
 )
 
 const (
@@ -30,13 +31,14 @@ const (
 )
 
 type Configuration struct {
-	PcfName         string    `yaml:"pcfName,omitempty"`
-	Sbi             *Sbi      `yaml:"sbi,omitempty"`
-	TimeFormat      string    `yaml:"timeFormat,omitempty"`
-	DefaultBdtRefId string    `yaml:"defaultBdtRefId,omitempty"`
-	NrfUri          string    `yaml:"nrfUri,omitempty"`
-	ServiceList     []Service `yaml:"serviceList,omitempty"`
-	Mongodb         *Mongodb  `yaml:"mongodb"`
+	PcfName         string       `yaml:"pcfName,omitempty"`
+	Sbi             *Sbi         `yaml:"sbi,omitempty"`
+	TimeFormat      string       `yaml:"timeFormat,omitempty"`
+	DefaultBdtRefId string       `yaml:"defaultBdtRefId,omitempty"`
+	NrfUri          string       `yaml:"nrfUri,omitempty"`
+	ServiceList     []Service    `yaml:"serviceList,omitempty"`
+	Mongodb         *Mongodb     `yaml:"mongodb"`
+	NtnProfiles     []NtnProfile `yaml:"ntnProfiles,omitempty"`
 }
 
 type Service struct {
@@ -52,6 +54,18 @@ type Sbi struct {
 	Port        int    `yaml:"port,omitempty"`
 }
 
+// NtnProfile describes the satellite backhaul serving a slice and/or a set of gNBs
+type NtnProfile struct {
+	Name       string          `yaml:"name" json:"name"`
+	SNssai     *models.Snssai  `yaml:"sNssai,omitempty" json:"sNssai,omitempty"`
+	GnbIds     []string        `yaml:"gnbIds,omitempty" json:"gnbIds,omitempty"` // hex encoded gNB IDs behind the satellite
+	Delay      int32           `yaml:"delay" json:"delay"`                       // one-way delay of the satellite segment in ms
+	CapacityUl string          `yaml:"capacityUl,omitempty" json:"capacityUl,omitempty"`
+	CapacityDl string          `yaml:"capacityDl,omitempty" json:"capacityDl,omitempty"`
+	Arp        *models.Arp     `yaml:"arp,omitempty" json:"arp,omitempty"`
+	QosMapping map[int32]int32 `yaml:"qosMapping,omitempty" json:"qosMapping,omitempty"` // explicit 5QI replacement
+}
+
 type Mongodb struct {
 	Name string `yaml:"name"`
 	Url  string `yaml:"url"`
@@ -0,0 +1,83 @@
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pcf/factory"
+	"github.com/free5gc/pcf/logger"
+	"github.com/free5gc/pcf/producer"
+)
+
+func sendOAMResponse(c *gin.Context, rsp *http_wrapper.Response) {
+	responseBody, err := openapi.Serialize(rsp.Body, "application/json")
+	if err != nil {
+		logger.OamLog.Errorln(err)
+		problemDetails := models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: err.Error(),
+		}
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(rsp.Status, "application/json", responseBody)
+	}
+}
+
+func HTTPOAMGetNtnProfiles(c *gin.Context) {
+	setCorsHeader(c)
+
+	req := http_wrapper.NewRequest(c.Request, nil)
+
+	sendOAMResponse(c, producer.HandleOAMGetNtnProfilesRequest(req))
+}
+
+func HTTPOAMPutNtnProfile(c *gin.Context) {
+	setCorsHeader(c)
+
+	var profile factory.NtnProfile
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.OamLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&profile, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.OamLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, profile)
+	req.Params["name"] = c.Params.ByName("name")
+
+	sendOAMResponse(c, producer.HandleOAMPutNtnProfileRequest(req))
+}
+
+func HTTPOAMDeleteNtnProfile(c *gin.Context) {
+	setCorsHeader(c)
+
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["name"] = c.Params.ByName("name")
+
+	sendOAMResponse(c, producer.HandleOAMDeleteNtnProfileRequest(req))
+}
@@ -38,6 +38,10 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case "GET":
 			group.GET(route.Pattern, route.HandlerFunc)
+		case "PUT":
+			group.PUT(route.Pattern, route.HandlerFunc)
+		case "DELETE":
+			group.DELETE(route.Pattern, route.HandlerFunc)
 		}
 	}
 	return group
@@ -62,4 +66,25 @@ var routes = Routes{
 		"/am-policy/:supi",
 		HTTPOAMGetAmPolicy,
 	},
+
+	{
+		"Get NTN Profiles",
+		http.MethodGet,
+		"/ntn-profiles",
+		HTTPOAMGetNtnProfiles,
+	},
+
+	{
+		"Set NTN Profile",
+		http.MethodPut,
+		"/ntn-profiles/:name",
+		HTTPOAMPutNtnProfile,
+	},
+
+	{
+		"Delete NTN Profile",
+		http.MethodDelete,
+		"/ntn-profiles/:name",
+		HTTPOAMDeleteNtnProfile,
+	},
 }
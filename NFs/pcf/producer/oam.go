@@ -7,6 +7,7 @@ import (
 	"github.com/free5gc/http_wrapper"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pcf/context"
+	"github.com/free5gc/pcf/factory"
 	"github.com/free5gc/pcf/logger"
 )
 
@@ -78,3 +79,41 @@ func OAMGetAmPolicyProcedure(supi string) (response *UEAmPolicys, problemDetails
 		return nil, problemDetails
 	}
 }
+
+func HandleOAMGetNtnProfilesRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.OamLog.Infof("Handle OAMGetNtnProfiles")
+
+	return http_wrapper.NewResponse(http.StatusOK, nil, context.PCF_Self().GetNtnProfiles())
+}
+
+func HandleOAMPutNtnProfileRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.OamLog.Infof("Handle OAMPutNtnProfile")
+
+	profile := request.Body.(factory.NtnProfile)
+	profile.Name = request.Params["name"]
+
+	if err := context.PCF_Self().SetNtnProfile(&profile); err != nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusBadRequest,
+			Cause:  "MANDATORY_IE_INCORRECT",
+			Detail: err.Error(),
+		}
+		return http_wrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	logger.OamLog.Infof("NTN profile[%s] set: delay[%d ms] capacity UL[%s] DL[%s]",
+		profile.Name, profile.Delay, profile.CapacityUl, profile.CapacityDl)
+	return http_wrapper.NewResponse(http.StatusOK, nil, profile)
+}
+
+func HandleOAMDeleteNtnProfileRequest(request *http_wrapper.Request) *http_wrapper.Response {
+	logger.OamLog.Infof("Handle OAMDeleteNtnProfile")
+
+	if !context.PCF_Self().DeleteNtnProfile(request.Params["name"]) {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return http_wrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
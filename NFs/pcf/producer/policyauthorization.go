@@ -418,7 +418,7 @@ func postAppSessCtxProcedure(appSessCtx *models.AppSessionContext) (*models.AppS
 		smPolicyID := fmt.Sprintf("%s-%d", ue.Supi, smPolicy.PolicyContext.PduSessionId)
 		notification := models.SmPolicyNotification{
 			ResourceUri:      util.GetResourceUri(models.ServiceName_NPCF_SMPOLICYCONTROL, smPolicyID),
-			SmPolicyDecision: smPolicy.PolicyDecision,
+			SmPolicyDecision: ntnSmPolicyDecision(smPolicy),
 		}
 		notifyevent.DispatchSendSMPolicyUpdateNotifyEvent(smPolicy.PolicyContext.NotificationUri, &notification)
 	}
@@ -796,7 +796,7 @@ func ModAppSessionContextProcedure(appSessID string,
 		smPolicyID := fmt.Sprintf("%s-%d", smPolicy.PcfUe.Supi, smPolicy.PolicyContext.PduSessionId)
 		notification := models.SmPolicyNotification{
 			ResourceUri:      util.GetResourceUri(models.ServiceName_NPCF_SMPOLICYCONTROL, smPolicyID),
-			SmPolicyDecision: smPolicy.PolicyDecision,
+			SmPolicyDecision: ntnSmPolicyDecision(smPolicy),
 		}
 		notifyevent.DispatchSendSMPolicyUpdateNotifyEvent(smPolicy.PolicyContext.NotificationUri, &notification)
 		logger.PolicyAuthorizationlog.Tracef("Send SM Policy[%s] Update Notification", smPolicyID)
@@ -842,7 +842,7 @@ func DeleteEventsSubscContextProcedure(appSessID string) *models.ProblemDetails
 		smPolicyID := fmt.Sprintf("%s-%d", smPolicy.PcfUe.Supi, smPolicy.PolicyContext.PduSessionId)
 		notification := models.SmPolicyNotification{
 			ResourceUri:      util.GetResourceUri(models.ServiceName_NPCF_SMPOLICYCONTROL, smPolicyID),
-			SmPolicyDecision: smPolicy.PolicyDecision,
+			SmPolicyDecision: ntnSmPolicyDecision(smPolicy),
 		}
 		notifyevent.DispatchSendSMPolicyUpdateNotifyEvent(smPolicy.PolicyContext.NotificationUri, &notification)
 		logger.PolicyAuthorizationlog.Tracef("Send SM Policy[%s] Update Notification", smPolicyID)
@@ -1033,7 +1033,7 @@ func UpdateEventsSubscContextProcedure(appSessID string, eventsSubscReqData mode
 		smPolicyID := fmt.Sprintf("%s-%d", smPolicy.PcfUe.Supi, smPolicy.PolicyContext.PduSessionId)
 		notification := models.SmPolicyNotification{
 			ResourceUri:      util.GetResourceUri(models.ServiceName_NPCF_SMPOLICYCONTROL, smPolicyID),
-			SmPolicyDecision: smPolicy.PolicyDecision,
+			SmPolicyDecision: ntnSmPolicyDecision(smPolicy),
 		}
 		notifyevent.DispatchSendSMPolicyUpdateNotifyEvent(smPolicy.PolicyContext.NotificationUri, &notification)
 		logger.PolicyAuthorizationlog.Tracef("Send SM Policy[%s] Update Notification", smPolicyID)
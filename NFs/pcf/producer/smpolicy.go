@@ -215,7 +215,7 @@ func createSMPolicyProcedure(request models.SmPolicyContextData) (
 	}
 	logger.SMpolicylog.Tracef("SMPolicy PduSessionId[%d] Create", request.PduSessionId)
 
-	return header, &decision, nil
+	return header, ntnSmPolicyDecision(smPolicyData), nil
 }
 
 // SmPoliciessmPolicyIDDeletePost -
@@ -306,7 +306,7 @@ func getSmPolicyContextProcedure(smPolicyID string) (
 	}
 	smPolicyData := ue.SmPolicyData[smPolicyID]
 	response = &models.SmPolicyControl{
-		Policy:  smPolicyData.PolicyDecision,
+		Policy:  ntnSmPolicyDecision(smPolicyData),
 		Context: smPolicyData.PolicyContext,
 	}
 	logger.SMpolicylog.Tracef("SMPolicy smPolicyID[%s] GET", smPolicyID)
@@ -708,7 +708,19 @@ func updateSmPolicyContextProcedure(request models.SmPolicyUpdateContextData, sm
 	}
 	logger.SMpolicylog.Tracef("SMPolicy smPolicyID[%s] Update", smPolicyID)
 	// message.SendHttpResponseMessage(httpChannel, nil, http.StatusOK, *smPolicyDecision)
-	return smPolicyDecision, nil
+	return ntnSmPolicyDecision(smPolicy), nil
+}
+
+// ntnSmPolicyDecision returns the policy decision to send to the SMF, adapted to the satellite backhaul when the
+// session rides one. The stored decision is kept unadapted.
+func ntnSmPolicyDecision(smPolicy *pcf_context.UeSmPolicyData) *models.SmPolicyDecision {
+	policyContext := smPolicy.PolicyContext
+	profile := pcf_context.PCF_Self().FindNtnProfile(policyContext.SliceInfo, policyContext.UserLocationInfo)
+	if profile == nil {
+		return smPolicy.PolicyDecision
+	}
+	logger.SMpolicylog.Tracef("SMPolicy PduSessionId[%d] uses NTN profile[%s]", policyContext.PduSessionId, profile.Name)
+	return util.AdaptSmPolicyDecisionToNtn(smPolicy.PolicyDecision, profile)
 }
 
 func sendSmPolicyRelatedAppSessionNotification(smPolicy *pcf_context.UeSmPolicyData,
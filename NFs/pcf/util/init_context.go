@@ -63,6 +63,11 @@ func InitpcfContext(context *context.PCFContext) {
 	context.InitNFService(serviceList, config.Info.Version)
 	context.TimeFormat = configuration.TimeFormat
 	context.DefaultBdtRefId = configuration.DefaultBdtRefId
+	for i := range configuration.NtnProfiles {
+		if err := context.SetNtnProfile(&configuration.NtnProfiles[i]); err != nil {
+			logger.UtilLog.Errorf("Ignore NTN profile: %+v", err)
+		}
+	}
 	for _, service := range context.NfService {
 		var err error
 		context.PcfServiceUris[service.ServiceName] =
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"sort"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pcf/context"
+	"github.com/free5gc/pcf/factory"
+	"github.com/free5gc/pcf/logger"
+)
+
+type resourceType int
+
+const (
+	gbr resourceType = iota
+	nonGbr
+	delayCriticalGbr
+)
+
+// Part of the packet delay budget consumed by the core network (TS 23.501 5.7.3.4)
+const coreNetworkDelayBudget = 20
+
+type qosCharacteristics struct {
+	resourceType  resourceType
+	priorityLevel int32
+	// packet delay budget in ms
+	packetDelayBudget int32
+}
+
+// Standardized 5QI to QoS characteristics mapping (TS 23.501 Table 5.7.4-1)
+var standard5qiCharacteristics = map[int32]qosCharacteristics{
+	1:  {gbr, 20, 100},
+	2:  {gbr, 40, 150},
+	3:  {gbr, 30, 50},
+	4:  {gbr, 50, 300},
+	65: {gbr, 7, 75},
+	66: {gbr, 20, 100},
+	67: {gbr, 15, 100},
+	71: {gbr, 56, 150},
+	72: {gbr, 56, 300},
+	73: {gbr, 56, 300},
+	74: {gbr, 56, 500},
+	75: {gbr, 25, 50},
+	76: {gbr, 56, 500},
+	5:  {nonGbr, 10, 100},
+	6:  {nonGbr, 60, 300},
+	7:  {nonGbr, 70, 100},
+	8:  {nonGbr, 80, 300},
+	9:  {nonGbr, 90, 300},
+	69: {nonGbr, 5, 60},
+	70: {nonGbr, 55, 200},
+	79: {nonGbr, 65, 50},
+	80: {nonGbr, 68, 10},
+	82: {delayCriticalGbr, 19, 10},
+	83: {delayCriticalGbr, 22, 10},
+	84: {delayCriticalGbr, 24, 30},
+	85: {delayCriticalGbr, 21, 5},
+	86: {delayCriticalGbr, 18, 5},
+}
+
+// SelectNtn5qi returns the 5QI to use over the satellite backhaul described by profile.
+// The requested 5QI is kept when its PDB covers the satellite delay, otherwise the
+// standardized 5QI of the same resource type with the highest priority whose PDB
+// covers it is selected. Delay critical GBR flows fall back to GBR 5QIs.
+func SelectNtn5qi(var5qi int32, profile *factory.NtnProfile) int32 {
+	if mapped, exist := profile.QosMapping[var5qi]; exist {
+		return mapped
+	}
+	requested, exist := standard5qiCharacteristics[var5qi]
+	if !exist {
+		// non standardized 5QI, the operator is in charge of its characteristics
+		return var5qi
+	}
+	requiredPdb := profile.Delay + coreNetworkDelayBudget
+	if requested.packetDelayBudget >= requiredPdb {
+		return var5qi
+	}
+
+	wantedType := requested.resourceType
+	if wantedType == delayCriticalGbr {
+		wantedType = gbr
+	}
+	candidates := make([]int32, 0, len(standard5qiCharacteristics))
+	for candidate := range standard5qiCharacteristics {
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	selected := var5qi
+	var selectedPriority int32
+	for _, candidate := range candidates {
+		characteristics := standard5qiCharacteristics[candidate]
+		if characteristics.resourceType != wantedType || characteristics.packetDelayBudget < requiredPdb {
+			continue
+		}
+		if selected == var5qi || characteristics.priorityLevel < selectedPriority {
+			selected = candidate
+			selectedPriority = characteristics.priorityLevel
+		}
+	}
+	if selected == var5qi {
+		logger.SMpolicylog.Warnf("No 5QI can meet the %d ms delay of NTN profile[%s], keep 5QI[%d]",
+			profile.Delay, profile.Name, var5qi)
+	}
+	return selected
+}
+
+// ntnPriorityLevel returns the default priority level of the standardized 5QI, the priority level of a non
+// standardized 5QI mapped by the operator is kept
+func ntnPriorityLevel(var5qi, priorityLevel int32) int32 {
+	if characteristics, exist := standard5qiCharacteristics[var5qi]; exist {
+		return characteristics.priorityLevel
+	}
+	return priorityLevel
+}
+
+// capBitRate returns the lowest of bitRate and capacity, an empty bitRate means unlimited
+func capBitRate(bitRate, capacity string) string {
+	if capacity == "" {
+		return bitRate
+	}
+	if bitRate == "" {
+		return capacity
+	}
+	capacityKbps, err := context.ConvertBitRateToKbps(capacity)
+	if err != nil {
+		logger.SMpolicylog.Warnf("NTN capacity[%s] error: %+v", capacity, err)
+		return bitRate
+	}
+	bitRateKbps, err := context.ConvertBitRateToKbps(bitRate)
+	if err != nil || bitRateKbps > capacityKbps {
+		return capacity
+	}
+	return bitRate
+}
+
+// adaptNtnArp returns the ARP to hand out for a NTN session
+func adaptNtnArp(arp *models.Arp, profile *factory.NtnProfile) *models.Arp {
+	if profile.Arp == nil {
+		return arp
+	}
+	ntnArp := *profile.Arp
+	return &ntnArp
+}
+
+// AdaptSmPolicyDecisionToNtn adjusts the QoS of a SM policy decision to the satellite backhaul of profile:
+// 5QIs are selected against the satellite delay, bit rates are capped at the satellite capacity
+// and the ARP of the profile is applied. The decision is left untouched and an adapted copy is returned, so the
+// stored decision can be adapted again on every send.
+func AdaptSmPolicyDecisionToNtn(decision *models.SmPolicyDecision,
+	profile *factory.NtnProfile) *models.SmPolicyDecision {
+	if decision == nil || profile == nil {
+		return decision
+	}
+
+	adapted := *decision
+	adapted.SessRules = make(map[string]*models.SessionRule, len(decision.SessRules))
+	for id, rule := range decision.SessRules {
+		sessRule := *rule
+		adapted.SessRules[id] = &sessRule
+	}
+	adapted.QosDecs = make(map[string]*models.QosData, len(decision.QosDecs))
+	for id, data := range decision.QosDecs {
+		qosData := *data
+		adapted.QosDecs[id] = &qosData
+	}
+
+	for id, sessRule := range adapted.SessRules {
+		if sessRule.AuthDefQos != nil {
+			authDefQos := *sessRule.AuthDefQos
+			if var5qi := SelectNtn5qi(authDefQos.Var5qi, profile); var5qi != authDefQos.Var5qi {
+				logger.SMpolicylog.Infof("NTN profile[%s] SessRule[%s] default 5QI[%d] -> 5QI[%d]",
+					profile.Name, id, authDefQos.Var5qi, var5qi)
+				authDefQos.Var5qi = var5qi
+				authDefQos.PriorityLevel = ntnPriorityLevel(var5qi, authDefQos.PriorityLevel)
+			}
+			authDefQos.Arp = adaptNtnArp(authDefQos.Arp, profile)
+			sessRule.AuthDefQos = &authDefQos
+		}
+		if sessRule.AuthSessAmbr != nil {
+			sessRule.AuthSessAmbr = &models.Ambr{
+				Uplink:   capBitRate(sessRule.AuthSessAmbr.Uplink, profile.CapacityUl),
+				Downlink: capBitRate(sessRule.AuthSessAmbr.Downlink, profile.CapacityDl),
+			}
+		}
+	}
+
+	for id, qosData := range adapted.QosDecs {
+		if var5qi := SelectNtn5qi(qosData.Var5qi, profile); var5qi != qosData.Var5qi {
+			logger.SMpolicylog.Infof("NTN profile[%s] QosData[%s] 5QI[%d] -> 5QI[%d]",
+				profile.Name, id, qosData.Var5qi, var5qi)
+			qosData.Var5qi = var5qi
+			qosData.PriorityLevel = ntnPriorityLevel(var5qi, qosData.PriorityLevel)
+		}
+		qosData.MaxbrUl = capBitRate(qosData.MaxbrUl, profile.CapacityUl)
+		qosData.MaxbrDl = capBitRate(qosData.MaxbrDl, profile.CapacityDl)
+		if qosData.GbrUl != "" {
+			qosData.GbrUl = capBitRate(qosData.GbrUl, profile.CapacityUl)
+		}
+		if qosData.GbrDl != "" {
+			qosData.GbrDl = capBitRate(qosData.GbrDl, profile.CapacityDl)
+		}
+		qosData.Arp = adaptNtnArp(qosData.Arp, profile)
+	}
+	return &adapted
+}
@@ -0,0 +1,144 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pcf/context"
+	"github.com/free5gc/pcf/factory"
+	"github.com/free5gc/pcf/util"
+)
+
+var geoProfile = &factory.NtnProfile{
+	Name:       "geo",
+	SNssai:     &models.Snssai{Sst: 1, Sd: "010203"},
+	Delay:      270,
+	CapacityUl: "10 Mbps",
+	CapacityDl: "20 Mbps",
+	Arp: &models.Arp{
+		PriorityLevel: 10,
+		PreemptCap:    models.PreemptionCapability_NOT_PREEMPT,
+		PreemptVuln:   models.PreemptionVulnerability_PREEMPTABLE,
+	},
+}
+
+func TestSelectNtn5qi(t *testing.T) {
+	leoProfile := &factory.NtnProfile{Name: "leo", Delay: 30}
+	mappedProfile := &factory.NtnProfile{Name: "mapped", Delay: 270, QosMapping: map[int32]int32{7: 8}}
+
+	testCases := []struct {
+		name    string
+		var5qi  int32
+		profile *factory.NtnProfile
+		expect  int32
+	}{
+		{"non GBR within GEO budget", 9, geoProfile, 9},
+		{"non GBR over GEO budget", 7, geoProfile, 6},
+		{"GBR over GEO budget", 1, geoProfile, 4},
+		{"delay critical falls back to GBR", 82, geoProfile, 4},
+		{"no candidate keeps 5QI", 9, &factory.NtnProfile{Name: "far", Delay: 1000}, 9},
+		{"non standardized 5QI", 128, geoProfile, 128},
+		{"LEO keeps conversational video", 7, leoProfile, 7},
+		{"LEO over budget", 80, leoProfile, 69},
+		{"explicit mapping", 7, mappedProfile, 8},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, util.SelectNtn5qi(tc.var5qi, tc.profile))
+		})
+	}
+}
+
+func TestAdaptSmPolicyDecisionToNtn(t *testing.T) {
+	subsAmbr := &models.Ambr{Uplink: "100 Mbps", Downlink: "5 Mbps"}
+	subsArp := &models.Arp{PriorityLevel: 1, PreemptCap: models.PreemptionCapability_MAY_PREEMPT}
+	decision := &models.SmPolicyDecision{
+		SessRules: map[string]*models.SessionRule{
+			"SessRuleId-1": {
+				SessRuleId:   "SessRuleId-1",
+				AuthSessAmbr: subsAmbr,
+				AuthDefQos:   &models.AuthorizedDefaultQos{Var5qi: 7, Arp: subsArp, PriorityLevel: 70},
+			},
+		},
+		QosDecs: map[string]*models.QosData{
+			"QosId-1": {QosId: "QosId-1", Var5qi: 1, GbrUl: "50 Mbps", GbrDl: "1 Mbps", MaxbrUl: "60 Mbps"},
+		},
+	}
+
+	adapted := util.AdaptSmPolicyDecisionToNtn(decision, geoProfile)
+
+	sessRule := adapted.SessRules["SessRuleId-1"]
+	require.Equal(t, &models.Ambr{Uplink: "10 Mbps", Downlink: "5 Mbps"}, sessRule.AuthSessAmbr)
+	require.Equal(t, int32(6), sessRule.AuthDefQos.Var5qi)
+	require.Equal(t, int32(60), sessRule.AuthDefQos.PriorityLevel)
+	require.Equal(t, geoProfile.Arp, sessRule.AuthDefQos.Arp)
+
+	qosData := adapted.QosDecs["QosId-1"]
+	require.Equal(t, int32(4), qosData.Var5qi)
+	require.Equal(t, "10 Mbps", qosData.GbrUl)
+	require.Equal(t, "1 Mbps", qosData.GbrDl)
+	require.Equal(t, "10 Mbps", qosData.MaxbrUl)
+	require.Equal(t, "20 Mbps", qosData.MaxbrDl)
+	require.Equal(t, geoProfile.Arp, qosData.Arp)
+
+	// subscribed values are not modified by the adaptation
+	require.Equal(t, "100 Mbps", subsAmbr.Uplink)
+	require.Equal(t, int32(1), subsArp.PriorityLevel)
+
+	// the stored decision is not modified, so adapting it again on policy update gives the same result
+	require.Equal(t, int32(7), decision.SessRules["SessRuleId-1"].AuthDefQos.Var5qi)
+	require.Equal(t, int32(1), decision.QosDecs["QosId-1"].Var5qi)
+	require.Equal(t, "50 Mbps", decision.QosDecs["QosId-1"].GbrUl)
+	require.Equal(t, adapted, util.AdaptSmPolicyDecisionToNtn(decision, geoProfile))
+
+	// the priority level is kept when the mapping points at a non standardized 5QI
+	operatorProfile := &factory.NtnProfile{Name: "operator", Delay: 270, QosMapping: map[int32]int32{9: 128}}
+	adapted = util.AdaptSmPolicyDecisionToNtn(&models.SmPolicyDecision{
+		QosDecs: map[string]*models.QosData{"QosId-2": {QosId: "QosId-2", Var5qi: 9, PriorityLevel: 90}},
+	}, operatorProfile)
+	qosData = adapted.QosDecs["QosId-2"]
+	require.Equal(t, int32(128), qosData.Var5qi)
+	require.Equal(t, int32(90), qosData.PriorityLevel)
+}
+
+func TestFindNtnProfile(t *testing.T) {
+	pcfSelf := context.PCF_Self()
+	gnbProfile := &factory.NtnProfile{Name: "site", GnbIds: []string{"000102"}, Delay: 30}
+	require.NoError(t, pcfSelf.SetNtnProfile(geoProfile))
+	require.NoError(t, pcfSelf.SetNtnProfile(gnbProfile))
+	require.Error(t, pcfSelf.SetNtnProfile(&factory.NtnProfile{Name: "unbound", Delay: 30}))
+	require.Error(t, pcfSelf.SetNtnProfile(&factory.NtnProfile{Name: "bad", GnbIds: []string{"01"}, CapacityUl: "10"}))
+	defer func() {
+		pcfSelf.DeleteNtnProfile(geoProfile.Name)
+		pcfSelf.DeleteNtnProfile(gnbProfile.Name)
+	}()
+
+	location := func(gnbId string) *models.UserLocation {
+		return &models.UserLocation{
+			NrLocation: &models.NrLocation{
+				GlobalGnbId: &models.GlobalRanNodeId{GNbId: &models.GNbId{BitLength: 24, GNBValue: gnbId}},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		snssai   *models.Snssai
+		location *models.UserLocation
+		expect   *factory.NtnProfile
+	}{
+		{"slice profile", &models.Snssai{Sst: 1, Sd: "010203"}, nil, geoProfile},
+		{"gNB profile wins over slice", &models.Snssai{Sst: 1, Sd: "010203"}, location("000102"), gnbProfile},
+		{"gNB profile on other slice", &models.Snssai{Sst: 2, Sd: "112233"}, location("000102"), gnbProfile},
+		{"terrestrial", &models.Snssai{Sst: 2, Sd: "112233"}, location("000103"), nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, pcfSelf.FindNtnProfile(tc.snssai, tc.location))
+		})
+	}
+}
@@ -40,6 +40,41 @@ func NTN5GSessionCreate(ntnSession *factory.NTNSession) error {
 		logger.PduSessLog.Errorln("Impossible to read the body")
 		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		logger.PduSessLog.Errorf("NTN QOF rejected the session: %s", string(body))
+		return fmt.Errorf("NTN QOF returned status %d", resp.StatusCode)
+	}
 	logger.PduSessLog.Infoln(string(body))
 	return nil
 }
+
+// NTNUsageReport forwards the usage of a satellite slice to the NTN QOF
+func NTNUsageReport(usageReport *factory.NTNUsageReport) error {
+
+	var url string = fmt.Sprintf("%s/ntn-session/usage-report", context.QOF_Self().NtnUri)
+
+	client := http.Client{}
+
+	reqBody, err := json.Marshal(usageReport)
+	if err != nil {
+		logger.PduSessLog.Errorln("Impossible to serialize usage report")
+		return err
+	}
+
+	resp, err := client.Post(url,
+		"application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		logger.PduSessLog.Errorln("Impossible to post usage report to NTN QOF")
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		logger.PduSessLog.Errorf("NTN QOF rejected the usage report: %s", string(body))
+		return fmt.Errorf("NTN QOF returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/shynuu/qof/context"
+	"github.com/shynuu/qof/factory"
+	"github.com/shynuu/qof/logger"
+)
+
+// NTNControlPlaneProvision sends one control-plane slice to the NTN QOF admission control
+func NTNControlPlaneProvision(controlPlane *factory.ControlPlane) error {
+	var url string = fmt.Sprintf("%s/ntn-session/admission-control", context.QOF_Self().NtnUri)
+
+	client := http.Client{Timeout: context.QOF_Self().NtnRetry}
+
+	reqBody, err := json.Marshal(controlPlane)
+	if err != nil {
+		logger.PduSessLog.Errorln("Impossible to serialize control plane Info")
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("NTN QOF returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// NTNStatusGet retrieves the status of the NTN QOF
+func NTNStatusGet() (*factory.NTNStatus, error) {
+	var url string = fmt.Sprintf("%s/ntn-session/status", context.QOF_Self().NtnUri)
+
+	client := http.Client{Timeout: context.QOF_Self().NtnRetry}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NTN QOF returned status %d", resp.StatusCode)
+	}
+	var status factory.NTNStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// provisionControlPlanes provisions every control-plane slice and returns the
+// instance ID of the NTN QOF that acknowledged them
+func provisionControlPlanes() (string, error) {
+	status, err := NTNStatusGet()
+	if err != nil {
+		return "", err
+	}
+	for _, controlPlane := range context.QOF_Self().ControlPlanes {
+		if err := NTNControlPlaneProvision(controlPlane); err != nil {
+			return "", fmt.Errorf("control plane RAN [%s] AMF [%s] slice [%d]: %+v",
+				controlPlane.RAN, controlPlane.CN, controlPlane.ID, err)
+		}
+		logger.PduSessLog.Infof("Control plane RAN [%s] AMF [%s] provisioned on NTN slice [%d]",
+			controlPlane.RAN, controlPlane.CN, controlPlane.ID)
+	}
+	return status.NfInstanceID, nil
+}
+
+// KeepControlPlaneProvisioned provisions the control-plane slices on the NTN QOF, retrying until
+// they are acknowledged, then watches the NTN QOF status and provisions them again when it restarts.
+// It returns when stop is closed.
+func KeepControlPlaneProvisioned(stop <-chan struct{}) {
+	self := context.QOF_Self()
+	if len(self.ControlPlanes) == 0 {
+		logger.PduSessLog.Warnln("No control plane slice to provision on the NTN QOF")
+		return
+	}
+
+	var ntnInstanceID string
+	provisioned := false
+	for {
+		wait := self.NtnCheck
+		if !provisioned {
+			logger.PduSessLog.Infoln("Handling Control Plane Slices")
+			if instanceID, err := provisionControlPlanes(); err != nil {
+				logger.PduSessLog.Errorf("Control plane provisioning failed, retry in %s: %+v", self.NtnRetry, err)
+				wait = self.NtnRetry
+			} else {
+				ntnInstanceID = instanceID
+				provisioned = true
+			}
+		} else if status, err := NTNStatusGet(); err != nil {
+			logger.PduSessLog.Warnf("NTN QOF unreachable: %+v", err)
+			provisioned = false
+			wait = self.NtnRetry
+		} else if status.NfInstanceID != ntnInstanceID {
+			logger.PduSessLog.Infof("NTN QOF restarted [%s] -> [%s]", ntnInstanceID, status.NfInstanceID)
+			provisioned = false
+			continue
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/shynuu/qof/consumer"
+	"github.com/shynuu/qof/context"
+	"github.com/shynuu/qof/factory"
+)
+
+// fakeNTN stands in for the NTNQOF, it refuses the first admission controls and
+// records the control planes it acknowledges
+type fakeNTN struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	instanceID    string
+	refusals      int
+	controlPlanes []factory.ControlPlane
+}
+
+func newFakeNTN(t *testing.T, refusals int) *fakeNTN {
+	f := &fakeNTN{instanceID: "ntn-1", refusals: refusals}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ntn-session/status", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		require.NoError(t, json.NewEncoder(w).Encode(factory.NTNStatus{NfInstanceID: f.instanceID}))
+	})
+	mux.HandleFunc("/ntn-session/admission-control", func(w http.ResponseWriter, r *http.Request) {
+		var controlPlane factory.ControlPlane
+		if err := json.NewDecoder(r.Body).Decode(&controlPlane); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.refusals > 0 {
+			f.refusals--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.controlPlanes = append(f.controlPlanes, controlPlane)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeNTN) restart() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.instanceID = "ntn-2"
+	f.controlPlanes = nil
+}
+
+func (f *fakeNTN) receivedControlPlanes() []factory.ControlPlane {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]factory.ControlPlane(nil), f.controlPlanes...)
+}
+
+func setupQOF(ntn *fakeNTN) {
+	context.InitQofContext(&factory.Config{
+		Info: &factory.Info{Version: factory.QOF_EXPECTED_CONFIG_VERSION},
+		Configuration: &factory.Configuration{
+			QofName: "QOF",
+			Sbi: &factory.Sbi{
+				Scheme:       "http",
+				RegisterIPv4: "127.0.0.1",
+				BindingIPv4:  "127.0.0.1",
+				Port:         8090,
+			},
+			NtnUri: ntn.server.URL,
+			ControlPlane: []*factory.ControlPlane{
+				{RAN: "10.0.10.1", CN: "10.0.5.2", ID: 0},
+				{RAN: "10.0.11.1", CN: "10.0.6.2", ID: 1},
+			},
+		},
+	})
+	context.QOF_Self().NtnRetry = 10 * time.Millisecond
+	context.QOF_Self().NtnCheck = 10 * time.Millisecond
+}
+
+func TestKeepControlPlaneProvisioned(t *testing.T) {
+	expected := []factory.ControlPlane{
+		{RAN: "10.0.10.1", CN: "10.0.5.2", ID: 0},
+		{RAN: "10.0.11.1", CN: "10.0.6.2", ID: 1},
+	}
+
+	ntn := newFakeNTN(t, 3)
+	setupQOF(ntn)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		consumer.KeepControlPlaneProvisioned(stop)
+		close(done)
+	}()
+
+	// provisioning is retried until the NTN QOF acknowledges every control plane
+	require.Eventually(t, func() bool {
+		return len(ntn.receivedControlPlanes()) == len(expected)
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, expected, ntn.receivedControlPlanes())
+
+	// a restarted NTN QOF is provisioned again
+	ntn.restart()
+	require.Eventually(t, func() bool {
+		return len(ntn.receivedControlPlanes()) == len(expected)
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, expected, ntn.receivedControlPlanes())
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("provisioning did not stop")
+	}
+}
+
+func TestNTNControlPlaneProvisionTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	setupQOF(&fakeNTN{server: server})
+
+	// a NTN QOF that never answers does not block the provisioning
+	done := make(chan error)
+	go func() {
+		done <- consumer.NTNControlPlaneProvision(context.QOF_Self().ControlPlanes[0])
+	}()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("admission control request was not bounded")
+	}
+}
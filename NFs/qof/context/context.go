@@ -1,13 +1,10 @@
 package context
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"strconv"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -30,8 +27,11 @@ type QOFContext struct {
 	Name         string
 	NfInstanceID string
 
-	QoS   map[int32]uint16
-	Slice []*factory.Slice
+	QoS           map[int32]uint16
+	Slice         []*factory.Slice
+	ControlPlanes []*factory.ControlPlane
+	// S-NSSAI(sst-sd form) to *sliceUsage
+	SliceUsage sync.Map
 
 	URIScheme    models.UriScheme
 	BindingIPv4  string
@@ -48,6 +48,8 @@ type QOFContext struct {
 
 	NrfUri                         string
 	NtnUri                         string
+	NtnRetry                       time.Duration
+	NtnCheck                       time.Duration
 	NFManagementClient             *Nnrf_NFManagement.APIClient
 	NFDiscoveryClient              *Nnrf_NFDiscovery.APIClient
 	SubscriberDataManagementClient *Nudm_SubscriberDataManagement.APIClient
@@ -68,6 +70,25 @@ func InitQofContext(config *factory.Config) {
 	qofContext.QoS = configuration.QoS
 	qofContext.Slice = configuration.Slice
 	qofContext.NtnUri = configuration.NtnUri
+	qofContext.SliceUsage.Range(func(key, value interface{}) bool {
+		qofContext.SliceUsage.Delete(key)
+		return true
+	})
+
+	if controlPlanes, err := configuration.ControlPlanes(); err != nil {
+		logger.CtxLog.Errorf("Control plane configuration error: %+v", err)
+		qofContext.ControlPlanes = nil
+	} else {
+		qofContext.ControlPlanes = controlPlanes
+	}
+	qofContext.NtnRetry = factory.QOF_DEFAULT_NTN_RETRY * time.Second
+	if configuration.NtnRetry > 0 {
+		qofContext.NtnRetry = time.Duration(configuration.NtnRetry) * time.Second
+	}
+	qofContext.NtnCheck = factory.QOF_DEFAULT_NTN_CHECK * time.Second
+	if configuration.NtnCheck > 0 {
+		qofContext.NtnCheck = time.Duration(configuration.NtnCheck) * time.Second
+	}
 
 	sbi := configuration.Sbi
 	if sbi == nil {
@@ -122,49 +143,3 @@ func InitQofContext(config *factory.Config) {
 func QOF_Self() *QOFContext {
 	return &qofContext
 }
-
-func InitDefaultSlice() error {
-
-	logger.PduSessLog.Infoln("Handling Default Slice")
-
-	var url string = fmt.Sprintf("%s/ntn-session/admission-control", QOF_Self().NtnUri)
-
-	var controlPlaneInfo *factory.ControlPlane
-
-	for _, sl := range QOF_Self().Slice {
-		if sl.Default {
-			u64, _ := strconv.ParseUint(sl.ID, 10, 8)
-			u8 := uint8(u64)
-			controlPlaneInfo = &factory.ControlPlane{
-				RAN: sl.RAN,
-				CN:  sl.AMF,
-				ID:  u8,
-			}
-		}
-	}
-
-	client := http.Client{}
-
-	reqBody, err := json.Marshal(controlPlaneInfo)
-
-	if err != nil {
-		logger.PduSessLog.Errorln("Impossible to serialzie Default Slice Info")
-		return err
-	}
-
-	resp, err := client.Post(url,
-		"application/json", bytes.NewBuffer(reqBody))
-	if err != nil {
-		logger.PduSessLog.Errorln(err)
-		logger.PduSessLog.Errorln("Impossible to post session Info to NTN QOF")
-		return err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.PduSessLog.Errorln("Impossible to read the body")
-		return err
-	}
-	logger.PduSessLog.Infoln(string(body))
-	return nil
-}
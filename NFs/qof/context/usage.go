@@ -0,0 +1,49 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shynuu/qof/factory"
+)
+
+type sliceUsage struct {
+	mu    sync.Mutex
+	usage factory.SliceUsage
+}
+
+// AddUsageReport accounts the usage report of a PDU session to its S-NSSAI
+func (c *QOFContext) AddUsageReport(report *factory.QOFUsageReport, sliceID string) {
+	key := fmt.Sprintf("%d-%s", report.Snssai.Sst, report.Snssai.Sd)
+	value, _ := c.SliceUsage.LoadOrStore(key, &sliceUsage{
+		usage: factory.SliceUsage{Snssai: *report.Snssai, SliceID: sliceID},
+	})
+	slice := value.(*sliceUsage)
+	slice.mu.Lock()
+	defer slice.mu.Unlock()
+	slice.usage.UplinkVolume += report.UplinkVolume
+	slice.usage.DownlinkVolume += report.DownlinkVolume
+	slice.usage.TotalVolume += report.TotalVolume
+	slice.usage.Duration += uint64(report.Duration)
+	slice.usage.Reports++
+}
+
+// GetSliceUsages returns the usage accumulated per S-NSSAI
+func (c *QOFContext) GetSliceUsages() []factory.SliceUsage {
+	usages := make([]factory.SliceUsage, 0)
+	c.SliceUsage.Range(func(key, value interface{}) bool {
+		slice := value.(*sliceUsage)
+		slice.mu.Lock()
+		usages = append(usages, slice.usage)
+		slice.mu.Unlock()
+		return true
+	})
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Snssai.Sst != usages[j].Snssai.Sst {
+			return usages[i].Snssai.Sst < usages[j].Snssai.Sst
+		}
+		return usages[i].Snssai.Sd < usages[j].Snssai.Sd
+	})
+	return usages
+}
@@ -5,6 +5,11 @@
 package factory
 
 import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
 	"github.com/free5gc/logger_util"
 	"github.com/free5gc/openapi/models"
 )
@@ -28,6 +33,9 @@ type Configuration struct {
 	ULCL            bool             `yaml:"ulcl,omitempty"`
 	QoS             map[int32]uint16 `yaml:"qos,omitempty"`
 	Slice           []*Slice         `yaml:"slice,omitempty"`
+	ControlPlane    []*ControlPlane  `yaml:"controlPlane,omitempty"`
+	NtnRetry        int              `yaml:"ntnRetry,omitempty"` // seconds between two provisioning attempts
+	NtnCheck        int              `yaml:"ntnCheck,omitempty"` // seconds between two NTN QOF status checks
 }
 
 type Info struct {
@@ -36,14 +44,17 @@ type Info struct {
 }
 
 const (
-	QOF_DEFAULT_IPV4     = "127.0.0.1"
-	QOF_DEFAULT_PORT     = "8000"
-	QOF_DEFAULT_PORT_INT = 8000
+	QOF_DEFAULT_IPV4      = "127.0.0.1"
+	QOF_DEFAULT_PORT      = "8000"
+	QOF_DEFAULT_PORT_INT  = 8000
+	QOF_DEFAULT_NTN_RETRY = 5
+	QOF_DEFAULT_NTN_CHECK = 10
 )
 
+// ControlPlane is the signaling slice between a RAN and its AMF over the satellite
 type ControlPlane struct {
 	RAN string `yaml:"ran" json:"ran"`
-	CN  string `yaml:"cn" json:"cn"`
+	CN  string `yaml:"amf" json:"cn"`
 	ID  uint8  `yaml:"id" json:"id"`
 }
 
@@ -56,6 +67,12 @@ type Slice struct {
 	Default bool           `yaml:"default"`
 }
 
+// NTNStatus is the status exposed by the NTN QOF, a new instance ID means the NTN QOF restarted
+type NTNStatus struct {
+	NfInstanceID  string          `json:"nf_instance_id"`
+	ControlPlanes []*ControlPlane `json:"control_planes"`
+}
+
 type QoS struct {
 	Var5QI int32  `yaml:"5qi,omitempty"`
 	DSCP   uint16 `yaml:"dscp,omitempty"`
@@ -94,6 +111,41 @@ type NTNSession struct {
 	IPv4       string      `json:"ipv4" yaml:"ipv4" bson:"ipv4"`
 }
 
+// QOFUsageReport is the usage report of a PDU session sent by the SMF
+type QOFUsageReport struct {
+	SessionID      int32          `json:"sessionid" yaml:"sessionid" bson:"sessionid"`
+	Snssai         *models.Snssai `json:"Snssai" yaml:"snssai" bson:"snssai"`
+	Supi           string         `json:"supi" yaml:"supi" bson:"supi"`
+	StartTime      time.Time      `json:"startTime" yaml:"startTime" bson:"startTime"`
+	EndTime        time.Time      `json:"endTime" yaml:"endTime" bson:"endTime"`
+	UplinkVolume   uint64         `json:"uplinkVolume" yaml:"uplinkVolume" bson:"uplinkVolume"`
+	DownlinkVolume uint64         `json:"downlinkVolume" yaml:"downlinkVolume" bson:"downlinkVolume"`
+	TotalVolume    uint64         `json:"totalVolume" yaml:"totalVolume" bson:"totalVolume"`
+	Duration       uint32         `json:"duration" yaml:"duration" bson:"duration"`
+}
+
+// NTNUsageReport is the usage report forwarded to the NTN QOF for the satellite slice
+type NTNUsageReport struct {
+	SliceID        string    `json:"id" yaml:"id" bson:"id"`
+	StartTime      time.Time `json:"start_time" yaml:"start_time" bson:"start_time"`
+	EndTime        time.Time `json:"end_time" yaml:"end_time" bson:"end_time"`
+	UplinkVolume   uint64    `json:"uplink_volume" yaml:"uplink_volume" bson:"uplink_volume"`
+	DownlinkVolume uint64    `json:"downlink_volume" yaml:"downlink_volume" bson:"downlink_volume"`
+	TotalVolume    uint64    `json:"total_volume" yaml:"total_volume" bson:"total_volume"`
+	Duration       uint32    `json:"duration" yaml:"duration" bson:"duration"`
+}
+
+// SliceUsage is the usage accumulated by the PDU sessions of a S-NSSAI
+type SliceUsage struct {
+	Snssai         models.Snssai `json:"snssai"`
+	SliceID        string        `json:"id"`
+	UplinkVolume   uint64        `json:"uplinkVolume"`
+	DownlinkVolume uint64        `json:"downlinkVolume"`
+	TotalVolume    uint64        `json:"totalVolume"`
+	Duration       uint64        `json:"duration"`
+	Reports        uint64        `json:"reports"`
+}
+
 type SliceMatch struct {
 	UTEID uint32 `json:"uteid" yaml:"supi" bson:"supi"`
 	DTEID uint32 `json:"dteid" yaml:"supi" bson:"supi"`
@@ -103,6 +155,44 @@ type QosMatch struct {
 	DSCP uint16 `json:"dscp" yaml:"dscp" bson:"dscp"`
 }
 
+// ControlPlanes returns the validated control-plane slices. When no controlPlane section is
+// configured, they are built from the slices marked as default.
+func (c *Configuration) ControlPlanes() ([]*ControlPlane, error) {
+	controlPlanes := c.ControlPlane
+	if len(controlPlanes) == 0 {
+		for _, sl := range c.Slice {
+			if !sl.Default {
+				continue
+			}
+			id, err := strconv.ParseUint(sl.ID, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("default slice ID [%s] is not a valid NTN slice ID: %+v", sl.ID, err)
+			}
+			controlPlanes = append(controlPlanes, &ControlPlane{
+				RAN: sl.RAN,
+				CN:  sl.AMF,
+				ID:  uint8(id),
+			})
+		}
+	}
+
+	pairs := make(map[string]bool)
+	for _, cp := range controlPlanes {
+		if net.ParseIP(cp.RAN) == nil {
+			return nil, fmt.Errorf("control plane RAN [%s] is not a valid IP address", cp.RAN)
+		}
+		if net.ParseIP(cp.CN) == nil {
+			return nil, fmt.Errorf("control plane AMF [%s] is not a valid IP address", cp.CN)
+		}
+		pair := cp.RAN + "-" + cp.CN
+		if pairs[pair] {
+			return nil, fmt.Errorf("control plane RAN [%s] AMF [%s] is configured twice", cp.RAN, cp.CN)
+		}
+		pairs[pair] = true
+	}
+	return controlPlanes, nil
+}
+
 func (c *Config) GetVersion() string {
 	if c.Info != nil && c.Info.Version != "" {
 		return c.Info.Version
@@ -0,0 +1,82 @@
+package factory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/shynuu/qof/factory"
+)
+
+func TestControlPlanes(t *testing.T) {
+	snssai := &models.Snssai{Sst: 1, Sd: "010203"}
+
+	testCases := []struct {
+		name          string
+		configuration *factory.Configuration
+		expect        []*factory.ControlPlane
+		expectErr     bool
+	}{
+		{
+			name: "every default slice",
+			configuration: &factory.Configuration{Slice: []*factory.Slice{
+				{SNssai: snssai, RAN: "10.0.10.1", CN: "10.0.5.1", AMF: "10.0.5.2", ID: "1", Default: true},
+				{SNssai: snssai, RAN: "10.0.11.1", CN: "10.0.6.1", ID: "2"},
+				{SNssai: snssai, RAN: "10.0.12.1", CN: "10.0.7.1", AMF: "10.0.7.2", ID: "3", Default: true},
+			}},
+			expect: []*factory.ControlPlane{
+				{RAN: "10.0.10.1", CN: "10.0.5.2", ID: 1},
+				{RAN: "10.0.12.1", CN: "10.0.7.2", ID: 3},
+			},
+		},
+		{
+			name: "control plane section wins",
+			configuration: &factory.Configuration{
+				Slice: []*factory.Slice{
+					{SNssai: snssai, RAN: "10.0.10.1", CN: "10.0.5.1", AMF: "10.0.5.2", ID: "1", Default: true},
+				},
+				ControlPlane: []*factory.ControlPlane{{RAN: "10.0.20.1", CN: "10.0.20.2", ID: 0}},
+			},
+			expect: []*factory.ControlPlane{{RAN: "10.0.20.1", CN: "10.0.20.2", ID: 0}},
+		},
+		{
+			name:          "no control plane",
+			configuration: &factory.Configuration{},
+		},
+		{
+			name: "slice ID out of range",
+			configuration: &factory.Configuration{Slice: []*factory.Slice{
+				{SNssai: snssai, RAN: "10.0.10.1", AMF: "10.0.5.2", ID: "256", Default: true},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "missing AMF",
+			configuration: &factory.Configuration{Slice: []*factory.Slice{
+				{SNssai: snssai, RAN: "10.0.10.1", CN: "10.0.5.1", ID: "1", Default: true},
+			}},
+			expectErr: true,
+		},
+		{
+			name: "duplicated pair",
+			configuration: &factory.Configuration{ControlPlane: []*factory.ControlPlane{
+				{RAN: "10.0.20.1", CN: "10.0.20.2", ID: 0},
+				{RAN: "10.0.20.1", CN: "10.0.20.2", ID: 1},
+			}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			controlPlanes, err := tc.configuration.ControlPlanes()
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, controlPlanes)
+		})
+	}
+}
@@ -44,3 +44,19 @@ func CheckConfigVersion() error {
 
 	return nil
 }
+
+func CheckControlPlaneConfig() error {
+	if QofConfig.Configuration == nil {
+		return fmt.Errorf("QOF config needs \"configuration\" value")
+	}
+
+	controlPlanes, err := QofConfig.Configuration.ControlPlanes()
+	if err != nil {
+		return err
+	}
+	if len(controlPlanes) == 0 {
+		logger.CfgLog.Warnln("No control plane slice configured, signaling will not be provisioned on the NTN QOF")
+	}
+
+	return nil
+}
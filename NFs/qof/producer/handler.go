@@ -13,6 +13,9 @@ import (
 
 // TranslateSnssai returns the UPF and RAN IP
 func TranslateSnssai(Snssai *models.Snssai) (upf string, ran string, id string, err error) {
+	if Snssai == nil {
+		return "", "", "", errors.New("missing S-NSSAI in session info")
+	}
 	for _, v := range context.QOF_Self().Slice {
 		if v.SNssai.Sst == Snssai.Sst && v.SNssai.Sd == Snssai.Sd {
 			upf = v.CN
@@ -42,6 +45,7 @@ func HandleSessionCreateQof(c *gin.Context) {
 		c.JSON(500, gin.H{
 			"message": "Error retrieving parameters",
 		})
+		return
 	}
 
 	upf, ran, id, err := TranslateSnssai(sessionInfo.Snssai)
@@ -50,6 +54,7 @@ func HandleSessionCreateQof(c *gin.Context) {
 		c.JSON(500, gin.H{
 			"message": err.Error(),
 		})
+		return
 	}
 
 	dscp := Translate5QI(sessionInfo.Var5QI)
@@ -65,9 +70,68 @@ func HandleSessionCreateQof(c *gin.Context) {
 		IPv4:    sessionInfo.IPv4,
 	}
 
-	consumer.NTN5GSessionCreate(ntnSession)
+	if err := consumer.NTN5GSessionCreate(ntnSession); err != nil {
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "success",
+	})
+}
+
+// HandleUsageReport accounts the usage report of a PDU session to its S-NSSAI
+// and forwards it to the NTN QOF for the satellite slice
+func HandleUsageReport(c *gin.Context) {
+
+	logger.PduSessLog.Infoln("Handling Usage Report from 5G QOF")
+
+	var usageReport factory.QOFUsageReport
+
+	if err := c.BindJSON(&usageReport); err != nil {
+		logger.PduSessLog.Errorln(err)
+		c.JSON(500, gin.H{
+			"message": "Error retrieving parameters",
+		})
+		return
+	}
+
+	_, _, id, err := TranslateSnssai(usageReport.Snssai)
+	if err != nil {
+		logger.PduSessLog.Errorln(err)
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	context.QOF_Self().AddUsageReport(&usageReport, id)
+
+	var ntnUsageReport *factory.NTNUsageReport = &factory.NTNUsageReport{
+		SliceID:        id,
+		StartTime:      usageReport.StartTime,
+		EndTime:        usageReport.EndTime,
+		UplinkVolume:   usageReport.UplinkVolume,
+		DownlinkVolume: usageReport.DownlinkVolume,
+		TotalVolume:    usageReport.TotalVolume,
+		Duration:       usageReport.Duration,
+	}
+
+	if err := consumer.NTNUsageReport(ntnUsageReport); err != nil {
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(200, gin.H{
 		"message": "success",
 	})
 }
+
+// HandleGetUsage returns the usage accumulated per S-NSSAI
+func HandleGetUsage(c *gin.Context) {
+	c.JSON(200, context.QOF_Self().GetSliceUsages())
+}
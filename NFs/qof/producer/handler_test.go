@@ -0,0 +1,339 @@
+package producer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/shynuu/qof/context"
+	"github.com/shynuu/qof/factory"
+	"github.com/shynuu/qof/producer"
+)
+
+// fakeNTN stands in for the NTNQOF and records every session forwarded by the QOF
+type fakeNTN struct {
+	server *httptest.Server
+	status int
+
+	mu           sync.Mutex
+	sessions     []factory.NTNSession
+	usageReports []factory.NTNUsageReport
+}
+
+func newFakeNTN(t *testing.T, status int) *fakeNTN {
+	f := &fakeNTN{status: status}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ntn-session/new-session", func(w http.ResponseWriter, r *http.Request) {
+		var session factory.NTNSession
+		if err := json.NewDecoder(r.Body).Decode(&session); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.sessions = append(f.sessions, session)
+		f.mu.Unlock()
+		w.WriteHeader(f.status)
+	})
+	mux.HandleFunc("/ntn-session/usage-report", func(w http.ResponseWriter, r *http.Request) {
+		var usageReport factory.NTNUsageReport
+		if err := json.NewDecoder(r.Body).Decode(&usageReport); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.usageReports = append(f.usageReports, usageReport)
+		f.mu.Unlock()
+		w.WriteHeader(f.status)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeNTN) receivedSessions() []factory.NTNSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]factory.NTNSession(nil), f.sessions...)
+}
+
+func (f *fakeNTN) receivedUsageReports() []factory.NTNUsageReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]factory.NTNUsageReport(nil), f.usageReports...)
+}
+
+// setupQOF loads a QOF context forwarding sessions to the given NTNQOF stand-in
+func setupQOF(ntn *fakeNTN) {
+	context.InitQofContext(&factory.Config{
+		Info: &factory.Info{Version: factory.QOF_EXPECTED_CONFIG_VERSION},
+		Configuration: &factory.Configuration{
+			QofName: "QOF",
+			Sbi: &factory.Sbi{
+				Scheme:       "http",
+				RegisterIPv4: "127.0.0.1",
+				BindingIPv4:  "127.0.0.1",
+				Port:         8090,
+			},
+			NtnUri: ntn.server.URL,
+			QoS: map[int32]uint16{
+				9: 0x12,
+				3: 0x11,
+			},
+			Slice: []*factory.Slice{
+				{SNssai: &models.Snssai{Sst: 1, Sd: "010203"}, RAN: "10.0.10.1", CN: "10.0.5.1", ID: "1"},
+				{SNssai: &models.Snssai{Sst: 1, Sd: "112233"}, RAN: "10.0.11.1", CN: "10.0.6.1", ID: "2"},
+			},
+		},
+	})
+}
+
+func newRouter() *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	return httptest.NewServer(producer.NewRouter())
+}
+
+// client does not use http.DefaultClient, whose transport is switched to HTTP/2 by the openapi clients
+var client = &http.Client{}
+
+func post(t *testing.T, uri string, body string) int {
+	resp, err := client.Post(uri, "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTranslateSnssai(t *testing.T) {
+	setupQOF(newFakeNTN(t, http.StatusOK))
+
+	testCases := []struct {
+		name      string
+		snssai    *models.Snssai
+		expectUPF string
+		expectRAN string
+		expectID  string
+		expectErr bool
+	}{
+		{"first slice", &models.Snssai{Sst: 1, Sd: "010203"}, "10.0.5.1", "10.0.10.1", "1", false},
+		{"second slice", &models.Snssai{Sst: 1, Sd: "112233"}, "10.0.6.1", "10.0.11.1", "2", false},
+		{"wrong sd", &models.Snssai{Sst: 1, Sd: "ffffff"}, "", "", "", true},
+		{"wrong sst", &models.Snssai{Sst: 2, Sd: "010203"}, "", "", "", true},
+		{"missing", nil, "", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upf, ran, id, err := producer.TranslateSnssai(tc.snssai)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectUPF, upf)
+			require.Equal(t, tc.expectRAN, ran)
+			require.Equal(t, tc.expectID, id)
+		})
+	}
+}
+
+func TestTranslate5QI(t *testing.T) {
+	setupQOF(newFakeNTN(t, http.StatusOK))
+
+	testCases := []struct {
+		name   string
+		var5qi int32
+		expect uint16
+	}{
+		{"default bearer", 9, 0x12},
+		{"gbr", 3, 0x11},
+		{"unmapped", 7, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expect, producer.Translate5QI(tc.var5qi))
+		})
+	}
+}
+
+func TestHandleSessionCreateQof(t *testing.T) {
+	testCases := []struct {
+		name           string
+		ntnStatus      int
+		body           string
+		expectStatus   int
+		expectSessions int
+	}{
+		{
+			name:      "known slice",
+			ntnStatus: http.StatusOK,
+			body: `{"sessionid":1,"Snssai":{"sst":1,"sd":"010203"},"supi":"imsi-208930000000003",
+				"uteid":1,"dteid":2,"ipv4":"60.60.0.1","var5qi":9}`,
+			expectStatus:   http.StatusOK,
+			expectSessions: 1,
+		},
+		{
+			name:         "unknown slice",
+			ntnStatus:    http.StatusOK,
+			body:         `{"sessionid":1,"Snssai":{"sst":4,"sd":"010203"},"uteid":1,"dteid":2,"var5qi":9}`,
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:         "missing slice",
+			ntnStatus:    http.StatusOK,
+			body:         `{"sessionid":1,"uteid":1,"dteid":2,"var5qi":9}`,
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:         "malformed body",
+			ntnStatus:    http.StatusOK,
+			body:         `{"sessionid":`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ntnqof rejects session",
+			ntnStatus:      http.StatusInternalServerError,
+			body:           `{"sessionid":1,"Snssai":{"sst":1,"sd":"010203"},"uteid":1,"dteid":2,"var5qi":9}`,
+			expectStatus:   http.StatusInternalServerError,
+			expectSessions: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ntn := newFakeNTN(t, tc.ntnStatus)
+			setupQOF(ntn)
+			router := newRouter()
+			defer router.Close()
+
+			require.Equal(t, tc.expectStatus, post(t, router.URL+"/qof-session/new-session", tc.body))
+			require.Len(t, ntn.receivedSessions(), tc.expectSessions)
+		})
+	}
+}
+
+func TestHandleSessionCreateQofUnreachableNTN(t *testing.T) {
+	ntn := newFakeNTN(t, http.StatusOK)
+	setupQOF(ntn)
+	ntn.server.Close()
+	router := newRouter()
+	defer router.Close()
+
+	require.Equal(t, http.StatusInternalServerError, post(t, router.URL+"/qof-session/new-session",
+		`{"sessionid":1,"Snssai":{"sst":1,"sd":"010203"},"uteid":1,"dteid":2,"var5qi":9}`))
+}
+
+func TestHandleSessionCreateQofTranslation(t *testing.T) {
+	ntn := newFakeNTN(t, http.StatusOK)
+	setupQOF(ntn)
+	router := newRouter()
+	defer router.Close()
+
+	require.Equal(t, http.StatusOK, post(t, router.URL+"/qof-session/new-session",
+		`{"sessionid":5,"Snssai":{"sst":1,"sd":"112233"},"supi":"imsi-208930000000003",
+		"uteid":7,"dteid":8,"ipv4":"60.60.0.7","var5qi":3}`))
+
+	require.Equal(t, []factory.NTNSession{{
+		RAN:        "10.0.11.1",
+		UPF:        "10.0.6.1",
+		SliceMatch: &factory.SliceMatch{UTEID: 7, DTEID: 8},
+		QosMatch:   &factory.QosMatch{DSCP: 0x11},
+		SliceID:    "2",
+		IPv4:       "60.60.0.7",
+	}}, ntn.receivedSessions())
+}
+
+func TestConcurrentSessionCreate(t *testing.T) {
+	const sessions = 32
+
+	ntn := newFakeNTN(t, http.StatusOK)
+	setupQOF(ntn)
+	router := newRouter()
+	defer router.Close()
+
+	var wg sync.WaitGroup
+	statuses := make([]int, sessions)
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"sessionid":%d,"Snssai":{"sst":1,"sd":"010203"},"uteid":%d,"dteid":%d,"var5qi":9}`,
+				i, 1000+i, 2000+i)
+			resp, err := client.Post(router.URL+"/qof-session/new-session", "application/json",
+				bytes.NewBufferString(body))
+			if err != nil {
+				return
+			}
+			statuses[i] = resp.StatusCode
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		require.Equal(t, http.StatusOK, status, "session %d", i)
+	}
+
+	teids := make(map[uint32]uint32)
+	for _, session := range ntn.receivedSessions() {
+		require.Equal(t, "1", session.SliceID)
+		require.Equal(t, uint16(0x12), session.QosMatch.DSCP)
+		teids[session.SliceMatch.UTEID] = session.SliceMatch.DTEID
+	}
+	require.Len(t, teids, sessions)
+	for uteid, dteid := range teids {
+		require.Equal(t, uteid+1000, dteid)
+	}
+}
+
+func TestHandleUsageReport(t *testing.T) {
+	ntn := newFakeNTN(t, http.StatusOK)
+	setupQOF(ntn)
+	router := newRouter()
+	defer router.Close()
+
+	for _, body := range []string{
+		`{"sessionid":1,"Snssai":{"sst":1,"sd":"010203"},"supi":"imsi-208930000000003",
+			"uplinkVolume":100,"downlinkVolume":400,"totalVolume":500,"duration":60}`,
+		`{"sessionid":2,"Snssai":{"sst":1,"sd":"010203"},"supi":"imsi-208930000000004",
+			"uplinkVolume":10,"downlinkVolume":40,"totalVolume":50,"duration":6}`,
+		`{"sessionid":1,"Snssai":{"sst":1,"sd":"112233"},"supi":"imsi-208930000000003",
+			"uplinkVolume":1,"downlinkVolume":2,"totalVolume":3,"duration":1}`,
+	} {
+		require.Equal(t, http.StatusOK, post(t, router.URL+"/qof-session/usage-report", body))
+	}
+	require.Equal(t, http.StatusInternalServerError, post(t, router.URL+"/qof-session/usage-report",
+		`{"sessionid":1,"Snssai":{"sst":4,"sd":"010203"},"totalVolume":3}`))
+
+	reports := ntn.receivedUsageReports()
+	require.Len(t, reports, 3)
+	require.Equal(t, factory.NTNUsageReport{
+		SliceID: "1", UplinkVolume: 100, DownlinkVolume: 400, TotalVolume: 500, Duration: 60,
+	}, reports[0])
+	require.Equal(t, "2", reports[2].SliceID)
+
+	resp, err := client.Get(router.URL + "/qof-session/usage")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var usages []factory.SliceUsage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&usages))
+	require.Equal(t, []factory.SliceUsage{
+		{
+			Snssai: models.Snssai{Sst: 1, Sd: "010203"}, SliceID: "1",
+			UplinkVolume: 110, DownlinkVolume: 440, TotalVolume: 550, Duration: 66, Reports: 2,
+		},
+		{
+			Snssai: models.Snssai{Sst: 1, Sd: "112233"}, SliceID: "2",
+			UplinkVolume: 1, DownlinkVolume: 2, TotalVolume: 3, Duration: 1, Reports: 1,
+		},
+	}, usages)
+}
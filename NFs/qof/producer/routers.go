@@ -70,4 +70,16 @@ var routes = Routes{
 		"/delete-session",
 		nil,
 	},
+	{
+		"HandleUsageReport",
+		"POST",
+		"/usage-report",
+		HandleUsageReport,
+	},
+	{
+		"HandleGetUsage",
+		"GET",
+		"/usage",
+		HandleGetUsage,
+	},
 }
@@ -18,6 +18,7 @@ import (
 	openApiLogger "github.com/free5gc/openapi/logger"
 	"github.com/free5gc/path_util"
 	pathUtilLogger "github.com/free5gc/path_util/logger"
+	"github.com/shynuu/qof/consumer"
 	"github.com/shynuu/qof/context"
 	"github.com/shynuu/qof/factory"
 	"github.com/shynuu/qof/logger"
@@ -25,7 +26,10 @@ import (
 	"github.com/shynuu/qof/util"
 )
 
-type QOF struct{}
+type QOF struct {
+	// stopProvisioning stops the control-plane provisioning of the NTN QOF on termination
+	stopProvisioning chan struct{}
+}
 
 type (
 	// Config information.
@@ -79,6 +83,10 @@ func (qof *QOF) Initialize(c *cli.Context) error {
 		return err
 	}
 
+	if err := factory.CheckControlPlaneConfig(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -202,7 +210,8 @@ func (qof *QOF) FilterCli(c *cli.Context) (args []string) {
 
 func (qof *QOF) Start() {
 	context.InitQofContext(&factory.QofConfig)
-	context.InitDefaultSlice()
+	qof.stopProvisioning = make(chan struct{})
+	go consumer.KeepControlPlaneProvisioned(qof.stopProvisioning)
 	// allocate id for each upf
 
 	initLog.Infoln("Server started")
@@ -255,6 +264,10 @@ func (qof *QOF) Start() {
 
 func (qof *QOF) Terminate() {
 	logger.InitLog.Infof("Terminating QOF...")
+	if qof.stopProvisioning != nil {
+		close(qof.stopProvisioning)
+		qof.stopProvisioning = nil
+	}
 	// deregister with NRF
 }
 
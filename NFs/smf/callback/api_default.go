@@ -50,3 +50,42 @@ func HTTPSmPolicyUpdateNotification(c *gin.Context) {
 func SmPolicyControlTerminationRequestNotification(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{})
 }
+
+// HTTPPfdChangeNotify - the NEF notifies the changes of the PFDs of the applications
+func HTTPPfdChangeNotify(c *gin.Context) {
+	var notifications []models.PfdChangeNotification
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.GinLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&notifications, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.GinLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	HTTPResponse := producer.HandlePfdChangeNotify(notifications)
+
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(HTTPResponse.Status)
+		return
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
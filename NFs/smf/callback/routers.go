@@ -70,4 +70,10 @@ var routes = Routes{
 		"/sm-policies/:smContextRef/terminate",
 		SmPolicyControlTerminationRequestNotification,
 	},
+	{
+		"PfdChangeNotify",
+		"POST",
+		"/pfd-changes",
+		HTTPPfdChangeNotify,
+	},
 }
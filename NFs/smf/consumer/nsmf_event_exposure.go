@@ -0,0 +1,37 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+)
+
+// SendSmfEventExposureNotification sends the event notifications to the notification URI of the subscription
+// (TS 29.508 5.2.2.3), the client of openapi can not carry the QoS flow change event
+func SendSmfEventExposureNotification(uri string, notification smf_context.NsmfEventExposureNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	logger.ConsumerLog.Infof("[SMF] Send SMF Event Exposure Notification to %s", uri)
+	client := http.Client{Timeout: 5 * time.Second}
+	httpResp, err := client.Post(uri, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rspCloseErr := httpResp.Body.Close(); rspCloseErr != nil {
+			logger.ConsumerLog.Errorf("SmfEventExposureNotification response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+	if httpResp.StatusCode != http.StatusNoContent && httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SMF Event Exposure Notification to %s returned status %d", uri, httpResp.StatusCode)
+	}
+	return nil
+}
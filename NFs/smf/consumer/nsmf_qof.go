@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/free5gc/smf/context"
 	smf_context "github.com/free5gc/smf/context"
@@ -47,3 +48,32 @@ func SendSessionQOF(sessionInfo *context.QOFSessionInfo) error {
 	logger.PduSessLog.Infoln(string(body))
 	return nil
 }
+
+// SendUsageReportQOF forwards the usage report of a PDU session to the QOF
+func SendUsageReportQOF(usageReport *context.QOFUsageReport) error {
+
+	var url string = fmt.Sprintf("%s/qof-session/usage-report", smf_context.SMF_Self().QofUri)
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	reqBody, err := json.Marshal(usageReport)
+	if err != nil {
+		logger.PduSessLog.Errorln("Impossible to serialize usage report")
+		return err
+	}
+
+	resp, err := client.Post(url,
+		"application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("QOF returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -3,10 +3,12 @@ package consumer
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/free5gc/nas/nasConvert"
+	"github.com/free5gc/openapi"
 	"github.com/free5gc/openapi/models"
 	smf_context "github.com/free5gc/smf/context"
 )
@@ -31,10 +33,16 @@ func SendSMPolicyAssociationCreate(smContext *smf_context.SMContext) (*models.Sm
 	smPolicyData.PduSessionType = nasConvert.PDUSessionTypeToModels(smContext.SelectedPDUSessionType)
 	smPolicyData.AccessType = smContext.AnType
 	smPolicyData.RatType = smContext.RatType
-	smPolicyData.Ipv4Address = smContext.PDUAddress.To4().String()
+	if smContext.PDUAddress != nil {
+		smPolicyData.Ipv4Address = smContext.PDUAddress.To4().String()
+	}
+	if prefix := smContext.IPv6Prefix(); prefix != nil {
+		smPolicyData.Ipv6AddressPrefix = prefix.String()
+	}
 	smPolicyData.SubsSessAmbr = smContext.DnnConfiguration.SessionAmbr
 	smPolicyData.SubsDefQos = smContext.DnnConfiguration.Var5gQosProfile
 	smPolicyData.SliceInfo = smContext.Snssai
+	smPolicyData.UserLocationInfo = smContext.UeLocation
 	smPolicyData.ServingNetwork = &models.NetworkId{
 		Mcc: smContext.ServingNetwork.Mcc,
 		Mnc: smContext.ServingNetwork.Mnc,
@@ -42,12 +50,69 @@ func SendSMPolicyAssociationCreate(smContext *smf_context.SMContext) (*models.Sm
 	smPolicyData.SuppFeat = "F"
 
 	var smPolicyDecision *models.SmPolicyDecision
-	if smPolicyDecisionFromPCF, _, err := smContext.SMPolicyClient.
+	if smPolicyDecisionFromPCF, httpResp, err := smContext.SMPolicyClient.
 		DefaultApi.SmPoliciesPost(context.Background(), smPolicyData); err != nil {
 		return nil, fmt.Errorf("setup sm policy association failed: %s", err)
 	} else {
 		smPolicyDecision = &smPolicyDecisionFromPCF
+		// the SM policy ID is the last segment of {apiRoot}/npcf-smpolicycontrol/v1/sm-policies/{smPolicyId}
+		if location := httpResp.Header.Get("Location"); location != "" {
+			smContext.SMPolicyID = location[strings.LastIndex(location, "/")+1:]
+		}
 	}
 
 	return smPolicyDecision, nil
 }
+
+// SendSMPolicyAssociationUpdateByUERequest requests the PCF to authorize the resource modification requested by
+// the UE (TS 29.512 4.2.4.17), the problem details are returned if the PCF rejects the request
+func SendSMPolicyAssociationUpdateByUERequest(smContext *smf_context.SMContext,
+	ueInitResReq *models.UeInitiatedResourceRequest) (*models.SmPolicyDecision, *models.ProblemDetails, error) {
+	if smContext.SMPolicyClient == nil || smContext.SMPolicyID == "" {
+		return nil, nil, errors.Errorf("smContext has no sm policy association")
+	}
+
+	updateSMPolicy := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{
+			models.PolicyControlRequestTrigger_RES_MO_RE,
+		},
+		UeInitResReq: ueInitResReq,
+	}
+
+	smPolicyDecision, httpResp, err := smContext.SMPolicyClient.
+		DefaultApi.SmPoliciesSmPolicyIdUpdatePost(context.Background(), smContext.SMPolicyID, updateSMPolicy)
+	if err == nil {
+		return &smPolicyDecision, nil, nil
+	} else if httpResp != nil {
+		if httpResp.Status != err.Error() {
+			return nil, nil, err
+		}
+		problem := err.(openapi.GenericOpenAPIError).Model().(models.ProblemDetails)
+		return nil, &problem, nil
+	} else {
+		return nil, nil, fmt.Errorf("update sm policy association failed: %s", err)
+	}
+}
+
+// SendSMPolicyAssociationUpdateByUsageReport reports the usage accumulated by the PDU session to the PCF for the
+// usage monitoring decisions (TS 29.512 4.2.4.10)
+func SendSMPolicyAssociationUpdateByUsageReport(smContext *smf_context.SMContext,
+	accuUsageReports []models.AccuUsageReport) (*models.SmPolicyDecision, error) {
+	if smContext.SMPolicyClient == nil || smContext.SMPolicyID == "" {
+		return nil, errors.Errorf("smContext has no sm policy association")
+	}
+
+	updateSMPolicy := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{
+			models.PolicyControlRequestTrigger_US_RE,
+		},
+		AccuUsageReports: accuUsageReports,
+	}
+
+	smPolicyDecision, _, err := smContext.SMPolicyClient.
+		DefaultApi.SmPoliciesSmPolicyIdUpdatePost(context.Background(), smContext.SMPolicyID, updateSMPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("update sm policy association failed: %s", err)
+	}
+	return &smPolicyDecision, nil
+}
@@ -1,6 +1,7 @@
 package context
 
 import (
+	"fmt"
 	"reflect"
 )
 
@@ -15,6 +16,8 @@ type BPManager struct {
 	ActivatingPath        *DataPath
 	UpdatedBranchingPoint map[*UPF]int
 	ULCL                  *UPF
+	// the activating path is removed from the PDU session after its activation finishes
+	ActivatingPathRemoved bool
 }
 type BPStatus int
 
@@ -87,12 +90,16 @@ func (bpMGR *BPManager) FindULCL(smContext *SMContext) error {
 	}
 
 	maxDepth := 0
+	bpMGR.ULCL = nil
 	for upf, depth := range bpMGR.UpdatedBranchingPoint {
 		if depth > maxDepth {
 			bpMGR.ULCL = upf
 			maxDepth = depth
 		}
 	}
+	if bpMGR.ULCL == nil {
+		return fmt.Errorf("data path of PSA2 has no branching point with the activated data paths")
+	}
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"net"
 	"os"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -56,6 +57,17 @@ type SMFContext struct {
 	ULCLSupport         bool
 	UEPreConfigPathPool map[string]*UEPreConfigPaths
 	LocalSEIDCount      uint64
+
+	UsageReport *factory.UsageReport
+
+	// PDU session address lifetime of the old PDU session on the relocation of SSC mode 3
+	PSAAddressLifetime time.Duration
+
+	// seconds without user plane traffic before the UPF reports the inactivity of the PDU session, 0 disables it
+	UserPlaneInactivityTimer uint32
+
+	// interval of the PFCP heartbeats the availability of the associated UPFs is checked with
+	PFCPHeartbeatInterval time.Duration
 }
 
 // RetrieveDnnInformation gets the corresponding dnn info from S-NSSAI and DNN
@@ -125,7 +137,11 @@ func InitSmfContext(config *factory.Config) {
 	}
 	smfContext.QofUri = configuration.QofUri
 
+	smfContext.PFCPHeartbeatInterval = factory.SMF_DEFAULT_PFCP_HEARTBEAT_INTERVAL * time.Second
 	if pfcp := configuration.PFCP; pfcp != nil {
+		if pfcp.HeartbeatInterval != 0 {
+			smfContext.PFCPHeartbeatInterval = time.Duration(pfcp.HeartbeatInterval) * time.Second
+		}
 		if pfcp.Port == 0 {
 			pfcp.Port = pfcpUdp.PFCP_PORT
 		}
@@ -161,12 +177,12 @@ func InitSmfContext(config *factory.Config) {
 		for _, dnnInfoConfig := range snssaiInfoConfig.DnnInfos {
 			dnnInfo := SnssaiSmfDnnInfo{}
 			dnnInfo.DNS.IPv4Addr = net.ParseIP(dnnInfoConfig.DNS.IPv4Addr).To4()
-			dnnInfo.DNS.IPv6Addr = net.ParseIP(dnnInfoConfig.DNS.IPv6Addr).To4()
-			if allocator, err := NewIPAllocator(dnnInfoConfig.UESubnet); err != nil {
-				logger.InitLog.Errorf("create ip allocator[%s] failed: %s", dnnInfoConfig.UESubnet, err)
+			dnnInfo.DNS.IPv6Addr = net.ParseIP(dnnInfoConfig.DNS.IPv6Addr).To16()
+			if ipam, err := NewUeIPAM(snssaiInfo.Snssai, dnnInfoConfig); err != nil {
+				logger.InitLog.Errorf("create UE IPAM of DNN[%s] failed: %s", dnnInfoConfig.Dnn, err)
 				continue
 			} else {
-				dnnInfo.UeIPAllocator = allocator
+				dnnInfo.UeIPAM = ipam
 			}
 			snssaiInfo.DnnInfos[dnnInfoConfig.Dnn] = &dnnInfo
 		}
@@ -184,7 +200,31 @@ func InitSmfContext(config *factory.Config) {
 
 	smfContext.ULCLSupport = configuration.ULCL
 
-	smfContext.OnlySupportIPv4 = true
+	if usageReport := configuration.UsageReport; usageReport != nil {
+		if usageReport.Period == 0 && usageReport.VolumeThreshold == 0 && usageReport.TimeThreshold == 0 {
+			logger.CtxLog.Warnln("Usage report has no trigger, URRs will not be installed")
+		} else {
+			smfContext.UsageReport = usageReport
+		}
+	}
+
+	smfContext.PSAAddressLifetime = factory.SMF_DEFAULT_PSA_ADDRESS_LIFETIME * time.Second
+	if psaRelocation := configuration.PSARelocation; psaRelocation != nil && psaRelocation.AddressLifetime != 0 {
+		smfContext.PSAAddressLifetime = time.Duration(psaRelocation.AddressLifetime) * time.Second
+	}
+	smfContext.UserPlaneInactivityTimer = configuration.UserPlaneInactivityTimer
+
+	smfContext.OnlySupportIPv4, smfContext.OnlySupportIPv6 = true, true
+	for _, snssaiInfo := range smfContext.SnssaiInfos {
+		for _, dnnInfo := range snssaiInfo.DnnInfos {
+			if dnnInfo.UeIPAM.SupportIPv4() {
+				smfContext.OnlySupportIPv6 = false
+			}
+			if dnnInfo.UeIPAM.SupportIPv6() {
+				smfContext.OnlySupportIPv4 = false
+			}
+		}
+	}
 
 	smfContext.UserPlaneInformation = NewUserPlaneInformation(&configuration.UserPlaneInformation)
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/smf/logger"
@@ -11,6 +12,10 @@ import (
 	"github.com/free5gc/util_3gpp"
 )
 
+// gtpuTransportType is the IP version of the N3 and N9 transport, the GTP-U tunnels are carried over IPv4 whatever
+// the PDU session type is
+const gtpuTransportType = nasMessage.PDUSessionTypeIPv4
+
 // GTPTunnel represents the GTP tunnel information
 type GTPTunnel struct {
 	SrcEndPoint  *DataPathNode
@@ -53,6 +58,8 @@ type Destination struct {
 	DestinationIP   string
 	DestinationPort string
 	Url             string
+	// the application detected with its PFDs provisioned to the UPF instead of the destination IP and port
+	ApplicationID string
 }
 
 func NewDataPathNode() *DataPathNode {
@@ -233,6 +240,40 @@ func (node *DataPathNode) DeactivateDownLinkTunnel(smContext *SMContext) {
 	node.DownLinkTunnel = &GTPTunnel{}
 }
 
+// RemoveTunnels marks the PDRs and FARs of the tunnels of the data path node to be removed from the UPF and releases
+// them, the QERs are kept since they are shared with the other data paths on the UPF. The removed rules are returned
+// to be sent in the PFCP Session Modification Request.
+func (node *DataPathNode) RemoveTunnels(smContext *SMContext) (pdrList []*PDR, farList []*FAR) {
+	for _, tunnel := range []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		if tunnel == nil || tunnel.PDR == nil {
+			continue
+		}
+		pdr := tunnel.PDR
+		pdr.State = RULE_REMOVE
+		pdrList = append(pdrList, pdr)
+		smContext.RemovePDRfromPFCPSession(node.UPF.NodeID, pdr)
+		if err := node.UPF.RemovePDR(pdr); err != nil {
+			logger.CtxLog.Warnln("Remove tunnel", err)
+		}
+		if far := pdr.FAR; far != nil {
+			far.State = RULE_REMOVE
+			farList = append(farList, far)
+			if err := node.UPF.RemoveFAR(far); err != nil {
+				logger.CtxLog.Warnln("Remove tunnel", err)
+			}
+			if far.BAR != nil {
+				if err := node.UPF.RemoveBAR(far.BAR); err != nil {
+					logger.CtxLog.Warnln("Remove tunnel", err)
+				}
+			}
+		}
+	}
+
+	node.UpLinkTunnel = &GTPTunnel{}
+	node.DownLinkTunnel = &GTPTunnel{}
+	return pdrList, farList
+}
+
 func (node *DataPathNode) GetUPFID() (id string, err error) {
 	node_ip := node.GetNodeIP()
 	var exist bool
@@ -284,6 +325,42 @@ func (dataPathPool DataPathPool) GetDefaultPath() (dataPath *DataPath) {
 	return
 }
 
+// HasInactiveDataPath returns whether a data path of the pool is waiting to be activated
+func (dataPathPool DataPathPool) HasInactiveDataPath() bool {
+	for _, path := range dataPathPool {
+		if !path.Activated {
+			return true
+		}
+	}
+	return false
+}
+
+// Dnai returns the DNAI served by the anchor UPF of the data path for the S-NSSAI and DNN, empty if not configured
+func (dataPath *DataPath) Dnai(snssai *models.Snssai, dnn string) string {
+	if dataPath == nil || dataPath.FirstDPNode == nil || snssai == nil {
+		return ""
+	}
+	node := dataPath.FirstDPNode
+	for !node.IsAnchorUPF() {
+		node = node.Next()
+	}
+	if node.UPF == nil {
+		return ""
+	}
+	target := SNssai{Sst: snssai.Sst, Sd: snssai.Sd}
+	for _, snssaiInfo := range node.UPF.SNssaiInfos {
+		if !snssaiInfo.SNssai.Equal(&target) {
+			continue
+		}
+		for _, dnnInfo := range snssaiInfo.DnnList {
+			if dnnInfo.Dnn == dnn && len(dnnInfo.DnaiList) > 0 {
+				return dnnInfo.DnaiList[0]
+			}
+		}
+	}
+	return ""
+}
+
 func (dataPath *DataPath) String() string {
 	firstDPNode := dataPath.FirstDPNode
 
@@ -295,6 +372,9 @@ func (dataPath *DataPath) String() string {
 	str += "Has Braching Point: " + strconv.FormatBool(dataPath.HasBranchingPoint) + "\n"
 	str += "Destination IP: " + dataPath.Destination.DestinationIP + "\n"
 	str += "Destination Port: " + dataPath.Destination.DestinationPort + "\n"
+	if dataPath.Destination.ApplicationID != "" {
+		str += "Application ID: " + dataPath.Destination.ApplicationID + "\n"
+	}
 
 	str += "DataPath Routing Information\n"
 	index := 1
@@ -367,6 +447,12 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 			}
 		}
 
+		// the usage of the session is measured once, on the anchor UPF
+		var usageURR *URR
+		if curDataPathNode.IsAnchorUPF() {
+			usageURR = smContext.anchorURR(curDataPathNode.UPF)
+		}
+
 		logger.CtxLog.Traceln("Calculate ", curDataPathNode.UPF.PFCPAddr().String())
 		curULTunnel := curDataPathNode.UpLinkTunnel
 		curDLTunnel := curDataPathNode.DownLinkTunnel
@@ -376,6 +462,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 			ULPDR := curULTunnel.PDR
 			ULDestUPF := curULTunnel.DestEndPoint.UPF
 			ULPDR.QER = append(ULPDR.QER, flowQER)
+			ULPDR.URR = usageURR
 
 			ULPDR.Precedence = precedence
 
@@ -386,7 +473,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 				iface = ULDestUPF.GetInterface(models.UpInterfaceType_N9, smContext.Dnn)
 			}
 
-			if upIP, err := iface.IP(smContext.SelectedPDUSessionType); err != nil {
+			if upIP, err := iface.IP(gtpuTransportType); err != nil {
 				logger.CtxLog.Errorln("ActivateTunnelAndPDR failed", err)
 				return
 			} else {
@@ -397,10 +484,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 						Ipv4Address: upIP,
 						Teid:        curULTunnel.TEID,
 					},
-					UEIPAddress: &pfcpType.UEIPAddress{
-						V4:          true,
-						Ipv4Address: smContext.PDUAddress.To4(),
-					},
+					UEIPAddress: smContext.UEIPAddress(false),
 				}
 			}
 
@@ -432,7 +516,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 				nextULTunnel := nextULDest.UpLinkTunnel
 				iface = nextULTunnel.DestEndPoint.UPF.GetInterface(models.UpInterfaceType_N9, smContext.Dnn)
 
-				if upIP, err := iface.IP(smContext.SelectedPDUSessionType); err != nil {
+				if upIP, err := iface.IP(gtpuTransportType); err != nil {
 					logger.CtxLog.Errorln("ActivateTunnelAndPDR failed", err)
 					return
 				} else {
@@ -451,22 +535,20 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 			DLPDR := curDLTunnel.PDR
 			DLDestUPF := curDLTunnel.DestEndPoint.UPF
 			DLPDR.QER = append(DLPDR.QER, flowQER)
+			DLPDR.URR = usageURR
 
 			DLPDR.Precedence = precedence
 
 			// TODO: Should delete this after FR5GC-1029 is solved
 			if curDataPathNode.IsAnchorUPF() {
-				DLPDR.PDI.UEIPAddress = &pfcpType.UEIPAddress{
-					V4:          true,
-					Ipv4Address: smContext.PDUAddress.To4(),
-				}
+				DLPDR.PDI.UEIPAddress = smContext.UEIPAddress(true)
 			} else {
 				DLPDR.OuterHeaderRemoval = &pfcpType.OuterHeaderRemoval{
 					OuterHeaderRemovalDescription: pfcpType.OuterHeaderRemovalGtpUUdpIpv4,
 				}
 
 				iface = DLDestUPF.GetInterface(models.UpInterfaceType_N9, smContext.Dnn)
-				if upIP, err := iface.IP(smContext.SelectedPDUSessionType); err != nil {
+				if upIP, err := iface.IP(gtpuTransportType); err != nil {
 					logger.CtxLog.Errorln("ActivateTunnelAndPDR failed", err)
 					return
 				} else {
@@ -505,7 +587,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 
 				iface = nextDLDest.UPF.GetInterface(models.UpInterfaceType_N9, smContext.Dnn)
 
-				if upIP, err := iface.IP(smContext.SelectedPDUSessionType); err != nil {
+				if upIP, err := iface.IP(gtpuTransportType); err != nil {
 					logger.CtxLog.Errorln("ActivateTunnelAndPDR failed", err)
 					return
 				} else {
@@ -541,10 +623,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 				DNDLPDR.PDI = PDI{
 					SourceInterface: pfcpType.SourceInterface{InterfaceValue: pfcpType.SourceInterfaceCore},
 					NetworkInstance: util_3gpp.Dnn(smContext.Dnn),
-					UEIPAddress: &pfcpType.UEIPAddress{
-						V4:          true,
-						Ipv4Address: smContext.PDUAddress.To4(),
-					},
+					UEIPAddress:     smContext.UEIPAddress(true),
 				}
 			}
 		}
@@ -560,6 +639,9 @@ func (dataPath *DataPath) DeactivateTunnelAndPDR(smContext *SMContext) {
 	for curDataPathNode := firstDPNode; curDataPathNode != nil; curDataPathNode = curDataPathNode.Next() {
 		curDataPathNode.DeactivateUpLinkTunnel(smContext)
 		curDataPathNode.DeactivateDownLinkTunnel(smContext)
+		if curDataPathNode.IsAnchorUPF() {
+			smContext.releaseAnchorURR(curDataPathNode.UPF)
+		}
 	}
 
 	dataPath.Activated = false
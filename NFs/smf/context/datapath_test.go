@@ -0,0 +1,61 @@
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+)
+
+func TestRemoveSteeringDataPath(t *testing.T) {
+	nodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: net.ParseIP("10.200.200.1").To4(),
+	}
+	upf := context.NewUPF(&nodeID, nil)
+	defer context.RemoveUPFNodeByNodeID(nodeID)
+	upf.SetStatus(context.AssociatedSetUpSuccess)
+
+	smContext := context.NewSMContext("imsi-208930000000046", 1)
+	defer context.RemoveSMContext(smContext.Ref)
+	smContext.Tunnel = context.NewUPTunnel()
+
+	node := context.NewDataPathNode()
+	node.UPF = upf
+	dataPath := context.NewDataPath()
+	dataPath.FirstDPNode = node
+	dataPath.Activated = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+
+	for _, tunnel := range []*context.GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		pdr, err := upf.AddPDR()
+		require.NoError(t, err)
+		require.NoError(t, smContext.PutPDRtoPFCPSession(nodeID, pdr))
+		tunnel.PDR = pdr
+	}
+	localSEID := smContext.PFCPContext[nodeID.ResolveNodeIdToIp().String()].LocalSEID
+
+	pdrList, farList := node.RemoveTunnels(smContext)
+	require.Len(t, pdrList, 2)
+	require.Len(t, farList, 2)
+	for _, pdr := range pdrList {
+		require.Equal(t, context.RULE_REMOVE, pdr.State)
+		require.Equal(t, context.RULE_REMOVE, pdr.FAR.State)
+	}
+	require.Empty(t, smContext.PFCPContext[nodeID.ResolveNodeIdToIp().String()].PDRs)
+	require.Nil(t, node.UpLinkTunnel.PDR)
+
+	smContext.Tunnel.RemoveDataPath(dataPath)
+	require.Empty(t, smContext.Tunnel.DataPathPool)
+
+	// the SM context is found by the local SEID until the PFCP Session Deletion Response
+	smContext.RemovePFCPSessionContext(nodeID)
+	require.Empty(t, smContext.PFCPContext)
+	require.Equal(t, smContext, context.GetSMContextBySEID(localSEID))
+	smContext.ReleaseRemovedLocalSEID(localSEID)
+	require.Nil(t, context.GetSMContextBySEID(localSEID))
+}
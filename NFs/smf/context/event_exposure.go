@@ -0,0 +1,183 @@
+package context
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// SmfEventQosChange reports the change of the QoS of a QoS flow, e.g. 5QI or GBR, Rel-15 Nsmf_EventExposure
+// has no such event
+const SmfEventQosChange models.SmfEvent = "QOS_CH"
+
+// subscription ID to *EventExposureSubscription
+var eventExposureSubscriptionPool sync.Map
+
+var eventExposureSubscriptionCount uint64
+
+// EventExposureSubscription is an Individual SMF Notification Subscription (TS 29.508 5.2.2.2)
+type EventExposureSubscription struct {
+	mu           sync.RWMutex
+	Subscription models.NsmfEventExposure
+	// reports left before the subscription is removed, nil for unlimited
+	remainReports *int32
+}
+
+func NewEventExposureSubscription(subscription models.NsmfEventExposure) *EventExposureSubscription {
+	subID := strconv.FormatUint(atomic.AddUint64(&eventExposureSubscriptionCount, 1), 10)
+	subscription.SubId = subID
+
+	eventSubscription := &EventExposureSubscription{
+		Subscription: subscription,
+	}
+	if subscription.MaxReportNbr > 0 {
+		eventSubscription.remainReports = new(int32)
+		*eventSubscription.remainReports = subscription.MaxReportNbr
+	}
+	eventExposureSubscriptionPool.Store(subID, eventSubscription)
+	return eventSubscription
+}
+
+func GetEventExposureSubscription(subID string) *EventExposureSubscription {
+	if value, ok := eventExposureSubscriptionPool.Load(subID); ok {
+		return value.(*EventExposureSubscription)
+	}
+	return nil
+}
+
+func RemoveEventExposureSubscription(subID string) {
+	eventExposureSubscriptionPool.Delete(subID)
+}
+
+// NsmfEventExposure returns a copy of the subscription, it is read with the lock of the subscription since
+// the subscription may be replaced by UpdateSubscription
+func (s *EventExposureSubscription) NsmfEventExposure() models.NsmfEventExposure {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Subscription
+}
+
+// UpdateSubscription replaces the subscription and keeps its ID
+func (s *EventExposureSubscription) UpdateSubscription(subscription models.NsmfEventExposure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription.SubId = s.Subscription.SubId
+	s.Subscription = subscription
+	s.remainReports = nil
+	if subscription.MaxReportNbr > 0 {
+		s.remainReports = new(int32)
+		*s.remainReports = subscription.MaxReportNbr
+	}
+}
+
+// EventSubscription returns the subscribed event of the subscription, nil if the event is not subscribed
+func (s *EventExposureSubscription) EventSubscription(event models.SmfEvent) *models.EventSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.Subscription.EventSubs {
+		if s.Subscription.EventSubs[i].Event == event {
+			return &s.Subscription.EventSubs[i]
+		}
+	}
+	return nil
+}
+
+// IsTargetOf returns true if the PDU session is a target of the subscription, i.e. any UE, the UE of SUPI or GPSI,
+// and the PDU session of the PDU session ID if present
+func (s *EventExposureSubscription) IsTargetOf(smContext *SMContext) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscription := &s.Subscription
+	if !subscription.AnyUeInd {
+		if subscription.Supi != "" {
+			if subscription.Supi != smContext.Supi {
+				return false
+			}
+		} else if subscription.Gpsi != "" {
+			if subscription.Gpsi != smContext.Gpsi {
+				return false
+			}
+		} else {
+			// group of UEs is not supported
+			return false
+		}
+	}
+	return subscription.PduSeId == 0 || subscription.PduSeId == smContext.PDUSessionID
+}
+
+// IsExpired returns true if the expiry time of the subscription is passed
+func (s *EventExposureSubscription) IsExpired() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Subscription.Expiry != nil && time.Now().After(*s.Subscription.Expiry)
+}
+
+// UseReport consumes a report of the subscription and returns false if no report is left,
+// the subscription is used up when the last report is consumed
+func (s *EventExposureSubscription) UseReport() (ok, usedUp bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.remainReports == nil {
+		return true, false
+	}
+	if *s.remainReports <= 0 {
+		return false, true
+	}
+	*s.remainReports--
+	return true, *s.remainReports == 0
+}
+
+// MarkReleaseNotified records that the release of the PDU session is notified, it returns false if the release is
+// already notified, e.g. by both the PDU Session Release Complete and the release of the SM context
+func (smContext *SMContext) MarkReleaseNotified() bool {
+	return atomic.CompareAndSwapInt32(&smContext.releaseNotified, 0, 1)
+}
+
+// EventExposureSubscriptionsOf returns the subscriptions to the event of the PDU session
+func EventExposureSubscriptionsOf(smContext *SMContext, event models.SmfEvent) []*EventExposureSubscription {
+	var subscriptions []*EventExposureSubscription
+	eventExposureSubscriptionPool.Range(func(key, value interface{}) bool {
+		subscription := value.(*EventExposureSubscription)
+		if subscription.EventSubscription(event) != nil && subscription.IsTargetOf(smContext) {
+			subscriptions = append(subscriptions, subscription)
+		}
+		return true
+	})
+	return subscriptions
+}
+
+// SMContexts returns the PDU sessions of the SMF
+func SMContexts() []*SMContext {
+	var smContexts []*SMContext
+	smContextPool.Range(func(key, value interface{}) bool {
+		smContexts = append(smContexts, value.(*SMContext))
+		return true
+	})
+	return smContexts
+}
+
+// QosFlowChange is the QoS of a QoS flow after the change, it is reported with SmfEventQosChange
+type QosFlowChange struct {
+	QosId   string      `json:"qosId,omitempty"`
+	Var5qi  int32       `json:"5qi,omitempty"`
+	GbrUl   string      `json:"gbrUl,omitempty"`
+	GbrDl   string      `json:"gbrDl,omitempty"`
+	MaxbrUl string      `json:"maxbrUl,omitempty"`
+	MaxbrDl string      `json:"maxbrDl,omitempty"`
+	Arp     *models.Arp `json:"arp,omitempty"`
+}
+
+// EventNotification is models.EventNotification extended with the QoS flow change
+type EventNotification struct {
+	models.EventNotification
+	QosFlowChanges []QosFlowChange `json:"qosFlowChanges,omitempty"`
+}
+
+// NsmfEventExposureNotification is models.NsmfEventExposureNotification of the extended event notifications
+type NsmfEventExposureNotification struct {
+	NotifId     string              `json:"notifId"`
+	EventNotifs []EventNotification `json:"eventNotifs"`
+}
@@ -0,0 +1,58 @@
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+)
+
+func TestEventExposureSubscription(t *testing.T) {
+	subscription := context.NewEventExposureSubscription(models.NsmfEventExposure{
+		Supi:         "imsi-208930000000003",
+		NotifUri:     "http://127.0.0.1:8000/notify",
+		EventSubs:    []models.EventSubscription{{Event: models.SmfEvent_PDU_SES_REL}},
+		MaxReportNbr: 2,
+	})
+	subID := subscription.NsmfEventExposure().SubId
+	defer context.RemoveEventExposureSubscription(subID)
+	require.NotEmpty(t, subID)
+	require.Equal(t, subscription, context.GetEventExposureSubscription(subID))
+
+	smContext := &context.SMContext{Supi: "imsi-208930000000003", PDUSessionID: 1}
+	require.True(t, subscription.IsTargetOf(smContext))
+	require.False(t, subscription.IsTargetOf(&context.SMContext{Supi: "imsi-208930000000004", PDUSessionID: 1}))
+	require.Equal(t, []*context.EventExposureSubscription{subscription},
+		context.EventExposureSubscriptionsOf(smContext, models.SmfEvent_PDU_SES_REL))
+	require.Empty(t, context.EventExposureSubscriptionsOf(smContext, models.SmfEvent_UP_PATH_CH))
+
+	ok, usedUp := subscription.UseReport()
+	require.True(t, ok)
+	require.False(t, usedUp)
+	ok, usedUp = subscription.UseReport()
+	require.True(t, ok)
+	require.True(t, usedUp)
+	ok, _ = subscription.UseReport()
+	require.False(t, ok)
+
+	subscription.UpdateSubscription(models.NsmfEventExposure{
+		AnyUeInd:  true,
+		PduSeId:   2,
+		NotifUri:  "http://127.0.0.1:8000/notify",
+		EventSubs: []models.EventSubscription{{Event: context.SmfEventQosChange}},
+	})
+	require.Equal(t, subID, subscription.NsmfEventExposure().SubId)
+	require.False(t, subscription.IsTargetOf(smContext))
+	require.True(t, subscription.IsTargetOf(&context.SMContext{Supi: "imsi-208930000000004", PDUSessionID: 2}))
+	ok, usedUp = subscription.UseReport()
+	require.True(t, ok)
+	require.False(t, usedUp)
+
+	require.True(t, smContext.MarkReleaseNotified())
+	require.False(t, smContext.MarkReleaseNotified())
+
+	context.RemoveEventExposureSubscription(subID)
+	require.Nil(t, context.GetEventExposureSubscription(subID))
+}
@@ -2,12 +2,12 @@ package context
 
 import (
 	"encoding/hex"
+	"time"
 
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasConvert"
 	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/nas/nasType"
-	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/smf/logger"
 )
 
@@ -27,25 +27,13 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	pDUSessionEstablishmentAccept.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionEstablishmentAccept.SetPTI(smContext.Pti)
 
-	selectedPDUSessionType := nasConvert.PDUSessionTypeToModels(smContext.SelectedPDUSessionType)
-	if selectedPDUSessionType == models.PduSessionType_IPV4_V6 {
-		onlySupportIPv4 := SMF_Self().OnlySupportIPv4
-		onlySupportIPv6 := SMF_Self().OnlySupportIPv6
-
-		if onlySupportIPv4 {
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
-			pDUSessionEstablishmentAccept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
-			pDUSessionEstablishmentAccept.SetCauseValue(nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed)
-		}
-		if onlySupportIPv6 {
-			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv6
-			pDUSessionEstablishmentAccept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
-			pDUSessionEstablishmentAccept.SetCauseValue(nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed)
-		}
+	if smContext.PDUSessionTypeCause != 0 {
+		pDUSessionEstablishmentAccept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
+		pDUSessionEstablishmentAccept.SetCauseValue(smContext.PDUSessionTypeCause)
 	}
 	pDUSessionEstablishmentAccept.SetPDUSessionType(smContext.SelectedPDUSessionType)
 
-	pDUSessionEstablishmentAccept.SetSSCMode(1)
+	pDUSessionEstablishmentAccept.SetSSCMode(smContext.SelectedSSCMode)
 	pDUSessionEstablishmentAccept.SessionAMBR = nasConvert.ModelsToSessionAMBR(sessRule.AuthSessAmbr)
 	pDUSessionEstablishmentAccept.SessionAMBR.SetLen(uint8(len(pDUSessionEstablishmentAccept.SessionAMBR.Octet)))
 
@@ -74,7 +62,7 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	pDUSessionEstablishmentAccept.AuthorizedQosRules.SetLen(uint16(len(qosRulesBytes)))
 	pDUSessionEstablishmentAccept.AuthorizedQosRules.SetQosRule(qosRulesBytes)
 
-	if smContext.PDUAddress != nil {
+	if smContext.PDUAddress != nil || smContext.PDUAddressV6 != nil {
 		addr, addrLen := smContext.PDUAddressToNAS()
 		pDUSessionEstablishmentAccept.PDUAddress =
 			nasType.NewPDUAddress(nasMessage.PDUSessionEstablishmentAcceptPDUAddressType)
@@ -88,9 +76,6 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	pDUSessionEstablishmentAccept.AuthorizedQosFlowDescriptions.SetLen(6)
 	pDUSessionEstablishmentAccept.SetQoSFlowDescriptions([]uint8{uint8(authDefQos.Var5qi), 0x20, 0x41, 0x01, 0x01, 0x09})
 
-	pDUSessionEstablishmentAccept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
-	pDUSessionEstablishmentAccept.Cause5GSM.SetCauseValue(nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed)
-
 	var sd [3]uint8
 
 	if byteArray, err := hex.DecodeString(smContext.Snssai.Sd); err != nil {
@@ -110,46 +95,44 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	pDUSessionEstablishmentAccept.DNN.SetDNN(dnn)
 
 	if smContext.ProtocolConfigurationOptions.DNSIPv4Request || smContext.ProtocolConfigurationOptions.DNSIPv6Request {
-		if smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest {
-			pDUSessionEstablishmentAccept.ExtendedProtocolConfigurationOptions =
-				nasType.NewExtendedProtocolConfigurationOptions(
-					nasMessage.PDUSessionEstablishmentAcceptExtendedProtocolConfigurationOptionsType,
-				)
-			protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
-
-			// IPv4 DNS
-			if smContext.ProtocolConfigurationOptions.DNSIPv4Request {
-				err := protocolConfigurationOptions.AddDNSServerIPv4Address(smContext.DNNInfo.DNS.IPv4Addr)
-				if err != nil {
-					logger.GsmLog.Warnln("Error while adding DNS IPv4 Addr: ", err)
-				}
+		pDUSessionEstablishmentAccept.ExtendedProtocolConfigurationOptions =
+			nasType.NewExtendedProtocolConfigurationOptions(
+				nasMessage.PDUSessionEstablishmentAcceptExtendedProtocolConfigurationOptionsType,
+			)
+		protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
+
+		// IPv4 DNS
+		if smContext.ProtocolConfigurationOptions.DNSIPv4Request {
+			err := protocolConfigurationOptions.AddDNSServerIPv4Address(smContext.DNNInfo.DNS.IPv4Addr)
+			if err != nil {
+				logger.GsmLog.Warnln("Error while adding DNS IPv4 Addr: ", err)
 			}
+		}
 
-			// IPv6 DNS
-			if smContext.ProtocolConfigurationOptions.DNSIPv6Request {
-				err := protocolConfigurationOptions.AddDNSServerIPv6Address(smContext.DNNInfo.DNS.IPv6Addr)
-				if err != nil {
-					logger.GsmLog.Warnln("Error while adding DNS IPv6 Addr: ", err)
-				}
+		// IPv6 DNS
+		if smContext.ProtocolConfigurationOptions.DNSIPv6Request {
+			err := protocolConfigurationOptions.AddDNSServerIPv6Address(smContext.DNNInfo.DNS.IPv6Addr)
+			if err != nil {
+				logger.GsmLog.Warnln("Error while adding DNS IPv6 Addr: ", err)
 			}
+		}
 
-			// MTU
-			if smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest {
-				err := protocolConfigurationOptions.AddIPv4LinkMTU(1400)
-				if err != nil {
-					logger.GsmLog.Warnln("Error while adding MTU: ", err)
-				}
+		// MTU
+		if smContext.ProtocolConfigurationOptions.IPv4LinkMTURequest {
+			err := protocolConfigurationOptions.AddIPv4LinkMTU(1400)
+			if err != nil {
+				logger.GsmLog.Warnln("Error while adding MTU: ", err)
 			}
-
-			pcoContents := protocolConfigurationOptions.Marshal()
-			pcoContentsLength := len(pcoContents)
-			pDUSessionEstablishmentAccept.
-				ExtendedProtocolConfigurationOptions.
-				SetLen(uint16(pcoContentsLength))
-			pDUSessionEstablishmentAccept.
-				ExtendedProtocolConfigurationOptions.
-				SetExtendedProtocolConfigurationOptionsContents(pcoContents)
 		}
+
+		pcoContents := protocolConfigurationOptions.Marshal()
+		pcoContentsLength := len(pcoContents)
+		pDUSessionEstablishmentAccept.
+			ExtendedProtocolConfigurationOptions.
+			SetLen(uint16(pcoContentsLength))
+		pDUSessionEstablishmentAccept.
+			ExtendedProtocolConfigurationOptions.
+			SetExtendedProtocolConfigurationOptionsContents(pcoContents)
 	}
 	return m.PlainNasEncode()
 }
@@ -170,7 +153,7 @@ func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([
 	return m.PlainNasEncode()
 }
 
-func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
+func BuildGSMPDUSessionReleaseCommand(smContext *SMContext, cause uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionReleaseCommand)
@@ -182,7 +165,7 @@ func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
 	pDUSessionReleaseCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionReleaseCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionReleaseCommand.SetPTI(smContext.Pti)
-	pDUSessionReleaseCommand.SetCauseValue(0x0)
+	pDUSessionReleaseCommand.SetCauseValue(cause)
 
 	return m.PlainNasEncode()
 }
@@ -199,13 +182,101 @@ func BuildGSMPDUSessionModificationCommand(smContext *SMContext) ([]byte, error)
 	pDUSessionModificationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionModificationCommand.SetPTI(smContext.Pti)
 	pDUSessionModificationCommand.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
-	// pDUSessionModificationCommand.SetQosRule()
-	// pDUSessionModificationCommand.AuthorizedQosRules.SetLen()
-	// pDUSessionModificationCommand.SessionAMBR.SetSessionAMBRForDownlink([2]uint8{0x11, 0x11})
-	// pDUSessionModificationCommand.SessionAMBR.SetSessionAMBRForUplink([2]uint8{0x11, 0x11})
-	// pDUSessionModificationCommand.SessionAMBR.SetUnitForSessionAMBRForDownlink(10)
-	// pDUSessionModificationCommand.SessionAMBR.SetUnitForSessionAMBRForUplink(10)
-	// pDUSessionModificationCommand.SessionAMBR.SetLen(uint8(len(pDUSessionModificationCommand.SessionAMBR.Octet)))
+
+	if sessRule := smContext.SelectedSessionRule(); sessRule != nil && sessRule.AuthSessAmbr != nil {
+		sessionAMBR := nasConvert.ModelsToSessionAMBR(sessRule.AuthSessAmbr)
+		sessionAMBR.SetIei(nasMessage.PDUSessionModificationCommandSessionAMBRType)
+		sessionAMBR.SetLen(uint8(len(sessionAMBR.Octet)))
+		pDUSessionModificationCommand.SessionAMBR = &sessionAMBR
+	}
+
+	// QoS rules and QoS flow descriptions of the QoS flows with pending operations
+	var qosRules QoSRules
+	var qosFlowDescriptions QoSFlowDescriptions
+	for _, flow := range smContext.QoSFlows {
+		if flow.Operation == 0 {
+			continue
+		}
+		qosRules = append(qosRules, flow.QoSRule())
+		qosFlowDescriptions = append(qosFlowDescriptions, flow.Description())
+	}
+
+	if len(qosRules) > 0 {
+		qosRulesBytes, err := qosRules.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pDUSessionModificationCommand.AuthorizedQosRules =
+			nasType.NewAuthorizedQosRules(nasMessage.PDUSessionModificationCommandAuthorizedQosRulesType)
+		pDUSessionModificationCommand.AuthorizedQosRules.SetLen(uint16(len(qosRulesBytes)))
+		pDUSessionModificationCommand.AuthorizedQosRules.SetQosRule(qosRulesBytes)
+
+		qosFlowDescriptionsBytes, err := qosFlowDescriptions.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pDUSessionModificationCommand.AuthorizedQosFlowDescriptions =
+			nasType.NewAuthorizedQosFlowDescriptions(nasMessage.PDUSessionModificationCommandAuthorizedQosFlowDescriptionsType)
+		pDUSessionModificationCommand.AuthorizedQosFlowDescriptions.SetLen(uint16(len(qosFlowDescriptionsBytes)))
+		pDUSessionModificationCommand.AuthorizedQosFlowDescriptions.SetQoSFlowDescriptions(qosFlowDescriptionsBytes)
+	}
+
+	return m.PlainNasEncode()
+}
+
+func BuildGSMPDUSessionModificationReject(smContext *SMContext, cause uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionModificationReject)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionModificationReject = nasMessage.NewPDUSessionModificationReject(0x0)
+	pDUSessionModificationReject := m.PDUSessionModificationReject
+
+	pDUSessionModificationReject.SetMessageType(nas.MsgTypePDUSessionModificationReject)
+	pDUSessionModificationReject.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pDUSessionModificationReject.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionModificationReject.SetPTI(smContext.Pti)
+	pDUSessionModificationReject.SetCauseValue(cause)
+
+	return m.PlainNasEncode()
+}
+
+// BuildGSMPDUSessionAnchorRelocationCommand builds the PDU Session Modification Command requesting the UE to
+// re-establish the PDU session of SSC mode 3 to the same DN before the PDU session address lifetime expires
+// (TS 23.502 4.3.5.2)
+func BuildGSMPDUSessionAnchorRelocationCommand(smContext *SMContext, addressLifetime time.Duration) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionModificationCommand = nasMessage.NewPDUSessionModificationCommand(0x0)
+	pDUSessionModificationCommand := m.PDUSessionModificationCommand
+
+	pDUSessionModificationCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pDUSessionModificationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionModificationCommand.SetPTI(smContext.Pti)
+	pDUSessionModificationCommand.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+
+	pDUSessionModificationCommand.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionModificationCommandCause5GSMType)
+	pDUSessionModificationCommand.Cause5GSM.SetCauseValue(nasMessage.Cause5GSMReactivationRequested)
+
+	// the PDU session address lifetime is coded as the value part of GPRS timer 3 (TS 24.008 10.5.6.3.1)
+	protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
+	addressLifetimeContainer := nasConvert.NewProtocolOrContainerUnit()
+	addressLifetimeContainer.ProtocolOrContainerID = nasMessage.PDUSessionAddressLifetimeDL
+	addressLifetimeContainer.LengthOfContents = 1
+	addressLifetimeContainer.Contents = []byte{nasConvert.GPRSTimer3ToNas(int(addressLifetime.Seconds()))}
+	protocolConfigurationOptions.ProtocolOrContainerList =
+		append(protocolConfigurationOptions.ProtocolOrContainerList, addressLifetimeContainer)
+
+	pcoContents := protocolConfigurationOptions.Marshal()
+	pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions =
+		nasType.NewExtendedProtocolConfigurationOptions(
+			nasMessage.PDUSessionModificationCommandExtendedProtocolConfigurationOptionsType,
+		)
+	pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(pcoContents)))
+	pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions.
+		SetExtendedProtocolConfigurationOptionsContents(pcoContents)
 
 	return m.PlainNasEncode()
 }
@@ -1,6 +1,8 @@
 package context
 
 import (
+	"fmt"
+
 	"github.com/free5gc/nas/nasConvert"
 	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/smf/logger"
@@ -40,6 +42,13 @@ func (smContext *SMContext) HandlePDUSessionEstablishmentRequest(req *nasMessage
 		smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
 	}
 
+	// Handle SSCMode
+	var requestedSSCMode uint8
+	if req.SSCMode != nil {
+		requestedSSCMode = req.SSCMode.GetSSCMode()
+	}
+	smContext.selectSSCMode(requestedSSCMode)
+
 	if req.ExtendedProtocolConfigurationOptions != nil {
 		EPCOContents := req.ExtendedProtocolConfigurationOptions.GetExtendedProtocolConfigurationOptionsContents()
 		protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
@@ -139,3 +148,55 @@ func (smContext *SMContext) HandlePDUSessionReleaseRequest(req *nasMessage.PDUSe
 	// Retrieve PTI (Procedure transaction identity)
 	smContext.Pti = req.GetPTI()
 }
+
+// HandlePDUSessionModificationRequest returns the QoS rules and QoS flow descriptions requested by the UE
+func (smContext *SMContext) HandlePDUSessionModificationRequest(
+	req *nasMessage.PDUSessionModificationRequest) (QoSRules, QoSFlowDescriptions, error) {
+	logger.GsmLog.Infof("Handle Pdu Session Modification Request")
+
+	// Retrieve PTI (Procedure transaction identity)
+	smContext.Pti = req.GetPTI()
+
+	var qosRules QoSRules
+	if req.RequestedQosRules != nil {
+		if err := qosRules.UnmarshalBinary(req.RequestedQosRules.GetQoSRules()); err != nil {
+			return nil, nil, fmt.Errorf("decode requested QoS rules failed: %s", err)
+		}
+	}
+
+	var qosFlowDescriptions QoSFlowDescriptions
+	if req.RequestedQosFlowDescriptions != nil {
+		if err := qosFlowDescriptions.UnmarshalBinary(req.RequestedQosFlowDescriptions.GetQoSFlowDescriptions()); err != nil {
+			return nil, nil, fmt.Errorf("decode requested QoS flow descriptions failed: %s", err)
+		}
+	}
+
+	return qosRules, qosFlowDescriptions, nil
+}
+
+// HandlePDUSessionModificationComplete completes the pending operations of the QoS flows
+func (smContext *SMContext) HandlePDUSessionModificationComplete(req *nasMessage.PDUSessionModificationComplete) {
+	logger.GsmLog.Infof("Handle Pdu Session Modification Complete")
+
+	for qfi, flow := range smContext.QoSFlows {
+		if flow.Operation == OperationCodeDeleteExistingQoSRule {
+			delete(smContext.QoSFlows, qfi)
+		}
+		flow.Operation = 0
+	}
+}
+
+// HandlePDUSessionModificationCommandReject handles the PDU Session Modification Command rejected by the UE, the
+// user plane of the QoS flows is kept as authorized by the PCF
+func (smContext *SMContext) HandlePDUSessionModificationCommandReject(
+	req *nasMessage.PDUSessionModificationCommandReject) {
+	logger.GsmLog.Warnf("PDU Session Modification Command is rejected by the UE, cause[%d]", req.GetCauseValue())
+
+	for qfi, flow := range smContext.QoSFlows {
+		if flow.Operation == OperationCodeDeleteExistingQoSRule {
+			delete(smContext.QoSFlows, qfi)
+			continue
+		}
+		flow.Operation = 0
+	}
+}
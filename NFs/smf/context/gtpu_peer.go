@@ -0,0 +1,75 @@
+package context
+
+import (
+	"net"
+	"time"
+)
+
+// gtpuPeerDownTime is how long the user plane path to a failed remote GTP-U peer is avoided, the UPF reports the
+// path failure only, so the path is tried again afterwards
+const gtpuPeerDownTime = 5 * time.Minute
+
+// SetGTPUPeerDown records the user plane path failure the UPF reports for the remote GTP-U peer
+// (TS 29.244 5.22)
+func (upf *UPF) SetGTPUPeerDown(peer net.IP) {
+	upf.failedPeersLock.Lock()
+	defer upf.failedPeersLock.Unlock()
+	if upf.failedPeers == nil {
+		upf.failedPeers = make(map[string]time.Time)
+	}
+	upf.failedPeers[peer.String()] = time.Now()
+}
+
+// IsGTPUPeerDown reports whether the user plane path from the UPF to the remote GTP-U peer has failed recently
+func (upf *UPF) IsGTPUPeerDown(peer net.IP) bool {
+	upf.failedPeersLock.Lock()
+	defer upf.failedPeersLock.Unlock()
+	failedAt, exist := upf.failedPeers[peer.String()]
+	if !exist {
+		return false
+	}
+	if time.Since(failedAt) > gtpuPeerDownTime {
+		delete(upf.failedPeers, peer.String())
+		return false
+	}
+	return true
+}
+
+// ResetGTPUPeers forgets the user plane path failures of the UPF, e.g. when its PFCP association is set up again
+func (upf *UPF) ResetGTPUPeers() {
+	upf.failedPeersLock.Lock()
+	defer upf.failedPeersLock.Unlock()
+	upf.failedPeers = nil
+}
+
+// isLinkDown reports whether the UPF of either node reports a user plane path failure towards the other node
+func isLinkDown(cur, next *UPNode) bool {
+	return isPeerDown(cur, next) || isPeerDown(next, cur)
+}
+
+func isPeerDown(node, peer *UPNode) bool {
+	if node.UPF == nil {
+		return false
+	}
+	if peer.Type == UPNODE_AN {
+		return peer.ANIP != nil && node.UPF.IsGTPUPeerDown(peer.ANIP)
+	}
+	if peer.UPF == nil {
+		return false
+	}
+	for _, ifaces := range [][]UPFInterfaceInfo{peer.UPF.N3Interfaces, peer.UPF.N9Interfaces} {
+		for _, iface := range ifaces {
+			for _, addr := range iface.IPv4EndPointAddresses {
+				if node.UPF.IsGTPUPeerDown(addr) {
+					return true
+				}
+			}
+			for _, addr := range iface.IPv6EndPointAddresses {
+				if node.UPF.IsGTPUPeerDown(addr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
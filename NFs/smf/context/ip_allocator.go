@@ -2,14 +2,19 @@ package context
 
 import (
 	"errors"
+	"fmt"
 	"net"
-
-	"github.com/free5gc/idgenerator"
+	"sync"
 )
 
+// IPAllocator allocates the host addresses of an IPv4 subnet, the network and broadcast addresses are excluded
 type IPAllocator struct {
 	ipNetwork *net.IPNet
-	g         *idgenerator.IDGenerator
+	size      int64
+
+	mu        sync.Mutex
+	next      int64
+	allocated map[int64]bool
 }
 
 func NewIPAllocator(cidr string) (*IPAllocator, error) {
@@ -17,10 +22,17 @@ func NewIPAllocator(cidr string) (*IPAllocator, error) {
 
 	if _, ipnet, err := net.ParseCIDR(cidr); err != nil {
 		return nil, err
+	} else if ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 subnet", cidr)
 	} else {
 		allocator.ipNetwork = ipnet
 	}
-	allocator.g = idgenerator.NewGenerator(1, 1<<int64(32-maskBits(allocator.ipNetwork.Mask))-2)
+	allocator.size = 1<<int64(32-maskBits(allocator.ipNetwork.Mask)) - 2
+	if allocator.size <= 0 {
+		return nil, fmt.Errorf("%s has no host address", cidr)
+	}
+	allocator.next = 1
+	allocator.allocated = make(map[int64]bool)
 
 	return allocator, nil
 }
@@ -71,14 +83,75 @@ func IPAddrOffset(in, base net.IP) int {
 
 // Allocate will allocate the IP address and returns it
 func (a *IPAllocator) Allocate() (net.IP, error) {
-	if offset, err := a.g.Allocate(); err != nil {
-		return nil, errors.New("ip allocation failed" + err.Error())
-	} else {
-		return IPAddrWithOffset(a.ipNetwork.IP, int(offset)), nil
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := int64(0); i < a.size; i++ {
+		offset := a.next
+		a.next = a.next%a.size + 1
+		if !a.allocated[offset] {
+			a.allocated[offset] = true
+			return IPAddrWithOffset(a.ipNetwork.IP, int(offset)), nil
+		}
 	}
+	return nil, errors.New("ip allocation failed: " + a.ipNetwork.String() + " is exhausted")
+}
+
+// Reserve allocates the given IP address, it fails if the address is out of the subnet or already allocated
+func (a *IPAllocator) Reserve(ip net.IP) error {
+	offset, ok := a.offset(ip)
+	if !ok {
+		return fmt.Errorf("%s is not a host address of %s", ip, a.ipNetwork)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.allocated[offset] {
+		return fmt.Errorf("%s is already allocated", ip)
+	}
+	a.allocated[offset] = true
+	return nil
 }
 
 func (a *IPAllocator) Release(ip net.IP) {
-	offset := IPAddrOffset(ip, a.ipNetwork.IP)
-	a.g.FreeID(int64(offset))
+	offset, ok := a.offset(ip)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.allocated, offset)
+}
+
+// Contains reports whether the IP address is a host address of the subnet
+func (a *IPAllocator) Contains(ip net.IP) bool {
+	_, ok := a.offset(ip)
+	return ok
+}
+
+// Usage returns the number of the allocated addresses and of all the host addresses of the subnet
+func (a *IPAllocator) Usage() (used, total int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return int64(len(a.allocated)), a.size
+}
+
+func (a *IPAllocator) String() string {
+	return a.ipNetwork.String()
+}
+
+func (a *IPAllocator) offset(ip net.IP) (int64, bool) {
+	ip = ip.To4()
+	if ip == nil || !a.ipNetwork.Contains(ip) {
+		return 0, false
+	}
+	offset := int64(IPAddrOffset(ip, a.ipNetwork.IP.To4()))
+	if offset < 1 || offset > a.size {
+		return 0, false
+	}
+	return offset, true
 }
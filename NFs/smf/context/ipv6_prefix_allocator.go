@@ -0,0 +1,133 @@
+package context
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// IPv6PrefixLength is the length of the IPv6 prefix delegated to a PDU session (TS 23.501 5.8.2.2.3)
+const IPv6PrefixLength = 64
+
+// IPv6PrefixAllocator allocates the /64 prefixes of an IPv6 subnet
+type IPv6PrefixAllocator struct {
+	ipNetwork *net.IPNet
+	base      uint64 // the upper 64 bits of the subnet
+	size      uint64
+
+	mu        sync.Mutex
+	next      uint64
+	allocated map[uint64]bool
+}
+
+func NewIPv6PrefixAllocator(cidr string) (*IPv6PrefixAllocator, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ipnet.IP.To4() != nil {
+		return nil, fmt.Errorf("%s is not an IPv6 subnet", cidr)
+	}
+	ones, _ := ipnet.Mask.Size()
+	if ones > IPv6PrefixLength {
+		return nil, fmt.Errorf("%s is longer than a /%d prefix", cidr, IPv6PrefixLength)
+	}
+	bits := IPv6PrefixLength - ones
+	if bits > 62 {
+		bits = 62
+	}
+
+	return &IPv6PrefixAllocator{
+		ipNetwork: ipnet,
+		base:      binary.BigEndian.Uint64(ipnet.IP.To16()[:8]),
+		size:      1 << uint(bits),
+		allocated: make(map[uint64]bool),
+	}, nil
+}
+
+// Allocate will allocate a /64 prefix and returns it
+func (a *IPv6PrefixAllocator) Allocate() (*net.IPNet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// one of the len(allocated)+1 prefixes from the next one is free unless the subnet is exhausted
+	for i := uint64(0); i < a.size && i <= uint64(len(a.allocated)); i++ {
+		offset := a.next
+		a.next = (a.next + 1) % a.size
+		if !a.allocated[offset] {
+			a.allocated[offset] = true
+			return a.prefix(offset), nil
+		}
+	}
+	return nil, errors.New("prefix allocation failed: " + a.ipNetwork.String() + " is exhausted")
+}
+
+// Reserve allocates the given /64 prefix, it fails if the prefix is out of the subnet or already allocated
+func (a *IPv6PrefixAllocator) Reserve(prefix net.IP) error {
+	offset, ok := a.offset(prefix)
+	if !ok {
+		return fmt.Errorf("%s is not a /%d prefix of %s", prefix, IPv6PrefixLength, a.ipNetwork)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.allocated[offset] {
+		return fmt.Errorf("%s is already allocated", prefix)
+	}
+	a.allocated[offset] = true
+	return nil
+}
+
+func (a *IPv6PrefixAllocator) Release(prefix net.IP) {
+	offset, ok := a.offset(prefix)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.allocated, offset)
+}
+
+// Contains reports whether the address is in a /64 prefix of the subnet
+func (a *IPv6PrefixAllocator) Contains(ip net.IP) bool {
+	_, ok := a.offset(ip)
+	return ok
+}
+
+// Usage returns the number of the allocated prefixes and of all the /64 prefixes of the subnet
+func (a *IPv6PrefixAllocator) Usage() (used, total int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return int64(len(a.allocated)), int64(a.size)
+}
+
+func (a *IPv6PrefixAllocator) String() string {
+	return a.ipNetwork.String()
+}
+
+func (a *IPv6PrefixAllocator) prefix(offset uint64) *net.IPNet {
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[:8], a.base+offset)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(IPv6PrefixLength, 8*net.IPv6len)}
+}
+
+func (a *IPv6PrefixAllocator) offset(ip net.IP) (uint64, bool) {
+	if ip.To4() != nil {
+		return 0, false
+	}
+	ip = ip.To16()
+	if ip == nil || !a.ipNetwork.Contains(ip) {
+		return 0, false
+	}
+	offset := binary.BigEndian.Uint64(ip[:8]) - a.base
+	if offset >= a.size {
+		return 0, false
+	}
+	return offset, true
+}
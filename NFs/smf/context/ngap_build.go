@@ -5,11 +5,25 @@ import (
 	"fmt"
 
 	"github.com/free5gc/aper"
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/ngap/ngapType"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/util"
 )
 
 const DefaultNonGBR5QI = 9
 
+func ngapPDUSessionType(pduSessionType uint8) aper.Enumerated {
+	switch pduSessionType {
+	case nasMessage.PDUSessionTypeIPv6:
+		return ngapType.PDUSessionTypePresentIpv6
+	case nasMessage.PDUSessionTypeIPv4IPv6:
+		return ngapType.PDUSessionTypePresentIpv4v6
+	default:
+		return ngapType.PDUSessionTypePresentIpv4
+	}
+}
+
 func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error) {
 	ANUPF := ctx.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
 	UpNode := ANUPF.UPF
@@ -22,7 +36,7 @@ func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error)
 	ie := ngapType.PDUSessionResourceSetupRequestTransferIEs{}
 	ie.Id.Value = ngapType.ProtocolIEIDULNGUUPTNLInformation
 	ie.Criticality.Value = ngapType.CriticalityPresentReject
-	if n3IP, err := UpNode.N3Interfaces[0].IP(ctx.SelectedPDUSessionType); err != nil {
+	if n3IP, err := UpNode.N3Interfaces[0].IP(gtpuTransportType); err != nil {
 		return nil, err
 	} else {
 		ie.Value = ngapType.PDUSessionResourceSetupRequestTransferIEsValue{
@@ -51,7 +65,7 @@ func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error)
 	ie.Value = ngapType.PDUSessionResourceSetupRequestTransferIEsValue{
 		Present: ngapType.PDUSessionResourceSetupRequestTransferIEsPresentPDUSessionType,
 		PDUSessionType: &ngapType.PDUSessionType{
-			Value: ngapType.PDUSessionTypePresentIpv4,
+			Value: ngapPDUSessionType(ctx.SelectedPDUSessionType),
 		},
 	}
 	resourceSetupRequestTransfer.ProtocolIEs.List = append(resourceSetupRequestTransfer.ProtocolIEs.List, ie)
@@ -105,6 +119,123 @@ func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error)
 	}
 }
 
+// qosFlowLevelQosParameters converts the QoS data of the PCC rule of the QoS flow to TS 38.413 9.3.1.12
+func qosFlowLevelQosParameters(qosData *models.QosData) *ngapType.QosFlowLevelQosParameters {
+	parameters := &ngapType.QosFlowLevelQosParameters{
+		QosCharacteristics: ngapType.QosCharacteristics{
+			Present: ngapType.QosCharacteristicsPresentNonDynamic5QI,
+			NonDynamic5QI: &ngapType.NonDynamic5QIDescriptor{
+				FiveQI: ngapType.FiveQI{
+					Value: int64(qosData.Var5qi),
+				},
+			},
+		},
+		AllocationAndRetentionPriority: ngapType.AllocationAndRetentionPriority{
+			PriorityLevelARP: ngapType.PriorityLevelARP{
+				Value: 15,
+			},
+			PreEmptionCapability: ngapType.PreEmptionCapability{
+				Value: ngapType.PreEmptionCapabilityPresentShallNotTriggerPreEmption,
+			},
+			PreEmptionVulnerability: ngapType.PreEmptionVulnerability{
+				Value: ngapType.PreEmptionVulnerabilityPresentNotPreEmptable,
+			},
+		},
+	}
+
+	if arp := qosData.Arp; arp != nil {
+		arpParameters := &parameters.AllocationAndRetentionPriority
+		arpParameters.PriorityLevelARP.Value = int64(arp.PriorityLevel)
+		if arp.PreemptCap == models.PreemptionCapability_MAY_PREEMPT {
+			arpParameters.PreEmptionCapability.Value = ngapType.PreEmptionCapabilityPresentMayTriggerPreEmption
+		}
+		if arp.PreemptVuln == models.PreemptionVulnerability_PREEMPTABLE {
+			arpParameters.PreEmptionVulnerability.Value = ngapType.PreEmptionVulnerabilityPresentPreEmptable
+		}
+	}
+
+	if qosData.GbrUl != "" || qosData.GbrDl != "" {
+		gbrUl, gbrDl := util.BitRateTokbps(qosData.GbrUl), util.BitRateTokbps(qosData.GbrDl)
+		mbrUl, mbrDl := util.BitRateTokbps(qosData.MaxbrUl), util.BitRateTokbps(qosData.MaxbrDl)
+		if mbrUl < gbrUl {
+			mbrUl = gbrUl
+		}
+		if mbrDl < gbrDl {
+			mbrDl = gbrDl
+		}
+		// bit rates of NGAP are in bit/s
+		parameters.GBRQosInformation = &ngapType.GBRQosInformation{
+			MaximumFlowBitRateDL:    ngapType.BitRate{Value: int64(mbrDl * 1000)},
+			MaximumFlowBitRateUL:    ngapType.BitRate{Value: int64(mbrUl * 1000)},
+			GuaranteedFlowBitRateDL: ngapType.BitRate{Value: int64(gbrDl * 1000)},
+			GuaranteedFlowBitRateUL: ngapType.BitRate{Value: int64(gbrUl * 1000)},
+		}
+	}
+	return parameters
+}
+
+// TS 38.413 9.3.4.3
+func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error) {
+	resourceModifyRequestTransfer := ngapType.PDUSessionResourceModifyRequestTransfer{}
+
+	addOrModifyList := new(ngapType.QosFlowAddOrModifyRequestList)
+	releaseList := new(ngapType.QosFlowListWithCause)
+	for _, flow := range ctx.QoSFlows {
+		switch flow.Operation {
+		case 0:
+			continue
+		case OperationCodeDeleteExistingQoSRule:
+			releaseList.List = append(releaseList.List, ngapType.QosFlowWithCauseItem{
+				QosFlowIdentifier: ngapType.QosFlowIdentifier{Value: int64(flow.QFI)},
+				Cause: ngapType.Cause{
+					Present: ngapType.CausePresentNas,
+					Nas: &ngapType.CauseNas{
+						Value: ngapType.CauseNasPresentNormalRelease,
+					},
+				},
+			})
+		default:
+			item := ngapType.QosFlowAddOrModifyRequestItem{
+				QosFlowIdentifier: ngapType.QosFlowIdentifier{Value: int64(flow.QFI)},
+			}
+			if flow.QosData != nil {
+				item.QosFlowLevelQosParameters = qosFlowLevelQosParameters(flow.QosData)
+			}
+			addOrModifyList.List = append(addOrModifyList.List, item)
+		}
+	}
+
+	// QoS Flow Add or Modify Request List
+	if len(addOrModifyList.List) > 0 {
+		ie := ngapType.PDUSessionResourceModifyRequestTransferIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDQosFlowAddOrModifyRequestList
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value = ngapType.PDUSessionResourceModifyRequestTransferIEsValue{
+			Present:                       ngapType.PDUSessionResourceModifyRequestTransferIEsPresentQosFlowAddOrModifyRequestList,
+			QosFlowAddOrModifyRequestList: addOrModifyList,
+		}
+		resourceModifyRequestTransfer.ProtocolIEs.List = append(resourceModifyRequestTransfer.ProtocolIEs.List, ie)
+	}
+
+	// QoS Flow to Release List
+	if len(releaseList.List) > 0 {
+		ie := ngapType.PDUSessionResourceModifyRequestTransferIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDQosFlowToReleaseList
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value = ngapType.PDUSessionResourceModifyRequestTransferIEsValue{
+			Present:              ngapType.PDUSessionResourceModifyRequestTransferIEsPresentQosFlowToReleaseList,
+			QosFlowToReleaseList: releaseList,
+		}
+		resourceModifyRequestTransfer.ProtocolIEs.List = append(resourceModifyRequestTransfer.ProtocolIEs.List, ie)
+	}
+
+	if buf, err := aper.MarshalWithParams(resourceModifyRequestTransfer, "valueExt"); err != nil {
+		return nil, fmt.Errorf("encode resourceModifyRequestTransfer failed: %s", err)
+	} else {
+		return buf, nil
+	}
+}
+
 // TS 38.413 9.3.4.9
 func BuildPathSwitchRequestAcknowledgeTransfer(ctx *SMContext) ([]byte, error) {
 	ANUPF := ctx.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
@@ -50,6 +50,23 @@ func HandlePDUSessionResourceSetupResponseTransfer(b []byte, ctx *SMContext) (er
 	return nil
 }
 
+// HandlePDUSessionResourceModifyResponseTransfer returns the QFIs of the QoS flows which NG-RAN failed to add or modify
+func HandlePDUSessionResourceModifyResponseTransfer(b []byte, ctx *SMContext) ([]uint8, error) {
+	resourceModifyResponseTransfer := ngapType.PDUSessionResourceModifyResponseTransfer{}
+
+	if err := aper.UnmarshalWithParams(b, &resourceModifyResponseTransfer, "valueExt"); err != nil {
+		return nil, err
+	}
+
+	var failedQFIs []uint8
+	if failedList := resourceModifyResponseTransfer.QosFlowFailedToAddOrModifyList; failedList != nil {
+		for _, item := range failedList.List {
+			failedQFIs = append(failedQFIs, uint8(item.QosFlowIdentifier.Value))
+		}
+	}
+	return failedQFIs, nil
+}
+
 func HandlePathSwitchRequestTransfer(b []byte, ctx *SMContext) error {
 	pathSwitchRequestTransfer := ngapType.PathSwitchRequestTransfer{}
 
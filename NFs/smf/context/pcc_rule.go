@@ -1,6 +1,9 @@
 package context
 
 import (
+	"fmt"
+
+	"github.com/free5gc/flowdesc"
 	"github.com/free5gc/openapi/models"
 )
 
@@ -16,6 +19,7 @@ type PCCRule struct {
 
 	// Reference Data
 	refTrafficControlData string
+	refQosData            string
 
 	// related Data
 	Datapath *DataPath
@@ -36,6 +40,10 @@ func NewPCCRuleFromModel(pccModel *models.PccRule) *PCCRule {
 		// TODO: now 1 pcc rule only maps to 1 TC data
 		pccRule.refTrafficControlData = pccModel.RefTcData[0]
 	}
+	if pccModel.RefQosData != nil {
+		// TODO: now 1 pcc rule only maps to 1 QoS data
+		pccRule.refQosData = pccModel.RefQosData[0]
+	}
 
 	return pccRule
 }
@@ -49,3 +57,34 @@ func (r *PCCRule) SetRefTrafficControlData(tcID string) {
 func (r *PCCRule) RefTrafficControlData() string {
 	return r.refTrafficControlData
 }
+
+// RefQosData - returns reference QoS data ID
+func (r *PCCRule) RefQosData() string {
+	return r.refQosData
+}
+
+// Destination returns the destination in the DN of the uplink traffic matched by the PCC rule, the flow description
+// of the PCC rule is encoded in the downlink direction (TS 29.512 5.6.2.14). The application of the PCC rule narrows
+// the traffic further, the PCC rule without flow information is not steered
+func (r *PCCRule) Destination() (Destination, error) {
+	destination := Destination{DestinationIP: "any", ApplicationID: r.AppID}
+	if len(r.FlowInfos) == 0 {
+		return destination, fmt.Errorf("PCC rule[%s] has no flow information", r.PCCRuleID)
+	}
+	// TODO: now the traffic of 1 PCC rule is steered by its first flow information
+	rule := flowdesc.NewIPFilterRule()
+	if err := flowdesc.Decode(r.FlowInfos[0].FlowDescription, rule); err != nil {
+		return destination, fmt.Errorf("flow description of PCC rule[%s] error: %+v", r.PCCRuleID, err)
+	}
+	if rule.GetDirection() == flowdesc.Out {
+		destination.DestinationIP = rule.GetSourceIP()
+		destination.DestinationPort = rule.GetSourcePorts()
+	} else {
+		destination.DestinationIP = rule.GetDestinationIP()
+		destination.DestinationPort = rule.GetDestinationPorts()
+	}
+	if destination.DestinationIP == "assigned" {
+		return destination, fmt.Errorf("flow description of PCC rule[%s] has no DN address", r.PCCRuleID)
+	}
+	return destination, nil
+}
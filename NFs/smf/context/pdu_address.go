@@ -0,0 +1,177 @@
+package context
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/logger"
+)
+
+// AllocatePDUAddress allocates the IPv4 address and delegates the /64 prefix of the selected PDU session type. The
+// IPv4v6 PDU session is downgraded to the IP version both the DNN and the subscription support, and the cause of
+// the downgrade is sent in the PDU Session Establishment Accept (TS 24.501 6.4.1.3). The 5GSM cause rejecting the
+// PDU session is returned on failure, the address allocated before the failure is released.
+func (smContext *SMContext) AllocatePDUAddress() (uint8, error) {
+	ipam := smContext.DNNInfo.UeIPAM
+
+	if smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv4IPv6 {
+		supportIPv4 := ipam.SupportIPv4() && smContext.isAllowedPDUSessionType(nasMessage.PDUSessionTypeIPv4)
+		supportIPv6 := ipam.SupportIPv6() && smContext.isAllowedPDUSessionType(nasMessage.PDUSessionTypeIPv6)
+		if supportIPv4 && !supportIPv6 {
+			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+			smContext.PDUSessionTypeCause = nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed
+		} else if !supportIPv4 && supportIPv6 {
+			smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv6
+			smContext.PDUSessionTypeCause = nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed
+		}
+	}
+	if smContext.SelectedPDUSessionType != nasMessage.PDUSessionTypeIPv6 &&
+		smContext.SelectedPDUSessionType != nasMessage.PDUSessionTypeIPv4IPv6 {
+		smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	}
+
+	// no UE subnet of the DNN serves the IP version of the PDU session
+	if smContext.UseIPv4() && !ipam.SupportIPv4() {
+		return nasMessage.Cause5GSMUnknownPDUSessionType, fmt.Errorf("DNN[%s] has no IPv4 pool", smContext.Dnn)
+	}
+	if smContext.UseIPv6() && !ipam.SupportIPv6() {
+		return nasMessage.Cause5GSMUnknownPDUSessionType, fmt.Errorf("DNN[%s] has no IPv6 pool", smContext.Dnn)
+	}
+
+	if smContext.UseIPv4() {
+		staticAddrs := smContext.DnnConfiguration.StaticIpAddress
+		ip, err := ipam.Allocate(smContext.Supi, smContext.PDUSessionID, staticAddrs)
+		if err != nil {
+			return nasMessage.Cause5GSMInsufficientResources, err
+		}
+		smContext.PDUAddress = ip
+	}
+	if smContext.UseIPv6() {
+		if err := smContext.delegatePrefix(); err != nil {
+			// the IPv4 address of the IPv4v6 PDU session is released with the prefix
+			smContext.releasePDUAddress()
+			smContext.PDUAddress, smContext.PDUAddressV6 = nil, nil
+			return nasMessage.Cause5GSMInsufficientResources, err
+		}
+	}
+	return 0, nil
+}
+
+// delegatePrefix delegates the /64 prefix to the PDU session and generates the interface identifier of the UE
+func (smContext *SMContext) delegatePrefix() error {
+	prefix, err := smContext.DNNInfo.UeIPAM.AllocatePrefix(smContext.Supi, smContext.PDUSessionID)
+	if err != nil {
+		return err
+	}
+	smContext.PDUAddressV6 = prefix.IP
+	if err := smContext.generateInterfaceIdentifier(); err != nil {
+		return err
+	}
+	logger.PduSessLog.Infof("Delegate IPv6 prefix[%s] to SUPI[%s] PDU session[%d]",
+		prefix, smContext.Supi, smContext.PDUSessionID)
+	return nil
+}
+
+// releasePDUAddress returns the IPv4 address and the /64 prefix of the PDU session to the UE IPAM
+func (smContext *SMContext) releasePDUAddress() {
+	if smContext.DNNInfo == nil {
+		return
+	}
+	if smContext.PDUAddress != nil {
+		smContext.DNNInfo.UeIPAM.Release(smContext.PDUAddress)
+	}
+	if smContext.PDUAddressV6 != nil {
+		smContext.DNNInfo.UeIPAM.ReleasePrefix(smContext.Supi, smContext.PDUSessionID)
+	}
+}
+
+// generateInterfaceIdentifier fills the lower 64 bits of the IPv6 address with a random interface identifier,
+// the UE builds its link-local address from it and takes the /64 prefix from the router advertisement
+// (TS 23.501 5.8.2.2.2)
+func (smContext *SMContext) generateInterfaceIdentifier() error {
+	iid := smContext.PDUAddressV6[8:]
+	for {
+		if _, err := rand.Read(iid); err != nil {
+			return fmt.Errorf("generate interface identifier failed: %s", err)
+		}
+		// the universal/local bit is cleared for the identifier is not derived from an EUI-64 (RFC 4291)
+		iid[0] &^= 0x02
+		for _, b := range iid {
+			if b != 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// UseIPv4 reports whether the PDU session carries IPv4 traffic
+func (smContext *SMContext) UseIPv4() bool {
+	return smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv4 ||
+		smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv4IPv6
+}
+
+// UseIPv6 reports whether the PDU session carries IPv6 traffic
+func (smContext *SMContext) UseIPv6() bool {
+	return smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv6 ||
+		smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv4IPv6
+}
+
+// IPv6Prefix returns the /64 prefix delegated to the PDU session
+func (smContext *SMContext) IPv6Prefix() *net.IPNet {
+	if smContext.PDUAddressV6 == nil {
+		return nil
+	}
+	mask := net.CIDRMask(IPv6PrefixLength, 8*net.IPv6len)
+	return &net.IPNet{IP: smContext.PDUAddressV6.Mask(mask), Mask: mask}
+}
+
+// UEIPAddress returns the UE IP address IE of the PDRs of the PDU session, the IPv6 address in the IE is the /64
+// prefix matched by the UPF
+func (smContext *SMContext) UEIPAddress(destination bool) *pfcpType.UEIPAddress {
+	ueIPAddress := &pfcpType.UEIPAddress{
+		Sd: destination,
+	}
+	if smContext.PDUAddress != nil {
+		ueIPAddress.V4 = true
+		ueIPAddress.Ipv4Address = smContext.PDUAddress.To4()
+	}
+	if prefix := smContext.IPv6Prefix(); prefix != nil {
+		ueIPAddress.V6 = true
+		ueIPAddress.Ipv6Address = prefix.IP
+	}
+	return ueIPAddress
+}
+
+// PDNType returns the PDN type IE of the PFCP session of the PDU session
+func (smContext *SMContext) PDNType() pfcpType.PDNType {
+	switch smContext.SelectedPDUSessionType {
+	case nasMessage.PDUSessionTypeIPv6:
+		return pfcpType.PDNType{PdnType: pfcpType.PDNTypeIpv6}
+	case nasMessage.PDUSessionTypeIPv4IPv6:
+		return pfcpType.PDNType{PdnType: pfcpType.PDNTypeIpv4v6}
+	default:
+		return pfcpType.PDNType{PdnType: pfcpType.PDNTypeIpv4}
+	}
+}
+
+// UEAddressFor returns the UE address in the flow description towards the remote address, it is the /64 prefix if
+// the remote address is IPv6 or the PDU session has no IPv4 address
+func (smContext *SMContext) UEAddressFor(remoteIP string) string {
+	prefix := smContext.IPv6Prefix()
+	if ip, _, err := net.ParseCIDR(remoteIP); err == nil {
+		remoteIP = ip.String()
+	}
+	if ip := net.ParseIP(remoteIP); prefix != nil && ip != nil && ip.To4() == nil {
+		return prefix.String()
+	}
+	if smContext.PDUAddress != nil {
+		return smContext.PDUAddress.To4().String()
+	}
+	if prefix != nil {
+		return prefix.String()
+	}
+	return "assigned"
+}
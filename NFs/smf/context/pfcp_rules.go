@@ -81,6 +81,16 @@ type QER struct {
 	State RuleState
 }
 
-// Usage Report Rule
+// Usage Reporting Rule. 7.5.2.4-1
 type URR struct {
+	URRID uint32
+
+	MeasurementMethod pfcpType.MeasurementMethod
+	ReportingTriggers pfcpType.ReportingTriggers
+	MeasurementPeriod *pfcpType.MeasurementPeriod
+	VolumeThreshold   *pfcpType.VolumeThreshold
+	TimeThreshold     *pfcpType.TimeThreshold
+	QuotaHoldingTime  *pfcpType.QuotaHoldingTime
+
+	State RuleState
 }
@@ -0,0 +1,114 @@
+package context
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/logger"
+)
+
+var (
+	// PFDs of the applications provisioned to the UPFs, keyed by the application ID
+	pfdDatas     = make(map[string][]models.PfdContent)
+	pfdDatasLock sync.RWMutex
+)
+
+// InitSMFPFDs loads the PFDs of the applications in the routing config
+func InitSMFPFDs(routingConfig *factory.RoutingConfig) {
+	if routingConfig == nil {
+		return
+	}
+
+	pfdDatasLock.Lock()
+	defer pfdDatasLock.Unlock()
+	pfdDatas = make(map[string][]models.PfdContent)
+	for _, pfdData := range routingConfig.PfdDatas {
+		if pfdData == nil || pfdData.AppID == "" {
+			logger.CtxLog.Warnln("PFDs without application ID are ignored")
+			continue
+		}
+		pfds := make([]models.PfdContent, 0, len(pfdData.Pfds))
+		for _, pfd := range pfdData.Pfds {
+			pfds = append(pfds, models.PfdContent{
+				PfdId:            pfd.PfdID,
+				FlowDescriptions: pfd.FlowDescriptions,
+				Urls:             pfd.Urls,
+				DomainNames:      pfd.DomainNames,
+			})
+		}
+		pfdDatas[pfdData.AppID] = pfds
+	}
+}
+
+// UpdatePFDs applies the PFD change of the application notified by the NEF (TS 29.551), the PFDs are
+// removed with the removal flag, the PFDs with the same PFD ID are replaced with the partial flag and a partial PFD
+// without any content removes the PFD, otherwise all the PFDs of the application are replaced. It returns the PFDs of
+// the application after the change.
+func UpdatePFDs(notification models.PfdChangeNotification) models.PfdDataForApp {
+	appID := notification.ApplicationId
+	pfdDatasLock.Lock()
+	defer pfdDatasLock.Unlock()
+
+	switch {
+	case notification.RemovalFlag:
+		delete(pfdDatas, appID)
+	case notification.PartialFlag:
+		// the PFDs are copied as the ones returned before may still be read
+		pfds := append([]models.PfdContent(nil), pfdDatas[appID]...)
+		for _, changedPFD := range notification.Pfds {
+			removed := len(changedPFD.FlowDescriptions) == 0 && len(changedPFD.Urls) == 0 &&
+				len(changedPFD.DomainNames) == 0
+			replaced := false
+			for i := 0; i < len(pfds); i++ {
+				if pfds[i].PfdId != changedPFD.PfdId {
+					continue
+				}
+				if removed {
+					pfds = append(pfds[:i], pfds[i+1:]...)
+					i--
+				} else {
+					pfds[i] = changedPFD
+					replaced = true
+				}
+			}
+			if !removed && !replaced {
+				pfds = append(pfds, changedPFD)
+			}
+		}
+		if len(pfds) == 0 {
+			delete(pfdDatas, appID)
+		} else {
+			pfdDatas[appID] = pfds
+		}
+	default:
+		if len(notification.Pfds) == 0 {
+			delete(pfdDatas, appID)
+		} else {
+			pfdDatas[appID] = append([]models.PfdContent(nil), notification.Pfds...)
+		}
+	}
+	return models.PfdDataForApp{
+		ApplicationId: appID,
+		Pfds:          pfdDatas[appID],
+	}
+}
+
+// PFDDatas returns the PFDs of all the applications in the order of the application IDs
+func PFDDatas() []models.PfdDataForApp {
+	pfdDatasLock.RLock()
+	defer pfdDatasLock.RUnlock()
+
+	datas := make([]models.PfdDataForApp, 0, len(pfdDatas))
+	for appID, pfds := range pfdDatas {
+		datas = append(datas, models.PfdDataForApp{
+			ApplicationId: appID,
+			Pfds:          pfds,
+		})
+	}
+	sort.Slice(datas, func(i, j int) bool {
+		return datas[i].ApplicationId < datas[j].ApplicationId
+	})
+	return datas
+}
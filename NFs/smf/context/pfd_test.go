@@ -0,0 +1,101 @@
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestUpdatePFDs(t *testing.T) {
+	context.InitSMFPFDs(&factory.RoutingConfig{
+		PfdDatas: []*factory.PfdDataForApp{
+			{
+				AppID: "video",
+				Pfds: []factory.PfdContent{
+					{PfdID: "pfd1", DomainNames: []string{"video.example.com"}},
+					{PfdID: "pfd2", FlowDescriptions: []string{"permit out ip from 10.60.0.2 to assigned"}},
+				},
+			},
+			{
+				AppID: "edge",
+				Pfds:  []factory.PfdContent{{PfdID: "pfd1", Urls: []string{"http://edge.example.com/"}}},
+			},
+			{Pfds: []factory.PfdContent{{PfdID: "pfd1", Urls: []string{"http://ignored.example.com/"}}}},
+		},
+	})
+	pfdDatas := context.PFDDatas()
+	require.Len(t, pfdDatas, 2)
+	require.Equal(t, "edge", pfdDatas[0].ApplicationId)
+	require.Equal(t, "video", pfdDatas[1].ApplicationId)
+	require.Len(t, pfdDatas[1].Pfds, 2)
+
+	// a partial change replaces the PFD with the same ID and removes the PFD without content
+	pfdData := context.UpdatePFDs(models.PfdChangeNotification{
+		ApplicationId: "video",
+		PartialFlag:   true,
+		Pfds: []models.PfdContent{
+			{PfdId: "pfd1", DomainNames: []string{"video2.example.com"}},
+			{PfdId: "pfd2"},
+			{PfdId: "pfd3", Urls: []string{"http://video.example.com/live"}},
+		},
+	})
+	require.Equal(t, models.PfdDataForApp{
+		ApplicationId: "video",
+		Pfds: []models.PfdContent{
+			{PfdId: "pfd1", DomainNames: []string{"video2.example.com"}},
+			{PfdId: "pfd3", Urls: []string{"http://video.example.com/live"}},
+		},
+	}, pfdData)
+	// the PFDs returned before are not changed
+	require.Equal(t, "pfd2", pfdDatas[1].Pfds[1].PfdId)
+
+	// a full change replaces all the PFDs of the application
+	pfdData = context.UpdatePFDs(models.PfdChangeNotification{
+		ApplicationId: "edge",
+		Pfds:          []models.PfdContent{{PfdId: "pfd9", DomainNames: []string{"edge2.example.com"}}},
+	})
+	require.Equal(t, []models.PfdContent{{PfdId: "pfd9", DomainNames: []string{"edge2.example.com"}}}, pfdData.Pfds)
+
+	pfdData = context.UpdatePFDs(models.PfdChangeNotification{ApplicationId: "video", RemovalFlag: true})
+	require.Equal(t, "video", pfdData.ApplicationId)
+	require.Empty(t, pfdData.Pfds)
+	pfdDatas = context.PFDDatas()
+	require.Len(t, pfdDatas, 1)
+	require.Equal(t, "edge", pfdDatas[0].ApplicationId)
+
+	context.InitSMFPFDs(&factory.RoutingConfig{})
+	require.Empty(t, context.PFDDatas())
+}
+
+func TestPCCRuleApplicationDestination(t *testing.T) {
+	// the PCC rule of an application without flow information is not steered
+	pccRule := context.NewPCCRuleFromModel(&models.PccRule{PccRuleId: "1", AppId: "edge"})
+	_, err := pccRule.Destination()
+	require.Error(t, err)
+
+	pccRule = context.NewPCCRuleFromModel(&models.PccRule{
+		PccRuleId: "2",
+		AppId:     "edge",
+		FlowInfos: []models.FlowInformation{
+			{FlowDescription: "permit out ip from 10.100.100.0/24 to assigned"},
+		},
+	})
+	destination, err := pccRule.Destination()
+	require.NoError(t, err)
+	require.Equal(t, "edge", destination.ApplicationID)
+	require.Equal(t, "10.100.100.0/24", destination.DestinationIP)
+}
+
+func TestUPFSupportPFDM(t *testing.T) {
+	upf := new(context.UPF)
+	require.False(t, upf.SupportPFDM())
+	upf.UPFunctionFeatures = &pfcpType.UPFunctionFeatures{}
+	require.False(t, upf.SupportPFDM())
+	upf.UPFunctionFeatures.SupportedFeatures = pfcpType.UpFunctionFeaturesPfdm
+	require.True(t, upf.SupportPFDM())
+}
@@ -0,0 +1,596 @@
+package context
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/free5gc/flowdesc"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/util"
+)
+
+// TS 24.501 Table 9.11.4.12.1
+const (
+	OperationCodeCreateNewQoSFlowDescription      uint8 = 1
+	OperationCodeDeleteExistingQoSFlowDescription uint8 = 2
+	OperationCodeModifyExistingQoSFlowDescription uint8 = 3
+)
+
+const (
+	QoSFlowDescriptionParameter5QI          uint8 = 0x01
+	QoSFlowDescriptionParameterGFBRUplink   uint8 = 0x02
+	QoSFlowDescriptionParameterGFBRDownlink uint8 = 0x03
+	QoSFlowDescriptionParameterMFBRUplink   uint8 = 0x04
+	QoSFlowDescriptionParameterMFBRDownlink uint8 = 0x05
+)
+
+// QoSFlowDescription of TS 24.501 9.11.4.12, the bit rates are in kbps and zero values are absent parameters
+type QoSFlowDescription struct {
+	QFI           uint8
+	OperationCode uint8
+	Var5QI        uint8
+	GFBRUplink    uint64
+	GFBRDownlink  uint64
+	MFBRUplink    uint64
+	MFBRDownlink  uint64
+}
+
+// bitRateUnitKbps returns the kbps of the bit rate unit of TS 24.501 9.11.4.14, the unit is multiplied by 4 from
+// 1Kbps (0x01) to 256Kbps (0x05), and by 1000 from 1Kbps to 1Mbps (0x06), 1Gbps (0x0B), 1Tbps (0x10)
+func bitRateUnitKbps(unit uint8) uint64 {
+	kbps := uint64(1)
+	for i := uint8(1); i < unit; i++ {
+		if i%5 == 0 {
+			kbps = kbps / 256 * 1000
+		} else {
+			kbps *= 4
+		}
+	}
+	return kbps
+}
+
+func encodeBitRate(kbps uint64) []byte {
+	unit := uint8(0x01)
+	for kbps/bitRateUnitKbps(unit) > 0xffff && unit < 0x19 {
+		unit++
+	}
+	value := make([]byte, 3)
+	value[0] = unit
+	binary.BigEndian.PutUint16(value[1:], uint16(kbps/bitRateUnitKbps(unit)))
+	return value
+}
+
+func decodeBitRate(value []byte) (uint64, error) {
+	if len(value) != 3 {
+		return 0, fmt.Errorf("bit rate length [%d] mismatch", len(value))
+	}
+	return uint64(binary.BigEndian.Uint16(value[1:])) * bitRateUnitKbps(value[0]), nil
+}
+
+func (d *QoSFlowDescription) MarshalBinary() ([]byte, error) {
+	parameterBuffer := bytes.NewBuffer(nil)
+	numOfParameters := 0
+	writeParameter := func(identifier uint8, contents []byte) {
+		parameterBuffer.WriteByte(identifier)
+		parameterBuffer.WriteByte(uint8(len(contents)))
+		parameterBuffer.Write(contents)
+		numOfParameters++
+	}
+
+	if d.Var5QI != 0 {
+		writeParameter(QoSFlowDescriptionParameter5QI, []byte{d.Var5QI})
+	}
+	if d.GFBRUplink != 0 {
+		writeParameter(QoSFlowDescriptionParameterGFBRUplink, encodeBitRate(d.GFBRUplink))
+	}
+	if d.GFBRDownlink != 0 {
+		writeParameter(QoSFlowDescriptionParameterGFBRDownlink, encodeBitRate(d.GFBRDownlink))
+	}
+	if d.MFBRUplink != 0 {
+		writeParameter(QoSFlowDescriptionParameterMFBRUplink, encodeBitRate(d.MFBRUplink))
+	}
+	if d.MFBRDownlink != 0 {
+		writeParameter(QoSFlowDescriptionParameterMFBRDownlink, encodeBitRate(d.MFBRDownlink))
+	}
+
+	descriptionBuffer := bytes.NewBuffer(nil)
+	descriptionBuffer.WriteByte(d.QFI & 0x3f)
+	descriptionBuffer.WriteByte(d.OperationCode << 5)
+	// E bit is set to replace all the parameters of the QoS flow description
+	var eBit uint8
+	if d.OperationCode != OperationCodeDeleteExistingQoSFlowDescription {
+		eBit = 1
+	}
+	descriptionBuffer.WriteByte(eBit<<6 | uint8(numOfParameters))
+	if _, err := descriptionBuffer.ReadFrom(parameterBuffer); err != nil {
+		return nil, err
+	}
+	return descriptionBuffer.Bytes(), nil
+}
+
+type QoSFlowDescriptions []QoSFlowDescription
+
+func (ds QoSFlowDescriptions) MarshalBinary() ([]byte, error) {
+	descriptionsBuffer := bytes.NewBuffer(nil)
+	for i := range ds {
+		if descriptionBytes, err := ds[i].MarshalBinary(); err != nil {
+			return nil, err
+		} else {
+			descriptionsBuffer.Write(descriptionBytes)
+		}
+	}
+	return descriptionsBuffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the QoS flow descriptions IE contents of TS 24.501 9.11.4.12
+func (ds *QoSFlowDescriptions) UnmarshalBinary(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return fmt.Errorf("QoS flow description is too short")
+		}
+		description := QoSFlowDescription{
+			QFI:           data[0] & 0x3f,
+			OperationCode: data[1] >> 5,
+		}
+		numOfParameters := int(data[2] & 0x3f)
+		data = data[3:]
+		for i := 0; i < numOfParameters; i++ {
+			if len(data) < 2 || len(data) < 2+int(data[1]) {
+				return fmt.Errorf("parameter of QoS flow description [%d] is too short", description.QFI)
+			}
+			identifier, contents := data[0], data[2:2+int(data[1])]
+			data = data[2+len(contents):]
+
+			var err error
+			switch identifier {
+			case QoSFlowDescriptionParameter5QI:
+				if len(contents) != 1 {
+					return fmt.Errorf("5QI length [%d] mismatch", len(contents))
+				}
+				description.Var5QI = contents[0]
+			case QoSFlowDescriptionParameterGFBRUplink:
+				description.GFBRUplink, err = decodeBitRate(contents)
+			case QoSFlowDescriptionParameterGFBRDownlink:
+				description.GFBRDownlink, err = decodeBitRate(contents)
+			case QoSFlowDescriptionParameterMFBRUplink:
+				description.MFBRUplink, err = decodeBitRate(contents)
+			case QoSFlowDescriptionParameterMFBRDownlink:
+				description.MFBRDownlink, err = decodeBitRate(contents)
+			default:
+				logger.GsmLog.Infof("QoS flow description parameter [0x%02x] is ignored", identifier)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		*ds = append(*ds, description)
+	}
+	return nil
+}
+
+// QoSFlow is a QoS flow other than the default QoS flow, which is authorized by a PCC rule of the PCF
+type QoSFlow struct {
+	QFI           uint8
+	QoSRuleID     uint8
+	PCCRuleID     string
+	Precedence    uint8
+	PacketFilters []PacketFilter
+	QosData       *models.QosData
+
+	// QoS rule operation code not yet acknowledged by the UE, 0 for none
+	Operation uint8
+
+	// UPF NodeID(string form) to the rules of the QoS flow on the UPF
+	rules map[string]*qosFlowRules
+}
+
+type qosFlowRules struct {
+	upf  *UPF
+	pdrs []*PDR
+	qer  *QER
+}
+
+// QoSFlowRuleList is the PFCP rules of the QoS flows to be sent to a UPF
+type QoSFlowRuleList struct {
+	NodeID  pfcpType.NodeID
+	PDRList []*PDR
+	QERList []*QER
+}
+
+// DefaultQFI returns the QFI of the default QoS flow
+func (smContext *SMContext) DefaultQFI() uint8 {
+	if sessionRule := smContext.SelectedSessionRule(); sessionRule != nil && sessionRule.AuthDefQos != nil {
+		return uint8(sessionRule.AuthDefQos.Var5qi)
+	}
+	return DefaultNonGBR5QI
+}
+
+// QoSFlowByQoSRuleID returns the QoS flow of the QoS rule, nil if not found
+func (smContext *SMContext) QoSFlowByQoSRuleID(ruleID uint8) *QoSFlow {
+	for _, flow := range smContext.QoSFlows {
+		if flow.QoSRuleID == ruleID {
+			return flow
+		}
+	}
+	return nil
+}
+
+// NewQoSFlow allocates the QFI and the QoS rule identifier of a QoS flow for the PCC rule
+func (smContext *SMContext) NewQoSFlow(pccRule *PCCRule, qosData *models.QosData,
+	packetFilters []PacketFilter) (*QoSFlow, error) {
+	flow := &QoSFlow{
+		PCCRuleID:     pccRule.PCCRuleID,
+		Precedence:    uint8(pccRule.Precedence),
+		PacketFilters: packetFilters,
+		QosData:       qosData,
+		Operation:     OperationCodeCreateNewQoSRule,
+		rules:         make(map[string]*qosFlowRules),
+	}
+
+	defaultQFI := smContext.DefaultQFI()
+	for qfi := uint8(1); qfi <= 63; qfi++ {
+		if _, exist := smContext.QoSFlows[qfi]; !exist && qfi != defaultQFI && qfi != DefaultNonGBR5QI {
+			flow.QFI = qfi
+			break
+		}
+	}
+	// QoS rule identifier 1 is the default QoS rule
+	for ruleID := uint8(2); ruleID != 0; ruleID++ {
+		if smContext.QoSFlowByQoSRuleID(ruleID) == nil {
+			flow.QoSRuleID = ruleID
+			break
+		}
+	}
+	if flow.QFI == 0 || flow.QoSRuleID == 0 {
+		return nil, fmt.Errorf("no QFI or QoS rule identifier is available for PCC rule[%s]", pccRule.PCCRuleID)
+	}
+
+	smContext.QoSFlows[flow.QFI] = flow
+	return flow, nil
+}
+
+// Description returns the QoS flow description of the pending operation of the QoS flow
+func (flow *QoSFlow) Description() QoSFlowDescription {
+	description := QoSFlowDescription{QFI: flow.QFI}
+	switch flow.Operation {
+	case OperationCodeCreateNewQoSRule:
+		description.OperationCode = OperationCodeCreateNewQoSFlowDescription
+	case OperationCodeDeleteExistingQoSRule:
+		description.OperationCode = OperationCodeDeleteExistingQoSFlowDescription
+		return description
+	default:
+		description.OperationCode = OperationCodeModifyExistingQoSFlowDescription
+	}
+
+	if qosData := flow.QosData; qosData != nil {
+		description.Var5QI = uint8(qosData.Var5qi)
+		if qosData.GbrUl != "" {
+			description.GFBRUplink = util.BitRateTokbps(qosData.GbrUl)
+		}
+		if qosData.GbrDl != "" {
+			description.GFBRDownlink = util.BitRateTokbps(qosData.GbrDl)
+		}
+		if qosData.MaxbrUl != "" {
+			description.MFBRUplink = util.BitRateTokbps(qosData.MaxbrUl)
+		}
+		if qosData.MaxbrDl != "" {
+			description.MFBRDownlink = util.BitRateTokbps(qosData.MaxbrDl)
+		}
+	}
+	return description
+}
+
+// QoSRule returns the QoS rule of the pending operation of the QoS flow
+func (flow *QoSFlow) QoSRule() QoSRule {
+	rule := QoSRule{
+		Identifier:    flow.QoSRuleID,
+		OperationCode: flow.Operation,
+		Precedence:    flow.Precedence,
+		QFI:           flow.QFI,
+	}
+	if flow.Operation != OperationCodeDeleteExistingQoSRule &&
+		flow.Operation != OperationCodeModifyExistingQoSRuleWithoutModifyingPacketFilters {
+		rule.PacketFilterList = flow.PacketFilters
+	}
+	return rule
+}
+
+// UpdatePacketFilters applies the packet filter operation of the QoS rule requested by the UE
+func (flow *QoSFlow) UpdatePacketFilters(rule *QoSRule) {
+	switch rule.OperationCode {
+	case OperationCodeModifyExistingQoSRuleAndAddPacketFilters:
+		flow.PacketFilters = append(flow.PacketFilters, rule.PacketFilterList...)
+	case OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters:
+		flow.PacketFilters = rule.PacketFilterList
+	case OperationCodeModifyExistingQoSRuleAndDeletePacketFilters:
+		deleted := make(map[uint8]bool)
+		for _, pf := range rule.PacketFilterList {
+			deleted[pf.Identifier] = true
+		}
+		var packetFilters []PacketFilter
+		for _, pf := range flow.PacketFilters {
+			if !deleted[pf.Identifier] {
+				packetFilters = append(packetFilters, pf)
+			}
+		}
+		flow.PacketFilters = packetFilters
+	}
+}
+
+func sdfFilter(flowDescription string) *pfcpType.SDFFilter {
+	return &pfcpType.SDFFilter{
+		Fd:                      true,
+		LengthOfFlowDescription: uint16(len(flowDescription)),
+		FlowDescription:         []byte(flowDescription),
+	}
+}
+
+// uplinkFlowDescription swaps the flow description of the PCC rule, which is from the remote to the UE,
+// to match the uplink packets from the UE
+func uplinkFlowDescription(flowDescription string) (string, error) {
+	rule := flowdesc.NewIPFilterRule()
+	if err := flowdesc.Decode(flowDescription, rule); err != nil {
+		return "", err
+	}
+	rule.SwapSourceAndDestination()
+	return flowdesc.Encode(rule)
+}
+
+func (flow *QoSFlow) buildQER(upf *UPF) (*QER, error) {
+	qer, err := upf.AddQER()
+	if err != nil {
+		return nil, err
+	}
+	qer.QFI.QFI = flow.QFI
+	qer.GateStatus = &pfcpType.GateStatus{
+		ULGate: pfcpType.GateOpen,
+		DLGate: pfcpType.GateOpen,
+	}
+	flow.setQERBitRate(qer)
+	return qer, nil
+}
+
+func (flow *QoSFlow) setQERBitRate(qer *QER) {
+	qer.MBR, qer.GBR = nil, nil
+	qosData := flow.QosData
+	if qosData == nil {
+		return
+	}
+	if qosData.MaxbrUl != "" || qosData.MaxbrDl != "" {
+		qer.MBR = &pfcpType.MBR{
+			ULMBR: util.BitRateTokbps(qosData.MaxbrUl),
+			DLMBR: util.BitRateTokbps(qosData.MaxbrDl),
+		}
+	}
+	if qosData.GbrUl != "" || qosData.GbrDl != "" {
+		qer.GBR = &pfcpType.GBR{
+			ULGBR: util.BitRateTokbps(qosData.GbrUl),
+			DLGBR: util.BitRateTokbps(qosData.GbrDl),
+		}
+	}
+}
+
+// buildPDRs builds the PDRs of the flow informations of the PCC rule on the UPF of the data path node, the PDRs
+// share the PDI and FAR of the default PDRs with SDF filters, or with the application ID of the PCC rule if it has no
+// flow informations
+func (flow *QoSFlow) buildPDRs(node *DataPathNode, pccRule *PCCRule, qer *QER) ([]*PDR, error) {
+	var pdrs []*PDR
+	addPDR := func(defaultPDR *PDR, flowDescription string) error {
+		pdrID, err := node.UPF.pdrID()
+		if err != nil {
+			return err
+		}
+		pdr := &PDR{
+			PDRID:              pdrID,
+			Precedence:         uint32(flow.Precedence),
+			PDI:                defaultPDR.PDI,
+			OuterHeaderRemoval: defaultPDR.OuterHeaderRemoval,
+			FAR:                defaultPDR.FAR,
+			URR:                defaultPDR.URR,
+			QER:                []*QER{qer},
+		}
+		if flowDescription != "" {
+			pdr.PDI.SDFFilter = sdfFilter(flowDescription)
+		} else {
+			pdr.PDI.ApplicationID = pccRule.AppID
+		}
+		node.UPF.pdrPool.Store(pdr.PDRID, pdr)
+		pdrs = append(pdrs, pdr)
+		return nil
+	}
+
+	if len(pccRule.FlowInfos) == 0 && pccRule.AppID != "" {
+		// the traffic of the application is detected with the PFDs provisioned to the UPF
+		for _, defaultPDR := range []*PDR{node.UpLinkTunnel.PDR, node.DownLinkTunnel.PDR} {
+			if defaultPDR == nil {
+				continue
+			}
+			if err := addPDR(defaultPDR, ""); err != nil {
+				return pdrs, err
+			}
+		}
+		return pdrs, nil
+	}
+
+	for _, flowInfo := range pccRule.FlowInfos {
+		direction := flowInfo.FlowDirection
+		if direction != models.FlowDirectionRm_DOWNLINK && node.UpLinkTunnel.PDR != nil {
+			flowDescription, err := uplinkFlowDescription(flowInfo.FlowDescription)
+			if err != nil {
+				return pdrs, err
+			}
+			if err := addPDR(node.UpLinkTunnel.PDR, flowDescription); err != nil {
+				return pdrs, err
+			}
+		}
+		if direction != models.FlowDirectionRm_UPLINK && node.DownLinkTunnel.PDR != nil {
+			if err := addPDR(node.DownLinkTunnel.PDR, flowInfo.FlowDescription); err != nil {
+				return pdrs, err
+			}
+		}
+	}
+	return pdrs, nil
+}
+
+func (flow *QoSFlow) removeRules(smContext *SMContext, rules *qosFlowRules) {
+	for _, pdr := range rules.pdrs {
+		pdr.State = RULE_REMOVE
+		smContext.RemovePDRfromPFCPSession(rules.upf.NodeID, pdr)
+		if err := rules.upf.RemovePDR(pdr); err != nil {
+			logger.CtxLog.Warnln("Remove QoS flow PDR", err)
+		}
+	}
+	if rules.qer != nil {
+		rules.qer.State = RULE_REMOVE
+		if err := rules.upf.RemoveQER(rules.qer); err != nil {
+			logger.CtxLog.Warnln("Remove QoS flow QER", err)
+		}
+	}
+}
+
+// qosFlowRulesUpdate is the rules of a QoS flow built on a UPF, which replace the old rules of the QoS flow on the UPF
+// once the rules of all the QoS flows are built
+type qosFlowRulesUpdate struct {
+	flow     *QoSFlow
+	nodeIP   string
+	rules    *qosFlowRules
+	oldRules *qosFlowRules
+
+	// the QER kept from the old rules before its update
+	oldMBR   *pfcpType.MBR
+	oldGBR   *pfcpType.GBR
+	oldState RuleState
+}
+
+// release frees the rules built by the update and restores the QER kept from the old rules
+func (update *qosFlowRulesUpdate) release() {
+	upf := update.rules.upf
+	for _, pdr := range update.rules.pdrs {
+		if err := upf.RemovePDR(pdr); err != nil {
+			logger.CtxLog.Warnln("Remove QoS flow PDR", err)
+		}
+	}
+	qer := update.rules.qer
+	if qer == nil {
+		return
+	}
+	if update.oldRules == nil {
+		if err := upf.RemoveQER(qer); err != nil {
+			logger.CtxLog.Warnln("Remove QoS flow QER", err)
+		}
+		return
+	}
+	qer.MBR, qer.GBR, qer.State = update.oldMBR, update.oldGBR, update.oldState
+}
+
+// UpdateQoSFlowRules installs, updates or removes the PDRs and QERs of the QoS flows on the UPFs of the default path
+// according to the pending operations of the QoS flows, and returns the rules to be sent to the UPFs. The rules of
+// either all the QoS flows or none of them are updated, the error is returned if none is updated
+func (smContext *SMContext) UpdateQoSFlowRules(flows ...*QoSFlow) ([]*QoSFlowRuleList, error) {
+	defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if defaultPath == nil {
+		return nil, fmt.Errorf("default data path of the QoS flows not found")
+	}
+
+	var updates []*qosFlowRulesUpdate
+	releaseUpdates := func() {
+		for _, update := range updates {
+			update.release()
+		}
+	}
+	for _, flow := range flows {
+		if flow.Operation == OperationCodeDeleteExistingQoSRule {
+			continue
+		}
+		pccRule := smContext.PCCRules[flow.PCCRuleID]
+		if pccRule == nil {
+			releaseUpdates()
+			return nil, fmt.Errorf("PCC rule[%s] of QoS flow[%d] not found", flow.PCCRuleID, flow.QFI)
+		}
+
+		for node := defaultPath.FirstDPNode; node != nil; node = node.Next() {
+			nodeIP := node.GetNodeIP()
+			update := &qosFlowRulesUpdate{
+				flow:   flow,
+				nodeIP: nodeIP,
+				rules:  &qosFlowRules{upf: node.UPF},
+			}
+			// the PDRs are replaced, the QER is kept and updated to the new bit rates
+			if oldRules, exist := flow.rules[nodeIP]; exist {
+				update.oldRules = oldRules
+				update.rules.qer = oldRules.qer
+				update.oldMBR, update.oldGBR, update.oldState = oldRules.qer.MBR, oldRules.qer.GBR, oldRules.qer.State
+				flow.setQERBitRate(oldRules.qer)
+				oldRules.qer.State = RULE_UPDATE
+			} else {
+				qer, err := flow.buildQER(node.UPF)
+				if err != nil {
+					releaseUpdates()
+					return nil, err
+				}
+				update.rules.qer = qer
+			}
+			updates = append(updates, update)
+
+			pdrs, err := flow.buildPDRs(node, pccRule, update.rules.qer)
+			update.rules.pdrs = pdrs
+			if err != nil {
+				releaseUpdates()
+				return nil, fmt.Errorf("build PDRs of QoS flow[%d] failed: %+v", flow.QFI, err)
+			}
+		}
+	}
+
+	var ruleLists []*QoSFlowRuleList
+	for _, update := range updates {
+		rules := update.rules
+		update.flow.rules[update.nodeIP] = rules
+		for _, pdr := range rules.pdrs {
+			if err := smContext.PutPDRtoPFCPSession(rules.upf.NodeID, pdr); err != nil {
+				logger.CtxLog.Warnln(err)
+			}
+		}
+		ruleList := &QoSFlowRuleList{
+			NodeID:  rules.upf.NodeID,
+			PDRList: rules.pdrs,
+			QERList: []*QER{rules.qer},
+		}
+
+		// old PDRs are removed after the new PDRs of all the QoS flows are allocated not to reuse their IDs in the
+		// same request
+		if oldRules := update.oldRules; oldRules != nil {
+			update.flow.removeRules(smContext, &qosFlowRules{upf: oldRules.upf, pdrs: oldRules.pdrs})
+			ruleList.PDRList = append(ruleList.PDRList, oldRules.pdrs...)
+		}
+		ruleLists = append(ruleLists, ruleList)
+	}
+
+	for _, flow := range flows {
+		if flow.Operation != OperationCodeDeleteExistingQoSRule {
+			continue
+		}
+		for nodeIP, rules := range flow.rules {
+			delete(flow.rules, nodeIP)
+			flow.removeRules(smContext, rules)
+			ruleLists = append(ruleLists, &QoSFlowRuleList{
+				NodeID:  rules.upf.NodeID,
+				PDRList: rules.pdrs,
+				QERList: []*QER{rules.qer},
+			})
+		}
+	}
+	return ruleLists, nil
+}
+
+// ReleaseQoSFlows releases the rules of all the QoS flows, the rules on the UPFs are removed with the PFCP session
+func (smContext *SMContext) ReleaseQoSFlows() {
+	for qfi, flow := range smContext.QoSFlows {
+		for _, rules := range flow.rules {
+			flow.removeRules(smContext, rules)
+		}
+		delete(smContext.QoSFlows, qfi)
+	}
+}
@@ -0,0 +1,180 @@
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+)
+
+func TestQoSRulesUnmarshalBinary(t *testing.T) {
+	qosRules := context.QoSRules{
+		{
+			Identifier:    2,
+			OperationCode: context.OperationCodeCreateNewQoSRule,
+			Precedence:    10,
+			QFI:           1,
+			PacketFilterList: []context.PacketFilter{
+				{
+					Identifier:    1,
+					Direction:     context.PacketFilterDirectionBidirectional,
+					ComponentType: context.PacketFilterComponentTypeIPv4RemoteAddress,
+					Component: []byte{
+						10, 60, 0, 0, 255, 255, 0, 0,
+						context.PacketFilterComponentTypeProtocolIdentifierOrNextHeader, 17,
+						context.PacketFilterComponentTypeSingleRemotePort, 0x1f, 0x90,
+					},
+				},
+			},
+		},
+		{
+			Identifier:    3,
+			OperationCode: context.OperationCodeDeleteExistingQoSRule,
+		},
+	}
+	data, err := qosRules[:1].MarshalBinary()
+	require.NoError(t, err)
+	// the deleted QoS rule has neither precedence nor QFI
+	data = append(data, 3, 0x00, 0x01, context.OperationCodeDeleteExistingQoSRule<<5)
+
+	var decoded context.QoSRules
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, qosRules, decoded)
+
+	pf := decoded[0].PacketFilterList[0]
+	require.Equal(t, models.FlowDirection_BIDIRECTIONAL, pf.FlowDirection())
+	flowDescription, err := pf.FlowDescription("10.60.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "permit out 17 from 10.60.0.0/16 8080 to 10.60.0.1", flowDescription)
+
+	require.Error(t, decoded.UnmarshalBinary([]byte{1, 0, 5, 0x20}))
+}
+
+func TestPacketFilterIPv6(t *testing.T) {
+	pf := context.PacketFilter{
+		Identifier:    1,
+		Direction:     context.PacketFilterDirectionDownlink,
+		ComponentType: context.PacketFilterComponentTypeIPv6RemoteAddress,
+		Component: []byte{
+			0x20, 0x01, 0x0d, 0xb8, 0, 0x70, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 48,
+			context.PacketFilterComponentTypeTypeOfServiceOrTrafficClass, 0xb8, 0xfc,
+			context.PacketFilterComponentTypeFlowLabel, 0xf1, 0x23, 0x45,
+		},
+	}
+	require.True(t, pf.IsIPv6())
+	flowDescription, err := pf.FlowDescription("2001:db8:60::1")
+	require.NoError(t, err)
+	require.Equal(t, "permit out ip from 2001:db8:70::/48 to 2001:db8:60::1", flowDescription)
+	require.Equal(t, "b8fc", pf.TosTrafficClass())
+	require.Equal(t, "012345", pf.FlowLabel())
+
+	pf.Component = pf.Component[:17]
+	pf.ComponentType = context.PacketFilterComponentTypeIPv4RemoteAddress
+	require.False(t, pf.IsIPv6())
+	_, err = pf.FlowDescription("10.60.0.1")
+	require.Error(t, err)
+}
+
+func TestQoSFlowDescriptions(t *testing.T) {
+	descriptions := context.QoSFlowDescriptions{
+		{
+			QFI:           1,
+			OperationCode: context.OperationCodeCreateNewQoSFlowDescription,
+			Var5QI:        1,
+			GFBRUplink:    1000,
+			GFBRDownlink:  2000000,
+			MFBRDownlink:  256,
+		},
+		{
+			QFI:           2,
+			OperationCode: context.OperationCodeDeleteExistingQoSFlowDescription,
+		},
+	}
+	data, err := descriptions.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 0x20, 0x44, 0x01, 1, 1}, data[:6])
+
+	var decoded context.QoSFlowDescriptions
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, descriptions, decoded)
+}
+
+func TestUpdateQoSFlowRules(t *testing.T) {
+	nodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: net.ParseIP("10.200.200.42").To4(),
+	}
+	upf := context.NewUPF(&nodeID, nil)
+	defer context.RemoveUPFNodeByNodeID(nodeID)
+	upf.SetStatus(context.AssociatedSetUpSuccess)
+
+	smContext := context.NewSMContext("imsi-208930000000042", 1)
+	defer context.RemoveSMContext(smContext.Ref)
+	smContext.Tunnel = context.NewUPTunnel()
+	node := context.NewDataPathNode()
+	node.UPF = upf
+	dataPath := context.NewDataPath()
+	dataPath.FirstDPNode = node
+	dataPath.Activated = true
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+	for _, tunnel := range []*context.GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		pdr, err := upf.AddPDR()
+		require.NoError(t, err)
+		require.NoError(t, smContext.PutPDRtoPFCPSession(nodeID, pdr))
+		tunnel.PDR = pdr
+	}
+	sessionPDRs := smContext.PFCPContext[nodeID.ResolveNodeIdToIp().String()].PDRs
+
+	pccRule1 := &context.PCCRule{
+		PCCRuleID:  "PccRule-1",
+		Precedence: 10,
+		FlowInfos:  []models.FlowInformation{{FlowDescription: "permit out ip from 10.60.0.0/16 to 10.60.0.1"}},
+	}
+	smContext.PCCRules[pccRule1.PCCRuleID] = pccRule1
+	flow1, err := smContext.NewQoSFlow(pccRule1, &models.QosData{Var5qi: 9, MaxbrUl: "1 Mbps"}, nil)
+	require.NoError(t, err)
+	ruleLists, err := smContext.UpdateQoSFlowRules(flow1)
+	require.NoError(t, err)
+	require.Len(t, ruleLists, 1)
+	require.Len(t, ruleLists[0].PDRList, 2)
+	require.Len(t, sessionPDRs, 4)
+	flow1PDRs := ruleLists[0].PDRList
+	qer := ruleLists[0].QERList[0]
+	require.Equal(t, uint64(1000), qer.MBR.ULMBR)
+
+	// the rules of none of the QoS flows are updated if the rules of a QoS flow fail to be built
+	flow1.QosData = &models.QosData{Var5qi: 9, MaxbrUl: "2 Mbps"}
+	flow1.Operation = context.OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters
+	pccRule2 := &context.PCCRule{
+		PCCRuleID:  "PccRule-2",
+		Precedence: 20,
+		FlowInfos:  []models.FlowInformation{{FlowDescription: "permit out ip from unknown to 10.60.0.1"}},
+	}
+	smContext.PCCRules[pccRule2.PCCRuleID] = pccRule2
+	flow2, err := smContext.NewQoSFlow(pccRule2, &models.QosData{Var5qi: 9}, nil)
+	require.NoError(t, err)
+	_, err = smContext.UpdateQoSFlowRules(flow1, flow2)
+	require.Error(t, err)
+	require.Len(t, sessionPDRs, 4)
+	for _, pdr := range flow1PDRs {
+		require.Equal(t, pdr, sessionPDRs[pdr.PDRID])
+	}
+	require.Equal(t, uint64(1000), qer.MBR.ULMBR)
+
+	pccRule2.FlowInfos[0].FlowDescription = "permit out ip from 10.70.0.0/16 to 10.60.0.1"
+	ruleLists, err = smContext.UpdateQoSFlowRules(flow1, flow2)
+	require.NoError(t, err)
+	require.Len(t, ruleLists, 2)
+	require.Len(t, sessionPDRs, 6)
+	require.Equal(t, uint64(2000), qer.MBR.ULMBR)
+	for _, pdr := range flow1PDRs {
+		require.Equal(t, context.RULE_REMOVE, pdr.State)
+		require.NotContains(t, sessionPDRs, pdr.PDRID)
+	}
+}
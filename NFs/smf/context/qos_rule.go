@@ -3,6 +3,13 @@ package context
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/free5gc/flowdesc"
+	"github.com/free5gc/openapi/models"
 )
 
 const (
@@ -44,6 +51,8 @@ const (
 	PacketFilterComponentTypeEthertype                      uint8 = 0x87
 )
 
+// PacketFilter of TS 24.501 9.11.4.13, Component is the packet filter contents after the first component type,
+// i.e. the value of the first component and the following components
 type PacketFilter struct {
 	Direction     uint8
 	Identifier    uint8
@@ -70,11 +79,9 @@ func (pf *PacketFilter) MarshalBinary() (data []byte, err error) {
 		return nil, err
 	}
 
-	if pf.ComponentType == PacketFilterComponentTypeMatchAll || pf.Component == nil {
-		_, err = packetFilterBuffer.Write(pf.Component)
-		if err != nil {
-			return nil, err
-		}
+	_, err = packetFilterBuffer.Write(pf.Component)
+	if err != nil {
+		return nil, err
 	}
 
 	return packetFilterBuffer.Bytes(), nil
@@ -164,3 +171,215 @@ func (rs QoSRules) MarshalBinary() (data []byte, err error) {
 	}
 	return qosRulesBuffer.Bytes(), nil
 }
+
+// UnmarshalBinary decodes the QoS rules IE contents of TS 24.501 9.11.4.13
+func (rs *QoSRules) UnmarshalBinary(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return fmt.Errorf("QoS rule is too short")
+		}
+		ruleLen := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+ruleLen || ruleLen < 1 {
+			return fmt.Errorf("QoS rule length [%d] mismatch", ruleLen)
+		}
+		rule := QoSRule{Identifier: data[0]}
+		if err := rule.unmarshalContent(data[3 : 3+ruleLen]); err != nil {
+			return err
+		}
+		*rs = append(*rs, rule)
+		data = data[3+ruleLen:]
+	}
+	return nil
+}
+
+func (r *QoSRule) unmarshalContent(content []byte) error {
+	r.OperationCode = content[0] >> 5
+	r.DQR = content[0] >> 4 & 0x01
+	numOfPacketFilters := int(content[0] & 0x0f)
+	content = content[1:]
+
+	for i := 0; i < numOfPacketFilters; i++ {
+		if len(content) < 1 {
+			return fmt.Errorf("packet filter list of QoS rule [%d] is too short", r.Identifier)
+		}
+		pf := PacketFilter{
+			Direction:  content[0] >> 4 & 0x03,
+			Identifier: content[0] & 0x0f,
+		}
+		// only packet filter identifiers are given to delete packet filters
+		if r.OperationCode == OperationCodeModifyExistingQoSRuleAndDeletePacketFilters {
+			r.PacketFilterList = append(r.PacketFilterList, pf)
+			content = content[1:]
+			continue
+		}
+		if len(content) < 2 || len(content) < 2+int(content[1]) || content[1] < 1 {
+			return fmt.Errorf("packet filter [%d] of QoS rule [%d] is too short", pf.Identifier, r.Identifier)
+		}
+		pfLen := int(content[1])
+		pf.ComponentType = content[2]
+		pf.Component = append([]byte{}, content[3:2+pfLen]...)
+		r.PacketFilterList = append(r.PacketFilterList, pf)
+		content = content[2+pfLen:]
+	}
+
+	// QoS rule precedence and QFI are absent when the QoS rule is deleted
+	if len(content) >= 2 {
+		r.Precedence = content[0]
+		r.Segregation = content[1] >> 6 & 0x01
+		r.QFI = content[1] & 0x3f
+	}
+	return nil
+}
+
+// packetFilterComponentLen is the length of the value of the packet filter components
+var packetFilterComponentLen = map[uint8]int{
+	PacketFilterComponentTypeMatchAll:                       0,
+	PacketFilterComponentTypeIPv4RemoteAddress:              8,
+	PacketFilterComponentTypeIPv4LocalAddress:               8,
+	PacketFilterComponentTypeIPv6RemoteAddress:              17,
+	PacketFilterComponentTypeIPv6LocalAddress:               17,
+	PacketFilterComponentTypeProtocolIdentifierOrNextHeader: 1,
+	PacketFilterComponentTypeSingleLocalPort:                2,
+	PacketFilterComponentTypeSingleRemotePort:               2,
+	PacketFilterComponentTypeLocalPortRange:                 4,
+	PacketFilterComponentTypeRemotePortRange:                4,
+	PacketFilterComponentTypeTypeOfServiceOrTrafficClass:    2,
+	PacketFilterComponentTypeFlowLabel:                      3,
+}
+
+// components returns the values of the packet filter components by their types
+func (pf *PacketFilter) components() (map[uint8][]byte, error) {
+	values := make(map[uint8][]byte)
+	contents := append([]byte{pf.ComponentType}, pf.Component...)
+	for len(contents) > 0 {
+		componentType := contents[0]
+		valueLen, supported := packetFilterComponentLen[componentType]
+		if !supported {
+			return nil, fmt.Errorf("packet filter component type [0x%02x] is not supported", componentType)
+		}
+		if len(contents)-1 < valueLen {
+			return nil, fmt.Errorf("packet filter component [0x%02x] is too short", componentType)
+		}
+		values[componentType] = contents[1 : 1+valueLen]
+		contents = contents[1+valueLen:]
+	}
+	return values, nil
+}
+
+// IsIPv6 reports whether the packet filter only matches the IPv6 packets, i.e. it has an IPv6 address or a flow
+// label component
+func (pf *PacketFilter) IsIPv6() bool {
+	values, err := pf.components()
+	if err != nil {
+		return false
+	}
+	for _, componentType := range []uint8{
+		PacketFilterComponentTypeIPv6RemoteAddress,
+		PacketFilterComponentTypeIPv6LocalAddress,
+		PacketFilterComponentTypeFlowLabel,
+	} {
+		if _, exist := values[componentType]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// FlowDescription converts the packet filter to the IPFilterRule of TS 29.212 5.4.2, which describes
+// the downlink traffic from the remote to the UE address ueIP. The type of service / traffic class and the flow
+// label are not in the IPFilterRule, see TosTrafficClass and FlowLabel
+func (pf *PacketFilter) FlowDescription(ueIP string) (string, error) {
+	values, err := pf.components()
+	if err != nil {
+		return "", err
+	}
+
+	rule := flowdesc.NewIPFilterRule()
+	remoteIP, localIP := "any", ueIP
+	if localIP == "" {
+		localIP = "assigned"
+	}
+	if value, exist := values[PacketFilterComponentTypeIPv4RemoteAddress]; exist {
+		remoteIP = (&net.IPNet{IP: net.IP(value[0:4]), Mask: net.IPMask(value[4:8])}).String()
+	}
+	if value, exist := values[PacketFilterComponentTypeIPv4LocalAddress]; exist {
+		localIP = (&net.IPNet{IP: net.IP(value[0:4]), Mask: net.IPMask(value[4:8])}).String()
+	}
+	if value, exist := values[PacketFilterComponentTypeIPv6RemoteAddress]; exist {
+		remoteIP = (&net.IPNet{IP: net.IP(value[0:16]), Mask: net.CIDRMask(int(value[16]), 128)}).String()
+	}
+	if value, exist := values[PacketFilterComponentTypeIPv6LocalAddress]; exist {
+		localIP = (&net.IPNet{IP: net.IP(value[0:16]), Mask: net.CIDRMask(int(value[16]), 128)}).String()
+	}
+	if value, exist := values[PacketFilterComponentTypeProtocolIdentifierOrNextHeader]; exist {
+		if err := rule.SetProtocal(value[0]); err != nil {
+			return "", err
+		}
+	}
+
+	portsOf := func(singleType, rangeType uint8) string {
+		if value, exist := values[singleType]; exist {
+			return strconv.Itoa(int(binary.BigEndian.Uint16(value)))
+		}
+		if value, exist := values[rangeType]; exist {
+			return fmt.Sprintf("%d-%d", binary.BigEndian.Uint16(value[0:2]), binary.BigEndian.Uint16(value[2:4]))
+		}
+		return ""
+	}
+	remotePorts := portsOf(PacketFilterComponentTypeSingleRemotePort, PacketFilterComponentTypeRemotePortRange)
+	localPorts := portsOf(PacketFilterComponentTypeSingleLocalPort, PacketFilterComponentTypeLocalPortRange)
+
+	if err := rule.SetSourceIP(remoteIP); err != nil {
+		return "", err
+	}
+	if err := rule.SetSourcePorts(remotePorts); err != nil {
+		return "", err
+	}
+	if err := rule.SetDestinationIP(localIP); err != nil {
+		return "", err
+	}
+	if err := rule.SetDestinationPorts(localPorts); err != nil {
+		return "", err
+	}
+	return flowdesc.Encode(rule)
+}
+
+// TosTrafficClass returns the type of service / traffic class and its mask of the packet filter in the hex string
+// of TS 29.512, it is empty if the packet filter has no such component
+func (pf *PacketFilter) TosTrafficClass() string {
+	values, err := pf.components()
+	if err != nil {
+		return ""
+	}
+	if value, exist := values[PacketFilterComponentTypeTypeOfServiceOrTrafficClass]; exist {
+		return hex.EncodeToString(value)
+	}
+	return ""
+}
+
+// FlowLabel returns the IPv6 flow label of the packet filter in the hex string of TS 29.512, it is empty if the
+// packet filter has no flow label component
+func (pf *PacketFilter) FlowLabel() string {
+	values, err := pf.components()
+	if err != nil {
+		return ""
+	}
+	if value, exist := values[PacketFilterComponentTypeFlowLabel]; exist {
+		return hex.EncodeToString([]byte{value[0] & 0x0f, value[1], value[2]})
+	}
+	return ""
+}
+
+// FlowDirection returns the flow direction of the packet filter in OpenAPI models
+func (pf *PacketFilter) FlowDirection() models.FlowDirection {
+	switch pf.Direction {
+	case PacketFilterDirectionDownlink:
+		return models.FlowDirection_DOWNLINK
+	case PacketFilterDirectionUplink:
+		return models.FlowDirection_UPLINK
+	case PacketFilterDirectionBidirectional:
+		return models.FlowDirection_BIDIRECTIONAL
+	default:
+		return models.FlowDirection_UNSPECIFIED
+	}
+}
@@ -102,7 +102,10 @@ type SMContext struct {
 	HoState         models.HoState
 
 	PDUAddress             net.IP
+	PDUAddressV6           net.IP // the /64 prefix delegated to the PDU session and the interface identifier of the UE
 	SelectedPDUSessionType uint8
+	PDUSessionTypeCause    uint8 // 5GSM cause of the PDU session type downgraded from IPv4v6
+	SelectedSSCMode        uint8
 
 	DnnConfiguration models.DnnConfiguration
 
@@ -123,6 +126,8 @@ type SMContext struct {
 	SBIPFCPCommunicationChan            chan PFCPSessionResponseStatus
 	PendingUPF                          PendingUPF
 	PDUSessionRelease_DUE_TO_DUP_PDU_ID bool
+	// set once the subscribers of PDU_SES_REL are notified of the release of the PDU session
+	releaseNotified int32
 
 	DNNInfo *SnssaiSmfDnnInfo
 
@@ -130,13 +135,27 @@ type SMContext struct {
 	PCCRules           map[string]*PCCRule
 	SessionRules       map[string]*SessionRule
 	TrafficControlPool map[string]*TrafficControlData
-
+	QosDecisions       map[string]*models.QosData
+	SMPolicyID         string
+	// usage monitoring decisions and the policy control request triggers the PCF arms
+	UsageMonitoringDecs   map[string]*models.UsageMonitoringData
+	PolicyCtrlReqTriggers []models.PolicyControlRequestTrigger
+
+	// QFI to the QoS flows other than the default QoS flow
+	QoSFlows map[uint8]*QoSFlow
 	// NAS
 	Pti uint8
 
 	// PCO Related
 	ProtocolConfigurationOptions *ProtocolConfigurationOptions
 
+	// Usage reporting, anchor UPF NodeID(string form) to URR
+	UsageURRs map[string]*URR
+	Usage     Usage
+	usageLock sync.Mutex
+	// URR IDs of the anchor UPFs reporting no user plane traffic for the user plane inactivity timer
+	idleURRs map[uint32]bool
+
 	// lock
 	SMLock sync.Mutex
 }
@@ -158,9 +177,17 @@ func ResolveRef(identifier string, pduSessID int32) (ref string, err error) {
 }
 
 func NewSMContext(identifier string, pduSessID int32) (smContext *SMContext) {
-	smContext = new(SMContext)
 	// Create Ref and identifier
-	smContext.Ref = uuid.New().URN()
+	smContext = newSMContext(uuid.New().URN(), identifier, pduSessID)
+	smContext.LocalSEID = GetSMContextCount()
+
+	return smContext
+}
+
+// newSMContext creates the SM context of the Ref, it is shared by the SM context restored after the SMF restarts
+func newSMContext(ref string, identifier string, pduSessID int32) (smContext *SMContext) {
+	smContext = new(SMContext)
+	smContext.Ref = ref
 	smContextPool.Store(smContext.Ref, smContext)
 	canonicalRef.Store(canonicalName(identifier, pduSessID), smContext.Ref)
 
@@ -168,12 +195,15 @@ func NewSMContext(identifier string, pduSessID int32) (smContext *SMContext) {
 	smContext.Identifier = identifier
 	smContext.PDUSessionID = pduSessID
 	smContext.PFCPContext = make(map[string]*PFCPSessionContext)
-	smContext.LocalSEID = GetSMContextCount()
 
 	// initialize SM Policy Data
 	smContext.PCCRules = make(map[string]*PCCRule)
 	smContext.SessionRules = make(map[string]*SessionRule)
 	smContext.TrafficControlPool = make(map[string]*TrafficControlData)
+	smContext.QosDecisions = make(map[string]*models.QosData)
+	smContext.UsageMonitoringDecs = make(map[string]*models.UsageMonitoringData)
+	smContext.QoSFlows = make(map[uint8]*QoSFlow)
+	smContext.UsageURRs = make(map[string]*URR)
 	smContext.SBIPFCPCommunicationChan = make(chan PFCPSessionResponseStatus, 1)
 
 	smContext.ProtocolConfigurationOptions = &ProtocolConfigurationOptions{
@@ -200,11 +230,17 @@ func RemoveSMContext(ref string) {
 		smContext = value.(*SMContext)
 	}
 
+	smContext.releasePDUAddress()
+
 	for _, pfcpSessionContext := range smContext.PFCPContext {
 		seidSMContextMap.Delete(pfcpSessionContext.LocalSEID)
+		if upf := RetrieveUPFNodeByNodeID(pfcpSessionContext.NodeID); upf != nil {
+			upf.removeSession()
+		}
 	}
 
 	smContextPool.Delete(ref)
+	removeStoredSMContext(ref)
 }
 
 //*** add unit test ***//
@@ -239,13 +275,27 @@ func (smContext *SMContext) BuildCreatedData() (createdData *models.SmContextCre
 	return
 }
 
+// PDUAddressToNAS returns the PDU address information of the PDU address IE, the IPv6 part of it is the interface
+// identifier of the UE (TS 24.501 9.11.4.10), the part of an address family without address is left zero
 func (smContext *SMContext) PDUAddressToNAS() (addr [12]byte, addrLen uint8) {
-	copy(addr[:], smContext.PDUAddress)
+	var ipv4, interfaceID []byte
+	if smContext.PDUAddress != nil {
+		ipv4 = smContext.PDUAddress.To4()
+	}
+	if len(smContext.PDUAddressV6) == net.IPv6len {
+		interfaceID = smContext.PDUAddressV6[8:]
+	}
+
 	switch smContext.SelectedPDUSessionType {
 	case nasMessage.PDUSessionTypeIPv4:
+		copy(addr[:], ipv4)
 		addrLen = 4 + 1
 	case nasMessage.PDUSessionTypeIPv6:
+		copy(addr[:], interfaceID)
+		addrLen = 8 + 1
 	case nasMessage.PDUSessionTypeIPv4IPv6:
+		copy(addr[:], interfaceID)
+		copy(addr[8:], ipv4)
 		addrLen = 12 + 1
 	}
 	return
@@ -284,6 +334,16 @@ func (smContext *SMContext) PCFSelection() error {
 	smContext.SelectedPCFProfile = rep.NfInstances[0]
 
 	// Create SMPolicyControl Client for this SM Context
+	smContext.BuildSMPolicyClient()
+
+	return nil
+}
+
+// BuildSMPolicyClient creates the Npcf_SMPolicyControl client of the selected PCF of the SM context
+func (smContext *SMContext) BuildSMPolicyClient() {
+	if smContext.SelectedPCFProfile.NfServices == nil {
+		return
+	}
 	for _, service := range *smContext.SelectedPCFProfile.NfServices {
 		if service.ServiceName == models.ServiceName_NPCF_SMPOLICYCONTROL {
 			SmPolicyControlConf := Npcf_SMPolicyControl.NewConfiguration()
@@ -291,8 +351,20 @@ func (smContext *SMContext) PCFSelection() error {
 			smContext.SMPolicyClient = Npcf_SMPolicyControl.NewAPIClient(SmPolicyControlConf)
 		}
 	}
+}
 
-	return nil
+// BuildCommunicationClient creates the Namf_Communication client of the serving AMF of the SM context
+func (smContext *SMContext) BuildCommunicationClient() {
+	if smContext.AMFProfile.NfServices == nil {
+		return
+	}
+	for _, service := range *smContext.AMFProfile.NfServices {
+		if service.ServiceName == models.ServiceName_NAMF_COMM {
+			communicationConf := Namf_Communication.NewConfiguration()
+			communicationConf.SetBasePath(service.ApiPrefix)
+			smContext.CommunicationClient = Namf_Communication.NewAPIClient(communicationConf)
+		}
+	}
 }
 
 func (smContext *SMContext) GetNodeIDByLocalSEID(seid uint64) (nodeID pfcpType.NodeID) {
@@ -305,6 +377,30 @@ func (smContext *SMContext) GetNodeIDByLocalSEID(seid uint64) (nodeID pfcpType.N
 	return
 }
 
+// RemovePFCPSessionContext removes the PFCP session context of the UPF whose PFCP session is deleted while the PDU
+// session goes on, its local SEID keeps identifying the SM context until the PFCP Session Deletion Response arrives
+func (smContext *SMContext) RemovePFCPSessionContext(nodeID pfcpType.NodeID) {
+	nodeIP := nodeID.ResolveNodeIdToIp().String()
+	if _, exist := smContext.PFCPContext[nodeIP]; !exist {
+		return
+	}
+	delete(smContext.PFCPContext, nodeIP)
+	if upf := RetrieveUPFNodeByNodeID(nodeID); upf != nil {
+		smContext.releaseAnchorURR(upf)
+		upf.removeSession()
+	}
+}
+
+// ReleaseRemovedLocalSEID releases the local SEID if its PFCP session context is removed from the SM context
+func (smContext *SMContext) ReleaseRemovedLocalSEID(seid uint64) {
+	for _, pfcpCtx := range smContext.PFCPContext {
+		if pfcpCtx.LocalSEID == seid {
+			return
+		}
+	}
+	seidSMContextMap.Delete(seid)
+}
+
 func (smContext *SMContext) AllocateLocalSEIDForUPPath(path UPPath) {
 	for _, upNode := range path {
 		NodeIDtoIP := upNode.NodeID.ResolveNodeIdToIp().String()
@@ -316,6 +412,7 @@ func (smContext *SMContext) AllocateLocalSEIDForUPPath(path UPPath) {
 				NodeID:    upNode.NodeID,
 				LocalSEID: allocatedSEID,
 			}
+			upNode.UPF.addSession()
 
 			seidSMContextMap.Store(allocatedSEID, smContext)
 		}
@@ -334,6 +431,7 @@ func (smContext *SMContext) AllocateLocalSEIDForDataPath(dataPath *DataPath) {
 				NodeID:    curDataPathNode.UPF.NodeID,
 				LocalSEID: allocatedSEID,
 			}
+			curDataPathNode.UPF.addSession()
 
 			seidSMContextMap.Store(allocatedSEID, smContext)
 		}
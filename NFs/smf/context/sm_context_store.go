@@ -0,0 +1,537 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/free5gc/MongoDBLibrary"
+	"github.com/free5gc/idgenerator"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/logger"
+)
+
+const (
+	smContextCollName   = "smfData.smContexts"
+	upfRecoveryCollName = "smfData.upfRecoveryTimeStamps"
+)
+
+// the SM contexts are persisted only if the MongoDB is configured
+var smContextStoreEnabled bool
+
+// NodeID(string form) of the UPF to the Recovery Time Stamp persisted before the SMF restarts
+var (
+	storedUPFRecoveryTimeStamps     = make(map[string]time.Time)
+	storedUPFRecoveryTimeStampsLock sync.Mutex
+)
+
+// smContextSnapshot is the SM context persisted in the MongoDB, the PDU session is kept with its PFCP sessions, user
+// plane tunnels and QoS flows, the PCC rules and the ULCL state are not persisted
+type smContextSnapshot struct {
+	Ref                    string
+	Identifier             string
+	Supi                   string
+	Pei                    string
+	Gpsi                   string
+	PDUSessionID           int32
+	Dnn                    string
+	Snssai                 *models.Snssai
+	ServingNetwork         *models.PlmnId
+	ServingNfId            string
+	AnType                 models.AccessType
+	RatType                models.RatType
+	UeLocation             *models.UserLocation
+	UpCnxState             models.UpCnxState
+	PDUAddress             net.IP
+	PDUAddressV6           net.IP
+	SelectedPDUSessionType uint8
+	SelectedSSCMode        uint8
+	DnnConfiguration       models.DnnConfiguration
+	AMFProfile             models.NfProfile
+	SelectedPCFProfile     models.NfProfile
+	SmStatusNotifyUri      string
+	SMPolicyID             string
+	SMContextState         SMContextState
+	LocalSEID              uint64
+	SessionRules           map[string]*SessionRule
+	SelectedSessionRuleID  string
+	UsageMonitoringDecs    map[string]*models.UsageMonitoringData
+	PolicyCtrlReqTriggers  []models.PolicyControlRequestTrigger
+	Usage                  Usage
+
+	ANIPAddress  net.IP
+	ANTEID       uint32
+	PFCPSessions []pfcpSessionSnapshot
+	DataPaths    []dataPathSnapshot
+	QoSFlows     []qosFlowSnapshot
+}
+
+type pfcpSessionSnapshot struct {
+	NodeID     pfcpType.NodeID
+	LocalSEID  uint64
+	RemoteSEID uint64
+	PDRs       []*PDR
+}
+
+type dataPathSnapshot struct {
+	IsDefaultPath bool
+	Destination   Destination
+	Nodes         []dataPathNodeSnapshot
+}
+
+// qosFlowSnapshot keeps the QFI and QoS rule identifier of the QoS flow allocated, and refers to its PDRs and QER
+// persisted with the PFCP sessions
+type qosFlowSnapshot struct {
+	Flow  *QoSFlow
+	Rules []qosFlowRulesSnapshot
+}
+
+type qosFlowRulesSnapshot struct {
+	NodeID pfcpType.NodeID
+	PDRIDs []uint16
+	QERID  uint32
+}
+
+type dataPathNodeSnapshot struct {
+	NodeID  pfcpType.NodeID
+	ULTEID  uint32
+	DLTEID  uint32
+	ULPDRID uint16
+	DLPDRID uint16
+}
+
+func (smContext *SMContext) snapshot() *smContextSnapshot {
+	snapshot := &smContextSnapshot{
+		Ref:                    smContext.Ref,
+		Identifier:             smContext.Identifier,
+		Supi:                   smContext.Supi,
+		Pei:                    smContext.Pei,
+		Gpsi:                   smContext.Gpsi,
+		PDUSessionID:           smContext.PDUSessionID,
+		Dnn:                    smContext.Dnn,
+		Snssai:                 smContext.Snssai,
+		ServingNetwork:         smContext.ServingNetwork,
+		ServingNfId:            smContext.ServingNfId,
+		AnType:                 smContext.AnType,
+		RatType:                smContext.RatType,
+		UeLocation:             smContext.UeLocation,
+		UpCnxState:             smContext.UpCnxState,
+		PDUAddress:             smContext.PDUAddress,
+		PDUAddressV6:           smContext.PDUAddressV6,
+		SelectedPDUSessionType: smContext.SelectedPDUSessionType,
+		SelectedSSCMode:        smContext.SelectedSSCMode,
+		DnnConfiguration:       smContext.DnnConfiguration,
+		AMFProfile:             smContext.AMFProfile,
+		SelectedPCFProfile:     smContext.SelectedPCFProfile,
+		SmStatusNotifyUri:      smContext.SmStatusNotifyUri,
+		SMPolicyID:             smContext.SMPolicyID,
+		SMContextState:         smContext.SMContextState,
+		LocalSEID:              smContext.LocalSEID,
+		SessionRules:           smContext.SessionRules,
+		UsageMonitoringDecs:    smContext.UsageMonitoringDecs,
+		PolicyCtrlReqTriggers:  smContext.PolicyCtrlReqTriggers,
+		Usage:                  smContext.GetUsage(),
+	}
+	if sessionRule := smContext.SelectedSessionRule(); sessionRule != nil {
+		snapshot.SelectedSessionRuleID = sessionRule.SessionRuleID
+	}
+
+	for _, pfcpSessionContext := range smContext.PFCPContext {
+		pfcpSession := pfcpSessionSnapshot{
+			NodeID:     pfcpSessionContext.NodeID,
+			LocalSEID:  pfcpSessionContext.LocalSEID,
+			RemoteSEID: pfcpSessionContext.RemoteSEID,
+		}
+		for _, pdr := range pfcpSessionContext.PDRs {
+			pfcpSession.PDRs = append(pfcpSession.PDRs, pdr)
+		}
+		snapshot.PFCPSessions = append(snapshot.PFCPSessions, pfcpSession)
+	}
+
+	for _, flow := range smContext.QoSFlows {
+		qosFlow := qosFlowSnapshot{Flow: flow}
+		for _, rules := range flow.rules {
+			rulesData := qosFlowRulesSnapshot{NodeID: rules.upf.NodeID}
+			for _, pdr := range rules.pdrs {
+				rulesData.PDRIDs = append(rulesData.PDRIDs, pdr.PDRID)
+			}
+			if rules.qer != nil {
+				rulesData.QERID = rules.qer.QERID
+			}
+			qosFlow.Rules = append(qosFlow.Rules, rulesData)
+		}
+		snapshot.QoSFlows = append(snapshot.QoSFlows, qosFlow)
+	}
+
+	if smContext.Tunnel == nil {
+		return snapshot
+	}
+	snapshot.ANIPAddress = smContext.Tunnel.ANInformation.IPAddress
+	snapshot.ANTEID = smContext.Tunnel.ANInformation.TEID
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		dataPathData := dataPathSnapshot{
+			IsDefaultPath: dataPath.IsDefaultPath,
+			Destination:   dataPath.Destination,
+		}
+		for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+			nodeData := dataPathNodeSnapshot{NodeID: node.UPF.NodeID}
+			if node.UpLinkTunnel != nil && node.UpLinkTunnel.PDR != nil {
+				nodeData.ULTEID = node.UpLinkTunnel.TEID
+				nodeData.ULPDRID = node.UpLinkTunnel.PDR.PDRID
+			}
+			if node.DownLinkTunnel != nil && node.DownLinkTunnel.PDR != nil {
+				nodeData.DLTEID = node.DownLinkTunnel.TEID
+				nodeData.DLPDRID = node.DownLinkTunnel.PDR.PDRID
+			}
+			dataPathData.Nodes = append(dataPathData.Nodes, nodeData)
+		}
+		snapshot.DataPaths = append(snapshot.DataPaths, dataPathData)
+	}
+	return snapshot
+}
+
+// Store persists the SM context, it is called after the state of the SM context transits
+func (smContext *SMContext) Store() {
+	// the SM context removed on the release is not persisted again
+	if !smContextStoreEnabled || GetSMContext(smContext.Ref) == nil {
+		return
+	}
+	data, err := json.Marshal(smContext.snapshot())
+	if err != nil {
+		logger.CtxLog.Errorf("Marshal SM context[%s] failed: %+v", smContext.Ref, err)
+		return
+	}
+	MongoDBLibrary.RestfulAPIPutOne(smContextCollName, bson.M{"ref": smContext.Ref}, map[string]interface{}{
+		"ref":          smContext.Ref,
+		"supi":         smContext.Supi,
+		"pduSessionId": smContext.PDUSessionID,
+		"smContext":    string(data),
+	})
+}
+
+func removeStoredSMContext(ref string) {
+	if !smContextStoreEnabled {
+		return
+	}
+	MongoDBLibrary.RestfulAPIDeleteOne(smContextCollName, bson.M{"ref": ref})
+}
+
+// StoreUPFRecoveryTimeStamp records the Recovery Time Stamp of the UPF in the PFCP association, it returns whether
+// the UPF has restarted since the SMF persisted the PFCP sessions on it
+func StoreUPFRecoveryTimeStamp(upf *UPF, recoveryTimeStamp time.Time) (restarted bool) {
+	nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+	upf.RecoveryTimeStamp = recoveryTimeStamp
+	if !smContextStoreEnabled {
+		return false
+	}
+
+	storedUPFRecoveryTimeStampsLock.Lock()
+	defer storedUPFRecoveryTimeStampsLock.Unlock()
+
+	// the Recovery Time Stamp is encoded in seconds
+	if storedTimeStamp, exist := storedUPFRecoveryTimeStamps[nodeIP]; exist {
+		restarted = storedTimeStamp.Unix() != recoveryTimeStamp.Unix()
+	}
+	storedUPFRecoveryTimeStamps[nodeIP] = recoveryTimeStamp
+	MongoDBLibrary.RestfulAPIPutOne(upfRecoveryCollName, bson.M{"nodeId": nodeIP}, map[string]interface{}{
+		"nodeId":            nodeIP,
+		"recoveryTimeStamp": recoveryTimeStamp.Unix(),
+	})
+	return restarted
+}
+
+// RestoreSMContexts enables the persistence of the SM contexts in the MongoDB connected by the SMF, and rebuilds the
+// SM contexts persisted before the SMF restarts with their SEIDs, TEIDs and PFCP rules
+func RestoreSMContexts() {
+	smContextStoreEnabled = true
+
+	for _, data := range MongoDBLibrary.RestfulAPIGetMany(upfRecoveryCollName, bson.M{}) {
+		nodeIP, _ := data["nodeId"].(string)
+		if recoveryTimeStamp, ok := data["recoveryTimeStamp"].(int64); ok {
+			storedUPFRecoveryTimeStamps[nodeIP] = time.Unix(recoveryTimeStamp, 0)
+		}
+	}
+
+	for _, data := range MongoDBLibrary.RestfulAPIGetMany(smContextCollName, bson.M{}) {
+		ref, _ := data["ref"].(string)
+		snapshotData, _ := data["smContext"].(string)
+		snapshot := new(smContextSnapshot)
+		if err := json.Unmarshal([]byte(snapshotData), snapshot); err != nil {
+			logger.CtxLog.Errorf("Unmarshal SM context[%s] failed: %+v", ref, err)
+			MongoDBLibrary.RestfulAPIDeleteOne(smContextCollName, bson.M{"ref": ref})
+			continue
+		}
+		if err := restoreSMContext(snapshot); err != nil {
+			logger.CtxLog.Errorf("Restore SM context[%s] failed: %+v", ref, err)
+			RemoveSMContext(ref)
+			continue
+		}
+		logger.CtxLog.Infof("Restore SM context[%s] of PDU session[%s-%02d]",
+			ref, snapshot.Supi, snapshot.PDUSessionID)
+	}
+
+	upfPool.Range(func(key, value interface{}) bool {
+		value.(*UPF).reserveRestoredIDs()
+		return true
+	})
+}
+
+func restoreSMContext(snapshot *smContextSnapshot) error {
+	smContext := newSMContext(snapshot.Ref, snapshot.Identifier, snapshot.PDUSessionID)
+	smContext.Supi = snapshot.Supi
+	smContext.Pei = snapshot.Pei
+	smContext.Gpsi = snapshot.Gpsi
+	smContext.Dnn = snapshot.Dnn
+	smContext.Snssai = snapshot.Snssai
+	smContext.ServingNetwork = snapshot.ServingNetwork
+	smContext.ServingNfId = snapshot.ServingNfId
+	smContext.AnType = snapshot.AnType
+	smContext.RatType = snapshot.RatType
+	smContext.UeLocation = snapshot.UeLocation
+	smContext.UpCnxState = snapshot.UpCnxState
+	smContext.PDUAddress = snapshot.PDUAddress
+	smContext.PDUAddressV6 = snapshot.PDUAddressV6
+	smContext.SelectedPDUSessionType = snapshot.SelectedPDUSessionType
+	smContext.SelectedSSCMode = snapshot.SelectedSSCMode
+	smContext.DnnConfiguration = snapshot.DnnConfiguration
+	smContext.AMFProfile = snapshot.AMFProfile
+	smContext.SelectedPCFProfile = snapshot.SelectedPCFProfile
+	smContext.SmStatusNotifyUri = snapshot.SmStatusNotifyUri
+	smContext.SMPolicyID = snapshot.SMPolicyID
+	// the SBI clients are not persisted but rebuilt from the profiles of the AMF and PCF
+	smContext.BuildCommunicationClient()
+	smContext.BuildSMPolicyClient()
+	smContext.LocalSEID = snapshot.LocalSEID
+	smContext.Usage = snapshot.Usage
+	raiseCounter(&smContextCount, snapshot.LocalSEID)
+
+	// the SBI request waiting for the PFCP response is lost with the SMF
+	smContext.SMContextState = snapshot.SMContextState
+	if smContext.SMContextState == PFCPModification || smContext.SMContextState == ModificationPending {
+		smContext.SMContextState = Active
+	}
+
+	if snapshot.SessionRules != nil {
+		smContext.SessionRules = snapshot.SessionRules
+	}
+	if sessionRule, exist := smContext.SessionRules[snapshot.SelectedSessionRuleID]; exist {
+		SetSessionRuleActivateState(sessionRule, true)
+	}
+	if snapshot.UsageMonitoringDecs != nil {
+		smContext.UsageMonitoringDecs = snapshot.UsageMonitoringDecs
+	}
+	smContext.PolicyCtrlReqTriggers = snapshot.PolicyCtrlReqTriggers
+
+	if smContext.Snssai != nil {
+		smContext.DNNInfo = RetrieveDnnInformation(*smContext.Snssai, smContext.Dnn)
+	}
+	if smContext.DNNInfo != nil && smContext.PDUAddress != nil {
+		smContext.DNNInfo.UeIPAM.claim(smContext.Supi, smContext.PDUSessionID, smContext.PDUAddress)
+	}
+	if smContext.DNNInfo != nil && smContext.PDUAddressV6 != nil {
+		smContext.DNNInfo.UeIPAM.claimPrefix(smContext.Supi, smContext.PDUSessionID, smContext.PDUAddressV6)
+	}
+
+	// PFCP sessions and their rules
+	pdrs := make(map[string]map[uint16]*PDR)
+	for _, pfcpSession := range snapshot.PFCPSessions {
+		upf := RetrieveUPFNodeByNodeID(pfcpSession.NodeID)
+		if upf == nil {
+			return fmt.Errorf("UPF[%s] is not configured", pfcpSession.NodeID.ResolveNodeIdToIp())
+		}
+		nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+		pfcpSessionContext := &PFCPSessionContext{
+			PDRs:       make(map[uint16]*PDR),
+			NodeID:     upf.NodeID,
+			LocalSEID:  pfcpSession.LocalSEID,
+			RemoteSEID: pfcpSession.RemoteSEID,
+		}
+		for _, pdr := range pfcpSession.PDRs {
+			upf.restoreRules(pdr)
+			pfcpSessionContext.PDRs[pdr.PDRID] = pdr
+		}
+		smContext.PFCPContext[nodeIP] = pfcpSessionContext
+		upf.addSession()
+		pdrs[nodeIP] = pfcpSessionContext.PDRs
+		seidSMContextMap.Store(pfcpSession.LocalSEID, smContext)
+		raiseCounter(&smfContext.LocalSEIDCount, pfcpSession.LocalSEID)
+	}
+
+	// QoS flows, their QFIs are not allocated to another QoS flow of the PDU session again
+	for _, qosFlow := range snapshot.QoSFlows {
+		flow := qosFlow.Flow
+		if flow == nil {
+			continue
+		}
+		flow.rules = make(map[string]*qosFlowRules)
+		for _, rulesData := range qosFlow.Rules {
+			upf := RetrieveUPFNodeByNodeID(rulesData.NodeID)
+			if upf == nil {
+				return fmt.Errorf("UPF[%s] is not configured", rulesData.NodeID.ResolveNodeIdToIp())
+			}
+			nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+			rules := &qosFlowRules{upf: upf}
+			for _, pdrID := range rulesData.PDRIDs {
+				if pdr, exist := pdrs[nodeIP][pdrID]; exist {
+					rules.pdrs = append(rules.pdrs, pdr)
+				}
+			}
+			if qer, exist := upf.qerPool.Load(rulesData.QERID); exist {
+				rules.qer = qer.(*QER)
+			}
+			flow.rules[nodeIP] = rules
+		}
+		smContext.QoSFlows[flow.QFI] = flow
+	}
+
+	// user plane tunnels
+	smContext.Tunnel = NewUPTunnel()
+	smContext.Tunnel.ANInformation.IPAddress = snapshot.ANIPAddress
+	smContext.Tunnel.ANInformation.TEID = snapshot.ANTEID
+	for _, dataPathData := range snapshot.DataPaths {
+		dataPath := NewDataPath()
+		dataPath.Activated = true
+		dataPath.IsDefaultPath = dataPathData.IsDefaultPath
+		dataPath.Destination = dataPathData.Destination
+
+		var prevNode *DataPathNode
+		for _, nodeData := range dataPathData.Nodes {
+			upf := RetrieveUPFNodeByNodeID(nodeData.NodeID)
+			if upf == nil {
+				return fmt.Errorf("UPF[%s] is not configured", nodeData.NodeID.ResolveNodeIdToIp())
+			}
+			nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+			node := NewDataPathNode()
+			node.UPF = upf
+			node.UpLinkTunnel.DestEndPoint = node
+			node.UpLinkTunnel.TEID = nodeData.ULTEID
+			node.UpLinkTunnel.PDR = pdrs[nodeIP][nodeData.ULPDRID]
+			node.DownLinkTunnel.DestEndPoint = node
+			node.DownLinkTunnel.TEID = nodeData.DLTEID
+			node.DownLinkTunnel.PDR = pdrs[nodeIP][nodeData.DLPDRID]
+			upf.restoreTEID(nodeData.ULTEID)
+			upf.restoreTEID(nodeData.DLTEID)
+
+			if prevNode == nil {
+				dataPath.FirstDPNode = node
+			} else {
+				node.UpLinkTunnel.SrcEndPoint = prevNode
+				prevNode.DownLinkTunnel.SrcEndPoint = node
+			}
+			prevNode = node
+		}
+		// the usage of the session is measured on the anchor UPF
+		if prevNode != nil && prevNode.DownLinkTunnel.PDR != nil && prevNode.DownLinkTunnel.PDR.URR != nil {
+			smContext.UsageURRs[prevNode.UPF.NodeID.ResolveNodeIdToIp().String()] = prevNode.DownLinkTunnel.PDR.URR
+		}
+		smContext.Tunnel.AddDataPath(dataPath)
+	}
+	return nil
+}
+
+// raiseCounter raises the counter to the value restored after the SMF restarts, so the value is not allocated again
+func raiseCounter(counter *uint64, value uint64) {
+	for {
+		current := atomic.LoadUint64(counter)
+		if current >= value || atomic.CompareAndSwapUint64(counter, current, value) {
+			return
+		}
+	}
+}
+
+type restoredUPFIDs struct {
+	farIDs map[int64]bool // the PDR, FAR and BAR IDs share the generator
+	qerIDs map[int64]bool
+	urrIDs map[int64]bool
+	teids  map[int64]bool
+}
+
+func (upf *UPF) restored() *restoredUPFIDs {
+	if upf.restoredIDs == nil {
+		upf.restoredIDs = &restoredUPFIDs{
+			farIDs: make(map[int64]bool),
+			qerIDs: make(map[int64]bool),
+			urrIDs: make(map[int64]bool),
+			teids:  make(map[int64]bool),
+		}
+	}
+	return upf.restoredIDs
+}
+
+// restoreRules puts the rules of the restored PDR to the UPF, the QERs shared by the PDRs of the UPF are restored once
+func (upf *UPF) restoreRules(pdr *PDR) {
+	restored := upf.restored()
+
+	upf.pdrPool.Store(pdr.PDRID, pdr)
+	restored.farIDs[int64(pdr.PDRID)] = true
+	if far := pdr.FAR; far != nil {
+		upf.farPool.Store(far.FARID, far)
+		restored.farIDs[int64(far.FARID)] = true
+		if bar := far.BAR; bar != nil {
+			upf.barPool.Store(bar.BARID, bar)
+			restored.farIDs[int64(bar.BARID)] = true
+		}
+	}
+	for i, qer := range pdr.QER {
+		if storedQER, exist := upf.qerPool.LoadOrStore(qer.QERID, qer); exist {
+			pdr.QER[i] = storedQER.(*QER)
+		}
+		restored.qerIDs[int64(qer.QERID)] = true
+	}
+	if urr := pdr.URR; urr != nil {
+		if storedURR, exist := upf.urrPool.LoadOrStore(urr.URRID, urr); exist {
+			pdr.URR = storedURR.(*URR)
+		}
+		restored.urrIDs[int64(urr.URRID)] = true
+	}
+}
+
+func (upf *UPF) restoreTEID(teid uint32) {
+	if teid != 0 {
+		upf.restored().teids[int64(teid)] = true
+	}
+}
+
+// reserveRestoredIDs allocates the restored IDs from the generators of the UPF, so they are not allocated again
+func (upf *UPF) reserveRestoredIDs() {
+	if upf.restoredIDs == nil {
+		return
+	}
+	reserveIDs(upf.farIDGenerator, upf.restoredIDs.farIDs)
+	reserveIDs(upf.qerIDGenerator, upf.restoredIDs.qerIDs)
+	reserveIDs(upf.urrIDGenerator, upf.restoredIDs.urrIDs)
+	reserveIDs(upf.teidGenerator, upf.restoredIDs.teids)
+	upf.restoredIDs = nil
+}
+
+// reserveIDs allocates the IDs from the generator which allocates from the minimum ID in order, the IDs allocated
+// on the way which are not reserved are freed again
+func reserveIDs(generator *idgenerator.IDGenerator, ids map[int64]bool) {
+	var maxID int64
+	for id := range ids {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	for maxID > 0 {
+		id, err := generator.Allocate()
+		if err != nil {
+			return
+		}
+		if !ids[id] {
+			generator.FreeID(id)
+		}
+		if id >= maxID {
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package context
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+)
+
+func TestRestoreSMContextClients(t *testing.T) {
+	var requests []string
+	// the SBI clients speak HTTP/2 without TLS
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/namf-comm/v1/ue-contexts/imsi-208930000000007/n1-n2-messages":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			require.NoError(t, json.NewEncoder(w).Encode(models.N1N2MessageTransferRspData{
+				Cause: models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE,
+			}))
+		case "/npcf-smpolicycontrol/v1/sm-policies/7/delete":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}), &http2.Server{}))
+	defer server.Close()
+
+	snapshot := &smContextSnapshot{
+		Ref:          "urn:uuid:3c9a2f8e-7e0a-4d3b-9b8e-0c3a0b5d6f07",
+		Identifier:   "imsi-208930000000007",
+		Supi:         "imsi-208930000000007",
+		PDUSessionID: 7,
+		AMFProfile: models.NfProfile{
+			NfServices: &[]models.NfService{{ServiceName: models.ServiceName_NAMF_COMM, ApiPrefix: server.URL}},
+		},
+		SelectedPCFProfile: models.NfProfile{
+			NfServices: &[]models.NfService{
+				{ServiceName: models.ServiceName_NPCF_SMPOLICYCONTROL, ApiPrefix: server.URL},
+			},
+		},
+		SMPolicyID:     "7",
+		SMContextState: Active,
+	}
+	// the snapshot is restored from its persisted form
+	data, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var storedSnapshot smContextSnapshot
+	require.NoError(t, json.Unmarshal(data, &storedSnapshot))
+
+	require.NoError(t, restoreSMContext(&storedSnapshot))
+	defer RemoveSMContext(snapshot.Ref)
+	smContext := GetSMContext(snapshot.Ref)
+	require.NotNil(t, smContext)
+	require.NotNil(t, smContext.CommunicationClient)
+	require.NotNil(t, smContext.SMPolicyClient)
+
+	// downlink data report of the restored PDU session pages the UE through the AMF
+	rspData, _, err := smContext.CommunicationClient.N1N2MessageCollectionDocumentApi.N1N2MessageTransfer(
+		context.Background(), smContext.Supi, models.N1N2MessageTransferRequest{
+			JsonData: &models.N1N2MessageTransferReqData{PduSessionId: smContext.PDUSessionID},
+		})
+	require.NoError(t, err)
+	require.Equal(t, models.N1N2MessageTransferCause_ATTEMPTING_TO_REACH_UE, rspData.Cause)
+
+	// release of the restored PDU session terminates its SM policy association
+	_, err = smContext.SMPolicyClient.DefaultApi.SmPoliciesSmPolicyIdDeletePost(context.Background(),
+		smContext.SMPolicyID, models.SmPolicyDeleteData{})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"POST /namf-comm/v1/ue-contexts/imsi-208930000000007/n1-n2-messages",
+		"POST /npcf-smpolicycontrol/v1/sm-policies/7/delete",
+	}, requests)
+}
+
+func TestRestoreSMContextQoSFlows(t *testing.T) {
+	nodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: net.ParseIP("10.200.200.45").To4(),
+	}
+	upf := NewUPF(&nodeID, nil)
+	defer RemoveUPFNodeByNodeID(nodeID)
+	upf.SetStatus(AssociatedSetUpSuccess)
+
+	smContext := NewSMContext("imsi-208930000000045", 1)
+	smContext.Tunnel = NewUPTunnel()
+	node := NewDataPathNode()
+	node.UPF = upf
+	dataPath := NewDataPath()
+	dataPath.FirstDPNode = node
+	dataPath.Activated = true
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+	for _, tunnel := range []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		pdr, err := upf.AddPDR()
+		require.NoError(t, err)
+		require.NoError(t, smContext.PutPDRtoPFCPSession(nodeID, pdr))
+		tunnel.PDR = pdr
+	}
+
+	pccRule := &PCCRule{
+		PCCRuleID:  "PccRule-1",
+		Precedence: 10,
+		FlowInfos:  []models.FlowInformation{{FlowDescription: "permit out ip from 10.60.0.1 to any"}},
+	}
+	smContext.PCCRules[pccRule.PCCRuleID] = pccRule
+	flow, err := smContext.NewQoSFlow(pccRule, &models.QosData{Var5qi: 2, MaxbrUl: "1 Mbps"}, nil)
+	require.NoError(t, err)
+	_, err = smContext.UpdateQoSFlowRules(flow)
+	require.NoError(t, err)
+	qerID := flow.rules[nodeID.ResolveNodeIdToIp().String()].qer.QERID
+
+	data, err := json.Marshal(smContext.snapshot())
+	require.NoError(t, err)
+	RemoveSMContext(smContext.Ref)
+	var snapshot smContextSnapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+
+	require.NoError(t, restoreSMContext(&snapshot))
+	restored := GetSMContext(smContext.Ref)
+	require.NotNil(t, restored)
+	defer RemoveSMContext(restored.Ref)
+
+	restoredFlow := restored.QoSFlows[flow.QFI]
+	require.NotNil(t, restoredFlow)
+	require.Equal(t, flow.QoSRuleID, restoredFlow.QoSRuleID)
+	require.Equal(t, pccRule.PCCRuleID, restoredFlow.PCCRuleID)
+	rules := restoredFlow.rules[nodeID.ResolveNodeIdToIp().String()]
+	require.NotNil(t, rules)
+	require.Len(t, rules.pdrs, 2)
+	require.NotNil(t, rules.qer)
+	require.Equal(t, qerID, rules.qer.QERID)
+
+	// the QFI and QoS rule identifier of the restored QoS flow are not allocated again
+	newFlow, err := restored.NewQoSFlow(&PCCRule{PCCRuleID: "PccRule-2"}, nil, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, flow.QFI, newFlow.QFI)
+	require.NotEqual(t, flow.QoSRuleID, newFlow.QoSRuleID)
+}
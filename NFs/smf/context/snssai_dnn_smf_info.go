@@ -10,8 +10,8 @@ type SnssaiSmfInfo struct {
 
 // SnssaiSmfDnnInfo records the SMF per S-NSSAI DNN information
 type SnssaiSmfDnnInfo struct {
-	DNS           DNS
-	UeIPAllocator *IPAllocator
+	DNS    DNS
+	UeIPAM *UeIPAM
 }
 
 type DNS struct {
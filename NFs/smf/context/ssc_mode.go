@@ -0,0 +1,113 @@
+package context
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/logger"
+)
+
+// SSC mode values of TS 24.501 9.11.4.16
+const (
+	SSCMode1 uint8 = 1
+	SSCMode2 uint8 = 2
+	SSCMode3 uint8 = 3
+)
+
+var sscModeToNas = map[models.SscMode]uint8{
+	models.SscMode__1: SSCMode1,
+	models.SscMode__2: SSCMode2,
+	models.SscMode__3: SSCMode3,
+}
+
+// SUPI, S-NSSAI and DNN of the UE to the PDU session anchor relocated by the SMF, the PDU session
+// established again by the UE after the relocation is anchored in the DNAI
+var (
+	relocatedAnchorDnais     = make(map[string]*RelocatedAnchor)
+	relocatedAnchorDnaisLock sync.Mutex
+)
+
+// RelocatedAnchor is the DNAI the PDU session anchor is relocated to, with the UE IP address and IPv6 prefix of
+// the PDU session before the relocation which are reported in the UE IP address change event
+type RelocatedAnchor struct {
+	Dnai               string
+	SourceUeIpv4Addr   net.IP
+	SourceUeIpv6Prefix *net.IPNet
+	// the relocation is dropped if the UE does not establish the PDU session again before it expires
+	Expiry time.Time
+}
+
+func relocatedAnchorKey(supi string, snssai *models.Snssai, dnn string) string {
+	return fmt.Sprintf("%s-%d-%s-%s", supi, snssai.Sst, snssai.Sd, dnn)
+}
+
+// selectSSCMode selects the SSC mode requested by the UE if it is allowed by the subscription, otherwise the
+// default SSC mode of the subscription (TS 23.501 5.6.9.3), SSC mode 1 is used without the subscribed SSC modes
+func (smContext *SMContext) selectSSCMode(requestedSSCMode uint8) {
+	smContext.SelectedSSCMode = SSCMode1
+
+	sscModes := smContext.DnnConfiguration.SscModes
+	if sscModes == nil {
+		return
+	}
+	if defaultSSCMode, exist := sscModeToNas[sscModes.DefaultSscMode]; exist {
+		smContext.SelectedSSCMode = defaultSSCMode
+	}
+	if requestedSSCMode == 0 || requestedSSCMode == smContext.SelectedSSCMode {
+		return
+	}
+
+	for _, allowedSSCMode := range sscModes.AllowedSscModes {
+		if sscModeToNas[allowedSSCMode] == requestedSSCMode {
+			smContext.SelectedSSCMode = requestedSSCMode
+			return
+		}
+	}
+	logger.GsmLog.Warnf("Requested SSC mode [%d] is not allowed, use SSC mode [%d]",
+		requestedSSCMode, smContext.SelectedSSCMode)
+}
+
+// SetRelocatedAnchorDnai records the DNAI where the next PDU session of the UE for the S-NSSAI and DNN is anchored,
+// the record is kept for the lifetime
+func (smContext *SMContext) SetRelocatedAnchorDnai(dnai string, lifetime time.Duration) {
+	key := relocatedAnchorKey(smContext.Supi, smContext.Snssai, smContext.Dnn)
+	relocatedAnchor := &RelocatedAnchor{
+		Dnai:               dnai,
+		SourceUeIpv4Addr:   smContext.PDUAddress.To4(),
+		SourceUeIpv6Prefix: smContext.IPv6Prefix(),
+		Expiry:             time.Now().Add(lifetime),
+	}
+
+	relocatedAnchorDnaisLock.Lock()
+	relocatedAnchorDnais[key] = relocatedAnchor
+	relocatedAnchorDnaisLock.Unlock()
+
+	time.AfterFunc(lifetime, func() {
+		relocatedAnchorDnaisLock.Lock()
+		defer relocatedAnchorDnaisLock.Unlock()
+		if relocatedAnchorDnais[key] == relocatedAnchor {
+			delete(relocatedAnchorDnais, key)
+		}
+	})
+}
+
+// TakeRelocatedAnchor returns the PDU session anchor recorded on the relocation of the PDU session anchor of
+// the UE for the S-NSSAI and DNN, and then clears it. nil is returned if it is not relocated or the record expires
+func (smContext *SMContext) TakeRelocatedAnchor() *RelocatedAnchor {
+	key := relocatedAnchorKey(smContext.Supi, smContext.Snssai, smContext.Dnn)
+
+	relocatedAnchorDnaisLock.Lock()
+	defer relocatedAnchorDnaisLock.Unlock()
+	relocatedAnchor, exist := relocatedAnchorDnais[key]
+	if !exist {
+		return nil
+	}
+	delete(relocatedAnchorDnais, key)
+	if time.Now().After(relocatedAnchor.Expiry) {
+		return nil
+	}
+	return relocatedAnchor
+}
@@ -0,0 +1,98 @@
+package context_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+)
+
+func TestSelectSSCMode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		sscModes         *models.SscModes
+		requestedSSCMode uint8
+		selectedSSCMode  uint8
+	}{
+		{
+			name:             "no subscribed SSC modes",
+			requestedSSCMode: context.SSCMode3,
+			selectedSSCMode:  context.SSCMode1,
+		},
+		{
+			name: "default SSC mode without request",
+			sscModes: &models.SscModes{
+				DefaultSscMode: models.SscMode__2,
+			},
+			selectedSSCMode: context.SSCMode2,
+		},
+		{
+			name: "allowed SSC mode requested",
+			sscModes: &models.SscModes{
+				DefaultSscMode:  models.SscMode__1,
+				AllowedSscModes: []models.SscMode{models.SscMode__2, models.SscMode__3},
+			},
+			requestedSSCMode: context.SSCMode3,
+			selectedSSCMode:  context.SSCMode3,
+		},
+		{
+			name: "not allowed SSC mode requested",
+			sscModes: &models.SscModes{
+				DefaultSscMode:  models.SscMode__1,
+				AllowedSscModes: []models.SscMode{models.SscMode__2},
+			},
+			requestedSSCMode: context.SSCMode3,
+			selectedSSCMode:  context.SSCMode1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := context.NewSMContext("imsi-208930000000003", 1)
+			smContext.DnnConfiguration.SscModes = tc.sscModes
+
+			req := nasMessage.NewPDUSessionEstablishmentRequest(0)
+			req.SetPDUSessionID(1)
+			if tc.requestedSSCMode != 0 {
+				req.SSCMode = nasType.NewSSCMode(nasMessage.PDUSessionEstablishmentRequestSSCModeType)
+				req.SSCMode.SetSSCMode(tc.requestedSSCMode)
+			}
+			smContext.HandlePDUSessionEstablishmentRequest(req)
+			require.Equal(t, tc.selectedSSCMode, smContext.SelectedSSCMode)
+		})
+	}
+}
+
+func TestRelocatedAnchorDnai(t *testing.T) {
+	smContext := context.NewSMContext("imsi-208930000000003", 2)
+	smContext.Supi = "imsi-208930000000003"
+	smContext.Snssai = &models.Snssai{Sst: 1, Sd: "010203"}
+	smContext.Dnn = "internet"
+
+	smContext.PDUAddress = net.ParseIP("10.60.0.1")
+
+	require.Nil(t, smContext.TakeRelocatedAnchor())
+
+	smContext.SetRelocatedAnchorDnai("satellite-lbo", time.Minute)
+	newSmContext := context.NewSMContext("imsi-208930000000003", 3)
+	newSmContext.Supi = smContext.Supi
+	newSmContext.Snssai = smContext.Snssai
+	newSmContext.Dnn = smContext.Dnn
+	relocatedAnchor := newSmContext.TakeRelocatedAnchor()
+	require.NotNil(t, relocatedAnchor)
+	require.Equal(t, "satellite-lbo", relocatedAnchor.Dnai)
+	require.Equal(t, "10.60.0.1", relocatedAnchor.SourceUeIpv4Addr.String())
+	require.Nil(t, relocatedAnchor.SourceUeIpv6Prefix)
+	require.Nil(t, newSmContext.TakeRelocatedAnchor())
+
+	// the relocation is dropped when it expires
+	smContext.SetRelocatedAnchorDnai("satellite-lbo", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.Nil(t, newSmContext.TakeRelocatedAnchor())
+}
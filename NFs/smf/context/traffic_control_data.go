@@ -33,6 +33,16 @@ func NewTrafficControlDataFromModel(model *models.TrafficControlData) *TrafficCo
 	return trafficControlData
 }
 
+// RouteToDnai returns the DNAI the traffic is routed to, empty if the traffic is not steered to a local DN
+func (tc *TrafficControlData) RouteToDnai() string {
+	for _, routeToLoc := range tc.RouteToLocs {
+		if routeToLoc.Dnai != "" {
+			return routeToLoc.Dnai
+		}
+	}
+	return ""
+}
+
 // RefedPCCRules - returns the PCCRules that reference this tcData
 func (tc *TrafficControlData) RefedPCCRules() map[string]string {
 	return tc.refedPCCRule
@@ -0,0 +1,84 @@
+package context
+
+import (
+	"sort"
+
+	"github.com/free5gc/smf/logger"
+)
+
+// AddTrafficSteeringPaths generates the data paths steering the traffic of the PCC rules to the DNAIs in the
+// RouteToLocs of their traffic control data (TS 23.501 5.6.4). The data paths branch from the default path at an
+// I-UPF selected from the topology, they are added to the tunnel without being activated. It returns whether any
+// data path is added.
+func (smContext *SMContext) AddTrafficSteeringPaths() (added bool) {
+	defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if defaultPath == nil {
+		return false
+	}
+	defaultDnai := defaultPath.Dnai(smContext.Snssai, smContext.Dnn)
+
+	for _, pccRule := range smContext.sortedPCCRules() {
+		if pccRule.Datapath != nil {
+			continue
+		}
+		tcData, exist := smContext.TrafficControlPool[pccRule.RefTrafficControlData()]
+		if !exist {
+			continue
+		}
+		dnai := tcData.RouteToDnai()
+		if dnai == "" || dnai == defaultDnai {
+			continue
+		}
+
+		destination, err := pccRule.Destination()
+		if err != nil {
+			logger.PduSessLog.Warnf("Steer traffic to DNAI[%s] failed: %+v", dnai, err)
+			continue
+		}
+		selection := &UPFSelectionParams{
+			Dnn: smContext.Dnn,
+			SNssai: &SNssai{
+				Sst: smContext.Snssai.Sst,
+				Sd:  smContext.Snssai.Sd,
+			},
+			Dnai: dnai,
+		}
+		selection.SetUeLocation(smContext.UeLocation)
+		upPath := GetUserPlaneInformation().GetBranchingUserPlanePath(defaultPath, selection)
+		if upPath == nil {
+			logger.PduSessLog.Warnf("PCC rule[%s]: no UPF reachable from the default path serves DNAI[%s]",
+				pccRule.PCCRuleID, dnai)
+			continue
+		}
+		dataPath := GenerateDataPath(upPath, smContext)
+		if dataPath == nil {
+			continue
+		}
+		dataPath.Destination = destination
+		smContext.Tunnel.AddDataPath(dataPath)
+		pccRule.Datapath = dataPath
+		added = true
+		logger.PduSessLog.Infof("PCC rule[%s] steers traffic to DNAI[%s]", pccRule.PCCRuleID, dnai)
+		logger.PduSessLog.Traceln("\n" + dataPath.String())
+	}
+
+	if added && smContext.BPManager == nil {
+		smContext.BPManager = NewBPManager(smContext.Supi)
+	}
+	return added
+}
+
+// sortedPCCRules returns the PCC rules in the order of their precedence
+func (smContext *SMContext) sortedPCCRules() []*PCCRule {
+	pccRules := make([]*PCCRule, 0, len(smContext.PCCRules))
+	for _, pccRule := range smContext.PCCRules {
+		pccRules = append(pccRules, pccRule)
+	}
+	sort.Slice(pccRules, func(i, j int) bool {
+		if pccRules[i].Precedence != pccRules[j].Precedence {
+			return pccRules[i].Precedence < pccRules[j].Precedence
+		}
+		return pccRules[i].PCCRuleID < pccRules[j].PCCRuleID
+	})
+	return pccRules
+}
@@ -0,0 +1,88 @@
+package context
+
+import (
+	"net"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/free5gc/MongoDBLibrary"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/logger"
+)
+
+const ueIPAddressCollName = "smfData.ueIpAddresses"
+
+// the UE addresses are persisted only if the MongoDB is configured
+var ueIPStoreEnabled bool
+
+func ueIPLeaseFilter(ipam *UeIPAM, ip net.IP) bson.M {
+	return bson.M{
+		"sst":      ipam.snssai.Sst,
+		"sd":       ipam.snssai.Sd,
+		"dnn":      ipam.dnn,
+		"ipv4Addr": ip.String(),
+	}
+}
+
+func storeUeIPLease(ipam *UeIPAM, ip net.IP, lease *ueIPLease) {
+	if !ueIPStoreEnabled {
+		return
+	}
+	putData := ueIPLeaseFilter(ipam, ip)
+	putData["supi"] = lease.supi
+	putData["pduSessionId"] = lease.pduSessionID
+	putData["external"] = lease.external
+	MongoDBLibrary.RestfulAPIPutOne(ueIPAddressCollName, ueIPLeaseFilter(ipam, ip), putData)
+}
+
+func removeUeIPLease(ipam *UeIPAM, ip net.IP) {
+	if !ueIPStoreEnabled {
+		return
+	}
+	MongoDBLibrary.RestfulAPIDeleteOne(ueIPAddressCollName, ueIPLeaseFilter(ipam, ip))
+}
+
+// RestoreUeIPAddresses enables the persistence of the UE addresses in the MongoDB connected by the SMF, and
+// allocates the UE addresses persisted before the SMF restarts again
+func RestoreUeIPAddresses() {
+	ueIPStoreEnabled = true
+
+	for _, data := range MongoDBLibrary.RestfulAPIGetMany(ueIPAddressCollName, bson.M{}) {
+		sst, _ := data["sst"].(int32)
+		sd, _ := data["sd"].(string)
+		dnn, _ := data["dnn"].(string)
+		ipv4Addr, _ := data["ipv4Addr"].(string)
+		ip := net.ParseIP(ipv4Addr).To4()
+		lease := &ueIPLease{}
+		lease.supi, _ = data["supi"].(string)
+		lease.pduSessionID, _ = data["pduSessionId"].(int32)
+		lease.external, _ = data["external"].(bool)
+
+		dnnInfo := RetrieveDnnInformation(models.Snssai{Sst: sst, Sd: sd}, dnn)
+		if dnnInfo == nil || ip == nil {
+			logger.CtxLog.Warnf("Drop UE address[%s] of S-NSSAI[sst: %d, sd: %s] DNN[%s] which is not configured",
+				ipv4Addr, sst, sd, dnn)
+			MongoDBLibrary.RestfulAPIDeleteOne(ueIPAddressCollName, bson.M{
+				"sst": sst, "sd": sd, "dnn": dnn, "ipv4Addr": ipv4Addr,
+			})
+			continue
+		}
+		if err := dnnInfo.UeIPAM.restore(ip, lease); err != nil {
+			logger.CtxLog.Warnf("Restore UE address[%s] of SUPI[%s] failed: %s", ip, lease.supi, err)
+			continue
+		}
+		logger.CtxLog.Infof("Restore UE address[%s] of PDU session[%s-%02d]", ip, lease.supi, lease.pduSessionID)
+	}
+}
+
+// ReleaseUnclaimedUeIPAddresses releases the UE addresses restored by RestoreUeIPAddresses which are not claimed by
+// the SM contexts restored by RestoreSMContexts
+func ReleaseUnclaimedUeIPAddresses() {
+	for _, snssaiInfo := range SMF_Self().SnssaiInfos {
+		for _, dnnInfo := range snssaiInfo.DnnInfos {
+			for _, ip := range dnnInfo.UeIPAM.releaseUnclaimed() {
+				removeUeIPLease(dnnInfo.UeIPAM, ip)
+			}
+		}
+	}
+}
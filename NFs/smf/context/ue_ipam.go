@@ -0,0 +1,449 @@
+package context
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/factory"
+	"github.com/free5gc/smf/logger"
+)
+
+// ExternalIPAM is an IPAM system outside of the SMF which the dynamic UE addresses are allocated from
+type ExternalIPAM interface {
+	Allocate(supi string, snssai SNssai, dnn string) (net.IP, error)
+	Release(supi string, ip net.IP) error
+}
+
+type newExternalIPAMFunc func(config *factory.ExternalIPAM) (ExternalIPAM, error)
+
+var externalIPAMTypes = map[string]newExternalIPAMFunc{
+	"stand-in": newStandInIPAM,
+}
+
+// RegisterExternalIPAM makes the external IPAM available to the externalIpam configuration of the type
+func RegisterExternalIPAM(ipamType string, newIPAM newExternalIPAMFunc) {
+	externalIPAMTypes[ipamType] = newIPAM
+}
+
+// UeIPAM manages the UE addresses of a DNN of a S-NSSAI, the dynamic addresses are allocated from the external IPAM
+// if it is configured, otherwise from the pools in order, the static pools only hold the static addresses of the
+// subscription. The /64 prefixes of the IPv6 PDU sessions are delegated from the IPv6 pool
+type UeIPAM struct {
+	snssai      SNssai
+	dnn         string
+	pools       []*IPAllocator
+	staticPools []*IPAllocator
+	ipv6Pool    *IPv6PrefixAllocator
+	external    ExternalIPAM
+
+	mu       sync.Mutex
+	leases   map[string]*ueIPLease // IP address to its lease
+	owners   map[string]string     // SUPI and PDU session ID to the IP address
+	prefixes map[string]*net.IPNet // SUPI and PDU session ID to the IPv6 prefix
+}
+
+type ueIPLease struct {
+	supi         string
+	pduSessionID int32
+	external     bool
+	restored     bool // persisted before the SMF restarts and not yet taken by the PDU session
+}
+
+// UeIPPoolUsage is the utilization of a UE address pool
+type UeIPPoolUsage struct {
+	Pool   string `json:"pool"`
+	Static bool   `json:"static,omitempty"`
+	Used   int64  `json:"used"`
+	Total  int64  `json:"total"`
+}
+
+func NewUeIPAM(snssai SNssai, config factory.SnssaiDnnInfoItem) (*UeIPAM, error) {
+	ipam := &UeIPAM{
+		snssai:   snssai,
+		dnn:      config.Dnn,
+		leases:   make(map[string]*ueIPLease),
+		owners:   make(map[string]string),
+		prefixes: make(map[string]*net.IPNet),
+	}
+
+	for _, cidr := range append([]string{config.UESubnet}, config.UEPools...) {
+		if cidr == "" {
+			continue
+		}
+		allocator, err := NewIPAllocator(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("create ip allocator[%s] failed: %s", cidr, err)
+		}
+		ipam.pools = append(ipam.pools, allocator)
+	}
+	for _, cidr := range config.StaticUEPools {
+		allocator, err := NewIPAllocator(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("create static ip allocator[%s] failed: %s", cidr, err)
+		}
+		ipam.staticPools = append(ipam.staticPools, allocator)
+	}
+	if config.UESubnetV6 != "" {
+		allocator, err := NewIPv6PrefixAllocator(config.UESubnetV6)
+		if err != nil {
+			return nil, fmt.Errorf("create ipv6 prefix allocator[%s] failed: %s", config.UESubnetV6, err)
+		}
+		ipam.ipv6Pool = allocator
+	}
+	if config.ExternalIPAM != nil {
+		newIPAM, exist := externalIPAMTypes[config.ExternalIPAM.Type]
+		if !exist {
+			return nil, fmt.Errorf("external IPAM type[%s] is not supported", config.ExternalIPAM.Type)
+		}
+		external, err := newIPAM(config.ExternalIPAM)
+		if err != nil {
+			return nil, fmt.Errorf("create external IPAM[%s] failed: %s", config.ExternalIPAM.Type, err)
+		}
+		ipam.external = external
+	}
+	if !ipam.SupportIPv4() && !ipam.SupportIPv6() {
+		return nil, fmt.Errorf("DNN[%s] has neither UE address pool nor external IPAM", config.Dnn)
+	}
+	return ipam, nil
+}
+
+// SupportIPv4 reports whether the IPv4 addresses can be allocated to the PDU sessions of the DNN
+func (ipam *UeIPAM) SupportIPv4() bool {
+	return len(ipam.pools) > 0 || ipam.external != nil
+}
+
+// SupportIPv6 reports whether the IPv6 prefixes can be delegated to the PDU sessions of the DNN
+func (ipam *UeIPAM) SupportIPv6() bool {
+	return ipam.ipv6Pool != nil
+}
+
+func ueIPOwnerKey(supi string, pduSessionID int32) string {
+	return fmt.Sprintf("%s-%d", supi, pduSessionID)
+}
+
+// Allocate allocates the UE address of the PDU session, the static address of the subscription is preferred to
+// a dynamic one
+func (ipam *UeIPAM) Allocate(supi string, pduSessionID int32, staticAddrs []models.IpAddress) (net.IP, error) {
+	ip, lease, err := ipam.allocate(supi, pduSessionID, staticAddrs)
+	if err != nil {
+		return nil, err
+	}
+	// the lease is persisted out of the lock not to hold the other allocations on the MongoDB
+	storeUeIPLease(ipam, ip, lease)
+	return ip, nil
+}
+
+func (ipam *UeIPAM) allocate(supi string, pduSessionID int32, staticAddrs []models.IpAddress) (
+	net.IP, *ueIPLease, error) {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	lease := &ueIPLease{
+		supi:         supi,
+		pduSessionID: pduSessionID,
+	}
+	ip, err := ipam.allocateStatic(staticAddrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip == nil {
+		if ipam.external != nil {
+			if ip, err = ipam.external.Allocate(supi, ipam.snssai, ipam.dnn); err != nil {
+				return nil, nil, fmt.Errorf("external IPAM allocation failed: %s", err)
+			}
+			lease.external = true
+		} else if ip, err = ipam.allocateDynamic(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ipam.leases[ip.String()] = lease
+	ipam.owners[ueIPOwnerKey(supi, pduSessionID)] = ip.String()
+	return ip, lease, nil
+}
+
+func (ipam *UeIPAM) allocateStatic(staticAddrs []models.IpAddress) (net.IP, error) {
+	for _, staticAddr := range staticAddrs {
+		ip := net.ParseIP(staticAddr.Ipv4Addr).To4()
+		if ip == nil {
+			continue
+		}
+		if _, leased := ipam.leases[ip.String()]; leased {
+			return nil, fmt.Errorf("static address[%s] is allocated to another PDU session", ip)
+		}
+		if pool := ipam.poolOf(ip); pool != nil {
+			if err := pool.Reserve(ip); err != nil {
+				return nil, fmt.Errorf("static address reservation failed: %s", err)
+			}
+		} else {
+			logger.CtxLog.Warnf("Static address[%s] is out of the UE address pools of DNN[%s]", ip, ipam.dnn)
+		}
+		return ip, nil
+	}
+	return nil, nil
+}
+
+func (ipam *UeIPAM) allocateDynamic() (net.IP, error) {
+	for _, pool := range ipam.pools {
+		if ip, err := pool.Allocate(); err == nil {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("UE address pools of DNN[%s] are exhausted", ipam.dnn)
+}
+
+func (ipam *UeIPAM) poolOf(ip net.IP) *IPAllocator {
+	for _, pool := range ipam.staticPools {
+		if pool.Contains(ip) {
+			return pool
+		}
+	}
+	for _, pool := range ipam.pools {
+		if pool.Contains(ip) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// Release returns the UE address to the pool or the external IPAM which allocates it
+func (ipam *UeIPAM) Release(ip net.IP) {
+	if ipam.release(ip) {
+		removeUeIPLease(ipam, ip)
+	}
+}
+
+// release returns false if the UE address is not allocated
+func (ipam *UeIPAM) release(ip net.IP) bool {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	lease, exist := ipam.leases[ip.String()]
+	if !exist {
+		logger.CtxLog.Warnf("UE address[%s] of DNN[%s] is not allocated", ip, ipam.dnn)
+		return false
+	}
+	ipam.releaseLease(ip, lease)
+	return true
+}
+
+func (ipam *UeIPAM) releaseLease(ip net.IP, lease *ueIPLease) {
+	if lease.external {
+		if err := ipam.external.Release(lease.supi, ip); err != nil {
+			logger.CtxLog.Errorf("External IPAM release of UE address[%s] failed: %s", ip, err)
+		}
+	} else if pool := ipam.poolOf(ip); pool != nil {
+		pool.Release(ip)
+	}
+	delete(ipam.leases, ip.String())
+	if owner := ueIPOwnerKey(lease.supi, lease.pduSessionID); ipam.owners[owner] == ip.String() {
+		delete(ipam.owners, owner)
+	}
+}
+
+// releaseUnclaimed releases the UE addresses persisted before the SMF restarts which no restored SM context claims,
+// their PDU sessions are gone with the SMF
+func (ipam *UeIPAM) releaseUnclaimed() []net.IP {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	var ips []net.IP
+	for addr, lease := range ipam.leases {
+		if !lease.restored {
+			continue
+		}
+		ip := net.ParseIP(addr).To4()
+		logger.CtxLog.Infof("Release unclaimed UE address[%s] of PDU session[%s-%02d]", ip, lease.supi,
+			lease.pduSessionID)
+		ipam.releaseLease(ip, lease)
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// restore allocates the UE address persisted before the SMF restarts again
+func (ipam *UeIPAM) restore(ip net.IP, lease *ueIPLease) error {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	if _, leased := ipam.leases[ip.String()]; leased {
+		return fmt.Errorf("UE address[%s] is restored twice", ip)
+	}
+	if !lease.external {
+		if pool := ipam.poolOf(ip); pool != nil {
+			if err := pool.Reserve(ip); err != nil {
+				return err
+			}
+		}
+	}
+	lease.restored = true
+	ipam.leases[ip.String()] = lease
+	ipam.owners[ueIPOwnerKey(lease.supi, lease.pduSessionID)] = ip.String()
+	return nil
+}
+
+// claim takes the UE address of the SM context restored after the SMF restarts, so it is not reused by another
+// PDU session of the same SUPI and PDU session ID
+func (ipam *UeIPAM) claim(supi string, pduSessionID int32, ip net.IP) {
+	lease := &ueIPLease{
+		supi:         supi,
+		pduSessionID: pduSessionID,
+	}
+	if err := ipam.restore(ip, lease); err == nil {
+		storeUeIPLease(ipam, ip, lease)
+	}
+
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	if lease, exist := ipam.leases[ip.String()]; exist {
+		lease.restored = false
+	}
+}
+
+// AllocatePrefix delegates a /64 prefix to the PDU session, the prefix delegated to the PDU session before is kept
+func (ipam *UeIPAM) AllocatePrefix(supi string, pduSessionID int32) (*net.IPNet, error) {
+	if ipam.ipv6Pool == nil {
+		return nil, fmt.Errorf("DNN[%s] has no IPv6 pool", ipam.dnn)
+	}
+
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	owner := ueIPOwnerKey(supi, pduSessionID)
+	if prefix, exist := ipam.prefixes[owner]; exist {
+		return prefix, nil
+	}
+	prefix, err := ipam.ipv6Pool.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	ipam.prefixes[owner] = prefix
+	return prefix, nil
+}
+
+// ReleasePrefix returns the /64 prefix delegated to the PDU session to the IPv6 pool
+func (ipam *UeIPAM) ReleasePrefix(supi string, pduSessionID int32) {
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	owner := ueIPOwnerKey(supi, pduSessionID)
+	if prefix, exist := ipam.prefixes[owner]; exist {
+		ipam.ipv6Pool.Release(prefix.IP)
+		delete(ipam.prefixes, owner)
+	}
+}
+
+// claimPrefix takes the /64 prefix of the SM context restored after the SMF restarts
+func (ipam *UeIPAM) claimPrefix(supi string, pduSessionID int32, ip net.IP) {
+	if ipam.ipv6Pool == nil {
+		return
+	}
+
+	ipam.mu.Lock()
+	defer ipam.mu.Unlock()
+
+	prefix := &net.IPNet{
+		IP:   ip.Mask(net.CIDRMask(IPv6PrefixLength, 8*net.IPv6len)),
+		Mask: net.CIDRMask(IPv6PrefixLength, 8*net.IPv6len),
+	}
+	if err := ipam.ipv6Pool.Reserve(prefix.IP); err != nil {
+		logger.CtxLog.Warnf("Claim IPv6 prefix[%s] failed: %s", prefix, err)
+		return
+	}
+	ipam.prefixes[ueIPOwnerKey(supi, pduSessionID)] = prefix
+}
+
+// Usage returns the utilization of the UE address pools, the addresses of the external IPAM are not counted
+func (ipam *UeIPAM) Usage() []UeIPPoolUsage {
+	usages := make([]UeIPPoolUsage, 0, len(ipam.pools)+len(ipam.staticPools)+1)
+	for _, pool := range ipam.pools {
+		used, total := pool.Usage()
+		usages = append(usages, UeIPPoolUsage{Pool: pool.String(), Used: used, Total: total})
+	}
+	for _, pool := range ipam.staticPools {
+		used, total := pool.Usage()
+		usages = append(usages, UeIPPoolUsage{Pool: pool.String(), Static: true, Used: used, Total: total})
+	}
+	if ipam.ipv6Pool != nil {
+		used, total := ipam.ipv6Pool.Usage()
+		usages = append(usages, UeIPPoolUsage{Pool: ipam.ipv6Pool.String(), Used: used, Total: total})
+	}
+	return usages
+}
+
+// standInIPAM stands in for an external IPAM system, it allocates the addresses from its own pools in memory
+type standInIPAM struct {
+	pools []*IPAllocator
+}
+
+func newStandInIPAM(config *factory.ExternalIPAM) (ExternalIPAM, error) {
+	ipam := &standInIPAM{}
+	for _, cidr := range config.Pools {
+		allocator, err := NewIPAllocator(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ipam.pools = append(ipam.pools, allocator)
+	}
+	if len(ipam.pools) == 0 {
+		return nil, fmt.Errorf("stand-in IPAM has no pool")
+	}
+	return ipam, nil
+}
+
+func (ipam *standInIPAM) Allocate(supi string, snssai SNssai, dnn string) (net.IP, error) {
+	for _, pool := range ipam.pools {
+		if ip, err := pool.Allocate(); err == nil {
+			logger.CtxLog.Debugf("Stand-in IPAM allocates [%s] to SUPI[%s] of DNN[%s]", ip, supi, dnn)
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("stand-in IPAM pools are exhausted")
+}
+
+func (ipam *standInIPAM) Release(supi string, ip net.IP) error {
+	for _, pool := range ipam.pools {
+		if pool.Contains(ip) {
+			pool.Release(ip)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not allocated by the stand-in IPAM", ip)
+}
+
+// DnnUeIPUsage is the utilization of the UE address pools of a DNN of a S-NSSAI
+type DnnUeIPUsage struct {
+	Snssai models.Snssai   `json:"snssai"`
+	Dnn    string          `json:"dnn"`
+	Leases int             `json:"leases"`
+	Pools  []UeIPPoolUsage `json:"pools"`
+}
+
+// GetUeIPUsages returns the utilization of the UE address pools of every DNN of every S-NSSAI
+func GetUeIPUsages() []DnnUeIPUsage {
+	usages := make([]DnnUeIPUsage, 0)
+	for _, snssaiInfo := range SMF_Self().SnssaiInfos {
+		dnns := make([]string, 0, len(snssaiInfo.DnnInfos))
+		for dnn := range snssaiInfo.DnnInfos {
+			dnns = append(dnns, dnn)
+		}
+		sort.Strings(dnns)
+		for _, dnn := range dnns {
+			ipam := snssaiInfo.DnnInfos[dnn].UeIPAM
+			ipam.mu.Lock()
+			leases := len(ipam.leases)
+			ipam.mu.Unlock()
+			usages = append(usages, DnnUeIPUsage{
+				Snssai: models.Snssai{Sst: snssaiInfo.Snssai.Sst, Sd: snssaiInfo.Snssai.Sd},
+				Dnn:    dnn,
+				Leases: leases,
+				Pools:  ipam.Usage(),
+			})
+		}
+	}
+	return usages
+}
@@ -0,0 +1,221 @@
+package context_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/factory"
+)
+
+func TestIPAllocator(t *testing.T) {
+	allocator, err := context.NewIPAllocator("10.60.0.0/30")
+	require.NoError(t, err)
+
+	ip, err := allocator.Allocate()
+	require.NoError(t, err)
+	require.Equal(t, "10.60.0.1", ip.String())
+	require.NoError(t, allocator.Reserve(net.ParseIP("10.60.0.2")))
+	require.Error(t, allocator.Reserve(net.ParseIP("10.60.0.2")))
+	require.Error(t, allocator.Reserve(net.ParseIP("10.60.0.3")))
+	_, err = allocator.Allocate()
+	require.Error(t, err)
+
+	used, total := allocator.Usage()
+	require.Equal(t, int64(2), used)
+	require.Equal(t, int64(2), total)
+
+	allocator.Release(net.ParseIP("10.60.0.1"))
+	ip, err = allocator.Allocate()
+	require.NoError(t, err)
+	require.Equal(t, "10.60.0.1", ip.String())
+
+	_, err = context.NewIPAllocator("10.60.0.0/32")
+	require.Error(t, err)
+}
+
+func TestUeIPAM(t *testing.T) {
+	ipam, err := context.NewUeIPAM(context.SNssai{Sst: 1, Sd: "010203"}, factory.SnssaiDnnInfoItem{
+		Dnn:           "internet",
+		UESubnet:      "10.60.0.0/30",
+		UEPools:       []string{"10.61.0.0/30"},
+		StaticUEPools: []string{"10.62.0.0/30"},
+	})
+	require.NoError(t, err)
+
+	ips := make([]string, 0)
+	for pduSessionID := int32(1); pduSessionID <= 4; pduSessionID++ {
+		ip, allocErr := ipam.Allocate("imsi-208930000000003", pduSessionID, nil)
+		require.NoError(t, allocErr)
+		ips = append(ips, ip.String())
+	}
+	require.Equal(t, []string{"10.60.0.1", "10.60.0.2", "10.61.0.1", "10.61.0.2"}, ips)
+	_, err = ipam.Allocate("imsi-208930000000003", 5, nil)
+	require.Error(t, err)
+
+	staticAddrs := []models.IpAddress{{Ipv4Addr: "10.62.0.2"}}
+	ip, err := ipam.Allocate("imsi-208930000000004", 1, staticAddrs)
+	require.NoError(t, err)
+	require.Equal(t, "10.62.0.2", ip.String())
+	_, err = ipam.Allocate("imsi-208930000000005", 1, staticAddrs)
+	require.Error(t, err)
+
+	ipam.Release(net.ParseIP("10.60.0.2"))
+	ip, err = ipam.Allocate("imsi-208930000000003", 5, nil)
+	require.NoError(t, err)
+	require.Equal(t, "10.60.0.2", ip.String())
+
+	require.Equal(t, []context.UeIPPoolUsage{
+		{Pool: "10.60.0.0/30", Used: 2, Total: 2},
+		{Pool: "10.61.0.0/30", Used: 2, Total: 2},
+		{Pool: "10.62.0.0/30", Static: true, Used: 1, Total: 2},
+	}, ipam.Usage())
+}
+
+func TestUeIPAMExternal(t *testing.T) {
+	_, err := context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{
+		Dnn:          "internet",
+		ExternalIPAM: &factory.ExternalIPAM{Type: "unknown"},
+	})
+	require.Error(t, err)
+
+	ipam, err := context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{
+		Dnn:          "internet",
+		UESubnet:     "10.60.0.0/30",
+		ExternalIPAM: &factory.ExternalIPAM{Type: "stand-in", Pools: []string{"10.70.0.0/30"}},
+	})
+	require.NoError(t, err)
+
+	ip, err := ipam.Allocate("imsi-208930000000003", 1, nil)
+	require.NoError(t, err)
+	require.Equal(t, "10.70.0.1", ip.String())
+	ipam.Release(ip)
+	ip, err = ipam.Allocate("imsi-208930000000003", 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, "10.70.0.2", ip.String())
+}
+
+func TestIPv6PrefixAllocator(t *testing.T) {
+	allocator, err := context.NewIPv6PrefixAllocator("2001:db8:60::/63")
+	require.NoError(t, err)
+
+	prefix, err := allocator.Allocate()
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60::/64", prefix.String())
+	require.NoError(t, allocator.Reserve(net.ParseIP("2001:db8:60:1::")))
+	require.Error(t, allocator.Reserve(net.ParseIP("2001:db8:60:1::")))
+	require.Error(t, allocator.Reserve(net.ParseIP("2001:db8:60:2::")))
+	_, err = allocator.Allocate()
+	require.Error(t, err)
+
+	used, total := allocator.Usage()
+	require.Equal(t, int64(2), used)
+	require.Equal(t, int64(2), total)
+	require.True(t, allocator.Contains(net.ParseIP("2001:db8:60:1::1")))
+
+	allocator.Release(net.ParseIP("2001:db8:60::"))
+	prefix, err = allocator.Allocate()
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60::/64", prefix.String())
+
+	_, err = context.NewIPv6PrefixAllocator("2001:db8:60::/96")
+	require.Error(t, err)
+	_, err = context.NewIPv6PrefixAllocator("10.60.0.0/16")
+	require.Error(t, err)
+}
+
+func TestUeIPAMIPv6(t *testing.T) {
+	ipam, err := context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{
+		Dnn:        "internet",
+		UESubnetV6: "2001:db8:60::/63",
+	})
+	require.NoError(t, err)
+	require.False(t, ipam.SupportIPv4())
+	require.True(t, ipam.SupportIPv6())
+
+	prefix, err := ipam.AllocatePrefix("imsi-208930000000003", 1)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60::/64", prefix.String())
+	// the PDU session keeps its prefix
+	prefix, err = ipam.AllocatePrefix("imsi-208930000000003", 1)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60::/64", prefix.String())
+
+	prefix, err = ipam.AllocatePrefix("imsi-208930000000003", 2)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60:1::/64", prefix.String())
+	_, err = ipam.AllocatePrefix("imsi-208930000000004", 1)
+	require.Error(t, err)
+
+	ipam.ReleasePrefix("imsi-208930000000003", 1)
+	prefix, err = ipam.AllocatePrefix("imsi-208930000000004", 1)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:60::/64", prefix.String())
+
+	require.Equal(t, []context.UeIPPoolUsage{
+		{Pool: "2001:db8:60::/63", Used: 2, Total: 2},
+	}, ipam.Usage())
+
+	_, err = context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{Dnn: "internet"})
+	require.Error(t, err)
+}
+
+func TestAllocatePDUAddress(t *testing.T) {
+	ipam, err := context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{
+		Dnn:        "internet",
+		UESubnet:   "10.60.0.0/30",
+		UESubnetV6: "2001:db8:60::/64",
+	})
+	require.NoError(t, err)
+	newSMContext := func(pduSessionID int32, pduSessionType uint8) *context.SMContext {
+		smContext := context.NewSMContext("imsi-208930000000047", pduSessionID)
+		smContext.Dnn = "internet"
+		smContext.Supi = "imsi-208930000000047"
+		smContext.DNNInfo = &context.SnssaiSmfDnnInfo{UeIPAM: ipam}
+		smContext.DnnConfiguration.PduSessionTypes = &models.PduSessionTypes{
+			AllowedSessionTypes: []models.PduSessionType{models.PduSessionType_IPV4_V6},
+		}
+		smContext.SelectedPDUSessionType = pduSessionType
+		return smContext
+	}
+
+	smContext := newSMContext(1, nasMessage.PDUSessionTypeIPv4IPv6)
+	defer context.RemoveSMContext(smContext.Ref)
+	cause, err := smContext.AllocatePDUAddress()
+	require.NoError(t, err)
+	require.Zero(t, cause)
+	require.Equal(t, "10.60.0.1", smContext.PDUAddress.String())
+	require.Equal(t, "2001:db8:60::/64", smContext.IPv6Prefix().String())
+
+	// the IPv4 address of the PDU session is released when the IPv6 pool is exhausted
+	smContext = newSMContext(2, nasMessage.PDUSessionTypeIPv4IPv6)
+	defer context.RemoveSMContext(smContext.Ref)
+	cause, err = smContext.AllocatePDUAddress()
+	require.Error(t, err)
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, cause)
+	require.Nil(t, smContext.PDUAddress)
+	require.Nil(t, smContext.PDUAddressV6)
+	require.Equal(t, []context.UeIPPoolUsage{
+		{Pool: "10.60.0.0/30", Used: 1, Total: 2},
+		{Pool: "2001:db8:60::/64", Used: 1, Total: 1},
+	}, ipam.Usage())
+	addr, addrLen := smContext.PDUAddressToNAS()
+	require.Equal(t, [12]byte{}, addr)
+	require.Equal(t, uint8(12+1), addrLen)
+
+	ipv4Only, err := context.NewUeIPAM(context.SNssai{Sst: 1}, factory.SnssaiDnnInfoItem{
+		Dnn:      "internet",
+		UESubnet: "10.61.0.0/30",
+	})
+	require.NoError(t, err)
+	smContext = newSMContext(3, nasMessage.PDUSessionTypeIPv6)
+	defer context.RemoveSMContext(smContext.Ref)
+	smContext.DNNInfo.UeIPAM = ipv4Only
+	cause, err = smContext.AllocatePDUAddress()
+	require.Error(t, err)
+	require.Equal(t, nasMessage.Cause5GSMUnknownPDUSessionType, cause)
+}
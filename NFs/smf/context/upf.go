@@ -7,6 +7,8 @@ import (
 	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -42,22 +44,49 @@ type UPF struct {
 	uuid         uuid.UUID
 	NodeID       pfcpType.NodeID
 	UPIPInfo     pfcpType.UserPlaneIPResourceInformation
-	UPFStatus    UPFStatus
 	SNssaiInfos  []SnssaiUPFInfo
 	N3Interfaces []UPFInterfaceInfo
 	N9Interfaces []UPFInterfaceInfo
 
+	// Recovery Time Stamp of the UPF in the last PFCP association
+	RecoveryTimeStamp time.Time
+	// UP function features of the UPF in the last PFCP association, nil if not reported
+	UPFunctionFeatures *pfcpType.UPFunctionFeatures
+
+	// relative weight of the UPF in the weighted UPF selection
+	Capacity uint16
+	// area the UPF is close to in the locality UPF selection
+	Locality *factory.UPFLocality
+
 	pdrPool sync.Map
 	farPool sync.Map
 	barPool sync.Map
 	qerPool sync.Map
-	// urrPool        sync.Map
+	urrPool sync.Map
 	pdrIDGenerator *idgenerator.IDGenerator
 	farIDGenerator *idgenerator.IDGenerator
 	barIDGenerator *idgenerator.IDGenerator
 	urrIDGenerator *idgenerator.IDGenerator
 	qerIDGenerator *idgenerator.IDGenerator
 	teidGenerator  *idgenerator.IDGenerator
+
+	// IDs of the rules and TEIDs restored after the SMF restarts
+	restoredIDs *restoredUPFIDs
+
+	// remote GTP-U peers the UPF reports user plane path failures for, with the time of the report
+	failedPeers     map[string]time.Time
+	failedPeersLock sync.Mutex
+
+	// number of the PFCP sessions of the PDU sessions on the UPF
+	sessionCount int64
+
+	// UPFStatus of the PFCP association, written by the PFCP handlers and the heartbeat
+	status int32
+
+	// PFCP heartbeats left unanswered in a row
+	heartbeatMisses  int
+	heartbeatPending bool
+	heartbeatLock    sync.Mutex
 }
 
 // UPFSelectionParams ... parameters for upf selection
@@ -65,6 +94,10 @@ type UPFSelectionParams struct {
 	Dnn    string
 	SNssai *SNssai
 	Dnai   string
+
+	// location of the UE in the locality UPF selection
+	Tai   *models.Tai
+	GnbID string
 }
 
 // UPFInterfaceInfo store the UPF interface information
@@ -153,6 +186,16 @@ func (upf *UPF) UUID() string {
 	return uuid
 }
 
+// Status returns the status of the PFCP association of the UPF
+func (upf *UPF) Status() UPFStatus {
+	return UPFStatus(atomic.LoadInt32(&upf.status))
+}
+
+// SetStatus sets the status of the PFCP association of the UPF
+func (upf *UPF) SetStatus(status UPFStatus) {
+	atomic.StoreInt32(&upf.status, int32(status))
+}
+
 func NewUPTunnel() (tunnel *UPTunnel) {
 	tunnel = &UPTunnel{
 		DataPathPool:    make(DataPathPool),
@@ -173,6 +216,17 @@ func (upTunnel *UPTunnel) AddDataPath(dataPath *DataPath) {
 	upTunnel.DataPathPool[pathID] = dataPath
 }
 
+// RemoveDataPath removes the data path from the tunnel and releases its path ID
+func (upTunnel *UPTunnel) RemoveDataPath(dataPath *DataPath) {
+	for pathID, path := range upTunnel.DataPathPool {
+		if path == dataPath {
+			delete(upTunnel.DataPathPool, pathID)
+			upTunnel.PathIDGenerator.FreeID(pathID)
+			return
+		}
+	}
+}
+
 //*** add unit test ***//
 // NewUPF returns a new UPF context in SMF
 func NewUPF(nodeID *pfcpType.NodeID, ifaces []factory.InterfaceUpfInfoItem) (upf *UPF) {
@@ -182,7 +236,7 @@ func NewUPF(nodeID *pfcpType.NodeID, ifaces []factory.InterfaceUpfInfoItem) (upf
 	upfPool.Store(upf.UUID(), upf)
 
 	// Initialize context
-	upf.UPFStatus = NotAssociated
+	upf.SetStatus(NotAssociated)
 	upf.NodeID = *nodeID
 	upf.pdrIDGenerator = idgenerator.NewGenerator(1, math.MaxUint16)
 	upf.farIDGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
@@ -229,7 +283,7 @@ func (upf *UPF) GetInterface(interfaceType models.UpInterfaceType, dnn string) *
 }
 
 func (upf *UPF) GenerateTEID() (uint32, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf not associate with smf")
 		return 0, err
 	}
@@ -303,6 +357,25 @@ func RemoveUPFNodeByNodeID(nodeID pfcpType.NodeID) bool {
 	return false
 }
 
+// SupportPFDM returns whether the UPF supports the PFD management (TS 29.244 8.2.25), the applications are detected by
+// the PFDs provisioned to the UPF only if it is supported
+func (upf *UPF) SupportPFDM() bool {
+	return upf.UPFunctionFeatures != nil &&
+		upf.UPFunctionFeatures.SupportedFeatures&pfcpType.UpFunctionFeaturesPfdm != 0
+}
+
+// AssociatedUPFs returns the UPFs in PFCP association with the SMF
+func AssociatedUPFs() []*UPF {
+	var upfs []*UPF
+	upfPool.Range(func(key, value interface{}) bool {
+		if upf := value.(*UPF); upf.Status() == AssociatedSetUpSuccess {
+			upfs = append(upfs, upf)
+		}
+		return true
+	})
+	return upfs
+}
+
 func SelectUPFByDnn(Dnn string) *UPF {
 	var upf *UPF
 	upfPool.Range(func(key, value interface{}) bool {
@@ -328,7 +401,7 @@ func (upf *UPF) GetUPFID() string {
 }
 
 func (upf *UPF) pdrID() (uint16, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf not associate with smf")
 		return 0, err
 	}
@@ -344,7 +417,7 @@ func (upf *UPF) pdrID() (uint16, error) {
 }
 
 func (upf *UPF) farID() (uint32, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf not associate with smf")
 		return 0, err
 	}
@@ -360,7 +433,7 @@ func (upf *UPF) farID() (uint32, error) {
 }
 
 func (upf *UPF) barID() (uint8, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf not associate with smf")
 		return 0, err
 	}
@@ -376,7 +449,7 @@ func (upf *UPF) barID() (uint8, error) {
 }
 
 func (upf *UPF) qerID() (uint32, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf not associate with smf")
 		return 0, err
 	}
@@ -391,8 +464,24 @@ func (upf *UPF) qerID() (uint32, error) {
 	return qerID, nil
 }
 
+func (upf *UPF) urrID() (uint32, error) {
+	if upf.Status() != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf not associate with smf")
+		return 0, err
+	}
+
+	var urrID uint32
+	if tmpID, err := upf.urrIDGenerator.Allocate(); err != nil {
+		return 0, err
+	} else {
+		urrID = uint32(tmpID)
+	}
+
+	return urrID, nil
+}
+
 func (upf *UPF) AddPDR() (*PDR, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf do not associate with smf")
 		return nil, err
 	}
@@ -415,7 +504,7 @@ func (upf *UPF) AddPDR() (*PDR, error) {
 }
 
 func (upf *UPF) AddFAR() (*FAR, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf do not associate with smf")
 		return nil, err
 	}
@@ -432,7 +521,7 @@ func (upf *UPF) AddFAR() (*FAR, error) {
 }
 
 func (upf *UPF) AddBAR() (*BAR, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf do not associate with smf")
 		return nil, err
 	}
@@ -448,7 +537,7 @@ func (upf *UPF) AddBAR() (*BAR, error) {
 }
 
 func (upf *UPF) AddQER() (*QER, error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err := fmt.Errorf("this upf do not associate with smf")
 		return nil, err
 	}
@@ -463,9 +552,26 @@ func (upf *UPF) AddQER() (*QER, error) {
 	return qer, nil
 }
 
+func (upf *UPF) AddURR() (*URR, error) {
+	if upf.Status() != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf do not associate with smf")
+		return nil, err
+	}
+
+	urr := new(URR)
+	if URRID, err := upf.urrID(); err != nil {
+		return nil, err
+	} else {
+		urr.URRID = URRID
+		upf.urrPool.Store(urr.URRID, urr)
+	}
+
+	return urr, nil
+}
+
 //*** add unit test ***//
 func (upf *UPF) RemovePDR(pdr *PDR) (err error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err = fmt.Errorf("this upf not associate with smf")
 		return err
 	}
@@ -477,7 +583,7 @@ func (upf *UPF) RemovePDR(pdr *PDR) (err error) {
 
 //*** add unit test ***//
 func (upf *UPF) RemoveFAR(far *FAR) (err error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err = fmt.Errorf("this upf not associate with smf")
 		return err
 	}
@@ -489,7 +595,7 @@ func (upf *UPF) RemoveFAR(far *FAR) (err error) {
 
 //*** add unit test ***//
 func (upf *UPF) RemoveBAR(bar *BAR) (err error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err = fmt.Errorf("this upf not associate with smf")
 		return err
 	}
@@ -501,7 +607,7 @@ func (upf *UPF) RemoveBAR(bar *BAR) (err error) {
 
 //*** add unit test ***//
 func (upf *UPF) RemoveQER(qer *QER) (err error) {
-	if upf.UPFStatus != AssociatedSetUpSuccess {
+	if upf.Status() != AssociatedSetUpSuccess {
 		err = fmt.Errorf("this upf not associate with smf")
 		return err
 	}
@@ -511,6 +617,36 @@ func (upf *UPF) RemoveQER(qer *QER) (err error) {
 	return nil
 }
 
+func (upf *UPF) RemoveURR(urr *URR) (err error) {
+	if upf.Status() != AssociatedSetUpSuccess {
+		err = fmt.Errorf("this upf not associate with smf")
+		return err
+	}
+
+	upf.urrIDGenerator.FreeID(int64(urr.URRID))
+	upf.urrPool.Delete(urr.URRID)
+	return nil
+}
+
+// ServesDnai reports whether the UPF serves the DNAI for the DNN of the S-NSSAI
+func (upf *UPF) ServesDnai(snssai *models.Snssai, dnn, dnai string) bool {
+	if snssai == nil {
+		return false
+	}
+	target := SNssai{Sst: snssai.Sst, Sd: snssai.Sd}
+	for _, snssaiInfo := range upf.SNssaiInfos {
+		if !snssaiInfo.SNssai.Equal(&target) {
+			continue
+		}
+		for _, dnnInfo := range snssaiInfo.DnnList {
+			if dnnInfo.Dnn == dnn && dnnInfo.ContainsDNAI(dnai) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (upf *UPF) isSupportSnssai(snssai *SNssai) bool {
 	for _, snssaiInfo := range upf.SNssaiInfos {
 		if snssaiInfo.SNssai.Equal(snssai) {
@@ -0,0 +1,36 @@
+package context
+
+// maxHeartbeatMisses is how many PFCP heartbeats in a row the UPF leaves unanswered before it is considered
+// unavailable (TS 29.244 6.2.2)
+const maxHeartbeatMisses = 3
+
+// HeartbeatDue counts the last PFCP heartbeat sent to the UPF as missed if it is still unanswered when the next one is
+// due, it reports whether the UPF has just become unavailable
+func (upf *UPF) HeartbeatDue() (lost bool) {
+	upf.heartbeatLock.Lock()
+	defer upf.heartbeatLock.Unlock()
+	if upf.heartbeatPending {
+		upf.heartbeatMisses++
+	}
+	upf.heartbeatPending = true
+	return upf.heartbeatMisses == maxHeartbeatMisses
+}
+
+// HeartbeatResponded records the PFCP heartbeat response of the UPF, or its new PFCP association, it reports whether
+// the UPF has just become available again
+func (upf *UPF) HeartbeatResponded() (recovered bool) {
+	upf.heartbeatLock.Lock()
+	defer upf.heartbeatLock.Unlock()
+	recovered = upf.heartbeatMisses >= maxHeartbeatMisses
+	upf.heartbeatMisses = 0
+	upf.heartbeatPending = false
+	return recovered
+}
+
+// IsAvailable reports whether the UPF answers the PFCP heartbeats, the unavailable UPF is not selected for the data
+// paths of new PDU sessions
+func (upf *UPF) IsAvailable() bool {
+	upf.heartbeatLock.Lock()
+	defer upf.heartbeatLock.Unlock()
+	return upf.heartbeatMisses < maxHeartbeatMisses
+}
@@ -0,0 +1,195 @@
+package context
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/free5gc/openapi/models"
+)
+
+const (
+	UPFSelectionFirst        = "first"
+	UPFSelectionRoundRobin   = "roundRobin"
+	UPFSelectionLeastSession = "leastSessions"
+	UPFSelectionWeighted     = "weighted"
+	UPFSelectionLocality     = "locality"
+)
+
+// UPFSelectionStrategy orders the candidate anchor UPFs of a PDU session, the data path is set up to the first one
+// reachable from the AN
+type UPFSelectionStrategy interface {
+	Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode
+}
+
+type newUPFSelectionStrategyFunc func() UPFSelectionStrategy
+
+var upfSelectionStrategies = map[string]newUPFSelectionStrategyFunc{
+	UPFSelectionFirst:        newFirstSelection,
+	UPFSelectionRoundRobin:   newRoundRobinSelection,
+	UPFSelectionLeastSession: newLeastSessionSelection,
+	UPFSelectionWeighted:     newWeightedSelection,
+	UPFSelectionLocality:     newLocalitySelection,
+}
+
+// RegisterUPFSelectionStrategy makes the UPF selection strategy available to the upfSelection configuration
+func RegisterUPFSelectionStrategy(name string, newStrategy newUPFSelectionStrategyFunc) {
+	upfSelectionStrategies[name] = newStrategy
+}
+
+// SessionCount returns the number of the PFCP sessions of the PDU sessions on the UPF
+func (upf *UPF) SessionCount() int64 {
+	return atomic.LoadInt64(&upf.sessionCount)
+}
+
+func (upf *UPF) addSession() {
+	atomic.AddInt64(&upf.sessionCount, 1)
+}
+
+func (upf *UPF) removeSession() {
+	atomic.AddInt64(&upf.sessionCount, -1)
+}
+
+// SetUeLocation sets the TAI and gNB of the UE location for the locality UPF selection
+func (upfSelectionParams *UPFSelectionParams) SetUeLocation(ueLocation *models.UserLocation) {
+	if ueLocation == nil {
+		return
+	}
+	if nrLocation := ueLocation.NrLocation; nrLocation != nil {
+		upfSelectionParams.Tai = nrLocation.Tai
+		if nrLocation.GlobalGnbId != nil && nrLocation.GlobalGnbId.GNbId != nil {
+			upfSelectionParams.GnbID = nrLocation.GlobalGnbId.GNbId.GNBValue
+		}
+	} else if eutraLocation := ueLocation.EutraLocation; eutraLocation != nil {
+		upfSelectionParams.Tai = eutraLocation.Tai
+	}
+}
+
+// firstSelection keeps the candidates in the order of their names, the PDU sessions are anchored on the first UPF
+// reachable from the AN
+type firstSelection struct{}
+
+func newFirstSelection() UPFSelectionStrategy {
+	return firstSelection{}
+}
+
+func (firstSelection) Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode {
+	return candidates
+}
+
+// roundRobinSelection rotates the candidates of every DNN, S-NSSAI and DNAI on each selection
+type roundRobinSelection struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func newRoundRobinSelection() UPFSelectionStrategy {
+	return &roundRobinSelection{next: make(map[string]int)}
+}
+
+func (s *roundRobinSelection) Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode {
+	if len(candidates) == 0 {
+		return candidates
+	}
+	s.mu.Lock()
+	key := selection.String()
+	start := s.next[key] % len(candidates)
+	s.next[key] = start + 1
+	s.mu.Unlock()
+
+	ordered := make([]*UPNode, 0, len(candidates))
+	ordered = append(ordered, candidates[start:]...)
+	return append(ordered, candidates[:start]...)
+}
+
+// leastSessionSelection prefers the UPFs with fewer PDU sessions
+type leastSessionSelection struct{}
+
+func newLeastSessionSelection() UPFSelectionStrategy {
+	return leastSessionSelection{}
+}
+
+func (leastSessionSelection) Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode {
+	ordered := append([]*UPNode(nil), candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].UPF.SessionCount() < ordered[j].UPF.SessionCount()
+	})
+	return ordered
+}
+
+// weightedSelection prefers the UPFs with fewer PDU sessions for their capacity, the UPF without capacity has
+// the capacity of 1
+type weightedSelection struct{}
+
+func newWeightedSelection() UPFSelectionStrategy {
+	return weightedSelection{}
+}
+
+func (weightedSelection) Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode {
+	capacity := func(upf *UPF) int64 {
+		if upf.Capacity == 0 {
+			return 1
+		}
+		return int64(upf.Capacity)
+	}
+	ordered := append([]*UPNode(nil), candidates...)
+	// the load with the new session, (sessions + 1) / capacity, is compared without division
+	sort.SliceStable(ordered, func(i, j int) bool {
+		upfI, upfJ := ordered[i].UPF, ordered[j].UPF
+		return (upfI.SessionCount()+1)*capacity(upfJ) < (upfJ.SessionCount()+1)*capacity(upfI)
+	})
+	return ordered
+}
+
+// localitySelection prefers the UPFs close to the gNB of the UE, then the ones close to its TAI, the UPFs of the same
+// locality are ordered by their PDU sessions. The DNAI of the selection restricts the candidates in the first place
+type localitySelection struct{}
+
+func newLocalitySelection() UPFSelectionStrategy {
+	return localitySelection{}
+}
+
+func (localitySelection) Order(candidates []*UPNode, selection *UPFSelectionParams) []*UPNode {
+	ordered := append([]*UPNode(nil), candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		localityI, localityJ := locality(ordered[i].UPF, selection), locality(ordered[j].UPF, selection)
+		if localityI != localityJ {
+			return localityI > localityJ
+		}
+		return ordered[i].UPF.SessionCount() < ordered[j].UPF.SessionCount()
+	})
+	return ordered
+}
+
+// locality returns 2 if the UPF is close to the gNB of the UE, 1 if it is close to the TAI of the UE, otherwise 0
+func locality(upf *UPF, selection *UPFSelectionParams) int {
+	if upf.Locality == nil {
+		return 0
+	}
+	if selection.GnbID != "" {
+		for _, gnbID := range upf.Locality.GnbIds {
+			if strings.EqualFold(gnbID, selection.GnbID) {
+				return 2
+			}
+		}
+	}
+	if selection.Tai != nil {
+		for i := range upf.Locality.Tais {
+			if equalTai(&upf.Locality.Tais[i], selection.Tai) {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+func equalTai(a, b *models.Tai) bool {
+	if !strings.EqualFold(a.Tac, b.Tac) {
+		return false
+	}
+	if a.PlmnId == nil || b.PlmnId == nil {
+		return a.PlmnId == b.PlmnId
+	}
+	return *a.PlmnId == *b.PlmnId
+}
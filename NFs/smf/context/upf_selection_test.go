@@ -0,0 +1,180 @@
+package context_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/factory"
+)
+
+func newBalancedUserPlaneInformation(strategy string, psas map[string]factory.UPNode) *context.UserPlaneInformation {
+	upNodes := map[string]factory.UPNode{
+		"GNodeB": {
+			Type:   "AN",
+			NodeID: "192.168.182.100",
+		},
+	}
+	links := make([]factory.UPLink, 0, len(psas))
+	for name, psa := range psas {
+		psa.Type = "UPF"
+		psa.SNssaiInfos = []models.SnssaiUpfInfoItem{
+			{
+				SNssai: &models.Snssai{
+					Sst: 1,
+					Sd:  "010203",
+				},
+				DnnUpfInfoList: []models.DnnUpfInfoItem{
+					{Dnn: "internet"},
+				},
+			},
+		}
+		upNodes[name] = psa
+		links = append(links, factory.UPLink{A: "GNodeB", B: name})
+	}
+	return context.NewUserPlaneInformation(&factory.UserPlaneInformation{
+		UPNodes:      upNodes,
+		Links:        links,
+		UPFSelection: strategy,
+	})
+}
+
+func newBalancedSelection() *context.UPFSelectionParams {
+	return &context.UPFSelectionParams{
+		Dnn: "internet",
+		SNssai: &context.SNssai{
+			Sst: 1,
+			Sd:  "010203",
+		},
+	}
+}
+
+func TestUPFSelectionFirst(t *testing.T) {
+	// the first UPF is selected by default as before the UPF selection strategies
+	userplaneInformation := newBalancedUserPlaneInformation("", map[string]factory.UPNode{
+		"PSA1": {NodeID: "192.168.182.1"},
+		"PSA2": {NodeID: "192.168.182.2"},
+	})
+	psa1, psa2 := userplaneInformation.UPFs["PSA1"], userplaneInformation.UPFs["PSA2"]
+	selection := newBalancedSelection()
+
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	// the next UPF is selected while the first one misses the heartbeats
+	for i := 0; i < 4; i++ {
+		psa1.UPF.HeartbeatDue()
+	}
+	require.Equal(t, context.UPPath{psa2}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	psa1.UPF.HeartbeatResponded()
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+}
+
+func TestUPFSelectionRoundRobin(t *testing.T) {
+	userplaneInformation := newBalancedUserPlaneInformation(context.UPFSelectionRoundRobin,
+		map[string]factory.UPNode{
+			"PSA1": {NodeID: "192.168.182.1"},
+			"PSA2": {NodeID: "192.168.182.2"},
+		})
+	psa1, psa2 := userplaneInformation.UPFs["PSA1"], userplaneInformation.UPFs["PSA2"]
+	selection := newBalancedSelection()
+
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.Equal(t, context.UPPath{psa2}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	// the UPF missing the heartbeats is skipped until it answers again
+	for i := 0; i < 4; i++ {
+		psa2.UPF.HeartbeatDue()
+	}
+	require.False(t, psa2.UPF.IsAvailable())
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.True(t, psa2.UPF.HeartbeatResponded())
+	require.True(t, psa2.UPF.IsAvailable())
+	require.False(t, psa2.UPF.HeartbeatResponded())
+}
+
+func TestUPFSelectionLeastSessions(t *testing.T) {
+	userplaneInformation := newBalancedUserPlaneInformation(context.UPFSelectionLeastSession,
+		map[string]factory.UPNode{
+			"PSA1": {NodeID: "192.168.182.11"},
+			"PSA2": {NodeID: "192.168.182.12"},
+		})
+	psa1, psa2 := userplaneInformation.UPFs["PSA1"], userplaneInformation.UPFs["PSA2"]
+	selection := newBalancedSelection()
+
+	smContext1 := context.NewSMContext("imsi-208930000000301", 1)
+	smContext1.AllocateLocalSEIDForUPPath(userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	require.Equal(t, int64(1), psa1.UPF.SessionCount())
+
+	smContext2 := context.NewSMContext("imsi-208930000000302", 1)
+	path := userplaneInformation.GetDefaultUserPlanePathByDNN(selection)
+	require.Equal(t, context.UPPath{psa2}, path)
+	smContext2.AllocateLocalSEIDForUPPath(path)
+	require.Equal(t, int64(1), psa2.UPF.SessionCount())
+
+	context.RemoveSMContext(smContext1.Ref)
+	require.Equal(t, int64(0), psa1.UPF.SessionCount())
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+	context.RemoveSMContext(smContext2.Ref)
+	require.Equal(t, int64(0), psa2.UPF.SessionCount())
+}
+
+func TestUPFSelectionWeighted(t *testing.T) {
+	userplaneInformation := newBalancedUserPlaneInformation(context.UPFSelectionWeighted,
+		map[string]factory.UPNode{
+			"PSA1": {NodeID: "192.168.182.21"},
+			"PSA2": {NodeID: "192.168.182.22", Capacity: 3},
+		})
+	psa1, psa2 := userplaneInformation.UPFs["PSA1"], userplaneInformation.UPFs["PSA2"]
+	selection := newBalancedSelection()
+
+	// PSA2 takes 3 sessions for every session of PSA1
+	var selected []*context.UPNode
+	for i := 0; i < 4; i++ {
+		path := userplaneInformation.GetDefaultUserPlanePathByDNN(selection)
+		require.Len(t, path, 1)
+		context.NewSMContext("imsi-208930000000311", int32(i+1)).AllocateLocalSEIDForUPPath(path)
+		selected = append(selected, path[0])
+	}
+	require.Equal(t, []*context.UPNode{psa2, psa2, psa1, psa2}, selected)
+	require.Equal(t, int64(1), psa1.UPF.SessionCount())
+	require.Equal(t, int64(3), psa2.UPF.SessionCount())
+}
+
+func TestUPFSelectionLocality(t *testing.T) {
+	tai := models.Tai{
+		PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"},
+		Tac:    "000001",
+	}
+	userplaneInformation := newBalancedUserPlaneInformation(context.UPFSelectionLocality,
+		map[string]factory.UPNode{
+			"PSA1": {NodeID: "192.168.182.31"},
+			"PSA2": {NodeID: "192.168.182.32", Locality: &factory.UPFLocality{Tais: []models.Tai{tai}}},
+			"PSA3": {NodeID: "192.168.182.33", Locality: &factory.UPFLocality{GnbIds: []string{"000102"}}},
+		})
+	psa1, psa2, psa3 := userplaneInformation.UPFs["PSA1"], userplaneInformation.UPFs["PSA2"],
+		userplaneInformation.UPFs["PSA3"]
+
+	selection := newBalancedSelection()
+	require.Equal(t, context.UPPath{psa1}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	selection.SetUeLocation(&models.UserLocation{
+		NrLocation: &models.NrLocation{
+			Tai: &models.Tai{
+				PlmnId: &models.PlmnId{Mcc: "208", Mnc: "93"},
+				Tac:    "000001",
+			},
+			GlobalGnbId: &models.GlobalRanNodeId{
+				GNbId: &models.GNbId{BitLength: 24, GNBValue: "000102"},
+			},
+		},
+	})
+	require.Equal(t, context.UPPath{psa3}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	selection.GnbID = "000103"
+	require.Equal(t, context.UPPath{psa2}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+}
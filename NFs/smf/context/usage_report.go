@@ -0,0 +1,364 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/logger"
+)
+
+// S-NSSAI(sst-sd form) to *sliceUsage
+var sliceUsagePool sync.Map
+
+// UsageReport is the usage measured by a URR between two reports of the UPF
+type UsageReport struct {
+	URRID          uint32
+	Trigger        string
+	StartTime      time.Time
+	EndTime        time.Time
+	UplinkVolume   uint64
+	DownlinkVolume uint64
+	TotalVolume    uint64
+	Duration       uint32
+}
+
+// Usage is the usage accumulated from the usage reports
+type Usage struct {
+	UplinkVolume   uint64 `json:"uplinkVolume"`
+	DownlinkVolume uint64 `json:"downlinkVolume"`
+	TotalVolume    uint64 `json:"totalVolume"`
+	// seconds of usage
+	Duration uint64 `json:"duration"`
+	Reports  uint64 `json:"reports"`
+}
+
+// SliceUsage is the usage accumulated by the PDU sessions of a S-NSSAI
+type SliceUsage struct {
+	Snssai models.Snssai `json:"snssai"`
+	Usage
+}
+
+// QOFUsageReport is the usage report of a PDU session forwarded to the QOF
+type QOFUsageReport struct {
+	SessionID      int32          `json:"sessionid" yaml:"sessionid" bson:"sessionid"`
+	Snssai         *models.Snssai `json:"Snssai" yaml:"snssai" bson:"snssai"`
+	Supi           string         `json:"supi" yaml:"supi" bson:"supi"`
+	StartTime      time.Time      `json:"startTime" yaml:"startTime" bson:"startTime"`
+	EndTime        time.Time      `json:"endTime" yaml:"endTime" bson:"endTime"`
+	UplinkVolume   uint64         `json:"uplinkVolume" yaml:"uplinkVolume" bson:"uplinkVolume"`
+	DownlinkVolume uint64         `json:"downlinkVolume" yaml:"downlinkVolume" bson:"downlinkVolume"`
+	TotalVolume    uint64         `json:"totalVolume" yaml:"totalVolume" bson:"totalVolume"`
+	Duration       uint32         `json:"duration" yaml:"duration" bson:"duration"`
+}
+
+type sliceUsage struct {
+	mu    sync.Mutex
+	usage SliceUsage
+}
+
+// Usage report trigger flags (TS 29.244 8.2.41)
+var usageReportTriggers = []struct {
+	octet int
+	mask  byte
+	name  string
+}{
+	{0, 0x01, "PERIO"},
+	{0, 0x02, "VOLTH"},
+	{0, 0x04, "TIMTH"},
+	{0, 0x08, "QUHTI"},
+	{0, 0x10, "START"},
+	{0, 0x20, "STOPT"},
+	{0, 0x40, "DROTH"},
+	{0, 0x80, "IMMER"},
+	{1, 0x01, "VOLQU"},
+	{1, 0x02, "TIMQU"},
+	{1, 0x04, "LIUSA"},
+	{1, 0x08, "TERMR"},
+	{1, 0x10, "MONIT"},
+	{1, 0x20, "ENVCL"},
+	{1, 0x40, "MACAR"},
+	{1, 0x80, "EVETH"},
+}
+
+func usageReportTriggerString(trigger *pfcpType.UsageReportTrigger) string {
+	if trigger == nil {
+		return ""
+	}
+	str := ""
+	for _, t := range usageReportTriggers {
+		if t.octet < len(trigger.UsageReportTriggerdata) && trigger.UsageReportTriggerdata[t.octet]&t.mask != 0 {
+			if str != "" {
+				str += "|"
+			}
+			str += t.name
+		}
+	}
+	return str
+}
+
+// NewUsageReport builds a UsageReport from the IEs of a PFCP usage report
+func NewUsageReport(urrID *pfcpType.URRID, trigger *pfcpType.UsageReportTrigger,
+	startTime *pfcpType.StartTime, endTime *pfcpType.EndTime,
+	volume *pfcpType.VolumeMeasurement, duration *pfcpType.DurationMeasurement) (*UsageReport, error) {
+	if urrID == nil {
+		return nil, fmt.Errorf("usage report has no URR ID")
+	}
+
+	report := &UsageReport{
+		URRID:   urrID.UrrIdValue,
+		Trigger: usageReportTriggerString(trigger),
+	}
+	if startTime != nil {
+		report.StartTime = startTime.StartTime
+	}
+	if endTime != nil {
+		report.EndTime = endTime.EndTime
+	}
+	if volume != nil {
+		if volume.Ulvol {
+			report.UplinkVolume = volume.UplinkVolume
+		}
+		if volume.Dlvol {
+			report.DownlinkVolume = volume.DownlinkVolume
+		}
+		if volume.Tovol {
+			report.TotalVolume = volume.TotalVolume
+		} else {
+			report.TotalVolume = report.UplinkVolume + report.DownlinkVolume
+		}
+	}
+	if duration != nil {
+		report.Duration = duration.DurationValue
+	}
+	return report, nil
+}
+
+func (report *UsageReport) hasTrigger(name string) bool {
+	for _, trigger := range strings.Split(report.Trigger, "|") {
+		if trigger == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (usage *Usage) add(report *UsageReport) {
+	usage.UplinkVolume += report.UplinkVolume
+	usage.DownlinkVolume += report.DownlinkVolume
+	usage.TotalVolume += report.TotalVolume
+	usage.Duration += uint64(report.Duration)
+	usage.Reports++
+}
+
+func snssaiKey(snssai *models.Snssai) string {
+	return fmt.Sprintf("%d-%s", snssai.Sst, snssai.Sd)
+}
+
+// NewUsageURR returns a URR measuring volume and duration with the configured triggers,
+// nil when neither usage reporting nor user plane inactivity detection is configured
+func NewUsageURR(upf *UPF) (*URR, error) {
+	usageReport := SMF_Self().UsageReport
+	inactivityTimer := SMF_Self().UserPlaneInactivityTimer
+	if usageReport == nil && inactivityTimer == 0 {
+		return nil, nil
+	}
+
+	urr, err := upf.AddURR()
+	if err != nil {
+		return nil, err
+	}
+
+	urr.MeasurementMethod = pfcpType.MeasurementMethod{
+		Volum: true,
+		Durat: true,
+	}
+	// the UPF reports the usage once no packet is received for the quota holding time (TS 29.244 5.2.2.3.1)
+	if inactivityTimer != 0 {
+		urr.ReportingTriggers.Quhti = true
+		urr.QuotaHoldingTime = &pfcpType.QuotaHoldingTime{
+			QuotaHoldingTimeValue: inactivityTimer,
+		}
+	}
+	if usageReport == nil {
+		return urr, nil
+	}
+	if usageReport.Period != 0 {
+		urr.ReportingTriggers.Perio = true
+		urr.MeasurementPeriod = &pfcpType.MeasurementPeriod{
+			MeasurementPeriod: usageReport.Period,
+		}
+	}
+	if usageReport.VolumeThreshold != 0 {
+		urr.ReportingTriggers.Volth = true
+		urr.VolumeThreshold = &pfcpType.VolumeThreshold{
+			Tovol:       true,
+			TotalVolume: usageReport.VolumeThreshold,
+		}
+	}
+	if usageReport.TimeThreshold != 0 {
+		urr.ReportingTriggers.Timth = true
+		urr.TimeThreshold = &pfcpType.TimeThreshold{
+			TimeThreshold: usageReport.TimeThreshold,
+		}
+	}
+	return urr, nil
+}
+
+// anchorURR returns the usage URR of the PDU session on the anchor UPF, it is shared
+// by the uplink and downlink PDRs and allocated on first use
+func (smContext *SMContext) anchorURR(upf *UPF) *URR {
+	nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+	if urr, exist := smContext.UsageURRs[nodeIP]; exist {
+		return urr
+	}
+
+	urr, err := NewUsageURR(upf)
+	if err != nil {
+		logger.PduSessLog.Errorf("new URR on UPF[%s] failed: %+v", nodeIP, err)
+		return nil
+	}
+	if urr != nil {
+		smContext.UsageURRs[nodeIP] = urr
+	}
+	return urr
+}
+
+// releaseAnchorURR frees the usage URR of the PDU session on the anchor UPF
+func (smContext *SMContext) releaseAnchorURR(upf *UPF) {
+	nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+	if urr, exist := smContext.UsageURRs[nodeIP]; exist {
+		if err := upf.RemoveURR(urr); err != nil {
+			logger.CtxLog.Warnln("Release URR", err)
+		}
+		urr.State = RULE_REMOVE
+		delete(smContext.UsageURRs, nodeIP)
+		delete(smContext.idleURRs, urr.URRID)
+	}
+}
+
+// AddUsageReport accounts a usage report to the PDU session and to its S-NSSAI
+func (smContext *SMContext) AddUsageReport(report *UsageReport) {
+	smContext.usageLock.Lock()
+	smContext.Usage.add(report)
+	smContext.usageLock.Unlock()
+
+	if smContext.Snssai == nil {
+		logger.PduSessLog.Warnf("SUPI[%s] PDU Session[%d] usage report without S-NSSAI",
+			smContext.Supi, smContext.PDUSessionID)
+		return
+	}
+
+	value, _ := sliceUsagePool.LoadOrStore(snssaiKey(smContext.Snssai), &sliceUsage{
+		usage: SliceUsage{Snssai: *smContext.Snssai},
+	})
+	slice := value.(*sliceUsage)
+	slice.mu.Lock()
+	slice.usage.add(report)
+	slice.mu.Unlock()
+
+	logger.PduSessLog.Infof("SUPI[%s] PDU Session[%d] URR[%d] usage report[%s]: UL %d DL %d bytes, %d s",
+		smContext.Supi, smContext.PDUSessionID, report.URRID, report.Trigger,
+		report.UplinkVolume, report.DownlinkVolume, report.Duration)
+}
+
+// UserPlaneInactive accounts the usage report for the user plane inactivity detection, it reports whether no user
+// plane traffic passes through any anchor UPF of the PDU session for the user plane inactivity timer
+func (smContext *SMContext) UserPlaneInactive(report *UsageReport) bool {
+	if SMF_Self().UserPlaneInactivityTimer == 0 {
+		return false
+	}
+	if smContext.idleURRs == nil {
+		smContext.idleURRs = make(map[uint32]bool)
+	}
+	if report.hasTrigger("QUHTI") {
+		smContext.idleURRs[report.URRID] = true
+	} else if report.TotalVolume != 0 {
+		delete(smContext.idleURRs, report.URRID)
+	}
+
+	for _, urr := range smContext.UsageURRs {
+		if !smContext.idleURRs[urr.URRID] {
+			return false
+		}
+	}
+	return len(smContext.UsageURRs) != 0
+}
+
+// AccuUsageReports returns the usage accumulated by the PDU session as the usage reports of the usage monitoring
+// decisions of the PCF, nil if the PCF does not arm the usage report trigger (TS 29.512 4.2.4.10)
+func (smContext *SMContext) AccuUsageReports() []models.AccuUsageReport {
+	armed := false
+	for _, trigger := range smContext.PolicyCtrlReqTriggers {
+		if trigger == models.PolicyControlRequestTrigger_US_RE {
+			armed = true
+		}
+	}
+	if !armed || len(smContext.UsageMonitoringDecs) == 0 {
+		return nil
+	}
+
+	usage := smContext.GetUsage()
+	reports := make([]models.AccuUsageReport, 0, len(smContext.UsageMonitoringDecs))
+	for umID := range smContext.UsageMonitoringDecs {
+		reports = append(reports, models.AccuUsageReport{
+			RefUmIds:         umID,
+			VolUsage:         int64(usage.TotalVolume),
+			VolUsageUplink:   int64(usage.UplinkVolume),
+			VolUsageDownlink: int64(usage.DownlinkVolume),
+			TimeUsage:        int32(usage.Duration),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].RefUmIds < reports[j].RefUmIds
+	})
+	return reports
+}
+
+// QOFUsageReport returns the usage report to forward to the QOF
+func (smContext *SMContext) QOFUsageReport(report *UsageReport) *QOFUsageReport {
+	qofReport := &QOFUsageReport{
+		SessionID:      smContext.PDUSessionID,
+		Supi:           smContext.Supi,
+		StartTime:      report.StartTime,
+		EndTime:        report.EndTime,
+		UplinkVolume:   report.UplinkVolume,
+		DownlinkVolume: report.DownlinkVolume,
+		TotalVolume:    report.TotalVolume,
+		Duration:       report.Duration,
+	}
+	if smContext.Snssai != nil {
+		qofReport.Snssai = &models.Snssai{
+			Sst: smContext.Snssai.Sst,
+			Sd:  smContext.Snssai.Sd,
+		}
+	}
+	return qofReport
+}
+
+// GetUsage returns the usage accumulated by the PDU session
+func (smContext *SMContext) GetUsage() Usage {
+	smContext.usageLock.Lock()
+	defer smContext.usageLock.Unlock()
+	return smContext.Usage
+}
+
+// GetSliceUsages returns the usage accumulated per S-NSSAI
+func GetSliceUsages() []SliceUsage {
+	usages := make([]SliceUsage, 0)
+	sliceUsagePool.Range(func(key, value interface{}) bool {
+		slice := value.(*sliceUsage)
+		slice.mu.Lock()
+		usages = append(usages, slice.usage)
+		slice.mu.Unlock()
+		return true
+	})
+	sort.Slice(usages, func(i, j int) bool {
+		return snssaiKey(&usages[i].Snssai) < snssaiKey(&usages[j].Snssai)
+	})
+	return usages
+}
@@ -0,0 +1,108 @@
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+)
+
+func TestNewUsageReport(t *testing.T) {
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	report, err := context.NewUsageReport(
+		&pfcpType.URRID{UrrIdValue: 3},
+		&pfcpType.UsageReportTrigger{UsageReportTriggerdata: []byte{0x03, 0x08}},
+		&pfcpType.StartTime{StartTime: start},
+		&pfcpType.EndTime{EndTime: end},
+		&pfcpType.VolumeMeasurement{Ulvol: true, Dlvol: true, UplinkVolume: 1000, DownlinkVolume: 4000},
+		&pfcpType.DurationMeasurement{DurationValue: 60})
+	require.NoError(t, err)
+	require.Equal(t, &context.UsageReport{
+		URRID:          3,
+		Trigger:        "PERIO|VOLTH|TERMR",
+		StartTime:      start,
+		EndTime:        end,
+		UplinkVolume:   1000,
+		DownlinkVolume: 4000,
+		TotalVolume:    5000,
+		Duration:       60,
+	}, report)
+
+	_, err = context.NewUsageReport(nil, nil, nil, nil, nil, nil)
+	require.Error(t, err)
+}
+
+func TestAddUsageReport(t *testing.T) {
+	snssai := &models.Snssai{Sst: 3, Sd: "0a0b0c"}
+	otherSnssai := &models.Snssai{Sst: 3, Sd: "0a0b0d"}
+
+	first := context.NewSMContext("imsi-208930000000101", 1)
+	first.Snssai = snssai
+	second := context.NewSMContext("imsi-208930000000102", 1)
+	second.Snssai = snssai
+	other := context.NewSMContext("imsi-208930000000103", 1)
+	other.Snssai = otherSnssai
+
+	first.AddUsageReport(&context.UsageReport{UplinkVolume: 100, DownlinkVolume: 200, TotalVolume: 300, Duration: 10})
+	first.AddUsageReport(&context.UsageReport{UplinkVolume: 10, DownlinkVolume: 20, TotalVolume: 30, Duration: 5})
+	second.AddUsageReport(&context.UsageReport{UplinkVolume: 1, DownlinkVolume: 2, TotalVolume: 3, Duration: 1})
+	other.AddUsageReport(&context.UsageReport{UplinkVolume: 7, DownlinkVolume: 7, TotalVolume: 14, Duration: 2})
+
+	require.Equal(t, context.Usage{
+		UplinkVolume: 110, DownlinkVolume: 220, TotalVolume: 330, Duration: 15, Reports: 2,
+	}, first.GetUsage())
+
+	usages := make(map[string]context.Usage)
+	for _, sliceUsage := range context.GetSliceUsages() {
+		usages[sliceUsage.Snssai.Sd] = sliceUsage.Usage
+	}
+	require.Equal(t, context.Usage{
+		UplinkVolume: 111, DownlinkVolume: 222, TotalVolume: 333, Duration: 16, Reports: 3,
+	}, usages[snssai.Sd])
+	require.Equal(t, context.Usage{
+		UplinkVolume: 7, DownlinkVolume: 7, TotalVolume: 14, Duration: 2, Reports: 1,
+	}, usages[otherSnssai.Sd])
+
+	qofReport := first.QOFUsageReport(&context.UsageReport{UplinkVolume: 1, DownlinkVolume: 2, TotalVolume: 3})
+	require.Equal(t, snssai, qofReport.Snssai)
+	require.Equal(t, int32(1), qofReport.SessionID)
+}
+
+func TestUserPlaneInactive(t *testing.T) {
+	context.SMF_Self().UserPlaneInactivityTimer = 60
+	defer func() {
+		context.SMF_Self().UserPlaneInactivityTimer = 0
+	}()
+
+	smContext := context.NewSMContext("imsi-208930000000104", 1)
+	smContext.UsageURRs["10.200.200.101"] = &context.URR{URRID: 1}
+	smContext.UsageURRs["10.200.200.102"] = &context.URR{URRID: 2}
+
+	require.False(t, smContext.UserPlaneInactive(&context.UsageReport{URRID: 1, Trigger: "QUHTI"}))
+	require.True(t, smContext.UserPlaneInactive(&context.UsageReport{URRID: 2, Trigger: "PERIO|QUHTI"}))
+	require.False(t, smContext.UserPlaneInactive(&context.UsageReport{URRID: 1, Trigger: "PERIO", TotalVolume: 10}))
+	require.True(t, smContext.UserPlaneInactive(&context.UsageReport{URRID: 1, Trigger: "QUHTI"}))
+}
+
+func TestAccuUsageReports(t *testing.T) {
+	smContext := context.NewSMContext("imsi-208930000000105", 1)
+	smContext.AddUsageReport(&context.UsageReport{UplinkVolume: 10, DownlinkVolume: 20, TotalVolume: 30, Duration: 5})
+	smContext.UsageMonitoringDecs["um2"] = &models.UsageMonitoringData{UmId: "um2"}
+	smContext.UsageMonitoringDecs["um1"] = &models.UsageMonitoringData{UmId: "um1"}
+	require.Nil(t, smContext.AccuUsageReports())
+
+	smContext.PolicyCtrlReqTriggers = []models.PolicyControlRequestTrigger{
+		models.PolicyControlRequestTrigger_PLMN_CH,
+		models.PolicyControlRequestTrigger_US_RE,
+	}
+	require.Equal(t, []models.AccuUsageReport{
+		{RefUmIds: "um1", VolUsage: 30, VolUsageUplink: 10, VolUsageDownlink: 20, TimeUsage: 5},
+		{RefUmIds: "um2", VolUsage: 30, VolUsageUplink: 10, VolUsageDownlink: 20, TimeUsage: 5},
+	}, smContext.AccuUsageReports())
+}
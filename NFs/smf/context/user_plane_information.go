@@ -3,6 +3,8 @@ package context
 import (
 	"net"
 	"reflect"
+	"sort"
+	"sync"
 
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/smf/factory"
@@ -17,7 +19,10 @@ type UserPlaneInformation struct {
 	UPFIPToName          map[string]string
 	UPFsID               map[string]string    // name to id
 	UPFsIPtoID           map[string]string    // ip->id table, for speed optimization
-	DefaultUserPlanePath map[string][]*UPNode // DNN to Default Path
+	DefaultUserPlanePath map[string][]*UPNode // selection and anchor UPF to Default Path
+
+	defaultPathLock   sync.Mutex
+	selectionStrategy UPFSelectionStrategy
 }
 
 type UPNodeType string
@@ -117,6 +122,8 @@ func NewUserPlaneInformation(upTopology *factory.UserPlaneInformation) *UserPlan
 				snssaiInfos = append(snssaiInfos, snssaiInfo)
 			}
 			upNode.UPF.SNssaiInfos = snssaiInfos
+			upNode.UPF.Capacity = node.Capacity
+			upNode.UPF.Locality = node.Locality
 			upfPool[name] = upNode
 		default:
 			logger.InitLog.Warningf("invalid UPNodeType: %s\n", upNode.Type)
@@ -139,6 +146,16 @@ func NewUserPlaneInformation(upTopology *factory.UserPlaneInformation) *UserPlan
 		nodeB.Links = append(nodeB.Links, nodeA)
 	}
 
+	strategy := upTopology.UPFSelection
+	if strategy == "" {
+		strategy = UPFSelectionFirst
+	}
+	newStrategy, exist := upfSelectionStrategies[strategy]
+	if !exist {
+		logger.InitLog.Warnf("UPF selection[%s] is not supported, the first UPF is selected", strategy)
+		newStrategy = newFirstSelection
+	}
+
 	userplaneInformation := &UserPlaneInformation{
 		UPNodes:              nodePool,
 		UPFs:                 upfPool,
@@ -147,6 +164,7 @@ func NewUserPlaneInformation(upTopology *factory.UserPlaneInformation) *UserPlan
 		UPFsID:               make(map[string]string),
 		UPFsIPtoID:           make(map[string]string),
 		DefaultUserPlanePath: make(map[string][]*UPNode),
+		selectionStrategy:    newStrategy(),
 	}
 
 	return userplaneInformation
@@ -169,22 +187,86 @@ func (upi *UserPlaneInformation) GetUPFIDByIP(ip string) string {
 	return upi.UPFsIPtoID[ip]
 }
 
+// GetDefaultUserPlanePathByDNN returns the path to the anchor UPF selected by the UPF selection strategy among the
+// available ones serving the selection, the next one is tried if the anchor is not reachable from the AN
 func (upi *UserPlaneInformation) GetDefaultUserPlanePathByDNN(selection *UPFSelectionParams) (path UPPath) {
-	path, pathExist := upi.DefaultUserPlanePath[selection.String()]
 	logger.CtxLog.Traceln("In GetDefaultUserPlanePathByDNN")
 	logger.CtxLog.Traceln("selection: ", selection.String())
-	if pathExist {
-		return
-	} else {
-		pathExist = upi.GenerateDefaultPath(selection)
-		if pathExist {
-			return upi.DefaultUserPlanePath[selection.String()]
+	destinations := upi.selectionStrategy.Order(upi.selectMatchUPF(selection), selection)
+	for _, dest := range destinations {
+		if path, pathExist := upi.defaultPathTo(dest, selection); pathExist {
+			return path
 		}
 	}
 	return nil
 }
 
+// GetBranchingUserPlanePath returns the path to the anchor UPF serving the DNAI of the selection, it shares the UPFs
+// of the data path up to the deepest one able to reach the anchor, which becomes the branching point (ULCL)
+func (upi *UserPlaneInformation) GetBranchingUserPlanePath(dataPath *DataPath,
+	selection *UPFSelectionParams) UPPath {
+	path := make(UPPath, 0)
+	for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+		upNode := upi.upNodeOf(node.UPF)
+		if upNode == nil {
+			return nil
+		}
+		path = append(path, upNode)
+	}
+
+	destinations := upi.selectionStrategy.Order(upi.selectMatchUPF(selection), selection)
+	// the anchor of the data path is not a branching point
+	for idx := len(path) - 2; idx >= 0; idx-- {
+		for _, dest := range destinations {
+			if path.contains(dest) {
+				continue
+			}
+			visited := make(map[*UPNode]bool)
+			for _, upNode := range upi.AccessNetwork {
+				visited[upNode] = true
+			}
+			for _, upNode := range path {
+				visited[upNode] = true
+			}
+			visited[path[idx]] = false
+			if tail, exist := getPathBetween(path[idx], dest, visited, selection); exist {
+				branchingPath := make(UPPath, 0, idx+len(tail))
+				branchingPath = append(branchingPath, path[:idx]...)
+				return append(branchingPath, tail...)
+			}
+		}
+	}
+	return nil
+}
+
+func (upi *UserPlaneInformation) upNodeOf(upf *UPF) *UPNode {
+	for _, upNode := range upi.UPFs {
+		if upNode.UPF == upf {
+			return upNode
+		}
+	}
+	return nil
+}
+
+func (path UPPath) contains(target *UPNode) bool {
+	for _, upNode := range path {
+		if upNode == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ResetDefaultUserPlanePath drops the default paths, they are generated again on the next selection
+func (upi *UserPlaneInformation) ResetDefaultUserPlanePath() {
+	upi.defaultPathLock.Lock()
+	defer upi.defaultPathLock.Unlock()
+	upi.DefaultUserPlanePath = make(map[string][]*UPNode)
+}
+
 func (upi *UserPlaneInformation) ExistDefaultPath(dnn string) bool {
+	upi.defaultPathLock.Lock()
+	defer upi.defaultPathLock.Unlock()
 	_, exist := upi.DefaultUserPlanePath[dnn]
 	return exist
 }
@@ -229,10 +311,36 @@ func GenerateDataPath(upPath UPPath, smContext *SMContext) *DataPath {
 	return dataPath
 }
 
+// GenerateDefaultPath reports whether a default path to an anchor UPF serving the selection exists
 func (upi *UserPlaneInformation) GenerateDefaultPath(selection *UPFSelectionParams) bool {
-	var source *UPNode
-	var destinations []*UPNode
+	destinations := upi.selectMatchUPF(selection)
+	if len(destinations) == 0 {
+		logger.CtxLog.Errorf("Can't find UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]\n", selection.Dnn,
+			selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
+		return false
+	} else {
+		logger.CtxLog.Tracef("Find UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]\n", selection.Dnn,
+			selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
+	}
 
+	for _, dest := range destinations {
+		if _, pathExist := upi.defaultPathTo(dest, selection); pathExist {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPathTo returns the path from the AN to the anchor UPF, the path is kept until the default paths are reset
+func (upi *UserPlaneInformation) defaultPathTo(dest *UPNode, selection *UPFSelectionParams) (UPPath, bool) {
+	key := selection.String() + "UPF: " + upi.GetUPFNameByIp(dest.NodeID.ResolveNodeIdToIp().String())
+	upi.defaultPathLock.Lock()
+	defer upi.defaultPathLock.Unlock()
+	if path, exist := upi.DefaultUserPlanePath[key]; exist {
+		return path, true
+	}
+
+	var source *UPNode
 	for _, node := range upi.AccessNetwork {
 		if node.Type == UPNODE_AN {
 			source = node
@@ -242,18 +350,7 @@ func (upi *UserPlaneInformation) GenerateDefaultPath(selection *UPFSelectionPara
 
 	if source == nil {
 		logger.CtxLog.Errorf("There is no AN Node in config file!")
-		return false
-	}
-
-	destinations = upi.selectMatchUPF(selection)
-
-	if len(destinations) == 0 {
-		logger.CtxLog.Errorf("Can't find UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]\n", selection.Dnn,
-			selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
-		return false
-	} else {
-		logger.CtxLog.Tracef("Find UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]\n", selection.Dnn,
-			selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
+		return nil, false
 	}
 
 	// Run DFS
@@ -263,22 +360,33 @@ func (upi *UserPlaneInformation) GenerateDefaultPath(selection *UPFSelectionPara
 		visited[upNode] = false
 	}
 
-	path, pathExist := getPathBetween(source, destinations[0], visited, selection)
+	path, pathExist := getPathBetween(source, dest, visited, selection)
 
 	if pathExist {
 		if path[0].Type == UPNODE_AN {
 			path = path[1:]
 		}
-		upi.DefaultUserPlanePath[selection.String()] = path
+		upi.DefaultUserPlanePath[key] = path
 	}
 
-	return pathExist
+	return path, pathExist
 }
 
+// selectMatchUPF returns the available UPFs serving the selection in the order of their names
 func (upi *UserPlaneInformation) selectMatchUPF(selection *UPFSelectionParams) []*UPNode {
 	upList := make([]*UPNode, 0)
 
-	for _, upNode := range upi.UPFs {
+	names := make([]string, 0, len(upi.UPFs))
+	for name := range upi.UPFs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		upNode := upi.UPFs[name]
+		if !upNode.UPF.IsAvailable() {
+			continue
+		}
 		for _, snssaiInfo := range upNode.UPF.SNssaiInfos {
 			currentSnssai := &snssaiInfo.SNssai
 			targetSnssai := selection.SNssai
@@ -315,6 +423,9 @@ func getPathBetween(cur *UPNode, dest *UPNode, visited map[*UPNode]bool,
 				visited[nodes] = true
 				continue
 			}
+			if isLinkDown(cur, nodes) || !nodes.UPF.IsAvailable() {
+				continue
+			}
 
 			path_tail, path_exist := getPathBetween(nodes, dest, visited, selection)
 
@@ -1,6 +1,7 @@
 package context_test
 
 import (
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -216,3 +217,161 @@ func TestGenerateDefaultPath(t *testing.T) {
 
 func TestGetDefaultUPFTopoByDNN(t *testing.T) {
 }
+
+func TestGetBranchingUserPlanePath(t *testing.T) {
+	snssaiInfos := func(dnn string, dnaiList ...string) []models.SnssaiUpfInfoItem {
+		return []models.SnssaiUpfInfoItem{
+			{
+				SNssai: &models.Snssai{
+					Sst: 1,
+					Sd:  "010203",
+				},
+				DnnUpfInfoList: []models.DnnUpfInfoItem{
+					{Dnn: dnn, DnaiList: dnaiList},
+				},
+			},
+		}
+	}
+	userplaneInformation := context.NewUserPlaneInformation(&factory.UserPlaneInformation{
+		UPNodes: map[string]factory.UPNode{
+			"GNodeB": {
+				Type:   "AN",
+				NodeID: "192.168.180.100",
+			},
+			"I-UPF": {
+				Type:        "UPF",
+				NodeID:      "192.168.180.1",
+				SNssaiInfos: snssaiInfos("ims"),
+			},
+			"PSA1": {
+				Type:        "UPF",
+				NodeID:      "192.168.180.2",
+				SNssaiInfos: snssaiInfos("internet"),
+			},
+			"PSA2": {
+				Type:        "UPF",
+				NodeID:      "192.168.180.3",
+				SNssaiInfos: snssaiInfos("internet", "edge"),
+			},
+		},
+		Links: []factory.UPLink{
+			{
+				A: "GNodeB",
+				B: "I-UPF",
+			},
+			{
+				A: "I-UPF",
+				B: "PSA1",
+			},
+			{
+				A: "I-UPF",
+				B: "PSA2",
+			},
+		},
+	})
+
+	selection := &context.UPFSelectionParams{
+		Dnn: "internet",
+		SNssai: &context.SNssai{
+			Sst: 1,
+			Sd:  "010203",
+		},
+	}
+	defaultPath := context.GenerateDataPath(userplaneInformation.GetDefaultUserPlanePathByDNN(selection), nil)
+	require.NotNil(t, defaultPath)
+
+	selection.Dnai = "edge"
+	require.Equal(t, context.UPPath{userplaneInformation.UPFs["I-UPF"], userplaneInformation.UPFs["PSA2"]},
+		userplaneInformation.GetBranchingUserPlanePath(defaultPath, selection))
+
+	selection.Dnai = "satellite"
+	require.Nil(t, userplaneInformation.GetBranchingUserPlanePath(defaultPath, selection))
+}
+
+func TestGetDefaultUserPlanePathAvoidsFailedPeer(t *testing.T) {
+	snssaiInfos := func(dnn string) []models.SnssaiUpfInfoItem {
+		return []models.SnssaiUpfInfoItem{
+			{
+				SNssai: &models.Snssai{
+					Sst: 1,
+					Sd:  "010203",
+				},
+				DnnUpfInfoList: []models.DnnUpfInfoItem{
+					{Dnn: dnn},
+				},
+			},
+		}
+	}
+	userplaneInformation := context.NewUserPlaneInformation(&factory.UserPlaneInformation{
+		UPNodes: map[string]factory.UPNode{
+			"GNodeB": {
+				Type: "AN",
+				ANIP: "192.168.181.100",
+			},
+			"I-UPF1": {
+				Type:        "UPF",
+				NodeID:      "192.168.181.1",
+				SNssaiInfos: snssaiInfos("ims"),
+				InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+					{InterfaceType: models.UpInterfaceType_N3, Endpoints: []string{"10.200.181.1"}},
+				},
+			},
+			"I-UPF2": {
+				Type:        "UPF",
+				NodeID:      "192.168.181.2",
+				SNssaiInfos: snssaiInfos("ims"),
+				InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+					{InterfaceType: models.UpInterfaceType_N3, Endpoints: []string{"10.200.181.2"}},
+				},
+			},
+			"PSA": {
+				Type:        "UPF",
+				NodeID:      "192.168.181.3",
+				SNssaiInfos: snssaiInfos("internet"),
+				InterfaceUpfInfoList: []factory.InterfaceUpfInfoItem{
+					{InterfaceType: models.UpInterfaceType_N9, Endpoints: []string{"10.200.181.3"}},
+				},
+			},
+		},
+		Links: []factory.UPLink{
+			{
+				A: "GNodeB",
+				B: "I-UPF1",
+			},
+			{
+				A: "GNodeB",
+				B: "I-UPF2",
+			},
+			{
+				A: "I-UPF1",
+				B: "PSA",
+			},
+			{
+				A: "I-UPF2",
+				B: "PSA",
+			},
+		},
+	})
+
+	selection := &context.UPFSelectionParams{
+		Dnn: "internet",
+		SNssai: &context.SNssai{
+			Sst: 1,
+			Sd:  "010203",
+		},
+	}
+	iupf1, iupf2, psa := userplaneInformation.UPFs["I-UPF1"], userplaneInformation.UPFs["I-UPF2"],
+		userplaneInformation.UPFs["PSA"]
+
+	iupf1.UPF.SetGTPUPeerDown(net.ParseIP("192.168.181.100"))
+	require.Equal(t, context.UPPath{iupf2, psa}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	userplaneInformation.ResetDefaultUserPlanePath()
+	iupf1.UPF.ResetGTPUPeers()
+	psa.UPF.SetGTPUPeerDown(net.ParseIP("10.200.181.2"))
+	require.Equal(t, context.UPPath{iupf1, psa}, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+
+	userplaneInformation.ResetDefaultUserPlanePath()
+	iupf1.UPF.SetGTPUPeerDown(net.ParseIP("10.200.181.3"))
+	require.Nil(t, userplaneInformation.GetDefaultUserPlanePathByDNN(selection))
+}
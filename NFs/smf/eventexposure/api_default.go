@@ -13,24 +13,74 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/producer"
 )
 
-// SubscriptionsPost -
+// SubscriptionsPost - Create an individual subscription for event notifications from the SMF
 func SubscriptionsPost(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	var request models.NsmfEventExposure
+	if err := c.ShouldBindJSON(&request); err != nil {
+		malformedRequest(c, err)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, request)
+	HTTPResponse := producer.HandleSmfEventExposureSubscriptionCreate(req.Body.(models.NsmfEventExposure))
+	for key, val := range HTTPResponse.Header {
+		c.Header(key, val[0])
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
 }
 
-// SubscriptionsSubIdDelete -
+// SubscriptionsSubIdDelete - Delete an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdDelete(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["subId"] = c.Params.ByName("subId")
+
+	HTTPResponse := producer.HandleSmfEventExposureSubscriptionDelete(req.Params["subId"])
+	if HTTPResponse.Body == nil {
+		c.Status(HTTPResponse.Status)
+		return
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
 }
 
-// SubscriptionsSubIdGet -
+// SubscriptionsSubIdGet - Read an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdGet(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	req := http_wrapper.NewRequest(c.Request, nil)
+	req.Params["subId"] = c.Params.ByName("subId")
+
+	HTTPResponse := producer.HandleSmfEventExposureSubscriptionGet(req.Params["subId"])
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
 }
 
-// SubscriptionsSubIdPut -
+// SubscriptionsSubIdPut - Replace an individual subscription for event notifications from the SMF
 func SubscriptionsSubIdPut(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{})
+	var request models.NsmfEventExposure
+	if err := c.ShouldBindJSON(&request); err != nil {
+		malformedRequest(c, err)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, request)
+	req.Params["subId"] = c.Params.ByName("subId")
+
+	HTTPResponse := producer.HandleSmfEventExposureSubscriptionUpdate(req.Params["subId"],
+		req.Body.(models.NsmfEventExposure))
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+func malformedRequest(c *gin.Context, err error) {
+	problemDetail := "[Request Body] " + err.Error()
+	rsp := models.ProblemDetails{
+		Title:  "Malformed request syntax",
+		Status: http.StatusBadRequest,
+		Detail: problemDetail,
+	}
+	logger.GinLog.Errorln(problemDetail)
+	c.JSON(http.StatusBadRequest, rsp)
 }
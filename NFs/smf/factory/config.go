@@ -31,6 +31,10 @@ const (
 	SMF_DEFAULT_IPV4     = "127.0.0.2"
 	SMF_DEFAULT_PORT     = "8000"
 	SMF_DEFAULT_PORT_INT = 8000
+
+	SMF_DEFAULT_PSA_ADDRESS_LIFETIME = 60
+
+	SMF_DEFAULT_PFCP_HEARTBEAT_INTERVAL = 10
 )
 
 type Configuration struct {
@@ -43,6 +47,24 @@ type Configuration struct {
 	ServiceNameList      []string             `yaml:"serviceNameList,omitempty"`
 	SNssaiInfo           []SnssaiInfoItem     `yaml:"snssaiInfos,omitempty"`
 	ULCL                 bool                 `yaml:"ulcl,omitempty"`
+	UsageReport          *UsageReport         `yaml:"usageReport,omitempty"`
+	PSARelocation        *PSARelocation       `yaml:"psaRelocation,omitempty"`
+	Mongodb              *Mongodb             `yaml:"mongodb,omitempty"`
+	// seconds without user plane traffic before the idle PDU session is released, 0 disables the inactivity detection
+	UserPlaneInactivityTimer uint32 `yaml:"userPlaneInactivityTimer,omitempty"`
+}
+
+// UsageReport configures the URR installed on the anchor UPF of every PDU session,
+// at least one trigger must be set for the UPF to report the usage
+type UsageReport struct {
+	Period          uint32 `yaml:"period,omitempty"`          // seconds between two periodic reports
+	VolumeThreshold uint64 `yaml:"volumeThreshold,omitempty"` // bytes of total volume triggering a report
+	TimeThreshold   uint32 `yaml:"timeThreshold,omitempty"`   // seconds of usage triggering a report
+}
+
+// PSARelocation configures the relocation of the PDU session anchor of the PDU sessions of SSC mode 2 and 3
+type PSARelocation struct {
+	AddressLifetime uint32 `yaml:"addressLifetime,omitempty"` // seconds the old PDU session of SSC mode 3 is kept
 }
 
 type SnssaiInfoItem struct {
@@ -51,9 +73,25 @@ type SnssaiInfoItem struct {
 }
 
 type SnssaiDnnInfoItem struct {
-	Dnn      string `yaml:"dnn"`
-	DNS      DNS    `yaml:"dns"`
-	UESubnet string `yaml:"ueSubnet"`
+	Dnn           string        `yaml:"dnn"`
+	DNS           DNS           `yaml:"dns"`
+	UESubnet      string        `yaml:"ueSubnet"`
+	UEPools       []string      `yaml:"uePools,omitempty"`       // subnets allocated after the ueSubnet is exhausted
+	StaticUEPools []string      `yaml:"staticUePools,omitempty"` // subnets of the static addresses of subscription
+	UESubnetV6    string        `yaml:"ueSubnetV6,omitempty"`    // subnet the /64 prefixes are delegated from
+	ExternalIPAM  *ExternalIPAM `yaml:"externalIpam,omitempty"`
+}
+
+// ExternalIPAM configures the IPAM system outside of the SMF which dynamic UE addresses are allocated from
+type ExternalIPAM struct {
+	Type  string   `yaml:"type"`
+	Pools []string `yaml:"pools,omitempty"` // subnets managed by the stand-in IPAM
+}
+
+// Mongodb configures the database the allocated UE addresses and SM contexts are persisted in
+type Mongodb struct {
+	Name string `yaml:"name"`
+	Url  string `yaml:"url"`
 }
 
 type Sbi struct {
@@ -73,6 +111,8 @@ type TLS struct {
 type PFCP struct {
 	Addr string `yaml:"addr,omitempty"`
 	Port uint16 `yaml:"port,omitempty"`
+	// seconds between two PFCP heartbeat requests to every associated UPF
+	HeartbeatInterval uint32 `yaml:"heartbeatInterval,omitempty"`
 }
 
 type DNS struct {
@@ -137,6 +177,9 @@ type RoutingConfig struct {
 type UserPlaneInformation struct {
 	UPNodes map[string]UPNode `yaml:"up_nodes"`
 	Links   []UPLink          `yaml:"links"`
+	// strategy the anchor UPF of a PDU session is selected with among the ones serving its DNN and S-NSSAI:
+	// first (default), roundRobin, leastSessions, weighted or locality
+	UPFSelection string `yaml:"upfSelection,omitempty"`
 }
 
 // UPNode represent the user plane node
@@ -147,6 +190,14 @@ type UPNode struct {
 	Dnn                  string                     `yaml:"dnn"`
 	SNssaiInfos          []models.SnssaiUpfInfoItem `yaml:"sNssaiUpfInfos,omitempty"`
 	InterfaceUpfInfoList []InterfaceUpfInfoItem     `yaml:"interfaces,omitempty"`
+	Capacity             uint16                     `yaml:"capacity,omitempty"` // relative weight of the UPF
+	Locality             *UPFLocality               `yaml:"locality,omitempty"`
+}
+
+// UPFLocality is the area the UPF is close to, the locality UPF selection prefers it for the UEs located there
+type UPFLocality struct {
+	Tais   []models.Tai `yaml:"tais,omitempty"`
+	GnbIds []string     `yaml:"gnbIds,omitempty"` // gNB IDs in hexadecimal
 }
 
 type InterfaceUpfInfoItem struct {
@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/antihax/optional v1.0.0
 	github.com/antonfisher/nested-logrus-formatter v1.3.0
+	github.com/free5gc/MongoDBLibrary v1.0.0
 	github.com/free5gc/aper v1.0.0
 	github.com/free5gc/flowdesc v1.0.0
 	github.com/free5gc/http2_util v1.0.0
@@ -26,5 +27,7 @@ require (
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.6.1
 	github.com/urfave/cli v1.22.4
+	go.mongodb.org/mongo-driver v1.4.4
+	golang.org/x/net v0.0.0-20201209123823-ac852fbbde11
 	gopkg.in/yaml.v2 v2.4.0
 )
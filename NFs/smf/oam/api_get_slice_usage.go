@@ -0,0 +1,13 @@
+package oam
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/smf/producer"
+)
+
+func HTTPGetSliceUsage(c *gin.Context) {
+	HTTPResponse := producer.HandleOAMGetSliceUsage()
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
@@ -0,0 +1,13 @@
+package oam
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/smf/producer"
+)
+
+func HTTPGetUeIPUsage(c *gin.Context) {
+	HTTPResponse := producer.HandleOAMGetUeIPUsage()
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
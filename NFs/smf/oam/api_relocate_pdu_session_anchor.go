@@ -0,0 +1,55 @@
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/producer"
+)
+
+func HTTPRelocatePDUSessionAnchor(c *gin.Context) {
+	var relocationRequest producer.PSARelocationRequest
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetail := models.ProblemDetails{
+			Title:  "System failure",
+			Status: http.StatusInternalServerError,
+			Detail: err.Error(),
+			Cause:  "SYSTEM_FAILURE",
+		}
+		logger.GinLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return
+	}
+
+	err = openapi.Deserialize(&relocationRequest, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := models.ProblemDetails{
+			Title:  "Malformed request syntax",
+			Status: http.StatusBadRequest,
+			Detail: problemDetail,
+		}
+		logger.GinLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return
+	}
+
+	req := http_wrapper.NewRequest(c.Request, relocationRequest)
+	req.Params["smContextRef"] = c.Params.ByName("smContextRef")
+
+	smContextRef := req.Params["smContextRef"]
+	HTTPResponse := producer.HandleOAMRelocatePDUSessionAnchor(smContextRef, relocationRequest)
+
+	if HTTPResponse.Status == http.StatusNoContent {
+		c.Status(HTTPResponse.Status)
+		return
+	}
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
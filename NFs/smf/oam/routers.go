@@ -38,6 +38,8 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case "GET":
 			group.GET(route.Pattern, route.HandlerFunc)
+		case "POST":
+			group.POST(route.Pattern, route.HandlerFunc)
 		}
 	}
 	return group
@@ -61,4 +63,22 @@ var routes = Routes{
 		"/ue-pdu-session-info/:smContextRef",
 		HTTPGetUEPDUSessionInfo,
 	},
+	{
+		"Relocate PDU Session Anchor",
+		"POST",
+		"/ue-pdu-session-info/:smContextRef/psa-relocation",
+		HTTPRelocatePDUSessionAnchor,
+	},
+	{
+		"Get Slice Usage",
+		"GET",
+		"/usage",
+		HTTPGetSliceUsage,
+	},
+	{
+		"Get UE IP Usage",
+		"GET",
+		"/ue-ip-usage",
+		HTTPGetUeIPUsage,
+	},
 }
@@ -8,9 +8,11 @@ import (
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
+	"github.com/free5gc/smf/consumer"
 	smf_context "github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/logger"
 	pfcp_message "github.com/free5gc/smf/pfcp/message"
+	"github.com/free5gc/smf/pfcp/udp"
 	"github.com/free5gc/smf/producer"
 )
 
@@ -19,8 +21,41 @@ func HandlePfcpHeartbeatRequest(msg *pfcpUdp.Message) {
 	pfcp_message.SendHeartbeatResponse(msg.RemoteAddr, h.SequenceNumber)
 }
 
+// HandlePfcpHeartbeatResponse records the heartbeat of the UPF, the UPF with a new Recovery Time Stamp has restarted
+// and lost its PFCP association, which is set up again (TS 29.244 6.2.2)
 func HandlePfcpHeartbeatResponse(msg *pfcpUdp.Message) {
-	logger.PfcpLog.Warnf("PFCP Heartbeat Response handling is not implemented")
+	rsp := msg.PfcpMessage.Body.(pfcp.HeartbeatResponse)
+
+	nodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: msg.RemoteAddr.IP.To4(),
+	}
+	if nodeID.NodeIdValue == nil {
+		nodeID.NodeIdType = pfcpType.NodeIdTypeIpv6Address
+		nodeID.NodeIdValue = msg.RemoteAddr.IP
+	}
+	upf := smf_context.RetrieveUPFNodeByNodeID(nodeID)
+	if upf == nil {
+		logger.PfcpLog.Warnf("PFCP Heartbeat Response from unknown UPF[%s]", msg.RemoteAddr)
+		return
+	}
+	upfAvailable(upf)
+
+	if rsp.RecoveryTimeStamp != nil && !upf.RecoveryTimeStamp.IsZero() &&
+		rsp.RecoveryTimeStamp.RecoveryTimeStamp.Unix() != upf.RecoveryTimeStamp.Unix() {
+		logger.PfcpLog.Warnf("UPF[%s] has restarted, set up its PFCP association again",
+			upf.NodeID.ResolveNodeIdToIp().String())
+		upf.SetStatus(smf_context.NotAssociated)
+		pfcp_message.SendPfcpAssociationSetupRequest(upf.NodeID)
+	}
+}
+
+// upfAvailable records the UPF answering the SMF, the UPF unavailable before is selected for the data paths again
+func upfAvailable(upf *smf_context.UPF) {
+	if upf.HeartbeatResponded() {
+		logger.PfcpLog.Infof("UPF[%s] is available again", upf.NodeID.ResolveNodeIdToIp().String())
+		smf_context.GetUserPlaneInformation().ResetDefaultUserPlanePath()
+	}
 }
 
 func HandlePfcpPfdManagementRequest(msg *pfcpUdp.Message) {
@@ -28,7 +63,16 @@ func HandlePfcpPfdManagementRequest(msg *pfcpUdp.Message) {
 }
 
 func HandlePfcpPfdManagementResponse(msg *pfcpUdp.Message) {
-	logger.PfcpLog.Warnf("PFCP PFD Management Response handling is not implemented")
+	rsp := msg.PfcpMessage.Body.(pfcp.PFCPPFDManagementResponse)
+
+	if rsp.Cause == nil || rsp.Cause.CauseValue != pfcpType.CauseRequestAccepted {
+		logger.PfcpLog.Warnf("UPF[%s] rejects PFCP PFD Management Request: %+v", msg.RemoteAddr, rsp.Cause)
+		if rsp.OffendingIE != nil {
+			logger.PfcpLog.Warnf("Offending IE type: %d", rsp.OffendingIE.TypeOfOffendingIe)
+		}
+		return
+	}
+	logger.PfcpLog.Infof("UPF[%s] accepts PFCP PFD Management Request", msg.RemoteAddr)
 }
 
 func HandlePfcpAssociationSetupRequest(msg *pfcpUdp.Message) {
@@ -48,12 +92,18 @@ func HandlePfcpAssociationSetupRequest(msg *pfcpUdp.Message) {
 	}
 
 	upf.UPIPInfo = *req.UserPlaneIPResourceInformation
+	upf.UPFunctionFeatures = req.UPFunctionFeatures
+	upf.SetStatus(smf_context.AssociatedSetUpSuccess)
+	upf.ResetGTPUPeers()
+	upfAvailable(upf)
 
 	// Response with PFCP Association Setup Response
 	cause := pfcpType.Cause{
 		CauseValue: pfcpType.CauseRequestAccepted,
 	}
 	pfcp_message.SendPfcpAssociationSetupResponse(*nodeID, cause)
+	handleUPFRecovery(upf, req.RecoveryTimeStamp)
+	provisionPFDs(upf)
 }
 
 func HandlePfcpAssociationSetupResponse(msg *pfcpUdp.Message) {
@@ -74,7 +124,10 @@ func HandlePfcpAssociationSetupResponse(msg *pfcpUdp.Message) {
 			return
 		}
 
-		upf.UPFStatus = smf_context.AssociatedSetUpSuccess
+		upf.UPFunctionFeatures = req.UPFunctionFeatures
+		upf.SetStatus(smf_context.AssociatedSetUpSuccess)
+		upf.ResetGTPUPeers()
+		upfAvailable(upf)
 
 		if req.UserPlaneIPResourceInformation != nil {
 			upf.UPIPInfo = *req.UserPlaneIPResourceInformation
@@ -84,6 +137,33 @@ func HandlePfcpAssociationSetupResponse(msg *pfcpUdp.Message) {
 		} else {
 			logger.PfcpLog.Errorln("pfcp association setup response has no UserPlane IP Resource Information")
 		}
+		handleUPFRecovery(upf, req.RecoveryTimeStamp)
+		provisionPFDs(upf)
+	}
+}
+
+// provisionPFDs provisions the PFDs of all the applications to the UPF supporting PFDM in new PFCP association
+func provisionPFDs(upf *smf_context.UPF) {
+	if !upf.SupportPFDM() {
+		return
+	}
+	if pfdDatas := smf_context.PFDDatas(); len(pfdDatas) != 0 {
+		pfcp_message.SendPfcpPfdManagementRequest(upf.NodeID, pfdDatas)
+	}
+}
+
+// handleUPFRecovery compares the Recovery Time Stamp of the UPF with the one persisted before the SMF restarts, the
+// PFCP sessions lost by the restarted UPF are established again (TS 23.527 4.3)
+func handleUPFRecovery(upf *smf_context.UPF, recoveryTimeStamp *pfcpType.RecoveryTimeStamp) {
+	if recoveryTimeStamp == nil {
+		logger.PfcpLog.Warnf("PFCP association of UPF[%s] has no Recovery Time Stamp",
+			upf.NodeID.ResolveNodeIdToIp().String())
+		return
+	}
+	if smf_context.StoreUPFRecoveryTimeStamp(upf, recoveryTimeStamp.RecoveryTimeStamp) {
+		logger.PfcpLog.Infof("UPF[%s] has restarted, establish its PFCP sessions again",
+			upf.NodeID.ResolveNodeIdToIp().String())
+		go producer.RecoverPFCPSessions(upf)
 	}
 }
 
@@ -123,8 +203,53 @@ func HandlePfcpVersionNotSupportedResponse(msg *pfcpUdp.Message) {
 	logger.PfcpLog.Warnf("PFCP Version Not Support Response handling is not implemented")
 }
 
+// HandlePfcpNodeReportRequest marks the remote GTP-U peers of the user plane path failures the UPF reports as down,
+// the data paths of new PDU sessions avoid them (TS 29.244 5.22)
 func HandlePfcpNodeReportRequest(msg *pfcpUdp.Message) {
-	logger.PfcpLog.Warnf("PFCP Node Report Request handling is not implemented")
+	req := msg.PfcpMessage.Body.(pfcp.PFCPNodeReportRequest)
+	seqFromUPF := msg.PfcpMessage.Header.SequenceNumber
+
+	var cause pfcpType.Cause
+	var upf *smf_context.UPF
+	if req.NodeID != nil {
+		upf = smf_context.RetrieveUPFNodeByNodeID(*req.NodeID)
+	}
+	if upf == nil {
+		logger.PfcpLog.Warnf("PFCP Node Report Request from unknown UPF[%s]", msg.RemoteAddr)
+		cause.CauseValue = pfcpType.CauseNoEstablishedPfcpAssociation
+		pfcp_message.SendPfcpNodeReportResponse(msg.RemoteAddr, cause, seqFromUPF)
+		return
+	}
+
+	if req.NodeReportType != nil && req.NodeReportType.Upfr {
+		if req.UserPlanePathFailureReport == nil {
+			logger.PfcpLog.Warnf("PFCP Node Report Request UPFR without User Plane Path Failure Report")
+			cause.CauseValue = pfcpType.CauseMandatoryIeMissing
+			pfcp_message.SendPfcpNodeReportResponse(msg.RemoteAddr, cause, seqFromUPF)
+			return
+		}
+		peers, err := udp.RemoteGTPUPeers(req.UserPlanePathFailureReport)
+		if err != nil {
+			logger.PfcpLog.Warnf("User Plane Path Failure Report error: %+v", err)
+			cause.CauseValue = pfcpType.CauseMandatoryIeIncorrect
+			pfcp_message.SendPfcpNodeReportResponse(msg.RemoteAddr, cause, seqFromUPF)
+			return
+		}
+		for _, peer := range peers {
+			peerIP := peer.Ipv4Address
+			if peer.V6 {
+				peerIP = peer.Ipv6Address
+			}
+			logger.PfcpLog.Warnf("User plane path from UPF[%s] to GTP-U peer[%s] fails",
+				upf.NodeID.ResolveNodeIdToIp().String(), peerIP)
+			upf.SetGTPUPeerDown(peerIP)
+		}
+		// the default paths through the failed peers are generated again
+		smf_context.GetUserPlaneInformation().ResetDefaultUserPlanePath()
+	}
+
+	cause.CauseValue = pfcpType.CauseRequestAccepted
+	pfcp_message.SendPfcpNodeReportResponse(msg.RemoteAddr, cause, seqFromUPF)
 }
 
 func HandlePfcpNodeReportResponse(msg *pfcpUdp.Message) {
@@ -148,12 +273,16 @@ func HandlePfcpSessionEstablishmentResponse(msg *pfcpUdp.Message) {
 
 	if rsp.UPFSEID != nil {
 		NodeIDtoIP := rsp.NodeID.ResolveNodeIdToIp().String()
+		smContext.SMLock.Lock()
 		pfcpSessionCtx := smContext.PFCPContext[NodeIDtoIP]
 		pfcpSessionCtx.RemoteSEID = rsp.UPFSEID.Seid
+		smContext.Store()
+		smContext.SMLock.Unlock()
 	}
 
+	// the PFCP session established again after the UPF restarts is not a new PDU session
 	ANUPF := smContext.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
-	if rsp.Cause.CauseValue == pfcpType.CauseRequestAccepted &&
+	if rsp.Cause.CauseValue == pfcpType.CauseRequestAccepted && smContext.SMContextState == smf_context.ActivePending &&
 		ANUPF.UPF.NodeID.ResolveNodeIdToIp().Equal(rsp.NodeID.ResolveNodeIdToIp()) {
 		n1n2Request := models.N1N2MessageTransferRequest{}
 
@@ -229,6 +358,13 @@ func HandlePfcpSessionModificationResponse(msg *pfcpUdp.Message) {
 		}
 	}
 
+	if usageReport := pfcpRsp.UsageReport; usageReport != nil && smContext != nil {
+		report, err := smf_context.NewUsageReport(usageReport.URRID,
+			usageReport.UsageReportTrigger, usageReport.StartTime, usageReport.EndTime,
+			usageReport.VolumeMeasurement, usageReport.DurationMeasurement)
+		handleUsageReport(smContext, report, err)
+	}
+
 	if pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
 		logger.PduSessLog.Infoln("[SMF] PFCP Modification Resonse Accept")
 		if smContext.SMContextState == smf_context.PFCPModification {
@@ -245,8 +381,8 @@ func HandlePfcpSessionModificationResponse(msg *pfcpUdp.Message) {
 				if smContext.BPManager.BPStatus == smf_context.UnInitialized {
 					logger.PfcpLog.Infoln("Add PSAAndULCL")
 					upfNodeID := smContext.GetNodeIDByLocalSEID(SEID)
-					producer.AddPDUSessionAnchorAndULCL(smContext, upfNodeID)
 					smContext.BPManager.BPStatus = smf_context.AddingPSA
+					producer.AddPDUSessionAnchorAndULCL(smContext, upfNodeID)
 				}
 			}
 		}
@@ -278,6 +414,14 @@ func HandlePfcpSessionDeletionResponse(msg *pfcpUdp.Message) {
 		// TODO fix: SEID should be the value sent by UPF but now the SEID value is from sm context
 	}
 
+	// the UPF reports the final usage of the session on deletion
+	if usageReport := pfcpRsp.UsageReport; usageReport != nil {
+		report, err := smf_context.NewUsageReport(usageReport.URRID,
+			usageReport.UsageReportTrigger, usageReport.StartTime, usageReport.EndTime,
+			usageReport.VolumeMeasurement, usageReport.DurationMeasurement)
+		handleUsageReport(smContext, report, err)
+	}
+
 	if pfcpRsp.Cause.CauseValue == pfcpType.CauseRequestAccepted {
 		if smContext.SMContextState == smf_context.PFCPModification {
 			upfNodeID := smContext.GetNodeIDByLocalSEID(SEID)
@@ -296,6 +440,8 @@ func HandlePfcpSessionDeletionResponse(msg *pfcpUdp.Message) {
 		}
 		logger.PfcpLog.Infof("PFCP Session Deletion Failed[%d]\n", SEID)
 	}
+	// the PFCP session of a data path removed from the PDU session
+	smContext.ReleaseRemovedLocalSEID(SEID)
 }
 
 func HandlePfcpSessionReportRequest(msg *pfcpUdp.Message) {
@@ -317,6 +463,37 @@ func HandlePfcpSessionReportRequest(msg *pfcpUdp.Message) {
 
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	if req.ReportType.Usar {
+		if usageReport := req.UsageReport; usageReport == nil {
+			logger.PfcpLog.Warnf("PFCP Session Report Request USAR without Usage Report")
+		} else {
+			report, err := smf_context.NewUsageReport(usageReport.URRID,
+				usageReport.UsageReportTrigger, usageReport.StartTime, usageReport.EndTime,
+				usageReport.VolumeMeasurement, usageReport.DurationMeasurement)
+			handleUsageReport(smContext, report, err)
+		}
+	}
+
+	if req.ReportType.Erir {
+		if errorIndicationReport := req.ErrorIndicationReport; errorIndicationReport == nil ||
+			errorIndicationReport.RemoteFTEID == nil {
+			logger.PfcpLog.Warnf("PFCP Session Report Request ERIR without Error Indication Report")
+		} else {
+			go producer.HandleErrorIndication(smContext.Ref, errorIndicationReport.RemoteFTEID)
+		}
+	}
+
+	if req.ReportType.Upir {
+		go producer.ReleaseInactivePDUSession(smContext.Ref)
+	}
+
+	if !req.ReportType.Dldr {
+		cause.CauseValue = pfcpType.CauseRequestAccepted
+		// TODO fix: SEID should be the value sent by UPF but now the SEID value is from sm context
+		pfcp_message.SendPfcpSessionReportResponse(msg.RemoteAddr, cause, seqFromUPF, SEID)
+	}
 
 	if req.ReportType.Dldr {
 		downlinkDataReport := req.DownlinkDataReport
@@ -377,6 +554,35 @@ func HandlePfcpSessionReportRequest(msg *pfcpUdp.Message) {
 	}
 }
 
+// handleUsageReport accounts a usage report of the PDU session and forwards it to the PCF and the QOF, the PDU
+// session is released once none of its anchor UPFs sees user plane traffic
+func handleUsageReport(smContext *smf_context.SMContext, report *smf_context.UsageReport, err error) {
+	if err != nil {
+		logger.PfcpLog.Warnf("Usage Report error: %+v", err)
+		return
+	}
+
+	smContext.AddUsageReport(report)
+
+	if smContext.UserPlaneInactive(report) {
+		go producer.ReleaseInactivePDUSession(smContext.Ref)
+	}
+
+	if accuUsageReports := smContext.AccuUsageReports(); accuUsageReports != nil {
+		go producer.UpdateSMPolicyByUsageReport(smContext.Ref, accuUsageReports)
+	}
+
+	if smf_context.SMF_Self().QofUri == "" || smContext.Snssai == nil {
+		return
+	}
+	qofReport := smContext.QOFUsageReport(report)
+	go func() {
+		if err := consumer.SendUsageReportQOF(qofReport); err != nil {
+			logger.PfcpLog.Warnf("Send Usage Report to QOF failed: %+v", err)
+		}
+	}()
+}
+
 func HandlePfcpSessionReportResponse(msg *pfcpUdp.Message) {
 	logger.PfcpLog.Warnf("PFCP Session Report Response handling is not implemented")
 }
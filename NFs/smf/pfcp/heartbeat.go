@@ -0,0 +1,46 @@
+package pfcp
+
+import (
+	"time"
+
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	"github.com/free5gc/smf/pfcp/message"
+)
+
+// RunHeartbeat sends PFCP heartbeat requests to the associated UPFs every interval (TS 29.244 6.2.2), the UPF missing
+// the heartbeats is unavailable to new PDU sessions, and the PFCP association of the UPF without one is requested
+// until the UPF is back
+func RunHeartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkUPFs()
+		}
+	}()
+}
+
+func checkUPFs() {
+	for _, upNode := range smf_context.GetUserPlaneInformation().UPFs {
+		upf := upNode.UPF
+		// the UPF releasing its PFCP association is left out
+		if smf_context.RetrieveUPFNodeByNodeID(upf.NodeID) != upf {
+			continue
+		}
+
+		if upf.Status() != smf_context.AssociatedSetUpSuccess {
+			message.SendPfcpAssociationSetupRequest(upf.NodeID)
+			continue
+		}
+		if upf.HeartbeatDue() {
+			logger.PfcpLog.Warnf("UPF[%s] misses PFCP heartbeats, it is unavailable until its PFCP association is "+
+				"set up again", upf.NodeID.ResolveNodeIdToIp().String())
+			upf.SetStatus(smf_context.NotAssociated)
+			smf_context.GetUserPlaneInformation().ResetDefaultUserPlanePath()
+			message.SendPfcpAssociationSetupRequest(upf.NodeID)
+			continue
+		}
+		message.SendHeartbeatRequest(upf.NodeID)
+	}
+}
@@ -3,12 +3,23 @@ package message
 import (
 	"net"
 
+	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/smf/context"
 	"github.com/free5gc/smf/pfcp/udp"
 )
 
+func BuildPfcpHeartbeatRequest() (pfcp.HeartbeatRequest, error) {
+	msg := pfcp.HeartbeatRequest{}
+
+	msg.RecoveryTimeStamp = &pfcpType.RecoveryTimeStamp{
+		RecoveryTimeStamp: udp.ServerStartTime,
+	}
+
+	return msg, nil
+}
+
 func BuildPfcpAssociationSetupRequest() (pfcp.PFCPAssociationSetupRequest, error) {
 	msg := pfcp.PFCPAssociationSetupRequest{}
 
@@ -61,6 +72,60 @@ func BuildPfcpAssociationReleaseResponse(cause pfcpType.Cause) (pfcp.PFCPAssocia
 	return msg, nil
 }
 
+// PFDManagementRequest is the body of the PFCP PFD Management Request, the Application ID of pfcp.ApplicationIDsPFDs
+// is not a pointer, which the PFCP library cannot marshal
+type PFDManagementRequest struct {
+	ApplicationIDsPFDs []ApplicationIDsPFDs `tlv:"58"`
+}
+
+type ApplicationIDsPFDs struct {
+	ApplicationID *pfcpType.ApplicationID `tlv:"24"`
+	PFDContexts   []*pfcp.PFD             `tlv:"59"`
+}
+
+// BuildPfcpPfdManagementRequest builds the PFDs of the applications, an application without PFDs has its PFDs
+// removed from the UPF (TS 29.244 6.2.5)
+func BuildPfcpPfdManagementRequest(pfdDatas []models.PfdDataForApp) (PFDManagementRequest, error) {
+	msg := PFDManagementRequest{}
+
+	for _, pfdData := range pfdDatas {
+		appIDsPFDs := ApplicationIDsPFDs{
+			ApplicationID: &pfcpType.ApplicationID{
+				ApplicationIdentifier: []byte(pfdData.ApplicationId),
+			},
+		}
+		for _, pfd := range pfdData.Pfds {
+			pfdContext := new(pfcp.PFD)
+			for _, flowDescription := range pfd.FlowDescriptions {
+				pfdContext.PFDContents = append(pfdContext.PFDContents,
+					pfcpType.PFDContents{FlowDescription: flowDescription})
+			}
+			for _, url := range pfd.Urls {
+				pfdContext.PFDContents = append(pfdContext.PFDContents, pfcpType.PFDContents{URL: url})
+			}
+			for _, domainName := range pfd.DomainNames {
+				pfdContext.PFDContents = append(pfdContext.PFDContents, pfcpType.PFDContents{DomainName: domainName})
+			}
+			if len(pfdContext.PFDContents) != 0 {
+				appIDsPFDs.PFDContexts = append(appIDsPFDs.PFDContexts, pfdContext)
+			}
+		}
+		msg.ApplicationIDsPFDs = append(msg.ApplicationIDsPFDs, appIDsPFDs)
+	}
+
+	return msg, nil
+}
+
+func BuildPfcpNodeReportResponse(cause pfcpType.Cause) (pfcp.PFCPNodeReportResponse, error) {
+	msg := pfcp.PFCPNodeReportResponse{}
+
+	msg.NodeID = &context.SMF_Self().CPNodeID
+
+	msg.Cause = &cause
+
+	return msg, nil
+}
+
 func pdrToCreatePDR(pdr *context.PDR) *pfcp.CreatePDR {
 	createPDR := new(pfcp.CreatePDR)
 
@@ -101,6 +166,12 @@ func pdrToCreatePDR(pdr *context.PDR) *pfcp.CreatePDR {
 		}
 	}
 
+	if pdr.URR != nil && pdr.URR.State != context.RULE_REMOVE {
+		createPDR.URRID = append(createPDR.URRID, &pfcpType.URRID{
+			UrrIdValue: pdr.URR.URRID,
+		})
+	}
+
 	return createPDR
 }
 
@@ -162,6 +233,50 @@ func qerToCreateQER(qer *context.QER) *pfcp.CreateQER {
 	return createQER
 }
 
+func qerToUpdateQER(qer *context.QER) *pfcp.UpdateQER {
+	updateQER := new(pfcp.UpdateQER)
+
+	updateQER.QERID = new(pfcpType.QERID)
+	updateQER.QERID.QERID = qer.QERID
+	updateQER.GateStatus = qer.GateStatus
+
+	updateQER.QoSFlowIdentifier = &qer.QFI
+	updateQER.MaximumBitrate = qer.MBR
+	updateQER.GuaranteedBitrate = qer.GBR
+
+	return updateQER
+}
+
+func urrToCreateURR(urr *context.URR) *pfcp.CreateURR {
+	createURR := new(pfcp.CreateURR)
+
+	createURR.URRID = new(pfcpType.URRID)
+	createURR.URRID.UrrIdValue = urr.URRID
+
+	createURR.MeasurementMethod = &urr.MeasurementMethod
+	createURR.ReportingTriggers = &urr.ReportingTriggers
+	createURR.MeasurementPeriod = urr.MeasurementPeriod
+	createURR.VolumeThreshold = urr.VolumeThreshold
+	createURR.TimeThreshold = urr.TimeThreshold
+	createURR.QuotaHoldingTime = urr.QuotaHoldingTime
+
+	return createURR
+}
+
+// pdrURRs returns the URRs referenced by the PDRs, a URR may be shared by several PDRs. The URR ID of a released
+// URR may already be reused by a new one, so URRs are told apart by identity rather than by ID
+func pdrURRs(pdrList []*context.PDR) []*context.URR {
+	urrList := make([]*context.URR, 0)
+	urrMap := make(map[*context.URR]bool)
+	for _, pdr := range pdrList {
+		if pdr.URR != nil && !urrMap[pdr.URR] {
+			urrMap[pdr.URR] = true
+			urrList = append(urrList, pdr.URR)
+		}
+	}
+	return urrList
+}
+
 func pdrToUpdatePDR(pdr *context.PDR) *pfcp.UpdatePDR {
 	updatePDR := new(pfcp.UpdatePDR)
 
@@ -198,6 +313,12 @@ func pdrToUpdatePDR(pdr *context.PDR) *pfcp.UpdatePDR {
 		FarIdValue: pdr.FAR.FARID,
 	}
 
+	if pdr.URR != nil && pdr.URR.State != context.RULE_REMOVE {
+		updatePDR.URRID = append(updatePDR.URRID, &pfcpType.URRID{
+			UrrIdValue: pdr.URR.URRID,
+		})
+	}
+
 	return updatePDR
 }
 
@@ -262,6 +383,8 @@ func BuildPfcpSessionEstablishmentRequest(
 	msg.CreatePDR = make([]*pfcp.CreatePDR, 0)
 	msg.CreateFAR = make([]*pfcp.CreateFAR, 0)
 
+	urrList := pdrURRs(pdrList)
+
 	for _, pdr := range pdrList {
 		if pdr.State == context.RULE_INITIAL {
 			msg.CreatePDR = append(msg.CreatePDR, pdrToCreatePDR(pdr))
@@ -269,6 +392,16 @@ func BuildPfcpSessionEstablishmentRequest(
 		pdr.State = context.RULE_CREATE
 	}
 
+	for _, urr := range urrList {
+		if urr.State == context.RULE_REMOVE {
+			continue
+		}
+		if urr.State == context.RULE_INITIAL {
+			msg.CreateURR = append(msg.CreateURR, urrToCreateURR(urr))
+		}
+		urr.State = context.RULE_CREATE
+	}
+
 	for _, far := range farList {
 		if far.State == context.RULE_INITIAL {
 			msg.CreateFAR = append(msg.CreateFAR, farToCreateFAR(far))
@@ -296,9 +429,8 @@ func BuildPfcpSessionEstablishmentRequest(
 		filteredQER.State = context.RULE_CREATE
 	}
 
-	msg.PDNType = &pfcpType.PDNType{
-		PdnType: pfcpType.PDNTypeIpv4,
-	}
+	pdnType := smContext.PDNType()
+	msg.PDNType = &pdnType
 
 	// for _, far := range msg.CreateFAR {
 	// 	printCreateFAR(far)
@@ -368,6 +500,8 @@ func BuildPfcpSessionModificationRequest(
 		Ipv4Address: context.SMF_Self().CPNodeID.NodeIdValue,
 	}
 
+	urrList := pdrURRs(pdrList)
+
 	for _, pdr := range pdrList {
 		switch pdr.State {
 		case context.RULE_INITIAL:
@@ -411,10 +545,39 @@ func BuildPfcpSessionModificationRequest(
 		switch qer.State {
 		case context.RULE_INITIAL:
 			msg.CreateQER = append(msg.CreateQER, qerToCreateQER(qer))
+		case context.RULE_UPDATE:
+			msg.UpdateQER = append(msg.UpdateQER, qerToUpdateQER(qer))
+		case context.RULE_REMOVE:
+			msg.RemoveQER = append(msg.RemoveQER, &pfcp.RemoveQER{
+				QERID: &pfcpType.QERID{
+					QERID: qer.QERID,
+				},
+			})
 		}
 		qer.State = context.RULE_CREATE
 	}
 
+	for _, urr := range urrList {
+		switch urr.State {
+		case context.RULE_INITIAL:
+			msg.CreateURR = append(msg.CreateURR, urrToCreateURR(urr))
+		case context.RULE_REMOVE:
+			// a released URR is detached from the PDRs below so that it is neither installed nor removed again
+			msg.RemoveURR = append(msg.RemoveURR, &pfcp.RemoveURR{
+				URRID: &pfcpType.URRID{
+					UrrIdValue: urr.URRID,
+				},
+			})
+			continue
+		}
+		urr.State = context.RULE_CREATE
+	}
+	for _, pdr := range pdrList {
+		if pdr.URR != nil && pdr.URR.State == context.RULE_REMOVE {
+			pdr.URR = nil
+		}
+	}
+
 	return msg, nil
 }
 
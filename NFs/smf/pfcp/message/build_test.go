@@ -0,0 +1,121 @@
+package message_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/pfcp/message"
+)
+
+func TestBuildPfcpSessionEstablishmentRequestURR(t *testing.T) {
+	upNodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: net.ParseIP("10.4.0.11").To4(),
+	}
+	smContext := context.NewSMContext("imsi-208930000000201", 1)
+	smContext.PFCPContext[upNodeID.ResolveNodeIdToIp().String()] = &context.PFCPSessionContext{
+		NodeID:    upNodeID,
+		LocalSEID: 1,
+	}
+
+	urr := &context.URR{
+		URRID:             7,
+		MeasurementMethod: pfcpType.MeasurementMethod{Volum: true, Durat: true},
+		ReportingTriggers: pfcpType.ReportingTriggers{Perio: true},
+		MeasurementPeriod: &pfcpType.MeasurementPeriod{MeasurementPeriod: 60},
+	}
+	ulPDR := &context.PDR{PDRID: 1, FAR: &context.FAR{FARID: 1}, URR: urr}
+	dlPDR := &context.PDR{PDRID: 2, FAR: &context.FAR{FARID: 2}, URR: urr}
+	anPDR := &context.PDR{PDRID: 3, FAR: &context.FAR{FARID: 3}}
+
+	msg, err := message.BuildPfcpSessionEstablishmentRequest(upNodeID, smContext,
+		[]*context.PDR{ulPDR, dlPDR, anPDR}, nil, nil, nil)
+	require.NoError(t, err)
+
+	// the URR shared by the uplink and downlink PDRs is created once
+	require.Len(t, msg.CreateURR, 1)
+	require.Equal(t, uint32(7), msg.CreateURR[0].URRID.UrrIdValue)
+	require.Equal(t, uint32(60), msg.CreateURR[0].MeasurementPeriod.MeasurementPeriod)
+	require.True(t, msg.CreateURR[0].ReportingTriggers.Perio)
+	require.Equal(t, context.RULE_CREATE, urr.State)
+
+	require.Len(t, msg.CreatePDR, 3)
+	require.Equal(t, []*pfcpType.URRID{{UrrIdValue: 7}}, msg.CreatePDR[0].URRID)
+	require.Equal(t, []*pfcpType.URRID{{UrrIdValue: 7}}, msg.CreatePDR[1].URRID)
+	require.Empty(t, msg.CreatePDR[2].URRID)
+
+	// a released URR is removed from the UPF on modification
+	urr.State = context.RULE_REMOVE
+	modification, err := message.BuildPfcpSessionModificationRequest(upNodeID, smContext,
+		[]*context.PDR{ulPDR}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, modification.RemoveURR, 1)
+	require.Equal(t, uint32(7), modification.RemoveURR[0].URRID.UrrIdValue)
+	require.Empty(t, modification.CreateURR)
+	require.Equal(t, context.RULE_REMOVE, urr.State)
+
+	// the released URR is not sent again, a new URR reusing its ID is created
+	ulPDR.State = context.RULE_UPDATE
+	newURR := &context.URR{URRID: 7, MeasurementMethod: pfcpType.MeasurementMethod{Volum: true}}
+	dlPDR.URR = newURR
+	dlPDR.State = context.RULE_UPDATE
+	modification, err = message.BuildPfcpSessionModificationRequest(upNodeID, smContext,
+		[]*context.PDR{ulPDR, dlPDR}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, modification.RemoveURR)
+	require.Len(t, modification.CreateURR, 1)
+	require.Nil(t, ulPDR.URR)
+	require.Empty(t, modification.UpdatePDR[0].URRID)
+	require.Equal(t, []*pfcpType.URRID{{UrrIdValue: 7}}, modification.UpdatePDR[1].URRID)
+	require.Equal(t, context.RULE_CREATE, newURR.State)
+}
+
+func TestBuildPfcpPfdManagementRequest(t *testing.T) {
+	req, err := message.BuildPfcpPfdManagementRequest([]models.PfdDataForApp{
+		{
+			ApplicationId: "edge",
+			Pfds: []models.PfdContent{{
+				PfdId:            "pfd1",
+				FlowDescriptions: []string{"permit out ip from 10.60.0.1 to assigned"},
+				DomainNames:      []string{"edge.example.com"},
+			}},
+		},
+		{ApplicationId: "removed"},
+	})
+	require.NoError(t, err)
+	require.Len(t, req.ApplicationIDsPFDs, 2)
+	require.Equal(t, []byte("edge"), req.ApplicationIDsPFDs[0].ApplicationID.ApplicationIdentifier)
+	require.Len(t, req.ApplicationIDsPFDs[0].PFDContexts, 1)
+	require.Equal(t, []pfcpType.PFDContents{
+		{FlowDescription: "permit out ip from 10.60.0.1 to assigned"},
+		{DomainName: "edge.example.com"},
+	}, req.ApplicationIDsPFDs[0].PFDContexts[0].PFDContents)
+	// an application without PFDs is sent without PFD contexts to remove its PFDs
+	require.Equal(t, []byte("removed"), req.ApplicationIDsPFDs[1].ApplicationID.ApplicationIdentifier)
+	require.Empty(t, req.ApplicationIDsPFDs[1].PFDContexts)
+
+	msg := pfcp.Message{
+		Header: pfcp.Header{
+			Version:        pfcp.PfcpVersion,
+			MessageType:    pfcp.PFCP_PFD_MANAGEMENT_REQUEST,
+			SequenceNumber: 1,
+		},
+		Body: req,
+	}
+	buf, err := msg.Marshal()
+	require.NoError(t, err)
+
+	var decoded pfcp.Message
+	require.NoError(t, decoded.Unmarshal(buf))
+	body, ok := decoded.Body.(pfcp.PFCPPFDManagementRequest)
+	require.True(t, ok)
+	require.Len(t, body.ApplicationIDsPFDs, 2)
+	require.Equal(t, []byte("edge"), body.ApplicationIDsPFDs[0].ApplicationID.ApplicationIdentifier)
+	require.Equal(t, []byte("removed"), body.ApplicationIDsPFDs[1].ApplicationID.ApplicationIdentifier)
+}
@@ -3,6 +3,7 @@ package message
 import (
 	"net"
 
+	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
@@ -122,6 +123,53 @@ func SendPfcpAssociationReleaseResponse(upNodeID pfcpType.NodeID, cause pfcpType
 	udp.SendPfcp(message, addr)
 }
 
+func SendPfcpPfdManagementRequest(upNodeID pfcpType.NodeID, pfdDatas []models.PfdDataForApp) {
+	pfcpMsg, err := BuildPfcpPfdManagementRequest(pfdDatas)
+	if err != nil {
+		logger.PfcpLog.Errorf("Build PFCP PFD Management Request failed: %v", err)
+		return
+	}
+
+	message := pfcp.Message{
+		Header: pfcp.Header{
+			Version:        pfcp.PfcpVersion,
+			MP:             0,
+			S:              pfcp.SEID_NOT_PRESENT,
+			MessageType:    pfcp.PFCP_PFD_MANAGEMENT_REQUEST,
+			SequenceNumber: getSeqNumber(),
+		},
+		Body: pfcpMsg,
+	}
+
+	addr := &net.UDPAddr{
+		IP:   upNodeID.ResolveNodeIdToIp(),
+		Port: pfcpUdp.PFCP_PORT,
+	}
+
+	udp.SendPfcp(message, addr)
+}
+
+func SendPfcpNodeReportResponse(addr *net.UDPAddr, cause pfcpType.Cause, seqFromUPF uint32) {
+	pfcpMsg, err := BuildPfcpNodeReportResponse(cause)
+	if err != nil {
+		logger.PfcpLog.Errorf("Build PFCP Node Report Response failed: %v", err)
+		return
+	}
+
+	message := pfcp.Message{
+		Header: pfcp.Header{
+			Version:        pfcp.PfcpVersion,
+			MP:             0,
+			S:              pfcp.SEID_NOT_PRESENT,
+			MessageType:    pfcp.PFCP_NODE_REPORT_RESPONSE,
+			SequenceNumber: seqFromUPF,
+		},
+		Body: pfcpMsg,
+	}
+
+	udp.SendPfcp(message, addr)
+}
+
 func SendPfcpSessionEstablishmentRequest(
 	upNodeID pfcpType.NodeID,
 	ctx *context.SMContext,
@@ -315,6 +363,32 @@ func SendPfcpSessionReportResponse(addr *net.UDPAddr, cause pfcpType.Cause, seqF
 	udp.SendPfcp(message, addr)
 }
 
+func SendHeartbeatRequest(upNodeID pfcpType.NodeID) {
+	pfcpMsg, err := BuildPfcpHeartbeatRequest()
+	if err != nil {
+		logger.PfcpLog.Errorf("Build PFCP Heartbeat Request failed: %v", err)
+		return
+	}
+
+	message := pfcp.Message{
+		Header: pfcp.Header{
+			Version:        pfcp.PfcpVersion,
+			MP:             0,
+			S:              pfcp.SEID_NOT_PRESENT,
+			MessageType:    pfcp.PFCP_HEARTBEAT_REQUEST,
+			SequenceNumber: getSeqNumber(),
+		},
+		Body: pfcpMsg,
+	}
+
+	addr := &net.UDPAddr{
+		IP:   upNodeID.ResolveNodeIdToIp(),
+		Port: pfcpUdp.PFCP_PORT,
+	}
+
+	udp.SendPfcp(message, addr)
+}
+
 func SendHeartbeatResponse(addr *net.UDPAddr, seq uint32) {
 	pfcpMsg := pfcp.HeartbeatResponse{
 		RecoveryTimeStamp: &pfcpType.RecoveryTimeStamp{
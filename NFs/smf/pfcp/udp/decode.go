@@ -0,0 +1,113 @@
+package udp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/free5gc/pfcp"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/pfcp/pfcpUdp"
+)
+
+const (
+	ieTypeUserPlanePathFailureReport = 102
+	ieTypeRemoteGTPUPeer             = 103
+)
+
+// readFrom reads a PFCP message like pfcpUdp.PfcpServer.ReadFrom, except that the User Plane Path Failure Report
+// of the PFCP Node Report Request is decoded by Unmarshal
+func readFrom(p *pfcpUdp.PfcpServer, msg *pfcp.Message) (*net.UDPAddr, error) {
+	buf := make([]byte, pfcpUdp.PFCP_MAX_UDP_LEN)
+	n, addr, err := p.Conn.ReadFromUDP(buf)
+	if err != nil {
+		return addr, err
+	}
+
+	if err = Unmarshal(msg, buf[:n]); err != nil {
+		return addr, err
+	}
+
+	if msg.IsRequest() {
+		tx, err := p.FindTransaction(msg, addr)
+		if err != nil {
+			return addr, err
+		} else if tx != nil {
+			tx.EventChannel <- pfcp.ReceiveResendRequest
+			return addr, fmt.Errorf("Receive resend PFCP request")
+		}
+	} else if msg.IsResponse() {
+		tx, err := p.FindTransaction(msg, p.Conn.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			return addr, err
+		}
+		tx.EventChannel <- pfcp.ReceiveValidResponse
+	}
+	return addr, nil
+}
+
+// Unmarshal decodes the PFCP message, the PFCP library cannot decode the grouped User Plane Path Failure Report IE,
+// so it is cut from the PFCP Node Report Request and kept raw in the UserPlanePathFailureReport of the body
+func Unmarshal(msg *pfcp.Message, data []byte) error {
+	const headerLen = 8
+	if len(data) < headerLen || pfcp.MessageType(data[1]) != pfcp.PFCP_NODE_REPORT_REQUEST || data[0]&0x01 != 0 {
+		return msg.Unmarshal(data)
+	}
+
+	var failureReport []byte
+	stripped := append(make([]byte, 0, len(data)), data[:headerLen]...)
+	for idx := headerLen; idx < len(data); {
+		if idx+4 > len(data) {
+			return fmt.Errorf("Inadequate IE header length: %d", len(data)-idx)
+		}
+		ieType := binary.BigEndian.Uint16(data[idx:])
+		ieEnd := idx + 4 + int(binary.BigEndian.Uint16(data[idx+2:]))
+		if ieEnd > len(data) {
+			return fmt.Errorf("Inadequate IE[%d] length: %d", ieType, len(data)-idx)
+		}
+		if ieType == ieTypeUserPlanePathFailureReport {
+			failureReport = append(failureReport, data[idx+4:ieEnd]...)
+		} else {
+			stripped = append(stripped, data[idx:ieEnd]...)
+		}
+		idx = ieEnd
+	}
+	binary.BigEndian.PutUint16(stripped[2:], uint16(len(stripped)-4))
+
+	if err := msg.Unmarshal(stripped); err != nil {
+		return err
+	}
+	if failureReport != nil {
+		body := msg.Body.(pfcp.PFCPNodeReportRequest)
+		body.UserPlanePathFailureReport = &pfcpType.UserPlanePathFailureReport{
+			UserPlanePathFailureReportdata: failureReport,
+		}
+		msg.Body = body
+	}
+	return nil
+}
+
+// RemoteGTPUPeers returns the remote GTP-U peers of the User Plane Path Failure Report kept raw by Unmarshal
+func RemoteGTPUPeers(report *pfcpType.UserPlanePathFailureReport) ([]pfcpType.RemoteGTPUPeer, error) {
+	var peers []pfcpType.RemoteGTPUPeer
+	data := report.UserPlanePathFailureReportdata
+	for idx := 0; idx < len(data); {
+		if idx+4 > len(data) {
+			return nil, fmt.Errorf("Inadequate IE header length: %d", len(data)-idx)
+		}
+		ieType := binary.BigEndian.Uint16(data[idx:])
+		ieEnd := idx + 4 + int(binary.BigEndian.Uint16(data[idx+2:]))
+		if ieEnd > len(data) {
+			return nil, fmt.Errorf("Inadequate IE[%d] length: %d", ieType, len(data)-idx)
+		}
+		if ieType == ieTypeRemoteGTPUPeer {
+			var peer pfcpType.RemoteGTPUPeer
+			if err := peer.UnmarshalBinary(data[idx+4 : ieEnd]); err != nil {
+				return nil, err
+			}
+			peers = append(peers, peer)
+		}
+		idx = ieEnd
+	}
+	return peers, nil
+}
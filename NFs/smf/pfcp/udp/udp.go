@@ -29,7 +29,7 @@ func Run(Dispatch func(*pfcpUdp.Message)) {
 	go func(p *pfcpUdp.PfcpServer) {
 		for {
 			var pfcpMessage pfcp.Message
-			remoteAddr, err := p.ReadFrom(&pfcpMessage)
+			remoteAddr, err := readFrom(p, &pfcpMessage)
 			if err != nil {
 				if err.Error() == "Receive resend PFCP request" {
 					logger.PfcpLog.Infoln(err)
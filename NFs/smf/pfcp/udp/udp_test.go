@@ -60,3 +60,37 @@ func TestRun(t *testing.T) {
 
 	time.Sleep(300 * time.Millisecond)
 }
+
+func TestUnmarshalNodeReportRequest(t *testing.T) {
+	ies := []byte{
+		0x00, 0x3c, 0x00, 0x05, 0x00, 192, 168, 1, 1, // Node ID
+		0x00, 0x65, 0x00, 0x01, 0x01, // Node Report Type: UPFR
+		0x00, 0x66, 0x00, 0x1e, // User Plane Path Failure Report
+		0x00, 0x67, 0x00, 0x05, 0x02, 10, 200, 200, 1, // Remote GTP-U Peer: IPv4
+		0x00, 0x67, 0x00, 0x11, 0x01, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, // IPv6
+	}
+	data := append([]byte{0x20, 0x0c, 0x00, byte(4 + len(ies)), 0x00, 0x00, 0x07, 0x00}, ies...)
+
+	var msg pfcp.Message
+	require.NoError(t, udp.Unmarshal(&msg, data))
+	require.Equal(t, uint32(7), msg.Header.SequenceNumber)
+
+	req, ok := msg.Body.(pfcp.PFCPNodeReportRequest)
+	require.True(t, ok)
+	require.Equal(t, net.ParseIP("192.168.1.1").To4(), net.IP(req.NodeID.NodeIdValue))
+	require.True(t, req.NodeReportType.Upfr)
+	require.NotNil(t, req.UserPlanePathFailureReport)
+
+	peers, err := udp.RemoteGTPUPeers(req.UserPlanePathFailureReport)
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+	require.True(t, peers[0].V4)
+	require.Equal(t, net.ParseIP("10.200.200.1").To4(), peers[0].Ipv4Address)
+	require.True(t, peers[1].V6)
+	require.Equal(t, net.ParseIP("2001:db8::1"), peers[1].Ipv6Address)
+
+	_, err = udp.RemoteGTPUPeers(&pfcpType.UserPlanePathFailureReport{
+		UserPlanePathFailureReportdata: []byte{0x00, 0x67, 0x00, 0x05, 0x02},
+	})
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package producer
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/free5gc/http_wrapper"
@@ -22,6 +23,7 @@ func HandleSMPolicyUpdateNotify(smContextRef string, request models.SmPolicyNoti
 
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
 
 	if smContext.SMContextState != smf_context.Active {
 		// Wait till the state becomes Active again
@@ -35,8 +37,8 @@ func HandleSMPolicyUpdateNotify(smContextRef string, request models.SmPolicyNoti
 	//[200 OK] array(PartialSuccessReport)
 	//[400 Bad Request] ErrorReport
 	httpResponse := http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
-	if err := ApplySmPolicyFromDecision(smContext, decision); err != nil {
-		logger.PduSessLog.Errorf("apply sm policy decision error: %+v", err)
+	if err := applySmPolicyUpdate(smContext, decision); err != nil {
+		logger.PduSessLog.Errorf("%+v", err)
 		// TODO: Fill the error body
 		httpResponse.Status = http.StatusBadRequest
 	}
@@ -44,6 +46,22 @@ func HandleSMPolicyUpdateNotify(smContextRef string, request models.SmPolicyNoti
 	return httpResponse
 }
 
+// applySmPolicyUpdate applies the SM policy decision the PCF updates, notifies the QoS change and inserts the PSA of
+// the new traffic steering paths, the caller holds the SMLock
+func applySmPolicyUpdate(smContext *smf_context.SMContext, decision *models.SmPolicyDecision) error {
+	qosBeforeUpdate := takeQosSnapshot(smContext)
+	if err := ApplySmPolicyFromDecision(smContext, decision); err != nil {
+		return fmt.Errorf("apply sm policy decision error: %+v", err)
+	}
+	NotifyQosChange(smContext, qosBeforeUpdate.qosFlowChanges(smContext))
+	if smf_context.SMF_Self().ULCLSupport && smContext.AddTrafficSteeringPaths() {
+		if err := AddPSAForTrafficSteering(smContext); err != nil {
+			return fmt.Errorf("add PSA for traffic steering error: %+v", err)
+		}
+	}
+	return nil
+}
+
 func handleSessionRule(smContext *smf_context.SMContext, id string, sessionRuleModel *models.SessionRule) {
 	if sessionRuleModel == nil {
 		logger.PduSessLog.Debugf("Delete SessionRule[%s]", id)
@@ -61,10 +79,75 @@ func handleSessionRule(smContext *smf_context.SMContext, id string, sessionRuleM
 	}
 }
 
+func handlePccRule(smContext *smf_context.SMContext, id string, pccRuleModel *models.PccRule) {
+	if pccRuleModel == nil {
+		logger.PduSessLog.Debugf("Delete PccRule[%s]", id)
+		if pccRule, exist := smContext.PCCRules[id]; exist {
+			if tcData, exist := smContext.TrafficControlPool[pccRule.RefTrafficControlData()]; exist {
+				tcData.DeleteRefedPCCRules(id)
+			}
+			if pccRule.Datapath != nil {
+				RemovePSAForTrafficSteering(smContext, pccRule.Datapath)
+			}
+		}
+		delete(smContext.PCCRules, id)
+	} else {
+		logger.PduSessLog.Debugf("Install PccRule[%s]", id)
+		pccRule := smf_context.NewPCCRuleFromModel(pccRuleModel)
+		// the data path steering the traffic of the PCC rule is kept on the modification
+		if oldPCCRule, exist := smContext.PCCRules[id]; exist {
+			pccRule.Datapath = oldPCCRule.Datapath
+		}
+		if tcData, exist := smContext.TrafficControlPool[pccRule.RefTrafficControlData()]; exist {
+			tcData.AddRefedPCCRules(id)
+		}
+		smContext.PCCRules[id] = pccRule
+	}
+}
+
+func handleTrafficControlData(smContext *smf_context.SMContext, id string, tcModel *models.TrafficControlData) {
+	if tcModel == nil {
+		logger.PduSessLog.Debugf("Delete TrafficControlData[%s]", id)
+		delete(smContext.TrafficControlPool, id)
+		return
+	}
+	logger.PduSessLog.Debugf("Install TrafficControlData[%s]", id)
+	tcData := smf_context.NewTrafficControlDataFromModel(tcModel)
+	if oldTcData, exist := smContext.TrafficControlPool[id]; exist {
+		for pccRuleID := range oldTcData.RefedPCCRules() {
+			tcData.AddRefedPCCRules(pccRuleID)
+		}
+	}
+	smContext.TrafficControlPool[id] = tcData
+}
+
 func ApplySmPolicyFromDecision(smContext *smf_context.SMContext, decision *models.SmPolicyDecision) error {
 	logger.PduSessLog.Traceln("In ApplySmPolicyFromDecision")
 	var err error
 	smContext.SMContextState = smf_context.ModificationPending
+	for id, qosData := range decision.QosDecs {
+		if qosData == nil {
+			delete(smContext.QosDecisions, id)
+		} else {
+			smContext.QosDecisions[id] = qosData
+		}
+	}
+	for id, tcModel := range decision.TraffContDecs {
+		handleTrafficControlData(smContext, id, tcModel)
+	}
+	for id, pccRuleModel := range decision.PccRules {
+		handlePccRule(smContext, id, pccRuleModel)
+	}
+	for id, umData := range decision.UmDecs {
+		if umData == nil {
+			delete(smContext.UsageMonitoringDecs, id)
+		} else {
+			smContext.UsageMonitoringDecs[id] = umData
+		}
+	}
+	if decision.PolicyCtrlReqTriggers != nil {
+		smContext.PolicyCtrlReqTriggers = decision.PolicyCtrlReqTriggers
+	}
 	selectedSessionRule := smContext.SelectedSessionRule()
 	if selectedSessionRule == nil { // No active session rule
 		// Update session rules from decision
@@ -0,0 +1,80 @@
+package producer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+)
+
+func TestHandleSMPolicyUpdateNotifyPccRules(t *testing.T) {
+	smContext := smf_context.NewSMContext("imsi-208930000000042", 2)
+	defer smf_context.RemoveSMContext(smContext.Ref)
+	smContext.SMContextState = smf_context.Active
+	smContext.Tunnel = smf_context.NewUPTunnel()
+
+	// the PCC rule steering the traffic is installed with its traffic control data
+	rsp := HandleSMPolicyUpdateNotify(smContext.Ref, models.SmPolicyNotification{
+		SmPolicyDecision: &models.SmPolicyDecision{
+			PccRules: map[string]*models.PccRule{
+				"PccRule-1": {
+					PccRuleId:  "PccRule-1",
+					Precedence: 10,
+					FlowInfos:  []models.FlowInformation{{FlowDescription: "permit out ip from 10.70.0.0/16 to any"}},
+					RefQosData: []string{"QosData-1"},
+					RefTcData:  []string{"TcData-1"},
+				},
+			},
+			QosDecs:       map[string]*models.QosData{"QosData-1": {QosId: "QosData-1", Var5qi: 9}},
+			TraffContDecs: map[string]*models.TrafficControlData{"TcData-1": {TcId: "TcData-1"}},
+		},
+	})
+	require.Equal(t, http.StatusNoContent, rsp.Status)
+	pccRule := smContext.PCCRules["PccRule-1"]
+	require.NotNil(t, pccRule)
+	require.Equal(t, "QosData-1", pccRule.RefQosData())
+	require.Equal(t, "TcData-1", pccRule.RefTrafficControlData())
+	require.Contains(t, smContext.TrafficControlPool["TcData-1"].RefedPCCRules(), "PccRule-1")
+
+	// the data path steering the traffic of the PCC rule is kept on the modification
+	steeringPath := smf_context.NewDataPath()
+	smContext.Tunnel.AddDataPath(steeringPath)
+	pccRule.Datapath = steeringPath
+	rsp = HandleSMPolicyUpdateNotify(smContext.Ref, models.SmPolicyNotification{
+		SmPolicyDecision: &models.SmPolicyDecision{
+			PccRules: map[string]*models.PccRule{
+				"PccRule-1": {
+					PccRuleId:  "PccRule-1",
+					Precedence: 20,
+					FlowInfos:  []models.FlowInformation{{FlowDescription: "permit out ip from 10.80.0.0/16 to any"}},
+					RefQosData: []string{"QosData-1"},
+					RefTcData:  []string{"TcData-1"},
+				},
+			},
+		},
+	})
+	require.Equal(t, http.StatusNoContent, rsp.Status)
+	pccRule = smContext.PCCRules["PccRule-1"]
+	require.Equal(t, int32(20), pccRule.Precedence)
+	require.Equal(t, steeringPath, pccRule.Datapath)
+	require.Len(t, smContext.Tunnel.DataPathPool, 1)
+
+	// the deleted PCC rule releases its traffic control data and the data path steering its traffic
+	rsp = HandleSMPolicyUpdateNotify(smContext.Ref, models.SmPolicyNotification{
+		SmPolicyDecision: &models.SmPolicyDecision{
+			PccRules: map[string]*models.PccRule{"PccRule-1": nil},
+		},
+	})
+	require.Equal(t, http.StatusNoContent, rsp.Status)
+	require.NotContains(t, smContext.PCCRules, "PccRule-1")
+	require.NotContains(t, smContext.TrafficControlPool["TcData-1"].RefedPCCRules(), "PccRule-1")
+	require.Empty(t, smContext.Tunnel.DataPathPool)
+
+	rsp = HandleSMPolicyUpdateNotify("urn:uuid:unknown", models.SmPolicyNotification{
+		SmPolicyDecision: &models.SmPolicyDecision{},
+	})
+	require.Equal(t, http.StatusBadRequest, rsp.Status)
+}
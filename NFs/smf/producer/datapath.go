@@ -121,3 +121,45 @@ func UpdateDataPathToUPF(smContext *smf_context.SMContext, oldDataPath, updateDa
 		SendPFCPRule(smContext, updateDataPath)
 	}
 }
+
+// RecoverPFCPSessions establishes the PFCP sessions of all SM contexts on the UPF again after the UPF restarts
+func RecoverPFCPSessions(upf *smf_context.UPF) {
+	nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+	for _, smContext := range smf_context.SMContexts() {
+		smContext.SMLock.Lock()
+		if sessionContext, exist := smContext.PFCPContext[nodeIP]; exist {
+			pdrList := make([]*smf_context.PDR, 0, len(sessionContext.PDRs))
+			farList := make([]*smf_context.FAR, 0, len(sessionContext.PDRs))
+			barList := make([]*smf_context.BAR, 0)
+			qerList := make([]*smf_context.QER, 0)
+			for _, pdr := range sessionContext.PDRs {
+				if pdr.State == smf_context.RULE_REMOVE {
+					continue
+				}
+				pdr.State = smf_context.RULE_INITIAL
+				pdrList = append(pdrList, pdr)
+				if pdr.URR != nil && pdr.URR.State != smf_context.RULE_REMOVE {
+					pdr.URR.State = smf_context.RULE_INITIAL
+				}
+				if pdr.FAR != nil {
+					pdr.FAR.State = smf_context.RULE_INITIAL
+					farList = append(farList, pdr.FAR)
+					if pdr.FAR.BAR != nil {
+						pdr.FAR.BAR.State = smf_context.RULE_INITIAL
+						barList = append(barList, pdr.FAR.BAR)
+					}
+				}
+				for _, qer := range pdr.QER {
+					qer.State = smf_context.RULE_INITIAL
+					qerList = append(qerList, qer)
+				}
+			}
+			sessionContext.RemoteSEID = 0
+			logger.PduSessLog.Infof("Establish PFCP session of PDU session[%s-%02d] on UPF[%s] again",
+				smContext.Supi, smContext.PDUSessionID, nodeIP)
+			pfcp_message.SendPfcpSessionEstablishmentRequest(
+				upf.NodeID, smContext, pdrList, farList, barList, qerList)
+		}
+		smContext.SMLock.Unlock()
+	}
+}
@@ -0,0 +1,310 @@
+package producer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+)
+
+func HandleSmfEventExposureSubscriptionCreate(request models.NsmfEventExposure) *http_wrapper.Response {
+	logger.CtxLog.Infoln("In HandleSmfEventExposureSubscriptionCreate")
+	if problemDetails := validateEventExposureSubscription(&request); problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	subscription := smf_context.NewEventExposureSubscription(request)
+	created := subscription.NsmfEventExposure()
+	logger.CtxLog.Infof("Create SMF Event Exposure Subscription[%s]", created.SubId)
+
+	smfSelf := smf_context.SMF_Self()
+	headers := http.Header{
+		"Location": {fmt.Sprintf("%s://%s:%d/nsmf_event-exposure/v1/subscriptions/%s",
+			smfSelf.URIScheme, smfSelf.RegisterIPv4, smfSelf.SBIPort, created.SubId)},
+	}
+	if request.ImmeRep {
+		go reportCurrentSmfEvents(subscription)
+	}
+	return http_wrapper.NewResponse(http.StatusCreated, headers, created)
+}
+
+func HandleSmfEventExposureSubscriptionGet(subID string) *http_wrapper.Response {
+	logger.CtxLog.Infoln("In HandleSmfEventExposureSubscriptionGet")
+	subscription := smf_context.GetEventExposureSubscription(subID)
+	if subscription == nil {
+		problemDetails := subscriptionNotFound(subID)
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusOK, nil, subscription.NsmfEventExposure())
+}
+
+func HandleSmfEventExposureSubscriptionUpdate(subID string, request models.NsmfEventExposure) *http_wrapper.Response {
+	logger.CtxLog.Infoln("In HandleSmfEventExposureSubscriptionUpdate")
+	subscription := smf_context.GetEventExposureSubscription(subID)
+	if subscription == nil {
+		problemDetails := subscriptionNotFound(subID)
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	if problemDetails := validateEventExposureSubscription(&request); problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	subscription.UpdateSubscription(request)
+	logger.CtxLog.Infof("Update SMF Event Exposure Subscription[%s]", subID)
+	return http_wrapper.NewResponse(http.StatusOK, nil, subscription.NsmfEventExposure())
+}
+
+func HandleSmfEventExposureSubscriptionDelete(subID string) *http_wrapper.Response {
+	logger.CtxLog.Infoln("In HandleSmfEventExposureSubscriptionDelete")
+	if smf_context.GetEventExposureSubscription(subID) == nil {
+		problemDetails := subscriptionNotFound(subID)
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	smf_context.RemoveEventExposureSubscription(subID)
+	logger.CtxLog.Infof("Delete SMF Event Exposure Subscription[%s]", subID)
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
+
+func validateEventExposureSubscription(request *models.NsmfEventExposure) *models.ProblemDetails {
+	var detail string
+	switch {
+	case request.NotifUri == "":
+		detail = "notifUri is missing"
+	case len(request.EventSubs) == 0:
+		detail = "eventSubs is missing"
+	case !request.AnyUeInd && request.Supi == "" && request.Gpsi == "":
+		detail = "one of supi, gpsi or anyUeInd shall be present"
+	}
+	if detail == "" {
+		return nil
+	}
+	return &models.ProblemDetails{
+		Title:  "Malformed request syntax",
+		Status: http.StatusBadRequest,
+		Detail: detail,
+		Cause:  "MANDATORY_IE_MISSING",
+	}
+}
+
+func subscriptionNotFound(subID string) *models.ProblemDetails {
+	return &models.ProblemDetails{
+		Title:  "Subscription Not Found",
+		Status: http.StatusNotFound,
+		Detail: "SMF Event Exposure Subscription[" + subID + "] not found",
+		Cause:  "SUBSCRIPTION_NOT_FOUND",
+	}
+}
+
+// reportCurrentSmfEvents reports the current PLMN, access type and UE IP address of the target PDU sessions
+// of a subscription which requests immediate reporting
+func reportCurrentSmfEvents(subscription *smf_context.EventExposureSubscription) {
+	for _, smContext := range smf_context.SMContexts() {
+		var eventNotifs []smf_context.EventNotification
+		smContext.SMLock.Lock()
+		if subscription.IsTargetOf(smContext) {
+			for _, event := range []models.SmfEvent{
+				models.SmfEvent_PLMN_CH, models.SmfEvent_AC_TY_CH, models.SmfEvent_UE_IP_CH,
+			} {
+				if subscription.EventSubscription(event) != nil {
+					eventNotifs = append(eventNotifs, newSmfEventNotification(smContext, event))
+				}
+			}
+		}
+		smContext.SMLock.Unlock()
+		// the notification is sent without holding the lock of the SM context
+		if len(eventNotifs) > 0 && !sendSmfEventNotification(subscription, eventNotifs) {
+			return
+		}
+	}
+}
+
+func newSmfEventNotification(smContext *smf_context.SMContext, event models.SmfEvent) smf_context.EventNotification {
+	now := time.Now().UTC()
+	eventNotification := smf_context.EventNotification{
+		EventNotification: models.EventNotification{
+			Event:     event,
+			TimeStamp: &now,
+			Supi:      smContext.Supi,
+			Gpsi:      smContext.Gpsi,
+			PduSeId:   smContext.PDUSessionID,
+		},
+	}
+	switch event {
+	case models.SmfEvent_PLMN_CH:
+		eventNotification.PlmnId = smContext.ServingNetwork
+	case models.SmfEvent_AC_TY_CH:
+		eventNotification.AccType = smContext.AnType
+	case models.SmfEvent_UE_IP_CH:
+		if ipv4 := smContext.PDUAddress.To4(); ipv4 != nil {
+			eventNotification.TargetUeIpv4Addr = ipv4.String()
+		}
+		if prefix := smContext.IPv6Prefix(); prefix != nil {
+			eventNotification.TargetUeIpv6Prefix = prefix.String()
+		}
+	}
+	return eventNotification
+}
+
+// sendSmfEventNotification notifies the subscriber of the events, the subscription is removed when it is expired
+// or its reports are used up. It returns false if the subscription is removed
+func sendSmfEventNotification(subscription *smf_context.EventExposureSubscription,
+	eventNotifs []smf_context.EventNotification) bool {
+	nsmfEventExposure := subscription.NsmfEventExposure()
+	subID := nsmfEventExposure.SubId
+	if subscription.IsExpired() {
+		logger.CtxLog.Infof("SMF Event Exposure Subscription[%s] is expired", subID)
+		smf_context.RemoveEventExposureSubscription(subID)
+		return false
+	}
+	ok, usedUp := subscription.UseReport()
+	if usedUp {
+		smf_context.RemoveEventExposureSubscription(subID)
+	}
+	if !ok {
+		return false
+	}
+
+	notification := smf_context.NsmfEventExposureNotification{
+		NotifId:     nsmfEventExposure.NotifId,
+		EventNotifs: eventNotifs,
+	}
+	if err := consumer.SendSmfEventExposureNotification(nsmfEventExposure.NotifUri, notification); err != nil {
+		logger.ConsumerLog.Warnf("Send SMF Event Exposure Notification of Subscription[%s] error: %+v", subID, err)
+	}
+	return !usedUp
+}
+
+// notifySmfEvent notifies the subscribers of the event of the PDU session, fill modifies the notification
+// of each subscription, e.g. for the DNAI change type of the subscription
+func notifySmfEvent(smContext *smf_context.SMContext, event models.SmfEvent,
+	fill func(*smf_context.EventNotification, *models.EventSubscription) bool) {
+	for _, subscription := range smf_context.EventExposureSubscriptionsOf(smContext, event) {
+		eventNotification := newSmfEventNotification(smContext, event)
+		if fill != nil && !fill(&eventNotification, subscription.EventSubscription(event)) {
+			continue
+		}
+		go sendSmfEventNotification(subscription, []smf_context.EventNotification{eventNotification})
+	}
+}
+
+// NotifyPDUSessionRelease notifies the subscribers of PDU_SES_REL of the release of the PDU session
+func NotifyPDUSessionRelease(smContext *smf_context.SMContext) {
+	if !smContext.MarkReleaseNotified() {
+		return
+	}
+	notifySmfEvent(smContext, models.SmfEvent_PDU_SES_REL, nil)
+}
+
+// NotifyPlmnChange notifies the subscribers of PLMN_CH of the new serving PLMN of the PDU session
+func NotifyPlmnChange(smContext *smf_context.SMContext) {
+	notifySmfEvent(smContext, models.SmfEvent_PLMN_CH, nil)
+}
+
+// NotifyAccessTypeChange notifies the subscribers of AC_TY_CH of the new access type of the PDU session
+func NotifyAccessTypeChange(smContext *smf_context.SMContext) {
+	notifySmfEvent(smContext, models.SmfEvent_AC_TY_CH, nil)
+}
+
+// NotifyUeIpChange notifies the subscribers of UE_IP_CH of the change of the IP address or IPv6 prefix of the UE,
+// e.g. the PDU session established again after the relocation of its anchor
+func NotifyUeIpChange(smContext *smf_context.SMContext, sourceUeIp net.IP, sourceUeIpv6Prefix *net.IPNet) {
+	notifySmfEvent(smContext, models.SmfEvent_UE_IP_CH, func(eventNotification *smf_context.EventNotification,
+		_ *models.EventSubscription) bool {
+		if ipv4 := sourceUeIp.To4(); ipv4 != nil {
+			eventNotification.SourceUeIpv4Addr = ipv4.String()
+		}
+		if sourceUeIpv6Prefix != nil {
+			eventNotification.SourceUeIpv6Prefix = sourceUeIpv6Prefix.String()
+		}
+		return true
+	})
+}
+
+// NotifyUpPathChange notifies the subscribers of UP_PATH_CH of the change of the DNAI of the PDU session,
+// the subscribers of the early or late notification only are notified of that change type
+func NotifyUpPathChange(smContext *smf_context.SMContext, sourceDnai, targetDnai string,
+	dnaiChgType models.DnaiChangeType) {
+	notifySmfEvent(smContext, models.SmfEvent_UP_PATH_CH, func(eventNotification *smf_context.EventNotification,
+		eventSubscription *models.EventSubscription) bool {
+		if eventSubscription.DnaiChgType != "" && eventSubscription.DnaiChgType != models.DnaiChangeType_EARLY_LATE &&
+			eventSubscription.DnaiChgType != dnaiChgType {
+			return false
+		}
+		eventNotification.SourceDnai = sourceDnai
+		eventNotification.TargetDnai = targetDnai
+		eventNotification.DnaiChgType = dnaiChgType
+		return true
+	})
+}
+
+// NotifyQosChange notifies the subscribers of QOS_CH of the QoS flows of which the QoS is changed
+func NotifyQosChange(smContext *smf_context.SMContext, qosFlowChanges []smf_context.QosFlowChange) {
+	if len(qosFlowChanges) == 0 {
+		return
+	}
+	notifySmfEvent(smContext, smf_context.SmfEventQosChange, func(eventNotification *smf_context.EventNotification,
+		_ *models.EventSubscription) bool {
+		eventNotification.QosFlowChanges = qosFlowChanges
+		return true
+	})
+}
+
+// qosSnapshot is the QoS of the PDU session compared before and after a SM policy update
+type qosSnapshot struct {
+	defQos       *models.AuthorizedDefaultQos
+	qosDecisions map[string]models.QosData
+}
+
+func takeQosSnapshot(smContext *smf_context.SMContext) qosSnapshot {
+	snapshot := qosSnapshot{qosDecisions: make(map[string]models.QosData)}
+	if sessionRule := smContext.SelectedSessionRule(); sessionRule != nil && sessionRule.AuthDefQos != nil {
+		defQos := *sessionRule.AuthDefQos
+		snapshot.defQos = &defQos
+	}
+	for id, qosData := range smContext.QosDecisions {
+		snapshot.qosDecisions[id] = *qosData
+	}
+	return snapshot
+}
+
+// qosFlowChanges returns the QoS flows of which the 5QI, ARP, GBR or MBR is changed from the snapshot,
+// the default QoS flow is reported without QoS ID
+func (snapshot qosSnapshot) qosFlowChanges(smContext *smf_context.SMContext) []smf_context.QosFlowChange {
+	var changes []smf_context.QosFlowChange
+	if sessionRule := smContext.SelectedSessionRule(); sessionRule != nil && sessionRule.AuthDefQos != nil {
+		defQos := sessionRule.AuthDefQos
+		if snapshot.defQos == nil || snapshot.defQos.Var5qi != defQos.Var5qi ||
+			!reflect.DeepEqual(snapshot.defQos.Arp, defQos.Arp) {
+			changes = append(changes, smf_context.QosFlowChange{
+				Var5qi: defQos.Var5qi,
+				Arp:    defQos.Arp,
+			})
+		}
+	}
+	for id, qosData := range smContext.QosDecisions {
+		if oldQosData, exist := snapshot.qosDecisions[id]; exist && oldQosData.Var5qi == qosData.Var5qi &&
+			oldQosData.GbrUl == qosData.GbrUl && oldQosData.GbrDl == qosData.GbrDl &&
+			oldQosData.MaxbrUl == qosData.MaxbrUl && oldQosData.MaxbrDl == qosData.MaxbrDl &&
+			reflect.DeepEqual(oldQosData.Arp, qosData.Arp) {
+			continue
+		}
+		changes = append(changes, smf_context.QosFlowChange{
+			QosId:   qosData.QosId,
+			Var5qi:  qosData.Var5qi,
+			GbrUl:   qosData.GbrUl,
+			GbrDl:   qosData.GbrDl,
+			MaxbrUl: qosData.MaxbrUl,
+			MaxbrDl: qosData.MaxbrDl,
+			Arp:     qosData.Arp,
+		})
+	}
+	return changes
+}
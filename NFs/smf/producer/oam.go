@@ -17,9 +17,11 @@ type PDUSessionInfo struct {
 	Sd           string
 	AnType       models.AccessType
 	PDUAddress   string
+	PDUAddressV6 string
 	SessionRule  models.SessionRule
 	UpCnxState   models.UpCnxState
 	Tunnel       context.UPTunnel
+	Usage        context.Usage
 }
 
 func HandleOAMGetUEPDUSessionInfo(smContextRef string) *http_wrapper.Response {
@@ -45,7 +47,9 @@ func HandleOAMGetUEPDUSessionInfo(smContextRef string) *http_wrapper.Response {
 			Sd:           smContext.Snssai.Sd,
 			AnType:       smContext.AnType,
 			PDUAddress:   smContext.PDUAddress.String(),
+			PDUAddressV6: smContext.PDUAddressV6.String(),
 			UpCnxState:   smContext.UpCnxState,
+			Usage:        smContext.GetUsage(),
 			// Tunnel: context.UPTunnel{
 			// 	//UpfRoot:  smContext.Tunnel.UpfRoot,
 			// 	ULCLRoot: smContext.Tunnel.UpfRoot,
@@ -54,3 +58,42 @@ func HandleOAMGetUEPDUSessionInfo(smContextRef string) *http_wrapper.Response {
 	}
 	return httpResponse
 }
+
+func HandleOAMGetSliceUsage() *http_wrapper.Response {
+	httpResponse := &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body:   context.GetSliceUsages(),
+	}
+	return httpResponse
+}
+
+func HandleOAMGetUeIPUsage() *http_wrapper.Response {
+	httpResponse := &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body:   context.GetUeIPUsages(),
+	}
+	return httpResponse
+}
+
+// PSARelocationRequest is the UPF change trigger of the OAM relocating the PDU session anchor to a UPF serving the DNAI
+type PSARelocationRequest struct {
+	Dnai string `json:"dnai"`
+}
+
+func HandleOAMRelocatePDUSessionAnchor(smContextRef string, request PSARelocationRequest) *http_wrapper.Response {
+	smContext := context.GetSMContext(smContextRef)
+	if smContext == nil {
+		problemDetails := &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "CONTEXT_NOT_FOUND",
+		}
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+
+	if problemDetails := RelocatePDUSessionAnchor(smContext, request.Dnai); problemDetails != nil {
+		return http_wrapper.NewResponse(int(problemDetails.Status), nil, problemDetails)
+	}
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
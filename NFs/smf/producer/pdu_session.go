@@ -10,7 +10,6 @@ import (
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi"
-	"github.com/free5gc/openapi/Namf_Communication"
 	"github.com/free5gc/openapi/Nsmf_PDUSession"
 	"github.com/free5gc/openapi/Nudm_SubscriberDataManagement"
 	"github.com/free5gc/openapi/models"
@@ -23,6 +22,14 @@ import (
 
 var globalTEID uint32 = 1
 
+// pduTypeDenied rejects the PDU session of the IP version no UE subnet of the DNN serves
+var pduTypeDenied = models.ProblemDetails{
+	Title:  "PDU Session Type Denied",
+	Status: http.StatusForbidden,
+	Detail: "The requested PDU session type is not supported by the DNN.",
+	Cause:  "PDUTYPE_DENIED",
+}
+
 func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http_wrapper.Response {
 	// GSM State
 	// PDU Session Establishment Accept/Reject
@@ -56,6 +63,7 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
 
 	// DNN Information from config
 	smContext.DNNInfo = smf_context.RetrieveDnnInformation(*createData.SNssai, createData.Dnn)
@@ -73,13 +81,6 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 		logger.PduSessLog.Infoln("Send NF Discovery Serving UDM Successfully")
 	}
 
-	// IP Allocation
-	if ip, err := smContext.DNNInfo.UeIPAllocator.Allocate(); err != nil {
-		logger.PduSessLog.Errorln("failed allocate IP address for this SM:", err)
-	} else {
-		smContext.PDUAddress = ip
-	}
-
 	smPlmnID := createData.Guami.PlmnId
 
 	smDataParams := &Nudm_SubscriberDataManagement.GetSmDataParamOpts{
@@ -110,6 +111,20 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 	establishmentRequest := m.PDUSessionEstablishmentRequest
 	smContext.HandlePDUSessionEstablishmentRequest(establishmentRequest)
 
+	// IP Allocation, after the PDU session type is selected
+	if smContext.DNNInfo != nil {
+		if cause, err := smContext.AllocatePDUAddress(); err != nil {
+			logger.PduSessLog.Errorln("failed allocate IP address for this SM:", err)
+			smContext.SMContextState = smf_context.InActive
+			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+			problemDetails := &Nsmf_PDUSession.InsufficientResourceSliceDnn
+			if cause == nasMessage.Cause5GSMUnknownPDUSessionType {
+				problemDetails = &pduTypeDenied
+			}
+			return establishmentRejectResponse(smContext, cause, problemDetails)
+		}
+	}
+
 	logger.PduSessLog.Infof("PCF Selection for SMContext SUPI[%s] PDUSessionID[%d]\n",
 		smContext.Supi, smContext.PDUSessionID)
 	if err := smContext.PCFSelection(); err != nil {
@@ -136,6 +151,15 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 			Sd:  createData.SNssai.Sd,
 		},
 	}
+	upfSelectionParams.SetUeLocation(smContext.UeLocation)
+
+	// PDU session established again after the relocation of its anchor (TS 23.502 4.3.5.1, 4.3.5.2)
+	relocatedAnchor := smContext.TakeRelocatedAnchor()
+	if relocatedAnchor != nil {
+		logger.PduSessLog.Infof("SUPI[%s] PDU session is anchored in relocated DNAI[%s]",
+			createData.Supi, relocatedAnchor.Dnai)
+		upfSelectionParams.Dnai = relocatedAnchor.Dnai
+	}
 
 	if smf_context.SMF_Self().ULCLSupport && smf_context.CheckUEHasPreConfig(createData.Supi) {
 		logger.PduSessLog.Infof("SUPI[%s] has pre-config route", createData.Supi)
@@ -169,6 +193,11 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 			}
 			consumer.SendSessionQOF(smContext.SessionInfo)
 			globalTEID++
+
+			// the ULCL is inserted after the default path is established
+			if smf_context.SMF_Self().ULCLSupport {
+				smContext.AddTrafficSteeringPaths()
+			}
 		}
 	}
 
@@ -178,54 +207,17 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 		logger.PduSessLog.Warnf("Data Path not found\n")
 		logger.PduSessLog.Warnln("Selection Parameter: ", upfSelectionParams.String())
 
-		var httpResponse *http_wrapper.Response
-		if buf, err := smf_context.
-			BuildGSMPDUSessionEstablishmentReject(
-				smContext,
-				nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN); err != nil {
-			httpResponse = &http_wrapper.Response{
-				Header: nil,
-				Status: http.StatusForbidden,
-				Body: models.PostSmContextsErrorResponse{
-					JsonData: &models.SmContextCreateError{
-						Error:   &Nsmf_PDUSession.InsufficientResourceSliceDnn,
-						N1SmMsg: &models.RefToBinaryData{ContentId: "n1SmMsg"},
-					},
-				},
-			}
-		} else {
-			httpResponse = &http_wrapper.Response{
-				Header: nil,
-				Status: http.StatusForbidden,
-				Body: models.PostSmContextsErrorResponse{
-					JsonData: &models.SmContextCreateError{
-						Error:   &Nsmf_PDUSession.InsufficientResourceSliceDnn,
-						N1SmMsg: &models.RefToBinaryData{ContentId: "n1SmMsg"},
-					},
-					BinaryDataN1SmMessage: buf,
-				},
-			}
-		}
-
-		return httpResponse
+		return establishmentRejectResponse(smContext, nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
+			&Nsmf_PDUSession.InsufficientResourceSliceDnn)
 	}
 
-	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
-		logger.PduSessLog.Warnf("Send NF Discovery Serving AMF Error[%v]", err)
-	} else if problemDetails != nil {
-		logger.PduSessLog.Warnf("Send NF Discovery Serving AMF Problem[%+v]", problemDetails)
-	} else {
-		logger.PduSessLog.Traceln("Send NF Discovery Serving AMF successfully")
-	}
+	selectServingAMF(smContext)
+	SendPFCPRules(smContext)
 
-	for _, service := range *smContext.AMFProfile.NfServices {
-		if service.ServiceName == models.ServiceName_NAMF_COMM {
-			communicationConf := Namf_Communication.NewConfiguration()
-			communicationConf.SetBasePath(service.ApiPrefix)
-			smContext.CommunicationClient = Namf_Communication.NewAPIClient(communicationConf)
-		}
+	// the UE IP address is allocated again by the new PDU session anchor
+	if relocatedAnchor != nil {
+		NotifyUeIpChange(smContext, relocatedAnchor.SourceUeIpv4Addr, relocatedAnchor.SourceUeIpv6Prefix)
 	}
-	SendPFCPRules(smContext)
 
 	response.JsonData = smContext.BuildCreatedData()
 	httpResponse := &http_wrapper.Response{
@@ -240,6 +232,28 @@ func HandlePDUSessionSMContextCreate(request models.PostSmContextsRequest) *http
 	// TODO: UECM registration
 }
 
+// establishmentRejectResponse rejects the PDU session establishment with the 5GSM cause in the PDU Session
+// Establishment Reject
+func establishmentRejectResponse(smContext *smf_context.SMContext, cause uint8,
+	problemDetails *models.ProblemDetails) *http_wrapper.Response {
+	errorResponse := models.PostSmContextsErrorResponse{
+		JsonData: &models.SmContextCreateError{
+			Error:   problemDetails,
+			N1SmMsg: &models.RefToBinaryData{ContentId: "n1SmMsg"},
+		},
+	}
+	if buf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext, cause); err != nil {
+		logger.PduSessLog.Errorf("Build GSM PDUSessionEstablishmentReject failed: %+v", err)
+	} else {
+		errorResponse.BinaryDataN1SmMessage = buf
+	}
+	return &http_wrapper.Response{
+		Header: nil,
+		Status: http.StatusForbidden,
+		Body:   errorResponse,
+	}
+}
+
 func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmContextRequest) *http_wrapper.Response {
 	// GSM State
 	// PDU Session Modification Reject(Cause Value == 43 || Cause Value != 43)/Complete
@@ -269,6 +283,7 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
 
 	var sendPFCPDelete, sendPFCPModification bool
 	var response models.UpdateSmContextResponse
@@ -303,7 +318,8 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 			}
 
 			smContext.HandlePDUSessionReleaseRequest(m.PDUSessionReleaseRequest)
-			if buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+			if buf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext,
+				nasMessage.Cause5GSMRegularDeactivation); err != nil {
 				logger.PduSessLog.Errorf("Build GSM PDUSessionReleaseCommand failed: %+v", err)
 			} else {
 				response.BinaryDataN1SmMessage = buf
@@ -320,6 +336,7 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 				response.BinaryDataN2SmInformation = buf
 			}
 
+			smContext.ReleaseQoSFlows()
 			deletedPFCPNode := make(map[string]bool)
 			smContext.PendingUPF = make(smf_context.PendingUPF)
 			for _, dataPath := range smContext.Tunnel.DataPathPool {
@@ -341,6 +358,66 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 			sendPFCPDelete = true
 			smContext.SMContextState = smf_context.PFCPModification
 			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		case nas.MsgTypePDUSessionModificationRequest:
+			if smContext.SMContextState != smf_context.Active {
+				// Wait till the state becomes Active again
+				// TODO: implement sleep wait in concurrent architecture
+				logger.PduSessLog.Infoln("The SMContext State should be Active State")
+				logger.PduSessLog.Infoln("SMContext state: ", smContext.SMContextState.String())
+			}
+
+			ruleLists, cause := handlePDUSessionModificationRequest(smContext, m.PDUSessionModificationRequest)
+			if cause != 0 {
+				smContext.SMContextState = smf_context.Active
+				problemDetail := models.ProblemDetails{
+					Status: http.StatusForbidden,
+					Cause:  "UE_REQUESTED_MODIFICATION_REJECTED",
+				}
+				errResponse := models.UpdateSmContextErrorResponse{
+					JsonData: &models.SmContextUpdateError{
+						Error: &problemDetail,
+					},
+				}
+				if buf, err := smf_context.BuildGSMPDUSessionModificationReject(smContext, cause); err != nil {
+					logger.PduSessLog.Errorf("Build GSM PDUSessionModificationReject failed: %+v", err)
+				} else {
+					errResponse.BinaryDataN1SmMessage = buf
+				}
+				errResponse.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionModificationReject"}
+				return &http_wrapper.Response{
+					Status: int(problemDetail.Status),
+					Body:   errResponse,
+				}
+			}
+			if buf, err := smf_context.BuildGSMPDUSessionModificationCommand(smContext); err != nil {
+				logger.PduSessLog.Errorf("Build GSM PDUSessionModificationCommand failed: %+v", err)
+			} else {
+				response.BinaryDataN1SmMessage = buf
+			}
+			response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionModificationCommand"}
+
+			if buf, err := smf_context.BuildPDUSessionResourceModifyRequestTransfer(smContext); err != nil {
+				logger.PduSessLog.Errorf("Build PDUSessionResourceModifyRequestTransfer failed: %+v", err)
+			} else {
+				response.BinaryDataN2SmInformation = buf
+				response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUSessionResourceModifyRequestTransfer"}
+				response.JsonData.N2SmInfoType = models.N2SmInfoType_PDU_RES_MOD_REQ
+			}
+
+			// the state is set before the requests are sent for the PFCP responses to be delivered
+			smContext.SMContextState = smf_context.PFCPModification
+			if !sendQoSFlowRules(smContext, ruleLists) {
+				smContext.SMContextState = smf_context.ModificationPending
+			}
+			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		case nas.MsgTypePDUSessionModificationComplete:
+			smContext.HandlePDUSessionModificationComplete(m.PDUSessionModificationComplete)
+			smContext.SMContextState = smf_context.ModificationPending
+			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		case nas.MsgTypePDUSessionModificationCommandReject:
+			smContext.HandlePDUSessionModificationCommandReject(m.PDUSessionModificationCommandReject)
+			smContext.SMContextState = smf_context.ModificationPending
+			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
 		case nas.MsgTypePDUSessionReleaseComplete:
 			if smContext.SMContextState != smf_context.InActivePending {
 				// Wait till the state becomes Active again
@@ -354,6 +431,7 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 			logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
 			response.JsonData.UpCnxState = models.UpCnxState_DEACTIVATED
 			smf_context.RemoveSMContext(smContext.Ref)
+			NotifyPDUSessionRelease(smContext)
 			problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri)
 			if problemDetails != nil || err != nil {
 				if problemDetails != nil {
@@ -480,6 +558,23 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 		sendPFCPModification = true
 		smContext.SMContextState = smf_context.PFCPModification
 		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	case models.N2SmInfoType_PDU_RES_MOD_RSP:
+		if failedQFIs, err := smf_context.
+			HandlePDUSessionResourceModifyResponseTransfer(body.BinaryDataN2SmInformation, smContext); err != nil {
+			logger.PduSessLog.Errorf("Handle PDUSessionResourceModifyResponseTransfer failed: %+v", err)
+		} else if len(failedQFIs) > 0 {
+			logger.PduSessLog.Warnf("NG-RAN failed to add or modify QoS flows %v", failedQFIs)
+		}
+		if smContext.SMContextState != smf_context.PFCPModification {
+			smContext.SMContextState = smf_context.ModificationPending
+		}
+		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	case models.N2SmInfoType_PDU_RES_MOD_FAIL:
+		logger.PduSessLog.Warnf("NG-RAN failed to modify PDU Session[%s-%02d]", smContext.Supi, smContext.PDUSessionID)
+		if smContext.SMContextState != smf_context.PFCPModification {
+			smContext.SMContextState = smf_context.ModificationPending
+		}
+		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
 	case models.N2SmInfoType_PDU_RES_REL_RSP:
 		logger.PduSessLog.Infoln("[SMF] N2 PDUSession Release Complete ")
 		if smContext.PDUSessionRelease_DUE_TO_DUP_PDU_ID {
@@ -496,6 +591,7 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 
 			smContext.PDUSessionRelease_DUE_TO_DUP_PDU_ID = false
 			smf_context.RemoveSMContext(smContext.Ref)
+			NotifyPDUSessionRelease(smContext)
 			problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri)
 			if problemDetails != nil || err != nil {
 				if problemDetails != nil {
@@ -600,6 +696,9 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 		smContext.SMContextState = smf_context.ModificationPending
 		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
 		smContext.HoState = models.HoState_PREPARING
+		if smContextUpdateData.TargetServingNfId != "" {
+			logger.PduSessLog.Infof("Handover to target AMF[%s]", smContextUpdateData.TargetServingNfId)
+		}
 		if err := smf_context.HandleHandoverRequiredTransfer(body.BinaryDataN2SmInformation, smContext); err != nil {
 			logger.PduSessLog.Errorf("Handle HandoverRequiredTransfer failed: %+v", err)
 		}
@@ -657,6 +756,30 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 		response.JsonData.HoState = models.HoState_COMPLETED
 	}
 
+	// AMF change on N2 handover (TS 23.502 4.9.1.3.3 step 6b) or on
+	// registration with AMF change (TS 23.502 4.2.2.2.2 step 17)
+	if smContextUpdateData.ServingNfId != "" && smContextUpdateData.ServingNfId != smContext.ServingNfId {
+		logger.PduSessLog.Infof("Serving AMF changed from [%s] to [%s]",
+			smContext.ServingNfId, smContextUpdateData.ServingNfId)
+		smContext.ServingNfId = smContextUpdateData.ServingNfId
+		if smContextUpdateData.ServingNetwork != nil {
+			plmnChanged := smContext.ServingNetwork == nil ||
+				*smContext.ServingNetwork != *smContextUpdateData.ServingNetwork
+			smContext.ServingNetwork = smContextUpdateData.ServingNetwork
+			if plmnChanged {
+				NotifyPlmnChange(smContext)
+			}
+		}
+		selectServingAMF(smContext)
+	}
+
+	// PDU session moved between 3GPP and non-3GPP access (TS 23.502 4.9.2)
+	if smContextUpdateData.AnType != "" && smContextUpdateData.AnType != smContext.AnType {
+		logger.PduSessLog.Infof("Access type changed from [%s] to [%s]", smContext.AnType, smContextUpdateData.AnType)
+		smContext.AnType = smContextUpdateData.AnType
+		NotifyAccessTypeChange(smContext)
+	}
+
 	switch smContextUpdateData.Cause {
 	case models.Cause_REL_DUE_TO_DUPLICATE_SESSION_ID:
 		//* release PDU Session Here
@@ -677,6 +800,7 @@ func HandlePDUSessionSMContextUpdate(smContextRef string, body models.UpdateSmCo
 			logger.PduSessLog.Error(err)
 		}
 
+		smContext.ReleaseQoSFlows()
 		deletedPFCPNode := make(map[string]bool)
 		smContext.PendingUPF = make(smf_context.PendingUPF)
 		for _, dataPath := range smContext.Tunnel.DataPathPool {
@@ -808,8 +932,10 @@ func HandlePDUSessionSMContextRelease(smContextRef string, body models.ReleaseSm
 	smContext := smf_context.GetSMContext(smContextRef)
 	smContext.SMLock.Lock()
 	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
 	// smf_context.RemoveSMContext(smContext.Ref)
 
+	smContext.ReleaseQoSFlows()
 	deletedPFCPNode := make(map[string]bool)
 	smContext.PendingUPF = make(smf_context.PendingUPF)
 	for _, dataPath := range smContext.Tunnel.DataPathPool {
@@ -839,6 +965,10 @@ func HandlePDUSessionSMContextRelease(smContextRef string, body models.ReleaseSm
 		logger.CtxLog.Traceln("In case SessionReleaseSuccess")
 		smContext.SMContextState = smf_context.InActivePending
 		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		// the SM context released by the AMF is removed here, otherwise its UE address lease stays allocated and
+		// persisted, and is restored again after the SMF restarts
+		smf_context.RemoveSMContext(smContext.Ref)
+		NotifyPDUSessionRelease(smContext)
 		httpResponse = &http_wrapper.Response{
 			Status: http.StatusNoContent,
 			Body:   nil,
@@ -900,3 +1030,16 @@ func HandlePDUSessionSMContextRelease(smContextRef string, body models.ReleaseSm
 
 	return httpResponse
 }
+
+// selectServingAMF discovers the serving AMF of the SM context and builds its Namf_Communication client
+func selectServingAMF(smContext *smf_context.SMContext) {
+	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
+		logger.PduSessLog.Warnf("Send NF Discovery Serving AMF Error[%v]", err)
+	} else if problemDetails != nil {
+		logger.PduSessLog.Warnf("Send NF Discovery Serving AMF Problem[%+v]", problemDetails)
+	} else {
+		logger.PduSessLog.Traceln("Send NF Discovery Serving AMF successfully")
+	}
+
+	smContext.BuildCommunicationClient()
+}
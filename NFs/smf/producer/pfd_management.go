@@ -0,0 +1,45 @@
+package producer
+
+import (
+	"net/http"
+
+	"github.com/free5gc/http_wrapper"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	pfcp_message "github.com/free5gc/smf/pfcp/message"
+)
+
+// HandlePfdChangeNotify applies the PFD changes of the applications notified by the NEF (TS 29.551) and provisions
+// the PFDs of the changed applications to the associated UPFs supporting PFDM through PFCP PFD management
+// (TS 29.244 6.2.5)
+func HandlePfdChangeNotify(notifications []models.PfdChangeNotification) *http_wrapper.Response {
+	logger.PduSessLog.Infoln("In HandlePfdChangeNotify")
+
+	for _, notification := range notifications {
+		if notification.ApplicationId == "" {
+			problemDetails := &models.ProblemDetails{
+				Title:  "Malformed request syntax",
+				Status: http.StatusBadRequest,
+				Detail: "PFD change notification without application ID",
+				Cause:  "MANDATORY_IE_MISSING",
+			}
+			return http_wrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+		}
+	}
+
+	changedPFDDatas := make([]models.PfdDataForApp, 0, len(notifications))
+	for _, notification := range notifications {
+		logger.PduSessLog.Infof("PFDs of application[%s] change", notification.ApplicationId)
+		changedPFDDatas = append(changedPFDDatas, smf_context.UpdatePFDs(notification))
+	}
+	if len(changedPFDDatas) != 0 {
+		for _, upf := range smf_context.AssociatedUPFs() {
+			if upf.SupportPFDM() {
+				pfcp_message.SendPfcpPfdManagementRequest(upf.NodeID, changedPFDDatas)
+			}
+		}
+	}
+
+	return http_wrapper.NewResponse(http.StatusNoContent, nil, nil)
+}
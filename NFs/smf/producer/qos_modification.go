@@ -0,0 +1,405 @@
+package producer
+
+import (
+	"fmt"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	pfcp_message "github.com/free5gc/smf/pfcp/message"
+)
+
+// qosRuleOperationToRuleOperation maps the operation code of the QoS rule requested by the UE to the PCC rule
+// operation of the PCF
+func qosRuleOperationToRuleOperation(operationCode uint8) (models.RuleOperation, bool) {
+	switch operationCode {
+	case smf_context.OperationCodeCreateNewQoSRule:
+		return models.RuleOperation_CREATE_PCC_RULE, true
+	case smf_context.OperationCodeDeleteExistingQoSRule:
+		return models.RuleOperation_DELETE_PCC_RULE, true
+	case smf_context.OperationCodeModifyExistingQoSRuleAndAddPacketFilters:
+		return models.RuleOperation_MODIFY_PCC_RULE_AND_ADD_PACKET_FILTERS, true
+	case smf_context.OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters:
+		return models.RuleOperation_MODIFY_PCC_RULE_AND_REPLACE_PACKET_FILTERS, true
+	case smf_context.OperationCodeModifyExistingQoSRuleAndDeletePacketFilters:
+		return models.RuleOperation_MODIFY_PCC_RULE_AND_DELETE_PACKET_FILTERS, true
+	case smf_context.OperationCodeModifyExistingQoSRuleWithoutModifyingPacketFilters:
+		return models.RuleOperation_MODIFY_PCC_RULE_WITHOUT_MODIFY_PACKET_FILTERS, true
+	}
+	return "", false
+}
+
+// handlePDUSessionModificationRequest authorizes the QoS rules requested by the UE with the PCF one by one and
+// updates the QoS flows of the PDU session (TS 23.502 4.3.3.2). The request is accepted or rejected as a whole
+// (TS 24.501 6.4.2.4), the QoS rules authorized before a rejection are rolled back with the PCF and the 5GSM cause
+// of the rejection is returned
+func handlePDUSessionModificationRequest(smContext *smf_context.SMContext,
+	req *nasMessage.PDUSessionModificationRequest) ([]*smf_context.QoSFlowRuleList, uint8) {
+	qosRules, qosFlowDescriptions, err := smContext.HandlePDUSessionModificationRequest(req)
+	if err != nil {
+		logger.PduSessLog.Warnf("Handle PDU Session Modification Request failed: %+v", err)
+		return nil, nasMessage.Cause5GSMSyntacticalErrorInTheQoSOperation
+	}
+
+	qosBeforeModification := takeQosSnapshot(smContext)
+	rollback := newQosModificationRollback(smContext)
+	var flows []*smf_context.QoSFlow
+	updatedFlows := make(map[*smf_context.QoSFlow]bool)
+	for i := range qosRules {
+		flow, cause := authorizeQoSRule(smContext, &qosRules[i], qosFlowDescriptions, rollback)
+		if cause != 0 {
+			rollback.run(smContext)
+			return nil, cause
+		}
+		if !updatedFlows[flow] {
+			updatedFlows[flow] = true
+			flows = append(flows, flow)
+		}
+	}
+
+	ruleLists, err := smContext.UpdateQoSFlowRules(flows...)
+	if err != nil {
+		logger.PduSessLog.Errorf("Update rules of QoS flows failed: %+v", err)
+		rollback.run(smContext)
+		return nil, nasMessage.Cause5GSMInsufficientResources
+	}
+
+	NotifyQosChange(smContext, qosBeforeModification.qosFlowChanges(smContext))
+	return ruleLists, 0
+}
+
+// authorizeQoSRule authorizes the QoS rule requested by the UE with the PCF and applies it to its QoS flow, the rules
+// of the QoS flow are not updated. The 5GSM cause is returned if the QoS rule is rejected
+func authorizeQoSRule(smContext *smf_context.SMContext, rule *smf_context.QoSRule,
+	qosFlowDescriptions smf_context.QoSFlowDescriptions, rollback *qosModificationRollback,
+) (*smf_context.QoSFlow, uint8) {
+	flow := smContext.QoSFlowByQoSRuleID(rule.Identifier)
+	ueInitResReq, err := ueInitiatedResourceRequest(smContext, rule, flow, qosFlowDescriptions)
+	if err != nil {
+		logger.PduSessLog.Warnf("QoS rule[%d] requested by UE is rejected: %+v", rule.Identifier, err)
+		return nil, nasMessage.Cause5GSMSemanticErrorInTheQoSOperation
+	}
+
+	existingPCCRules := make(map[string]bool)
+	for id := range smContext.PCCRules {
+		existingPCCRules[id] = true
+	}
+
+	decision, problemDetails, err := consumer.SendSMPolicyAssociationUpdateByUERequest(smContext, ueInitResReq)
+	if err != nil {
+		logger.PduSessLog.Errorf("SM Policy Update for QoS rule[%d] failed: %+v", rule.Identifier, err)
+		return nil, nasMessage.Cause5GSMRequestRejectedUnspecified
+	} else if problemDetails != nil {
+		logger.PduSessLog.Warnf("PCF rejects QoS rule[%d]: %+v", rule.Identifier, problemDetails)
+		if problemDetails.Cause == "ERROR_TRAFFIC_MAPPING_INFO_REJECTED" {
+			return nil, nasMessage.Cause5GSMInsufficientResources
+		}
+		return nil, nasMessage.Cause5GSMRequestRejectedUnspecified
+	}
+	if err := ApplySmPolicyFromDecision(smContext, decision); err != nil {
+		logger.PduSessLog.Errorf("apply sm policy decision error: %+v", err)
+		return nil, nasMessage.Cause5GSMRequestRejectedUnspecified
+	}
+
+	switch ueInitResReq.RuleOp {
+	case models.RuleOperation_CREATE_PCC_RULE:
+		// the PCC rule created by the PCF is the one not installed before
+		var pccRule *smf_context.PCCRule
+		for id, installedPCCRule := range smContext.PCCRules {
+			if !existingPCCRules[id] {
+				pccRule = installedPCCRule
+				break
+			}
+		}
+		if pccRule == nil {
+			logger.PduSessLog.Errorf("PCC rule for QoS rule[%d] is not created by PCF", rule.Identifier)
+			return nil, nasMessage.Cause5GSMRequestRejectedUnspecified
+		}
+		rollback.authorized(ueInitResReq.RuleOp, pccRule.PCCRuleID, nil)
+		if flow, err = smContext.NewQoSFlow(pccRule, smContext.QosDecisions[pccRule.RefQosData()],
+			rule.PacketFilterList); err != nil {
+			logger.PduSessLog.Errorf("Create QoS flow failed: %+v", err)
+			return nil, nasMessage.Cause5GSMInsufficientResources
+		}
+	case models.RuleOperation_DELETE_PCC_RULE:
+		rollback.authorized(ueInitResReq.RuleOp, flow.PCCRuleID, flow)
+		// deleted PCC rule and QoS data are absent from the policy decision of the PCF
+		if pccRule, exist := smContext.PCCRules[flow.PCCRuleID]; exist {
+			delete(smContext.QosDecisions, pccRule.RefQosData())
+			delete(smContext.PCCRules, flow.PCCRuleID)
+		}
+		flow.Operation = smf_context.OperationCodeDeleteExistingQoSRule
+	default:
+		rollback.authorized(ueInitResReq.RuleOp, flow.PCCRuleID, flow)
+		if pccRule, exist := smContext.PCCRules[flow.PCCRuleID]; exist {
+			flow.QosData = smContext.QosDecisions[pccRule.RefQosData()]
+		}
+		flow.Precedence = uint8(ueInitResReq.Precedence)
+		flow.UpdatePacketFilters(rule)
+		// all the packet filters of the QoS rule are sent to the UE to keep both sides consistent
+		flow.Operation = smf_context.OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters
+		if rule.OperationCode == smf_context.OperationCodeModifyExistingQoSRuleWithoutModifyingPacketFilters {
+			flow.Operation = rule.OperationCode
+		}
+	}
+	return flow, 0
+}
+
+// qosModificationRollback keeps the QoS flows and the PCC rules of the PDU session before the PDU Session
+// Modification Request, and the PCC rule operations authorized by the PCF for the request
+type qosModificationRollback struct {
+	qosFlows     map[uint8]*smf_context.QoSFlow
+	flows        map[*smf_context.QoSFlow]smf_context.QoSFlow
+	pccRules     map[string]*smf_context.PCCRule
+	qosDecisions map[string]*models.QosData
+	operations   []authorizedPCCRuleOperation
+}
+
+type authorizedPCCRuleOperation struct {
+	ruleOp    models.RuleOperation
+	pccRuleID string
+	// the QoS flow of the modified or deleted PCC rule
+	flow *smf_context.QoSFlow
+}
+
+func newQosModificationRollback(smContext *smf_context.SMContext) *qosModificationRollback {
+	rollback := &qosModificationRollback{
+		qosFlows:     make(map[uint8]*smf_context.QoSFlow),
+		flows:        make(map[*smf_context.QoSFlow]smf_context.QoSFlow),
+		pccRules:     make(map[string]*smf_context.PCCRule),
+		qosDecisions: make(map[string]*models.QosData),
+	}
+	for qfi, flow := range smContext.QoSFlows {
+		rollback.qosFlows[qfi] = flow
+		rollback.flows[flow] = *flow
+	}
+	for id, pccRule := range smContext.PCCRules {
+		rollback.pccRules[id] = pccRule
+	}
+	for id, qosData := range smContext.QosDecisions {
+		rollback.qosDecisions[id] = qosData
+	}
+	return rollback
+}
+
+func (rollback *qosModificationRollback) authorized(ruleOp models.RuleOperation, pccRuleID string,
+	flow *smf_context.QoSFlow) {
+	rollback.operations = append(rollback.operations, authorizedPCCRuleOperation{
+		ruleOp:    ruleOp,
+		pccRuleID: pccRuleID,
+		flow:      flow,
+	})
+}
+
+// run restores the QoS flows and the PCC rules of the PDU session, and reverts the authorized PCC rule operations
+// with the PCF in the reverse order. The PCC rule deleted by the PCF is created again for its QoS flow
+func (rollback *qosModificationRollback) run(smContext *smf_context.SMContext) {
+	smContext.QoSFlows = rollback.qosFlows
+	for flow, original := range rollback.flows {
+		*flow = original
+	}
+	smContext.PCCRules = rollback.pccRules
+	smContext.QosDecisions = rollback.qosDecisions
+
+	for i := len(rollback.operations) - 1; i >= 0; i-- {
+		operation := rollback.operations[i]
+		var ueInitResReq *models.UeInitiatedResourceRequest
+		var err error
+		switch operation.ruleOp {
+		case models.RuleOperation_CREATE_PCC_RULE:
+			ueInitResReq = &models.UeInitiatedResourceRequest{
+				PccRuleId: operation.pccRuleID,
+				RuleOp:    models.RuleOperation_DELETE_PCC_RULE,
+			}
+		case models.RuleOperation_DELETE_PCC_RULE:
+			ueInitResReq, err = revertQoSRuleRequest(smContext, operation.flow,
+				smf_context.OperationCodeCreateNewQoSRule)
+		default:
+			ueInitResReq, err = revertQoSRuleRequest(smContext, operation.flow,
+				smf_context.OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters)
+		}
+		if err != nil {
+			logger.PduSessLog.Errorf("Revert PCC rule[%s] failed: %+v", operation.pccRuleID, err)
+			continue
+		}
+
+		existingPCCRules := make(map[string]bool)
+		for id := range smContext.PCCRules {
+			existingPCCRules[id] = true
+		}
+		decision, problemDetails, err := consumer.SendSMPolicyAssociationUpdateByUERequest(smContext, ueInitResReq)
+		if err != nil || problemDetails != nil {
+			logger.PduSessLog.Errorf("Revert PCC rule[%s] failed: %+v %+v", operation.pccRuleID, problemDetails, err)
+			continue
+		}
+		if operation.ruleOp != models.RuleOperation_DELETE_PCC_RULE {
+			continue
+		}
+		// the QoS flow is bound to the PCC rule created again, the old PCC rule is deleted by the PCF
+		delete(smContext.PCCRules, operation.pccRuleID)
+		if err := ApplySmPolicyFromDecision(smContext, decision); err != nil {
+			logger.PduSessLog.Errorf("apply sm policy decision error: %+v", err)
+		}
+		for id := range smContext.PCCRules {
+			if !existingPCCRules[id] {
+				operation.flow.PCCRuleID = id
+				break
+			}
+		}
+	}
+}
+
+// revertQoSRuleRequest builds the resource request to the PCF restoring the QoS rule of the QoS flow
+func revertQoSRuleRequest(smContext *smf_context.SMContext, flow *smf_context.QoSFlow,
+	operationCode uint8) (*models.UeInitiatedResourceRequest, error) {
+	rule := &smf_context.QoSRule{
+		Identifier:       flow.QoSRuleID,
+		OperationCode:    operationCode,
+		Precedence:       flow.Precedence,
+		QFI:              flow.QFI,
+		PacketFilterList: flow.PacketFilters,
+	}
+	description := flow.Description()
+	description.OperationCode = smf_context.OperationCodeModifyExistingQoSFlowDescription
+	requestedFlow := flow
+	if operationCode == smf_context.OperationCodeCreateNewQoSRule {
+		requestedFlow = nil
+	}
+	return ueInitiatedResourceRequest(smContext, rule, requestedFlow, smf_context.QoSFlowDescriptions{description})
+}
+
+// ueInitiatedResourceRequest converts the QoS rule and the QoS flow description requested by the UE to the
+// resource request to the PCF (TS 29.512 4.2.4.17)
+func ueInitiatedResourceRequest(smContext *smf_context.SMContext, rule *smf_context.QoSRule,
+	flow *smf_context.QoSFlow, qosFlowDescriptions smf_context.QoSFlowDescriptions,
+) (*models.UeInitiatedResourceRequest, error) {
+	ruleOp, exist := qosRuleOperationToRuleOperation(rule.OperationCode)
+	if !exist {
+		return nil, fmt.Errorf("QoS rule operation code [%d] is not supported", rule.OperationCode)
+	}
+	ueInitResReq := &models.UeInitiatedResourceRequest{
+		RuleOp:     ruleOp,
+		Precedence: int32(rule.Precedence),
+	}
+
+	packetFilters := rule.PacketFilterList
+	if rule.OperationCode == smf_context.OperationCodeCreateNewQoSRule {
+		if len(packetFilters) == 0 {
+			return nil, fmt.Errorf("no packet filter in the new QoS rule")
+		}
+	} else {
+		if flow == nil {
+			return nil, fmt.Errorf("QoS rule[%d] does not exist", rule.Identifier)
+		}
+		ueInitResReq.PccRuleId = flow.PCCRuleID
+		if rule.Precedence == 0 {
+			ueInitResReq.Precedence = int32(flow.Precedence)
+		}
+		// packet filter identifiers of the UE are unknown to the PCF, the remaining packet filters replace all
+		if rule.OperationCode == smf_context.OperationCodeModifyExistingQoSRuleAndDeletePacketFilters {
+			ueInitResReq.RuleOp = models.RuleOperation_MODIFY_PCC_RULE_AND_REPLACE_PACKET_FILTERS
+			remainingFlow := *flow
+			remainingFlow.UpdatePacketFilters(rule)
+			packetFilters = remainingFlow.PacketFilters
+			if len(packetFilters) == 0 {
+				return nil, fmt.Errorf("all packet filters of QoS rule[%d] are deleted", rule.Identifier)
+			}
+		}
+	}
+
+	var ueIPv4, ueIPv6 string
+	if smContext.PDUAddress != nil {
+		ueIPv4 = smContext.PDUAddress.String()
+	}
+	if prefix := smContext.IPv6Prefix(); prefix != nil {
+		ueIPv6 = prefix.String()
+	}
+	if ueInitResReq.RuleOp != models.RuleOperation_DELETE_PCC_RULE &&
+		ueInitResReq.RuleOp != models.RuleOperation_MODIFY_PCC_RULE_WITHOUT_MODIFY_PACKET_FILTERS {
+		for i := range packetFilters {
+			// the packet filter without IP version specific component matches the IPv4 traffic of the IPv4v6 session
+			ueIP := ueIPv4
+			if packetFilters[i].IsIPv6() || ueIPv4 == "" {
+				ueIP = ueIPv6
+			}
+			flowDescription, err := packetFilters[i].FlowDescription(ueIP)
+			if err != nil {
+				return nil, err
+			}
+			ueInitResReq.PackFiltInfo = append(ueInitResReq.PackFiltInfo, models.PacketFilterInfo{
+				PackFiltCont:    flowDescription,
+				TosTrafficClass: packetFilters[i].TosTrafficClass(),
+				FlowLabel:       packetFilters[i].FlowLabel(),
+				FlowDirection:   packetFilters[i].FlowDirection(),
+			})
+		}
+	}
+
+	// the requested QoS is the QoS flow description of the QFI of the QoS rule
+	qfi := rule.QFI
+	if flow != nil {
+		qfi = flow.QFI
+	}
+	for _, description := range qosFlowDescriptions {
+		if description.QFI != qfi || description.OperationCode == smf_context.OperationCodeDeleteExistingQoSFlowDescription {
+			continue
+		}
+		ueInitResReq.ReqQos = &models.RequestedQos{
+			Var5qi: int32(description.Var5QI),
+		}
+		if description.GFBRUplink != 0 {
+			ueInitResReq.ReqQos.GbrUl = fmt.Sprintf("%d Kbps", description.GFBRUplink)
+		}
+		if description.GFBRDownlink != 0 {
+			ueInitResReq.ReqQos.GbrDl = fmt.Sprintf("%d Kbps", description.GFBRDownlink)
+		}
+	}
+	if ueInitResReq.ReqQos == nil && ueInitResReq.RuleOp == models.RuleOperation_CREATE_PCC_RULE {
+		// non-GBR QoS flow of the default 5QI
+		ueInitResReq.ReqQos = &models.RequestedQos{}
+	}
+	if ueInitResReq.ReqQos != nil && ueInitResReq.ReqQos.Var5qi == 0 {
+		if flow != nil && flow.QosData != nil {
+			ueInitResReq.ReqQos.Var5qi = flow.QosData.Var5qi
+		} else {
+			ueInitResReq.ReqQos.Var5qi = int32(smContext.DefaultQFI())
+		}
+	}
+	return ueInitResReq, nil
+}
+
+// sendQoSFlowRules sends the rules of the QoS flows to the UPFs in PFCP Session Modification Requests, it returns
+// false if there is no rule to send
+func sendQoSFlowRules(smContext *smf_context.SMContext, ruleLists []*smf_context.QoSFlowRuleList) bool {
+	if len(ruleLists) == 0 {
+		return false
+	}
+
+	// rules of a UPF are sent in one request
+	nodeRuleLists := make(map[string]*smf_context.QoSFlowRuleList)
+	for _, ruleList := range ruleLists {
+		nodeIP := ruleList.NodeID.ResolveNodeIdToIp().String()
+		if nodeRuleList, exist := nodeRuleLists[nodeIP]; exist {
+			nodeRuleList.PDRList = append(nodeRuleList.PDRList, ruleList.PDRList...)
+			nodeRuleList.QERList = append(nodeRuleList.QERList, ruleList.QERList...)
+		} else {
+			nodeRuleLists[nodeIP] = &smf_context.QoSFlowRuleList{
+				NodeID:  ruleList.NodeID,
+				PDRList: ruleList.PDRList,
+				QERList: ruleList.QERList,
+			}
+		}
+	}
+
+	smContext.PendingUPF = make(smf_context.PendingUPF)
+	for nodeIP := range nodeRuleLists {
+		smContext.PendingUPF[nodeIP] = true
+	}
+	for _, ruleList := range nodeRuleLists {
+		pfcp_message.SendPfcpSessionModificationRequest(ruleList.NodeID, smContext,
+			ruleList.PDRList, []*smf_context.FAR{}, []*smf_context.BAR{}, ruleList.QERList)
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	smf_context "github.com/free5gc/smf/context"
+)
+
+func TestPDUSessionModificationRequestRollback(t *testing.T) {
+	var requests []models.UeInitiatedResourceRequest
+	var numOfPCCRules int
+	// the PCF rejects the new QoS rules of the traffic from 10.80.0.0/16
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var updateData models.SmPolicyUpdateContextData
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&updateData))
+		ueInitResReq := updateData.UeInitResReq
+		requests = append(requests, *ueInitResReq)
+
+		decision := models.SmPolicyDecision{}
+		pccRuleID := ueInitResReq.PccRuleId
+		switch ueInitResReq.RuleOp {
+		case models.RuleOperation_DELETE_PCC_RULE:
+			decision.PccRules = map[string]*models.PccRule{pccRuleID: nil}
+		case models.RuleOperation_CREATE_PCC_RULE:
+			if strings.Contains(ueInitResReq.PackFiltInfo[0].PackFiltCont, "10.80.0.0") {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusForbidden)
+				require.NoError(t, json.NewEncoder(w).Encode(models.ProblemDetails{
+					Status: http.StatusForbidden,
+					Cause:  "ERROR_TRAFFIC_MAPPING_INFO_REJECTED",
+				}))
+				return
+			}
+			numOfPCCRules++
+			pccRuleID = fmt.Sprintf("PccRule-%d", numOfPCCRules)
+			fallthrough
+		default:
+			qosID := strings.Replace(pccRuleID, "PccRule", "QosData", 1)
+			decision.PccRules = map[string]*models.PccRule{
+				pccRuleID: {
+					PccRuleId:  pccRuleID,
+					Precedence: ueInitResReq.Precedence,
+					FlowInfos:  []models.FlowInformation{{FlowDescription: ueInitResReq.PackFiltInfo[0].PackFiltCont}},
+					RefQosData: []string{qosID},
+				},
+			}
+			decision.QosDecs = map[string]*models.QosData{qosID: {QosId: qosID, Var5qi: 9}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		require.NoError(t, json.NewEncoder(w).Encode(decision))
+	}), &http2.Server{}))
+	defer server.Close()
+
+	nodeID := pfcpType.NodeID{
+		NodeIdType:  pfcpType.NodeIdTypeIpv4Address,
+		NodeIdValue: net.ParseIP("10.200.200.142").To4(),
+	}
+	upf := smf_context.NewUPF(&nodeID, nil)
+	defer smf_context.RemoveUPFNodeByNodeID(nodeID)
+	upf.SetStatus(smf_context.AssociatedSetUpSuccess)
+
+	smContext := smf_context.NewSMContext("imsi-208930000000142", 1)
+	defer smf_context.RemoveSMContext(smContext.Ref)
+	smContext.PDUAddress = net.ParseIP("10.60.0.1").To4()
+	smContext.SelectedPCFProfile = models.NfProfile{
+		NfServices: &[]models.NfService{
+			{ServiceName: models.ServiceName_NPCF_SMPOLICYCONTROL, ApiPrefix: server.URL},
+		},
+	}
+	smContext.BuildSMPolicyClient()
+	smContext.SMPolicyID = "142"
+	smContext.Tunnel = smf_context.NewUPTunnel()
+	node := smf_context.NewDataPathNode()
+	node.UPF = upf
+	dataPath := smf_context.NewDataPath()
+	dataPath.FirstDPNode = node
+	dataPath.Activated = true
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+	for _, tunnel := range []*smf_context.GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		pdr, err := upf.AddPDR()
+		require.NoError(t, err)
+		require.NoError(t, smContext.PutPDRtoPFCPSession(nodeID, pdr))
+		tunnel.PDR = pdr
+	}
+
+	newQoSRule := func(identifier, operationCode uint8, remoteAddress []byte) smf_context.QoSRule {
+		return smf_context.QoSRule{
+			Identifier:    identifier,
+			OperationCode: operationCode,
+			Precedence:    identifier * 10,
+			PacketFilterList: []smf_context.PacketFilter{{
+				Identifier:    1,
+				Direction:     smf_context.PacketFilterDirectionBidirectional,
+				ComponentType: smf_context.PacketFilterComponentTypeIPv4RemoteAddress,
+				Component:     append(remoteAddress, 255, 255, 0, 0),
+			}},
+		}
+	}
+	modificationRequest := func(deletedRuleID uint8,
+		qosRules smf_context.QoSRules) *nasMessage.PDUSessionModificationRequest {
+		var data []byte
+		if deletedRuleID != 0 {
+			// the deleted QoS rule has neither precedence nor QFI
+			data = []byte{deletedRuleID, 0x00, 0x01, smf_context.OperationCodeDeleteExistingQoSRule << 5}
+		}
+		rulesData, err := qosRules.MarshalBinary()
+		require.NoError(t, err)
+		data = append(data, rulesData...)
+		req := nasMessage.NewPDUSessionModificationRequest(0)
+		req.RequestedQosRules = nasType.NewRequestedQosRules(nasMessage.PDUSessionModificationRequestRequestedQosRulesType)
+		req.RequestedQosRules.SetLen(uint16(len(data)))
+		req.RequestedQosRules.SetQoSRules(data)
+		return req
+	}
+	rejectedRule := newQoSRule(3, smf_context.OperationCodeCreateNewQoSRule, []byte{10, 80, 0, 0})
+	sessionPDRs := smContext.PFCPContext[nodeID.ResolveNodeIdToIp().String()].PDRs
+
+	// the whole request is rejected, the PCC rule authorized before the rejection is deleted from the PCF
+	ruleLists, cause := handlePDUSessionModificationRequest(smContext, modificationRequest(0, smf_context.QoSRules{
+		newQoSRule(2, smf_context.OperationCodeCreateNewQoSRule, []byte{10, 70, 0, 0}),
+		rejectedRule,
+	}))
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, cause)
+	require.Empty(t, ruleLists)
+	require.Len(t, requests, 3)
+	require.Equal(t, models.RuleOperation_CREATE_PCC_RULE, requests[0].RuleOp)
+	require.Equal(t, models.RuleOperation_CREATE_PCC_RULE, requests[1].RuleOp)
+	require.Equal(t, models.RuleOperation_DELETE_PCC_RULE, requests[2].RuleOp)
+	require.Equal(t, "PccRule-1", requests[2].PccRuleId)
+	require.Empty(t, smContext.QoSFlows)
+	require.Empty(t, smContext.PCCRules)
+	require.Empty(t, smContext.QosDecisions)
+	require.Len(t, sessionPDRs, 2)
+
+	ruleLists, cause = handlePDUSessionModificationRequest(smContext, modificationRequest(0, smf_context.QoSRules{
+		newQoSRule(2, smf_context.OperationCodeCreateNewQoSRule, []byte{10, 70, 0, 0}),
+	}))
+	require.Zero(t, cause)
+	require.Len(t, ruleLists, 1)
+	require.Len(t, sessionPDRs, 4)
+	flow := smContext.QoSFlowByQoSRuleID(2)
+	require.NotNil(t, flow)
+	require.Equal(t, "PccRule-2", flow.PCCRuleID)
+	flow.Operation = 0
+	original := *flow
+	requests = nil
+
+	// the modified PCC rule is restored with the PCF
+	ruleLists, cause = handlePDUSessionModificationRequest(smContext, modificationRequest(0, smf_context.QoSRules{
+		newQoSRule(2, smf_context.OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters, []byte{10, 90, 0, 0}),
+		rejectedRule,
+	}))
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, cause)
+	require.Empty(t, ruleLists)
+	require.Len(t, requests, 3)
+	require.Equal(t, models.RuleOperation_MODIFY_PCC_RULE_AND_REPLACE_PACKET_FILTERS, requests[2].RuleOp)
+	require.Equal(t, "PccRule-2", requests[2].PccRuleId)
+	require.Contains(t, requests[2].PackFiltInfo[0].PackFiltCont, "10.70.0.0/16")
+	require.Equal(t, original, *flow)
+	require.Contains(t, smContext.PCCRules, "PccRule-2")
+	require.Len(t, sessionPDRs, 4)
+	requests = nil
+
+	// the deleted PCC rule is created again with the PCF and bound to the QoS flow
+	ruleLists, cause = handlePDUSessionModificationRequest(smContext,
+		modificationRequest(2, smf_context.QoSRules{rejectedRule}))
+	require.Equal(t, nasMessage.Cause5GSMInsufficientResources, cause)
+	require.Empty(t, ruleLists)
+	require.Len(t, requests, 3)
+	require.Equal(t, models.RuleOperation_DELETE_PCC_RULE, requests[0].RuleOp)
+	require.Equal(t, models.RuleOperation_CREATE_PCC_RULE, requests[2].RuleOp)
+	require.Contains(t, requests[2].PackFiltInfo[0].PackFiltCont, "10.70.0.0/16")
+	require.Equal(t, smContext.QoSFlows[flow.QFI], flow)
+	require.Equal(t, "PccRule-3", flow.PCCRuleID)
+	require.Zero(t, flow.Operation)
+	require.NotContains(t, smContext.PCCRules, "PccRule-2")
+	require.Contains(t, smContext.PCCRules, "PccRule-3")
+	require.Len(t, sessionPDRs, 4)
+}
@@ -0,0 +1,140 @@
+package producer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi/models"
+	"github.com/free5gc/pfcp/pfcpType"
+	"github.com/free5gc/smf/consumer"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	pfcp_message "github.com/free5gc/smf/pfcp/message"
+)
+
+// ReleaseInactivePDUSession releases the PDU session the UPF reports no user plane traffic for (TS 23.502 4.3.4.2)
+func ReleaseInactivePDUSession(smContextRef string) {
+	smContext := smf_context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	if smContext.SMContextState != smf_context.Active {
+		return
+	}
+	logger.PduSessLog.Infof("PDU session[%s-%02d] is inactive", smContext.Supi, smContext.PDUSessionID)
+	smContext.Pti = 0
+	if err := releasePDUSession(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
+		logger.PduSessLog.Errorf("Release inactive PDU session failed: %+v", err)
+	}
+}
+
+// UpdateSMPolicyByUsageReport reports the usage accumulated by the PDU session to the PCF and applies the SM policy
+// decision the PCF returns (TS 29.512 4.2.4.10), the decision is not applied once the PDU session is released
+func UpdateSMPolicyByUsageReport(smContextRef string, accuUsageReports []models.AccuUsageReport) {
+	smContext := smf_context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	decision, err := consumer.SendSMPolicyAssociationUpdateByUsageReport(smContext, accuUsageReports)
+	if err != nil {
+		logger.PduSessLog.Warnf("Send Usage Report to PCF failed: %+v", err)
+		return
+	}
+	if smContext.SMContextState == smf_context.InActive || smContext.SMContextState == smf_context.InActivePending {
+		return
+	}
+	if err := applySmPolicyUpdate(smContext, decision); err != nil {
+		logger.PduSessLog.Errorf("%+v", err)
+	}
+}
+
+// HandleErrorIndication handles the GTP-U error indication the UPF receives from the remote peer of the PDU session
+// (TS 23.527 5.3.3), the downlink traffic is buffered and the AN tunnel is rebuilt if the peer is the AN, otherwise
+// the PDU session is released and the UE is requested to establish it again
+func HandleErrorIndication(smContextRef string, remoteFTEID *pfcpType.FTEID) {
+	smContext := smf_context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	if smContext.SMContextState != smf_context.Active {
+		return
+	}
+	logger.PduSessLog.Infof("Error indication of PDU session[%s-%02d] from TEID[%d]",
+		smContext.Supi, smContext.PDUSessionID, remoteFTEID.Teid)
+
+	anInformation := smContext.Tunnel.ANInformation
+	if remoteFTEID.Teid == anInformation.TEID && anInformation.IPAddress.Equal(remoteFTEID.Ipv4Address) {
+		err := rebuildANTunnel(smContext)
+		if err == nil {
+			return
+		}
+		logger.PduSessLog.Warnf("Rebuild AN tunnel failed: %+v", err)
+	}
+
+	smContext.Pti = 0
+	if err := releasePDUSession(smContext, nasMessage.Cause5GSMReactivationRequested); err != nil {
+		logger.PduSessLog.Errorf("Release PDU session on error indication failed: %+v", err)
+	}
+}
+
+// rebuildANTunnel buffers the downlink traffic of the PDU session in the UPF and requests the NG-RAN to set up the
+// PDU session resource again, the downlink traffic is forwarded again once the NG-RAN responds with its new tunnel
+func rebuildANTunnel(smContext *smf_context.SMContext) error {
+	smContext.PendingUPF = make(smf_context.PendingUPF)
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		ANUPF := dataPath.FirstDPNode
+		DLPDR := ANUPF.DownLinkTunnel.PDR
+		if DLPDR == nil {
+			continue
+		}
+		DLPDR.FAR.State = smf_context.RULE_UPDATE
+		DLPDR.FAR.ApplyAction.Forw = false
+		DLPDR.FAR.ApplyAction.Buff = true
+		DLPDR.FAR.ApplyAction.Nocp = true
+		smContext.PendingUPF[ANUPF.GetNodeIP()] = true
+		pfcp_message.SendPfcpSessionModificationRequest(ANUPF.UPF.NodeID, smContext,
+			nil, []*smf_context.FAR{DLPDR.FAR}, nil, nil)
+	}
+
+	if !smContext.PendingUPF.IsEmpty() {
+		smContext.SMContextState = smf_context.PFCPModification
+		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		status := <-smContext.SBIPFCPCommunicationChan
+		smContext.SMContextState = smf_context.Active
+		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		if status != smf_context.SessionUpdateSuccess {
+			return fmt.Errorf("PFCP session modification failed: %s", status.String())
+		}
+	}
+	smContext.UpCnxState = models.UpCnxState_DEACTIVATED
+
+	n2Msg, err := smf_context.BuildPDUSessionResourceSetupRequestTransfer(smContext)
+	if err != nil {
+		return err
+	}
+	status, err := sendN1N2MessageTransfer(smContext, nil, n2Msg, models.NgapIeType_PDU_RES_SETUP_REQ)
+	if status == http.StatusConflict {
+		// the UE is in CM-IDLE, the buffered downlink traffic triggers the paging
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/openapi"
+	"github.com/free5gc/openapi/models"
+	smf_context "github.com/free5gc/smf/context"
+	"github.com/free5gc/smf/logger"
+	pfcp_message "github.com/free5gc/smf/pfcp/message"
+)
+
+// RelocatePDUSessionAnchor relocates the anchor of the PDU session to a UPF serving the DNAI, the PDU session of
+// SSC mode 2 is released before the UE establishes it again (break-before-make, TS 23.502 4.3.5.1), the UE is
+// requested to establish a new PDU session for SSC mode 3 and the old one is kept until its address lifetime
+// expires (make-before-break, TS 23.502 4.3.5.2)
+func RelocatePDUSessionAnchor(smContext *smf_context.SMContext, dnai string) *models.ProblemDetails {
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	if smContext.SelectedSSCMode != smf_context.SSCMode2 && smContext.SelectedSSCMode != smf_context.SSCMode3 {
+		return &models.ProblemDetails{
+			Status: http.StatusForbidden,
+			Cause:  "PSA_RELOCATION_NOT_ALLOWED",
+			Detail: fmt.Sprintf("PDU session anchor of SSC mode %d can't be relocated", smContext.SelectedSSCMode),
+		}
+	}
+	if smContext.SMContextState != smf_context.Active {
+		return &models.ProblemDetails{
+			Status: http.StatusConflict,
+			Cause:  "PDU_SESSION_NOT_ACTIVE",
+			Detail: fmt.Sprintf("SM context state is %s", smContext.SMContextState.String()),
+		}
+	}
+
+	upfSelectionParams := &smf_context.UPFSelectionParams{
+		Dnn: smContext.Dnn,
+		SNssai: &smf_context.SNssai{
+			Sst: smContext.Snssai.Sst,
+			Sd:  smContext.Snssai.Sd,
+		},
+		Dnai: dnai,
+	}
+	targetUPPath := smf_context.GetUserPlaneInformation().GetDefaultUserPlanePathByDNN(upfSelectionParams)
+	if len(targetUPPath) == 0 {
+		return &models.ProblemDetails{
+			Status: http.StatusNotFound,
+			Cause:  "UPF_NOT_AVAILABLE",
+			Detail: fmt.Sprintf("no UPF serves DNAI[%s]", dnai),
+		}
+	}
+
+	var defaultPath *smf_context.DataPath
+	if smContext.Tunnel != nil {
+		defaultPath = smContext.Tunnel.DataPathPool.GetDefaultPath()
+	}
+	if defaultPath == nil || defaultPath.FirstDPNode == nil {
+		return &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: "PDU session has no default data path",
+		}
+	}
+	anchorNode := defaultPath.FirstDPNode
+	for !anchorNode.IsAnchorUPF() {
+		anchorNode = anchorNode.Next()
+	}
+	if anchorNode.UPF == nil {
+		return &models.ProblemDetails{
+			Status: http.StatusInternalServerError,
+			Cause:  "SYSTEM_FAILURE",
+			Detail: "PDU session has no anchor UPF",
+		}
+	}
+	// the UPFs serving the DNAI are balanced, any of them anchors the PDU session in the DNAI
+	if anchorNode.UPF.ServesDnai(smContext.Snssai, smContext.Dnn, dnai) {
+		logger.PduSessLog.Infof("PDU session[%s-%02d] is already anchored in DNAI[%s]",
+			smContext.Supi, smContext.PDUSessionID, dnai)
+		return nil
+	}
+
+	logger.PduSessLog.Infof("Relocate anchor of PDU session[%s-%02d] of SSC mode %d to DNAI[%s]",
+		smContext.Supi, smContext.PDUSessionID, smContext.SelectedSSCMode, dnai)
+	// the UE establishes the PDU session again within the address lifetime of the old one
+	smContext.SetRelocatedAnchorDnai(dnai, smf_context.SMF_Self().PSAAddressLifetime)
+	NotifyUpPathChange(smContext, defaultPath.Dnai(smContext.Snssai, smContext.Dnn), dnai,
+		models.DnaiChangeType_EARLY)
+
+	// network-requested procedures have no procedure transaction identity
+	smContext.Pti = 0
+	switch smContext.SelectedSSCMode {
+	case smf_context.SSCMode2:
+		if err := releasePDUSession(smContext, nasMessage.Cause5GSMReactivationRequested); err != nil {
+			logger.PduSessLog.Errorf("Release PDU session for PSA relocation failed: %+v", err)
+			return &models.ProblemDetails{
+				Status: http.StatusInternalServerError,
+				Cause:  "SYSTEM_FAILURE",
+				Detail: err.Error(),
+			}
+		}
+	case smf_context.SSCMode3:
+		addressLifetime := smf_context.SMF_Self().PSAAddressLifetime
+		n1Msg, err := smf_context.BuildGSMPDUSessionAnchorRelocationCommand(smContext, addressLifetime)
+		if err != nil {
+			logger.PduSessLog.Errorf("Build GSM PDUSessionModificationCommand failed: %+v", err)
+			return &models.ProblemDetails{
+				Status: http.StatusInternalServerError,
+				Cause:  "SYSTEM_FAILURE",
+				Detail: err.Error(),
+			}
+		}
+		if _, err := sendN1N2MessageTransfer(smContext, n1Msg, nil, ""); err != nil {
+			logger.PduSessLog.Errorf("Send N1N2MessageTransfer failed: %+v", err)
+			return &models.ProblemDetails{
+				Status: http.StatusInternalServerError,
+				Cause:  "SYSTEM_FAILURE",
+				Detail: err.Error(),
+			}
+		}
+		smContextRef := smContext.Ref
+		time.AfterFunc(addressLifetime, func() {
+			handleAddressLifetimeExpiry(smContextRef)
+		})
+	}
+	return nil
+}
+
+// handleAddressLifetimeExpiry releases the old PDU session of SSC mode 3 which is not released by the UE before its
+// PDU session address lifetime expires
+func handleAddressLifetimeExpiry(smContextRef string) {
+	smContext := smf_context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	defer smContext.Store()
+
+	if smContext.SMContextState != smf_context.Active {
+		return
+	}
+	logger.PduSessLog.Infof("Address lifetime of PDU session[%s-%02d] expires", smContext.Supi, smContext.PDUSessionID)
+	smContext.Pti = 0
+	if err := releasePDUSession(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
+		logger.PduSessLog.Errorf("Release PDU session on address lifetime expiry failed: %+v", err)
+	}
+}
+
+// releasePDUSession performs the SMF-requested PDU session release (TS 23.502 4.3.4.2), the N4 sessions are
+// deleted before the UE and the NG-RAN are requested to release the PDU session
+func releasePDUSession(smContext *smf_context.SMContext, cause uint8) error {
+	smContext.ReleaseQoSFlows()
+	deletedPFCPNode := make(map[string]bool)
+	smContext.PendingUPF = make(smf_context.PendingUPF)
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		dataPath.DeactivateTunnelAndPDR(smContext)
+		for curDataPathNode := dataPath.FirstDPNode; curDataPathNode != nil; curDataPathNode = curDataPathNode.Next() {
+			curUPFID, err := curDataPathNode.GetUPFID()
+			if err != nil {
+				logger.PduSessLog.Error("DataPath UPFID not found")
+				continue
+			}
+			if _, exist := deletedPFCPNode[curUPFID]; !exist {
+				pfcp_message.SendPfcpSessionDeletionRequest(curDataPathNode.UPF.NodeID, smContext)
+				deletedPFCPNode[curUPFID] = true
+				smContext.PendingUPF[curDataPathNode.GetNodeIP()] = true
+			}
+		}
+	}
+
+	smContext.SMContextState = smf_context.PFCPModification
+	logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+	if status := <-smContext.SBIPFCPCommunicationChan; status != smf_context.SessionReleaseSuccess {
+		smContext.SMContextState = smf_context.Active
+		logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+		return fmt.Errorf("PFCP session deletion failed: %s", status.String())
+	}
+	smContext.SMContextState = smf_context.InActivePending
+	logger.CtxLog.Traceln("SMContextState Change State: ", smContext.SMContextState.String())
+
+	n1Msg, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, cause)
+	if err != nil {
+		return err
+	}
+	n2Msg, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext)
+	if err != nil {
+		return err
+	}
+	status, err := sendN1N2MessageTransfer(smContext, n1Msg, n2Msg, models.NgapIeType_PDU_RES_REL_CMD)
+	if status == http.StatusConflict {
+		// the UE is in CM-IDLE, only the N1 SM message is transferred after the UE is paged
+		_, err = sendN1N2MessageTransfer(smContext, n1Msg, nil, "")
+	}
+	return err
+}
+
+// sendN1N2MessageTransfer transfers the N1 SM message and the N2 SM information of the PDU session through the
+// serving AMF, the N1 or N2 part is omitted if its message is nil, the HTTP status of the AMF is returned
+func sendN1N2MessageTransfer(smContext *smf_context.SMContext, n1Msg, n2Msg []byte,
+	ngapIeType models.NgapIeType) (int, error) {
+	if smContext.CommunicationClient == nil {
+		return 0, fmt.Errorf("serving AMF of SUPI[%s] is not found", smContext.Supi)
+	}
+
+	n1n2Request := models.N1N2MessageTransferRequest{
+		JsonData: &models.N1N2MessageTransferReqData{
+			PduSessionId: smContext.PDUSessionID,
+		},
+	}
+	if n1Msg != nil {
+		n1n2Request.BinaryDataN1Message = n1Msg
+		n1n2Request.JsonData.N1MessageContainer = &models.N1MessageContainer{
+			N1MessageClass:   "SM",
+			N1MessageContent: &models.RefToBinaryData{ContentId: "GSM_NAS"},
+		}
+	}
+	if n2Msg != nil {
+		n1n2Request.BinaryDataN2Information = n2Msg
+		n1n2Request.JsonData.N2InfoContainer = &models.N2InfoContainer{
+			N2InformationClass: models.N2InformationClass_SM,
+			SmInfo: &models.N2SmInformation{
+				PduSessionId: smContext.PDUSessionID,
+				N2InfoContent: &models.N2InfoContent{
+					NgapIeType: ngapIeType,
+					NgapData: &models.RefToBinaryData{
+						ContentId: "N2SmInformation",
+					},
+				},
+				SNssai: smContext.Snssai,
+			},
+		}
+	}
+
+	rspData, httpResponse, err := smContext.CommunicationClient.
+		N1N2MessageCollectionDocumentApi.
+		N1N2MessageTransfer(context.Background(), smContext.Supi, n1n2Request)
+	if httpResponse == nil {
+		return 0, err
+	}
+	defer func() {
+		if rspCloseErr := httpResponse.Body.Close(); rspCloseErr != nil {
+			logger.PduSessLog.Errorf("N1N2MessageTransfer response body cannot close: %+v", rspCloseErr)
+		}
+	}()
+	if err != nil {
+		if openapiErr, ok := err.(openapi.GenericOpenAPIError); ok {
+			if transferErr, ok := openapiErr.Model().(models.N1N2MessageTransferError); ok && transferErr.Error != nil {
+				return httpResponse.StatusCode, fmt.Errorf("N1N2MessageTransfer failed: %s", transferErr.Error.Cause)
+			}
+		}
+		return httpResponse.StatusCode, err
+	}
+	logger.PduSessLog.Tracef("N1N2MessageTransfer cause: %s", rspData.Cause)
+	return httpResponse.StatusCode, nil
+}
@@ -1,10 +1,12 @@
 package producer
 
 import (
+	"fmt"
 	"net"
 	"reflect"
 
 	"github.com/free5gc/flowdesc"
+	"github.com/free5gc/openapi/models"
 	"github.com/free5gc/pfcp/pfcpType"
 	"github.com/free5gc/pfcp/pfcpUdp"
 	"github.com/free5gc/smf/context"
@@ -18,22 +20,9 @@ func AddPDUSessionAnchorAndULCL(smContext *context.SMContext, nodeID pfcpType.No
 
 	switch bpMGR.AddingPSAState {
 	case context.ActivatingDataPath:
-		// select PSA2
-		bpMGR.SelectPSA2(smContext)
-		smContext.AllocateLocalSEIDForDataPath(bpMGR.ActivatingPath)
-		// select an upf as ULCL
-		err := bpMGR.FindULCL(smContext)
-		if err != nil {
+		if err := activatePSA2(smContext); err != nil {
 			logger.PduSessLog.Errorln(err)
-			return
 		}
-
-		// Allocate Path PDR and TEID
-		bpMGR.ActivatingPath.ActivateTunnelAndPDR(smContext, 255)
-		// N1N2MessageTransfer Here
-
-		// Establish PSA2
-		EstablishPSA2(smContext)
 	case context.EstablishingNewPSA:
 
 		trggierUPFIP := nodeID.ResolveNodeIdToIp().String()
@@ -99,9 +88,130 @@ func AddPDUSessionAnchorAndULCL(smContext *context.SMContext, nodeID pfcpType.No
 		}
 
 		if pendingUPF.IsEmpty() {
-			bpMGR.AddingPSAState = context.Finished
-			bpMGR.BPStatus = context.AddPSASuccess
-			logger.CtxLog.Infoln("[SMF] Add PSA success")
+			finishAddingPSA(smContext)
+		}
+	}
+}
+
+// activatePSA2 activates the first inactive data path as the PSA2 and establishes the PFCP sessions of its UPFs after
+// the ULCL, it fails if the data path has no branching point with the activated data paths
+func activatePSA2(smContext *context.SMContext) error {
+	bpMGR := smContext.BPManager
+	// select PSA2
+	bpMGR.SelectPSA2(smContext)
+	bpMGR.ActivatingPathRemoved = false
+	// select an upf as ULCL
+	if err := bpMGR.FindULCL(smContext); err != nil {
+		bpMGR.BPStatus = context.InitializedFail
+		return err
+	}
+	smContext.AllocateLocalSEIDForDataPath(bpMGR.ActivatingPath)
+
+	// Allocate Path PDR and TEID
+	bpMGR.ActivatingPath.ActivateTunnelAndPDR(smContext, 255)
+	// N1N2MessageTransfer Here
+
+	// Establish PSA2
+	EstablishPSA2(smContext)
+	return nil
+}
+
+// AddPSAForTrafficSteering inserts the ULCL and the PSA of the data paths steering the traffic of the PCC rules into
+// the PDU session, the data paths added during an ongoing insertion are activated after it finishes. A data path
+// which can't branch from the activated data paths is removed, the traffic of its PCC rule isn't steered.
+func AddPSAForTrafficSteering(smContext *context.SMContext) error {
+	bpMGR := smContext.BPManager
+	// the PDU session is modification pending after the SM policy decision is applied
+	if (smContext.SMContextState != context.Active && smContext.SMContextState != context.ModificationPending) ||
+		bpMGR.BPStatus == context.AddingPSA {
+		return nil
+	}
+	logger.PduSessLog.Infof("Add PSA for traffic steering of PDU session[%s-%02d]", smContext.Supi, smContext.PDUSessionID)
+	var steeringErr error
+	for smContext.Tunnel.DataPathPool.HasInactiveDataPath() {
+		bpMGR.BPStatus = context.AddingPSA
+		bpMGR.AddingPSAState = context.ActivatingDataPath
+		err := activatePSA2(smContext)
+		if err == nil {
+			break
+		}
+		dataPath := bpMGR.ActivatingPath
+		for _, pccRule := range smContext.PCCRules {
+			if pccRule.Datapath == dataPath {
+				pccRule.Datapath = nil
+			}
+		}
+		smContext.Tunnel.RemoveDataPath(dataPath)
+		steeringErr = fmt.Errorf("steer traffic to DNAI[%s] failed: %+v",
+			dataPath.Dnai(smContext.Snssai, smContext.Dnn), err)
+		logger.PduSessLog.Errorln(steeringErr)
+	}
+	return steeringErr
+}
+
+// RemovePSAForTrafficSteering removes the data path steering the traffic of a deleted PCC rule from the PDU session,
+// the data path being activated is removed after its activation finishes
+func RemovePSAForTrafficSteering(smContext *context.SMContext, dataPath *context.DataPath) {
+	bpMGR := smContext.BPManager
+	if bpMGR != nil && bpMGR.BPStatus == context.AddingPSA && bpMGR.ActivatingPath == dataPath {
+		bpMGR.ActivatingPathRemoved = true
+		return
+	}
+	if !dataPath.Activated {
+		smContext.Tunnel.RemoveDataPath(dataPath)
+		return
+	}
+	logger.PduSessLog.Infof("Remove PSA for traffic steering of PDU session[%s-%02d]",
+		smContext.Supi, smContext.PDUSessionID)
+	NotifyUpPathChange(smContext, dataPath.Dnai(smContext.Snssai, smContext.Dnn),
+		smContext.Tunnel.DataPathPool.GetDefaultPath().Dnai(smContext.Snssai, smContext.Dnn),
+		models.DnaiChangeType_LATE)
+	removePSA2(smContext, dataPath)
+}
+
+// removePSA2 removes the rules of the activated data path from the ULCL and the other UPFs shared with the activated
+// data paths, and deletes the PFCP sessions of the UPFs which only the data path traverses
+func removePSA2(smContext *context.SMContext, dataPath *context.DataPath) {
+	sharedUPFs := make(map[string]bool)
+	for _, path := range smContext.Tunnel.DataPathPool {
+		if path == dataPath || !path.Activated {
+			continue
+		}
+		for curDPNode := path.FirstDPNode; curDPNode != nil; curDPNode = curDPNode.Next() {
+			sharedUPFs[curDPNode.GetNodeIP()] = true
+		}
+	}
+
+	for curDPNode := dataPath.FirstDPNode; curDPNode != nil; curDPNode = curDPNode.Next() {
+		nodeID := curDPNode.UPF.NodeID
+		pdrList, farList := curDPNode.RemoveTunnels(smContext)
+		if sharedUPFs[curDPNode.GetNodeIP()] {
+			message.SendPfcpSessionModificationRequest(nodeID, smContext, pdrList, farList, nil, nil)
+		} else {
+			message.SendPfcpSessionDeletionRequest(nodeID, smContext)
+			smContext.RemovePFCPSessionContext(nodeID)
+		}
+	}
+	dataPath.Activated = false
+	smContext.Tunnel.RemoveDataPath(dataPath)
+}
+
+func finishAddingPSA(smContext *context.SMContext) {
+	bpMGR := smContext.BPManager
+	bpMGR.AddingPSAState = context.Finished
+	bpMGR.BPStatus = context.AddPSASuccess
+	logger.CtxLog.Infoln("[SMF] Add PSA success")
+	if bpMGR.ActivatingPathRemoved {
+		// the PCC rule of the data path is deleted during its activation
+		removePSA2(smContext, bpMGR.ActivatingPath)
+	} else {
+		NotifyUpPathChange(smContext, smContext.Tunnel.DataPathPool.GetDefaultPath().Dnai(smContext.Snssai,
+			smContext.Dnn), bpMGR.ActivatingPath.Dnai(smContext.Snssai, smContext.Dnn), models.DnaiChangeType_LATE)
+	}
+
+	if smContext.Tunnel.DataPathPool.HasInactiveDataPath() {
+		if err := AddPSAForTrafficSteering(smContext); err != nil {
+			logger.PduSessLog.Errorf("Add PSA for traffic steering failed: %+v", err)
 		}
 	}
 }
@@ -168,42 +278,7 @@ func EstablishULCL(smContext *context.SMContext) {
 			DownLinkPDR := curDPNode.DownLinkTunnel.PDR
 			UPLinkPDR.State = context.RULE_INITIAL
 
-			FlowDespcription := flowdesc.NewIPFilterRule()
-			err := FlowDespcription.SetAction(flowdesc.Permit) // permit
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-			}
-			err = FlowDespcription.SetDirection(flowdesc.Out) // uplink
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-			}
-			err = FlowDespcription.SetDestinationIP(dest.DestinationIP)
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-			}
-			err = FlowDespcription.SetDestinationPorts(dest.DestinationPort)
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-			}
-			err = FlowDespcription.SetSourceIP(smContext.PDUAddress.To4().String())
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-			}
-
-			FlowDespcriptionStr, err := flowdesc.Encode(FlowDespcription)
-			if err != nil {
-				logger.PduSessLog.Errorf("Error occurs when encoding flow despcription: %s\n", err)
-			}
-
-			UPLinkPDR.PDI.SDFFilter = &pfcpType.SDFFilter{
-				Bid:                     false,
-				Fl:                      false,
-				Spi:                     false,
-				Ttc:                     false,
-				Fd:                      true,
-				LengthOfFlowDescription: uint16(len(FlowDespcriptionStr)),
-				FlowDescription:         []byte(FlowDespcriptionStr),
-			}
+			setUplinkSteeringPDI(smContext, curDPNode.UPF, UPLinkPDR, dest)
 
 			UPLinkPDR.Precedence = 30
 
@@ -320,43 +395,7 @@ func UpdateRANAndIUPFUpLink(smContext *context.SMContext) {
 			DownLinkPDR.State = context.RULE_INITIAL
 
 			if _, exist := bpMGR.UpdatedBranchingPoint[curDPNode.UPF]; exist {
-				// add SDF Filter
-				FlowDespcription := flowdesc.NewIPFilterRule()
-				err := FlowDespcription.SetAction(flowdesc.Permit) // permit
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-				}
-				err = FlowDespcription.SetDirection(flowdesc.Out) // uplink
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-				}
-				err = FlowDespcription.SetDestinationIP(dest.DestinationIP)
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-				}
-				err = FlowDespcription.SetDestinationPorts(dest.DestinationPort)
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-				}
-				err = FlowDespcription.SetSourceIP(smContext.PDUAddress.To4().String())
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
-				}
-
-				FlowDespcriptionStr, err := flowdesc.Encode(FlowDespcription)
-				if err != nil {
-					logger.PduSessLog.Errorf("Error occurs when encoding flow despcription: %s\n", err)
-				}
-
-				UPLinkPDR.PDI.SDFFilter = &pfcpType.SDFFilter{
-					Bid:                     false,
-					Fl:                      false,
-					Spi:                     false,
-					Ttc:                     false,
-					Fd:                      true,
-					LengthOfFlowDescription: uint16(len(FlowDespcriptionStr)),
-					FlowDescription:         []byte(FlowDespcriptionStr),
-				}
+				setUplinkSteeringPDI(smContext, curDPNode.UPF, UPLinkPDR, dest)
 			}
 
 			pdrList := []*context.PDR{UPLinkPDR, DownLinkPDR}
@@ -371,10 +410,53 @@ func UpdateRANAndIUPFUpLink(smContext *context.SMContext) {
 	}
 
 	if bpMGR.PendingUPF.IsEmpty() {
-		bpMGR.AddingPSAState = context.Finished
-		bpMGR.BPStatus = context.AddPSASuccess
-		logger.CtxLog.Infoln("[SMF] Add PSA success")
+		finishAddingPSA(smContext)
 	} else {
 		bpMGR.AddingPSAState = context.UpdatingRANAndIUPFUpLink
 	}
 }
+
+// setUplinkSteeringPDI matches the uplink traffic to the destination of the activating path on the uplink PDR, the
+// traffic of the application is detected with the PFDs provisioned to the UPF in addition if the UPF supports PFDM
+func setUplinkSteeringPDI(smContext *context.SMContext, upf *context.UPF, pdr *context.PDR, dest context.Destination) {
+	if dest.ApplicationID != "" && upf.SupportPFDM() {
+		pdr.PDI.ApplicationID = dest.ApplicationID
+	}
+
+	FlowDespcription := flowdesc.NewIPFilterRule()
+	err := FlowDespcription.SetAction(flowdesc.Permit) // permit
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
+	}
+	err = FlowDespcription.SetDirection(flowdesc.Out) // uplink
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
+	}
+	err = FlowDespcription.SetDestinationIP(dest.DestinationIP)
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
+	}
+	err = FlowDespcription.SetDestinationPorts(dest.DestinationPort)
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
+	}
+	err = FlowDespcription.SetSourceIP(smContext.UEAddressFor(dest.DestinationIP))
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when setting flow despcription: %s\n", err)
+	}
+
+	FlowDespcriptionStr, err := flowdesc.Encode(FlowDespcription)
+	if err != nil {
+		logger.PduSessLog.Errorf("Error occurs when encoding flow despcription: %s\n", err)
+	}
+
+	pdr.PDI.SDFFilter = &pfcpType.SDFFilter{
+		Bid:                     false,
+		Fl:                      false,
+		Spi:                     false,
+		Ttc:                     false,
+		Fd:                      true,
+		LengthOfFlowDescription: uint16(len(FlowDespcriptionStr)),
+		FlowDescription:         []byte(FlowDespcriptionStr),
+	}
+}
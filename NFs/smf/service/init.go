@@ -10,6 +10,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
+	"github.com/free5gc/MongoDBLibrary"
+	mongoDBLibLogger "github.com/free5gc/MongoDBLibrary/logger"
 	aperLogger "github.com/free5gc/aper/logger"
 	"github.com/free5gc/http2_util"
 	"github.com/free5gc/logger_util"
@@ -227,6 +229,22 @@ func (smf *SMF) setLogLevel() {
 		}
 		pfcpLogger.SetReportCaller(factory.SmfConfig.Logger.PFCP.ReportCaller)
 	}
+
+	if factory.SmfConfig.Logger.MongoDBLibrary != nil {
+		if factory.SmfConfig.Logger.MongoDBLibrary.DebugLevel != "" {
+			if level, err := logrus.ParseLevel(factory.SmfConfig.Logger.MongoDBLibrary.DebugLevel); err != nil {
+				mongoDBLibLogger.MongoDBLog.Warnf("MongoDBLibrary Log level [%s] is invalid, set to [info] level",
+					factory.SmfConfig.Logger.MongoDBLibrary.DebugLevel)
+				mongoDBLibLogger.SetLogLevel(logrus.InfoLevel)
+			} else {
+				mongoDBLibLogger.SetLogLevel(level)
+			}
+		} else {
+			mongoDBLibLogger.MongoDBLog.Warnln("MongoDBLibrary Log level not set. Default set to [info] level")
+			mongoDBLibLogger.SetLogLevel(logrus.InfoLevel)
+		}
+		mongoDBLibLogger.SetReportCaller(factory.SmfConfig.Logger.MongoDBLibrary.ReportCaller)
+	}
 }
 
 func (smf *SMF) FilterCli(c *cli.Context) (args []string) {
@@ -247,6 +265,15 @@ func (smf *SMF) Start() {
 	// allocate id for each upf
 	context.AllocateUPFID()
 	context.InitSMFUERouting(&factory.UERoutingConfig)
+	context.InitSMFPFDs(&factory.UERoutingConfig)
+
+	// Connect to MongoDB, the UE addresses and SM contexts are persisted in it
+	if mongodb := factory.SmfConfig.Configuration.Mongodb; mongodb != nil {
+		MongoDBLibrary.SetMongoDB(mongodb.Name, mongodb.Url)
+		context.RestoreUeIPAddresses()
+		context.RestoreSMContexts()
+		context.ReleaseUnclaimedUeIPAddresses()
+	}
 
 	initLog.Infoln("Server started")
 	router := logger_util.NewGinWithLogrus(logger.GinLog)
@@ -289,6 +316,7 @@ func (smf *SMF) Start() {
 		}
 		message.SendPfcpAssociationSetupRequest(upf.NodeID)
 	}
+	pfcp.RunHeartbeat(context.SMF_Self().PFCPHeartbeatInterval)
 
 	time.Sleep(1000 * time.Millisecond)
 
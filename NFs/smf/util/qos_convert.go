@@ -9,9 +9,9 @@ func BitRateTokbps(bitrate string) uint64 {
 	s := strings.Split(bitrate, " ")
 	var kbps uint64
 
-	var digit int
+	var digit float64
 
-	if n, err := strconv.Atoi(s[0]); err != nil {
+	if n, err := strconv.ParseFloat(s[0], 64); err != nil {
 		return 0
 	} else {
 		digit = n
@@ -21,6 +21,45 @@ ENDIAN2(
     uint32_t    daddr;
 } __attribute__ ((packed)) IPv4Header;
 
+typedef struct {
+    uint32_t    vtcFlow;            // Version, traffic class and flow label
+    uint16_t    payloadLen;
+    uint8_t     nextHeader;
+    uint8_t     hopLimit;
+    uint8_t     saddr[16];
+    uint8_t     daddr[16];
+} __attribute__ ((packed)) IPv6Header;
+
+// ICMPv6 Router Advertisement of RFC 4861 4.2
+typedef struct {
+    uint8_t     type;
+    uint8_t     code;
+    uint16_t    check;
+    uint8_t     curHopLimit;
+    uint8_t     flags;
+    uint16_t    routerLifetime;
+    uint32_t    reachableTime;
+    uint32_t    retransTimer;
+} __attribute__ ((packed)) ICMPv6RAHeader;
+
+// ICMPv6 Prefix Information option of RFC 4861 4.6.2
+typedef struct {
+    uint8_t     type;
+    uint8_t     len;                // In units of 8 octets
+    uint8_t     prefixLen;
+    uint8_t     flags;
+    uint32_t    validLifetime;
+    uint32_t    preferredLifetime;
+    uint32_t    reserved;
+    uint8_t     prefix[16];
+} __attribute__ ((packed)) ICMPv6PrefixInfo;
+
+#define IPV6_NEXT_HEADER_ICMPV6             58
+#define ICMPV6_ROUTER_SOLICITATION          133
+#define ICMPV6_ROUTER_ADVERTISEMENT         134
+#define ICMPV6_OPTION_PREFIX_INFORMATION    3
+#define ICMPV6_PREFIX_FLAG_AUTONOMOUS       0x40
+
 typedef struct {
 	uint16_t	source;
 	uint16_t	dest;
@@ -343,6 +343,22 @@ Status _ConvertCreateFARTlvToRule(UpfFAR *upfFar, CreateFAR *createFar) {
     return STATUS_OK;
 }
 
+/*
+ * The UE of IPv6 session gets its /64 prefix by the router advertisement (TS 23.501 5.8.2.2.3),
+ * the UPF advertises it once the downlink FAR forwards the packets to the access network by GTP-U
+ */
+static void _SendRouterAdvertisement(UpfSession *session, UpfFAR *upfFar) {
+    uint8_t pdnType = session->pdn.paa.pdnType;
+    if (pdnType != PFCP_PDN_TYPE_IPV6 && pdnType != PFCP_PDN_TYPE_IPV4V6)
+        return;
+
+    if (!UpFARForwardToAccess(upfFar))
+        return;
+
+    UTLT_Assert(UpSendRouterAdvertisement(session, upfFar) == STATUS_OK, ,
+        "UpSendRouterAdvertisement failed: FAR ID[%u]", upfFar->farId);
+}
+
 Status UpfN4HandleCreateFar(UpfSession *session, CreateFAR *createFar) {
     UTLT_Debug("Handle Create FAR");
 
@@ -368,6 +384,8 @@ Status UpfN4HandleCreateFar(UpfSession *session, CreateFAR *createFar) {
     UTLT_Assert(UpfFARRegisterToSession(session, &upfFar),
         return STATUS_ERROR, "UpfFARRegisterToSession failed");
 
+    _SendRouterAdvertisement(session, &upfFar);
+
     return STATUS_OK;
 }
 
@@ -866,6 +884,8 @@ Status UpfN4HandleUpdateFar(UpfSession *session, UpdateFAR *updateFar) {
         }
     }
 
+    _SendRouterAdvertisement(session, &upfFar);
+
     return STATUS_OK;
 }
 
@@ -341,6 +341,49 @@ Status FindPDRByUEIP(uint8_t *pkt, uint16_t pktlen, uint32_t hdrlen, void *pdrBu
     return status;
 }
 
+/**
+ * HandleRouterSolicitation - Answer the router solicitation of the UE in T-PDU by the router advertisement
+ *
+ * @pkt: packet pointer which layer should upper or equal than GTP-U header
+ * @pktlen: total length of @pkt
+ * @hdrlen: Header length from @pkt to GTP-U header
+ * @return: 1 if the router solicitation is handled, 0 if it is not a router solicitation or -1 if handling failed
+ */
+static int HandleRouterSolicitation(uint8_t *pkt, uint16_t pktlen, uint16_t hdrlen) {
+    int gtpuLen = GTPUHeaderLen(pkt, pktlen, hdrlen);
+    if (gtpuLen < 0 || !PacketLenIsEnough(hdrlen + gtpuLen + sizeof(IPv6Header) + 1, pktlen))
+        return 0;
+
+    // The UE sends it from its link-local address, so it does NOT match the UE IP of the uplink PDR
+    IPv6Header *ip6h = (IPv6Header *) (pkt + hdrlen + gtpuLen);
+    uint8_t *icmp6 = (uint8_t *) ip6h + sizeof(IPv6Header);
+    if ((ntohl(ip6h->vtcFlow) >> 28) != 6 || ip6h->nextHeader != IPV6_NEXT_HEADER_ICMPV6 ||
+        *icmp6 != ICMPV6_ROUTER_SOLICITATION)
+        return 0;
+
+    Gtpv1Header *gtpHdr = (Gtpv1Header *) (pkt + hdrlen);
+    uint32_t teid = ntohl(gtpHdr->_teid);
+
+    const UpfSession *session = NULL;
+    MatchRuleNode *matchRule, *nextMatchRule = NULL;
+    TEID_HList_Thread_Safe(
+        ListHead *entry = &TEIDHList[MHash32(teid) % MAX_NUM_OF_H_LIST];
+        ListForEachSafe(matchRule, nextMatchRule, entry) {
+            if (matchRule->teid != teid)
+                continue;
+
+            UpfBufPacket *bufPacket = UpfBufPacketFindByPdrId(matchRule->pdr->pdrId);
+            if (bufPacket && bufPacket->sessionPtr) {
+                session = bufPacket->sessionPtr;
+                break;
+            }
+        }
+    );
+    UTLT_Assert(session, return -1, "Cannot find the session of router solicitation: TEID[%u]", teid);
+
+    return (UpHandleRouterSolicitation((UpfSession *) session) == STATUS_OK ? 1 : -1);
+}
+
 static int PacketInGTPUHandle(uint8_t *pkt, uint16_t pktlen, uint16_t hdrlen, uint32_t remoteIP, uint16_t _remotePort, MatchRuleNode *matchRule) {
     UTLT_Assert(PacketLenIsEnough(hdrlen + sizeof(Gtpv1Header), pktlen), return STATUS_ERROR,
         "Packet length is not enough");
@@ -354,6 +397,8 @@ static int PacketInGTPUHandle(uint8_t *pkt, uint16_t pktlen, uint16_t hdrlen, ui
     Gtpv1Header *gtpHdr = (Gtpv1Header *) (pkt + hdrlen);
     switch (gtpHdr->type) {
         case GTPV1_T_PDU: // Should be the first to speed up UP packet matching
+            if ((status = HandleRouterSolicitation(pkt, pktlen, hdrlen)))
+                return status;
             status = FindPDRByTEID(pkt, pktlen, sizeof(IPv4Header) + sizeof(UDPHeader), matchRule);
             return (status == STATUS_OK ? 0 : -1);
         case GTPV1_ECHO_REQUEST:
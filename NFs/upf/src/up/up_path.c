@@ -217,3 +217,121 @@ Status UpSendPacketByPdrFar(UpfPDR *pdr, UpfFAR *far, Sock *sock) {
 
     return status;
 }
+
+static uint16_t ICMPv6Checksum(IPv6Header *ip6h, uint8_t *icmp6, uint16_t len) {
+    uint32_t sum = 0;
+
+    // Pseudo header of RFC 8200 8.1
+    for (int i = 0; i < 16; i += 2) {
+        sum += (ip6h->saddr[i] << 8) | ip6h->saddr[i + 1];
+        sum += (ip6h->daddr[i] << 8) | ip6h->daddr[i + 1];
+    }
+    sum += len;
+    sum += ip6h->nextHeader;
+
+    for (int i = 0; i + 1 < len; i += 2)
+        sum += (icmp6[i] << 8) | icmp6[i + 1];
+    if (len & 1)
+        sum += icmp6[len - 1] << 8;
+
+    while (sum >> 16)
+        sum = (sum & 0xFFFF) + (sum >> 16);
+
+    return htons(~sum & 0xFFFF);
+}
+
+Status UpSendRouterAdvertisement(UpfSession *session, UpfFAR *far) {
+    UTLT_Assert(session, return STATUS_ERROR, "Session error");
+    UTLT_Assert(far, return STATUS_ERROR, "FAR error");
+
+    UTLT_Assert(far->flags.forwardingParameters && far->forwardingParameters.flags.outerHeaderCreation,
+        return STATUS_ERROR, "Need OuterHeaderCreation to send router advertisement");
+
+    UPDK_OuterHeaderCreation *outerHeaderCreation = &far->forwardingParameters.outerHeaderCreation;
+    if (!(outerHeaderCreation->description & UPDK_OUTER_HEADER_CREATION_DESCRIPTION_GTPU_UDP_IPV4)) {
+        UTLT_Warning("outer header creatation not implement: "
+                     "GTP-IPV6, IPV4, IPV6");
+        return STATUS_ERROR;
+    }
+
+    Sock *sock = &Self()->upSock;
+    UTLT_Assert(sock->localAddr._family == AF_INET, return STATUS_ERROR, "Do NOT support IPv6 yet");
+    sock->remoteAddr._family = sock->localAddr._family;
+    sock->remoteAddr._port = sock->localAddr._port;
+    sock->remoteAddr.s4.sin_addr = outerHeaderCreation->ipv4;
+
+    uint16_t icmp6Len = sizeof(ICMPv6RAHeader) + sizeof(ICMPv6PrefixInfo);
+    uint8_t pkt[sizeof(Gtpv1Header) + sizeof(IPv6Header) + sizeof(ICMPv6RAHeader) + sizeof(ICMPv6PrefixInfo)];
+    memset(pkt, 0, sizeof(pkt));
+
+    Gtpv1Header *gtpHdr = (Gtpv1Header *) pkt;
+    gtpHdr->flags = 0x30;
+    gtpHdr->type = GTPV1_T_PDU;
+    gtpHdr->_length = htons(sizeof(IPv6Header) + icmp6Len);
+    gtpHdr->_teid = htonl(outerHeaderCreation->teid);
+
+    // From the link-local address of the UPF to all nodes of the link
+    IPv6Header *ip6h = (IPv6Header *) (pkt + sizeof(Gtpv1Header));
+    ip6h->vtcFlow = htonl(0x60000000);
+    ip6h->payloadLen = htons(icmp6Len);
+    ip6h->nextHeader = IPV6_NEXT_HEADER_ICMPV6;
+    ip6h->hopLimit = 255;
+    ip6h->saddr[0] = 0xfe;
+    ip6h->saddr[1] = 0x80;
+    ip6h->saddr[15] = 0x01;
+    ip6h->daddr[0] = 0xff;
+    ip6h->daddr[1] = 0x02;
+    ip6h->daddr[15] = 0x01;
+
+    ICMPv6RAHeader *ra = (ICMPv6RAHeader *) ((uint8_t *) ip6h + sizeof(IPv6Header));
+    ra->type = ICMPV6_ROUTER_ADVERTISEMENT;
+    ra->curHopLimit = 64;
+    ra->routerLifetime = htons(9000);
+
+    // The /64 prefix is only used by the UE, so it is not on-link (TS 29.061 11.2.1.3.2)
+    ICMPv6PrefixInfo *prefixInfo = (ICMPv6PrefixInfo *) ((uint8_t *) ra + sizeof(ICMPv6RAHeader));
+    prefixInfo->type = ICMPV6_OPTION_PREFIX_INFORMATION;
+    prefixInfo->len = sizeof(ICMPv6PrefixInfo) / 8;
+    prefixInfo->prefixLen = 64;
+    prefixInfo->flags = ICMPV6_PREFIX_FLAG_AUTONOMOUS;
+    prefixInfo->validLifetime = 0xFFFFFFFF;
+    prefixInfo->preferredLifetime = 0xFFFFFFFF;
+    memcpy(prefixInfo->prefix, session->ueIpv6.addr6.s6_addr, 8);
+
+    ra->check = ICMPv6Checksum(ip6h, (uint8_t *) ra, icmp6Len);
+
+    char ipStr[INET6_ADDRSTRLEN];
+    inet_ntop(AF_INET6, prefixInfo->prefix, ipStr, INET6_ADDRSTRLEN);
+    UTLT_Debug("Send router advertisement of prefix %s/64 to TEID[%u]", ipStr, outerHeaderCreation->teid);
+
+    UTLT_Assert(UdpSendTo(sock, pkt, sizeof(pkt)) == STATUS_OK, return STATUS_ERROR,
+                "UdpSendTo failed");
+
+    return STATUS_OK;
+}
+
+int UpFARForwardToAccess(UpfFAR *far) {
+    UPDK_ForwardingParameters *forwardingParameters = &far->forwardingParameters;
+    return (far->applyAction & PFCP_FAR_APPLY_ACTION_FORW) && far->flags.forwardingParameters &&
+           forwardingParameters->flags.destinationInterface &&
+           forwardingParameters->destinationInterface == UPDK_INTERFACE_VALUE_ACCESS &&
+           forwardingParameters->flags.outerHeaderCreation;
+}
+
+Status UpHandleRouterSolicitation(UpfSession *session) {
+    UTLT_Assert(session, return STATUS_ERROR, "Session error");
+
+    uint8_t pdnType = session->pdn.paa.pdnType;
+    UTLT_Assert(pdnType == PFCP_PDN_TYPE_IPV6 || pdnType == PFCP_PDN_TYPE_IPV4V6, return STATUS_ERROR,
+                "Router solicitation in the session without IPv6: SEID[%lu]", session->upfSeid);
+
+    UpfFARNode *node, *nextNode = NULL;
+    ListForEachSafe(node, nextNode, &session->farList) {
+        if (UpFARForwardToAccess(&node->far))
+            return UpSendRouterAdvertisement(session, &node->far);
+    }
+
+    // The router advertisement is sent once the downlink FAR is created or updated
+    UTLT_Debug("No downlink FAR to answer router solicitation yet: SEID[%lu]", session->upfSeid);
+    return STATUS_OK;
+}
@@ -21,5 +21,30 @@ Status BufferHandler(Sock *sock, void *data);
 
 Status UpSendPacketByPdrFar(UpfPDR *pdr, UpfFAR *far, Sock *sock);
 
+/**
+ * UpSendRouterAdvertisement - Send the router advertisement of the /64 prefix of the IPv6 session to the UE
+ *
+ * @session: the IPv6 or IPv4v6 session
+ * @far: the FAR forwarding the downlink packets to the access network by GTP-U
+ * @return: STATUS_OK if the router advertisement is sent
+ */
+Status UpSendRouterAdvertisement(UpfSession *session, UpfFAR *far);
+
+/**
+ * UpFARForwardToAccess - Check the FAR forwards the downlink packets to the access network by GTP-U
+ *
+ * @far: the FAR to check
+ * @return: 1 if the FAR forwards to the access network with outer header creation, otherwise 0
+ */
+int UpFARForwardToAccess(UpfFAR *far);
+
+/**
+ * UpHandleRouterSolicitation - Answer the router solicitation of the UE by the router advertisement
+ *
+ * @session: the session whose uplink tunnel carries the router solicitation
+ * @return: STATUS_OK if the router advertisement is sent
+ */
+Status UpHandleRouterSolicitation(UpfSession *session);
+
 
 #endif /* __UP_PATH_H_ */
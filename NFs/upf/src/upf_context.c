@@ -574,19 +574,9 @@ UpfSession *UpfSessionAdd(PfcpUeIpAddr *ueIp, uint8_t *dnn,
         session->ueIpv6.addr6 = ueIp->addr6;
         //session->pdn.paa.addr6 = ueIp->addr6;
     } else if (pdnType == PFCP_PDN_TYPE_IPV4V6) {
-        // TODO
-        // session->ueIpv4 = UpfUeIPAlloc(AF_INET, dnn);
-        // UTLT_Assert(session->ueIpv4,
-        //   UpfSessionRemove(session); return NULL,
-        //   "Cannot allocate IPv4");
-
-        // session->ueIpv6 = UpfUeIPAlloc(AF_INET6, dnn);
-        // UTLT_Assert(session->ueIpv6,
-        //   UpfSessionRemove(session); return NULL,
-        //   "Cannot allocate IPv6");
-
-        // session->pdn.paa.dualStack.addr4 = session->ueIpv4->addr4;
-        // session->pdn.paa.dualStack.addr6 = session->ueIpv6->addr6;
+        // The UE IP address of IPv4v6 session carries both addresses
+        session->ueIpv4.addr4 = ueIp->dualStack.addr4;
+        session->ueIpv6.addr6 = ueIp->dualStack.addr6;
     } else {
         UTLT_Assert(0, return NULL, "UnSupported PDN Type(%d)", pdnType);
     }
@@ -152,8 +152,11 @@ int _SetGtp5gPdr(UpfPdr *upfPdr, UPDK_PDR *pdr) {
         if (pdi->flags.ueIpAddress) {
             UPDK_UEIPAddress *ueIp = &pdi->ueIpAddress;
             if (ueIp->flags.v4 && ueIp->flags.v6) {
-                // TODO: Dual Stack
-                UTLT_Warning("Do NOT support dual stack in UE IP Address yet");
+                // TODO: Need to handle IPv6 with gtp5g and libgtp5gnl, only IPv4 is matched in dual stack
+                gtp5g_pdr_set_ue_addr_ipv4(upfPdr, &(ueIp->ipv4));
+                inet_ntop(AF_INET, &(ueIp->ipv4), ipStr, INET_ADDRSTRLEN);
+                UTLT_Debug("gtp5g set PDI UE IP Address: %s", ipStr);
+                UTLT_Warning("Do NOT support IPv6 in dual stack UE IP Address yet");
             } else if (ueIp->flags.v4) {
                 gtp5g_pdr_set_ue_addr_ipv4(upfPdr, &(ueIp->ipv4));
                 inet_ntop(AF_INET, &(ueIp->ipv4), ipStr, INET_ADDRSTRLEN);
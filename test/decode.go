@@ -18,3 +18,30 @@ func GetNasPdu(ue *RanUeContext, msg *ngapType.DownlinkNASTransport) (m *nas.Mes
 	}
 	return nil
 }
+
+// GetPDUSessionNasPdu returns the 5GSM message carried in the PDU Session Resource Setup Request for the PDU session
+func GetPDUSessionNasPdu(ue *RanUeContext, msg *ngapType.PDUSessionResourceSetupRequest,
+	pduSessionID int64) (m *nas.Message) {
+	for _, ie := range msg.ProtocolIEs.List {
+		if ie.Id.Value != ngapType.ProtocolIEIDPDUSessionResourceSetupListSUReq {
+			continue
+		}
+		for _, item := range ie.Value.PDUSessionResourceSetupListSUReq.List {
+			if item.PDUSessionID.Value != pduSessionID || item.PDUSessionNASPDU == nil {
+				continue
+			}
+			pkg := []byte(item.PDUSessionNASPDU.Value)
+			dlNasTransport, err := NASDecode(ue, nas.GetSecurityHeaderType(pkg), pkg)
+			if err != nil || dlNasTransport.GmmMessage == nil || dlNasTransport.DLNASTransport == nil {
+				return nil
+			}
+			container := dlNasTransport.DLNASTransport.GetPayloadContainerContents()
+			m = nas.NewMessage()
+			if err := m.GsmMessageDecode(&container); err != nil {
+				return nil
+			}
+			return m
+		}
+	}
+	return nil
+}
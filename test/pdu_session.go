@@ -0,0 +1,40 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/free5gc/nas"
+)
+
+// SetPduSessionType rewrites the PDU session type of the PDU Session Establishment Request carried in the plain
+// UL NAS Transport message pdu, nasTestpacket always requests an IPv4 PDU session
+func SetPduSessionType(pdu []byte, pduSessionType uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	if err := m.PlainNasDecode(&pdu); err != nil {
+		return nil, err
+	}
+	if m.GmmMessage == nil || m.GmmMessage.ULNASTransport == nil {
+		return nil, fmt.Errorf("not a UL NAS Transport message")
+	}
+	ulNasTransport := m.GmmMessage.ULNASTransport
+
+	container := ulNasTransport.PayloadContainer.GetPayloadContainerContents()
+	gsm := nas.NewMessage()
+	if err := gsm.GsmMessageDecode(&container); err != nil {
+		return nil, err
+	}
+	request := gsm.GsmMessage.PDUSessionEstablishmentRequest
+	if request == nil || request.PDUSessionType == nil {
+		return nil, fmt.Errorf("not a PDU Session Establishment Request with PDU session type")
+	}
+	request.PDUSessionType.SetPDUSessionTypeValue(pduSessionType)
+
+	data := new(bytes.Buffer)
+	if err := gsm.GsmMessageEncode(data); err != nil {
+		return nil, err
+	}
+	ulNasTransport.PayloadContainer.SetLen(uint16(data.Len()))
+	ulNasTransport.PayloadContainer.SetPayloadContainerContents(data.Bytes())
+	return m.PlainNasEncode()
+}